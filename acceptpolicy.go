@@ -0,0 +1,50 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// acceptpolicy implements a hook that embedders can set on the DHT to decide which of
+// the messages it receives it acts on, for admission control like allowlists of peers
+
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Decision is an accept policy's decision about a message
+type Decision int
+
+const (
+	Accept Decision = iota
+	Reject
+)
+
+var ErrRejectedByPolicy = errors.New("message rejected by accept policy")
+
+// AcceptPolicy decides whether the DHT acts on a message it received, from the network
+// or from gossip.  from is the peer the message came from: its sender, or for gossiped
+// messages the peer gossiping it, as a gossiped message's From can't be checked.  It is
+// called concurrently so must be safe for concurrent use.
+type AcceptPolicy func(from peer.ID, msg *Message) Decision
+
+// SetAcceptPolicy sets the policy consulted before the DHT acts on a message, nil to
+// accept all of them.  It is consulted on our own messages too.
+func (dht *DHT) SetAcceptPolicy(policy AcceptPolicy) {
+	dht.policyLk.Lock()
+	defer dht.policyLk.Unlock()
+	dht.acceptPolicy = policy
+}
+
+// accepts returns whether the accept policy lets the DHT act on a message that came
+// from the peer
+func (dht *DHT) accepts(from peer.ID, msg *Message) bool {
+	dht.policyLk.RLock()
+	policy := dht.acceptPolicy
+	dht.policyLk.RUnlock()
+	if policy == nil || policy(from, msg) == Accept {
+		return true
+	}
+	dht.dlog.Logf("accept policy rejected %v from %v", msg.Type, peer.IDB58Encode(from))
+	return false
+}
@@ -0,0 +1,75 @@
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAcceptPolicy(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	hash := commit(h, "oddNumbers", "3")
+	allowed, _ := makePeer("peer_allowed")
+	other, _ := makePeer("peer_other")
+
+	var seen []MsgType
+	h.dht.SetAcceptPolicy(func(from peer.ID, msg *Message) Decision {
+		seen = append(seen, msg.Type)
+		if from == allowed {
+			return Accept
+		}
+		return Reject
+	})
+	defer h.dht.SetAcceptPolicy(nil)
+
+	get := func(from *Message) error {
+		_, err := ActionReceiver(h, from)
+		return err
+	}
+	req := GetReq{H: hash, StatusMask: StatusDefault, GetMask: GetMaskEntry}
+
+	Convey("the policy should decide which messages are acted on", t, func() {
+		m := h.node.NewMessage(GET_REQUEST, req)
+		m.From = other
+		So(get(m), ShouldEqual, ErrRejectedByPolicy)
+		m.From = allowed
+		So(get(m), ShouldBeNil)
+		So(seen, ShouldResemble, []MsgType{GET_REQUEST, GET_REQUEST})
+	})
+
+	Convey("our own messages should be put to the policy too", t, func() {
+		seen = nil
+		So(get(h.node.NewMessage(GET_REQUEST, req)), ShouldEqual, ErrRejectedByPolicy)
+		So(seen, ShouldResemble, []MsgType{GET_REQUEST})
+	})
+
+	Convey("gossiped messages should be decided on by who gossiped them", t, func() {
+		m := h.node.NewMessage(GET_REQUEST, req)
+		m.From = allowed
+		_, err := receiveAction(h, other, m)
+		So(err, ShouldEqual, ErrRejectedByPolicy)
+		m.From = other
+		_, err = receiveAction(h, allowed, m)
+		So(err, ShouldBeNil)
+
+		put := h.node.NewMessage(PUT_REQUEST, PutReq{H: hash})
+		put.From = allowed
+		_, err = validateGossipedPut(h, other, put)
+		So(err, ShouldEqual, ErrRejectedByPolicy)
+	})
+
+	Convey("rejections should reach the sender as such", t, func() {
+		err := NewErrorResponse(ErrRejectedByPolicy).DecodeResponseError()
+		So(errors.Is(err, ErrRejectedByPolicy), ShouldBeTrue)
+		So(ErrorCode(err), ShouldEqual, ErrorCodeRejectedByPolicy)
+	})
+
+	Convey("a nil policy should accept everything", t, func() {
+		h.dht.SetAcceptPolicy(nil)
+		m := h.node.NewMessage(GET_REQUEST, req)
+		m.From = other
+		So(get(m), ShouldBeNil)
+	})
+}
@@ -5,11 +5,14 @@
 package holochain
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"io"
 	"reflect"
+	"sync"
 	"time"
 )
 
@@ -33,6 +36,9 @@ type Arg struct {
 	Type     ArgType
 	Optional bool
 	MapType  reflect.Type
+	Default  interface{} // value used when an optional arg or field is missing
+	Enum     []string    // allowed values of a string arg or field
+	Fields   []Arg       // specs of the fields of a MapArg
 	value    interface{}
 }
 
@@ -67,6 +73,13 @@ type ValidatingAction interface {
 	Args() []Arg
 }
 
+// BuiltinAction provides an abstraction for the parts of an action needed to expose it
+// as a ribosome built-in function
+type BuiltinAction interface {
+	Name() string
+	Args() []Arg
+}
+
 var NonDHTAction error = errors.New("Not a DHT action")
 var NonCallableAction error = errors.New("Not a callable action")
 
@@ -102,6 +115,10 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 		if err != nil {
 			return
 		}
+		if h.config.ValidationDebug {
+			start := time.Now()
+			defer func() { h.recordTranscript(a, entryType, z.Name, vpkg, sources, start, err) }()
+		}
 
 		// run the action's system level validations
 		err = a.SysValidation(h, d, sources)
@@ -110,14 +127,44 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 			return
 		}
 
-		// run the action's app level validations
+		// header times must be plausible whatever the app's rules
+		if hd := validatedHeader(a); hd != nil {
+			err = h.checkHeaderTime(hd, h.prevHeader(hd, vpkg, sources), time.Now())
+			if err != nil {
+				return
+			}
+			if err = h.checkHeaderTimestamps(hd); err != nil {
+				return
+			}
+			if err = checkDisclosureRoot(d, hd, validatedEntry(a)); err != nil {
+				return
+			}
+		}
+
+		// run the action's app level validations.  Only the author of an encrypted
+		// entry can check its content, but holders still run the app's mod validation,
+		// given the sealed entry, so it can check the header and who is modifying it.
+		if e := validatedEntry(a); d.Sharing == Encrypted && e != nil {
+			if _, isMod := a.(*ActionMod); !isMod {
+				if _, ok := sealedContent(e); ok {
+					return
+				}
+			}
+		}
 		var n Ribosome
 		n, err = z.MakeRibosome(h)
 		if err != nil {
 			return
 		}
 
+		err = h.addChainRate(n, a, d, vpkg)
+		if err != nil {
+			return
+		}
+
+		vmStart := time.Now()
 		err = n.ValidateAction(a, d, vpkg, prepareSources(sources))
+		h.recordVM(vmStart)
 		if err != nil {
 			Debugf("Ribosome ValidateAction(%T) err:%v\n", a, err)
 		}
@@ -125,12 +172,72 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 	return
 }
 
+// validatedHeader returns the header of the entry an action is validating if it has one
+func validatedHeader(a ValidatingAction) (header *Header) {
+	switch t := a.(type) {
+	case *ActionCommit:
+		header = t.header
+	case *ActionPut:
+		header = t.header
+	case *ActionMod:
+		header = t.header
+	}
+	return
+}
+
+// validatedEntry returns the entry an action is validating if it has one
+func validatedEntry(a ValidatingAction) (entry Entry) {
+	switch t := a.(type) {
+	case *ActionCommit:
+		entry = t.entry
+	case *ActionPut:
+		entry = t.entry
+	case *ActionMod:
+		entry = t.entry
+	}
+	return
+}
+
+// addChainRate adds the chain rate to the validation package if the app's packaging
+// request asks for one.  The request is made by the validating node's own ribosome so
+// the author can't change the windows the rate is counted over.
+func (h *Holochain) addChainRate(n Ribosome, a ValidatingAction, d *EntryDef, vpkg *ValidationPackage) (err error) {
+	hd := validatedHeader(a)
+	if hd == nil {
+		return
+	}
+	// a commit is checked against the rate its put will be validated with
+	pa := a
+	if c, ok := a.(*ActionCommit); ok {
+		pa = NewPutAction(c.entryType, c.entry, c.header)
+	}
+	var req PackagingReq
+	if req, err = n.ValidatePackagingRequest(pa, d); err != nil {
+		return
+	}
+	r, ok := req[PkgReqRate]
+	if !ok {
+		return
+	}
+	var minutes, headers int
+	if minutes, headers, err = parseRateReq(r); err != nil {
+		return
+	}
+	// validators count the author's chain from the package, authors their own chain
+	chain := h.chain
+	if vpkg.Chain != nil {
+		chain = vpkg.Chain
+	}
+	vpkg.Rate = countChainRate(chain, hd, minutes, headers)
+	return
+}
+
 // GetValidationResponse check the validation request and builds the validation package based
 // on the app's requirements
 func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp ValidateResponse, err error) {
 	var entry Entry
 	entry, resp.Type, err = h.chain.GetEntry(hash)
-	if err == ErrHashNotFound {
+	if errors.Is(err, ErrHashNotFound) {
 		if hash.String() == h.nodeIDStr {
 			resp.Type = KeyEntryType
 			err = nil
@@ -152,9 +259,17 @@ func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp V
 	case DNAEntryType:
 		panic("attempt to get validation response for DNA")
 	case KeyEntryType:
-		//		resp.Entry = TODO public key goes here
+		// the header of the agent entry lets the key's holders link the key to it
+		resp.Entry = GobEntry{C: h.nodeIDStr}
+		_, hd := h.chain.TopType(AgentEntryType)
+		if hd == nil {
+			err = ErrHashNotFound
+			return
+		}
+		resp.Header = *hd
 	case AgentEntryType:
-		//		resp.Entry = TODO agent block goes here
+		// include the genesis headers so that DHT nodes can hold them for chain regeneration
+		resp.Package, err = MakePackage(h, PackagingReq{PkgReqChain: int64(PkgReqChainOptHeaders), PkgReqEntryTypes: []string{AgentEntryType}})
 	default:
 		// app defined entry types
 		var def *EntryDef
@@ -204,12 +319,24 @@ func MakeActionFromMessage(msg *Message) (a Action, err error) {
 	case DEL_REQUEST:
 		a = &ActionDel{}
 		t = reflect.TypeOf(DelReq{})
+	case STATUS_REQUEST:
+		a = &ActionSetStatus{}
+		t = reflect.TypeOf(StatusReq{})
 	case LINK_REQUEST:
 		a = &ActionLink{}
 		t = reflect.TypeOf(LinkReq{})
 	case GETLINK_REQUEST:
 		a = &ActionGetLink{}
 		t = reflect.TypeOf(LinkQuery{})
+	case GETLINKS_REQUEST:
+		a = &ActionGetLinks{}
+		t = reflect.TypeOf(LinksQuery{})
+	case GET_HEADERS_REQUEST:
+		a = &ActionGetHeaders{}
+		t = reflect.TypeOf(HeadersReq{})
+	case RECEIPT_REQUEST:
+		a = &ActionReceipt{}
+		t = reflect.TypeOf(ReceiptReq{})
 	default:
 		err = fmt.Errorf("message type %d not in holochain-action protocol", int(msg.Type))
 	}
@@ -235,7 +362,7 @@ func checkArgCount(args []Arg, l int) (err error) {
 }
 
 func argErr(typeName string, index int, arg Arg) error {
-	return fmt.Errorf("argument %d (%s) should be %s", index, arg.Name, typeName)
+	return &wrappedError{msg: fmt.Sprintf("argument %d (%s) should be %s", index, arg.Name, typeName), err: ErrInvalidArgs}
 }
 
 //------------------------------------------------------------
@@ -263,6 +390,32 @@ func (a *ActionProperty) Do(h *Holochain) (response interface{}, err error) {
 	return
 }
 
+//------------------------------------------------------------
+// Config
+
+type ActionConfig struct {
+	zome string
+	key  string
+}
+
+func NewConfigAction(zome string, key string) *ActionConfig {
+	a := ActionConfig{zome: zome, key: key}
+	return &a
+}
+
+func (a *ActionConfig) Name() string {
+	return "config"
+}
+
+func (a *ActionConfig) Args() []Arg {
+	return []Arg{{Name: "key", Type: StringArg}}
+}
+
+func (a *ActionConfig) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.ZomeConfig(a.zome, a.key)
+	return
+}
+
 //------------------------------------------------------------
 // Debug
 
@@ -318,6 +471,217 @@ func (a *ActionMakeHash) Do(h *Holochain) (response interface{}, err error) {
 	return
 }
 
+//------------------------------------------------------------
+// LocalStore
+
+type ActionLocalStoreSet struct {
+	zome  string
+	key   string
+	value string
+}
+
+func NewLocalStoreSetAction(zome string, key string, value string) *ActionLocalStoreSet {
+	a := ActionLocalStoreSet{zome: zome, key: key, value: value}
+	return &a
+}
+
+func (a *ActionLocalStoreSet) Name() string {
+	return "localStore.set"
+}
+
+func (a *ActionLocalStoreSet) Args() []Arg {
+	return []Arg{{Name: "key", Type: StringArg}, {Name: "value", Type: ToStrArg}}
+}
+
+func (a *ActionLocalStoreSet) Do(h *Holochain) (response interface{}, err error) {
+	err = h.dht.localStoreSet(a.zome, a.key, a.value)
+	return
+}
+
+type ActionLocalStoreGet struct {
+	zome string
+	key  string
+}
+
+func NewLocalStoreGetAction(zome string, key string) *ActionLocalStoreGet {
+	a := ActionLocalStoreGet{zome: zome, key: key}
+	return &a
+}
+
+func (a *ActionLocalStoreGet) Name() string {
+	return "localStore.get"
+}
+
+func (a *ActionLocalStoreGet) Args() []Arg {
+	return []Arg{{Name: "key", Type: StringArg}}
+}
+
+func (a *ActionLocalStoreGet) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.dht.localStoreGet(a.zome, a.key)
+	return
+}
+
+type ActionLocalStoreDel struct {
+	zome string
+	key  string
+}
+
+func NewLocalStoreDelAction(zome string, key string) *ActionLocalStoreDel {
+	a := ActionLocalStoreDel{zome: zome, key: key}
+	return &a
+}
+
+func (a *ActionLocalStoreDel) Name() string {
+	return "localStore.del"
+}
+
+func (a *ActionLocalStoreDel) Args() []Arg {
+	return []Arg{{Name: "key", Type: StringArg}}
+}
+
+func (a *ActionLocalStoreDel) Do(h *Holochain) (response interface{}, err error) {
+	err = h.dht.localStoreDel(a.zome, a.key)
+	return
+}
+
+//------------------------------------------------------------
+// StreamWrite
+
+type ActionStreamWrite struct {
+	w    io.Writer
+	data string
+}
+
+func NewStreamWriteAction(w io.Writer, data string) *ActionStreamWrite {
+	a := ActionStreamWrite{w: w, data: data}
+	return &a
+}
+
+func (a *ActionStreamWrite) Name() string {
+	return "stream.write"
+}
+
+func (a *ActionStreamWrite) Args() []Arg {
+	return []Arg{{Name: "data", Type: ToStrArg}}
+}
+
+func (a *ActionStreamWrite) Do(h *Holochain) (response interface{}, err error) {
+	if a.w == nil {
+		err = ErrNoStream
+		return
+	}
+	_, err = io.WriteString(a.w, a.data)
+	return
+}
+
+//------------------------------------------------------------
+// SpawnTask
+
+type ActionSpawnTask struct {
+	zome     string
+	function string
+	args     string
+}
+
+func NewSpawnTaskAction(zome string, function string, args string) *ActionSpawnTask {
+	a := ActionSpawnTask{zome: zome, function: function, args: args}
+	return &a
+}
+
+func (a *ActionSpawnTask) Name() string {
+	return "spawnTask"
+}
+
+func (a *ActionSpawnTask) Args() []Arg {
+	return []Arg{{Name: "function", Type: StringArg}, {Name: "args", Type: ArgsArg}}
+}
+
+func (a *ActionSpawnTask) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.tasks.Spawn(a.zome, a.function, a.args)
+	return
+}
+
+//------------------------------------------------------------
+// TaskProgress
+
+type ActionTaskProgress struct {
+	id       string
+	progress int
+	message  string
+}
+
+func NewTaskProgressAction(id string, progress int, message string) *ActionTaskProgress {
+	a := ActionTaskProgress{id: id, progress: progress, message: message}
+	return &a
+}
+
+func (a *ActionTaskProgress) Name() string {
+	return "taskProgress"
+}
+
+func (a *ActionTaskProgress) Args() []Arg {
+	return []Arg{{Name: "id", Type: StringArg}, {Name: "progress", Type: IntArg}, {Name: "message", Type: StringArg, Optional: true, Default: ""}}
+}
+
+func (a *ActionTaskProgress) Do(h *Holochain) (response interface{}, err error) {
+	err = h.tasks.SetProgress(a.id, a.progress, a.message)
+	return
+}
+
+//------------------------------------------------------------
+// GetTask
+
+type ActionGetTask struct {
+	id string
+}
+
+func NewGetTaskAction(id string) *ActionGetTask {
+	a := ActionGetTask{id: id}
+	return &a
+}
+
+func (a *ActionGetTask) Name() string {
+	return "getTask"
+}
+
+func (a *ActionGetTask) Args() []Arg {
+	return []Arg{{Name: "id", Type: StringArg}}
+}
+
+func (a *ActionGetTask) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.tasks.Get(a.id)
+	return
+}
+
+//------------------------------------------------------------
+// GetBridges
+
+type ActionGetBridges struct {
+}
+
+func NewGetBridgesAction() *ActionGetBridges {
+	a := ActionGetBridges{}
+	return &a
+}
+
+func (a *ActionGetBridges) Name() string {
+	return "getBridges"
+}
+
+func (a *ActionGetBridges) Args() []Arg {
+	return []Arg{}
+}
+
+func (a *ActionGetBridges) Do(h *Holochain) (response interface{}, err error) {
+	// the tokens are only for making calls over the bridges
+	bridges := h.Bridges()
+	for i := range bridges {
+		bridges[i].Token = ""
+	}
+	response = bridges
+	return
+}
+
 //------------------------------------------------------------
 // Call
 
@@ -345,12 +709,48 @@ func (a *ActionCall) Do(h *Holochain) (response interface{}, err error) {
 	return
 }
 
+//------------------------------------------------------------
+// Bridge
+
+type ActionBridge struct {
+	toApp    string
+	zome     string
+	function string
+	args     interface{}
+}
+
+func NewBridgeAction(toApp string, zome string, function string, args interface{}) *ActionBridge {
+	a := ActionBridge{toApp: toApp, zome: zome, function: function, args: args}
+	return &a
+}
+
+func (a *ActionBridge) Name() string {
+	return "bridge"
+}
+
+func (a *ActionBridge) Args() []Arg {
+	return []Arg{{Name: "toApp", Type: StringArg}, {Name: "zome", Type: StringArg}, {Name: "function", Type: StringArg}, {Name: "args", Type: ArgsArg}}
+}
+
+func (a *ActionBridge) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.BridgeCall(a.toApp, a.zome, a.function, a.args)
+	return
+}
+
 //------------------------------------------------------------
 // Send
 
 type ActionSend struct {
-	to  peer.ID
-	msg AppMsg
+	to      peer.ID
+	msg     AppMsg
+	options SendOptions
+}
+
+// SendOptions options to the send function
+type SendOptions struct {
+	Ephemeral bool // authenticate the message deniably with a one-time key exchange
+	Async     bool // send in the background returning an id for getMessageStatus
+	Encrypted bool // encrypt the message and its reply so that only the two agents can read them
 }
 
 func NewSendAction(to peer.ID, msg AppMsg) *ActionSend {
@@ -363,27 +763,61 @@ func (a *ActionSend) Name() string {
 }
 
 func (a *ActionSend) Args() []Arg {
-	return []Arg{{Name: "to", Type: HashArg}, {Name: "msg", Type: MapArg}}
+	return []Arg{{Name: "to", Type: HashArg}, {Name: "msg", Type: MapArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(SendOptions{}), Optional: true}}
 }
 
 func (a *ActionSend) Do(h *Holochain) (response interface{}, err error) {
+	if a.options.Ephemeral {
+		if err = h.authAppMsg(a.to, &a.msg); err != nil {
+			return
+		}
+	}
+	if a.options.Encrypted {
+		if err = h.sealAppMsg(a.to, &a.msg); err != nil {
+			return
+		}
+	}
+	if a.options.Async {
+		response = h.messages.Send(a.to, a.msg)
+		return
+	}
 	var r interface{}
 	r, err = h.Send(ActionProtocol, a.to, APP_MESSAGE, a.msg)
 	if err == nil {
-		response = r.(AppMsg).Body
+		response, err = h.openAppMsg(r.(AppMsg))
 	}
 	return
 }
 
 func (a *ActionSend) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
 	t := msg.Body.(AppMsg)
+	if t.Enc != nil {
+		if t.Body, err = dht.h.openAppMsg(t); err != nil {
+			return
+		}
+	}
+	if t.Auth != nil {
+		if err = dht.h.checkAppMsgAuth(msg.From, t); err != nil {
+			return
+		}
+	}
 	var r Ribosome
 	r, _, err = dht.h.MakeRibosome(t.ZomeType)
 	if err != nil {
 		return
 	}
+	from := peer.IDB58Encode(msg.From)
+	ctx := HookContext{Point: HookOnReceive, Zome: t.ZomeType, Function: "receive", Agent: from, Args: t.Body, Start: time.Now()}
+	err = dht.h.runHooks(&ctx)
+	if err != nil {
+		return
+	}
 	rsp := AppMsg{ZomeType: t.ZomeType}
-	rsp.Body, err = r.Receive(peer.IDB58Encode(msg.From), t.Body)
+	rsp.Body, err = r.Receive(from, t.Body)
+	if err == nil && t.Enc != nil {
+		// encrypted messages get encrypted replies
+		err = dht.h.sealAppMsg(msg.From, &rsp)
+	}
 	if err == nil {
 		response = rsp
 	}
@@ -391,53 +825,403 @@ func (a *ActionSend) Receive(dht *DHT, msg *Message) (response interface{}, err
 }
 
 //------------------------------------------------------------
-// Get
+// GetMessageStatus
 
-type ActionGet struct {
-	req     GetReq
-	options *GetOptions
+type ActionGetMessageStatus struct {
+	id string
 }
 
-func NewGetAction(req GetReq, options *GetOptions) *ActionGet {
-	a := ActionGet{req: req, options: options}
+func NewGetMessageStatusAction(id string) *ActionGetMessageStatus {
+	a := ActionGetMessageStatus{id: id}
 	return &a
 }
 
-func (a *ActionGet) Name() string {
-	return "get"
+func (a *ActionGetMessageStatus) Name() string {
+	return "getMessageStatus"
 }
 
-func (a *ActionGet) Args() []Arg {
-	return []Arg{{Name: "hash", Type: HashArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(GetOptions{}), Optional: true}}
+func (a *ActionGetMessageStatus) Args() []Arg {
+	return []Arg{{Name: "id", Type: StringArg}}
 }
 
-func (a *ActionGet) Do(h *Holochain) (response interface{}, err error) {
-	if a.options.Local {
-		var entry Entry
-		var entryType string
-		entry, entryType, err = h.chain.GetEntry(a.req.H)
-		if err != nil {
-			return
-		}
-		resp := GetResp{Entry: entry}
-		mask := a.options.GetMask
-		if (mask & GetMaskEntryType) != 0 {
-			resp.EntryType = entryType
-		}
-		if (mask & GetMaskEntry) != 0 {
-			resp.Entry = entry
-		}
+func (a *ActionGetMessageStatus) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.messages.Get(a.id)
+	return
+}
 
-		response = resp
-		return
+//------------------------------------------------------------
+// MakeProof
+
+type ActionMakeProof struct {
+	entryType string
+	field     string
+	value     interface{}
+}
+
+func NewMakeProofAction(entryType string, field string, value interface{}) *ActionMakeProof {
+	a := ActionMakeProof{entryType: entryType, field: field, value: value}
+	return &a
+}
+
+func (a *ActionMakeProof) Name() string {
+	return "makeProof"
+}
+
+func (a *ActionMakeProof) Args() []Arg {
+	return []Arg{{Name: "entryType", Type: StringArg}, {Name: "field", Type: StringArg}, {Name: "value", Type: ToStrArg}}
+}
+
+// setValue sets the value from the string the ribosome converted it to, where objects,
+// arrays, numbers and booleans are JSON and anything else is a plain string
+func (a *ActionMakeProof) setValue(s string) {
+	if json.Unmarshal([]byte(s), &a.value) != nil {
+		a.value = s
 	}
-	rsp, err := h.dht.Send(a.req.H, GET_REQUEST, a.req)
-	if err != nil {
+}
 
-		// follow the modified hash
-		if a.req.StatusMask == StatusDefault && err == ErrHashModified {
-			var hash Hash
-			hash, err = NewHash(rsp.(GetResp).FollowHash)
+func (a *ActionMakeProof) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.MakeProof(a.entryType, a.field, a.value)
+	return
+}
+
+//------------------------------------------------------------
+// VerifyProof
+
+type ActionVerifyProof struct {
+	proof Proof
+}
+
+func NewVerifyProofAction(proof Proof) *ActionVerifyProof {
+	a := ActionVerifyProof{proof: proof}
+	return &a
+}
+
+func (a *ActionVerifyProof) Name() string {
+	return "verifyProof"
+}
+
+func (a *ActionVerifyProof) Args() []Arg {
+	return []Arg{{Name: "proof", Type: ArgsArg}}
+}
+
+func (a *ActionVerifyProof) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.VerifyProof(&a.proof)
+	return
+}
+
+//------------------------------------------------------------
+// EntryToken
+
+type ActionEntryToken struct {
+	hash Hash
+}
+
+func NewEntryTokenAction(hash Hash) *ActionEntryToken {
+	a := ActionEntryToken{hash: hash}
+	return &a
+}
+
+func (a *ActionEntryToken) Name() string {
+	return "entryToken"
+}
+
+func (a *ActionEntryToken) Args() []Arg {
+	return []Arg{{Name: "hash", Type: HashArg}}
+}
+
+func (a *ActionEntryToken) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.EntryToken(a.hash)
+	return
+}
+
+//------------------------------------------------------------
+// Pin
+
+type ActionPin struct {
+	hash Hash
+}
+
+func NewPinAction(hash Hash) *ActionPin {
+	a := ActionPin{hash: hash}
+	return &a
+}
+
+func (a *ActionPin) Name() string {
+	return "pin"
+}
+
+func (a *ActionPin) Args() []Arg {
+	return []Arg{{Name: "hash", Type: HashArg}}
+}
+
+func (a *ActionPin) Do(h *Holochain) (response interface{}, err error) {
+	err = h.dht.Pin(a.hash)
+	return
+}
+
+//------------------------------------------------------------
+// Unpin
+
+type ActionUnpin struct {
+	hash Hash
+}
+
+func NewUnpinAction(hash Hash) *ActionUnpin {
+	a := ActionUnpin{hash: hash}
+	return &a
+}
+
+func (a *ActionUnpin) Name() string {
+	return "unpin"
+}
+
+func (a *ActionUnpin) Args() []Arg {
+	return []Arg{{Name: "hash", Type: HashArg}}
+}
+
+func (a *ActionUnpin) Do(h *Holochain) (response interface{}, err error) {
+	err = h.dht.Unpin(a.hash)
+	return
+}
+
+//------------------------------------------------------------
+// Publish
+
+type ActionPublish struct {
+	zome    string
+	channel string
+	msg     string
+}
+
+func NewPublishAction(zome string, channel string, msg string) *ActionPublish {
+	a := ActionPublish{zome: zome, channel: channel, msg: msg}
+	return &a
+}
+
+func (a *ActionPublish) Name() string {
+	return "publish"
+}
+
+func (a *ActionPublish) Args() []Arg {
+	return []Arg{{Name: "channel", Type: StringArg}, {Name: "msg", Type: ArgsArg}}
+}
+
+func (a *ActionPublish) Do(h *Holochain) (response interface{}, err error) {
+	if h.channels == nil {
+		err = ErrChannelsNotStarted
+		return
+	}
+	err = h.channels.Publish(a.zome, a.channel, a.msg)
+	return
+}
+
+//------------------------------------------------------------
+// Subscribe
+
+type ActionSubscribe struct {
+	zome    string
+	channel string
+	handler string
+}
+
+func NewSubscribeAction(zome string, channel string, handler string) *ActionSubscribe {
+	a := ActionSubscribe{zome: zome, channel: channel, handler: handler}
+	return &a
+}
+
+func (a *ActionSubscribe) Name() string {
+	return "subscribe"
+}
+
+func (a *ActionSubscribe) Args() []Arg {
+	return []Arg{{Name: "channel", Type: StringArg}, {Name: "handler", Type: StringArg}}
+}
+
+func (a *ActionSubscribe) Do(h *Holochain) (response interface{}, err error) {
+	if h.channels == nil {
+		err = ErrChannelsNotStarted
+		return
+	}
+	err = h.channels.Subscribe(a.zome, a.channel, a.handler)
+	return
+}
+
+//------------------------------------------------------------
+// Unsubscribe
+
+type ActionUnsubscribe struct {
+	zome    string
+	channel string
+}
+
+func NewUnsubscribeAction(zome string, channel string) *ActionUnsubscribe {
+	a := ActionUnsubscribe{zome: zome, channel: channel}
+	return &a
+}
+
+func (a *ActionUnsubscribe) Name() string {
+	return "unsubscribe"
+}
+
+func (a *ActionUnsubscribe) Args() []Arg {
+	return []Arg{{Name: "channel", Type: StringArg}}
+}
+
+func (a *ActionUnsubscribe) Do(h *Holochain) (response interface{}, err error) {
+	if h.channels == nil {
+		err = ErrChannelsNotStarted
+		return
+	}
+	err = h.channels.Unsubscribe(a.zome, a.channel)
+	return
+}
+
+//------------------------------------------------------------
+// Emit
+
+type ActionEmit struct {
+	zome    string
+	signal  string
+	payload string
+}
+
+func NewEmitAction(zome string, signal string, payload string) *ActionEmit {
+	a := ActionEmit{zome: zome, signal: signal, payload: payload}
+	return &a
+}
+
+func (a *ActionEmit) Name() string {
+	return "emit"
+}
+
+func (a *ActionEmit) Args() []Arg {
+	return []Arg{{Name: "signal", Type: StringArg}, {Name: "payload", Type: ArgsArg}}
+}
+
+func (a *ActionEmit) Do(h *Holochain) (response interface{}, err error) {
+	err = h.Emit(a.zome, a.signal, a.payload)
+	return
+}
+
+//------------------------------------------------------------
+// GetOnlineAgents
+
+type ActionGetOnlineAgents struct {
+}
+
+func NewGetOnlineAgentsAction() *ActionGetOnlineAgents {
+	a := ActionGetOnlineAgents{}
+	return &a
+}
+
+func (a *ActionGetOnlineAgents) Name() string {
+	return "getOnlineAgents"
+}
+
+func (a *ActionGetOnlineAgents) Args() []Arg {
+	return []Arg{}
+}
+
+func (a *ActionGetOnlineAgents) Do(h *Holochain) (response interface{}, err error) {
+	if h.presence == nil {
+		response = []OnlineAgent{}
+		return
+	}
+	response = h.presence.Online()
+	return
+}
+
+//------------------------------------------------------------
+// Query
+
+type ActionQuery struct {
+	options *QueryOptions
+}
+
+func NewQueryAction(options *QueryOptions) *ActionQuery {
+	a := ActionQuery{options: options}
+	return &a
+}
+
+func (a *ActionQuery) Name() string {
+	return "query"
+}
+
+func (a *ActionQuery) Args() []Arg {
+	return []Arg{{Name: "options", Type: MapArg, MapType: reflect.TypeOf(QueryOptions{}), Optional: true}}
+}
+
+func (a *ActionQuery) Do(h *Holochain) (response interface{}, err error) {
+	response, err = h.query(a.options)
+	return
+}
+
+//------------------------------------------------------------
+// Get
+
+type ActionGet struct {
+	req     GetReq
+	options *GetOptions
+}
+
+func NewGetAction(req GetReq, options *GetOptions) *ActionGet {
+	a := ActionGet{req: req, options: options}
+	return &a
+}
+
+func (a *ActionGet) Name() string {
+	return "get"
+}
+
+func (a *ActionGet) Args() []Arg {
+	return []Arg{{Name: "hash", Type: HashArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(GetOptions{}), Optional: true}}
+}
+
+func (a *ActionGet) Do(h *Holochain) (response interface{}, err error) {
+	if a.options.Local {
+		var entry Entry
+		var entryType string
+		hash := a.req.H
+		mask := a.options.GetMask
+		// the hash may be of a header, which is got along with its entry
+		header, _ := h.chain.Get(hash)
+		if header != nil {
+			hash = header.EntryLink
+			if mask == GetMaskDefault {
+				mask = GetMaskHeader
+			}
+		}
+		entry, entryType, err = h.chain.GetEntry(hash)
+		if err != nil {
+			return
+		}
+		entry = h.openEntry(entry, a.options.Token)
+		resp := GetResp{Entry: entry, Header: header}
+		if (mask & GetMaskEntryType) != 0 {
+			resp.EntryType = entryType
+		}
+		if (mask & GetMaskMeta) != 0 {
+			var header *Header
+			header, err = h.chain.GetEntryHeader(hash)
+			if err != nil {
+				return
+			}
+			resp.Meta = header.Meta
+		}
+		if (mask & GetMaskEntry) != 0 {
+			resp.Entry = entry
+		}
+
+		response = resp
+		return
+	}
+	rsp, err := h.dht.Send(a.req.H, GET_REQUEST, a.req)
+	if err != nil {
+
+		// follow the modified hash
+		if a.req.StatusMask == StatusDefault && errors.Is(err, ErrHashModified) {
+			var hash Hash
+			hash, err = NewHash(rsp.(GetResp).FollowHash)
 			if err != nil {
 				return
 			}
@@ -451,6 +1235,15 @@ func (a *ActionGet) Do(h *Holochain) (response interface{}, err error) {
 	}
 	switch t := rsp.(type) {
 	case GetResp:
+		if t.Header != nil {
+			err = h.CheckSigAlgorithm(t.Header.Sig.A)
+			if err != nil {
+				return
+			}
+		}
+		if t.Entry != nil {
+			t.Entry = h.openEntry(t.Entry, a.options.Token)
+		}
 		response = t
 	default:
 		err = fmt.Errorf("expected GetResp response from GET_REQUEST, got: %T", t)
@@ -474,6 +1267,28 @@ func (a *ActionGet) Receive(dht *DHT, msg *Message) (response interface{}, err e
 	resp := GetResp{}
 	var entryType string
 	entryData, entryType, resp.Sources, _, err = dht.get(req.H, req.StatusMask, req.GetMask|GetMaskEntryType)
+	if errors.Is(err, ErrHashNotFound) {
+		// the hash may be of a header, which by default is all that is returned, and
+		// otherwise the rest of the response is about its entry
+		if hd, e := dht.getHeader(req.H); e == nil {
+			resp.Header = hd
+			if req.GetMask == GetMaskDefault {
+				mask = GetMaskHeader
+			}
+			if mask&^GetMaskHeader == 0 {
+				err = nil
+				response = resp
+				return
+			}
+			req.H = hd.EntryLink
+			entryData, entryType, resp.Sources, _, err = dht.get(req.H, req.StatusMask, req.GetMask|GetMaskEntryType)
+		}
+	}
+	if errors.Is(err, ErrCorruptRecord) {
+		// our local copy is damaged so get a good one from the network for later
+		// requests, rather than holding this one up while it's fetched
+		dht.refetchInBackground(req.H)
+	}
 	if (mask & GetMaskEntryType) != 0 {
 		resp.EntryType = entryType
 	}
@@ -490,47 +1305,108 @@ func (a *ActionGet) Receive(dht *DHT, msg *Message) (response interface{}, err e
 				e.C = string(entryData)
 				resp.Entry = &e
 			default:
-				var e GobEntry
-				err = e.Unmarshal(entryData)
-				if err != nil {
-					return
+				k := req.H.String()
+				e, ok := dht.entries.get(k)
+				if !ok {
+					e = &GobEntry{}
+					err = e.Unmarshal(entryData)
+					if err != nil {
+						return
+					}
+					dht.entries.add(k, e)
 				}
-				resp.Entry = &e
+				resp.Entry = e
 			}
 		}
 	} else {
-		if err == ErrHashModified {
+		if errors.Is(err, ErrHashModified) {
 			resp.FollowHash = string(entryData)
 		}
 	}
+	if err == nil && (mask&GetMaskMeta) != 0 {
+		resp.Meta, err = dht.getMeta(req.H)
+	}
+	if (err == nil || errors.Is(err, ErrHashModified) || errors.Is(err, ErrHashDeleted)) && wantsHistory(mask) {
+		var e error
+		resp.History, e = dht.getHistory(req.H)
+		if e != nil {
+			err = e
+		}
+	}
 	response = resp
 	return
 }
 
 // doCommit adds an entry to the local chain after validating the action it's part of
-func (h *Holochain) doCommit(a CommittingAction, change *StatusChange) (d *EntryDef, header *Header, entryHash Hash, err error) {
+func (h *Holochain) doCommit(a CommittingAction, change *StatusChange, meta map[string]string) (d *EntryDef, header *Header, entryHash Hash, err error) {
 
 	entryType := a.EntryType()
+	if IsSystemEntryType(entryType) {
+		err = ErrReservedEntryType
+		return
+	}
 	entry := a.Entry()
+	stored := entry
+	privKey := h.agent.PrivKey()
+	if _, def, e := h.GetEntryDef(entryType); e == nil {
+		if def.Ephemeral {
+			privKey, err = NewOneTimeKey()
+			if err != nil {
+				return
+			}
+		}
+		if meta, err = addDisclosureRoot(def, entry, meta); err != nil {
+			return
+		}
+		// the app validates the entry as it is, but it is stored and published sealed
+		if def.Sharing == Encrypted {
+			if stored, err = h.sealEntry(entry); err != nil {
+				return
+			}
+		}
+	}
 	var l int
 	var hash Hash
-	l, hash, header, err = h.chain.PrepareHeader(time.Now(), entryType, entry, h.agent.PrivKey(), change)
+	l, hash, header, err = h.chain.PrepareHeader(time.Now(), entryType, stored, privKey, change, meta)
 	if err != nil {
 		return
 	}
-	//TODO	a.header = header
+	if len(h.nucleus.dna.TimeAuthorities) > 0 {
+		if hash, err = h.timestampHeader(header); err != nil {
+			return
+		}
+	}
+	switch t := a.(type) {
+	case *ActionCommit:
+		t.header = header
+	case *ActionMod:
+		t.header = header
+	}
 	d, err = h.ValidateAction(a, entryType, nil, []peer.ID{h.nodeID})
 	if err != nil {
-		if err == ValidationFailedErr {
-			err = fmt.Errorf("Invalid entry: %v", entry.Content())
+		if errors.Is(err, ErrValidationFailed) {
+			err = &ValidationError{Entry: entry.Content()}
 		}
 		return
 	}
-	err = h.chain.addEntry(l, hash, header, entry)
+	ctx := HookContext{Point: HookOnCommit, Agent: h.nodeIDStr, EntryType: entryType, Entry: entry, Start: time.Now()}
+	err = h.runHooks(&ctx)
 	if err != nil {
 		return
 	}
+	// an interrupted write is rolled back from the journal when the chain is next loaded
+	if err = h.journalBegin(hash); err != nil {
+		return
+	}
+	err = h.chain.addEntry(l, hash, header, stored)
+	if err != nil {
+		return
+	}
+	if err = h.journalCommitted(hash); err != nil {
+		return
+	}
 	entryHash = header.EntryLink
+	h.events.publish(Event{Type: EntryCommitted, Hash: entryHash.String(), EntryType: entryType})
 	return
 }
 
@@ -541,6 +1417,12 @@ type ActionCommit struct {
 	entryType string
 	entry     Entry
 	header    *Header
+	options   CommitOptions
+}
+
+// CommitOptions options to the commit function
+type CommitOptions struct {
+	Meta map[string]string // app-defined values to attach to the entry's header
 }
 
 func NewCommitAction(entryType string, entry Entry) *ActionCommit {
@@ -548,6 +1430,12 @@ func NewCommitAction(entryType string, entry Entry) *ActionCommit {
 	return &a
 }
 
+// NewCommitActionWithOptions creates a commit action that uses the given options
+func NewCommitActionWithOptions(entryType string, entry Entry, options CommitOptions) *ActionCommit {
+	a := ActionCommit{entryType: entryType, entry: entry, options: options}
+	return &a
+}
+
 func (a *ActionCommit) Entry() Entry {
 	return a.entry
 }
@@ -561,41 +1449,18 @@ func (a *ActionCommit) Name() string {
 }
 
 func (a *ActionCommit) Args() []Arg {
-	return []Arg{{Name: "entryType", Type: StringArg}, {Name: "entry", Type: EntryArg}}
+	return []Arg{{Name: "entryType", Type: StringArg}, {Name: "entry", Type: EntryArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(CommitOptions{}), Optional: true}}
 }
 
 func (a *ActionCommit) Do(h *Holochain) (response interface{}, err error) {
-	var d *EntryDef
-	var entryHash Hash
-	//	var header *Header
-	d, _, entryHash, err = h.doCommit(a, nil)
-	if err != nil {
+	if a.entry, err = h.formatEntry(a.entryType, a.entry); err != nil {
 		return
 	}
-	if d.DataFormat == DataFormatLinks {
-		// if this is a Link entry we have to send the DHT Link message
-		var le LinksEntry
-		entryStr := a.entry.Content().(string)
-		err = json.Unmarshal([]byte(entryStr), &le)
-		if err != nil {
-			return
-		}
-
-		bases := make(map[string]bool)
-		for _, l := range le.Links {
-			_, exists := bases[l.Base]
-			if !exists {
-				b, _ := NewHash(l.Base)
-				h.dht.Send(b, LINK_REQUEST, LinkReq{Base: b, Links: entryHash})
-				//TODO errors from the send??
-				bases[l.Base] = true
-			}
-		}
-	} else if d.Sharing == Public {
-		// otherwise we check to see if it's a public entry and if so send the DHT put message
-		_, err = h.dht.Send(entryHash, PUT_REQUEST, PutReq{H: entryHash})
+	var header *Header
+	if header, _, err = h.commitEntry(a, nil, a.options.Meta); header == nil {
+		return
 	}
-	response = entryHash
+	response = header.EntryLink
 	return
 }
 
@@ -607,11 +1472,33 @@ func sysValidateEntry(h *Holochain, d *EntryDef, entry Entry) (err error) {
 		err = errors.New("nil entry invalid")
 		return
 	}
+	// holders can't read encrypted entries, so only their author checks the content
+	if d.Sharing == Encrypted {
+		if _, ok := sealedContent(entry); ok {
+			return
+		}
+	}
+	if err = checkEntryContent(d.DataFormat, entry.Content()); err != nil {
+		return
+	}
 	// see if there is a schema validator for the entry type and validate it if so
 	if d.validator != nil {
 		var input interface{}
 		if d.DataFormat == DataFormatJSON {
-			if err = json.Unmarshal([]byte(entry.Content().(string)), &input); err != nil {
+			var c string
+			if c, err = entryContentString(entry.Content()); err != nil {
+				return
+			}
+			if err = json.Unmarshal([]byte(c), &input); err != nil {
+				return
+			}
+		} else if d.DataFormat == DataFormatCBOR {
+			c, ok := entry.Content().(CBOR)
+			if !ok {
+				err = fmt.Errorf("%w: %T", ErrBadEntryContent, entry.Content())
+				return
+			}
+			if input, err = c.Value(); err != nil {
 				return
 			}
 		} else {
@@ -625,9 +1512,13 @@ func sysValidateEntry(h *Holochain, d *EntryDef, entry Entry) (err error) {
 		// Perform base validation on links entries, i.e. that all items exist and are of the right types
 		// so first unmarshall the json, and then check that the hashes are real.
 		var l struct{ Links []map[string]string }
-		err = json.Unmarshal([]byte(entry.Content().(string)), &l)
+		var c string
+		if c, err = entryContentString(entry.Content()); err != nil {
+			return
+		}
+		err = json.Unmarshal([]byte(c), &l)
 		if err != nil {
-			err = fmt.Errorf("invalid links entry, invalid json: %v", err)
+			err = fmt.Errorf("invalid links entry, invalid json: %w", err)
 			return
 		}
 		if len(l.Links) == 0 {
@@ -641,7 +1532,7 @@ func sysValidateEntry(h *Holochain, d *EntryDef, entry Entry) (err error) {
 				return
 			}
 			if _, err = NewHash(h); err != nil {
-				err = fmt.Errorf("invalid links entry: Base %v", err)
+				err = fmt.Errorf("invalid links entry: Base %w", err)
 				return
 			}
 			h, ok = link["Link"]
@@ -650,7 +1541,7 @@ func sysValidateEntry(h *Holochain, d *EntryDef, entry Entry) (err error) {
 				return
 			}
 			if _, err = NewHash(h); err != nil {
-				err = fmt.Errorf("invalid links entry: Link %v", err)
+				err = fmt.Errorf("invalid links entry: Link %w", err)
 				return
 			}
 			_, ok = link["Tag"]
@@ -658,6 +1549,10 @@ func sysValidateEntry(h *Holochain, d *EntryDef, entry Entry) (err error) {
 				err = errors.New("invalid links entry: missing Tag")
 				return
 			}
+			if len(link["SortKey"]) > MaxLinkSortKeySize {
+				err = ErrLinkSortKeyTooLong
+				return
+			}
 		}
 
 	}
@@ -707,6 +1602,46 @@ func (a *ActionPut) Do(h *Holochain) (response interface{}, err error) {
 
 func (a *ActionPut) SysValidation(h *Holochain, d *EntryDef, sources []peer.ID) (err error) {
 	err = sysValidateEntry(h, d, a.entry)
+	if err != nil {
+		return
+	}
+	if a.header != nil && a.header.EntryLink.H != nil {
+		err = h.CheckSigAlgorithm(a.header.Sig.A)
+		if err != nil {
+			return
+		}
+		if a.header.Sig.Key != nil && !d.Ephemeral {
+			err = ErrOneTimeSignature
+			return
+		}
+		if a.header.Sig.Key == nil && d.Ephemeral {
+			err = ErrNotEphemeral
+			return
+		}
+		err = checkHeaderMeta(a.header.Meta)
+		if err != nil {
+			return
+		}
+		err = sysValidateEntryLink(h, a.entry, a.header.EntryLink)
+	}
+	return
+}
+
+// sysValidateEntryLink checks that a header's entry link was made with the DNA's
+// hash type, and that it is the hash of the entry
+func sysValidateEntryLink(h *Holochain, entry Entry, link Hash) (err error) {
+	err = h.hashSpec.Check(link)
+	if err != nil {
+		return
+	}
+	var hash Hash
+	hash, err = entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	if !hash.Equal(&link) {
+		err = ErrEntryLinkMismatch
+	}
 	return
 }
 
@@ -718,6 +1653,13 @@ func RunValidationPhase(h *Holochain, source peer.ID, msgType MsgType, query Has
 	}
 	switch resp := r.(type) {
 	case ValidateResponse:
+		if resp.Package.ID != "" {
+			err = fetchPackage(h, source, &resp.Package)
+			if err != nil {
+				return
+			}
+			defer releasePackage(&resp.Package)
+		}
 		err = handler(resp)
 	default:
 		err = fmt.Errorf("expected ValidateResponse from validator got %T", r)
@@ -727,28 +1669,104 @@ func RunValidationPhase(h *Holochain, source peer.ID, msgType MsgType, query Has
 
 func (a *ActionPut) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
 	//dht.puts <- *m  TODO add back in queueing
+	var p *validatedPut
+	if p, err = dht.validatePut(msg); err == nil {
+		err = dht.applyPuts([]*validatedPut{p})
+	}
+	response = "queued"
+	return
+}
+
+// validatePut fetches and validates the put in msg from its source, returning what to
+// store for it.  Nothing is written to the DHT, so that gossiped puts can be
+// validated before the transaction that stores them is started.
+func (dht *DHT) validatePut(msg *Message) (p *validatedPut, err error) {
 	t := msg.Body.(PutReq)
 	err = RunValidationPhase(dht.h, msg.From, VALIDATE_PUT_REQUEST, t.H, func(resp ValidateResponse) error {
 		a := NewPutAction(resp.Type, &resp.Entry, &resp.Header)
 		_, err := dht.h.ValidateAction(a, a.entryType, &resp.Package, []peer.ID{msg.From})
+		if err == nil && resp.Type == KeyEntryType {
+			err = checkKeyEntry(t.H, msg.From, &resp.Header)
+		}
 
 		var status int
 		if err != nil {
 			dht.dlog.Logf("Put %v rejected: %v", t.H, err)
 			status = StatusRejected
+			if dht.h.config.ValidationDebug {
+				go func(from peer.ID, hash Hash) {
+					if _, e := dht.h.debugValidation(from, hash); e != nil {
+						dht.dlog.Logf("unable to compare validation of %v with its author's: %v", hash, e)
+					}
+				}(msg.From, t.H)
+			}
+		} else if dht.quorum() > 1 {
+			// it doesn't go live until enough holders have validated it
+			status = StatusPending
 		} else {
 			status = StatusLive
 		}
 		entry := resp.Entry
 		var b []byte
-		b, err = entry.Marshal()
-		if err == nil {
-			err = dht.put(msg, resp.Type, t.H, msg.From, b, status)
+		if b, err = entry.Marshal(); err != nil {
+			return err
 		}
-		return err
+		if resp.Type == KeyEntryType {
+			// key entries hold the node's id, as they do on the node itself
+			b = []byte(msg.From)
+		}
+		p = &validatedPut{msg: msg, entryType: resp.Type, key: t.H, value: b, status: status}
+		if status == StatusRejected {
+			return nil
+		}
+		if resp.Type == KeyEntryType {
+			p.agent = resp.Header.EntryLink.String()
+		}
+		// pending puts keep their headers too, they won't be sent again once they go live
+		if p.headers, err = sourceHeaders(dht, msg.From, &resp); err != nil {
+			return err
+		}
+		if p.expires, err = dht.expiry(resp.Type, resp.Header.Time); err != nil {
+			return err
+		}
+		if len(resp.Header.Meta) > 0 {
+			var j []byte
+			if j, err = json.Marshal(resp.Header.Meta); err != nil {
+				return err
+			}
+			p.meta = string(j)
+		}
+		if status == StatusPending && dht.holdsHash(t.H) {
+			// record our own validation, which gossips on to the other holders
+			r, err := dht.h.newReceipt(t.H)
+			if err != nil {
+				return err
+			}
+			p.receipt = dht.h.node.NewMessage(RECEIPT_REQUEST, r)
+		}
+		return nil
 	})
+	return
+}
 
-	response = "queued"
+// sourceHeaders returns the records of the headers in a validated put response, which
+// for agent entries include the genesis headers in the package
+func sourceHeaders(dht *DHT, src peer.ID, resp *ValidateResponse) (recs []headerRecord, err error) {
+	headers := []*Header{&resp.Header}
+	if resp.Type == AgentEntryType && resp.Package.Chain != nil {
+		var c *Chain
+		if _, c, err = UnmarshalChain(dht.h.hashSpec, bytes.NewBuffer(resp.Package.Chain)); err != nil {
+			return
+		}
+		headers = c.Headers
+	}
+	for _, hd := range headers {
+		var rec headerRecord
+		if rec, err = dht.headerRecord(src, hd); err != nil {
+			return
+		}
+		recs = append(recs, rec)
+	}
 	return
 }
 
@@ -788,17 +1806,14 @@ func (a *ActionMod) Args() []Arg {
 }
 
 func (a *ActionMod) Do(h *Holochain) (response interface{}, err error) {
-	var d *EntryDef
-	var entryHash Hash
-	d, a.header, entryHash, err = h.doCommit(a, &StatusChange{Action: ModAction, Hash: a.replaces})
-	if err != nil {
+	if a.entry, err = h.formatEntry(a.entryType, a.entry); err != nil {
 		return
 	}
-	if d.Sharing == Public {
-		// if it's a public entry send the DHT MOD & PUT messages
-		// TODO handle errors better!!
-		_, err = h.dht.Send(entryHash, PUT_REQUEST, PutReq{H: entryHash})
-		_, err = h.dht.Send(a.replaces, MOD_REQUEST, ModReq{H: a.replaces, N: entryHash})
+	var entryHash Hash
+	// if it's a public entry this sends the DHT MOD & PUT messages
+	a.header, entryHash, err = h.commitEntry(a, &StatusChange{Action: ModAction, Hash: a.replaces}, nil)
+	if a.header == nil {
+		return
 	}
 	response = entryHash
 	return
@@ -818,6 +1833,12 @@ func (a *ActionMod) SysValidation(h *Holochain, def *EntryDef, sources []peer.ID
 		err = ErrEntryTypeMismatch
 		return
 	}
+	if a.header != nil {
+		err = h.CheckSigAlgorithm(a.header.Sig.A)
+		if err != nil {
+			return
+		}
+	}
 	err = sysValidateEntry(h, def, a.entry)
 	return
 }
@@ -826,9 +1847,10 @@ func (a *ActionMod) Receive(dht *DHT, msg *Message) (response interface{}, err e
 	//var hashStatus int
 	t := msg.Body.(ModReq)
 	from := msg.From
-	err = dht.exists(t.H, StatusDefault)
+	// entries moved into a DNA's statuses can still be modified
+	err = dht.exists(t.H, StatusLive|StatusCustomAny)
 	if err != nil {
-		if err == ErrHashNotFound {
+		if errors.Is(err, ErrHashNotFound) {
 			dht.dlog.Logf("don't yet have %s, trying again later", t.H)
 			panic("RETRY-MOD NOT IMPLEMENTED")
 			// try the del again later
@@ -862,6 +1884,7 @@ func (a *ActionMod) CheckValidationRequest(def *EntryDef) (err error) {
 type ActionDel struct {
 	entryType string
 	entry     DelEntry
+	header    *Header
 }
 
 func NewDelAction(entryType string, entry DelEntry) *ActionDel {
@@ -891,19 +1914,14 @@ func (a *ActionDel) Args() []Arg {
 }
 
 func (a *ActionDel) Do(h *Holochain) (response interface{}, err error) {
-	var d *EntryDef
-	var entryHash Hash
+	var header *Header
 
-	d, _, entryHash, err = h.doCommit(a, &StatusChange{Action: DelAction, Hash: a.entry.Hash})
-	if err != nil {
+	// if it's a public entry this sends the DHT DEL
+	header, _, err = h.commitEntry(a, &StatusChange{Action: DelAction, Hash: a.entry.Hash}, nil)
+	if header == nil {
 		return
 	}
-
-	if d.Sharing == Public {
-		// if it's a public entry send the DHT DEL
-		_, err = h.dht.Send(a.entry.Hash, DEL_REQUEST, DelReq{H: a.entry.Hash, By: entryHash})
-	}
-	response = entryHash
+	response = header.EntryLink
 
 	return
 }
@@ -922,15 +1940,19 @@ func (a *ActionDel) SysValidation(h *Holochain, d *EntryDef, sources []peer.ID)
 		err = ErrEntryTypeMismatch
 		return
 	}
+	if a.header != nil {
+		err = h.CheckSigAlgorithm(a.header.Sig.A)
+	}
 	return
 }
 
 func (a *ActionDel) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
 	t := msg.Body.(DelReq)
 	from := msg.From
-	err = dht.exists(t.H, StatusDefault)
+	// entries moved into a DNA's statuses can still be deleted
+	err = dht.exists(t.H, StatusLive|StatusCustomAny)
 	if err != nil {
-		if err == ErrHashNotFound {
+		if errors.Is(err, ErrHashNotFound) {
 			dht.dlog.Logf("don't yet have %s, trying again later", t.H)
 			panic("RETRY-DELETE NOT IMPLEMENTED")
 			// try the del again later
@@ -940,12 +1962,17 @@ func (a *ActionDel) Receive(dht *DHT, msg *Message) (response interface{}, err e
 
 	err = RunValidationPhase(dht.h, msg.From, VALIDATE_DEL_REQUEST, t.By, func(resp ValidateResponse) error {
 		var delEntry DelEntry
-		err := ByteDecoder([]byte(resp.Entry.Content().(string)), &delEntry)
+		c, err := systemEntryContent(&resp.Entry)
+		if err != nil {
+			return err
+		}
+		err = ByteDecoder([]byte(c), &delEntry)
 		if err != nil {
 			return err
 		}
 
 		a := NewDelAction(resp.Type, delEntry)
+		a.header = &resp.Header
 		//@TODO what comes back from Validate Del
 		_, err = dht.h.ValidateAction(a, resp.Type, &resp.Package, []peer.ID{from})
 		if err != nil {
@@ -964,6 +1991,102 @@ func (a *ActionDel) CheckValidationRequest(def *EntryDef) (err error) {
 	return
 }
 
+//------------------------------------------------------------
+// SetStatus
+
+type ActionSetStatus struct {
+	entryType string
+	entry     StatusEntry
+}
+
+func NewSetStatusAction(entryType string, entry StatusEntry) *ActionSetStatus {
+	a := ActionSetStatus{entryType: entryType, entry: entry}
+	return &a
+}
+
+func (a *ActionSetStatus) Name() string {
+	return "setStatus"
+}
+
+func (a *ActionSetStatus) Entry() Entry {
+	var buf []byte
+	buf, err := ByteEncoder(a.entry)
+	if err != nil {
+		panic(err)
+	}
+	return &GobEntry{C: string(buf)}
+}
+
+func (a *ActionSetStatus) EntryType() string {
+	return a.entryType
+}
+
+func (a *ActionSetStatus) Args() []Arg {
+	return []Arg{{Name: "hash", Type: HashArg}, {Name: "status", Type: StringArg}, {Name: "message", Type: StringArg, Optional: true}}
+}
+
+func (a *ActionSetStatus) Do(h *Holochain) (response interface{}, err error) {
+	var header *Header
+
+	// if it's a public entry this sends the DHT STATUS
+	header, _, err = h.commitEntry(a, &StatusChange{Action: StatusAction, Hash: a.entry.Hash}, nil)
+	if header == nil {
+		return
+	}
+	response = header.EntryLink
+
+	return
+}
+
+func (a *ActionSetStatus) SysValidation(h *Holochain, d *EntryDef, sources []peer.ID) (err error) {
+	if d.DataFormat == DataFormatLinks {
+		err = errors.New("Can't set the status of Links entry")
+		return
+	}
+	_, err = h.nucleus.dna.statusValue(a.entry.Status)
+	return
+}
+
+func (a *ActionSetStatus) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
+	t := msg.Body.(StatusReq)
+	from := msg.From
+	err = dht.exists(t.H, StatusLive|StatusCustomAny)
+	if err != nil {
+		return
+	}
+
+	err = RunValidationPhase(dht.h, msg.From, VALIDATE_STATUS_REQUEST, t.By, func(resp ValidateResponse) error {
+		var statusEntry StatusEntry
+		c, err := systemEntryContent(&resp.Entry)
+		if err != nil {
+			return err
+		}
+		err = ByteDecoder([]byte(c), &statusEntry)
+		if err != nil {
+			return err
+		}
+		if !statusEntry.Hash.Equal(&t.H) {
+			return ErrEntryLinkMismatch
+		}
+
+		a := NewSetStatusAction(resp.Type, statusEntry)
+		_, err = dht.h.ValidateAction(a, resp.Type, &resp.Package, []peer.ID{from})
+		if err == nil {
+			var status int
+			if status, err = dht.h.nucleus.dna.statusValue(statusEntry.Status); err == nil {
+				err = dht.setStatus(msg, statusEntry.Hash, status)
+			}
+		}
+		return err
+	})
+	response = "queued"
+	return
+}
+
+func (a *ActionSetStatus) CheckValidationRequest(def *EntryDef) (err error) {
+	return
+}
+
 //------------------------------------------------------------
 // Link
 
@@ -998,6 +2121,10 @@ func (a *ActionLink) SysValidation(h *Holochain, d *EntryDef, sources []peer.ID)
 
 func (a *ActionLink) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
 	t := msg.Body.(LinkReq)
+	if t.Reverse {
+		response, err = a.receiveBacklinks(dht, msg)
+		return
+	}
 	base := t.Base
 	from := msg.From
 	err = dht.exists(base, StatusLive)
@@ -1005,7 +2132,7 @@ func (a *ActionLink) Receive(dht *DHT, msg *Message) (response interface{}, err
 		err = dht.exists(t.Base, StatusLive)
 		// @TODO what happens if the baseStatus is not StatusLive?
 		if err != nil {
-			if err == ErrHashNotFound {
+			if errors.Is(err, ErrHashNotFound) {
 				dht.dlog.Logf("don't yet have %s, trying again later", t.Base)
 				panic("RETRY-LINK NOT IMPLEMENTED")
 				// try the put again later
@@ -1016,7 +2143,11 @@ func (a *ActionLink) Receive(dht *DHT, msg *Message) (response interface{}, err
 		err = RunValidationPhase(dht.h, msg.From, VALIDATE_LINK_REQUEST, t.Links, func(resp ValidateResponse) error {
 			var le LinksEntry
 
-			if err = json.Unmarshal([]byte(resp.Entry.Content().(string)), &le); err != nil {
+			c, err := entryContentString(resp.Entry.Content())
+			if err != nil {
+				return err
+			}
+			if err = json.Unmarshal([]byte(c), &le); err != nil {
 				return err
 			}
 
@@ -1037,7 +2168,7 @@ func (a *ActionLink) Receive(dht *DHT, msg *Message) (response interface{}, err
 						if l.LinkAction == DelAction {
 							err = dht.delLink(msg, base, l.Link, l.Tag)
 						} else {
-							err = dht.putLink(msg, base, l.Link, l.Tag)
+							err = dht.putSortedLink(msg, base, l.Link, l.Tag, l.SortKey, resp.Header.Time)
 						}
 					}
 				}
@@ -1090,25 +2221,7 @@ func (a *ActionGetLink) Do(h *Holochain) (response interface{}, err error) {
 		case *LinkQueryResp:
 			response = t
 			if a.options.Load {
-				for i := range t.Links {
-					var hash Hash
-					hash, err = NewHash(t.Links[i].H)
-					if err != nil {
-						return
-					}
-					req := GetReq{H: hash, StatusMask: StatusDefault}
-					rsp, err := NewGetAction(req, &GetOptions{StatusMask: StatusDefault}).Do(h)
-					if err == nil {
-						entry := rsp.(GetResp).Entry
-						if entry != nil {
-							t.Links[i].E = entry.(Entry).Content().(string)
-						} else {
-							panic(fmt.Sprintf("Nil entry in GetLink.Do response to req: %v", req))
-						}
-
-					}
-					//TODO better error handling here, i.e break out of the loop and return if error?
-				}
+				err = loadLinks(h, t.Links)
 			}
 		default:
 			err = fmt.Errorf("unexpected response type from SendGetLink: %T", t)
@@ -1117,16 +2230,355 @@ func (a *ActionGetLink) Do(h *Holochain) (response interface{}, err error) {
 	return
 }
 
+// loadLinks fills in the entries of links
+func loadLinks(h *Holochain, links []TaggedHash) (err error) {
+	for i := range links {
+		var hash Hash
+		hash, err = NewHash(links[i].H)
+		if err != nil {
+			return
+		}
+		req := GetReq{H: hash, StatusMask: StatusDefault}
+		rsp, err := NewGetAction(req, &GetOptions{StatusMask: StatusDefault}).Do(h)
+		if err == nil {
+			entry := rsp.(GetResp).Entry
+			if entry != nil {
+				links[i].E, _ = entryContentString(entry.(Entry).Content())
+			} else {
+				panic(fmt.Sprintf("Nil entry in GetLink.Do response to req: %v", req))
+			}
+
+		}
+		//TODO better error handling here, i.e break out of the loop and return if error?
+	}
+	return
+}
+
 func (a *ActionGetLink) SysValidation(h *Holochain, d *EntryDef, sources []peer.ID) (err error) {
 	//@TODO what sys level getlinks validation?  That they are all valid hash format for the DNA?
 	return
 }
 
 func (a *ActionGetLink) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
-	lq := msg.Body.(LinkQuery)
 	var r LinkQueryResp
-	r.Links, err = dht.getLink(lq.Base, lq.T, lq.StatusMask)
+	r, err = dht.linkQuery(msg.Body.(LinkQuery))
+	response = &r
+	return
+}
+
+// linkQuery answers a query for the links on a base we hold
+func (dht *DHT) linkQuery(lq LinkQuery) (r LinkQueryResp, err error) {
+	if lq.Reverse {
+		r.Links, err = dht.getBacklink(lq.Base, lq.T, lq.StatusMask)
+	} else if lq.Count {
+		r.Count, err = dht.countLinks(lq.Base, lq.T, lq.StatusMask, lq.Target)
+	} else if lq.Limit > 0 || lq.Cursor != "" || lq.SortBy != "" {
+		r.Links, r.Next, err = dht.getLinkPage(lq.Base, lq.T, lq.StatusMask, lq.SortBy, lq.Cursor, lq.Limit)
+	} else {
+		r.Links, err = dht.getLink(lq.Base, lq.T, lq.StatusMask)
+	}
+	return
+}
+
+//------------------------------------------------------------
+// GetBacklinks
+
+type ActionGetBacklinks struct {
+	target  Hash
+	tag     string
+	options *GetLinkOptions
+}
+
+func NewGetBacklinksAction(target Hash, tag string, options *GetLinkOptions) *ActionGetBacklinks {
+	a := ActionGetBacklinks{target: target, tag: tag, options: options}
+	return &a
+}
+
+func (a *ActionGetBacklinks) Name() string {
+	return "getBacklinks"
+}
+
+func (a *ActionGetBacklinks) Args() []Arg {
+	return []Arg{{Name: "target", Type: HashArg}, {Name: "tag", Type: StringArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(GetLinkOptions{}), Optional: true}}
+}
+
+// Do asks the node holding the target for the bases that link to it, which it indexes
+// as the links are made
+func (a *ActionGetBacklinks) Do(h *Holochain) (response interface{}, err error) {
+	q := LinkQuery{Base: a.target, T: a.tag, StatusMask: a.options.StatusMask, Reverse: true}
+	response, err = NewGetLinkAction(&q, a.options).Do(h)
+	return
+}
+
+// countLinkQuery asks the node holding a base to count its links from the index
+func countLinkQuery(h *Holochain, q LinkQuery) (count int, err error) {
+	q.Count = true
+	var r interface{}
+	if r, err = h.dht.Send(q.Base, GETLINK_REQUEST, q); err != nil {
+		return
+	}
+	resp, ok := r.(*LinkQueryResp)
+	if !ok {
+		err = fmt.Errorf("unexpected response type from SendGetLink: %T", r)
+		return
+	}
+	count = resp.Count
+	return
+}
+
+//------------------------------------------------------------
+// CountLinks
+
+type ActionCountLinks struct {
+	base Hash
+	tag  string
+}
+
+func NewCountLinksAction(base Hash, tag string) *ActionCountLinks {
+	a := ActionCountLinks{base: base, tag: tag}
+	return &a
+}
+
+func (a *ActionCountLinks) Name() string {
+	return "countLinks"
+}
+
+func (a *ActionCountLinks) Args() []Arg {
+	return []Arg{{Name: "base", Type: HashArg}, {Name: "tag", Type: StringArg}}
+}
+
+func (a *ActionCountLinks) Do(h *Holochain) (response interface{}, err error) {
+	response, err = countLinkQuery(h, LinkQuery{Base: a.base, T: a.tag, StatusMask: StatusLive})
+	return
+}
+
+//------------------------------------------------------------
+// LinkExists
+
+type ActionLinkExists struct {
+	base   Hash
+	tag    string
+	target Hash
+}
+
+func NewLinkExistsAction(base Hash, tag string, target Hash) *ActionLinkExists {
+	a := ActionLinkExists{base: base, tag: tag, target: target}
+	return &a
+}
+
+func (a *ActionLinkExists) Name() string {
+	return "linkExists"
+}
+
+func (a *ActionLinkExists) Args() []Arg {
+	return []Arg{{Name: "base", Type: HashArg}, {Name: "tag", Type: StringArg}, {Name: "target", Type: HashArg}}
+}
+
+func (a *ActionLinkExists) Do(h *Holochain) (response interface{}, err error) {
+	var count int
+	count, err = countLinkQuery(h, LinkQuery{Base: a.base, T: a.tag, StatusMask: StatusLive, Target: a.target.String()})
+	response = count > 0
+	return
+}
+
+//------------------------------------------------------------
+// GetLinks
+
+// LinksSpec is a base and tag to get the links of in a getLinks call
+type LinksSpec struct {
+	Base   string
+	Tag    string
+	Cursor string // where the page of links starts if the options have a Limit
+}
+
+// DefaultLinksPageSize is how many links getLinks returns for each base when its options
+// don't set a Limit, with Next set to get the rest
+var DefaultLinksPageSize = 100
+
+type ActionGetLinks struct {
+	specs   []LinksSpec
+	options *GetLinkOptions
+}
+
+func NewGetLinksAction(specs []LinksSpec, options *GetLinkOptions) *ActionGetLinks {
+	a := ActionGetLinks{specs: specs, options: options}
+	return &a
+}
+
+func (a *ActionGetLinks) Name() string {
+	return "getLinks"
+}
+
+func (a *ActionGetLinks) Args() []Arg {
+	return []Arg{{Name: "specs", Type: ToStrArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(GetLinkOptions{}), Optional: true}}
+}
+
+// setSpecs sets the bases and tags from the JSON array the ribosome converted them to
+func (a *ActionGetLinks) setSpecs(s string) (err error) {
+	if err = json.Unmarshal([]byte(s), &a.specs); err != nil {
+		err = fmt.Errorf("getLinks expects an array of {Base,Tag} objects: %w", err)
+	}
+	return
+}
+
+// Do sends the queries for the bases each node holds to it in one message, all the
+// nodes at once, and returns the results in the order of the specs.  A query that
+// fails has its Error set rather than failing the others.
+func (a *ActionGetLinks) Do(h *Holochain) (response interface{}, err error) {
+	results := make([]LinkQueryResp, len(a.specs))
+	limit := a.options.Limit
+	if limit == 0 {
+		limit = DefaultLinksPageSize
+	}
+	queries := make(map[peer.ID]*LinksQuery)
+	indexes := make(map[peer.ID][]int)
+	for i, s := range a.specs {
+		var base Hash
+		if base, err = NewHash(s.Base); err != nil {
+			return
+		}
+		var n *Node
+		if n, err = h.dht.FindNodeForHash(base); err != nil {
+			return
+		}
+		q := queries[n.HashAddr]
+		if q == nil {
+			q = &LinksQuery{}
+			queries[n.HashAddr] = q
+		}
+		q.Queries = append(q.Queries, LinkQuery{Base: base, T: s.Tag, StatusMask: a.options.StatusMask, Limit: limit, Cursor: s.Cursor, SortBy: a.options.SortBy})
+		indexes[n.HashAddr] = append(indexes[n.HashAddr], i)
+	}
+
+	var wg sync.WaitGroup
+	for id, q := range queries {
+		wg.Add(1)
+		go func(id peer.ID, q *LinksQuery) {
+			defer wg.Done()
+			var resp []LinkQueryResp
+			r, err := h.dht.send(id, GETLINKS_REQUEST, *q)
+			if err == nil {
+				if t, ok := r.(*LinksQueryResp); ok && len(t.Results) == len(q.Queries) {
+					resp = t.Results
+				} else {
+					err = fmt.Errorf("unexpected response type from SendGetLinks: %T", r)
+				}
+			}
+			for j, i := range indexes[id] {
+				if err != nil {
+					results[i].Error = err.Error()
+				} else {
+					results[i] = resp[j]
+				}
+			}
+		}(id, q)
+	}
+	wg.Wait()
+
+	if a.options.Load {
+		for i := range results {
+			if err = loadLinks(h, results[i].Links); err != nil {
+				return
+			}
+		}
+	}
+	response = results
+	return
+}
+
+func (a *ActionGetLinks) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
+	lq := msg.Body.(LinksQuery)
+	r := LinksQueryResp{Results: make([]LinkQueryResp, len(lq.Queries))}
+	for i, q := range lq.Queries {
+		paged := !q.Count && !q.Reverse
+		if paged && q.Limit == 0 {
+			q.Limit = DefaultLinksPageSize
+		}
+		var e error
+		r.Results[i], e = dht.linkQuery(q)
+		// the first page being empty is reported as getLink reports no links
+		if e == nil && paged && q.Cursor == "" && len(r.Results[i].Links) == 0 {
+			e = &wrappedError{fmt.Sprintf("No links for %s", q.T), ErrLinkNotFound}
+		}
+		if e != nil {
+			r.Results[i].Error = e.Error()
+		}
+	}
 	response = &r
+	return
+}
+
+//------------------------------------------------------------
+// GetHeaders
+
+type ActionGetHeaders struct {
+	req HeadersReq
+}
+
+func NewGetHeadersAction(req HeadersReq) *ActionGetHeaders {
+	a := ActionGetHeaders{req: req}
+	return &a
+}
+
+func (a *ActionGetHeaders) Name() string {
+	return "getHeaders"
+}
+
+func (a *ActionGetHeaders) Args() []Arg {
+	return nil
+}
 
+func (a *ActionGetHeaders) Do(h *Holochain) (response interface{}, err error) {
+	var key Hash
+	key, err = NewHash(peer.IDB58Encode(a.req.Source))
+	if err != nil {
+		return
+	}
+	var rsp interface{}
+	rsp, err = h.dht.Send(key, GET_HEADERS_REQUEST, a.req)
+	if err != nil {
+		return
+	}
+	switch t := rsp.(type) {
+	case HeadersResp:
+		response = t
+	default:
+		err = fmt.Errorf("expected HeadersResp response from GET_HEADERS_REQUEST, got: %T", t)
+	}
+	return
+}
+
+func (a *ActionGetHeaders) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
+	req := msg.Body.(HeadersReq)
+	var r HeadersResp
+	r.Headers, err = dht.getHeaders(req.Source)
+	response = r
+	return
+}
+
+//------------------------------------------------------------
+// Receipt
+
+type ActionReceipt struct {
+}
+
+func (a *ActionReceipt) Name() string {
+	return "receipt"
+}
+
+func (a *ActionReceipt) Args() []Arg {
+	return nil
+}
+
+func (a *ActionReceipt) Do(h *Holochain) (response interface{}, err error) {
+	err = NonCallableAction
+	return
+}
+
+func (a *ActionReceipt) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
+	err = dht.receipt(msg)
+	if err == nil {
+		response = "queued"
+	}
 	return
 }
@@ -4,6 +4,7 @@ import (
 	// "fmt"
 	"fmt"
 	peer "github.com/libp2p/go-libp2p-peer"
+	mh "github.com/multiformats/go-multihash"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 )
@@ -37,6 +38,32 @@ func TestValidateAction(t *testing.T) {
 	})
 }
 
+func TestSystemEntryProtection(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("apps should not be able to commit system entries", t, func() {
+		l := h.chain.Length()
+		_, err := NewCommitAction(AgentEntryType, &GobEntry{C: "fake agent"}).Do(h)
+		So(err, ShouldEqual, ErrReservedEntryType)
+		_, err = NewCommitAction(KeyEntryType, &GobEntry{C: "fake key"}).Do(h)
+		So(err, ShouldEqual, ErrReservedEntryType)
+		So(h.chain.Length(), ShouldEqual, l)
+	})
+
+	Convey("apps should not be able to modify system entries", t, func() {
+		_, err := NewModAction(AgentEntryType, &GobEntry{C: "fake agent"}, h.AgentHash()).Do(h)
+		So(err, ShouldEqual, ErrReservedEntryType)
+	})
+
+	Convey("commit from a ribosome should not be able to write system entries", t, func() {
+		z, _ := h.GetZome("zySampleZome")
+		r, _ := z.MakeRibosome(h)
+		_, err := r.Run(`(commit "%agent" "fake agent")`)
+		So(err.Error(), ShouldContainSubstring, ErrReservedEntryType.Error())
+	})
+}
+
 func TestSysValidateEntry(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestDir(d)
@@ -55,6 +82,25 @@ func TestSysValidateEntry(t *testing.T) {
 		So(err.Error(), ShouldEqual, "validator profile failed: object property 'lastName' is required")
 	})
 
+	Convey("an entry type's Schema should be checked before the app's validation", t, func() {
+		z, _ := h.GetZome("jsSampleZome")
+		for i := range z.Entries {
+			if z.Entries[i].Name == "profile" {
+				e := &z.Entries[i]
+				schema, validator := e.Schema, e.validator
+				defer func() { e.Schema, e.validator = schema, validator }()
+				e.validator = nil
+				e.Schema = `{"type":"object","required":["nick"]}`
+			}
+		}
+		So(h.nucleus.dna.check(), ShouldBeNil)
+
+		// validateCommit in the test zome accepts any profile
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `commit("profile",{firstName:"Eric",lastName:"H-B"})`})
+		So(err, ShouldBeNil)
+		So(v.(*JSRibosome).lastResult.String(), ShouldContainSubstring, "object property 'nick' is required")
+	})
+
 	_, def, _ := h.GetEntryDef("rating")
 
 	Convey("validate on a links entry should fail if not formatted correctly", t, func() {
@@ -83,6 +129,59 @@ func TestSysValidateEntry(t *testing.T) {
 	})
 }
 
+func TestSysValidatePut(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	_, def, _ := h.GetEntryDef("evenNumbers")
+	entry := GobEntry{C: "2"}
+	link, _ := entry.Sum(h.hashSpec)
+
+	Convey("it should accept a header whose entry link is the entry's hash", t, func() {
+		a := NewPutAction("evenNumbers", &entry, &Header{EntryLink: link})
+		err := a.SysValidation(h, def, []peer.ID{h.nodeID})
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should reject an entry link that isn't the entry's hash", t, func() {
+		other, _ := (&GobEntry{C: "4"}).Sum(h.hashSpec)
+		a := NewPutAction("evenNumbers", &entry, &Header{EntryLink: other})
+		err := a.SysValidation(h, def, []peer.ID{h.nodeID})
+		So(err, ShouldEqual, ErrEntryLinkMismatch)
+	})
+
+	Convey("it should reject an entry link made with a different hash type", t, func() {
+		b, _ := entry.Marshal()
+		var other Hash
+		other.Sum(HashSpec{Code: mh.SHA1, Length: -1}, b)
+		a := NewPutAction("evenNumbers", &entry, &Header{EntryLink: other})
+		err := a.SysValidation(h, def, []peer.ID{h.nodeID})
+		So(err, ShouldEqual, ErrHashTypeMismatch)
+	})
+
+	Convey("it should reject a signature algorithm the DNA doesn't allow", t, func() {
+		a := NewPutAction("evenNumbers", &entry, &Header{EntryLink: link, Sig: Signature{A: 201}})
+		err := a.SysValidation(h, def, []peer.ID{h.nodeID})
+		So(err, ShouldEqual, ErrSigAlgorithmNotAllowed)
+	})
+
+	Convey("it should require one-time key signatures for ephemeral entry types", t, func() {
+		eph := *def
+		eph.Ephemeral = true
+		a := NewPutAction("evenNumbers", &entry, &Header{EntryLink: link})
+		err := a.SysValidation(h, &eph, []peer.ID{h.nodeID})
+		So(err, ShouldEqual, ErrNotEphemeral)
+
+		k, _ := NewOneTimeKey()
+		sig, _ := Sign(k, link.H)
+		a = NewPutAction("evenNumbers", &entry, &Header{EntryLink: link, Sig: sig})
+		err = a.SysValidation(h, &eph, []peer.ID{h.nodeID})
+		So(err, ShouldBeNil)
+
+		err = a.SysValidation(h, def, []peer.ID{h.nodeID})
+		So(err, ShouldEqual, ErrOneTimeSignature)
+	})
+}
+
 func TestSysValidateMod(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestDir(d)
@@ -107,6 +206,13 @@ func TestSysValidateMod(t *testing.T) {
 		err := a.SysValidation(h, def, []peer.ID{h.nodeID})
 		So(err.Error(), ShouldEqual, "nil entry invalid")
 	})
+
+	Convey("it should reject a signature algorithm the DNA doesn't allow", t, func() {
+		a := NewModAction("evenNumbers", &GobEntry{C: "4"}, hash)
+		a.header = &Header{Sig: Signature{A: 201}}
+		err := a.SysValidation(h, def, []peer.ID{h.nodeID})
+		So(err, ShouldEqual, ErrSigAlgorithmNotAllowed)
+	})
 }
 
 func TestSysValidateDel(t *testing.T) {
@@ -127,6 +233,13 @@ func TestSysValidateDel(t *testing.T) {
 		err := a.SysValidation(h, ratingsDef, []peer.ID{h.nodeID})
 		So(err.Error(), ShouldEqual, "Can't del Links entry")
 	})
+
+	Convey("it should reject a signature algorithm the DNA doesn't allow", t, func() {
+		a := NewDelAction("evenNumbers", DelEntry{Hash: hash})
+		a.header = &Header{Sig: Signature{A: 201}}
+		err := a.SysValidation(h, def, []peer.ID{h.nodeID})
+		So(err, ShouldEqual, ErrSigAlgorithmNotAllowed)
+	})
 }
 
 func TestCheckArgCount(t *testing.T) {
@@ -151,6 +264,93 @@ func TestCheckArgCount(t *testing.T) {
 	})
 }
 
+func TestActionCommitMeta(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	meta := map[string]string{"requestID": "42", "device": "phone"}
+	r, err := NewCommitActionWithOptions("evenNumbers", &GobEntry{C: "2"}, CommitOptions{Meta: meta}).Do(h)
+	if err != nil {
+		panic(err)
+	}
+	hash := r.(Hash)
+
+	Convey("the meta should be in the committed header", t, func() {
+		header, err := h.chain.GetEntryHeader(hash)
+		So(err, ShouldBeNil)
+		So(header.Meta, ShouldResemble, meta)
+	})
+
+	Convey("it should be returned by local gets", t, func() {
+		req := GetReq{H: hash, GetMask: GetMaskMeta}
+		rsp, err := NewGetAction(req, &GetOptions{GetMask: req.GetMask, Local: true}).Do(h)
+		So(err, ShouldBeNil)
+		So(rsp.(GetResp).Meta, ShouldResemble, meta)
+	})
+
+	Convey("it should be returned by DHT gets", t, func() {
+		req := GetReq{H: hash, GetMask: GetMaskMeta}
+		rsp, err := NewGetAction(req, &GetOptions{GetMask: req.GetMask}).Do(h)
+		So(err, ShouldBeNil)
+		So(rsp.(GetResp).Meta, ShouldResemble, meta)
+	})
+
+	Convey("it should not be returned unless asked for", t, func() {
+		req := GetReq{H: hash, GetMask: GetMaskEntry}
+		rsp, err := NewGetAction(req, &GetOptions{GetMask: req.GetMask}).Do(h)
+		So(err, ShouldBeNil)
+		So(rsp.(GetResp).Meta, ShouldBeNil)
+	})
+
+	Convey("commits with too much meta should fail", t, func() {
+		big := make(map[string]string)
+		for i := 0; i <= MaxHeaderMetaEntries; i++ {
+			big[fmt.Sprintf("k%d", i)] = "v"
+		}
+		_, err := NewCommitActionWithOptions("evenNumbers", &GobEntry{C: "4"}, CommitOptions{Meta: big}).Do(h)
+		So(err, ShouldEqual, ErrHeaderMetaTooLarge)
+	})
+}
+
+func TestActionGetByHeader(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	hash := commit(h, "evenNumbers", "2")
+	headerHash := h.chain.Hashes[len(h.chain.Hashes)-1]
+	if err := h.dht.simHandleChangeReqs(); err != nil {
+		panic(err)
+	}
+
+	Convey("it should get the header by default", t, func() {
+		for _, local := range []bool{true, false} {
+			req := GetReq{H: headerHash, GetMask: GetMaskDefault}
+			rsp, err := NewGetAction(req, &GetOptions{GetMask: req.GetMask, Local: local}).Do(h)
+			So(err, ShouldBeNil)
+			header := rsp.(GetResp).Header
+			So(header, ShouldNotBeNil)
+			So(header.EntryLink.String(), ShouldEqual, hash.String())
+			So(header.Type, ShouldEqual, "evenNumbers")
+		}
+	})
+
+	Convey("it should get the header's entry when asked for", t, func() {
+		for _, local := range []bool{true, false} {
+			req := GetReq{H: headerHash, GetMask: GetMaskEntry | GetMaskHeader}
+			rsp, err := NewGetAction(req, &GetOptions{GetMask: req.GetMask, Local: local}).Do(h)
+			So(err, ShouldBeNil)
+			getResp := rsp.(GetResp)
+			So(getResp.Header.EntryLink.String(), ShouldEqual, hash.String())
+			So(getResp.Entry.Content(), ShouldEqual, "2")
+		}
+	})
+
+	Convey("getting an entry hash should not return a header", t, func() {
+		req := GetReq{H: hash, GetMask: GetMaskDefault}
+		rsp, err := NewGetAction(req, &GetOptions{GetMask: req.GetMask}).Do(h)
+		So(err, ShouldBeNil)
+		So(rsp.(GetResp).Header, ShouldBeNil)
+	})
+}
+
 func TestActionGetLocal(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestDir(d)
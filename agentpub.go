@@ -0,0 +1,131 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// agentpub implements publishing an agent's key and agent entries to the DHT, and the
+// key directory the nodes holding a key keep of it: a link from the key to the agent
+// entry it belongs to, tagged with the agent entry type, which getLinks can follow to
+// find the public key and name of whoever signed something
+
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+)
+
+var ErrBadKeyEntry = errors.New("key entry must be published by its own node for an agent entry")
+
+const publishedAgentKey = "agent:published"
+
+// publishAgent sends the key and agent entries to the DHT unless the current agent
+// entry has already been published, so that they are republished whenever it changes.
+// Like commits, they go through the outbox, so they are retried until delivered.
+func (h *Holochain) publishAgent() (err error) {
+	agent := h.AgentHash()
+	var published string
+	err = h.dht.view(func(tx *buntdb.Tx) error {
+		var err error
+		published, err = tx.Get(publishedAgentKey)
+		if err == buntdb.ErrNotFound {
+			err = nil
+		}
+		return err
+	})
+	if err != nil || published == agent.String() {
+		return
+	}
+	var kh Hash
+	if kh, err = NewHash(h.nodeIDStr); err != nil {
+		return
+	}
+	pubs := []*Publication{
+		{Key: kh, T: PUT_REQUEST, Body: PutReq{H: kh}},
+		{Key: agent, T: PUT_REQUEST, Body: PutReq{H: agent}},
+	}
+	if err = h.outbox.Queue(pubs...); err != nil {
+		return
+	}
+	err = h.dht.update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(publishedAgentKey, agent.String(), nil)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	err = h.outbox.Send(pubs...)
+	return
+}
+
+// agentChanged makes the chain's latest agent entry the current one and, if the node is
+// running, republishes the key and agent entries when that is a new agent entry, as
+// after the agent's key is rotated
+func (h *Holochain) agentChanged() (err error) {
+	_, hd := h.chain.TopType(AgentEntryType)
+	if hd == nil || h.agentHash.Equal(&hd.EntryLink) {
+		return
+	}
+	h.agentHash = hd.EntryLink.Clone()
+	if h.outbox != nil && h.outbox.running() {
+		err = h.publishAgent()
+	}
+	return
+}
+
+// checkKeyEntry checks that a key entry was published by the node whose key it is, and
+// that the header sent with it is of that node's agent entry
+func checkKeyEntry(key Hash, from peer.ID, hd *Header) (err error) {
+	if key.String() != peer.IDB58Encode(from) || hd.Type != AgentEntryType {
+		err = ErrBadKeyEntry
+	}
+	return
+}
+
+// linkKeyAgent links a key to its agent entry, replacing the link to any agent entry
+// it had before.  The link isn't gossiped itself, as it comes with the key's put.
+func (dht *DHT) linkKeyAgent(key Hash, agent string) (err error) {
+	err = dht.update(func(tx *buntdb.Tx) error {
+		return _linkKeyAgent(tx, key.String(), agent)
+	})
+	return
+}
+
+// _linkKeyAgent makes the link from the key k to agent the only live one of its
+// links to agent entries.  A link to an agent the key belonged to before is
+// brought back to live.
+func _linkKeyAgent(tx *buntdb.Tx, k string, agent string) (err error) {
+	prefix := "link:" + k + ":"
+	suffix := ":" + AgentEntryType
+	var stale []string
+	err = tx.AscendKeys(prefix+"*"+suffix, func(key, value string) bool {
+		if value == StatusLiveVal && key != prefix+agent+suffix {
+			stale = append(stale, key)
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	for _, key := range stale {
+		if _, _, err = tx.Set(key, StatusDeletedVal, nil); err != nil {
+			return
+		}
+	}
+	_, _, err = tx.Set(prefix+agent+suffix, StatusLiveVal, nil)
+	return
+}
+
+// KeyAgent returns the hash of the agent entry a key held by this node belongs to
+func (dht *DHT) KeyAgent(key Hash) (agent Hash, err error) {
+	var links []TaggedHash
+	if links, err = dht.getLink(key, AgentEntryType, StatusLive); err != nil {
+		return
+	}
+	if len(links) == 0 {
+		err = ErrLinkNotFound
+		return
+	}
+	agent, err = NewHash(links[0].H)
+	return
+}
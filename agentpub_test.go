@@ -0,0 +1,105 @@
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestKeyAgentLink(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	kh, _ := NewHash(h.nodeIDStr)
+
+	Convey("genesis should link the key to the agent entry", t, func() {
+		agent, err := h.dht.KeyAgent(kh)
+		So(err, ShouldBeNil)
+		So(agent.String(), ShouldEqual, h.agentHash.String())
+	})
+
+	Convey("linking a new agent entry should replace the old link", t, func() {
+		other, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(h.dht.linkKeyAgent(kh, other.String()), ShouldBeNil)
+		links, err := h.dht.getLink(kh, AgentEntryType, StatusLive)
+		So(err, ShouldBeNil)
+		So(len(links), ShouldEqual, 1)
+		So(links[0].H, ShouldEqual, other.String())
+	})
+
+	Convey("linking a previous agent entry again should bring its link back to live", t, func() {
+		So(h.dht.linkKeyAgent(kh, h.agentHash.String()), ShouldBeNil)
+		agent, err := h.dht.KeyAgent(kh)
+		So(err, ShouldBeNil)
+		So(agent.String(), ShouldEqual, h.agentHash.String())
+		links, err := h.dht.getLink(kh, AgentEntryType, StatusDeleted)
+		So(err, ShouldBeNil)
+		So(len(links), ShouldEqual, 1)
+	})
+
+	Convey("a key without a live link should have no agent", t, func() {
+		_, err := h.dht.KeyAgent(h.dnaHash)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("key entries should only be accepted from their own node for an agent entry", t, func() {
+		_, hd := h.chain.TopType(AgentEntryType)
+		So(checkKeyEntry(kh, h.nodeID, hd), ShouldBeNil)
+		other, _ := peer.IDB58Decode("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(checkKeyEntry(kh, other, hd), ShouldEqual, ErrBadKeyEntry)
+		So(checkKeyEntry(kh, h.nodeID, h.chain.Headers[0]), ShouldEqual, ErrBadKeyEntry)
+	})
+
+	Convey("the validation response for the key should carry the agent entry's header", t, func() {
+		resp, err := h.GetValidationResponse(NewPutAction(KeyEntryType, nil, nil), kh)
+		So(err, ShouldBeNil)
+		So(resp.Type, ShouldEqual, KeyEntryType)
+		So(resp.Header.EntryLink.String(), ShouldEqual, h.agentHash.String())
+	})
+}
+
+func TestPublishAgent(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	o := h.Outbox()
+	var sent []*Publication
+	o.sendp = func(p *Publication) (bool, error) {
+		sent = append(sent, p)
+		return false, errors.New("offline")
+	}
+
+	Convey("it should publish the key and agent entries", t, func() {
+		So(h.publishAgent(), ShouldBeNil)
+		So(len(sent), ShouldEqual, 2)
+		So(sent[0].Key.String(), ShouldEqual, h.nodeIDStr)
+		So(sent[1].Key.String(), ShouldEqual, h.agentHash.String())
+		pubs, err := o.Pending()
+		So(err, ShouldBeNil)
+		So(len(pubs), ShouldEqual, 2)
+	})
+
+	Convey("it should not publish them again until the agent entry changes", t, func() {
+		sent = nil
+		So(h.publishAgent(), ShouldBeNil)
+		So(len(sent), ShouldEqual, 0)
+
+		h.agentHash, _ = NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(h.publishAgent(), ShouldBeNil)
+		So(len(sent), ShouldEqual, 2)
+	})
+
+	Convey("a new agent entry on the chain should be republished once the node is running", t, func() {
+		_, hd := h.chain.TopType(AgentEntryType)
+		h.agentHash = Hash{}
+		sent = nil
+		So(h.agentChanged(), ShouldBeNil)
+		So(h.agentHash.String(), ShouldEqual, hd.EntryLink.String())
+		So(len(sent), ShouldEqual, 0)
+
+		h.agentHash = Hash{}
+		o.Start()
+		defer o.Stop()
+		So(h.agentChanged(), ShouldBeNil)
+		So(len(sent), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// apikey implements the named keys that clients of a node's web api authenticate with
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+var ErrAPIKeyScope = errors.New("api key not permitted")
+
+// APIKey is a key a client of the web api authenticates with.  Keys that aren't Write
+// keys may only read, i.e. get entries and task statuses, while Write keys may also call
+// the zome functions matched by Functions, which are patterns of the form zome/function
+// where either part may be * (or any other path.Match pattern).
+type APIKey struct {
+	Name      string
+	Key       string
+	Write     bool
+	Functions []string
+	RateLimit float64 // requests per second allowed, 0 for no limit
+	Burst     int     // requests allowed at once above the rate, at least 1
+}
+
+// Allows returns nil if the key may call the given zome function
+func (k *APIKey) Allows(zome string, function string) (err error) {
+	if !k.Write {
+		err = ErrAPIKeyScope
+		return
+	}
+	fn := zome + "/" + function
+	for _, pattern := range k.Functions {
+		if ok, _ := path.Match(pattern, fn); ok {
+			return
+		}
+	}
+	err = ErrAPIKeyScope
+	return
+}
+
+// validateAPIKeys checks that keys all have a distinct name and key, and well formed scopes
+func validateAPIKeys(keys []APIKey) (err error) {
+	names := make(map[string]bool)
+	values := make(map[string]bool)
+	for _, k := range keys {
+		if k.Name == "" || k.Key == "" {
+			err = errors.New("api keys must have a Name and Key")
+			return
+		}
+		if names[k.Name] || values[k.Key] {
+			err = fmt.Errorf("api key %s is not unique", k.Name)
+			return
+		}
+		names[k.Name] = true
+		values[k.Key] = true
+		for _, pattern := range k.Functions {
+			if _, e := path.Match(pattern, ""); e != nil {
+				err = fmt.Errorf("api key %s has bad function pattern %q", k.Name, pattern)
+				return
+			}
+		}
+		if k.RateLimit < 0 || k.Burst < 0 {
+			err = fmt.Errorf("api key %s has a negative rate limit", k.Name)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,31 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAPIKeyAllows(t *testing.T) {
+	Convey("read keys should not be allowed to call functions", t, func() {
+		k := APIKey{Name: "reader", Key: "abc", Functions: []string{"*/*"}}
+		So(k.Allows("zome", "fn"), ShouldEqual, ErrAPIKeyScope)
+	})
+
+	Convey("write keys should be allowed to call the functions they match", t, func() {
+		k := APIKey{Name: "writer", Key: "abc", Write: true, Functions: []string{"zome1/*", "zome2/get*"}}
+		So(k.Allows("zome1", "fn"), ShouldBeNil)
+		So(k.Allows("zome2", "getPosts"), ShouldBeNil)
+		So(k.Allows("zome2", "addPost"), ShouldEqual, ErrAPIKeyScope)
+		So(k.Allows("zome3", "fn"), ShouldEqual, ErrAPIKeyScope)
+	})
+}
+
+func TestValidateAPIKeys(t *testing.T) {
+	Convey("it should validate api keys", t, func() {
+		So(validateAPIKeys([]APIKey{{Name: "a", Key: "1"}, {Name: "b", Key: "2"}}), ShouldBeNil)
+		So(validateAPIKeys([]APIKey{{Name: "a"}}).Error(), ShouldEqual, "api keys must have a Name and Key")
+		So(validateAPIKeys([]APIKey{{Name: "a", Key: "1"}, {Name: "b", Key: "1"}}).Error(), ShouldEqual, "api key b is not unique")
+		So(validateAPIKeys([]APIKey{{Name: "a", Key: "1", Functions: []string{"["}}}).Error(), ShouldEqual, `api key a has bad function pattern "["`)
+		So(validateAPIKeys([]APIKey{{Name: "a", Key: "1", RateLimit: -1}}).Error(), ShouldEqual, "api key a has a negative rate limit")
+	})
+}
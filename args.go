@@ -0,0 +1,219 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// args implements checking and converting the arguments passed to built-in functions
+// against their declared Arg specs, shared by all ribosome types
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// argKind is the basic type of a ribosome value passed as an argument
+type argKind int
+
+const (
+	argOther argKind = iota
+	argStr
+	argNumber
+	argBool
+	argObject
+	argArray
+)
+
+// argValue is implemented by each ribosome to adapt its native values for processArgs
+type argValue interface {
+	kind() argKind
+	str() string
+	integer() (int64, error)
+	boolean() (bool, error)
+	json() (string, error)        // JSON of an object or array
+	export() (interface{}, error) // go value of an object
+	toStr() (string, bool)        // string conversion of any non-object value
+	objectName() string           // what the ribosome calls objects, used in errors
+}
+
+// argTypeNames are the names used for arg types in built-in signatures
+var argTypeNames = map[ArgType]string{
+	HashArg:   "Hash",
+	StringArg: "string",
+	EntryArg:  "entry",
+	IntArg:    "int",
+	BoolArg:   "boolean",
+	MapArg:    "object",
+	ToStrArg:  "any",
+	ArgsArg:   "args",
+}
+
+// argSignature returns a description of the args like "hash: Hash, options?: object"
+func argSignature(args []Arg) string {
+	var sig []string
+	for _, a := range args {
+		opt := ""
+		if a.Optional {
+			opt = "?"
+		}
+		sig = append(sig, a.Name+opt+": "+argTypeNames[a.Type])
+	}
+	return strings.Join(sig, ", ")
+}
+
+// actionArgsErr reports a wrong number of arguments with the signature of the action's built-in
+func actionArgsErr(a BuiltinAction, args []Arg, err error) error {
+	if errors.Is(err, ErrWrongNargs) {
+		return &wrappedError{msg: fmt.Sprintf("%s() expects (%s)", a.Name(), argSignature(args)), err: ErrInvalidArgs}
+	}
+	return err
+}
+
+// processArgs checks vals against the args spec filling args[].value with the converted
+// values and the defaults of any missing optional args
+func processArgs(args []Arg, vals []argValue) (err error) {
+	err = checkArgCount(args, len(vals))
+	if err != nil {
+		return
+	}
+
+	for i, v := range vals {
+		arg := &args[i]
+		switch arg.Type {
+		case StringArg:
+			if v.kind() != argStr {
+				return argErr("string", i+1, *arg)
+			}
+			arg.value = v.str()
+		case HashArg:
+			if v.kind() != argStr {
+				return argErr("string", i+1, *arg)
+			}
+			var hash Hash
+			hash, err = NewHash(v.str())
+			if err != nil {
+				return
+			}
+			arg.value = hash
+		case IntArg:
+			if v.kind() != argNumber {
+				return argErr("int", i+1, *arg)
+			}
+			arg.value, err = v.integer()
+		case BoolArg:
+			if v.kind() != argBool {
+				return argErr("boolean", i+1, *arg)
+			}
+			arg.value, err = v.boolean()
+		case ArgsArg, EntryArg:
+			switch v.kind() {
+			case argStr:
+				arg.value = v.str()
+			case argObject:
+				arg.value, err = v.json()
+			default:
+				return argErr("string or "+v.objectName(), i+1, *arg)
+			}
+		case MapArg:
+			if v.kind() != argObject {
+				return argErr(v.objectName(), i+1, *arg)
+			}
+			arg.value, err = v.export()
+			if err == nil && arg.Fields != nil {
+				err = checkFields(fmt.Sprintf("argument %d (%s)", i+1, arg.Name), arg.Fields, arg.value)
+			}
+		case ToStrArg:
+			switch v.kind() {
+			case argObject, argArray:
+				arg.value, err = v.json()
+			default:
+				s, ok := v.toStr()
+				if !ok {
+					return argErr("int, boolean, string, array or "+v.objectName(), i+1, *arg)
+				}
+				arg.value = s
+			}
+		}
+		if err != nil {
+			return
+		}
+		if arg.Enum != nil {
+			err = checkEnum(fmt.Sprintf("argument %d (%s)", i+1, arg.Name), arg.Enum, arg.value)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	for i := len(vals); i < len(args); i++ {
+		args[i].value = args[i].Default
+	}
+	return
+}
+
+func checkEnum(what string, enum []string, value interface{}) error {
+	s, _ := value.(string)
+	for _, e := range enum {
+		if s == e {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s should be one of: %s", what, strings.Join(enum, ", "))
+}
+
+// checkFields validates the fields of an object argument against their specs, setting
+// the defaults of missing optional fields
+func checkFields(what string, fields []Arg, value interface{}) (err error) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s should be object", what)
+	}
+	for _, f := range fields {
+		fwhat := what + " field " + f.Name
+		v, ok := m[f.Name]
+		if !ok {
+			if !f.Optional {
+				return fmt.Errorf("%s is required", fwhat)
+			}
+			if f.Default != nil {
+				m[f.Name] = f.Default
+			}
+			continue
+		}
+		var typeOk bool
+		switch f.Type {
+		case StringArg, HashArg:
+			_, typeOk = v.(string)
+			if typeOk && f.Type == HashArg {
+				if _, e := NewHash(v.(string)); e != nil {
+					return fmt.Errorf("%s should be Hash: %v", fwhat, e)
+				}
+			}
+		case IntArg:
+			_, typeOk = numInterfaceToInt(v)
+		case BoolArg:
+			_, typeOk = v.(bool)
+		case MapArg:
+			_, typeOk = v.(map[string]interface{})
+			if typeOk && f.Fields != nil {
+				err = checkFields(fwhat, f.Fields, v)
+				if err != nil {
+					return
+				}
+			}
+		default:
+			typeOk = true
+		}
+		if !typeOk {
+			return fmt.Errorf("%s should be %s", fwhat, argTypeNames[f.Type])
+		}
+		if f.Enum != nil {
+			err = checkEnum(fwhat, f.Enum, v)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package holochain
+
+import (
+	zygo "github.com/glycerine/zygomys/repl"
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestArgSignature(t *testing.T) {
+	Convey("it should describe the args", t, func() {
+		a := &ActionGetLink{}
+		So(argSignature(a.Args()), ShouldEqual, "base: Hash, tag: string, options?: object")
+		So(argSignature(nil), ShouldEqual, "")
+	})
+	Convey("it should report wrong arg counts with the signature", t, func() {
+		a := &ActionGet{}
+		err := zyProcessActionArgs(a, a.Args(), []zygo.Sexp{})
+		So(err.Error(), ShouldEqual, "get() expects (hash: Hash, options?: object)")
+
+		args := a.Args()
+		err = zyProcessActionArgs(a, args, []zygo.Sexp{zygo.SexpNull})
+		So(err.Error(), ShouldEqual, "argument 1 (hash) should be string")
+	})
+}
+
+func TestProcessArgsSchema(t *testing.T) {
+	jsr := &JSRibosome{vm: otto.New()}
+	val := func(v interface{}) otto.Value {
+		o, _ := jsr.vm.ToValue(v)
+		return o
+	}
+
+	Convey("missing optional args should get their defaults", t, func() {
+		args := []Arg{{Name: "a", Type: StringArg}, {Name: "b", Type: IntArg, Optional: true, Default: int64(7)}, {Name: "c", Type: StringArg, Optional: true}}
+		err := jsProcessArgs(jsr, args, []otto.Value{val("x")})
+		So(err, ShouldBeNil)
+		So(args[1].value, ShouldEqual, int64(7))
+		So(args[2].value, ShouldBeNil)
+	})
+
+	Convey("enum args should be checked", t, func() {
+		args := []Arg{{Name: "mode", Type: StringArg, Enum: []string{"fast", "slow"}}}
+		err := jsProcessArgs(jsr, args, []otto.Value{val("fast")})
+		So(err, ShouldBeNil)
+		err = jsProcessArgs(jsr, args, []otto.Value{val("medium")})
+		So(err.Error(), ShouldEqual, "argument 1 (mode) should be one of: fast, slow")
+	})
+
+	Convey("object fields should be validated", t, func() {
+		args := []Arg{{Name: "opts", Type: MapArg, Fields: []Arg{
+			{Name: "Count", Type: IntArg},
+			{Name: "Order", Type: StringArg, Optional: true, Enum: []string{"asc", "desc"}, Default: "asc"},
+			{Name: "Sub", Type: MapArg, Optional: true, Fields: []Arg{{Name: "On", Type: BoolArg}}},
+		}}}
+		err := jsProcessArgs(jsr, args, []otto.Value{val(map[string]interface{}{"Count": 2})})
+		So(err, ShouldBeNil)
+		So(args[0].value.(map[string]interface{})["Order"], ShouldEqual, "asc")
+
+		err = jsProcessArgs(jsr, args, []otto.Value{val(map[string]interface{}{})})
+		So(err.Error(), ShouldEqual, "argument 1 (opts) field Count is required")
+
+		err = jsProcessArgs(jsr, args, []otto.Value{val(map[string]interface{}{"Count": "2"})})
+		So(err.Error(), ShouldEqual, "argument 1 (opts) field Count should be int")
+
+		err = jsProcessArgs(jsr, args, []otto.Value{val(map[string]interface{}{"Count": 2, "Order": "up"})})
+		So(err.Error(), ShouldEqual, "argument 1 (opts) field Order should be one of: asc, desc")
+
+		err = jsProcessArgs(jsr, args, []otto.Value{val(map[string]interface{}{"Count": 2, "Sub": map[string]interface{}{"On": 1}})})
+		So(err.Error(), ShouldEqual, "argument 1 (opts) field Sub field On should be boolean")
+	})
+}
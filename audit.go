@@ -0,0 +1,521 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// audit implements recording the actions a node does into an append-only log whose
+// records are chained by hash and signed by the agent so that any change to them can
+// be detected.  The last record is also kept in a signed head file so that records
+// removed from the end of the log are detected too.
+
+package holochain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuditDir             string = "audit"      // Sub-directory of the audit log's files
+	AuditFileName        string = "audit.log"  // Filename the audit log is appended to
+	AuditHeadFileName    string = "audit.head" // Filename of the signed record of the log's last record
+	DefaultAuditLogSize  int64  = 10 * 1024 * 1024
+	auditRotatedPrefix   string = "audit-"
+	auditRotatedSuffix   string = ".log"
+	auditRotatedSeqWidth int    = 12
+	auditMaxRecordSize   int    = 16 * 1024 * 1024
+)
+
+var ErrAuditTampered = errors.New("audit log has been tampered with")
+
+// AuditRecord records an action done by a node
+type AuditRecord struct {
+	Seq    int64
+	Time   time.Time
+	Agent  string
+	Zome   string `json:",omitempty"`
+	Action string
+	Args   map[string]interface{} `json:",omitempty"` // the args of the built-in call, by name
+	Result json.RawMessage        `json:",omitempty"` // the JSON of what the action returned
+	Error  string                 `json:",omitempty"`
+	Prev   string                 // the hash of the record before, empty for the first
+	Hash   string                 // the hash of this record with its Hash and Sig empty
+	Sig    Signature              // the agent's signature of the Hash
+}
+
+// AuditHead is the signed record of the last record of an audit log
+type AuditHead struct {
+	Seq  int64
+	Hash string
+	Sig  Signature
+}
+
+func (hd *AuditHead) signedData() []byte {
+	return []byte(fmt.Sprintf("audit head %d %s", hd.Seq, hd.Hash))
+}
+
+// Auditor records the actions a node does.  Auditors must be safe for concurrent use.
+type Auditor interface {
+	Audit(rec AuditRecord) error
+}
+
+// actionDoer is what is common to all the actions that can be done
+type actionDoer interface {
+	Name() string
+	Do(h *Holochain) (response interface{}, err error)
+}
+
+// SetAuditor sets what records the actions the holochain does, nil for nothing
+func (h *Holochain) SetAuditor(a Auditor) {
+	h.auditor = a
+}
+
+// Auditor returns what records the actions the holochain does
+func (h *Holochain) Auditor() Auditor {
+	return h.auditor
+}
+
+// doAction does an action for a zome, which is empty for actions the node does itself,
+// and records it with the auditor if there is one, along with the args of the built-in
+// call it was made for.  Failing to record an action is logged rather than failing the
+// action, which has already been done.
+func (h *Holochain) doAction(zome string, a actionDoer, args ...Arg) (response interface{}, err error) {
+	response, err = a.Do(h)
+	if h.auditor != nil {
+		rec := AuditRecord{Time: time.Now(), Agent: h.nodeIDStr, Zome: zome, Action: a.Name(), Args: auditArgs(args)}
+		if err != nil {
+			rec.Error = err.Error()
+		} else {
+			rec.Result = auditResult(response)
+		}
+		if e := h.auditor.Audit(rec); e != nil {
+			h.config.Loggers.App.Logf("audit of %s failed: %v", rec.Action, e)
+		}
+	}
+	return
+}
+
+// auditArgs returns the values of a built-in call's args by name
+func auditArgs(args []Arg) (values map[string]interface{}) {
+	for _, a := range args {
+		if a.value == nil {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		if hash, ok := a.value.(Hash); ok {
+			values[a.Name] = hash.String()
+		} else {
+			values[a.Name] = a.value
+		}
+	}
+	return
+}
+
+// auditResult returns the JSON of an action's response, or of its string form if it
+// can't be marshaled
+func auditResult(response interface{}) (result json.RawMessage) {
+	if response == nil {
+		return
+	}
+	if hash, ok := response.(Hash); ok {
+		response = hash.String()
+	}
+	b, err := json.Marshal(response)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%v", response))
+	}
+	result = b
+	return
+}
+
+// setupAuditLog opens the audit log if the config asks for one.  Its records are signed
+// with the agent's key, so it isn't opened until the agent is loaded.
+func (h *Holochain) setupAuditLog() (err error) {
+	if !h.config.AuditLog || h.agent == nil {
+		return
+	}
+	h.auditor, err = OpenAuditLog(filepath.Join(h.rootPath, AuditDir), h.config.AuditLogSize, h.agent.PrivKey())
+	return
+}
+
+// hashAuditRecord returns the hash of a record with its Hash and Sig empty
+func hashAuditRecord(rec AuditRecord) (hash string, err error) {
+	rec.Hash = ""
+	rec.Sig = Signature{}
+	var b []byte
+	if b, err = json.Marshal(rec); err != nil {
+		return
+	}
+	sum := sha256.Sum256(b)
+	hash = hex.EncodeToString(sum[:])
+	return
+}
+
+// AuditLog is an Auditor that appends records to a file, one JSON object per line.
+// When the file reaches its size limit it is renamed after the sequence number of its
+// first record and a new file is started, with the hash chain carrying on across them.
+type AuditLog struct {
+	lk      sync.Mutex
+	dir     string
+	maxSize int64
+	key     ic.PrivKey
+	f       *os.File
+	size    int64
+	first   int64 // the sequence number of the first record in the current file
+	seq     int64
+	prev    string
+}
+
+// OpenAuditLog opens the audit log in dir, creating it if need be, carrying on from its
+// last record.  Records are signed with key.  Files are rotated when they reach maxSize
+// bytes, or DefaultAuditLogSize if maxSize is 0.  A partly written last record, left by
+// a crash, is removed, but a log that ends before its head is refused.
+func OpenAuditLog(dir string, maxSize int64, key ic.PrivKey) (l *AuditLog, err error) {
+	if maxSize <= 0 {
+		maxSize = DefaultAuditLogSize
+	}
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return
+	}
+	if err = truncateTornAuditRecord(filepath.Join(dir, AuditFileName)); err != nil {
+		return
+	}
+	var files []string
+	if files, err = auditFiles(dir); err != nil {
+		return
+	}
+	al := AuditLog{dir: dir, maxSize: maxSize, key: key}
+	// the last record is in the current file unless it was just rotated
+	for i := len(files) - 1; i >= 0 && al.prev == ""; i-- {
+		var rec *AuditRecord
+		if rec, err = lastAuditRecord(files[i]); err != nil {
+			return
+		}
+		if rec != nil {
+			al.seq = rec.Seq
+			al.prev = rec.Hash
+		}
+	}
+	var head *AuditHead
+	if head, err = readAuditHead(dir); err != nil {
+		return
+	}
+	if err = checkAuditHead(head, key.GetPublic(), al.seq, al.prev); err != nil {
+		return
+	}
+	al.first = al.seq + 1
+	p := filepath.Join(dir, AuditFileName)
+	if al.f, err = os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return
+	}
+	var info os.FileInfo
+	if info, err = al.f.Stat(); err != nil {
+		al.f.Close()
+		return
+	}
+	al.size = info.Size()
+	if al.size > 0 {
+		var rec *AuditRecord
+		if rec, err = firstAuditRecord(p); err != nil {
+			al.f.Close()
+			return
+		}
+		if rec != nil {
+			al.first = rec.Seq
+		}
+	}
+	l = &al
+	return
+}
+
+// auditFiles returns the paths of the audit log's files, oldest first
+func auditFiles(dir string) (files []string, err error) {
+	var infos []os.FileInfo
+	if infos, err = ioutil.ReadDir(dir); err != nil {
+		return
+	}
+	for _, info := range infos {
+		n := info.Name()
+		if strings.HasPrefix(n, auditRotatedPrefix) && strings.HasSuffix(n, auditRotatedSuffix) {
+			files = append(files, filepath.Join(dir, n))
+		}
+	}
+	// rotated files are named with zero padded sequence numbers so sort by name
+	sort.Strings(files)
+	p := filepath.Join(dir, AuditFileName)
+	if fileExists(p) {
+		files = append(files, p)
+	}
+	return
+}
+
+// truncateTornAuditRecord removes a partly written record from the end of the file
+func truncateTornAuditRecord(path string) (err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if len(b) == 0 || b[len(b)-1] == '\n' {
+		return
+	}
+	end := bytes.LastIndexByte(b, '\n') + 1
+	Infof("removing partly written audit record from %s", path)
+	err = os.Truncate(path, int64(end))
+	return
+}
+
+// readAuditHead reads the log's head file, returning nil if it has none
+func readAuditHead(dir string) (head *AuditHead, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(filepath.Join(dir, AuditHeadFileName)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	head = &AuditHead{}
+	err = json.Unmarshal(b, head)
+	return
+}
+
+// checkAuditHead checks that a log whose last record has the sequence number and hash
+// reaches its head.  The log may be one record past the head if it was written but
+// the head wasn't.
+func checkAuditHead(head *AuditHead, pub ic.PubKey, seq int64, hash string) (err error) {
+	if head == nil {
+		return
+	}
+	valid, err := head.Sig.Verify(pub, head.signedData())
+	if err != nil || !valid {
+		err = fmt.Errorf("%w: head isn't signed by the agent", ErrAuditTampered)
+		return
+	}
+	if seq < head.Seq || (seq == head.Seq && hash != head.Hash) {
+		err = fmt.Errorf("%w: log ends before its head at record %d", ErrAuditTampered, head.Seq)
+	}
+	return
+}
+
+// writeHead replaces the log's head file with one for its last record
+func (l *AuditLog) writeHead() (err error) {
+	head := AuditHead{Seq: l.seq, Hash: l.prev}
+	if head.Sig, err = Sign(l.key, head.signedData()); err != nil {
+		return
+	}
+	var b []byte
+	if b, err = json.Marshal(head); err != nil {
+		return
+	}
+	p := filepath.Join(l.dir, AuditHeadFileName)
+	if err = ioutil.WriteFile(p+".tmp", b, 0600); err != nil {
+		return
+	}
+	err = os.Rename(p+".tmp", p)
+	return
+}
+
+// Head returns the signed record of the log's last record
+func (l *AuditLog) Head() (head *AuditHead, err error) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	head, err = readAuditHead(l.dir)
+	return
+}
+
+// newAuditScanner returns a scanner of the records read from r, which can be as long as
+// the largest record allowed
+func newAuditScanner(r io.Reader) (s *bufio.Scanner) {
+	s = bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), auditMaxRecordSize)
+	return
+}
+
+func firstAuditRecord(path string) (rec *AuditRecord, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+	s := newAuditScanner(f)
+	if s.Scan() {
+		var r AuditRecord
+		if err = json.Unmarshal(s.Bytes(), &r); err != nil {
+			return
+		}
+		rec = &r
+	}
+	err = s.Err()
+	return
+}
+
+func lastAuditRecord(path string) (rec *AuditRecord, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	last := lines[len(lines)-1]
+	if len(last) == 0 {
+		return
+	}
+	var r AuditRecord
+	if err = json.Unmarshal(last, &r); err != nil {
+		return
+	}
+	rec = &r
+	return
+}
+
+// Audit appends a record to the log, setting its sequence number, hashes and signature
+func (l *AuditLog) Audit(rec AuditRecord) (err error) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.f == nil {
+		err = errors.New("audit log is closed")
+		return
+	}
+	if l.size >= l.maxSize {
+		if err = l.rotate(); err != nil {
+			return
+		}
+	}
+	rec.Seq = l.seq + 1
+	rec.Prev = l.prev
+	if rec.Hash, err = hashAuditRecord(rec); err != nil {
+		return
+	}
+	if rec.Sig, err = Sign(l.key, []byte(rec.Hash)); err != nil {
+		return
+	}
+	var b []byte
+	if b, err = json.Marshal(rec); err != nil {
+		return
+	}
+	if len(b) >= auditMaxRecordSize {
+		err = fmt.Errorf("audit record of %s is too large", rec.Action)
+		return
+	}
+	b = append(b, '\n')
+	var n int
+	n, err = l.f.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		return
+	}
+	l.seq = rec.Seq
+	l.prev = rec.Hash
+	err = l.writeHead()
+	return
+}
+
+// rotate renames the current file after its first record and starts a new one
+func (l *AuditLog) rotate() (err error) {
+	if err = l.f.Close(); err != nil {
+		return
+	}
+	l.f = nil
+	name := fmt.Sprintf("%s%0*d%s", auditRotatedPrefix, auditRotatedSeqWidth, l.first, auditRotatedSuffix)
+	p := filepath.Join(l.dir, AuditFileName)
+	if err = os.Rename(p, filepath.Join(l.dir, name)); err != nil {
+		return
+	}
+	if l.f, err = os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return
+	}
+	l.size = 0
+	l.first = l.seq + 1
+	return
+}
+
+// Export writes all the records of the log, oldest first, one JSON object per line
+func (l *AuditLog) Export(w io.Writer) (err error) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	var files []string
+	if files, err = auditFiles(l.dir); err != nil {
+		return
+	}
+	for _, p := range files {
+		var f *os.File
+		if f, err = os.Open(p); err != nil {
+			return
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Close closes the log's file
+func (l *AuditLog) Close() (err error) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.f != nil {
+		err = l.f.Close()
+		l.f = nil
+	}
+	return
+}
+
+// VerifyAudit checks that the exported records read from r were signed with the agent's
+// key, and are unchanged, complete and in order, returning how many there are.  The check
+// starts from whatever the first record is so that a log whose oldest files were removed
+// can still be verified.  If the log's head is given, the records must reach it.
+func VerifyAudit(r io.Reader, pub ic.PubKey, head *AuditHead) (count int, err error) {
+	s := newAuditScanner(r)
+	var prev *AuditRecord
+	for s.Scan() {
+		var rec AuditRecord
+		if err = json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return
+		}
+		var hash string
+		if hash, err = hashAuditRecord(rec); err != nil {
+			return
+		}
+		if hash != rec.Hash {
+			err = fmt.Errorf("%w: record %d doesn't match its hash", ErrAuditTampered, rec.Seq)
+			return
+		}
+		if valid, e := rec.Sig.Verify(pub, []byte(rec.Hash)); e != nil || !valid {
+			err = fmt.Errorf("%w: record %d isn't signed by the agent", ErrAuditTampered, rec.Seq)
+			return
+		}
+		if prev != nil && (rec.Seq != prev.Seq+1 || rec.Prev != prev.Hash) {
+			err = fmt.Errorf("%w: record %d doesn't follow record %d", ErrAuditTampered, rec.Seq, prev.Seq)
+			return
+		}
+		prev = &rec
+		count++
+	}
+	if err = s.Err(); err != nil {
+		return
+	}
+	if prev != nil {
+		err = checkAuditHead(head, pub, prev.Seq, prev.Hash)
+	} else {
+		err = checkAuditHead(head, pub, 0, "")
+	}
+	return
+}
@@ -0,0 +1,200 @@
+package holochain
+
+import (
+	"bytes"
+	"crypto/rand"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testAuditor struct {
+	lk   sync.Mutex
+	recs []AuditRecord
+}
+
+func (a *testAuditor) Audit(rec AuditRecord) error {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	a.recs = append(a.recs, rec)
+	return nil
+}
+
+func TestAuditLog(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	dir := filepath.Join(d, AuditDir)
+	key, pub, _ := ic.GenerateEd25519Key(rand.Reader)
+
+	audit := func(l *AuditLog, n int) {
+		for i := 0; i < n; i++ {
+			if err := l.Audit(AuditRecord{Time: time.Now(), Agent: "agent", Zome: "zome", Action: "commit"}); err != nil {
+				panic(err)
+			}
+		}
+	}
+	export := func(l *AuditLog) string {
+		var b bytes.Buffer
+		if err := l.Export(&b); err != nil {
+			panic(err)
+		}
+		return b.String()
+	}
+
+	Convey("records should be chained by hash and rotated", t, func() {
+		l, err := OpenAuditLog(dir, 500, key)
+		So(err, ShouldBeNil)
+		audit(l, 10)
+		So(l.Close(), ShouldBeNil)
+
+		files, err := auditFiles(dir)
+		So(err, ShouldBeNil)
+		So(len(files), ShouldBeGreaterThan, 1)
+		So(filepath.Base(files[0]), ShouldEqual, "audit-000000000001.log")
+	})
+
+	Convey("reopening the log should carry on the chain", t, func() {
+		l, err := OpenAuditLog(dir, 500, key)
+		So(err, ShouldBeNil)
+		defer l.Close()
+		audit(l, 3)
+		x := export(l)
+		head, err := l.Head()
+		So(err, ShouldBeNil)
+		So(head.Seq, ShouldEqual, 13)
+		n, err := VerifyAudit(strings.NewReader(x), pub, head)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 13)
+	})
+
+	Convey("changed, removed and reordered records should be detected", t, func() {
+		l, err := OpenAuditLog(dir, 500, key)
+		So(err, ShouldBeNil)
+		defer l.Close()
+		lines := strings.Split(strings.TrimSpace(export(l)), "\n")
+
+		changed := strings.Replace(strings.Join(lines, "\n"), `"Action":"commit"`, `"Action":"del"`, 1)
+		_, err = VerifyAudit(strings.NewReader(changed), pub, nil)
+		So(err.Error(), ShouldStartWith, ErrAuditTampered.Error())
+
+		removed := strings.Join(append(lines[:4:4], lines[5:]...), "\n")
+		_, err = VerifyAudit(strings.NewReader(removed), pub, nil)
+		So(err.Error(), ShouldStartWith, ErrAuditTampered.Error())
+
+		lines[2], lines[3] = lines[3], lines[2]
+		_, err = VerifyAudit(strings.NewReader(strings.Join(lines, "\n")), pub, nil)
+		So(err.Error(), ShouldStartWith, ErrAuditTampered.Error())
+	})
+
+	Convey("records rewritten without the agent's key should be detected", t, func() {
+		l, err := OpenAuditLog(dir, 500, key)
+		So(err, ShouldBeNil)
+		defer l.Close()
+		x := export(l)
+		_, otherPub, _ := ic.GenerateEd25519Key(rand.Reader)
+		_, err = VerifyAudit(strings.NewReader(x), otherPub, nil)
+		So(err.Error(), ShouldStartWith, ErrAuditTampered.Error())
+	})
+
+	Convey("records removed from the end should be detected by the head", t, func() {
+		l, err := OpenAuditLog(dir, 500, key)
+		So(err, ShouldBeNil)
+		defer l.Close()
+		head, err := l.Head()
+		So(err, ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(export(l)), "\n")
+		truncated := strings.Join(lines[:len(lines)-1], "\n")
+		_, err = VerifyAudit(strings.NewReader(truncated), pub, head)
+		So(err.Error(), ShouldStartWith, ErrAuditTampered.Error())
+	})
+
+	Convey("a log whose last records were removed should not be opened", t, func() {
+		d := SetupTestDir()
+		defer CleanupTestDir(d)
+		dir := filepath.Join(d, AuditDir)
+		l, err := OpenAuditLog(dir, 0, key)
+		So(err, ShouldBeNil)
+		audit(l, 3)
+		So(l.Close(), ShouldBeNil)
+		p := filepath.Join(dir, AuditFileName)
+		b, err := ioutil.ReadFile(p)
+		So(err, ShouldBeNil)
+		lines := strings.SplitAfter(string(b), "\n")
+		So(ioutil.WriteFile(p, []byte(strings.Join(lines[:1], "")), 0600), ShouldBeNil)
+		_, err = OpenAuditLog(dir, 0, key)
+		So(err.Error(), ShouldStartWith, ErrAuditTampered.Error())
+	})
+
+	Convey("a partly written last record should be removed on opening", t, func() {
+		d := SetupTestDir()
+		defer CleanupTestDir(d)
+		dir := filepath.Join(d, AuditDir)
+		l, err := OpenAuditLog(dir, 0, key)
+		So(err, ShouldBeNil)
+		audit(l, 2)
+		So(l.Close(), ShouldBeNil)
+		f, err := os.OpenFile(filepath.Join(dir, AuditFileName), os.O_APPEND|os.O_WRONLY, 0600)
+		So(err, ShouldBeNil)
+		_, err = f.WriteString(`{"Seq":3,"Time":`)
+		So(err, ShouldBeNil)
+		So(f.Close(), ShouldBeNil)
+
+		l, err = OpenAuditLog(dir, 0, key)
+		So(err, ShouldBeNil)
+		defer l.Close()
+		audit(l, 1)
+		head, err := l.Head()
+		So(err, ShouldBeNil)
+		n, err := VerifyAudit(strings.NewReader(export(l)), pub, head)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 3)
+	})
+}
+
+func TestAuditActions(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	a := &testAuditor{}
+	h.SetAuditor(a)
+
+	Convey("actions done by zomes should be audited", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = z.Run(`commit("oddNumbers","7")`)
+		So(err, ShouldBeNil)
+		rec := a.recs[len(a.recs)-1]
+		So(rec.Action, ShouldEqual, "commit")
+		So(rec.Zome, ShouldEqual, "jsSampleZome")
+		So(rec.Agent, ShouldEqual, h.nodeIDStr)
+		So(rec.Error, ShouldEqual, "")
+		So(rec.Args["entryType"], ShouldEqual, "oddNumbers")
+		So(rec.Args["entry"], ShouldEqual, "7")
+		So(string(rec.Result), ShouldStartWith, `"Qm`)
+	})
+
+	Convey("failed actions should be audited with their error", t, func() {
+		_, err := h.doAction("zome", NewCommitAction("oddNumbers", &GobEntry{C: "2"}))
+		So(err, ShouldNotBeNil)
+		So(a.recs[len(a.recs)-1].Error, ShouldEqual, err.Error())
+	})
+
+	Convey("the audit log should be kept when configured", t, func() {
+		h.config.AuditLog = true
+		So(h.setupConfig(), ShouldBeNil)
+		h.config.AuditLog = false
+		l, ok := h.Auditor().(*AuditLog)
+		So(ok, ShouldBeTrue)
+		_, err := h.doAction("", NewDebugAction("audited"))
+		So(err, ShouldBeNil)
+		var b bytes.Buffer
+		So(l.Export(&b), ShouldBeNil)
+		So(b.String(), ShouldContainSubstring, `"Action":"debug"`)
+		So(l.Close(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// backlink implements the reverse link index, which the node holding a link's target
+// keeps so that apps can find the bases that link to an entry
+
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"strconv"
+	"strings"
+)
+
+// backlinkKey returns the DHT store key of the backlink from base to target
+func backlinkKey(target string, base string, tag string) string {
+	return "backlink:" + target + ":" + base + ":" + tag
+}
+
+// putBacklink records that base links to target with the tag
+// N.B. this function assumes that the links entry has been validated
+func (dht *DHT) putBacklink(m *Message, target string, base string, tag string) (err error) {
+	dht.dlog.Logf("putBacklink on %v from %v as %s", target, base, tag)
+	err = dht.update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(backlinkKey(target, base, tag), StatusLiveVal, nil)
+		if err != nil {
+			return err
+		}
+		_, err = incIdx(tx, m)
+		return err
+	})
+	return
+}
+
+// delBacklink marks the backlink from base to target with the tag as deleted.  Unlike
+// links, a backlink we don't have is recorded as deleted, as the link may have been
+// made before the target's node indexed backlinks.
+// N.B. this function assumes that the links entry has been validated
+func (dht *DHT) delBacklink(m *Message, target string, base string, tag string) (err error) {
+	dht.dlog.Logf("delBacklink on %v from %v as %s", target, base, tag)
+	err = dht.update(func(tx *buntdb.Tx) error {
+		key := backlinkKey(target, base, tag)
+		val, err := tx.Get(key)
+		if err != nil && err != buntdb.ErrNotFound {
+			return err
+		}
+		if err == nil && val != StatusLiveVal {
+			return nil
+		}
+		if _, err = incIdx(tx, m); err != nil {
+			return err
+		}
+		_, _, err = tx.Set(key, StatusDeletedVal, nil)
+		return err
+	})
+	return
+}
+
+// getBacklink returns the bases that link to target with the tag
+func (dht *DHT) getBacklink(target Hash, tag string, statusMask int) (results []TaggedHash, err error) {
+	dht.dlog.Logf("getBacklink on %v of %s with mask %d", target, tag, statusMask)
+	if statusMask == StatusDefault {
+		statusMask = StatusLive
+	}
+	prefix := "backlink:" + target.String() + ":"
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		results = make([]TaggedHash, 0)
+		err := tx.AscendKeys(prefix+"*", func(key, value string) bool {
+			x := strings.SplitN(strings.TrimPrefix(key, prefix), ":", 2)
+			if len(x) != 2 || x[1] != tag {
+				return true
+			}
+			var status int
+			if status, e = strconv.Atoi(value); e != nil {
+				return false
+			}
+			if status&statusMask > 0 {
+				results = append(results, TaggedHash{H: x[0]})
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			return e
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("No backlinks for %s", tag)
+		}
+		return nil
+	})
+	return
+}
+
+// receiveBacklinks handles a reverse link request, which is sent to the node holding
+// the target of links so that it indexes the bases linking to it.  The target needn't
+// be held as anything may be linked to.
+func (a *ActionLink) receiveBacklinks(dht *DHT, msg *Message) (response interface{}, err error) {
+	t := msg.Body.(LinkReq)
+	from := msg.From
+	target := t.Base.String()
+	err = RunValidationPhase(dht.h, from, VALIDATE_LINK_REQUEST, t.Links, func(resp ValidateResponse) (err error) {
+		var le LinksEntry
+		var c string
+		if c, err = entryContentString(resp.Entry.Content()); err != nil {
+			return
+		}
+		if err = json.Unmarshal([]byte(c), &le); err != nil {
+			return
+		}
+		var links []Link
+		for _, l := range le.Links {
+			if l.Link == target {
+				links = append(links, l)
+			}
+		}
+		if len(links) == 0 {
+			err = ErrLinkNotFound
+			return
+		}
+
+		// the links are validated as they were against their first base
+		a := NewLinkAction(resp.Type, le.Links)
+		a.validationBase, err = NewHash(links[0].Base)
+		if err != nil {
+			return
+		}
+		_, err = dht.h.ValidateAction(a, a.entryType, &resp.Package, []peer.ID{from})
+		if err != nil {
+			return
+		}
+		for _, l := range links {
+			if l.LinkAction == DelAction {
+				err = dht.delBacklink(msg, target, l.Base, l.Tag)
+			} else {
+				err = dht.putBacklink(msg, target, l.Base, l.Tag)
+			}
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	response = "queued"
+	return
+}
@@ -0,0 +1,63 @@
+package holochain
+
+import (
+	"fmt"
+	zygo "github.com/glycerine/zygomys/repl"
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestBacklinks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	hash := commit(h, "oddNumbers", "7")
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	commit(h, "rating", fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, hash.String(), profileHash.String()))
+
+	Convey("the target's node should index the bases that link to it", t, func() {
+		results, err := h.dht.getBacklink(profileHash, "4stars", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(results), ShouldEqual, 1)
+		So(results[0].H, ShouldEqual, hash.String())
+
+		_, err = h.dht.getBacklink(profileHash, "3stars", StatusLive)
+		So(err, ShouldNotBeNil)
+		_, err = h.dht.getBacklink(hash, "4stars", StatusLive)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("getBacklinks should return the bases and load their entries", t, func() {
+		r, err := NewGetBacklinksAction(profileHash, "4stars", &GetLinkOptions{StatusMask: StatusLive}).Do(h)
+		So(err, ShouldBeNil)
+		So(r.(*LinkQueryResp).Links[0].H, ShouldEqual, hash.String())
+
+		r, err = NewGetBacklinksAction(profileHash, "4stars", &GetLinkOptions{Load: true, StatusMask: StatusLive}).Do(h)
+		So(err, ShouldBeNil)
+		So(r.(*LinkQueryResp).Links[0].E, ShouldEqual, "7")
+	})
+
+	Convey("getBacklinks should be available from the ribosomes", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r, err := z.Run(fmt.Sprintf(`getBacklinks("%s","4stars").Links[0].H`, profileHash.String()))
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, hash.String())
+
+		z, _, err = h.MakeRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		_, err = z.Run(fmt.Sprintf(`(getBacklinks "%s" "4stars")`, profileHash.String()))
+		So(err, ShouldBeNil)
+		So(z.(*ZygoRibosome).lastResult.(*zygo.SexpStr).S, ShouldEqual, fmt.Sprintf(`[{"H":"%s","E":""}]`, hash.String()))
+	})
+
+	Convey("deleting the link should delete the backlink", t, func() {
+		commit(h, "rating", fmt.Sprintf(`{"Links":[{"LinkAction":"%s","Base":"%s","Link":"%s","Tag":"4stars"}]}`, DelAction, hash.String(), profileHash.String()))
+		_, err := h.dht.getBacklink(profileHash, "4stars", StatusLive)
+		So(err, ShouldNotBeNil)
+		results, err := h.dht.getBacklink(profileHash, "4stars", StatusDeleted)
+		So(err, ShouldBeNil)
+		So(results[0].H, ShouldEqual, hash.String())
+	})
+}
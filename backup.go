@@ -0,0 +1,337 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// backup implements backing up a service's directory while its holochains are running,
+// and restoring it.  The chain and DHT stores of running holochains are snapshotted
+// through the holochains rather than read from disk, so that the backup never catches
+// them part way through a write.
+
+package holochain
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackupManifestFileName is the file describing a backup in its archive
+const BackupManifestFileName = "backup.json"
+
+var ErrBackupCorrupt = errors.New("backup is corrupt")
+var ErrRestoreRunning = errors.New("can't restore a holochain that is running")
+
+// BackupManifest describes a backup of a service
+type BackupManifest struct {
+	Time   time.Time
+	Chains []string          // the names of the holochains backed up
+	Files  map[string]string // the sha256 of each file in the archive by its path
+}
+
+// openHolochains are the holochains whose stores are open in this process, by root path
+var openHolochains = struct {
+	lk sync.Mutex
+	m  map[string]*Holochain
+}{m: make(map[string]*Holochain)}
+
+func cleanRoot(root string) string {
+	if abs, err := filepath.Abs(root); err == nil {
+		return abs
+	}
+	return filepath.Clean(root)
+}
+
+// registerOpen notes that the stores of h are open
+func registerOpen(h *Holochain) {
+	openHolochains.lk.Lock()
+	openHolochains.m[cleanRoot(h.rootPath)] = h
+	openHolochains.lk.Unlock()
+}
+
+// unregisterOpen notes that the stores of h have been closed
+func unregisterOpen(h *Holochain) {
+	openHolochains.lk.Lock()
+	root := cleanRoot(h.rootPath)
+	if openHolochains.m[root] == h {
+		delete(openHolochains.m, root)
+	}
+	openHolochains.lk.Unlock()
+}
+
+// openHolochain returns the holochain at root if its stores are open in this process
+func openHolochain(root string) *Holochain {
+	openHolochains.lk.Lock()
+	defer openHolochains.lk.Unlock()
+	return openHolochains.m[cleanRoot(root)]
+}
+
+// snapshotStores returns consistent copies of the chain and DHT stores of h.  Entries
+// are put to the DHT after they are committed, so the DHT may be ahead of the chain.
+func (h *Holochain) snapshotStores() (chain []byte, dht []byte, err error) {
+	if _, chain, err = h.chainSince(0); err != nil {
+		return
+	}
+	var b bytes.Buffer
+	if err = h.dht.db.Save(&b); err != nil {
+		return
+	}
+	dht = b.Bytes()
+	return
+}
+
+// isStoreFile returns the name of the holochain whose chain or DHT store is at the
+// path rel in the service's directory, if it is one
+func isStoreFile(rel string) (name string, ok bool) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) == 3 && parts[1] == ChainDataDir && (parts[2] == StoreFileName || parts[2] == DHTStoreFileName) {
+		name, ok = parts[0], true
+	}
+	return
+}
+
+// Backup writes a gzipped tar archive of the service's directory to w, with a manifest
+// of the holochains and file hashes last.  Running holochains carry on while it is
+// made, their chain and DHT stores being snapshotted.
+func (s *Service) Backup(w io.Writer) (err error) {
+	manifest := BackupManifest{Time: time.Now(), Files: make(map[string]string)}
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	write := func(name string, mode os.FileMode, modTime time.Time, data []byte) (err error) {
+		hdr := tar.Header{Name: name, Mode: int64(mode.Perm()), Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err = tw.WriteHeader(&hdr); err != nil {
+			return
+		}
+		_, err = tw.Write(data)
+		return
+	}
+
+	snapshots := make(map[string][2][]byte)
+	err = filepath.Walk(s.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.Path, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel != "." && !strings.Contains(rel, string(filepath.Separator)) {
+				if _, e := s.IsConfigured(rel); e == nil {
+					manifest.Chains = append(manifest.Chains, rel)
+				}
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		var data []byte
+		if name, ok := isStoreFile(rel); ok && openHolochain(filepath.Join(s.Path, name)) != nil {
+			snap, done := snapshots[name]
+			if !done {
+				h := openHolochain(filepath.Join(s.Path, name))
+				if snap[0], snap[1], err = h.snapshotStores(); err != nil {
+					return err
+				}
+				snapshots[name] = snap
+			}
+			if filepath.Base(rel) == StoreFileName {
+				data = snap[0]
+			} else {
+				data = snap[1]
+			}
+		} else if data, err = ioutil.ReadFile(path); err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		sum := sha256.Sum256(data)
+		manifest.Files[name] = hex.EncodeToString(sum[:])
+		return write(name, info.Mode(), info.ModTime(), data)
+	})
+	if err != nil {
+		return
+	}
+
+	var b []byte
+	if b, err = json.MarshalIndent(manifest, "", "  "); err != nil {
+		return
+	}
+	if err = write(BackupManifestFileName, 0600, manifest.Time, b); err != nil {
+		return
+	}
+	if err = tw.Close(); err != nil {
+		return
+	}
+	err = zw.Close()
+	return
+}
+
+// Restore replaces the service's holochains with those in a backup made by Backup.
+// The backup is unpacked beside the service's directory and its file hashes, chains
+// and DHT stores are checked before anything is replaced.  None of the holochains in
+// the backup can be running.
+func (s *Service) Restore(r io.Reader) (err error) {
+	var stage string
+	if stage, err = ioutil.TempDir(filepath.Dir(s.Path), filepath.Base(s.Path)+".restore"); err != nil {
+		return
+	}
+	defer os.RemoveAll(stage)
+
+	var manifest BackupManifest
+	if manifest, err = unpackBackup(r, stage); err != nil {
+		return
+	}
+	for _, name := range manifest.Chains {
+		if openHolochain(filepath.Join(s.Path, name)) != nil {
+			err = fmt.Errorf("%w: %s", ErrRestoreRunning, name)
+			return
+		}
+		if err = verifyBackupStores(filepath.Join(stage, name)); err != nil {
+			err = fmt.Errorf("%w: %s: %v", ErrBackupCorrupt, name, err)
+			return
+		}
+	}
+
+	// move what is there aside so that it can be put back if a move fails
+	if err = os.MkdirAll(s.Path, os.ModePerm); err != nil {
+		return
+	}
+	old := filepath.Join(stage, ".old")
+	if err = os.Mkdir(old, os.ModePerm); err != nil {
+		return
+	}
+	var items []os.FileInfo
+	if items, err = ioutil.ReadDir(stage); err != nil {
+		return
+	}
+	var moved []string
+	defer func() {
+		if err != nil {
+			for _, name := range moved {
+				os.RemoveAll(filepath.Join(s.Path, name))
+				if fileExists(old, name) {
+					os.Rename(filepath.Join(old, name), filepath.Join(s.Path, name))
+				}
+			}
+		}
+	}()
+	for _, item := range items {
+		name := item.Name()
+		if name == ".old" || name == BackupManifestFileName {
+			continue
+		}
+		if fileExists(s.Path, name) {
+			if err = os.Rename(filepath.Join(s.Path, name), filepath.Join(old, name)); err != nil {
+				return
+			}
+		}
+		moved = append(moved, name)
+		if err = os.Rename(filepath.Join(stage, name), filepath.Join(s.Path, name)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// unpackBackup writes the files of a backup to dir, checking them against its manifest
+func unpackBackup(r io.Reader, dir string) (manifest BackupManifest, err error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+		return
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	sums := make(map[string]string)
+	var manifestData []byte
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+			return
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			err = fmt.Errorf("%w: unexpected file %s", ErrBackupCorrupt, hdr.Name)
+			return
+		}
+		var data []byte
+		if data, err = ioutil.ReadAll(tr); err != nil {
+			err = fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+			return
+		}
+		if hdr.Name == BackupManifestFileName {
+			manifestData = data
+			continue
+		}
+		sum := sha256.Sum256(data)
+		sums[hdr.Name] = hex.EncodeToString(sum[:])
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return
+		}
+		if err = ioutil.WriteFile(path, data, os.FileMode(hdr.Mode).Perm()); err != nil {
+			return
+		}
+	}
+	if manifestData == nil {
+		err = fmt.Errorf("%w: no manifest", ErrBackupCorrupt)
+		return
+	}
+	if err = json.Unmarshal(manifestData, &manifest); err != nil {
+		err = fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+		return
+	}
+	if len(sums) != len(manifest.Files) {
+		err = fmt.Errorf("%w: has %d files, manifest lists %d", ErrBackupCorrupt, len(sums), len(manifest.Files))
+		return
+	}
+	for name, sum := range manifest.Files {
+		if sums[name] != sum {
+			err = fmt.Errorf("%w: hash mismatch for %s", ErrBackupCorrupt, name)
+			return
+		}
+	}
+	return
+}
+
+// verifyBackupStores checks that the chain of the holochain at root links up and that
+// its DHT store loads
+func verifyBackupStores(root string) (err error) {
+	if fileExists(root, ChainDataDir, StoreFileName) {
+		var r ChainReader
+		if r, err = OpenChainReader(root); err != nil {
+			return
+		}
+		err = r.(*Chain).Validate(false)
+		r.Close()
+		if err != nil {
+			return
+		}
+	}
+	if fileExists(root, ChainDataDir, DHTStoreFileName) {
+		var r DHTReader
+		if r, err = OpenDHTReader(root); err != nil {
+			return
+		}
+		r.Close()
+	}
+	return
+}
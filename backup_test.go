@@ -0,0 +1,77 @@
+package holochain
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+)
+
+// testArchive returns a gzipped tar archive of files
+func testArchive(files map[string]string) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	tw := tar.NewWriter(zw)
+	for name, data := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	zw.Close()
+	return b.Bytes()
+}
+
+func TestBackup(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	hash := commit(h, "oddNumbers", "7")
+	l := h.chain.Length()
+
+	var backup bytes.Buffer
+	Convey("it should back up the service while the holochain is running", t, func() {
+		err := s.Backup(&backup)
+		So(err, ShouldBeNil)
+		dir := filepath.Join(d, "unpacked")
+		manifest, err := unpackBackup(bytes.NewReader(backup.Bytes()), dir)
+		So(err, ShouldBeNil)
+		So(manifest.Chains, ShouldResemble, []string{"test"})
+		So(manifest.Files["test/"+ChainDataDir+"/"+StoreFileName], ShouldNotEqual, "")
+		So(manifest.Files["test/"+ChainDataDir+"/"+DHTStoreFileName], ShouldNotEqual, "")
+		So(verifyBackupStores(filepath.Join(dir, "test")), ShouldBeNil)
+	})
+
+	commit(h, "oddNumbers", "9")
+
+	Convey("it should not restore over a running holochain", t, func() {
+		err := s.Restore(bytes.NewReader(backup.Bytes()))
+		So(errors.Is(err, ErrRestoreRunning), ShouldBeTrue)
+	})
+
+	Convey("it should restore the holochain as it was backed up", t, func() {
+		So(h.Close(), ShouldBeNil)
+		err := s.Restore(bytes.NewReader(backup.Bytes()))
+		So(err, ShouldBeNil)
+		r, err := s.Load("test")
+		So(err, ShouldBeNil)
+		defer r.chain.Close()
+		So(r.chain.Length(), ShouldEqual, l)
+		_, entryType, err := r.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "oddNumbers")
+	})
+
+	Convey("it should not restore a corrupt backup", t, func() {
+		err := s.Restore(bytes.NewReader([]byte("not a backup")))
+		So(errors.Is(err, ErrBackupCorrupt), ShouldBeTrue)
+
+		err = s.Restore(bytes.NewReader(testArchive(map[string]string{"test/x": "x"})))
+		So(err.Error(), ShouldEqual, "backup is corrupt: no manifest")
+
+		manifest := `{"Chains":[],"Files":{"test/x":"00"}}`
+		err = s.Restore(bytes.NewReader(testArchive(map[string]string{"test/x": "x", BackupManifestFileName: manifest})))
+		So(err.Error(), ShouldEqual, "backup is corrupt: hash mismatch for test/x")
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// batch implements storing validated puts together in a single transaction, so that
+// applying the puts received in a gossip exchange costs one commit rather than one per
+// put.  The puts are validated before the transaction starts so it only lasts as long
+// as the writes.
+
+package holochain
+
+import (
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	GossipBatchSize = 100 // number of gossiped puts applied in each batch
+)
+
+// view runs fn in a read-only transaction
+func (dht *DHT) view(fn func(tx *buntdb.Tx) error) (err error) {
+	err = dht.db.View(fn)
+	return
+}
+
+// update runs fn in a read-write transaction, which is rolled back if fn returns an error
+func (dht *DHT) update(fn func(tx *buntdb.Tx) error) (err error) {
+	err = dht.db.Update(fn)
+	return
+}
+
+// validatedPut is a put that has been validated and is ready to be stored
+type validatedPut struct {
+	msg       *Message
+	entryType string
+	key       Hash
+	value     []byte
+	status    int
+	agent     string         // for key entries, the agent entry the key belongs to
+	headers   []headerRecord // the source's headers that came with the put
+	expires   time.Time      // zero if the entry doesn't expire
+	meta      string         // the header meta as JSON
+	receipt   *Message       // our own signed validation when the put needs a quorum
+}
+
+// applyPuts stores validated puts in one transaction.  If that fails they are stored
+// one at a time, so that a put which can't be stored doesn't lose the others.
+func (dht *DHT) applyPuts(puts []*validatedPut) (err error) {
+	if len(puts) == 0 {
+		return
+	}
+	if err = dht.applyPutsTx(puts); err == nil || len(puts) == 1 {
+		return
+	}
+	dht.dlog.Logf("storing %d puts together failed, storing them singly: %v", len(puts), err)
+	err = nil
+	for _, p := range puts {
+		if e := dht.applyPutsTx([]*validatedPut{p}); e != nil {
+			dht.dlog.Logf("storing put of %v failed: %v", p.key, e)
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	return
+}
+
+// applyPutsTx stores validated puts in one transaction, none of them if any fails.
+// Puts that the store's quota has no room for are skipped.
+func (dht *DHT) applyPutsTx(puts []*validatedPut) (err error) {
+	quorum := dht.quorum()
+	var stored []*validatedPut
+	err = dht.updateStored(func(tx *buntdb.Tx) (added int64, err error) {
+		stored = nil
+		for _, p := range puts {
+			freed, e := dht._makeRoom(tx, p.msg.From, p.key.String(), int64(len(p.value)))
+			if e == ErrDHTQuotaExceeded || e == ErrEvicted {
+				dht.dlog.Logf("not storing put of %v: %v", p.key, e)
+				added -= freed
+				continue
+			}
+			if e != nil {
+				err = e
+				return
+			}
+			var size int64
+			if size, err = _applyPut(tx, p, quorum); err != nil {
+				return
+			}
+			added += size - freed
+			stored = append(stored, p)
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	for _, p := range stored {
+		if p.status != StatusRejected {
+			dht.h.events.publish(Event{Type: PutReceived, Hash: p.key.String(), EntryType: p.entryType, Peer: peer.IDB58Encode(p.msg.From)})
+		}
+	}
+	return
+}
+
+// _applyPut stores a validated put, returning by how much it changed the size of the
+// stored entries
+func _applyPut(tx *buntdb.Tx, p *validatedPut, quorum int) (size int64, err error) {
+	k := p.key.String()
+	if size, err = _put(tx, p.msg, p.entryType, k, p.msg.From, p.value, p.status); err != nil {
+		return
+	}
+	if p.status == StatusRejected {
+		return
+	}
+	if p.agent != "" {
+		if err = _linkKeyAgent(tx, k, p.agent); err != nil {
+			return
+		}
+	}
+	for _, rec := range p.headers {
+		if err = _putHeader(tx, rec); err != nil {
+			return
+		}
+	}
+	if !p.expires.IsZero() {
+		if err = _putExpiry(tx, k, p.expires); err != nil {
+			return
+		}
+	}
+	if p.meta != "" {
+		if err = _putMeta(tx, k, p.meta); err != nil {
+			return
+		}
+	}
+	if p.receipt != nil {
+		err = _receipt(tx, p.receipt, k, p.receipt.From, quorum)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"sync/atomic"
+	"testing"
+)
+
+func TestApplyPuts(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+
+	hash1, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh1")
+	hash2, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2")
+	hash3, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh3")
+	put := func(hash Hash, status int) *validatedPut {
+		return &validatedPut{msg: h.node.NewMessage(PUT_REQUEST, PutReq{H: hash}), entryType: "someType", key: hash, value: []byte("some value"), status: status}
+	}
+	// a receipt that can't be encoded into the gossip index fails to be stored
+	badReceipt := h.node.NewMessage(RECEIPT_REQUEST, func() {})
+
+	Convey("puts should be stored together", t, func() {
+		idx, _ := dht.GetIdx()
+		used := atomic.LoadInt64(&dht.storedBytes)
+		err := dht.applyPuts([]*validatedPut{put(hash1, StatusLive), put(hash2, StatusLive)})
+		So(err, ShouldBeNil)
+		So(dht.exists(hash1, StatusLive), ShouldBeNil)
+		So(dht.exists(hash2, StatusLive), ShouldBeNil)
+		newIdx, _ := dht.GetIdx()
+		So(newIdx, ShouldEqual, idx+2)
+		So(atomic.LoadInt64(&dht.storedBytes), ShouldEqual, used+20)
+	})
+
+	Convey("a put that fails should be rolled back", t, func() {
+		p := put(hash3, StatusPending)
+		p.receipt = badReceipt
+		err := dht.applyPuts([]*validatedPut{p})
+		So(err, ShouldNotBeNil)
+		So(dht.exists(hash3, StatusAny), ShouldEqual, ErrHashNotFound)
+	})
+
+	Convey("a put that fails shouldn't lose the others in its batch", t, func() {
+		bad := put(hash1, StatusPending)
+		bad.receipt = badReceipt
+		err := dht.applyPuts([]*validatedPut{bad, put(hash3, StatusLive)})
+		So(err, ShouldNotBeNil)
+		So(dht.exists(hash3, StatusLive), ShouldBeNil)
+		So(dht.exists(hash1, StatusLive), ShouldBeNil)
+	})
+
+	Convey("nothing to store should do nothing", t, func() {
+		So(dht.applyPuts(nil), ShouldBeNil)
+	})
+}
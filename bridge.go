@@ -0,0 +1,289 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// bridge implements calls from one holochain to the exposed functions of another one
+// running in the same process.  A bridge is set up by a handshake in which both apps'
+// bridgeGenesis functions, where they have them, accept the bridge, and the called app
+// issues a capability token to the calling app.  Both record the bridge in their configs
+// so that it lasts across restarts.  Apps list their bridges, and the agent's identities
+// in the bridged apps, with getBridges().
+
+package holochain
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+var ErrNoBridge = errors.New("no bridge to app")
+var ErrBridgeNotRunning = errors.New("bridged app not running")
+var ErrBadBridgeToken = errors.New("invalid bridge token")
+var ErrBridgeRefused = errors.New("bridge refused by bridgeGenesis")
+
+// the side of a bridge an app's bridgeGenesis is called for
+const (
+	BridgeCaller = 0
+	BridgeCallee = 1
+)
+
+// DefaultBridgeCallTimeout is how long BridgeCall waits for the called app's function
+const DefaultBridgeCallTimeout = 60 * time.Second
+
+// BridgeGenesiser is implemented by ribosomes that can run a zome's bridgeGenesis
+// function, which is called with the side of the bridge the app is on and the DNA hash
+// of the app at the other end, and returns false to refuse the bridge.  Zomes that don't
+// define the function accept every bridge.
+type BridgeGenesiser interface {
+	BridgeGenesis(side int, dnaHash string) error
+}
+
+// Bridge is a bridge from this app to another, recorded in the calling app's config
+type Bridge struct {
+	App   string // the name the called app is installed under
+	DNA   string // the called app's DNA hash
+	Agent string // our agent's key in the called app
+	Token string // the capability token the called app issued
+}
+
+// BridgeGrant is a bridge to this app from another, recorded in the called app's config
+type BridgeGrant struct {
+	DNA   string // the calling app's DNA hash
+	Token string
+}
+
+// saveConfig writes the holochain's config back to its config file
+func (h *Holochain) saveConfig() error {
+	return encodeFile(filepath.Join(h.rootPath, ConfigFileName+"."+h.encodingFormat), h.encodingFormat, &h.config)
+}
+
+// bridgedApp returns the running holochain installed as name beside this one
+func (h *Holochain) bridgedApp(name string) (to *Holochain, err error) {
+	if to = openHolochain(filepath.Join(filepath.Dir(h.rootPath), name)); to == nil {
+		err = fmt.Errorf("%w: %s", ErrBridgeNotRunning, name)
+	}
+	return
+}
+
+// bridgeGenesis runs the bridgeGenesis functions of the app's zomes for a bridge to or
+// from the app with the DNA hash dnaHash
+func (h *Holochain) bridgeGenesis(side int, dnaHash string) (err error) {
+	for _, z := range h.nucleus.dna.Zomes {
+		var r Ribosome
+		if r, _, err = h.MakeRibosome(z.Name); err != nil {
+			return
+		}
+		if g, ok := r.(BridgeGenesiser); ok {
+			if err = g.BridgeGenesis(side, dnaHash); err != nil {
+				err = fmt.Errorf("%w: zome %s: %w", ErrBridgeRefused, z.Name, err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// AddBridge sets up a bridge from this app to the running app installed as toApp,
+// which issues the token the bridge's calls are made with once both apps' bridgeGenesis
+// functions have accepted it
+func (h *Holochain) AddBridge(toApp string) (err error) {
+	var to *Holochain
+	if to, err = h.bridgedApp(toApp); err != nil {
+		return
+	}
+	if err = h.bridgeGenesis(BridgeCaller, to.dnaHash.String()); err != nil {
+		return
+	}
+	if err = to.bridgeGenesis(BridgeCallee, h.dnaHash.String()); err != nil {
+		return
+	}
+	var token string
+	if token, err = to.grantBridge(h.dnaHash.String()); err != nil {
+		return
+	}
+	b := Bridge{App: toApp, DNA: to.dnaHash.String(), Agent: to.nodeIDStr, Token: token}
+	h.configLk.Lock()
+	defer h.configLk.Unlock()
+	bridges := []Bridge{b}
+	for _, old := range h.config.Bridges {
+		if old.App != toApp {
+			bridges = append(bridges, old)
+		}
+	}
+	h.config.Bridges = bridges
+	err = h.saveConfig()
+	return
+}
+
+// grantBridge issues a new token for calls from the app with the DNA hash fromDNA,
+// replacing any it was issued before
+func (h *Holochain) grantBridge(fromDNA string) (token string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	h.configLk.Lock()
+	defer h.configLk.Unlock()
+	grants := []BridgeGrant{{DNA: fromDNA, Token: token}}
+	for _, g := range h.config.BridgeGrants {
+		if g.DNA != fromDNA {
+			grants = append(grants, g)
+		}
+	}
+	h.config.BridgeGrants = grants
+	err = h.saveConfig()
+	return
+}
+
+// RemoveBridge removes the bridge to toApp, revoking its token if toApp is running
+func (h *Holochain) RemoveBridge(toApp string) (err error) {
+	var b Bridge
+	if b, err = h.bridge(toApp); err != nil {
+		return
+	}
+	h.configLk.Lock()
+	var bridges []Bridge
+	for _, old := range h.config.Bridges {
+		if old.App != toApp {
+			bridges = append(bridges, old)
+		}
+	}
+	h.config.Bridges = bridges
+	err = h.saveConfig()
+	h.configLk.Unlock()
+	if err != nil {
+		return
+	}
+	if to, e := h.bridgedApp(toApp); e == nil && to.dnaHash.String() == b.DNA {
+		err = to.revokeBridge(h.dnaHash.String())
+	}
+	return
+}
+
+// revokeBridge removes the grant to the app with the DNA hash fromDNA
+func (h *Holochain) revokeBridge(fromDNA string) (err error) {
+	h.configLk.Lock()
+	defer h.configLk.Unlock()
+	var grants []BridgeGrant
+	for _, g := range h.config.BridgeGrants {
+		if g.DNA != fromDNA {
+			grants = append(grants, g)
+		}
+	}
+	h.config.BridgeGrants = grants
+	err = h.saveConfig()
+	return
+}
+
+// Bridges returns the bridges from this app to others
+func (h *Holochain) Bridges() []Bridge {
+	h.configLk.Lock()
+	defer h.configLk.Unlock()
+	return append([]Bridge{}, h.config.Bridges...)
+}
+
+func (h *Holochain) bridge(toApp string) (b Bridge, err error) {
+	h.configLk.Lock()
+	defer h.configLk.Unlock()
+	for _, b = range h.config.Bridges {
+		if b.App == toApp {
+			return
+		}
+	}
+	err = fmt.Errorf("%w: %s", ErrNoBridge, toApp)
+	return
+}
+
+// BridgeCall calls a function of the app installed as toApp over the bridge to it,
+// giving up after DefaultBridgeCallTimeout.  The function must have public or bridge
+// exposure.
+func (h *Holochain) BridgeCall(toApp string, zome string, function string, args interface{}) (result interface{}, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultBridgeCallTimeout)
+	defer cancel()
+	result, err = h.BridgeCallContext(ctx, toApp, zome, function, args)
+	return
+}
+
+// BridgeCallContext is BridgeCall returning when ctx is done, as CallContext does
+func (h *Holochain) BridgeCallContext(ctx context.Context, toApp string, zome string, function string, args interface{}) (result interface{}, err error) {
+	var b Bridge
+	if b, err = h.bridge(toApp); err != nil {
+		return
+	}
+	var to *Holochain
+	if to, err = h.bridgedApp(toApp); err != nil {
+		return
+	}
+	result, err = to.bridgeReceive(ctx, h.dnaHash.String(), b.Token, zome, function, args)
+	return
+}
+
+// BridgeCallAsync calls a function of the app installed as toApp over the bridge to it
+// without waiting for it, passing the result to cb when it returns
+func (h *Holochain) BridgeCallAsync(toApp string, zome string, function string, args interface{}, cb func(result interface{}, err error)) {
+	go func() {
+		cb(h.BridgeCall(toApp, zome, function, args))
+	}()
+}
+
+// bridgeReceive makes a call from the app with the DNA hash fromDNA if token is the one
+// it was granted
+func (h *Holochain) bridgeReceive(ctx context.Context, fromDNA string, token string, zome string, function string, args interface{}) (result interface{}, err error) {
+	h.configLk.Lock()
+	ok := false
+	for _, g := range h.config.BridgeGrants {
+		if g.DNA == fromDNA && subtle.ConstantTimeCompare([]byte(g.Token), []byte(token)) == 1 {
+			ok = true
+			break
+		}
+	}
+	h.configLk.Unlock()
+	if !ok {
+		err = ErrBadBridgeToken
+		return
+	}
+	result, err = h.CallContext(ctx, zome, function, args, BRIDGE_EXPOSURE)
+	return
+}
+
+// withApps calls f with the installed apps called names, loading those that aren't
+// already running in the process for the call and closing them after it
+func (s *Service) withApps(f func(apps []*Holochain) error, names ...string) (err error) {
+	apps := make([]*Holochain, len(names))
+	for i, name := range names {
+		if apps[i] = openHolochain(filepath.Join(s.Path, name)); apps[i] != nil {
+			continue
+		}
+		var h *Holochain
+		if h, err = s.Load(name); err != nil {
+			return
+		}
+		defer h.Close()
+		apps[i] = h
+	}
+	err = f(apps)
+	return
+}
+
+// Bridge sets up a bridge from the installed app fromApp to the installed app toApp
+func (s *Service) Bridge(fromApp string, toApp string) (err error) {
+	err = s.withApps(func(apps []*Holochain) error {
+		return apps[0].AddBridge(toApp)
+	}, fromApp, toApp)
+	return
+}
+
+// Unbridge removes the bridge from the installed app fromApp to the installed app toApp
+func (s *Service) Unbridge(fromApp string, toApp string) (err error) {
+	err = s.withApps(func(apps []*Holochain) error {
+		return apps[0].RemoveBridge(toApp)
+	}, fromApp, toApp)
+	return
+}
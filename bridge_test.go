@@ -0,0 +1,170 @@
+package holochain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	zygo "github.com/glycerine/zygomys/repl"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBridge(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	// only one holochain can listen on the test port, so the app bridges to itself,
+	// which exercises both ends of the handshake
+	Convey("it should not bridge to an app that isn't running", t, func() {
+		err := h.AddBridge("other")
+		So(errors.Is(err, ErrBridgeNotRunning), ShouldBeTrue)
+	})
+
+	Convey("it should not call over a bridge that hasn't been added", t, func() {
+		_, err := h.BridgeCall("test", "jsSampleZome", "addOdd", "7")
+		So(errors.Is(err, ErrNoBridge), ShouldBeTrue)
+	})
+
+	Convey("it should not bridge apps whose bridgeGenesis refuses", t, func() {
+		zome := &h.nucleus.dna.Zomes[1]
+		code := zome.Code
+		defer func() { zome.Code = code }()
+		// only accept being called
+		zome.Code += `function bridgeGenesis(side,dna){return side==1}`
+		err := h.AddBridge("test")
+		So(errors.Is(err, ErrBridgeRefused), ShouldBeTrue)
+		So(len(h.Bridges()), ShouldEqual, 0)
+		So(len(h.config.BridgeGrants), ShouldEqual, 0)
+	})
+
+	Convey("adding a bridge should record it in both configs", t, func() {
+		err := h.AddBridge("test")
+		So(err, ShouldBeNil)
+		bridges := h.Bridges()
+		So(len(bridges), ShouldEqual, 1)
+		So(bridges[0].App, ShouldEqual, "test")
+		So(bridges[0].DNA, ShouldEqual, h.dnaHash.String())
+		So(bridges[0].Agent, ShouldEqual, h.nodeIDStr)
+		So(bridges[0].Token, ShouldNotEqual, "")
+		So(h.config.BridgeGrants, ShouldResemble, []BridgeGrant{{DNA: h.dnaHash.String(), Token: bridges[0].Token}})
+
+		var config Config
+		err = decodeFile(filepath.Join(h.rootPath, ConfigFileName+"."+h.encodingFormat), h.encodingFormat, &config)
+		So(err, ShouldBeNil)
+		So(config.Bridges, ShouldResemble, bridges)
+		So(config.BridgeGrants, ShouldResemble, h.config.BridgeGrants)
+	})
+
+	Convey("it should call exposed functions over the bridge", t, func() {
+		r, err := h.BridgeCall("test", "jsSampleZome", "addOdd", "7")
+		So(err, ShouldBeNil)
+		hash, err := NewHash(r.(string))
+		So(err, ShouldBeNil)
+		entry, _, _ := h.chain.GetEntry(hash)
+		So(entry.Content(), ShouldEqual, "7")
+
+		_, err = h.BridgeCall("test", "jsSampleZome", "testStrFn1", "x")
+		So(err, ShouldEqual, ErrUnauthorized)
+	})
+
+	Convey("it should call over the bridge asynchronously", t, func() {
+		done := make(chan error, 1)
+		h.BridgeCallAsync("test", "jsSampleZome", "addOdd", "9", func(result interface{}, err error) {
+			done <- err
+		})
+		So(<-done, ShouldBeNil)
+	})
+
+	Convey("the bridge should be callable from the JS ribosome", t, func() {
+		zome, _ := h.GetZome("jsSampleZome")
+		v, _ := NewJSRibosome(h, zome)
+		z := v.(*JSRibosome)
+		_, err := z.Run(`bridge("test","jsSampleZome","addOdd","11")`)
+		So(err, ShouldBeNil)
+		So(h.chain.Entries[len(h.chain.Hashes)-1].Content(), ShouldEqual, "11")
+	})
+
+	Convey("the bridge should be callable from the WASM ribosome", t, func() {
+		wr := &WASMRibosome{h: h, zome: &Zome{Name: "test", RibosomeType: WASMRibosomeType}}
+		_, err := wr.builtins()["bridge"]([]interface{}{"test", "jsSampleZome", "addOdd", "13"})
+		So(err, ShouldBeNil)
+		So(h.chain.Entries[len(h.chain.Hashes)-1].Content(), ShouldEqual, "13")
+	})
+
+	Convey("bridge calls should time out", t, func() {
+		zome := &h.nucleus.dna.Zomes[1]
+		code, fns := zome.Code, zome.Functions
+		defer func() { zome.Code, zome.Functions = code, fns }()
+		zome.Code += `function spin(x){while(true){}}`
+		zome.Functions = append(append([]FunctionDef{}, fns...), FunctionDef{Name: "spin", CallingType: STRING_CALLING, Exposure: BRIDGE_EXPOSURE})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := h.BridgeCallContext(ctx, "test", "jsSampleZome", "spin", "")
+		So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+	})
+
+	Convey("calls with the wrong token should be refused", t, func() {
+		_, err := h.bridgeReceive(context.Background(), h.dnaHash.String(), "not a token", "jsSampleZome", "addOdd", "7")
+		So(err, ShouldEqual, ErrBadBridgeToken)
+	})
+
+	Convey("removing the bridge should revoke its token", t, func() {
+		err := h.RemoveBridge("test")
+		So(err, ShouldBeNil)
+		So(len(h.Bridges()), ShouldEqual, 0)
+		So(len(h.config.BridgeGrants), ShouldEqual, 0)
+		_, err = h.BridgeCall("test", "jsSampleZome", "addOdd", "7")
+		So(errors.Is(err, ErrNoBridge), ShouldBeTrue)
+	})
+
+	Convey("the service should set up and remove bridges between installed apps", t, func() {
+		So(s.Bridge("test", "test"), ShouldBeNil)
+		So(len(h.Bridges()), ShouldEqual, 1)
+		So(s.Unbridge("test", "test"), ShouldBeNil)
+		So(len(h.Bridges()), ShouldEqual, 0)
+		So(s.Bridge("test", "nonexistent"), ShouldNotBeNil)
+	})
+}
+
+func TestGetBridges(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	h.config.Bridges = []Bridge{{App: "other", DNA: "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2", Agent: h.nodeIDStr, Token: "secret"}}
+	expected := `[{"App":"other","DNA":"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2","Agent":"` + h.nodeIDStr + `","Token":""}]`
+
+	Convey("it should list the bridged apps to javascript", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `var b=getBridges();b.length+" "+b[0].App+" "+b[0].DNA+" "+b[0].Agent+" "+b[0].Token`})
+		So(err, ShouldBeNil)
+		So(v.(*JSRibosome).lastResult.String(), ShouldEqual, "1 other QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2 "+h.nodeIDStr+" ")
+	})
+
+	Convey("it should list the bridged apps to zygo", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(getBridges)`})
+		So(err, ShouldBeNil)
+		sh := v.(*ZygoRibosome).lastResult.(*zygo.SexpHash)
+		r, err := sh.HashGet(v.(*ZygoRibosome).env, v.(*ZygoRibosome).env.MakeSymbol("result"))
+		So(err, ShouldBeNil)
+		So(r.(*zygo.SexpStr).S, ShouldEqual, expected)
+	})
+
+	Convey("it should list the bridged apps to wasm", t, func() {
+		wr := &WASMRibosome{h: h, zome: &Zome{Name: "test", RibosomeType: WASMRibosomeType}}
+		r, err := wr.builtins()["getBridges"](nil)
+		So(err, ShouldBeNil)
+		j, err := json.Marshal(r)
+		So(err, ShouldBeNil)
+		So(string(j), ShouldEqual, expected)
+	})
+
+	Convey("it should not give zome code the bridges' tokens", t, func() {
+		So(h.Bridges()[0].Token, ShouldEqual, "secret")
+	})
+
+	Convey("it should return copies of the bridges", t, func() {
+		b := h.Bridges()
+		b[0].App = "changed"
+		So(h.Bridges()[0].App, ShouldEqual, "other")
+	})
+}
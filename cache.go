@@ -0,0 +1,90 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// cache implements an LRU of decoded entries so that frequently read entries, like agent
+// keys and anchors, aren't decoded from the store on every read
+
+package holochain
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	EntryCacheSize = 1024 // number of decoded entries kept
+)
+
+// CacheStats reports on the use of a cache
+type CacheStats struct {
+	Entries  int   // number of items in the cache
+	Capacity int   // maximum number of items in the cache
+	Hits     int64 // lookups found in the cache
+	Misses   int64 // lookups not found in the cache
+}
+
+// cachedEntry is an entry in the cache
+type cachedEntry struct {
+	key   string
+	entry GobEntry
+}
+
+// entryCache is an LRU of decoded entries keyed by hash.  Entries are content
+// addressed so a cached entry never goes stale.
+type entryCache struct {
+	lk     sync.Mutex
+	size   int
+	items  map[string]*list.Element
+	order  *list.List // most recently used first
+	hits   int64
+	misses int64
+}
+
+func newEntryCache(size int) *entryCache {
+	return &entryCache{size: size, items: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns a copy of the entry with hash key if it is in the cache
+func (c *entryCache) get(key string) (entry *GobEntry, ok bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	e := el.Value.(*cachedEntry).entry
+	entry = &e
+	return
+}
+
+// add puts a copy of the entry with hash key in the cache
+func (c *entryCache) add(key string, entry *GobEntry) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cachedEntry{key: key, entry: *entry})
+	for c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.items, el.Value.(*cachedEntry).key)
+	}
+}
+
+// stats returns the cache's statistics
+func (c *entryCache) stats() CacheStats {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return CacheStats{Entries: c.order.Len(), Capacity: c.size, Hits: c.hits, Misses: c.misses}
+}
+
+// EntryCacheStats returns the statistics of the DHT's cache of decoded entries
+func (dht *DHT) EntryCacheStats() CacheStats {
+	return dht.entries.stats()
+}
@@ -0,0 +1,83 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestEntryCache(t *testing.T) {
+	Convey("it should return copies of cached entries", t, func() {
+		c := newEntryCache(2)
+		_, ok := c.get("a")
+		So(ok, ShouldBeFalse)
+		e := GobEntry{C: "foo"}
+		c.add("a", &e)
+		e.C = "changed"
+		got, ok := c.get("a")
+		So(ok, ShouldBeTrue)
+		So(got.C, ShouldEqual, "foo")
+		got.C = "changed"
+		got, _ = c.get("a")
+		So(got.C, ShouldEqual, "foo")
+		So(c.stats(), ShouldResemble, CacheStats{Entries: 1, Capacity: 2, Hits: 2, Misses: 1})
+	})
+
+	Convey("it should evict the least recently used entries", t, func() {
+		c := newEntryCache(2)
+		c.add("a", &GobEntry{C: "a"})
+		c.add("b", &GobEntry{C: "b"})
+		c.get("a")
+		c.add("c", &GobEntry{C: "c"})
+		_, ok := c.get("b")
+		So(ok, ShouldBeFalse)
+		_, ok = c.get("a")
+		So(ok, ShouldBeTrue)
+		_, ok = c.get("c")
+		So(ok, ShouldBeTrue)
+	})
+}
+
+func TestDHTEntryCache(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("gets should be served from the entry cache once decoded", t, func() {
+		e := GobEntry{C: "124"}
+		_, hd, err := h.NewEntry(time.Now(), "evenNumbers", &e)
+		So(err, ShouldBeNil)
+		b, _ := e.Marshal()
+		err = h.dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: hd.EntryLink}), "evenNumbers", hd.EntryLink, h.nodeID, b, StatusLive)
+		So(err, ShouldBeNil)
+
+		before := h.dht.EntryCacheStats()
+		for i := 0; i < 2; i++ {
+			m := h.node.NewMessage(GET_REQUEST, GetReq{H: hd.EntryLink, GetMask: GetMaskEntry})
+			r, err := NewGetAction(GetReq{}, nil).Receive(h.dht, m)
+			So(err, ShouldBeNil)
+			So(r.(GetResp).Entry.Content(), ShouldEqual, "124")
+		}
+		after := h.dht.EntryCacheStats()
+		So(after.Misses-before.Misses, ShouldEqual, 1)
+		So(after.Hits-before.Hits, ShouldEqual, 1)
+	})
+}
+
+func TestChainEntryCache(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("chain gets should be served from the entry cache once decoded", t, func() {
+		hash := commit(h, "evenNumbers", "2")
+		before := h.chain.EntryCacheStats()
+		for i := 0; i < 2; i++ {
+			e, entryType, err := h.chain.GetEntry(hash)
+			So(err, ShouldBeNil)
+			So(entryType, ShouldEqual, "evenNumbers")
+			So(e.Content(), ShouldEqual, "2")
+		}
+		after := h.chain.EntryCacheStats()
+		So(after.Misses-before.Misses, ShouldEqual, 1)
+		So(after.Hits-before.Hits, ShouldEqual, 1)
+	})
+}
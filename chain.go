@@ -7,13 +7,18 @@
 package holochain
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	ic "github.com/libp2p/go-libp2p-crypto"
 	"io"
+	"io/ioutil"
 	"os"
+	"runtime"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -22,6 +27,7 @@ type WalkerFn func(key *Hash, header *Header, entry Entry) error
 
 var ErrHashNotFound = errors.New("hash not found")
 var ErrIncompleteChain = errors.New("operation not allowed on incomplete chain")
+var ErrChainClosed = errors.New("chain closed")
 
 const (
 	ChainMarshalFlagsNone      = 0x00
@@ -35,14 +41,30 @@ type Chain struct {
 	Hashes   []Hash
 	Headers  []*Header
 	Entries  []Entry
-	TypeTops map[string]int // pointer to index of top of a given type
-	Hmap     map[string]int // map header hashes to index number
-	Emap     map[string]int // map entry hashes to index number
+	TypeTops map[string]int   // pointer to index of top of a given type
+	TypeIdx  map[string][]int // indexes of the entries of each type, oldest first
+	Hmap     map[string]int   // map header hashes to index number
+	Emap     map[string]int   // map entry hashes to index number
 
 	//---
 
 	s        *os.File // if this stream is not nil, new entries will get marshaled to it
+	closed   bool     // set by Close, after which no entries can be added
 	hashSpec HashSpec
+
+	// entries loaded from a file are nil until they are needed, when they are read from
+	// where locs says they are in the file at path
+	path string
+	locs []entryLoc
+	lk   sync.Mutex
+
+	cache *entryCache // decoded entries by hash for GetEntry
+}
+
+// entryLoc is the location of an entry's data in a chain file
+type entryLoc struct {
+	offset int64
+	size   int64
 }
 
 // NewChain creates and empty chain
@@ -52,9 +74,11 @@ func NewChain(hashSpec HashSpec) (chain *Chain) {
 		Entries:  make([]Entry, 0),
 		Hashes:   make([]Hash, 0),
 		TypeTops: make(map[string]int),
+		TypeIdx:  make(map[string][]int),
 		Hmap:     make(map[string]int),
 		Emap:     make(map[string]int),
 		hashSpec: hashSpec,
+		cache:    newEntryCache(EntryCacheSize),
 	}
 	chain = &c
 	return
@@ -72,50 +96,9 @@ func NewChainFromFile(spec HashSpec, path string) (c *Chain, err error) {
 
 	var f *os.File
 	if fileExists(path) {
-		f, err = os.Open(path)
-		if err != nil {
+		if err = c.load(path); err != nil {
 			return
 		}
-		var i int
-		for {
-			var header *Header
-			var e Entry
-			header, e, err = readPair(ChainMarshalFlagsNone, f)
-			if err != nil && err.Error() == "EOF" {
-				err = nil
-				break
-			}
-			if err != nil {
-				Debugf("error reading pair:%s", err.Error())
-				return
-			}
-			c.addPair(header, e, i)
-			i++
-		}
-		f.Close()
-		i--
-		// if we read anything then we have to calculate the final hash and add it
-		if i >= 0 {
-			hd := c.Headers[i]
-			var hash Hash
-
-			// hash the header
-			hash, _, err = hd.Sum(spec)
-			if err != nil {
-				return
-			}
-
-			c.Hashes = append(c.Hashes, hash)
-			c.Hmap[hash.String()] = i
-
-			// finally validate that it all hashes out correctly
-			/*			err = c.Validate(h)
-						if err != nil {
-							return
-						}
-			*/
-		}
-
 		f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
 		if err != nil {
 			return
@@ -130,6 +113,192 @@ func NewChainFromFile(spec HashSpec, path string) (c *Chain, err error) {
 	return
 }
 
+// load reads the headers from the chain file at path, leaving the entries to be read
+// when they are needed
+func (c *Chain) load(path string) (err error) {
+	var f *os.File
+	f, err = os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	// read just the headers, noting where the entries are so they can be loaded
+	// when they are needed
+	var offset int64
+	r := countingReader{bufio.NewReader(f), &offset}
+	var i int
+	for {
+		var header Header
+		err = UnmarshalHeader(r, &header, 34)
+		if err != nil && err.Error() == "EOF" {
+			err = nil
+			break
+		}
+		if err != nil {
+			Debugf("error reading header:%s", err.Error())
+			return
+		}
+		var l uint64
+		err = binary.Read(r, binary.LittleEndian, &l)
+		if err != nil {
+			Debugf("error reading entry:%s", err.Error())
+			return
+		}
+		loc := entryLoc{offset: offset, size: int64(l)}
+		_, err = io.CopyN(ioutil.Discard, r, loc.size)
+		if err != nil {
+			Debugf("error reading entry:%s", err.Error())
+			return
+		}
+		c.addPair(&header, nil, i)
+		c.Entries = append(c.Entries, nil)
+		c.locs = append(c.locs, loc)
+		i++
+	}
+	c.path = path
+	i--
+	// if we read anything then we have to calculate the final hash and add it
+	if i >= 0 {
+		hd := c.Headers[i]
+		var hash Hash
+
+		// hash the header
+		hash, _, err = hd.Sum(c.hashSpec)
+		if err != nil {
+			return
+		}
+
+		c.Hashes = append(c.Hashes, hash)
+		c.Hmap[hash.String()] = i
+
+		// finally validate that it all hashes out correctly
+		/*			err = c.Validate(h)
+					if err != nil {
+						return
+					}
+		*/
+	}
+	return
+}
+
+// Close flushes the chain's file to disk, after which adding entries fails with
+// ErrChainClosed
+func (c *Chain) Close() (err error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.closed = true
+	if c.s == nil {
+		return
+	}
+	err = c.s.Sync()
+	if e := c.s.Close(); err == nil {
+		err = e
+	}
+	c.s = nil
+	return
+}
+
+// readEntry decodes the ith entry from the chain file f
+func (c *Chain) readEntry(f *os.File, i int) (e Entry, err error) {
+	loc := c.locs[i]
+	b := make([]byte, loc.size)
+	_, err = f.ReadAt(b, loc.offset)
+	if err != nil {
+		return
+	}
+	var g GobEntry
+	err = g.Unmarshal(b)
+	if err != nil {
+		return
+	}
+	e = &g
+	return
+}
+
+// Entry returns the ith entry, loading it from the chain file if it hasn't been yet
+func (c *Chain) Entry(i int) (e Entry, err error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	e = c.Entries[i]
+	if e != nil || c.path == "" {
+		return
+	}
+	var f *os.File
+	f, err = os.Open(c.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	e, err = c.readEntry(f, i)
+	if err == nil {
+		c.Entries[i] = e
+	}
+	return
+}
+
+// LoadEntries loads all the entries that haven't been yet, decoding them in parallel
+func (c *Chain) LoadEntries() (err error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	var todo []int
+	for i, e := range c.Entries {
+		if e == nil && c.path != "" {
+			todo = append(todo, i)
+		}
+	}
+	if len(todo) == 0 {
+		return
+	}
+	f, err := os.Open(c.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	jobs := make(chan int)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// each worker sets different elements so they can share the slice
+				e, err := c.readEntry(f, i)
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					continue
+				}
+				c.Entries[i] = e
+			}
+		}()
+	}
+	for _, i := range todo {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	select {
+	case err = <-errs:
+	default:
+	}
+	return
+}
+
+// snapshot returns copies of the chain's hashes, headers and entries as they are now,
+// which can be read without the lock
+func (c *Chain) snapshot() (hashes []Hash, headers []*Header, entries []Entry) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	hashes = append([]Hash(nil), c.Hashes...)
+	headers = append([]*Header(nil), c.Headers...)
+	entries = append([]Entry(nil), c.Entries...)
+	return
+}
+
 // Top returns the latest header
 func (c *Chain) Top() (header *Header) {
 	return c.Nth(0)
@@ -137,6 +306,8 @@ func (c *Chain) Top() (header *Header) {
 
 // Nth returns the nth latest header
 func (c *Chain) Nth(n int) (header *Header) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
 	l := len(c.Headers)
 	if l-n > 0 {
 		header = c.Headers[l-n-1]
@@ -146,6 +317,8 @@ func (c *Chain) Nth(n int) (header *Header) {
 
 // TopType returns the latest header of a given type
 func (c *Chain) TopType(entryType string) (hash *Hash, header *Header) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
 	i, ok := c.TypeTops[entryType]
 	if ok {
 		header = c.Headers[i]
@@ -159,19 +332,20 @@ func (c *Chain) TopType(entryType string) (hash *Hash, header *Header) {
 func (c *Chain) AddEntry(now time.Time, entryType string, e Entry, privKey ic.PrivKey) (hash Hash, err error) {
 	var l int
 	var header *Header
-	l, hash, header, err = c.PrepareHeader(now, entryType, e, privKey, nil)
+	l, hash, header, err = c.PrepareHeader(now, entryType, e, privKey, nil, nil)
 	if err == nil {
 		err = c.addEntry(l, hash, header, e)
 	}
 	return
 }
 
-func (c *Chain) PrepareHeader(now time.Time, entryType string, e Entry, privKey ic.PrivKey, change *StatusChange) (entryIdx int, hash Hash, header *Header, err error) {
+func (c *Chain) PrepareHeader(now time.Time, entryType string, e Entry, privKey ic.PrivKey, change *StatusChange, meta map[string]string) (entryIdx int, hash Hash, header *Header, err error) {
 
 	// get the previous hashes
 	var ph, pth Hash
 
 	//@TODO make this transactional
+	c.lk.Lock()
 	l := len(c.Hashes)
 	if l == 0 {
 		ph = NullHash()
@@ -185,8 +359,9 @@ func (c *Chain) PrepareHeader(now time.Time, entryType string, e Entry, privKey
 	} else {
 		pth = c.Hashes[i]
 	}
+	c.lk.Unlock()
 
-	hash, header, err = newHeader(c.hashSpec, now, entryType, e, privKey, ph, pth, change)
+	hash, header, err = newHeader(c.hashSpec, now, entryType, e, privKey, ph, pth, change, meta)
 	if err != nil {
 		return
 	}
@@ -210,10 +385,17 @@ func (c *Chain) addEntry(entryIdx int, hash Hash, header *Header, e Entry) (err
 	var g GobEntry
 	g = *e.(*GobEntry)
 
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if c.closed {
+		err = ErrChainClosed
+		return
+	}
 	c.Hashes = append(c.Hashes, hash)
 	c.Headers = append(c.Headers, header)
 	c.Entries = append(c.Entries, &g)
 	c.TypeTops[header.Type] = entryIdx
+	c.TypeIdx[header.Type] = append(c.TypeIdx[header.Type], entryIdx)
 	c.Emap[header.EntryLink.String()] = entryIdx
 	c.Hmap[hash.String()] = entryIdx
 
@@ -224,8 +406,33 @@ func (c *Chain) addEntry(entryIdx int, hash Hash, header *Header, e Entry) (err
 	return
 }
 
+// TypeIndexes returns the indexes of the entries of the given types in chain order, or of
+// all the app's entries if no types are given
+func (c *Chain) TypeIndexes(types ...string) (idxs []int) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if len(types) == 0 {
+		for t := range c.TypeIdx {
+			if !IsSystemEntryType(t) {
+				types = append(types, t)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for _, t := range types {
+		if !seen[t] {
+			seen[t] = true
+			idxs = append(idxs, c.TypeIdx[t]...)
+		}
+	}
+	sort.Ints(idxs)
+	return
+}
+
 // Get returns the header of a given hash
 func (c *Chain) Get(h Hash) (header *Header, err error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
 	i, ok := c.Hmap[h.String()]
 	if ok {
 		header = c.Headers[i]
@@ -235,20 +442,39 @@ func (c *Chain) Get(h Hash) (header *Header, err error) {
 	return
 }
 
-// GetEntry returns the entry of a given entry hash
+// GetEntry returns the entry of a given entry hash, from the cache if it is there
 func (c *Chain) GetEntry(h Hash) (entry Entry, entryType string, err error) {
-	i, ok := c.Emap[h.String()]
+	k := h.String()
+	c.lk.Lock()
+	i, ok := c.Emap[k]
 	if ok {
-		entry = c.Entries[i]
 		entryType = c.Headers[i].Type
-	} else {
+	}
+	c.lk.Unlock()
+	if !ok {
 		err = ErrHashNotFound
+		return
+	}
+	if e, hit := c.cache.get(k); hit {
+		entry = e
+		return
+	}
+	entry, err = c.Entry(i)
+	if g, isGob := entry.(*GobEntry); err == nil && isGob {
+		c.cache.add(k, g)
 	}
 	return
 }
 
+// EntryCacheStats returns the statistics of the chain's cache of decoded entries
+func (c *Chain) EntryCacheStats() CacheStats {
+	return c.cache.stats()
+}
+
 // GetEntryHeader returns the header of a given entry hash
 func (c *Chain) GetEntryHeader(h Hash) (header *Header, err error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
 	i, ok := c.Emap[h.String()]
 	if ok {
 		header = c.Headers[i]
@@ -288,8 +514,14 @@ func readPair(flags int64, reader io.Reader) (header *Header, entry Entry, err e
 
 // MarshalChain serializes a chain data to a writer
 func (c *Chain) MarshalChain(writer io.Writer, flags int64, types ...string) (err error) {
-
-	if len(c.Headers) != len(c.Entries) {
+	if (flags & ChainMarshalFlagsNoEntries) == 0 {
+		err = c.LoadEntries()
+		if err != nil {
+			return
+		}
+	}
+	hashes, headers, entries := c.snapshot()
+	if len(headers) != len(entries) {
 		err = ErrIncompleteChain
 		return
 	}
@@ -300,7 +532,7 @@ func (c *Chain) MarshalChain(writer io.Writer, flags int64, types ...string) (er
 	}
 
 	var lastIdx int64
-	numEntries := int64(len(c.Headers))
+	numEntries := int64(len(headers))
 	var entryFilter []bool
 	if len(types) > 0 {
 		// make a hash of the types if we need to filter by type
@@ -311,7 +543,7 @@ func (c *Chain) MarshalChain(writer io.Writer, flags int64, types ...string) (er
 		// make the entry filter array
 		entryFilter = make([]bool, numEntries)
 		numEntries = 0
-		for i, hdr := range c.Headers {
+		for i, hdr := range headers {
 			_, ok := typesHash[hdr.Type]
 			if i == 0 {
 				ok = true
@@ -332,7 +564,7 @@ func (c *Chain) MarshalChain(writer io.Writer, flags int64, types ...string) (er
 		return err
 	}
 
-	for i, hdr := range c.Headers {
+	for i, hdr := range headers {
 		var e Entry
 
 		if entryFilter != nil && !entryFilter[i] {
@@ -346,7 +578,7 @@ func (c *Chain) MarshalChain(writer io.Writer, flags int64, types ...string) (er
 				e = &GobEntry{C: ""}
 
 			} else {
-				e = c.Entries[i]
+				e = entries[i]
 			}
 		}
 
@@ -357,7 +589,7 @@ func (c *Chain) MarshalChain(writer io.Writer, flags int64, types ...string) (er
 	}
 
 	if (flags & ChainMarshalFlagsNoHeaders) == 0 {
-		hash := c.Hashes[lastIdx]
+		hash := hashes[lastIdx]
 		err = hash.MarshalHash(writer)
 	}
 	return
@@ -371,12 +603,12 @@ func (c *Chain) addPair(header *Header, entry Entry, i int) {
 	if header != nil {
 		if i > 0 {
 			s := header.HeaderLink.String()
-			h, _ := NewHash(s)
-			c.Hashes = append(c.Hashes, h)
+			c.Hashes = append(c.Hashes, header.HeaderLink.Clone())
 			c.Hmap[s] = i - 1
 		}
 		c.Headers = append(c.Headers, header)
 		c.TypeTops[header.Type] = i
+		c.TypeIdx[header.Type] = append(c.TypeIdx[header.Type], i)
 		c.Emap[header.EntryLink.String()] = i
 	}
 	if entry != nil {
@@ -426,9 +658,14 @@ func UnmarshalChain(hashSpec HashSpec, reader io.Reader) (flags int64, c *Chain,
 
 // Walk traverses chain from most recent to first entry calling fn on each one
 func (c *Chain) Walk(fn WalkerFn) (err error) {
-	l := len(c.Headers)
+	err = c.LoadEntries()
+	if err != nil {
+		return
+	}
+	hashes, headers, entries := c.snapshot()
+	l := len(headers)
 	for i := l - 1; i >= 0; i-- {
-		err = fn(&c.Hashes[i], c.Headers[i], c.Entries[i])
+		err = fn(&hashes[i], headers[i], entries[i])
 		if err != nil {
 			return
 		}
@@ -440,9 +677,16 @@ func (c *Chain) Walk(fn WalkerFn) (err error) {
 // @TODO confirm that TypeLinks are also correct
 // @TODO confirm signatures
 func (c *Chain) Validate(skipEntries bool) (err error) {
-	l := len(c.Headers)
+	if !skipEntries {
+		err = c.LoadEntries()
+		if err != nil {
+			return
+		}
+	}
+	hashes, headers, entries := c.snapshot()
+	l := len(headers)
 	for i := 0; i < l; i++ {
-		hd := c.Headers[i]
+		hd := headers[i]
 
 		var hash, nexth Hash
 		// hash the header
@@ -452,10 +696,10 @@ func (c *Chain) Validate(skipEntries bool) (err error) {
 		}
 		// we can't compare top hash to next link, because it doesn't exist yet!
 		if i < l-2 {
-			nexth = c.Headers[i+1].HeaderLink
+			nexth = headers[i+1].HeaderLink
 		} else {
 			// so get it from the Hashes (even though this could be cheated)
-			nexth = c.Hashes[i]
+			nexth = hashes[i]
 		}
 
 		if !hash.Equal(&nexth) {
@@ -465,7 +709,7 @@ func (c *Chain) Validate(skipEntries bool) (err error) {
 
 		if !skipEntries {
 			var b []byte
-			b, err = c.Entries[i].Marshal()
+			b, err = entries[i].Marshal()
 			if err != nil {
 				return
 			}
@@ -485,16 +729,18 @@ func (c *Chain) Validate(skipEntries bool) (err error) {
 
 // String converts a chain to a textual dump of the headers and entries
 func (c *Chain) String() string {
-	l := len(c.Headers)
+	c.LoadEntries()
+	hashes, headers, entries := c.snapshot()
+	l := len(headers)
 	r := ""
 	for i := 0; i < l; i++ {
-		hdr := c.Headers[i]
-		hash := c.Hashes[i]
+		hdr := headers[i]
+		hash := hashes[i]
 		r += fmt.Sprintf("%s:%s @ %v\n", hdr.Type, hash, hdr.Time)
 		r += fmt.Sprintf("    Next Header: %v\n", hdr.HeaderLink)
 		r += fmt.Sprintf("    Next %s: %v\n", hdr.Type, hdr.TypeLink)
 		r += fmt.Sprintf("    Entry: %v\n", hdr.EntryLink)
-		e := c.Entries[i]
+		e := entries[i]
 		switch hdr.Type {
 		case KeyEntryType:
 			r += fmt.Sprintf("       %v\n", e.(*GobEntry).C)
@@ -512,5 +758,7 @@ func (c *Chain) String() string {
 
 // Length returns the number of entries in the chain
 func (c *Chain) Length() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
 	return len(c.Headers)
 }
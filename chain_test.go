@@ -60,6 +60,83 @@ func TestNewChainFromFile(t *testing.T) {
 	})
 }
 
+func TestChainLazyLoading(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+	hashSpec, key, now := chainTestSetup()
+
+	path := filepath.Join(d, "chain.dat")
+	c, _ := NewChainFromFile(hashSpec, path)
+	var hashes []Hash
+	for i := 0; i < 10; i++ {
+		e := GobEntry{C: fmt.Sprintf("data %d", i)}
+		c.AddEntry(now, "entryTypeFoo", &e, key)
+		hashes = append(hashes, c.Headers[i].EntryLink)
+	}
+	dump := c.String()
+	c.s.Close()
+
+	c, err := NewChainFromFile(hashSpec, path)
+	defer c.s.Close()
+
+	Convey("it should load the headers but not the entries", t, func() {
+		So(err, ShouldBeNil)
+		So(c.Length(), ShouldEqual, 10)
+		So(len(c.Entries), ShouldEqual, 10)
+		So(c.Entries[3], ShouldBeNil)
+	})
+
+	Convey("it should load entries when they are needed", t, func() {
+		e, entryType, err := c.GetEntry(hashes[3])
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "entryTypeFoo")
+		So(e.Content(), ShouldEqual, "data 3")
+		So(c.Entries[3], ShouldEqual, e)
+		So(c.Entries[4], ShouldBeNil)
+	})
+
+	Convey("it should load all the entries", t, func() {
+		err := c.LoadEntries()
+		So(err, ShouldBeNil)
+		for i, e := range c.Entries {
+			So(e.Content(), ShouldEqual, fmt.Sprintf("data %d", i))
+		}
+		So(c.Validate(false), ShouldBeNil)
+		So(c.String(), ShouldEqual, dump)
+	})
+
+	Convey("new entries should follow the loaded ones", t, func() {
+		e := GobEntry{C: "more"}
+		_, err := c.AddEntry(now, "entryTypeFoo", &e, key)
+		So(err, ShouldBeNil)
+		So(c.Entries[10].Content(), ShouldEqual, "more")
+	})
+
+	Convey("it should be readable while entries are being added", t, func() {
+		done := make(chan bool)
+		go func() {
+			for i := 0; i < 20; i++ {
+				e := GobEntry{C: fmt.Sprintf("concurrent %d", i)}
+				c.AddEntry(now, "entryTypeFoo", &e, key)
+			}
+			close(done)
+		}()
+		for running := true; running; {
+			select {
+			case <-done:
+				running = false
+			default:
+			}
+			So(c.Walk(func(key *Hash, header *Header, entry Entry) error { return nil }), ShouldBeNil)
+			var b bytes.Buffer
+			So(c.MarshalChain(&b, ChainMarshalFlagsNone), ShouldBeNil)
+			So(c.Validate(false), ShouldBeNil)
+			So(c.String(), ShouldNotEqual, "")
+		}
+		So(c.Length(), ShouldEqual, 31)
+	})
+}
+
 func TestTop(t *testing.T) {
 	hashSpec, key, now := chainTestSetup()
 	c := NewChain(hashSpec)
@@ -0,0 +1,213 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// channels implements app-level publish/subscribe channels between the nodes of a holochain
+
+package holochain
+
+import (
+	"context"
+	"errors"
+	floodsub "github.com/libp2p/go-floodsub"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"sync"
+)
+
+var ErrChannelsNotStarted = errors.New("channels not started")
+var ErrNotSubscribed = errors.New("not subscribed to channel")
+var ErrBadChannelName = errors.New("channel name must not be empty")
+
+// ChannelHandler is implemented by ribosomes that support channels.  Published payloads
+// are checked by the zome's validatePublish function and delivered to the function the
+// zome named when it subscribed.
+type ChannelHandler interface {
+	ValidatePublish(channel string, msg string) error
+	ReceivePublish(handler string, channel string, from string, msg string) error
+}
+
+// Channels manages a node's channel subscriptions.  Messages published on a channel
+// are ephemeral: they are never committed to the chain or put to the DHT.
+type Channels struct {
+	h    *Holochain
+	ps   *floodsub.PubSub
+	lk   sync.Mutex
+	subs map[string]*channelSub
+}
+
+// channelSub is a zome's subscription to a channel
+type channelSub struct {
+	zome    string
+	channel string
+	handler string
+	sub     *floodsub.Subscription
+	cancel  context.CancelFunc
+}
+
+// NewChannels starts pubsub on the holochain's node
+func NewChannels(h *Holochain) (c *Channels, err error) {
+	var ps *floodsub.PubSub
+	ps, err = floodsub.NewFloodSub(context.Background(), h.node.Host)
+	if err != nil {
+		return
+	}
+	c = &Channels{h: h, ps: ps, subs: make(map[string]*channelSub)}
+	return
+}
+
+// Channels returns the holochain's channel manager, nil until the node is activated
+func (h *Holochain) Channels() *Channels {
+	return h.channels
+}
+
+// topic returns the pubsub topic of a zome's channel, which is scoped to the DNA so
+// that different holochains sharing a network never see each other's messages
+func (c *Channels) topic(zome string, channel string) string {
+	return c.h.dnaHash.String() + "/" + zome + "/" + channel
+}
+
+// validate checks a payload with the zome's validatePublish function
+func (c *Channels) validate(zome string, channel string, msg string) (err error) {
+	var ch ChannelHandler
+	if ch, err = c.handler(zome); err != nil {
+		return
+	}
+	err = ch.ValidatePublish(channel, msg)
+	return
+}
+
+// handler makes a ribosome for the zome to validate or receive channel messages
+func (c *Channels) handler(zome string) (ch ChannelHandler, err error) {
+	var r Ribosome
+	r, _, err = c.h.MakeRibosome(zome)
+	if err != nil {
+		return
+	}
+	var ok bool
+	if ch, ok = r.(ChannelHandler); !ok {
+		err = errors.New("ribosome doesn't support channels: " + r.Type())
+	}
+	return
+}
+
+// Publish validates msg and sends it to the subscribers of the zome's channel
+func (c *Channels) Publish(zome string, channel string, msg string) (err error) {
+	if channel == "" {
+		err = ErrBadChannelName
+		return
+	}
+	if err = c.validate(zome, channel, msg); err != nil {
+		return
+	}
+	err = c.ps.Publish(c.topic(zome, channel), []byte(msg))
+	return
+}
+
+// Subscribe delivers messages published on the zome's channel by other nodes to the
+// zome's handler function.  Subscribing again to the same channel replaces the handler.
+func (c *Channels) Subscribe(zome string, channel string, handler string) (err error) {
+	if channel == "" {
+		err = ErrBadChannelName
+		return
+	}
+	if _, err = c.h.GetZome(zome); err != nil {
+		return
+	}
+	topic := c.topic(zome, channel)
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if s, ok := c.subs[topic]; ok {
+		s.handler = handler
+		return
+	}
+	// invalid messages are dropped before delivery and aren't passed on to other peers
+	err = c.ps.RegisterTopicValidator(topic, func(ctx context.Context, m *floodsub.Message) bool {
+		return c.validate(zome, channel, string(m.GetData())) == nil
+	})
+	if err != nil {
+		return
+	}
+	var sub *floodsub.Subscription
+	sub, err = c.ps.Subscribe(topic)
+	if err != nil {
+		c.ps.UnregisterTopicValidator(topic)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &channelSub{zome: zome, channel: channel, handler: handler, sub: sub, cancel: cancel}
+	c.subs[topic] = s
+	go c.run(ctx, s)
+	return
+}
+
+// Unsubscribe stops delivery of the zome's channel
+func (c *Channels) Unsubscribe(zome string, channel string) (err error) {
+	topic := c.topic(zome, channel)
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	s, ok := c.subs[topic]
+	if !ok {
+		err = ErrNotSubscribed
+		return
+	}
+	delete(c.subs, topic)
+	s.cancel()
+	s.sub.Cancel()
+	c.ps.UnregisterTopicValidator(topic)
+	return
+}
+
+// Subscriptions returns the channels the zome is subscribed to
+func (c *Channels) Subscriptions(zome string) (channels []string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for _, s := range c.subs {
+		if s.zome == zome {
+			channels = append(channels, s.channel)
+		}
+	}
+	return
+}
+
+func (c *Channels) run(ctx context.Context, s *channelSub) {
+	for {
+		m, err := s.sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		from := peer.ID(m.GetFrom())
+		// our own messages come back to us too
+		if from == c.h.nodeID {
+			continue
+		}
+		c.lk.Lock()
+		handler := s.handler
+		c.lk.Unlock()
+		err = c.deliver(s.zome, s.channel, handler, from, string(m.GetData()))
+		if err != nil {
+			c.h.dht.dlog.Logf("channel %s in zome %s: %v", s.channel, s.zome, err)
+		}
+	}
+}
+
+// deliver calls the zome's handler function with a message received on a channel
+func (c *Channels) deliver(zome string, channel string, handler string, from peer.ID, msg string) (err error) {
+	var ch ChannelHandler
+	if ch, err = c.handler(zome); err != nil {
+		return
+	}
+	err = ch.ReceivePublish(handler, channel, peer.IDB58Encode(from), msg)
+	return
+}
+
+// Close cancels all of the node's subscriptions
+func (c *Channels) Close() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for topic, s := range c.subs {
+		s.cancel()
+		s.sub.Cancel()
+		c.ps.UnregisterTopicValidator(topic)
+	}
+	c.subs = make(map[string]*channelSub)
+}
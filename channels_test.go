@@ -0,0 +1,75 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestChannels(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	h.nucleus.dna.Zomes[1].Code += `
+function validatePublish(channel,msg) {return msg != "bad"}
+function onTyping(channel,from,msg) {localStore.set("typing",channel+":"+from+":"+msg)}
+`
+	c := h.Channels()
+
+	Convey("channels should be started when the node is activated", t, func() {
+		So(c, ShouldNotBeNil)
+	})
+
+	Convey("topics should be scoped to the DNA and zome", t, func() {
+		So(c.topic("jsSampleZome", "typing"), ShouldEqual, h.dnaHash.String()+"/jsSampleZome/typing")
+	})
+
+	Convey("publishing should be validated by the zome", t, func() {
+		err := c.Publish("jsSampleZome", "typing", "bad")
+		So(err, ShouldEqual, ValidationFailedErr)
+		err = c.Publish("jsSampleZome", "", "ok")
+		So(err, ShouldEqual, ErrBadChannelName)
+		err = c.Publish("jsSampleZome", "typing", "ok")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("subscribing should register the channel", t, func() {
+		err := c.Subscribe("fooZome", "typing", "onTyping")
+		So(err.Error(), ShouldEqual, "unknown zome: fooZome")
+		err = c.Subscribe("jsSampleZome", "typing", "onTyping")
+		So(err, ShouldBeNil)
+		So(c.Subscriptions("jsSampleZome"), ShouldResemble, []string{"typing"})
+		So(len(c.Subscriptions("zySampleZome")), ShouldEqual, 0)
+	})
+
+	Convey("delivered messages should be passed to the handler", t, func() {
+		from, _ := makePeer("peer_a")
+		err := c.deliver("jsSampleZome", "typing", "onTyping", from, "hello")
+		So(err, ShouldBeNil)
+		v, err := h.dht.localStoreGet("jsSampleZome", "typing")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "typing:"+from.Pretty()+":hello")
+	})
+
+	Convey("unsubscribing should remove the channel", t, func() {
+		err := c.Unsubscribe("jsSampleZome", "typing")
+		So(err, ShouldBeNil)
+		So(len(c.Subscriptions("jsSampleZome")), ShouldEqual, 0)
+		err = c.Unsubscribe("jsSampleZome", "typing")
+		So(err, ShouldEqual, ErrNotSubscribed)
+	})
+
+	Convey("it should be available from the ribosome", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = z.Run(`subscribe("presence","onTyping")`)
+		So(err, ShouldBeNil)
+		So(c.Subscriptions("jsSampleZome"), ShouldResemble, []string{"presence"})
+		_, err = z.Run(`publish("presence",{online:true})`)
+		So(err, ShouldBeNil)
+		_, err = z.Run(`publish("presence","bad")`)
+		So(err, ShouldBeNil)
+		So(z.(*JSRibosome).lastResult.String(), ShouldEqual, "HolochainError: "+ValidationFailedErr.Error())
+		_, err = z.Run(`unsubscribe("presence")`)
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// admin implements the client's calls of the web server's admin api, which are made
+// with the AdminToken
+
+package client
+
+import (
+	"encoding/json"
+	holo "github.com/metacurrency/holochain"
+	"github.com/metacurrency/holochain/ui"
+	"net/url"
+	"strconv"
+)
+
+// Chain returns the local chain, most recent first
+func (c *Client) Chain() (items []ui.ChainItem, err error) {
+	err = c.getJSON("/admin/api/chain", c.AdminToken, &items)
+	return
+}
+
+// DHT returns a summary of the node's DHT
+func (c *Client) DHT() (stats ui.DHTStats, err error) {
+	err = c.getJSON("/admin/api/dht", c.AdminToken, &stats)
+	return
+}
+
+// Peers returns the gossip stats of the node's peers
+func (c *Client) Peers() (peers []holo.GossipStats, err error) {
+	err = c.getJSON("/admin/api/peers", c.AdminToken, &peers)
+	return
+}
+
+// Usage returns the resources used by the app
+func (c *Client) Usage() (usage ui.AppUsage, err error) {
+	err = c.getJSON("/admin/api/usage", c.AdminToken, &usage)
+	return
+}
+
+// Fork reports any peers found running a different DNA of the app
+func (c *Client) Fork() (status holo.ForkStatus, err error) {
+	err = c.getJSON("/admin/api/fork", c.AdminToken, &status)
+	return
+}
+
+// Integrity returns the report of the node's last integrity check, running them again
+// first if recheck is set
+func (c *Client) Integrity(recheck bool) (report holo.IntegrityReport, err error) {
+	if !recheck {
+		err = c.getJSON("/admin/api/integrity", c.AdminToken, &report)
+		return
+	}
+	b, err := c.do("POST", "/admin/api/integrity", c.AdminToken, nil)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &report)
+	return
+}
+
+// Logs returns up to n of the most recent log records, all of those kept for 0
+func (c *Client) Logs(n int) (records []holo.LogRecord, err error) {
+	q := url.Values{}
+	if n > 0 {
+		q.Set("n", strconv.Itoa(n))
+	}
+	err = c.getJSON("/admin/api/logs?"+q.Encode(), c.AdminToken, &records)
+	return
+}
+
+// HeldHashes lists the hashes the node holds in its DHT, filtered by entry type and
+// author when they are given
+func (c *Client) HeldHashes(entryType string, author string) (hashes []string, err error) {
+	q := url.Values{}
+	if entryType != "" {
+		q.Set("type", entryType)
+	}
+	if author != "" {
+		q.Set("author", author)
+	}
+	err = c.getJSON("/admin/api/dht/hashes?"+q.Encode(), c.AdminToken, &hashes)
+	return
+}
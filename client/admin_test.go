@@ -0,0 +1,28 @@
+package client
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAdmin(t *testing.T) {
+	c := New(testURL)
+	Convey("it should get the chain", t, func() {
+		items, err := c.Chain()
+		So(err, ShouldBeNil)
+		So(len(items), ShouldEqual, testH.Chain().Length())
+	})
+	Convey("it should get the app's usage", t, func() {
+		usage, err := c.Usage()
+		So(err, ShouldBeNil)
+		So(usage.DNA, ShouldEqual, testH.DNAHash().String())
+	})
+	Convey("it should get the integrity report", t, func() {
+		_, err := c.Integrity(true)
+		So(err, ShouldBeNil)
+	})
+	Convey("it should get the held hashes", t, func() {
+		_, err := c.HeldHashes("oddNumbers", "")
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// Package client implements a Go client for the web API of a holochain node, so that
+// Go services can call zome functions, subscribe to events and use the admin api
+// without making the HTTP requests themselves.  Typed wrappers for the exposed
+// functions of a particular DNA can be generated with `hcdev client go`.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	holo "github.com/metacurrency/holochain"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Error is an error response from the web server
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// Client makes requests of a holochain web server
+type Client struct {
+	// URL is the address of the web server, e.g. http://localhost:3141
+	URL string
+	// Token is the api key sent as a bearer token, if the server requires one
+	Token string
+	// AdminToken is the bearer token sent with admin api requests
+	AdminToken string
+	// HTTP is the client requests are made with, http.DefaultClient if nil
+	HTTP *http.Client
+}
+
+// New returns a client of the web server at url
+func New(url string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/")}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP == nil {
+		return http.DefaultClient
+	}
+	return c.HTTP
+}
+
+// do makes a request with token as its bearer token and returns the response body,
+// or an *Error if the response status isn't 200
+func (c *Client) do(method string, path string, token string, body io.Reader) (result []byte, err error) {
+	req, err := http.NewRequest(method, c.URL+path, body)
+	if err != nil {
+		return
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	result, err = ioutil.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(result))}
+		result = nil
+	}
+	return
+}
+
+// getJSON decodes the response to a GET of path into result
+func (c *Client) getJSON(path string, token string, result interface{}) (err error) {
+	b, err := c.do("GET", path, token, nil)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, result)
+	return
+}
+
+// Call calls a string calling function and returns its result
+func (c *Client) Call(zome string, function string, arg string) (result string, err error) {
+	b, err := c.do("POST", "/fn/"+url.PathEscape(zome)+"/"+url.PathEscape(function), c.Token, strings.NewReader(arg))
+	result = string(b)
+	return
+}
+
+// CallJSON calls a JSON calling function with arg encoded and decodes its result
+// into result, which may be nil to ignore it
+func (c *Client) CallJSON(zome string, function string, arg interface{}, result interface{}) (err error) {
+	body, err := json.Marshal(arg)
+	if err != nil {
+		return
+	}
+	b, err := c.do("POST", "/fn/"+url.PathEscape(zome)+"/"+url.PathEscape(function), c.Token, bytes.NewReader(body))
+	if err != nil || result == nil {
+		return
+	}
+	err = json.Unmarshal(b, result)
+	return
+}
+
+// EntryResult is an entry and its type as returned by Entry
+type EntryResult struct {
+	Entry     interface{}
+	EntryType string
+}
+
+// Entry gets the entry with the given hash
+func (c *Client) Entry(hash string) (entry EntryResult, err error) {
+	err = c.getJSON("/entry/"+url.PathEscape(hash), c.Token, &entry)
+	return
+}
+
+// Task returns the status of a background task
+func (c *Client) Task(id string) (task holo.Task, err error) {
+	err = c.getJSON("/task/"+url.PathEscape(id), c.Token, &task)
+	return
+}
+
+// Tasks lists the background tasks
+func (c *Client) Tasks() (tasks []holo.Task, err error) {
+	err = c.getJSON("/task/", c.Token, &tasks)
+	return
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"errors"
+	holo "github.com/metacurrency/holochain"
+	"github.com/metacurrency/holochain/ui"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// the holochain served to the tests, and its web server's URL
+var testH *holo.Holochain
+
+const testURL = "http://127.0.0.1:31416"
+
+func TestMain(m *testing.M) {
+	holo.InitializeHolochain()
+	d, _, h := holo.PrepareTestChain("test")
+	testH = h
+	go ui.NewWebServer(h, "31416").Start()
+	time.Sleep(time.Second)
+	code := m.Run()
+	holo.CleanupTestDir(d)
+	os.Exit(code)
+}
+
+func TestCall(t *testing.T) {
+	c := New(testURL + "/")
+	var hash string
+	Convey("it should call string calling functions", t, func() {
+		var err error
+		hash, err = c.Call("jsSampleZome", "addOdd", "7")
+		So(err, ShouldBeNil)
+		_, err = holo.NewHash(hash)
+		So(err, ShouldBeNil)
+	})
+	Convey("it should call JSON calling functions", t, func() {
+		var r string
+		err := c.CallJSON("jsSampleZome", "addProfile", map[string]string{"firstName": "Zippy", "lastName": "Pinhead"}, &r)
+		So(err, ShouldBeNil)
+		_, err = holo.NewHash(r)
+		So(err, ShouldBeNil)
+	})
+	Convey("it should return errors with their status codes", t, func() {
+		_, err := c.Call("jsSampleZome", "testStrFn1", "foo")
+		var e *Error
+		So(errors.As(err, &e), ShouldBeTrue)
+		So(e.StatusCode, ShouldEqual, http.StatusForbidden)
+	})
+	Convey("it should get entries", t, func() {
+		entry, err := c.Entry(hash)
+		So(err, ShouldBeNil)
+		So(entry.EntryType, ShouldEqual, "oddNumbers")
+		So(entry.Entry, ShouldEqual, "7")
+	})
+	Convey("it should get task statuses", t, func() {
+		id, err := testH.Tasks().Spawn("jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldBeNil)
+		time.Sleep(time.Millisecond * 100)
+		task, err := c.Task(id)
+		So(err, ShouldBeNil)
+		So(task.Result, ShouldEqual, "result: foo")
+		tasks, err := c.Tasks()
+		So(err, ShouldBeNil)
+		So(len(tasks), ShouldBeGreaterThan, 0)
+	})
+}
+
+func TestToken(t *testing.T) {
+	Convey("it should send its token as a bearer token", t, func() {
+		var auth string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth = r.Header.Get("Authorization")
+			w.Write([]byte("ok"))
+		}))
+		defer s.Close()
+		c := New(s.URL)
+		c.Token = "secret"
+		r, err := c.Call("z", "f", "")
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, "ok")
+		So(auth, ShouldEqual, "Bearer secret")
+	})
+}
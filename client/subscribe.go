@@ -0,0 +1,63 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// subscribe implements receiving the holochain's events over the web server's websocket
+
+package client
+
+import (
+	"context"
+	websocket "github.com/gorilla/websocket"
+	holo "github.com/metacurrency/holochain"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// wsURL returns the websocket URL of path on the web server
+func (c *Client) wsURL(path string) string {
+	u := c.URL + path
+	if strings.HasPrefix(u, "https:") {
+		return "wss:" + strings.TrimPrefix(u, "https:")
+	}
+	return "ws:" + strings.TrimPrefix(u, "http:")
+}
+
+// Subscribe streams the holochain's events of the given types on the returned channel
+// until ctx is done or the connection fails, when the channel is closed
+func (c *Client) Subscribe(ctx context.Context, types holo.EventType) (events <-chan holo.Event, err error) {
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+	q := url.Values{"types": {strings.Replace(types.String(), "|", ",", -1)}}
+	conn, resp, err := websocket.DefaultDialer.Dial(c.wsURL("/_events?"+q.Encode()), header)
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			err = &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		return
+	}
+	ch := make(chan holo.Event)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(ch)
+		for {
+			var e holo.Event
+			if err := conn.ReadJSON(&e); err != nil {
+				return
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	events = ch
+	return
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	holo "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	c := New(testURL)
+	Convey("it should make websocket URLs", t, func() {
+		So(c.wsURL("/_events"), ShouldEqual, "ws://127.0.0.1:31416/_events")
+		So((&Client{URL: "https://example.com"}).wsURL("/x"), ShouldEqual, "wss://example.com/x")
+	})
+	Convey("it should receive the events subscribed to", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := c.Subscribe(ctx, holo.EntryCommitted)
+		So(err, ShouldBeNil)
+		time.Sleep(time.Millisecond * 100)
+		hash, err := c.Call("jsSampleZome", "addOdd", "9")
+		So(err, ShouldBeNil)
+		e := <-events
+		So(e.Type, ShouldEqual, holo.EntryCommitted)
+		So(e.Hash, ShouldEqual, hash)
+		cancel()
+		for range events {
+		}
+	})
+}
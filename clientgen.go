@@ -0,0 +1,259 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// clientgen implements generating typed client code for a holochain's exposed functions
+// from its Description
+
+package holochain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	ClientLangJS = "js"
+	ClientLangTS = "ts"
+	ClientLangGo = "go"
+)
+
+var ErrUnknownClientLang = errors.New("unknown client language")
+
+// GenerateClient writes client code in the given language with one method per publicly
+// exposed function and types for entry definitions that have JSON schemas.  The generated
+// code calls the functions through the /fn/ endpoint of the holochain web server, the
+// Go code doing so by wrapping a client.Client.
+func GenerateClient(w io.Writer, d Description, lang string) (err error) {
+	var b bytes.Buffer
+	switch lang {
+	case ClientLangJS:
+		genJSClient(&b, d, false)
+	case ClientLangTS:
+		genJSClient(&b, d, true)
+	case ClientLangGo:
+		genGoClient(&b, d)
+	default:
+		err = ErrUnknownClientLang
+		return
+	}
+	_, err = w.Write(b.Bytes())
+	return
+}
+
+// clientIdent converts a name into an identifier, optionally exporting it.  Names
+// starting with a digit get an "X" (or "x") prefix to keep the identifier valid.
+func clientIdent(name string, export bool) string {
+	var b bytes.Buffer
+	upper := export
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			if export {
+				b.WriteRune('X')
+			} else {
+				b.WriteRune('x')
+			}
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// schemaProps returns the properties of an object schema and which of them are required
+func schemaProps(schema interface{}) (props map[string]interface{}, names []string, required map[string]bool) {
+	s, ok := schema.(map[string]interface{})
+	if !ok || s["type"] != "object" {
+		return
+	}
+	props, _ = s["properties"].(map[string]interface{})
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	required = make(map[string]bool)
+	if r, ok := s["required"].([]interface{}); ok {
+		for _, n := range r {
+			if name, ok := n.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+	return
+}
+
+func schemaType(schema interface{}, ts bool) string {
+	s, _ := schema.(map[string]interface{})
+	switch s["type"] {
+	case "string":
+		return "string"
+	case "integer":
+		if ts {
+			return "number"
+		}
+		return "int64"
+	case "number":
+		if ts {
+			return "number"
+		}
+		return "float64"
+	case "boolean":
+		if ts {
+			return "boolean"
+		}
+		return "bool"
+	case "array":
+		if ts {
+			return schemaType(s["items"], ts) + "[]"
+		}
+		return "[]" + schemaType(s["items"], ts)
+	}
+	if ts {
+		return "any"
+	}
+	return "interface{}"
+}
+
+func genJSClient(b *bytes.Buffer, d Description, ts bool) {
+	fmt.Fprintf(b, "// Client for the %s holochain (DNA %s)\n// Generated by holochain, DO NOT EDIT.\n\n", d.Name, d.DNAHash)
+
+	if ts {
+		seen := make(map[string]bool)
+		for _, z := range d.Zomes {
+			for _, e := range z.Entries {
+				props, names, required := schemaProps(e.Schema)
+				if props == nil || seen[e.Name] {
+					continue
+				}
+				seen[e.Name] = true
+				fmt.Fprintf(b, "export interface %s {\n", clientIdent(e.Name, true))
+				for _, n := range names {
+					opt := "?"
+					if required[n] {
+						opt = ""
+					}
+					fmt.Fprintf(b, "  %s%s: %s;\n", n, opt, schemaType(props[n], true))
+				}
+				b.WriteString("}\n\n")
+			}
+		}
+	}
+
+	if ts {
+		b.WriteString("export class HolochainClient {\n  baseURL: string;\n\n  constructor(baseURL: string = \"\") {\n")
+	} else {
+		b.WriteString("export class HolochainClient {\n  constructor(baseURL = \"\") {\n")
+	}
+	b.WriteString("    this.baseURL = baseURL;\n  }\n\n")
+
+	if ts {
+		b.WriteString("  private call(zome: string, fn: string, arg: any, json: boolean): Promise<any> {\n")
+	} else {
+		b.WriteString("  call(zome, fn, arg, json) {\n")
+	}
+	b.WriteString(`    return fetch(this.baseURL + "/fn/" + zome + "/" + fn, {
+      method: "POST",
+      body: json ? JSON.stringify(arg) : String(arg)
+    }).then(r => {
+      if (!r.ok) {
+        return r.text().then(t => { throw new Error(t); });
+      }
+      return json ? r.json() : r.text();
+    });
+  }
+`)
+
+	for _, z := range d.Zomes {
+		for _, f := range z.Functions {
+			if f.Exposure != PUBLIC_EXPOSURE {
+				continue
+			}
+			json := f.CallingType == JSON_CALLING
+			name := clientIdent(z.Name, false) + clientIdent(f.Name, true)
+			if ts {
+				argType, retType := "string", "Promise<string>"
+				if json {
+					argType, retType = "any", "Promise<any>"
+				}
+				fmt.Fprintf(b, "\n  %s(arg: %s): %s {\n", name, argType, retType)
+			} else {
+				fmt.Fprintf(b, "\n  %s(arg) {\n", name)
+			}
+			fmt.Fprintf(b, "    return this.call(%q, %q, arg, %v);\n  }\n", z.Name, f.Name, json)
+		}
+	}
+	b.WriteString("}\n")
+}
+
+func genGoClient(b *bytes.Buffer, d Description) {
+	fmt.Fprintf(b, "// Client for the %s holochain (DNA %s)\n// Generated by holochain, DO NOT EDIT.\n\n", d.Name, d.DNAHash)
+	pkg := strings.ToLower(clientIdent(d.Name, false))
+	if pkg == "" || pkg == "client" {
+		pkg = "app"
+	}
+	fmt.Fprintf(b, "package %s\n\nimport \"github.com/metacurrency/holochain/client\"\n\n", pkg)
+	seen := make(map[string]bool)
+	for _, z := range d.Zomes {
+		for _, e := range z.Entries {
+			props, names, required := schemaProps(e.Schema)
+			if props == nil || seen[e.Name] {
+				continue
+			}
+			seen[e.Name] = true
+			fmt.Fprintf(b, "type %s struct {\n", clientIdent(e.Name, true))
+			for _, n := range names {
+				omit := ",omitempty"
+				if required[n] {
+					omit = ""
+				}
+				fmt.Fprintf(b, "\t%s %s `json:\"%s%s\"`\n", clientIdent(n, true), schemaType(props[n], false), n, omit)
+			}
+			b.WriteString("}\n\n")
+		}
+	}
+
+	b.WriteString(`// Client calls the exposed functions of a holochain web server
+type Client struct {
+	*client.Client
+}
+
+// NewClient returns a client of the web server at url
+func NewClient(url string) *Client {
+	return &Client{client.New(url)}
+}
+`)
+
+	for _, z := range d.Zomes {
+		for _, f := range z.Functions {
+			if f.Exposure != PUBLIC_EXPOSURE {
+				continue
+			}
+			name := clientIdent(z.Name, true) + clientIdent(f.Name, true)
+			if f.CallingType == JSON_CALLING {
+				fmt.Fprintf(b, `
+func (c *Client) %s(arg interface{}, result interface{}) (err error) {
+	return c.CallJSON(%q, %q, arg, result)
+}
+`, name, z.Name, f.Name)
+			} else {
+				fmt.Fprintf(b, `
+func (c *Client) %s(arg string) (result string, err error) {
+	return c.Call(%q, %q, arg)
+}
+`, name, z.Name, f.Name)
+			}
+		}
+	}
+}
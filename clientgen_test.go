@@ -0,0 +1,62 @@
+package holochain
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"go/format"
+	"testing"
+)
+
+func TestGenerateClient(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	desc, _ := h.Describe()
+
+	Convey("it should fail on unknown languages", t, func() {
+		var b bytes.Buffer
+		err := GenerateClient(&b, desc, "cobol")
+		So(err, ShouldEqual, ErrUnknownClientLang)
+	})
+
+	Convey("it should generate a javascript client for exposed functions", t, func() {
+		var b bytes.Buffer
+		err := GenerateClient(&b, desc, ClientLangJS)
+		So(err, ShouldBeNil)
+		js := b.String()
+		So(js, ShouldContainSubstring, "export class HolochainClient")
+		So(js, ShouldContainSubstring, "zySampleZomeAddEven(arg) {\n    return this.call(\"zySampleZome\", \"addEven\", arg, false);")
+		So(js, ShouldContainSubstring, "zySampleZomeAddPrime(arg) {\n    return this.call(\"zySampleZome\", \"addPrime\", arg, true);")
+		So(js, ShouldNotContainSubstring, "testStrFn1")
+	})
+
+	Convey("it should generate a typescript client with entry types", t, func() {
+		var b bytes.Buffer
+		err := GenerateClient(&b, desc, ClientLangTS)
+		So(err, ShouldBeNil)
+		ts := b.String()
+		So(ts, ShouldContainSubstring, "export interface Primes {\n  prime: number;\n}")
+		So(ts, ShouldContainSubstring, "zySampleZomeAddEven(arg: string): Promise<string> {")
+		So(ts, ShouldContainSubstring, "zySampleZomeAddPrime(arg: any): Promise<any> {")
+	})
+
+	Convey("it should generate a valid go client", t, func() {
+		var b bytes.Buffer
+		err := GenerateClient(&b, desc, ClientLangGo)
+		So(err, ShouldBeNil)
+		src, err := format.Source(b.Bytes())
+		So(err, ShouldBeNil)
+		g := string(src)
+		So(g, ShouldContainSubstring, "import \"github.com/metacurrency/holochain/client\"")
+		So(g, ShouldContainSubstring, "type Client struct {\n\t*client.Client\n}")
+		So(g, ShouldContainSubstring, "type Primes struct {\n\tPrime int64 `json:\"prime\"`\n}")
+		So(g, ShouldContainSubstring, "func (c *Client) ZySampleZomeAddEven(arg string) (result string, err error) {\n\treturn c.Call(\"zySampleZome\", \"addEven\", arg)\n}")
+		So(g, ShouldContainSubstring, "func (c *Client) ZySampleZomeAddPrime(arg interface{}, result interface{}) (err error) {")
+	})
+
+	Convey("clientIdent should make identifiers", t, func() {
+		So(clientIdent("my-zome", false), ShouldEqual, "myZome")
+		So(clientIdent("my-zome", true), ShouldEqual, "MyZome")
+		So(clientIdent("2fish", true), ShouldEqual, "X2fish")
+		So(clientIdent("2fish", false), ShouldEqual, "x2fish")
+	})
+}
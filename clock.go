@@ -0,0 +1,87 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// clock implements checking header timestamps against local time, so that apps can rely
+// on header times being roughly right and never going backwards along a chain
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"time"
+)
+
+// DefaultClockSkew is how far ahead of local time a header's time may be when the
+// config doesn't set ClockSkew
+const DefaultClockSkew = 5 * time.Minute
+
+var ErrHeaderTimeMissing = errors.New("header has no timestamp")
+var ErrHeaderTimeInFuture = errors.New("header timestamp is in the future")
+var ErrHeaderTimeBeforePrev = errors.New("header timestamp is before the previous header's")
+
+// clockSkew returns how far ahead of local time header times may be, or 0 for no limit
+func (h *Holochain) clockSkew() time.Duration {
+	switch s := h.config.ClockSkew; {
+	case s == 0:
+		return DefaultClockSkew
+	case s < 0:
+		return 0
+	default:
+		return time.Duration(s) * time.Second
+	}
+}
+
+// checkHeaderTime checks that a header's time isn't further ahead of local time than the
+// allowed skew and that it isn't before the time of the previous header on its chain
+func (h *Holochain) checkHeaderTime(hd *Header, prev *Header, now time.Time) (err error) {
+	if hd.Time.IsZero() {
+		err = ErrHeaderTimeMissing
+		return
+	}
+	if skew := h.clockSkew(); skew > 0 && hd.Time.After(now.Add(skew)) {
+		err = fmt.Errorf("%w: %v is %v ahead of local time", ErrHeaderTimeInFuture, hd.Time, hd.Time.Sub(now))
+		return
+	}
+	if prev != nil && hd.Time.Before(prev.Time) {
+		err = fmt.Errorf("%w: %v is before %v", ErrHeaderTimeBeforePrev, hd.Time, prev.Time)
+	}
+	return
+}
+
+// prevHeader returns the header before hd on its author's chain if we have it, looking in
+// the validation package, our own chain and the headers we hold for the sources
+func (h *Holochain) prevHeader(hd *Header, vpkg *ValidationPackage, sources []peer.ID) (prev *Header) {
+	if hd.HeaderLink.H == nil || hd.HeaderLink.IsNullHash() {
+		return
+	}
+	if vpkg != nil && vpkg.Chain != nil {
+		if p, err := vpkg.Chain.Get(hd.HeaderLink); err == nil {
+			prev = p
+			return
+		}
+	}
+	for _, src := range sources {
+		if src == h.nodeID {
+			if p, err := h.chain.Get(hd.HeaderLink); err == nil {
+				prev = p
+				return
+			}
+			continue
+		}
+		headers, err := h.dht.getHeaders(src)
+		if err != nil {
+			continue
+		}
+		for i := range headers {
+			hash, _, err := headers[i].Sum(h.hashSpec)
+			if err == nil && hash.Equal(&hd.HeaderLink) {
+				prev = &headers[i]
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestCheckHeaderTime(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	now := time.Now()
+
+	Convey("the clock skew should default and be configurable", t, func() {
+		So(h.clockSkew(), ShouldEqual, DefaultClockSkew)
+		h.config.ClockSkew = 30
+		So(h.clockSkew(), ShouldEqual, 30*time.Second)
+		h.config.ClockSkew = -1
+		So(h.clockSkew(), ShouldEqual, 0)
+		h.config.ClockSkew = 0
+	})
+
+	Convey("headers should have a time", t, func() {
+		err := h.checkHeaderTime(&Header{}, nil, now)
+		So(err, ShouldEqual, ErrHeaderTimeMissing)
+	})
+
+	Convey("header times should be within the skew of local time", t, func() {
+		err := h.checkHeaderTime(&Header{Time: now.Add(DefaultClockSkew / 2)}, nil, now)
+		So(err, ShouldBeNil)
+		err = h.checkHeaderTime(&Header{Time: now.Add(2 * DefaultClockSkew)}, nil, now)
+		So(err.Error(), ShouldStartWith, ErrHeaderTimeInFuture.Error())
+		So(errors.Is(err, ErrHeaderTimeInFuture), ShouldBeTrue)
+
+		h.config.ClockSkew = -1
+		err = h.checkHeaderTime(&Header{Time: now.Add(2 * DefaultClockSkew)}, nil, now)
+		So(err, ShouldBeNil)
+		h.config.ClockSkew = 0
+	})
+
+	Convey("header times should not go backwards", t, func() {
+		prev := &Header{Time: now.Add(-time.Minute)}
+		err := h.checkHeaderTime(&Header{Time: now}, prev, now)
+		So(err, ShouldBeNil)
+		err = h.checkHeaderTime(&Header{Time: now.Add(-time.Hour)}, prev, now)
+		So(err.Error(), ShouldStartWith, ErrHeaderTimeBeforePrev.Error())
+	})
+}
+
+func TestValidateHeaderTime(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	first := commit(h, "evenNumbers", "2")
+	hash := commit(h, "evenNumbers", "4")
+	hd, _ := h.chain.GetEntryHeader(hash)
+	entry, _, _ := h.chain.GetEntry(hash)
+
+	Convey("the previous header should be found on our own chain", t, func() {
+		firstHd, _ := h.chain.GetEntryHeader(first)
+		So(h.prevHeader(hd, nil, []peer.ID{h.nodeID}), ShouldEqual, firstHd)
+		other, _ := makePeer("peer_other")
+		So(h.prevHeader(hd, nil, []peer.ID{other}), ShouldBeNil)
+	})
+
+	Convey("puts with plausible header times should validate", t, func() {
+		a := NewPutAction("evenNumbers", entry, hd)
+		_, err := h.ValidateAction(a, a.entryType, nil, []peer.ID{h.nodeID})
+		So(err, ShouldBeNil)
+	})
+
+	Convey("puts with header times far in the future should be rejected", t, func() {
+		future := *hd
+		future.Time = time.Now().Add(time.Hour)
+		a := NewPutAction("evenNumbers", entry, &future)
+		_, err := h.ValidateAction(a, a.entryType, nil, []peer.ID{h.nodeID})
+		So(err.Error(), ShouldStartWith, ErrHeaderTimeInFuture.Error())
+	})
+
+	Convey("puts with header times before the previous header should be rejected", t, func() {
+		past := *hd
+		past.Time = time.Unix(1, 0)
+		a := NewPutAction("evenNumbers", entry, &past)
+		_, err := h.ValidateAction(a, a.entryType, nil, []peer.ID{h.nodeID})
+		So(err.Error(), ShouldStartWith, ErrHeaderTimeBeforePrev.Error())
+	})
+}
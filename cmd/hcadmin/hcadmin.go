@@ -133,6 +133,102 @@ func setupApp() (app *cli.App) {
 				return err
 			},
 		},
+		{
+			Name:      "gossip",
+			Aliases:   []string{"g"},
+			ArgsUsage: "holochain-name",
+			Usage:     "display per-peer gossip statistics",
+			Action: func(c *cli.Context) error {
+				h, err := cmd.GetHolochain(c.Args().First(), service, "gossip")
+				if err != nil {
+					return err
+				}
+				if !h.Started() {
+					return errors.New("No gossip statistics, chain not yet initialized.")
+				}
+				stats, err := h.DHT().Stats()
+				if err != nil {
+					return err
+				}
+				if len(stats) == 0 {
+					fmt.Println("no gossip exchanges recorded")
+					return nil
+				}
+				for _, s := range stats {
+					fmt.Printf("%s\n", s.Peer)
+					fmt.Printf("    exchanges: %d  puts received: %d  puts sent: %d  failures: %d\n", s.Exchanges, s.PutsReceived, s.PutsSent, s.Failures)
+					fmt.Printf("    average latency: %v  last success: %v  last failure: %v\n", s.AvgLatency(), s.LastSuccess, s.LastFailure)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "rebuild",
+			ArgsUsage: "holochain-name",
+			Usage:     "rebuild the DHT gossip indexes from the stored messages",
+			Action: func(c *cli.Context) error {
+				h, err := cmd.GetHolochain(c.Args().First(), service, "rebuild")
+				if err != nil {
+					return err
+				}
+				if !h.Started() {
+					return errors.New("No indexes to rebuild, chain not yet initialized.")
+				}
+				count, err := h.DHT().RebuildIndexes()
+				if err == nil {
+					fmt.Printf("rebuilt gossip indexes with %d messages\n", count)
+				}
+				return err
+			},
+		},
+		{
+			Name:      "recover",
+			ArgsUsage: "holochain-name",
+			Usage:     "regenerate a lost source chain from the entries published to the DHT",
+			Action: func(c *cli.Context) error {
+				h, err := cmd.GetHolochain(c.Args().First(), service, "recover")
+				if err != nil {
+					return err
+				}
+				count, err := h.RegenerateChain()
+				if err == nil {
+					fmt.Printf("recovered %d chain entries\n", count)
+				}
+				return err
+			},
+		},
+		{
+			Name:      "bridge",
+			ArgsUsage: "from-holochain to-holochain",
+			Usage:     "set up a bridge for calls from one installed holochain to another",
+			Action: func(c *cli.Context) error {
+				if service == nil {
+					return cmd.ErrServiceUninitialized
+				}
+				if len(c.Args()) != 2 {
+					return errors.New("bridge: expected from-holochain and to-holochain arguments")
+				}
+				err := service.Bridge(c.Args()[0], c.Args()[1])
+				if err == nil && verbose {
+					fmt.Printf("bridged %s to %s\n", c.Args()[0], c.Args()[1])
+				}
+				return err
+			},
+		},
+		{
+			Name:      "unbridge",
+			ArgsUsage: "from-holochain to-holochain",
+			Usage:     "remove the bridge from one installed holochain to another",
+			Action: func(c *cli.Context) error {
+				if service == nil {
+					return cmd.ErrServiceUninitialized
+				}
+				if len(c.Args()) != 2 {
+					return errors.New("unbridge: expected from-holochain and to-holochain arguments")
+				}
+				return service.Unbridge(c.Args()[0], c.Args()[1])
+			},
+		},
 		{
 			Name:      "status",
 			Aliases:   []string{"s"},
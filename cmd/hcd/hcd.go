@@ -21,6 +21,10 @@ const (
 
 var debug bool
 var verbose bool
+var timeout time.Duration
+var adminToken string
+var sessions bool
+var daemon bool
 
 func setupApp() (app *cli.App) {
 	app = cli.NewApp()
@@ -49,6 +53,28 @@ func setupApp() (app *cli.App) {
 			Usage:       "verbose output",
 			Destination: &verbose,
 		},
+		cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "maximum time a zome call may run before a 504 is returned (0 for no limit)",
+			Value:       ui.DefaultCallTimeout,
+			Destination: &timeout,
+		},
+		cli.StringFlag{
+			Name:        "admintoken",
+			Usage:       "bearer token required to use the admin api",
+			EnvVar:      "HC_ADMIN_TOKEN",
+			Destination: &adminToken,
+		},
+		cli.BoolFlag{
+			Name:        "sessions",
+			Usage:       "let UIs exchange an api key for a CSRF protected session cookie",
+			Destination: &sessions,
+		},
+		cli.BoolFlag{
+			Name:        "daemon",
+			Usage:       "run as a daemon managing holochains through a control socket in the holochain directory",
+			Destination: &daemon,
+		},
 	}
 
 	app.Before = func(c *cli.Context) error {
@@ -68,6 +94,9 @@ func setupApp() (app *cli.App) {
 	}
 
 	app.Action = func(c *cli.Context) error {
+		if daemon {
+			return runDaemon(service)
+		}
 		args := len(c.Args())
 		if args == 1 {
 			h, err := cmd.GetHolochain(c.Args().First(), service, "serve")
@@ -95,7 +124,19 @@ func setupApp() (app *cli.App) {
 			//				go h.DHT().HandleChangeReqs()
 			go h.DHT().HandleGossipWiths()
 			go h.DHT().Gossip(2 * time.Second)
-			ui.NewWebServer(h, port).Start()
+			ws := ui.NewWebServer(h, port)
+			ws.CallTimeout = timeout
+			ws.AdminToken = adminToken
+			ws.APIKeys = service.Settings.APIKeys
+			ws.CookieSessions = sessions
+			go func() {
+				if err := holo.WaitForShutdown(h.Close); err != nil {
+					fmt.Printf("Error shutting down: %v\n", err)
+					os.Exit(1)
+				}
+				os.Exit(0)
+			}()
+			ws.Start()
 			return err
 		} else if args == 0 {
 			fmt.Println(service.ListChains())
@@ -107,6 +148,19 @@ func setupApp() (app *cli.App) {
 	return
 }
 
+// runDaemon runs the service's daemon until the process is interrupted
+func runDaemon(service *holo.Service) error {
+	d := holo.NewDaemon(service)
+	err := d.Start()
+	if err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Printf("control socket listening on %s\n", d.Path)
+	}
+	return holo.WaitForShutdown(d.Stop)
+}
+
 func main() {
 	app := setupApp()
 
@@ -281,6 +281,34 @@ func setupApp() (app *cli.App) {
 				return err
 			},
 		},
+		{
+			Name:      "client",
+			ArgsUsage: "js|ts|go [output-file]",
+			Usage:     "generate client code for calling the chain's exposed functions",
+			Action: func(c *cli.Context) error {
+				args := c.Args()
+				if len(args) == 0 {
+					return errors.New("client: missing required language argument")
+				}
+				h, err := getHolochain(c, service)
+				if err != nil {
+					return err
+				}
+				desc, err := h.Describe()
+				if err != nil {
+					return err
+				}
+				out := os.Stdout
+				if len(args) > 1 {
+					out, err = os.Create(args[1])
+					if err != nil {
+						return err
+					}
+					defer out.Close()
+				}
+				return holo.GenerateClient(out, desc, args[0])
+			},
+		},
 		{
 			Name:      "dump",
 			Aliases:   []string{"d"},
@@ -0,0 +1,124 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// codec implements versioned envelopes for persisted and transmitted messages so
+// that the underlying encoding can evolve while old data stays readable
+
+package holochain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+)
+
+// envelopeMagic marks the start of an envelope.  It can never be the first byte of
+// a gob stream (gob's uint length prefix is either < 0x80 or >= 0xF8), so data
+// without it is decoded as a legacy bare gob.
+const envelopeMagic byte = 0xEC
+
+const (
+	GobCodecID = 1
+)
+
+// Codec is the interface for encoders that can be carried in an envelope
+type Codec interface {
+	Encode(w io.Writer, data interface{}) error
+	Decode(r io.Reader, to interface{}) error
+}
+
+type codecKey struct {
+	id      byte
+	version byte
+}
+
+// GobCodec implements the Codec interface with gob
+type GobCodec struct{}
+
+func (c GobCodec) Encode(w io.Writer, data interface{}) error {
+	return gob.NewEncoder(w).Encode(data)
+}
+
+func (c GobCodec) Decode(r io.Reader, to interface{}) error {
+	return gob.NewDecoder(r).Decode(to)
+}
+
+var ErrUnknownCodec = errors.New("unknown codec")
+
+var codecs = map[codecKey]Codec{
+	{GobCodecID, 1}: GobCodec{},
+}
+
+var envelopeCodec = codecKey{GobCodecID, 1}
+
+// RegisterCodec adds a codec for the given id and version.  Old versions should remain
+// registered so that previously written envelopes can still be decoded.
+// It is not safe to call while messages are being encoded or decoded.
+func RegisterCodec(id byte, version byte, c Codec) {
+	codecs[codecKey{id, version}] = c
+}
+
+// SetEnvelopeCodec sets the codec used by EnvelopeEncoder for new envelopes
+func SetEnvelopeCodec(id byte, version byte) (err error) {
+	k := codecKey{id, version}
+	if _, ok := codecs[k]; !ok {
+		err = ErrUnknownCodec
+		return
+	}
+	envelopeCodec = k
+	return
+}
+
+// EnvelopeEncoder encodes data with the current codec and wraps it in an envelope
+func EnvelopeEncoder(data interface{}) (b []byte, err error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	err = encodeEnvelope(buf, data)
+	if err != nil {
+		return
+	}
+	b = append([]byte(nil), buf.Bytes()...)
+	return
+}
+
+// EnvelopeDecoder decodes data encoded by EnvelopeEncoder, or a legacy bare gob
+func EnvelopeDecoder(b []byte, to interface{}) (err error) {
+	err = decodeEnvelope(bytes.NewReader(b), to)
+	return
+}
+
+func encodeEnvelope(w io.Writer, data interface{}) (err error) {
+	header := [3]byte{envelopeMagic, envelopeCodec.id, envelopeCodec.version}
+	_, err = w.Write(header[:])
+	if err != nil {
+		return
+	}
+	err = codecs[envelopeCodec].Encode(w, data)
+	return
+}
+
+func decodeEnvelope(r io.Reader, to interface{}) (err error) {
+	var header [3]byte
+	_, err = io.ReadFull(r, header[:1])
+	if err != nil {
+		return
+	}
+	if header[0] != envelopeMagic {
+		// no envelope so fallback to the original bare gob encoding
+		err = GobCodec{}.Decode(io.MultiReader(bytes.NewReader(header[:1]), r), to)
+		return
+	}
+	_, err = io.ReadFull(r, header[1:])
+	if err != nil {
+		return
+	}
+	c, ok := codecs[codecKey{header[1], header[2]}]
+	if !ok {
+		err = ErrUnknownCodec
+		return
+	}
+	err = c.Decode(r, to)
+	return
+}
@@ -0,0 +1,68 @@
+package holochain
+
+import (
+	"bytes"
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"testing"
+)
+
+type testJSONCodec struct{}
+
+func (c testJSONCodec) Encode(w io.Writer, data interface{}) error {
+	return json.NewEncoder(w).Encode(data)
+}
+
+func (c testJSONCodec) Decode(r io.Reader, to interface{}) error {
+	return json.NewDecoder(r).Decode(to)
+}
+
+func TestEnvelope(t *testing.T) {
+	Convey("it should round trip data in an envelope", t, func() {
+		b, err := EnvelopeEncoder("fish")
+		So(err, ShouldBeNil)
+		So(b[0], ShouldEqual, envelopeMagic)
+		So(b[1], ShouldEqual, GobCodecID)
+		So(b[2], ShouldEqual, 1)
+		var s string
+		err = EnvelopeDecoder(b, &s)
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, "fish")
+	})
+
+	Convey("it should fall back to decoding legacy bare gobs", t, func() {
+		m := Message{Type: PUT_REQUEST, Body: "fish"}
+		b, err := ByteEncoder(&m)
+		So(err, ShouldBeNil)
+		var m2 Message
+		err = EnvelopeDecoder(b, &m2)
+		So(err, ShouldBeNil)
+		So(m2.Type, ShouldEqual, PUT_REQUEST)
+		So(m2.Body, ShouldEqual, "fish")
+	})
+
+	Convey("it should fail on unknown codecs", t, func() {
+		var s string
+		err := EnvelopeDecoder([]byte{envelopeMagic, 99, 1, 0}, &s)
+		So(err, ShouldEqual, ErrUnknownCodec)
+		So(SetEnvelopeCodec(99, 1), ShouldEqual, ErrUnknownCodec)
+	})
+
+	Convey("it should encode with a registered codec and still read old envelopes", t, func() {
+		old, _ := EnvelopeEncoder("old")
+		RegisterCodec(99, 1, testJSONCodec{})
+		err := SetEnvelopeCodec(99, 1)
+		So(err, ShouldBeNil)
+		defer SetEnvelopeCodec(GobCodecID, 1)
+
+		b, err := EnvelopeEncoder("new")
+		So(err, ShouldBeNil)
+		So(bytes.HasPrefix(b, []byte{envelopeMagic, 99, 1}), ShouldBeTrue)
+		var s string
+		So(EnvelopeDecoder(b, &s), ShouldBeNil)
+		So(s, ShouldEqual, "new")
+		So(EnvelopeDecoder(old, &s), ShouldBeNil)
+		So(s, ShouldEqual, "old")
+	})
+}
@@ -0,0 +1,367 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// daemon implements running a service's holochains managed over a local control socket
+
+package holochain
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DaemonSocketFileName is the name of the control socket in the service directory
+	DaemonSocketFileName = "hcd.sock"
+
+	DaemonInstall  = "install"
+	DaemonStart    = "start"
+	DaemonStop     = "stop"
+	DaemonStatus   = "status"
+	DaemonBridge   = "bridge"
+	DaemonUnbridge = "unbridge"
+)
+
+var ErrUnknownDaemonCommand = errors.New("unknown daemon command")
+var ErrInstanceRunning = errors.New("instance already running")
+var ErrInstanceNotRunning = errors.New("instance not running")
+var ErrMissingName = errors.New("missing holochain name")
+var ErrBadHolochainName = errors.New("holochain name must be a single path element")
+
+// DaemonCommand is a request on the control socket.  Commands are sent one JSON object
+// per line and each gets a DaemonResponse line in reply.
+type DaemonCommand struct {
+	Command string
+	Name    string // the holochain to act on, or all of them for status if empty
+	Path    string // for install, the directory to copy the app's DNA from
+	To      string // for bridge and unbridge, the holochain Name's bridge is to
+}
+
+// DaemonResponse is the reply to a DaemonCommand
+type DaemonResponse struct {
+	OK     bool
+	Error  string           `json:",omitempty"`
+	Status []InstanceStatus `json:",omitempty"`
+}
+
+// InstanceStatus describes an installed holochain
+type InstanceStatus struct {
+	Name    string
+	DNAHash string
+	Running bool
+	Started time.Time `json:",omitempty"`
+}
+
+type instance struct {
+	h       *Holochain
+	started time.Time
+}
+
+// Daemon runs the holochains of a service and takes control commands on a unix socket
+type Daemon struct {
+	Service      *Service
+	Path         string        // path of the control socket
+	GossipPeriod time.Duration // how often running instances gossip
+	// Prepare, if set, is called with each holochain before it is activated, like for
+	// adding hooks
+	Prepare func(name string, h *Holochain)
+
+	lk        sync.Mutex
+	instances map[string]*instance
+	conns     map[net.Conn]bool
+	listener  net.Listener
+	wg        sync.WaitGroup
+}
+
+// NewDaemon returns a daemon for the service with its socket in the service directory
+func NewDaemon(s *Service) *Daemon {
+	d := Daemon{
+		Service:      s,
+		Path:         filepath.Join(s.Path, DaemonSocketFileName),
+		GossipPeriod: 2 * time.Second,
+		instances:    make(map[string]*instance),
+		conns:        make(map[net.Conn]bool),
+	}
+	return &d
+}
+
+// Start listens on the control socket and handles connections in the background
+func (d *Daemon) Start() (err error) {
+	// a socket left by a daemon that didn't shut down cleanly would block the listen
+	if _, e := os.Stat(d.Path); e == nil {
+		if c, e := net.Dial("unix", d.Path); e == nil {
+			c.Close()
+			err = errors.New("daemon already running on " + d.Path)
+			return
+		}
+		os.Remove(d.Path)
+	}
+	d.listener, err = net.Listen("unix", d.Path)
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(d.Path, 0600); err != nil {
+		d.listener.Close()
+		return
+	}
+	listener := d.listener
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			d.lk.Lock()
+			if d.listener == nil {
+				d.lk.Unlock()
+				conn.Close()
+				return
+			}
+			d.conns[conn] = true
+			d.wg.Add(1)
+			d.lk.Unlock()
+			go d.serve(conn)
+		}
+	}()
+	return
+}
+
+// Stop closes the control socket and its open connections and stops all running
+// instances
+func (d *Daemon) Stop() (err error) {
+	d.lk.Lock()
+	if d.listener != nil {
+		err = d.listener.Close()
+		d.listener = nil
+	}
+	for conn := range d.conns {
+		conn.Close()
+	}
+	for name, i := range d.instances {
+		if e := i.h.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(d.instances, name)
+	}
+	d.lk.Unlock()
+	d.wg.Wait()
+	return
+}
+
+func (d *Daemon) serve(conn net.Conn) {
+	defer d.wg.Done()
+	defer func() {
+		conn.Close()
+		d.lk.Lock()
+		delete(d.conns, conn)
+		d.lk.Unlock()
+	}()
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var cmd DaemonCommand
+		var resp DaemonResponse
+		err := json.Unmarshal(scanner.Bytes(), &cmd)
+		if err == nil {
+			resp, err = d.Do(cmd)
+		}
+		if err != nil {
+			resp = DaemonResponse{Error: err.Error()}
+		}
+		if enc.Encode(resp) != nil {
+			return
+		}
+	}
+}
+
+// Do carries out a control command
+func (d *Daemon) Do(cmd DaemonCommand) (resp DaemonResponse, err error) {
+	if cmd.Name == "" && cmd.Command != DaemonStatus {
+		err = ErrMissingName
+		return
+	}
+	if cmd.Name != "" {
+		if err = checkHolochainName(cmd.Name); err != nil {
+			return
+		}
+	}
+	switch cmd.Command {
+	case DaemonInstall:
+		err = d.Install(cmd.Name, cmd.Path)
+	case DaemonStart:
+		err = d.StartInstance(cmd.Name)
+	case DaemonStop:
+		err = d.StopInstance(cmd.Name)
+	case DaemonStatus:
+		resp.Status, err = d.Status(cmd.Name)
+	case DaemonBridge, DaemonUnbridge:
+		if err = checkHolochainName(cmd.To); err != nil {
+			break
+		}
+		if cmd.Command == DaemonBridge {
+			err = d.Service.Bridge(cmd.Name, cmd.To)
+		} else {
+			err = d.Service.Unbridge(cmd.Name, cmd.To)
+		}
+	default:
+		err = ErrUnknownDaemonCommand
+	}
+	resp.OK = err == nil
+	return
+}
+
+// checkHolochainName checks that a name can only refer to a directory in the service
+// directory
+func checkHolochainName(name string) (err error) {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) || filepath.Base(name) != name {
+		err = ErrBadHolochainName
+	}
+	return
+}
+
+// Install joins the service to the app whose DNA is at srcPath under the given name
+func (d *Daemon) Install(name string, srcPath string) (err error) {
+	if err = checkHolochainName(name); err != nil {
+		return
+	}
+	var agent Agent
+	if agent, err = LoadAgent(d.Service.Path); err != nil {
+		return
+	}
+	if err = d.Service.Clone(srcPath, filepath.Join(d.Service.Path, name), agent, false); err != nil {
+		return
+	}
+	var h *Holochain
+	if h, err = d.Service.GenChain(name); err != nil {
+		return
+	}
+	// generating the chain activates it, but installing shouldn't leave it running
+	err = h.Close()
+	return
+}
+
+// StartInstance loads and activates an installed holochain
+func (d *Daemon) StartInstance(name string) (err error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if _, ok := d.instances[name]; ok {
+		err = ErrInstanceRunning
+		return
+	}
+	if err = checkHolochainName(name); err != nil {
+		return
+	}
+	var h *Holochain
+	if h, err = d.Service.Load(name); err != nil {
+		return
+	}
+	if !h.Started() {
+		h.Close()
+		err = errors.New("can't start an un-started chain")
+		return
+	}
+	if d.Prepare != nil {
+		d.Prepare(name, h)
+	}
+	if err = h.Activate(); err != nil {
+		h.Close()
+		return
+	}
+	go h.DHT().HandleGossipWiths()
+	go h.DHT().Gossip(d.GossipPeriod)
+	d.instances[name] = &instance{h: h, started: time.Now()}
+	return
+}
+
+// StopInstance shuts down a running holochain
+func (d *Daemon) StopInstance(name string) (err error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	i, ok := d.instances[name]
+	if !ok {
+		err = ErrInstanceNotRunning
+		return
+	}
+	delete(d.instances, name)
+	err = i.h.Close()
+	return
+}
+
+// Instance returns the running holochain with the given name or nil
+func (d *Daemon) Instance(name string) *Holochain {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if i, ok := d.instances[name]; ok {
+		return i.h
+	}
+	return nil
+}
+
+// Status returns the status of the named holochain, or of all installed holochains
+// if name is empty.  Chains are found from their files rather than loaded, as loading
+// a chain starts a node for it.
+func (d *Daemon) Status(name string) (status []InstanceStatus, err error) {
+	var names []string
+	if name != "" {
+		if err = checkHolochainName(name); err != nil {
+			return
+		}
+		if _, err = d.Service.IsConfigured(name); err != nil {
+			return
+		}
+		names = []string{name}
+	} else {
+		var files []os.FileInfo
+		if files, err = ioutil.ReadDir(d.Service.Path); err != nil {
+			return
+		}
+		for _, f := range files {
+			if _, e := d.Service.IsConfigured(f.Name()); f.IsDir() && e == nil {
+				names = append(names, f.Name())
+			}
+		}
+	}
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	for _, n := range names {
+		s := InstanceStatus{Name: n}
+		if b, e := readFile(filepath.Join(d.Service.Path, n), DNAHashFileName); e == nil {
+			s.DNAHash = string(b)
+		}
+		if i, ok := d.instances[n]; ok {
+			s.Running = true
+			s.Started = i.started
+		}
+		status = append(status, s)
+	}
+	return
+}
+
+// DaemonRequest sends a command to the daemon listening on the socket at path and
+// returns its response
+func DaemonRequest(path string, cmd DaemonCommand) (resp DaemonResponse, err error) {
+	var conn net.Conn
+	if conn, err = net.Dial("unix", path); err != nil {
+		return
+	}
+	defer conn.Close()
+	if err = json.NewEncoder(conn).Encode(cmd); err != nil {
+		return
+	}
+	err = json.NewDecoder(conn).Decode(&resp)
+	if err == nil && !resp.OK {
+		err = errors.New(resp.Error)
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDaemon(t *testing.T) {
+	d, s, h := setupTestChain("test")
+	defer CleanupTestDir(d)
+	// free the test chain's port for the instances the daemon runs
+	h.node.Close()
+
+	daemon := NewDaemon(s)
+	err := daemon.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer daemon.Stop()
+
+	Convey("it should install apps from a DNA source", t, func() {
+		err := daemon.Install("joined", filepath.Join(s.Path, "test"))
+		So(err, ShouldBeNil)
+		status, err := daemon.Status("joined")
+		So(err, ShouldBeNil)
+		So(len(status), ShouldEqual, 1)
+		So(status[0].DNAHash, ShouldNotEqual, "")
+		So(status[0].Running, ShouldBeFalse)
+	})
+
+	Convey("it should start and stop instances", t, func() {
+		So(daemon.Instance("joined"), ShouldBeNil)
+		err := daemon.StartInstance("joined")
+		So(err, ShouldBeNil)
+		So(daemon.Instance("joined"), ShouldNotBeNil)
+		So(daemon.StartInstance("joined"), ShouldEqual, ErrInstanceRunning)
+
+		status, err := daemon.Status("")
+		So(err, ShouldBeNil)
+		So(len(status), ShouldEqual, 2)
+		So(status[0].Name, ShouldEqual, "joined")
+		So(status[0].Running, ShouldBeTrue)
+		So(status[1].Name, ShouldEqual, "test")
+		So(status[1].Running, ShouldBeFalse)
+
+		So(daemon.StopInstance("joined"), ShouldBeNil)
+		So(daemon.StopInstance("joined"), ShouldEqual, ErrInstanceNotRunning)
+	})
+
+	Convey("it should take commands on the control socket", t, func() {
+		resp, err := DaemonRequest(daemon.Path, DaemonCommand{Command: DaemonStart, Name: "joined"})
+		So(err, ShouldBeNil)
+		So(resp.OK, ShouldBeTrue)
+
+		resp, err = DaemonRequest(daemon.Path, DaemonCommand{Command: DaemonStatus, Name: "joined"})
+		So(err, ShouldBeNil)
+		So(resp.Status[0].Running, ShouldBeTrue)
+
+		resp, err = DaemonRequest(daemon.Path, DaemonCommand{Command: DaemonStop, Name: "joined"})
+		So(err, ShouldBeNil)
+
+		_, err = DaemonRequest(daemon.Path, DaemonCommand{Command: DaemonStop, Name: "joined"})
+		So(err.Error(), ShouldEqual, ErrInstanceNotRunning.Error())
+		_, err = DaemonRequest(daemon.Path, DaemonCommand{Command: "reboot", Name: "joined"})
+		So(err.Error(), ShouldEqual, ErrUnknownDaemonCommand.Error())
+		_, err = DaemonRequest(daemon.Path, DaemonCommand{Command: DaemonStart})
+		So(err.Error(), ShouldEqual, ErrMissingName.Error())
+	})
+
+	Convey("it should refuse names that aren't in the service directory", t, func() {
+		for _, name := range []string{"..", ".", "../test", "a/b"} {
+			_, err := DaemonRequest(daemon.Path, DaemonCommand{Command: DaemonStart, Name: name})
+			So(err.Error(), ShouldEqual, ErrBadHolochainName.Error())
+		}
+		So(daemon.Install("../joined", filepath.Join(s.Path, "test")), ShouldEqual, ErrBadHolochainName)
+	})
+
+	Convey("a second daemon should not take over the socket", t, func() {
+		err := NewDaemon(s).Start()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("stopping should close open connections", t, func() {
+		other := NewDaemon(s)
+		other.Path = filepath.Join(d, "other.sock")
+		So(other.Start(), ShouldBeNil)
+		conn, err := net.Dial("unix", other.Path)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		// let the daemon accept the connection before stopping
+		time.Sleep(100 * time.Millisecond)
+		stopped := make(chan error, 1)
+		go func() { stopped <- other.Stop() }()
+		select {
+		case err = <-stopped:
+			So(err, ShouldBeNil)
+		case <-time.After(5 * time.Second):
+			So("Stop hung", ShouldBeNil)
+		}
+	})
+}
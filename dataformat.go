@@ -0,0 +1,150 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// dataformat implements the binary data formats.  Entries of these formats are stored
+// and gossiped as bytes, a []byte for DataFormatBinary and CBOR for DataFormatCBOR, but
+// ribosomes and clients see them as strings: base64 for binary and JSON for CBOR.
+
+package holochain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"reflect"
+)
+
+var ErrBadEntryContent = errors.New("entry content doesn't match its data format")
+
+// CBOR is the content of an entry of DataFormatCBOR
+type CBOR []byte
+
+// cborHandle decodes CBOR maps as map[string]interface{} so that they can be encoded
+// as JSON and checked against JSON schemas
+var cborHandle = func() *codec.CborHandle {
+	h := &codec.CborHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}{})
+	return h
+}()
+
+// Value decodes the CBOR
+func (c CBOR) Value() (v interface{}, err error) {
+	err = codec.NewDecoderBytes(c, cborHandle).Decode(&v)
+	return
+}
+
+// MarshalJSON encodes the value of the CBOR as JSON
+func (c CBOR) MarshalJSON() ([]byte, error) {
+	v, err := c.Value()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// encodeEntryContent converts the content of an entry as given by an app into the form
+// it is stored in for the data format, leaving content already in that form alone
+func encodeEntryContent(format string, content interface{}) (c interface{}, err error) {
+	c = content
+	s, isStr := content.(string)
+	switch format {
+	case DataFormatBinary:
+		if isStr {
+			c, err = base64.StdEncoding.DecodeString(s)
+		}
+	case DataFormatCBOR:
+		if isStr {
+			var v interface{}
+			if err = json.Unmarshal([]byte(s), &v); err != nil {
+				return
+			}
+			var b []byte
+			if err = codec.NewEncoderBytes(&b, cborHandle).Encode(v); err == nil {
+				c = CBOR(b)
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrBadEntryContent, err)
+	}
+	return
+}
+
+// checkEntryContent returns an error if content isn't in the form stored for the data
+// format
+func checkEntryContent(format string, content interface{}) (err error) {
+	ok := true
+	switch format {
+	case DataFormatBinary:
+		_, ok = content.([]byte)
+	case DataFormatCBOR:
+		var c CBOR
+		if c, ok = content.(CBOR); ok {
+			_, err = c.Value()
+		}
+	}
+	if !ok || err != nil {
+		err = ErrBadEntryContent
+	}
+	return
+}
+
+// appEntry returns an entry got for an app with its content as the string apps see it
+// as, nil if there is no entry
+func appEntry(entry Entry) (e Entry, err error) {
+	if entry == nil {
+		return
+	}
+	var c string
+	if c, err = entryContentString(entry.Content()); err != nil {
+		return
+	}
+	e = &GobEntry{C: c}
+	return
+}
+
+// systemEntryContent returns the content of a system entry, which is always the string
+// of its encoded value
+func systemEntryContent(entry Entry) (c string, err error) {
+	c, ok := entry.Content().(string)
+	if !ok {
+		err = fmt.Errorf("%w: %T", ErrBadEntryContent, entry.Content())
+	}
+	return
+}
+
+// entryContentString returns the content of an entry as the string apps see it as
+func entryContentString(content interface{}) (s string, err error) {
+	switch c := content.(type) {
+	case string:
+		s = c
+	case []byte:
+		s = base64.StdEncoding.EncodeToString(c)
+	case CBOR:
+		var b []byte
+		if b, err = c.MarshalJSON(); err == nil {
+			s = string(b)
+		}
+	default:
+		err = fmt.Errorf("%w: %T", ErrBadEntryContent, content)
+	}
+	return
+}
+
+// formatEntry returns the entry an app is committing in the form it is stored in
+func (h *Holochain) formatEntry(entryType string, entry Entry) (formatted Entry, err error) {
+	formatted = entry
+	_, def, e := h.GetEntryDef(entryType)
+	if e != nil || (def.DataFormat != DataFormatBinary && def.DataFormat != DataFormatCBOR) {
+		return
+	}
+	var c interface{}
+	if c, err = encodeEntryContent(def.DataFormat, entry.Content()); err != nil {
+		return
+	}
+	formatted = &GobEntry{C: c}
+	return
+}
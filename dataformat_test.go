@@ -0,0 +1,95 @@
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEntryContent(t *testing.T) {
+	Convey("binary content should be decoded from base64", t, func() {
+		c, err := encodeEntryContent(DataFormatBinary, "aGVsbG8=")
+		So(err, ShouldBeNil)
+		So(c, ShouldResemble, []byte("hello"))
+		s, err := entryContentString(c)
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, "aGVsbG8=")
+
+		_, err = encodeEntryContent(DataFormatBinary, "not base64!")
+		So(errors.Is(err, ErrBadEntryContent), ShouldBeTrue)
+	})
+	Convey("CBOR content should be encoded from JSON", t, func() {
+		c, err := encodeEntryContent(DataFormatCBOR, `{"b":[1,2],"a":"x"}`)
+		So(err, ShouldBeNil)
+		So(checkEntryContent(DataFormatCBOR, c), ShouldBeNil)
+		s, err := entryContentString(c)
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, `{"a":"x","b":[1,2]}`)
+
+		_, err = encodeEntryContent(DataFormatCBOR, `{"a":`)
+		So(errors.Is(err, ErrBadEntryContent), ShouldBeTrue)
+	})
+	Convey("content not in the stored form should fail the check", t, func() {
+		So(checkEntryContent(DataFormatBinary, "aGVsbG8="), ShouldEqual, ErrBadEntryContent)
+		So(checkEntryContent(DataFormatCBOR, CBOR{0xff}), ShouldEqual, ErrBadEntryContent)
+		So(checkEntryContent(DataFormatString, "x"), ShouldBeNil)
+	})
+}
+
+func TestBinaryDataFormats(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	for i, z := range h.nucleus.dna.Zomes {
+		for j, e := range z.Entries {
+			switch e.Name {
+			case "secret":
+				h.nucleus.dna.Zomes[i].Entries[j].DataFormat = DataFormatBinary
+			case "profile":
+				h.nucleus.dna.Zomes[i].Entries[j].DataFormat = DataFormatCBOR
+			}
+		}
+	}
+
+	Convey("binary entries should be stored as bytes", t, func() {
+		hash := commit(h, "secret", "aGVsbG8=")
+		entry, _, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(entry.Content(), ShouldResemble, []byte("hello"))
+
+		_, err = NewCommitAction("secret", &GobEntry{C: "not base64!"}).Do(h)
+		So(errors.Is(err, ErrBadEntryContent), ShouldBeTrue)
+	})
+
+	Convey("CBOR entries should be stored as CBOR and checked against their schema", t, func() {
+		hash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+		entry, _, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		c, ok := entry.Content().(CBOR)
+		So(ok, ShouldBeTrue)
+		v, err := c.Value()
+		So(err, ShouldBeNil)
+		So(v, ShouldResemble, map[string]interface{}{"firstName": "Zippy", "lastName": "Pinhead"})
+
+		_, err = NewCommitAction("profile", &GobEntry{C: `{"firstName":"Zippy"}`}).Do(h)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("binary and CBOR entries should be got by apps as strings", t, func() {
+		secret := commit(h, "secret", "aGVsbG8=")
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = z.Run(fmt.Sprintf(`get("%s")`, secret.String()))
+		So(err, ShouldBeNil)
+		v, err := z.(*JSRibosome).lastResult.Export()
+		So(err, ShouldBeNil)
+		So(v.(Entry).Content(), ShouldEqual, "aGVsbG8=")
+
+		profile := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+		entry, _, err := h.chain.GetEntry(profile)
+		So(err, ShouldBeNil)
+		e, err := appEntry(entry)
+		So(err, ShouldBeNil)
+		So(e.Content(), ShouldContainSubstring, `"firstName":"Zippy"`)
+	})
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// dedup implements a short-lived cache of recently received messages so that copies of a
+// message arriving from several gossip partners at once are only processed once
+
+package holochain
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	DedupCacheSize = 1024             // number of message fingerprints remembered
+	DedupCacheTTL  = 10 * time.Second // how long a processed message is remembered
+)
+
+// dedupEntry is the result of processing a message, which is pending until done is closed
+type dedupEntry struct {
+	key      string
+	done     chan struct{}
+	response interface{}
+	err      error
+	expires  time.Time
+}
+
+// dedupCache is an LRU of message fingerprints and the results of processing them
+type dedupCache struct {
+	lk    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[string]*list.Element
+	order *list.List // most recently used first
+}
+
+func newDedupCache(size int, ttl time.Duration) *dedupCache {
+	return &dedupCache{size: size, ttl: ttl, items: make(map[string]*list.Element), order: list.New()}
+}
+
+// do calls fn to process the message with fingerprint key unless it has been processed
+// recently or is being processed, in which case it returns that result with dup set.
+// Failures aren't remembered so that the message can be retried.
+func (c *dedupCache) do(key string, fn func() (interface{}, error)) (response interface{}, err error, dup bool) {
+	c.lk.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*dedupEntry)
+		select {
+		case <-e.done:
+			if time.Now().Before(e.expires) {
+				c.order.MoveToFront(el)
+				c.lk.Unlock()
+				return e.response, e.err, true
+			}
+			c.remove(el)
+		default:
+			// a copy is being processed so wait for its result
+			c.lk.Unlock()
+			<-e.done
+			return e.response, e.err, true
+		}
+	}
+	e := &dedupEntry{key: key, done: make(chan struct{})}
+	c.items[key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	c.lk.Unlock()
+
+	response, err = fn()
+
+	c.lk.Lock()
+	e.response, e.err = response, err
+	e.expires = time.Now().Add(c.ttl)
+	if err != nil {
+		if el, ok := c.items[key]; ok && el.Value.(*dedupEntry) == e {
+			c.remove(el)
+		}
+	}
+	close(e.done)
+	c.lk.Unlock()
+	return
+}
+
+func (c *dedupCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*dedupEntry).key)
+}
@@ -0,0 +1,118 @@
+package holochain
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDedupCache(t *testing.T) {
+	Convey("it should only process a message once while it's remembered", t, func() {
+		c := newDedupCache(10, time.Minute)
+		calls := 0
+		fn := func() (interface{}, error) { calls++; return "ok", nil }
+		r, err, dup := c.do("a", fn)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, "ok")
+		So(dup, ShouldBeFalse)
+		r, err, dup = c.do("a", fn)
+		So(r, ShouldEqual, "ok")
+		So(dup, ShouldBeTrue)
+		So(calls, ShouldEqual, 1)
+		_, _, dup = c.do("b", fn)
+		So(dup, ShouldBeFalse)
+		So(calls, ShouldEqual, 2)
+	})
+
+	Convey("it should forget messages after the ttl", t, func() {
+		c := newDedupCache(10, time.Millisecond)
+		calls := 0
+		fn := func() (interface{}, error) { calls++; return nil, nil }
+		c.do("a", fn)
+		time.Sleep(5 * time.Millisecond)
+		_, _, dup := c.do("a", fn)
+		So(dup, ShouldBeFalse)
+		So(calls, ShouldEqual, 2)
+	})
+
+	Convey("it should forget the least recently used messages when full", t, func() {
+		c := newDedupCache(2, time.Minute)
+		fn := func() (interface{}, error) { return nil, nil }
+		c.do("a", fn)
+		c.do("b", fn)
+		c.do("a", fn)
+		c.do("c", fn)
+		So(c.order.Len(), ShouldEqual, 2)
+		_, _, dup := c.do("a", fn)
+		So(dup, ShouldBeTrue)
+		_, _, dup = c.do("b", fn)
+		So(dup, ShouldBeFalse)
+	})
+
+	Convey("it should not remember failures", t, func() {
+		c := newDedupCache(10, time.Minute)
+		calls := 0
+		fn := func() (interface{}, error) { calls++; return nil, errors.New("fail") }
+		_, err, _ := c.do("a", fn)
+		So(err.Error(), ShouldEqual, "fail")
+		_, _, dup := c.do("a", fn)
+		So(dup, ShouldBeFalse)
+		So(calls, ShouldEqual, 2)
+	})
+
+	Convey("copies arriving together should share the first's result", t, func() {
+		c := newDedupCache(10, time.Minute)
+		var lk sync.Mutex
+		calls := 0
+		fn := func() (interface{}, error) {
+			lk.Lock()
+			calls++
+			lk.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			return "ok", nil
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r, _, _ := c.do("a", fn)
+				if r != "ok" {
+					panic("wrong result")
+				}
+			}()
+		}
+		wg.Wait()
+		So(calls, ShouldEqual, 1)
+	})
+}
+
+func TestActionReceiverDedup(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	Convey("failed changes should be retried", t, func() {
+		m := h.node.NewMessage(LINK_REQUEST, LinkReq{Base: hash, Links: hash})
+		_, err := ActionReceiver(h, m)
+		So(err.Error(), ShouldEqual, "hash not found")
+		_, err = ActionReceiver(h, m)
+		So(err.Error(), ShouldEqual, "hash not found")
+	})
+
+	Convey("duplicate changes should get the first's response", t, func() {
+		e := GobEntry{C: "124"}
+		_, hd, _ := h.NewEntry(time.Unix(1, 1), "evenNumbers", &e)
+		m := h.node.NewMessage(PUT_REQUEST, PutReq{H: hd.EntryLink})
+		r, err := ActionReceiver(h, m)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, "queued")
+		f, _ := m.Fingerprint()
+		So(h.dht.dedup.items[f.String()], ShouldNotBeNil)
+		r, err = ActionReceiver(h, m)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, "queued")
+	})
+}
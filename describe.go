@@ -0,0 +1,68 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// describe implements read-only introspection of a holochain's zomes for client tooling
+
+package holochain
+
+import (
+	"encoding/json"
+)
+
+// Description holds a machine readable description of a holochain's interface
+type Description struct {
+	Name    string
+	DNAHash string
+	Version int
+	Zomes   []ZomeDescription
+}
+
+// ZomeDescription describes a zome's entry types and functions
+type ZomeDescription struct {
+	Name         string
+	Description  string
+	RibosomeType string
+	Entries      []EntryDescription
+	Functions    []FunctionDef
+}
+
+// EntryDescription describes an entry type.  Schema holds the parsed JSON schema if
+// the entry type has one.
+type EntryDescription struct {
+	Name       string
+	DataFormat string
+	Sharing    string
+	Schema     interface{} `json:",omitempty"`
+}
+
+// Describe returns a description of the holochain's zomes, entry types and functions
+func (h *Holochain) Describe() (d Description, err error) {
+	dna := h.nucleus.dna
+	d.Name = dna.Name
+	d.DNAHash = h.dnaHash.String()
+	d.Version = dna.Version
+	d.Zomes = make([]ZomeDescription, len(dna.Zomes))
+	for i, z := range dna.Zomes {
+		zd := ZomeDescription{
+			Name:         z.Name,
+			Description:  z.Description,
+			RibosomeType: z.RibosomeType,
+			Entries:      make([]EntryDescription, len(z.Entries)),
+			Functions:    make([]FunctionDef, len(z.Functions)),
+		}
+		copy(zd.Functions, z.Functions)
+		for j, e := range z.Entries {
+			ed := EntryDescription{Name: e.Name, DataFormat: e.DataFormat, Sharing: e.Sharing}
+			if e.Schema != "" {
+				err = json.Unmarshal([]byte(e.Schema), &ed.Schema)
+				if err != nil {
+					return
+				}
+			}
+			zd.Entries[j] = ed
+		}
+		d.Zomes[i] = zd
+	}
+	return
+}
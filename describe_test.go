@@ -0,0 +1,39 @@
+package holochain
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("it should describe the zomes", t, func() {
+		desc, err := h.Describe()
+		So(err, ShouldBeNil)
+		So(desc.DNAHash, ShouldEqual, h.DNAHash().String())
+		So(len(desc.Zomes), ShouldEqual, 2)
+
+		z := desc.Zomes[0]
+		So(z.Name, ShouldEqual, "zySampleZome")
+		So(z.RibosomeType, ShouldEqual, ZygoRibosomeType)
+		So(z.Functions[1], ShouldResemble, FunctionDef{Name: "addEven", CallingType: STRING_CALLING, Exposure: PUBLIC_EXPOSURE})
+
+		So(z.Entries[0].Name, ShouldEqual, "evenNumbers")
+		So(z.Entries[0].Schema, ShouldBeNil)
+		So(z.Entries[1].Name, ShouldEqual, "primes")
+		So(z.Entries[1].DataFormat, ShouldEqual, DataFormatJSON)
+		So(z.Entries[1].Sharing, ShouldEqual, Public)
+		schema := z.Entries[1].Schema.(map[string]interface{})
+		So(schema["type"], ShouldEqual, "object")
+	})
+
+	Convey("the description should be JSON encodable", t, func() {
+		desc, _ := h.Describe()
+		b, err := json.Marshal(desc)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, `"Name":"addEven","CallingType":"string","Exposure":"public"`)
+	})
+}
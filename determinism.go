@@ -0,0 +1,112 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// determinism implements the host functions that let javascript validation give the
+// same result on every node, HC.time() and HC.rand(seed), and the zome's strict
+// validation mode, in which the javascript globals that differ from node to node throw
+// while validating
+
+package holochain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/robertkrimen/otto"
+	"time"
+)
+
+var ErrStrictValidationUnsupported = errors.New("strict validation is only supported for javascript zomes")
+
+// jsStrictToggle evaluates to a function that swaps out Date and Math.random for ones
+// that throw, or back.  Date stays usable with explicit arguments, so that times from
+// headers can still be parsed.
+const jsStrictToggle = `(function(D,random){
+var nondeterministic=function(what){return function(){throw new Error(what+" is nondeterministic in validation, use HC.time() or HC.rand(seed)")}};
+var S=function(a,b,c,d,e,f,g){
+if(!(this instanceof S)||arguments.length==0){nondeterministic("Date")()}
+switch(arguments.length){
+case 1:return new D(a);case 2:return new D(a,b);case 3:return new D(a,b,c);
+case 4:return new D(a,b,c,d);case 5:return new D(a,b,c,d,e);case 6:return new D(a,b,c,d,e,f);
+default:return new D(a,b,c,d,e,f,g)}};
+S.prototype=D.prototype;S.UTC=D.UTC;S.parse=D.parse;S.now=nondeterministic("Date.now");
+var strictRandom=nondeterministic("Math.random");
+return function(on){Date=on?S:D;Math.random=on?strictRandom:random}
+})(Date,Math.random)`
+
+// hcRand returns a pseudo-random number in [0,1) that is always the same for a seed
+func hcRand(seed string) float64 {
+	sum := sha256.Sum256([]byte(seed))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
+
+// addHostFunctions adds HC.time and HC.rand to the HC object of the javascript library
+func (jsr *JSRibosome) addHostFunctions() (err error) {
+	hc, err := jsr.vm.Get("HC")
+	if err != nil {
+		return
+	}
+	err = hc.Object().Set("time", func(call otto.FunctionCall) otto.Value {
+		t := time.Now()
+		if jsr.validating {
+			if jsr.validationHeader == nil {
+				return otto.NullValue()
+			}
+			t = jsr.validationHeader.Time
+		}
+		v, _ := jsr.vm.ToValue(t.UnixNano() / int64(time.Millisecond))
+		return v
+	})
+	if err != nil {
+		return
+	}
+	err = hc.Object().Set("rand", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 {
+			return mkOttoErr(jsr, &wrappedError{msg: "HC.rand() expects (seed)", err: ErrInvalidArgs})
+		}
+		seed, err := call.Argument(0).ToString()
+		if err != nil {
+			return mkOttoErr(jsr, err)
+		}
+		v, _ := jsr.vm.ToValue(hcRand(seed))
+		return v
+	})
+	return
+}
+
+// validation sets up for calling a validation function for the action, making the
+// nondeterministic globals throw if the zome validates strictly, and returns the
+// function that puts things back
+func (jsr *JSRibosome) validation(action Action) (done func() error, err error) {
+	strict := jsr.zome.StrictValidation
+	if strict {
+		if !jsr.strictToggle.IsFunction() {
+			if jsr.strictToggle, err = jsr.vm.Run(jsStrictToggle); err != nil {
+				return
+			}
+		}
+		if _, err = jsr.strictToggle.Call(otto.NullValue(), true); err != nil {
+			return
+		}
+	}
+	jsr.validating, jsr.validationHeader = true, nil
+	if a, ok := action.(ValidatingAction); ok {
+		jsr.validationHeader = validatedHeader(a)
+	}
+	done = func() (err error) {
+		jsr.validating, jsr.validationHeader = false, nil
+		if strict {
+			_, err = jsr.strictToggle.Call(otto.NullValue(), false)
+		}
+		return
+	}
+	return
+}
+
+// validated calls done and keeps its error in err unless err is already set
+func validated(done func() error, err *error) {
+	if e := done(); e != nil && *err == nil {
+		*err = e
+	}
+}
@@ -0,0 +1,113 @@
+package holochain
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestHCRand(t *testing.T) {
+	Convey("it should return the same number for a seed", t, func() {
+		r := hcRand("seed")
+		So(r, ShouldEqual, hcRand("seed"))
+		So(r, ShouldBeGreaterThanOrEqualTo, 0)
+		So(r, ShouldBeLessThan, 1)
+		So(hcRand("other seed"), ShouldNotEqual, r)
+	})
+
+	Convey("it should be available to javascript", t, func() {
+		v, err := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType, Code: `HC.rand("seed")`})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		f, _ := z.lastResult.ToFloat()
+		So(f, ShouldEqual, hcRand("seed"))
+
+		_, err = z.Run(`HC.rand().code`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, ErrorCodeInvalidArgs)
+	})
+}
+
+func TestJSValidationDeterminism(t *testing.T) {
+	hd := &Header{Type: "evenNumbers", Time: time.Unix(1500000000, 0)}
+	action := NewPutAction("evenNumbers", &GobEntry{C: "2"}, hd)
+
+	Convey("HC.time() should be the current time outside validation", t, func() {
+		v, err := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType, Code: `HC.time()`})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		ms, _ := z.lastResult.ToInteger()
+		So(time.Since(time.Unix(0, ms*int64(time.Millisecond))), ShouldBeLessThan, time.Minute)
+	})
+
+	Convey("HC.time() should be the header's time in validation", t, func() {
+		v, err := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		done, err := z.validation(action)
+		So(err, ShouldBeNil)
+		_, err = z.Run(`HC.time()`)
+		So(err, ShouldBeNil)
+		ms, _ := z.lastResult.ToInteger()
+		So(ms, ShouldEqual, int64(1500000000000))
+
+		// globals should be left alone without strict validation
+		_, err = z.Run(`Date.now()+Math.random()`)
+		So(err, ShouldBeNil)
+		done()
+
+		done, err = z.validation(NewDelAction("evenNumbers", DelEntry{}))
+		So(err, ShouldBeNil)
+		_, err = z.Run(`HC.time()`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.IsNull(), ShouldBeTrue)
+		done()
+	})
+
+	Convey("strict validation should make nondeterministic globals throw", t, func() {
+		v, err := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType, StrictValidation: true})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		done, err := z.validation(action)
+		So(err, ShouldBeNil)
+		for _, code := range []string{`Date.now()`, `new Date()`, `Date()`, `Math.random()`} {
+			_, err = z.Run(code)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "nondeterministic in validation")
+		}
+		_, err = z.Run(`new Date(1500000000000).getTime()`)
+		So(err, ShouldBeNil)
+		ms, _ := z.lastResult.ToInteger()
+		So(ms, ShouldEqual, int64(1500000000000))
+		_, err = z.Run(`new Date(2017,6,14) instanceof Date`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "true")
+		done()
+
+		_, err = z.Run(`new Date().getTime()+Date.now()+Math.random()`)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("strict validation should apply to package validators", t, func() {
+		v, err := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType, StrictValidation: true,
+			Code: `function validateCommitPkg(entry_type) {Math.random(); return null}`})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		_, err = z.ValidatePackagingRequest(NewCommitAction("evenNumbers", &GobEntry{C: "2"}), &EntryDef{Name: "evenNumbers"})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "nondeterministic in validation")
+
+		// and be switched off again afterwards
+		_, err = z.Run(`Math.random()`)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("strict validation should only be allowed for javascript zomes", t, func() {
+		dna := DNA{Zomes: []Zome{{Name: "z", RibosomeType: JSRibosomeType, StrictValidation: true}}}
+		So(dna.check(), ShouldBeNil)
+		dna.Zomes[0].RibosomeType = ZygoRibosomeType
+		err := dna.check()
+		So(errors.Is(err, ErrStrictValidationUnsupported), ShouldBeTrue)
+	})
+}
@@ -7,20 +7,35 @@
 package holochain
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/tidwall/buntdb"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Holds the dht configuration options
 type DHTConfig struct {
-	// HashType : (string) Identifies hash type to be used for this application. Should be from the list of hash types from the multihash library
+	// HashType : (string) Identifies hash type to be used for this application, i.e. "sha2-256" or "blake2b-256". Should be from the list of hash types from the multihash library
 	HashType string
 
+	// ValidationQuorum : (integer) Number of holders other than the author that must validate a put before it goes from Pending to Live. Zero or one means puts go live as soon as they are validated. Only applies when sharding with a ResilienceFactor, as it is the hash's neighborhood that validates it.
+	ValidationQuorum int
+
+	// SigAlgorithms : ([]string) Names the signature algorithms that headers may be signed with, i.e. "ed25519". Defaults to ed25519 only. Headers signed with any other algorithm are rejected in validation.
+	SigAlgorithms []string
+
+	// ResilienceFactor : (integer) Number of nodes nearest to a hash in the keyspace that hold its entry, links and the rest of its DHT data. Zero means no sharding, every node holds everything.
+	ResilienceFactor int
+
 	// NeighborhoodSize : (integer) Establishes minimum online redundancy targets for data, and size of peer sets for sync gossip. A neighborhood size of ZERO means no sharding (every node syncs all data with every other node). ONE means you are running this as a centralized application and gossip is turned OFF. For most applications we recommend neighborhoods no smaller than 8 for nearness or 32 for hashmask sharding.
 
 	// ShardingMethod : Identifier for sharding method (none, XOR, hashmask, other nearness algorithms?, etc.)
@@ -44,6 +59,12 @@ type gossipWithReq struct {
 
 // DHT struct holds the data necessary to run the distributed hash table
 type DHT struct {
+	// accessed atomically so kept first for alignment
+	lastGossip     int64 // UnixNano of when the gossip loop last ran, 0 if it isn't running
+	gossipInterval int64 // the interval of the gossip loop
+	storedBytes    int64 // bytes of entry data in the store
+	quotaWarned    int32 // set while the store is over the quota warning level
+
 	h         *Holochain // pointer to the holochain this DHT is part of
 	db        *buntdb.DB
 	puts      chan Message
@@ -52,6 +73,31 @@ type DHT struct {
 	dlog      *Logger // the dht logger
 	gossips   map[peer.ID]bool
 	gchan     chan gossipWithReq
+	dedup     *dedupCache // recently received changes
+	entries   *entryCache // recently read entries
+	// peers found running a different DNA
+	forks   map[peer.ID]ForkedPeer
+	foreign map[peer.ID]bool
+	forksLk sync.Mutex
+	// closed to stop sweeping expired entries
+	stopExpiry chan struct{}
+	// set atomically when on the low power profile
+	lowPower int32
+	// closed when the DHT resumes after being suspended, and whether the expiry sweep
+	// was running when it was
+	suspended chan struct{}
+	sweeping  bool
+	powerLk   sync.Mutex
+	// closed to stop pinging gossipers
+	stopKeepAlive chan struct{}
+	// closed to stop recording metrics snapshots
+	stopMetrics chan struct{}
+	// what decides which received messages are acted on, nil for all of them
+	acceptPolicy AcceptPolicy
+	policyLk     sync.RWMutex
+	// corrupt records being refetched in the background
+	refetching map[string]bool
+	refetchLk  sync.Mutex
 }
 
 // Meta holds data that can be associated with a hash
@@ -65,9 +111,10 @@ type Meta struct {
 const (
 	// constants for status action type
 
-	AddAction = ""
-	ModAction = "m"
-	DelAction = "d"
+	AddAction    = ""
+	ModAction    = "m"
+	DelAction    = "d"
+	StatusAction = "s"
 
 	// constants for the state of the data, they are bit flags
 
@@ -76,7 +123,12 @@ const (
 	StatusRejected = 0x02
 	StatusDeleted  = 0x04
 	StatusModified = 0x08
-	StatusAny      = 0xFF
+	StatusPending  = 0x10
+	StatusExpired  = 0x20
+	// StatusAny matches every status including the ones a DNA declares (see
+	// StatusCustom).  It was 0xFF before DNAs could declare statuses, and a mask of
+	// 0xFF still matches all the system statuses but none of the declared ones.
+	StatusAny = 0xFFFF
 
 	// constants for the stored string status values in buntdb and for building code
 
@@ -84,7 +136,9 @@ const (
 	StatusRejectedVal = "2"
 	StatusDeletedVal  = "4"
 	StatusModifiedVal = "8"
-	StatusAnyVal      = "255"
+	StatusPendingVal  = "16"
+	StatusExpiredVal  = "32"
+	StatusAnyVal      = "65535"
 
 	// constants for system reseved tags (start with 2 underscores)
 
@@ -96,6 +150,9 @@ const (
 	GetMaskEntry     = 0x01
 	GetMaskEntryType = 0x02
 	GetMaskSources   = 0x04
+	GetMaskHistory   = 0x08
+	GetMaskMeta      = 0x10
+	GetMaskHeader    = 0x20
 	GetMaskAll       = 0xFF
 
 	// constants for building code for GetMask
@@ -104,6 +161,9 @@ const (
 	GetMaskEntryStr     = "1"
 	GetMaskEntryTypeStr = "2"
 	GetMaskSourcesStr   = "4"
+	GetMaskHistoryStr   = "8"
+	GetMaskMetaStr      = "16"
+	GetMaskHeaderStr    = "32"
 	GetMaskAllStr       = "255"
 )
 
@@ -127,6 +187,36 @@ type GetResp struct {
 	EntryType  string
 	Sources    []string
 	FollowHash string // hash of new entry if the entry was modified and needs following
+	History    []StatusHistory
+	Meta       map[string]string // app-defined values from the header of the entry
+	// Header is set when the hash got was of a header rather than an entry, the rest of
+	// the response then being about the entry it points to
+	Header *Header
+}
+
+// StatusHistory records a single change of status of a hash on the DHT
+type StatusHistory struct {
+	Time        time.Time
+	Status      int
+	Fingerprint string // fingerprint of the message that caused the change
+}
+
+// ReceiptReq holds the hash of a put that a holder validated, signed by the holder as
+// receipts are passed on by gossip
+type ReceiptReq struct {
+	H   Hash
+	Key []byte    // the holder's marshaled public key
+	Sig Signature // the holder's signature of the hash
+}
+
+// HeadersReq holds a request for all the headers published by a source
+type HeadersReq struct {
+	Source peer.ID
+}
+
+// HeadersResp holds the headers returned for a HeadersReq
+type HeadersResp struct {
+	Headers []Header
 }
 
 // DelReq holds the data of a del request
@@ -145,6 +235,9 @@ type ModReq struct {
 type LinkReq struct {
 	Base  Hash // data on which to attach the links
 	Links Hash // hash of the links entry
+	// Reverse is set on the request to the node holding the links' target, which is
+	// then in Base, so that it indexes the backlinks
+	Reverse bool
 }
 
 // DelLinkReq holds a delete link request
@@ -159,21 +252,31 @@ type LinkQuery struct {
 	Base       Hash
 	T          string
 	StatusMask int
+	Reverse    bool   // query the bases that link to Base instead of its links
+	Limit      int    // maximum number of links to return, 0 for all of them
+	Cursor     string // where the page of links starts, from LinkQueryResp.Next
+	Count      bool   // answer with the number of links instead of the links
+	SortBy     string // order of the links, LinkSortTime or LinkSortKey, "-" prefixed for descending
+	Target     string // only count the link to this hash
 	// order
 	// filter, etc
 }
 
 // GetOptions options to holochain level Get functions
 type GetOptions struct {
-	StatusMask int  // mask of which status of entries to return
-	GetMask    int  // mask of what to include in the response
-	Local      bool // bool if get should happen from chain not DHT
+	StatusMask int    // mask of which status of entries to return
+	GetMask    int    // mask of what to include in the response
+	Local      bool   // bool if get should happen from chain not DHT
+	Token      string // capability token for reading an encrypted entry
 }
 
 // GetLinkOptions options to holochain level GetLink functions
 type GetLinkOptions struct {
-	Load       bool // indicates whether GetLink should retrieve the entries of all links
-	StatusMask int  // mask of which status of links to return
+	Load       bool   // indicates whether GetLink should retrieve the entries of all links
+	StatusMask int    // mask of which status of links to return
+	Limit      int    // maximum number of links to return, 0 for all of them
+	Cursor     string // the Next cursor of the previous page of links
+	SortBy     string // order of the links, LinkSortTime or LinkSortKey, "-" prefixed for descending
 }
 
 // TaggedHash holds associated entries for the LinkQueryResponse
@@ -185,37 +288,95 @@ type TaggedHash struct {
 // LinkQueryResp holds response to getLink query
 type LinkQueryResp struct {
 	Links []TaggedHash
+	// Next is the cursor for the page after a limited query, empty after the last page
+	Next string `json:",omitempty"`
+	// Count is the number of links for a count query
+	Count int `json:",omitempty"`
+	// Error is why the query failed when it was one of several in a LinksQuery
+	Error string `json:",omitempty"`
+}
+
+// LinksQuery holds several link queries for bases that a node holds
+type LinksQuery struct {
+	Queries []LinkQuery
+}
+
+// LinksQueryResp holds the responses to a LinksQuery in the order of its queries
+type LinksQueryResp struct {
+	Results []LinkQueryResp
 }
 
 var ErrLinkNotFound = errors.New("link not found")
+var ErrLinkDeleted = errors.New("link deleted")
 var ErrHashDeleted = errors.New("hash deleted")
 var ErrHashModified = errors.New("hash modified")
 var ErrHashRejected = errors.New("hash rejected")
+var ErrHashPending = errors.New("hash pending")
+var ErrHashExpired = errors.New("hash expired")
+var ErrNegativeTTL = errors.New("entry TTL can't be negative")
+var ErrNegativeResilienceFactor = errors.New("resilience factor can't be negative")
+var ErrNotHolder = errors.New("receipt from a node that doesn't hold the hash")
+var ErrBadReceipt = errors.New("receipt not signed by its holder")
+
+// ExpiryCheckInterval is how often holders look for entries that have expired
+var ExpiryCheckInterval = time.Minute
 
 var ErrEntryTypeMismatch = errors.New("entry type mismatch")
+var ErrEntryLinkMismatch = errors.New("header entry link doesn't match entry")
+var ErrNotEphemeral = errors.New("entry type requires a one-time key signature")
+
+var ErrCorruptRecord = errors.New("corrupt record")
 
 // NewDHT creates a new DHT structure
-func NewDHT(h *Holochain) *DHT {
+// dhtIndexes are the indexes of the DHT's database
+var dhtIndexes = []struct {
+	name    string
+	pattern string
+	less    func(a, b string) bool
+}{
+	{"link", "link:*", buntdb.IndexString},
+	{"idx", "idx:*", buntdb.IndexInt},
+	{"peer", "peer:*", buntdb.IndexString},
+	{"gstats", "gstats:*", buntdb.IndexString},
+	{"header", "header:*", buntdb.IndexString},
+}
+
+// NewDHT opens the DHT store of a holochain
+func NewDHT(h *Holochain) (d *DHT, err error) {
 	dht := DHT{
 		h:    h,
 		glog: &h.config.Loggers.Gossip,
 		dlog: &h.config.Loggers.DHT,
 	}
-	db, err := buntdb.Open(filepath.Join(h.DBPath(), DHTStoreFileName))
+	var db *buntdb.DB
+	db, err = buntdb.Open(filepath.Join(h.DBPath(), DHTStoreFileName))
 	if err != nil {
-		panic(err)
+		return
+	}
+	for _, i := range dhtIndexes {
+		db.CreateIndex(i.name, i.pattern, i.less)
 	}
-	db.CreateIndex("link", "link:*", buntdb.IndexString)
-	db.CreateIndex("idx", "idx:*", buntdb.IndexInt)
-	db.CreateIndex("peer", "peer:*", buntdb.IndexString)
 
 	dht.db = db
+	dht.storedBytes, err = dht.countStoredBytes()
+	if err != nil {
+		db.Close()
+		return
+	}
+	registerOpen(h)
 	dht.puts = make(chan Message, 10)
 
 	dht.gossips = make(map[peer.ID]bool)
+	dht.forks = make(map[peer.ID]ForkedPeer)
+	dht.foreign = make(map[peer.ID]bool)
+	dht.refetching = make(map[string]bool)
 	dht.gchan = make(chan gossipWithReq, 10)
+	dht.dedup = newDedupCache(DedupCacheSize, DedupCacheTTL)
+	dht.entries = newEntryCache(EntryCacheSize)
+	dht.setLowPower(h.config.PowerProfile == PowerProfileLow)
 
-	return &dht
+	d = &dht
+	return
 }
 
 // SetupDHT prepares a DHT for use by putting the genesis entries that are added by GenChain
@@ -258,7 +419,104 @@ func (dht *DHT) SetupDHT() (err error) {
 	if err = dht.put(dht.h.node.NewMessage(PUT_REQUEST, PutReq{H: a}), AgentEntryType, a, dht.h.nodeID, b, StatusLive); err != nil {
 		return
 	}
+	if err = dht.linkKeyAgent(kh, a.String()); err != nil {
+		return
+	}
+
+	// record the genesis headers so the chain can be regenerated from the DHT
+	genesis := dht.h.chain.Headers
+	if len(genesis) > 2 {
+		genesis = genesis[:2]
+	}
+	for _, hd := range genesis {
+		if err = dht.putHeader(dht.h.nodeID, hd); err != nil {
+			return
+		}
+	}
+
+	return
+}
 
+// putHeader stores a header published by src so that the source's chain can later
+// be regenerated from the DHT
+func (dht *DHT) putHeader(src peer.ID, hd *Header) (err error) {
+	var rec headerRecord
+	if rec, err = dht.headerRecord(src, hd); err != nil {
+		return
+	}
+	err = dht.update(func(tx *buntdb.Tx) error {
+		return _putHeader(tx, rec)
+	})
+	return
+}
+
+// headerRecord is a header as it is stored
+type headerRecord struct {
+	key  string
+	data string
+}
+
+// headerRecord returns the record of a header published by src
+func (dht *DHT) headerRecord(src peer.ID, hd *Header) (rec headerRecord, err error) {
+	var hash Hash
+	var b []byte
+	if hash, b, err = hd.Sum(dht.h.hashSpec); err != nil {
+		return
+	}
+	dht.dlog.Logf("putHeader %s from %v", hash, src)
+	rec = headerRecord{key: "header:" + peer.IDB58Encode(src) + ":" + hash.String(), data: string(b)}
+	return
+}
+
+// _putHeader stores a header record
+func _putHeader(tx *buntdb.Tx, rec headerRecord) (err error) {
+	_, _, err = tx.Set(rec.key, rec.data, nil)
+	return
+}
+
+// getHeader returns a header we hold by its hash, whoever published it
+func (dht *DHT) getHeader(key Hash) (hd *Header, err error) {
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var val string
+		found := false
+		err := tx.AscendKeys("header:*:"+key.String(), func(key, value string) bool {
+			val, found = value, true
+			return false
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrHashNotFound
+		}
+		hd = &Header{}
+		return hd.Unmarshal([]byte(val), 34)
+	})
+	return
+}
+
+// getHeaders returns all the headers we hold that were published by src
+func (dht *DHT) getHeaders(src peer.ID) (headers []Header, err error) {
+	prefix := "header:" + peer.IDB58Encode(src) + ":"
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		err := tx.Ascend("header", func(key, value string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return true
+			}
+			var hd Header
+			e = hd.Unmarshal([]byte(value), 34)
+			if e != nil {
+				return false
+			}
+			headers = append(headers, hd)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
 	return
 }
 
@@ -267,27 +525,376 @@ func (dht *DHT) SetupDHT() (err error) {
 func (dht *DHT) put(m *Message, entryType string, key Hash, src peer.ID, value []byte, status int) (err error) {
 	k := key.String()
 	dht.dlog.Logf("put %s=>%s", k, string(value))
-	err = dht.db.Update(func(tx *buntdb.Tx) error {
-		_, err := incIdx(tx, m)
-		if err != nil {
-			return err
+	err = dht.updateStored(func(tx *buntdb.Tx) (size int64, err error) {
+		var freed int64
+		if freed, err = dht._makeRoom(tx, src, k, int64(len(value))); err != nil {
+			return
 		}
-		_, _, err = tx.Set("entry:"+k, string(value), nil)
+		size, err = _put(tx, m, entryType, k, src, value, status)
+		size -= freed
+		return
+	})
+	return
+}
+
+// _put stores a value at a key, returning by how much it changed the size of the
+// stored entries
+func _put(tx *buntdb.Tx, m *Message, entryType string, k string, src peer.ID, value []byte, status int) (size int64, err error) {
+	if _, err = incIdx(tx, m); err != nil {
+		return
+	}
+	size = int64(len(value))
+	if old, e := tx.Get("entry:" + k); e == nil {
+		size -= int64(len(old))
+	}
+	if _, _, err = tx.Set("entry:"+k, string(value), nil); err != nil {
+		return
+	}
+	var sum string
+	if sum, err = recordSum(value); err != nil {
+		return
+	}
+	if _, _, err = tx.Set("sum:"+k, sum, nil); err != nil {
+		return
+	}
+	if _, _, err = tx.Set("type:"+k, entryType, nil); err != nil {
+		return
+	}
+	if _, _, err = tx.Set("src:"+k, peer.IDB58Encode(src), nil); err != nil {
+		return
+	}
+	if _, _, err = tx.Set("status:"+k, fmt.Sprintf("%d", status), nil); err != nil {
+		return
+	}
+	err = _recordStatus(tx, m, k, status)
+	return
+}
+
+// countStoredBytes returns the total size of the entry data in the store
+func (dht *DHT) countStoredBytes() (n int64, err error) {
+	err = dht.view(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, value string) bool {
+			if strings.HasPrefix(key, "entry:") {
+				n += int64(len(value))
+			}
+			return true
+		})
+	})
+	return
+}
+
+// _recordStatus appends a status change to the history of a hash
+func _recordStatus(tx *buntdb.Tx, m *Message, key string, status int) (err error) {
+	var history []StatusHistory
+	history, err = _getHistory(tx, key)
+	if err != nil {
+		return
+	}
+	sh := StatusHistory{Status: status}
+	if m != nil {
+		var f Hash
+		f, err = m.Fingerprint()
 		if err != nil {
-			return err
+			return
+		}
+		sh.Fingerprint = f.String()
+		sh.Time = m.Time
+	} else {
+		sh.Time = time.Now()
+	}
+	history = append(history, sh)
+	var b []byte
+	b, err = json.Marshal(history)
+	if err != nil {
+		return
+	}
+	_, _, err = tx.Set("history:"+key, string(b), nil)
+	return
+}
+
+func _getHistory(tx *buntdb.Tx, key string) (history []StatusHistory, err error) {
+	var val string
+	val, err = tx.Get("history:" + key)
+	if err == buntdb.ErrNotFound {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(val), &history)
+	return
+}
+
+// putMeta records the header meta that came with a hash.  Only the first meta is
+// kept, as that is what the original author committed.
+func (dht *DHT) putMeta(key Hash, meta map[string]string) (err error) {
+	var b []byte
+	b, err = json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	err = dht.update(func(tx *buntdb.Tx) error {
+		return _putMeta(tx, key.String(), string(b))
+	})
+	return
+}
+
+// _putMeta records the header meta of a hash unless it already has some
+func _putMeta(tx *buntdb.Tx, k string, meta string) (err error) {
+	_, err = tx.Get("meta:" + k)
+	if err != buntdb.ErrNotFound {
+		return
+	}
+	_, _, err = tx.Set("meta:"+k, meta, nil)
+	return
+}
+
+// getMeta returns the header meta recorded for a hash, or nil if there isn't any
+func (dht *DHT) getMeta(key Hash) (meta map[string]string, err error) {
+	err = dht.view(func(tx *buntdb.Tx) error {
+		val, err := tx.Get("meta:" + key.String())
+		if err == buntdb.ErrNotFound {
+			return nil
 		}
-		_, _, err = tx.Set("type:"+k, entryType, nil)
 		if err != nil {
 			return err
 		}
-		_, _, err = tx.Set("src:"+k, peer.IDB58Encode(src), nil)
+		return json.Unmarshal([]byte(val), &meta)
+	})
+	return
+}
+
+// quorum returns the number of holder validations a put needs before it goes live,
+// which is none without sharding as then there are no holders to validate it
+func (dht *DHT) quorum() int {
+	if dht.resilienceFactor() <= 0 {
+		return 0
+	}
+	return dht.h.nucleus.dna.DHTConfig.ValidationQuorum
+}
+
+// newReceipt returns our receipt for having validated the put of the hash
+func (h *Holochain) newReceipt(hash Hash) (r ReceiptReq, err error) {
+	r.H = hash
+	if r.Key, err = ic.MarshalPublicKey(h.agent.PubKey()); err != nil {
+		return
+	}
+	r.Sig, err = Sign(h.agent.PrivKey(), hash.H)
+	return
+}
+
+// receiptHolder returns the holder that signed a receipt
+func (h *Holochain) receiptHolder(r ReceiptReq) (holder peer.ID, err error) {
+	var pub ic.PubKey
+	if pub, err = ic.UnmarshalPublicKey(r.Key); err != nil {
+		err = fmt.Errorf("%w: %w", ErrBadReceipt, err)
+		return
+	}
+	if err = h.CheckSigAlgorithm(r.Sig.A); err != nil {
+		return
+	}
+	var valid bool
+	if valid, err = r.Sig.Verify(pub, r.H.H); err != nil || !valid {
+		err = ErrBadReceipt
+		return
+	}
+	holder, err = peer.IDFromPublicKey(pub)
+	return
+}
+
+// receipt records that the holder that signed the receipt in m validated the put of
+// the hash in it, and moves the hash from Pending to Live if that makes enough
+// validations.  Receipts are recorded in the gossip index so they reach the other
+// holders.  Only receipts from nodes in the hash's neighborhood are accepted.
+func (dht *DHT) receipt(m *Message) (err error) {
+	t := m.Body.(ReceiptReq)
+	var holder peer.ID
+	if holder, err = dht.h.receiptHolder(t); err != nil {
+		return
+	}
+	if !dht.isHolder(t.H, holder) {
+		err = ErrNotHolder
+		return
+	}
+	err = dht.update(func(tx *buntdb.Tx) error {
+		return _receipt(tx, m, t.H.String(), holder, dht.quorum())
+	})
+	return
+}
+
+// _receipt records the receipt in m of the holder for the hash k and promotes the
+// hash if that makes a quorum
+func _receipt(tx *buntdb.Tx, m *Message, k string, holder peer.ID, quorum int) (err error) {
+	rk := "receipt:" + k + ":" + peer.IDB58Encode(holder)
+	_, err = tx.Get(rk)
+	if err == buntdb.ErrNotFound {
+		if _, err = incIdx(tx, m); err != nil {
+			return
+		}
+		_, _, err = tx.Set(rk, m.Time.Format(time.RFC3339), nil)
+	}
+	if err != nil {
+		return
+	}
+	err = _promote(tx, m, k, quorum)
+	return
+}
+
+// _promote moves a Pending hash to Live if it has receipts from at least quorum
+// holders other than its source
+func _promote(tx *buntdb.Tx, m *Message, k string, quorum int) (err error) {
+	var status string
+	status, err = tx.Get("status:" + k)
+	if err == buntdb.ErrNotFound {
+		// we don't have the put yet, the receipts will be counted when it arrives
+		err = nil
+		return
+	}
+	if err != nil || status != StatusPendingVal {
+		return
+	}
+	var src string
+	src, err = tx.Get("src:" + k)
+	if err != nil {
+		return
+	}
+	prefix := "receipt:" + k + ":"
+	count := 0
+	err = tx.AscendKeys(prefix+"*", func(key, value string) bool {
+		if key[len(prefix):] != src {
+			count++
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	if count >= quorum {
+		// the receipt is already in the gossip index so this doesn't add to it
+		_, _, err = tx.Set("status:"+k, StatusLiveVal, nil)
+		if err == nil {
+			err = _recordStatus(tx, m, k, StatusLive)
+		}
+	}
+	return
+}
+
+// putExpiry records when an entry expires if its type has a TTL.  The time comes from
+// the entry's signed header rather than when it arrived so that all holders agree on it.
+func (dht *DHT) putExpiry(key Hash, entryType string, committed time.Time) (err error) {
+	var expires time.Time
+	if expires, err = dht.expiry(entryType, committed); err != nil || expires.IsZero() {
+		return
+	}
+	err = dht.update(func(tx *buntdb.Tx) error {
+		return _putExpiry(tx, key.String(), expires)
+	})
+	return
+}
+
+// expiry returns when an entry of the type committed at the given time expires, the
+// zero time if its type has no TTL
+func (dht *DHT) expiry(entryType string, committed time.Time) (expires time.Time, err error) {
+	if IsSystemEntryType(entryType) {
+		return
+	}
+	var def *EntryDef
+	if _, def, err = dht.h.GetEntryDef(entryType); err != nil {
+		return
+	}
+	if def.TTL != 0 {
+		expires = committed.Add(time.Duration(def.TTL) * time.Second)
+	}
+	return
+}
+
+// _putExpiry records when the hash k expires
+func _putExpiry(tx *buntdb.Tx, k string, expires time.Time) (err error) {
+	_, _, err = tx.Set("expires:"+k, fmt.Sprintf("%d", expires.UnixNano()), nil)
+	return
+}
+
+// _expired returns whether a hash with the given status has passed its expiry time.
+// Hashes in a status the DNA declares expire like live ones, deleted and rejected
+// hashes stay as they are, and pinned ones never expire.
+func _expired(tx *buntdb.Tx, k string, statusVal string, now time.Time) bool {
+	status, err := strconv.Atoi(statusVal)
+	if err != nil || status&(StatusLive|StatusModified|StatusPending|StatusCustomAny) == 0 {
+		return false
+	}
+	val, err := tx.Get("expires:" + k)
+	if err != nil || _isPinned(tx, k) {
+		return false
+	}
+	expires, err := strconv.ParseInt(val, 10, 64)
+	return err == nil && expires <= now.UnixNano()
+}
+
+// expire moves the hashes that have passed their expiry time to the StatusExpired
+// status, returning how many it moved.  Every holder does this on its own, so the
+// changes aren't gossiped.
+func (dht *DHT) expire(now time.Time) (n int, err error) {
+	err = dht.update(func(tx *buntdb.Tx) error {
+		var keys []string
+		err := tx.AscendKeys("expires:*", func(key, value string) bool {
+			k := key[len("expires:"):]
+			if status, e := tx.Get("status:" + k); e == nil && _expired(tx, k, status, now) {
+				keys = append(keys, k)
+			}
+			return true
+		})
 		if err != nil {
 			return err
 		}
-		_, _, err = tx.Set("status:"+k, fmt.Sprintf("%d", status), nil)
+		for _, k := range keys {
+			if err = _setStatus(tx, nil, k, StatusExpired); err != nil {
+				return err
+			}
+		}
+		n = len(keys)
+		return nil
+	})
+	if n > 0 {
+		dht.dlog.Logf("expired %d hashes", n)
+	}
+	return
+}
+
+// sweepExpired expires hashes every ExpiryCheckInterval until stop is closed
+func (dht *DHT) sweepExpired(stop chan struct{}) {
+	ticker := time.NewTicker(ExpiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if _, err := dht.expire(now); err != nil {
+				dht.dlog.Logf("error expiring hashes: %v", err)
+			}
+		}
+	}
+}
+
+// wantsHistory reports whether a get mask asks for the status change history, which
+// has to be asked for with its own bit as GetMaskAll predates it and doesn't include it
+func wantsHistory(mask int) bool {
+	return mask&GetMaskHistory != 0 && mask != GetMaskAll
+}
+
+// getHistory returns the status change history of a hash
+func (dht *DHT) getHistory(key Hash) (history []StatusHistory, err error) {
+	err = dht.view(func(tx *buntdb.Tx) error {
+		k := key.String()
+		_, err := tx.Get("entry:" + k)
+		if err == buntdb.ErrNotFound {
+			return ErrHashNotFound
+		}
 		if err != nil {
 			return err
 		}
+		history, err = _getHistory(tx, k)
 		return err
 	})
 	return
@@ -312,6 +919,7 @@ func _setStatus(tx *buntdb.Tx, m *Message, key string, status int) (err error) {
 	if err != nil {
 		return
 	}
+	err = _recordStatus(tx, m, key, status)
 	return
 }
 
@@ -320,7 +928,7 @@ func _setStatus(tx *buntdb.Tx, m *Message, key string, status int) (err error) {
 func (dht *DHT) del(m *Message, key Hash) (err error) {
 	k := key.String()
 	dht.dlog.Logf("del %s", k)
-	err = dht.db.Update(func(tx *buntdb.Tx) error {
+	err = dht.update(func(tx *buntdb.Tx) error {
 		err = _setStatus(tx, m, k, StatusDeleted)
 		return err
 	})
@@ -332,7 +940,7 @@ func (dht *DHT) del(m *Message, key Hash) (err error) {
 func (dht *DHT) mod(m *Message, key Hash, newkey Hash) (err error) {
 	k := key.String()
 	dht.dlog.Logf("mod %s", k)
-	err = dht.db.Update(func(tx *buntdb.Tx) error {
+	err = dht.update(func(tx *buntdb.Tx) error {
 		err = _setStatus(tx, m, k, StatusModified)
 		if err == nil {
 			link := newkey.String()
@@ -349,14 +957,54 @@ func (dht *DHT) mod(m *Message, key Hash, newkey Hash) (err error) {
 	return
 }
 
+// recordSum returns the checksum stored alongside each DHT record so that
+// local corruption of the value can be detected on read
+func recordSum(value []byte) (sum string, err error) {
+	var h mh.Multihash
+	h, err = mh.Sum(value, mh.SHA2_256, -1)
+	if err != nil {
+		return
+	}
+	sum = h.B58String()
+	return
+}
+
+// _verify checks a record's value against its stored checksum
+// records stored before checksums were added have no sum and are not checked
+func _verify(tx *buntdb.Tx, k string, val string) (err error) {
+	sum, err := tx.Get("sum:" + k)
+	if err == buntdb.ErrNotFound {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var want string
+	if want, err = recordSum([]byte(val)); err != nil {
+		return
+	}
+	if sum != want {
+		err = ErrCorruptRecord
+	}
+	return
+}
+
 func _get(tx *buntdb.Tx, k string, statusMask int) (string, error) {
 	val, err := tx.Get("entry:" + k)
 	if err == buntdb.ErrNotFound {
 		err = ErrHashNotFound
 		return val, err
 	}
+	if err = _verify(tx, k, val); err != nil {
+		return "", err
+	}
 	var statusVal string
 	statusVal, err = tx.Get("status:" + k)
+	if err == nil && _expired(tx, k, statusVal, time.Now()) {
+		// it may not have been swept yet
+		statusVal = StatusExpiredVal
+	}
 	if err == nil {
 
 		if statusMask == StatusDefault {
@@ -373,9 +1021,16 @@ func _get(tx *buntdb.Tx, k string, statusMask int) (string, error) {
 				err = ErrHashModified
 			case StatusRejectedVal:
 				err = ErrHashRejected
+			case StatusPendingVal:
+				err = ErrHashPending
+			case StatusExpiredVal:
+				err = ErrHashExpired
 			case StatusLiveVal:
 			default:
-				panic("unknown status!")
+				if status, e := strconv.Atoi(statusVal); e != nil || status&StatusCustomAny == 0 {
+					panic("unknown status!")
+				}
+				err = ErrHashCustomStatus
 			}
 		} else {
 			// otherwise we return the value only if the status is in the mask
@@ -393,7 +1048,7 @@ func _get(tx *buntdb.Tx, k string, statusMask int) (string, error) {
 
 // exists checks for the existence of the hash in the store
 func (dht *DHT) exists(key Hash, statusMask int) (err error) {
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		_, err := _get(tx, key.String(), statusMask)
 		return err
 	})
@@ -402,7 +1057,7 @@ func (dht *DHT) exists(key Hash, statusMask int) (err error) {
 
 // returns the source of a given hash
 func (dht *DHT) source(key Hash) (id peer.ID, err error) {
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		val, err := tx.Get("src:" + key.String())
 		if err == buntdb.ErrNotFound {
 			err = ErrHashNotFound
@@ -420,7 +1075,7 @@ func (dht *DHT) get(key Hash, statusMask int, getMask int) (data []byte, entryTy
 	if getMask == GetMaskDefault {
 		getMask = GetMaskEntry
 	}
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		k := key.String()
 		val, err := _get(tx, k, statusMask)
 		if err != nil {
@@ -467,17 +1122,16 @@ func _putLink(tx *buntdb.Tx, base string, link string, tag string) (err error) {
 	key := "link:" + base + ":" + link + ":" + tag
 	var val string
 	val, err = tx.Get(key)
-	if err == buntdb.ErrNotFound {
+	switch {
+	case err == buntdb.ErrNotFound:
 		_, _, err = tx.Set(key, StatusLiveVal, nil)
-		if err != nil {
-			return
-		}
-	} else {
-		//TODO what do we do if there's already something there?
-		//		if val != StatusLiveVal {
+	case err != nil:
+	case val == StatusLiveVal:
+		// the same link arrives again from retries, replicas and gossip
+	default:
+		//TODO what do we do about re-adding a deleted link?
 		Debugf("putlink when %v has status %v", key, val)
-		panic("putLink over existing link not implemented")
-		//		}
+		err = ErrLinkDeleted
 	}
 	return
 }
@@ -486,8 +1140,19 @@ func _putLink(tx *buntdb.Tx, base string, link string, tag string) (err error) {
 // N.B. this function assumes that the data associated has been properly retrieved
 // and validated from the cource chain
 func (dht *DHT) putLink(m *Message, base string, link string, tag string) (err error) {
+	var made time.Time
+	if m != nil {
+		made = m.Time
+	}
+	err = dht.putSortedLink(m, base, link, tag, "", made)
+	return
+}
+
+// putSortedLink associates a link with a stored hash recording the link's sort key and
+// when it was made
+func (dht *DHT) putSortedLink(m *Message, base string, link string, tag string, sortKey string, made time.Time) (err error) {
 	dht.dlog.Logf("putLink on %v link %v as %s", base, link, tag)
-	err = dht.db.Update(func(tx *buntdb.Tx) error {
+	err = dht.update(func(tx *buntdb.Tx) error {
 		_, err := _get(tx, base, StatusLive)
 		if err != nil {
 			return err
@@ -497,6 +1162,16 @@ func (dht *DHT) putLink(m *Message, base string, link string, tag string) (err e
 		if err != nil {
 			return err
 		}
+		if !made.IsZero() {
+			if err = _putLinkTime(tx, base, link, tag, made); err != nil {
+				return err
+			}
+		}
+		if sortKey != "" {
+			if _, _, err = tx.Set(linkSortKey(base, link, tag), sortKey, nil); err != nil {
+				return err
+			}
+		}
 
 		//var index string
 		_, err = incIdx(tx, m)
@@ -512,7 +1187,7 @@ func (dht *DHT) putLink(m *Message, base string, link string, tag string) (err e
 // N.B. this function assumes that the action has been properly validated
 func (dht *DHT) delLink(m *Message, base string, link string, tag string) (err error) {
 	dht.dlog.Logf("delLink on %v link %v as %s", base, link, tag)
-	err = dht.db.Update(func(tx *buntdb.Tx) error {
+	err = dht.update(func(tx *buntdb.Tx) error {
 		_, err := _get(tx, base, StatusLive)
 		if err != nil {
 			return err
@@ -561,7 +1236,7 @@ func filter(ss []Meta, test func(*Meta) bool) (ret []Meta) {
 func (dht *DHT) getLink(base Hash, tag string, statusMask int) (results []TaggedHash, err error) {
 	dht.dlog.Logf("getLink on %v of %s with mask %d", base, tag, statusMask)
 	b := base.String()
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		_, err := _get(tx, b, StatusLive+StatusModified) //only get links on live and modified bases
 		if err != nil {
 			return err
@@ -587,13 +1262,136 @@ func (dht *DHT) getLink(base Hash, tag string, statusMask int) (results []Tagged
 		})
 
 		if len(results) == 0 {
-			err = fmt.Errorf("No links for %s", tag)
+			err = &wrappedError{fmt.Sprintf("No links for %s", tag), ErrLinkNotFound}
 		}
 		return err
 	})
 	return
 }
 
+// countLinks returns the number of links on a base with a tag, or if target isn't empty
+// whether there is a link to it, from the index without loading anything
+func (dht *DHT) countLinks(base Hash, tag string, statusMask int, target string) (count int, err error) {
+	dht.dlog.Logf("countLinks on %v of %s with mask %d", base, tag, statusMask)
+	if statusMask == StatusDefault {
+		statusMask = StatusLive
+	}
+	b := base.String()
+	err = dht.view(func(tx *buntdb.Tx) error {
+		_, err := _get(tx, b, StatusLive+StatusModified)
+		if err != nil {
+			return err
+		}
+		var e error
+		count1 := func(value string) {
+			var status int
+			if status, e = strconv.Atoi(value); e == nil && status&statusMask > 0 {
+				count++
+			}
+		}
+		if target != "" {
+			value, err := tx.Get("link:" + b + ":" + target + ":" + tag)
+			if err == buntdb.ErrNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			count1(value)
+			return e
+		}
+		err = tx.Ascend("link", func(key, value string) bool {
+			x := strings.Split(key, ":")
+			if x[1] == b && x[3] == tag {
+				count1(value)
+			}
+			return e == nil
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
+	return
+}
+
+// refetch replaces a corrupt local record by re-requesting the entry from the
+// node that originally put it
+func (dht *DHT) refetch(key Hash) (err error) {
+	var entryType string
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		entryType, e = tx.Get("type:" + key.String())
+		if e == buntdb.ErrNotFound {
+			e = ErrHashNotFound
+		}
+		return e
+	})
+	if err != nil {
+		return
+	}
+	// system entries can't be requested back through the validation protocol
+	if entryType == DNAEntryType || entryType == KeyEntryType {
+		err = ErrCorruptRecord
+		return
+	}
+	var src peer.ID
+	src, err = dht.source(key)
+	if err != nil {
+		return
+	}
+	dht.dlog.Logf("refetching corrupt record %v from %v", key, src)
+	err = RunValidationPhase(dht.h, src, VALIDATE_PUT_REQUEST, key, func(resp ValidateResponse) error {
+		b, err := resp.Entry.Marshal()
+		if err != nil {
+			return err
+		}
+		var hash Hash
+		if err = hash.Sum(dht.h.hashSpec, b); err != nil {
+			return err
+		}
+		if !hash.Equal(&key) && entryType != AgentEntryType {
+			return ErrCorruptRecord
+		}
+		return dht.updateStored(func(tx *buntdb.Tx) (size int64, err error) {
+			k := key.String()
+			size = int64(len(b))
+			if old, e := tx.Get("entry:" + k); e == nil {
+				size -= int64(len(old))
+			}
+			if _, _, err = tx.Set("entry:"+k, string(b), nil); err != nil {
+				return
+			}
+			var sum string
+			if sum, err = recordSum(b); err != nil {
+				return
+			}
+			_, _, err = tx.Set("sum:"+k, sum, nil)
+			return
+		})
+	})
+	return
+}
+
+// refetchInBackground starts refetching a corrupt record unless it already is being
+func (dht *DHT) refetchInBackground(key Hash) {
+	k := key.String()
+	dht.refetchLk.Lock()
+	defer dht.refetchLk.Unlock()
+	if dht.refetching[k] {
+		return
+	}
+	dht.refetching[k] = true
+	go func() {
+		if err := dht.refetch(key); err != nil {
+			dht.dlog.Logf("unable to refetch %v: %v", key, err)
+		}
+		dht.refetchLk.Lock()
+		delete(dht.refetching, k)
+		dht.refetchLk.Unlock()
+	}()
+}
+
 func (dht *DHT) Send(key Hash, msgType MsgType, body interface{}) (response interface{}, err error) {
 	n, err := dht.FindNodeForHash(key)
 	if err != nil {
@@ -603,6 +1401,49 @@ func (dht *DHT) Send(key Hash, msgType MsgType, body interface{}) (response inte
 	return
 }
 
+var ErrLocalKeyNotFound = errors.New("key not found")
+
+// localStoreKey builds the database key for a zome's node-local storage.  The zome
+// name is length prefixed so that zome names or keys containing ":" can't collide.
+func localStoreKey(zome string, key string) string {
+	return fmt.Sprintf("local:%d:%s:%s", len(zome), zome, key)
+}
+
+// localStoreSet stores a value in a zome's node-local storage.  This data is never
+// committed to the chain or shared on the DHT.
+func (dht *DHT) localStoreSet(zome string, key string, value string) (err error) {
+	err = dht.update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(localStoreKey(zome, key), value, nil)
+		return err
+	})
+	return
+}
+
+// localStoreGet retrieves a value from a zome's node-local storage
+func (dht *DHT) localStoreGet(zome string, key string) (value string, err error) {
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		value, e = tx.Get(localStoreKey(zome, key))
+		if e == buntdb.ErrNotFound {
+			e = ErrLocalKeyNotFound
+		}
+		return e
+	})
+	return
+}
+
+// localStoreDel removes a value from a zome's node-local storage
+func (dht *DHT) localStoreDel(zome string, key string) (err error) {
+	err = dht.update(func(tx *buntdb.Tx) error {
+		_, e := tx.Delete(localStoreKey(zome, key))
+		if e == buntdb.ErrNotFound {
+			e = ErrLocalKeyNotFound
+		}
+		return e
+	})
+	return
+}
+
 // Send sends a message to the node
 func (dht *DHT) send(to peer.ID, t MsgType, body interface{}) (response interface{}, err error) {
 	return dht.h.Send(ActionProtocol, to, t, body)
@@ -611,8 +1452,15 @@ func (dht *DHT) send(to peer.ID, t MsgType, body interface{}) (response interfac
 // FindNodeForHash gets the nearest node to the neighborhood of the hash
 func (dht *DHT) FindNodeForHash(key Hash) (n *Node, err error) {
 
-	// for now, the node it returns it self!
+	// without sharding we hold everything so it's ourself
 	pid := dht.h.nodeID
+	if dht.resilienceFactor() > 0 {
+		var nodes []peer.ID
+		if nodes, err = dht.nearestNodes(key.H, 1); err != nil {
+			return
+		}
+		pid = nodes[0]
+	}
 
 	var node Node
 	node.HashAddr = pid
@@ -641,9 +1489,50 @@ func (dht *DHT) FindNodeForHash(key Hash) (n *Node, err error) {
 }
 */
 
+// Close stops gossiping and closes the DHT's database
+func (dht *DHT) Close() (err error) {
+	dht.gossiping = false
+	// let a suspended gossip loop see that it's done
+	dht.powerLk.Lock()
+	if dht.suspended != nil {
+		close(dht.suspended)
+		dht.suspended = nil
+	}
+	dht.powerLk.Unlock()
+	if dht.stopExpiry != nil {
+		close(dht.stopExpiry)
+		dht.stopExpiry = nil
+	}
+	if dht.stopKeepAlive != nil {
+		close(dht.stopKeepAlive)
+		dht.stopKeepAlive = nil
+	}
+	if dht.stopMetrics != nil {
+		close(dht.stopMetrics)
+		dht.stopMetrics = nil
+	}
+	err = dht.db.Close()
+	return
+}
+
 // Start initiates listening for DHT & Gossip protocol messages on the node
 func (dht *DHT) Start() (err error) {
 	err = dht.h.node.StartProtocol(dht.h, GossipProtocol)
+	if err != nil {
+		return
+	}
+	if dht.h.nucleus.dna.hasTTL() {
+		dht.stopExpiry = make(chan struct{})
+		go dht.sweepExpired(dht.stopExpiry)
+	}
+	if KeepAliveInterval > 0 {
+		dht.stopKeepAlive = make(chan struct{})
+		go dht.keepAlive(KeepAliveInterval, dht.stopKeepAlive)
+	}
+	if MetricsInterval > 0 {
+		dht.stopMetrics = make(chan struct{})
+		go dht.keepMetrics(MetricsInterval, dht.stopMetrics)
+	}
 	return
 }
 
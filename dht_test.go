@@ -2,8 +2,12 @@ package holochain
 
 import (
 	"fmt"
+	zygo "github.com/glycerine/zygomys/repl"
+	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/robertkrimen/otto"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
 	"os"
 	"strings"
 	"testing"
@@ -17,8 +21,9 @@ func TestNewDHT(t *testing.T) {
 	h.rootPath = d
 	os.MkdirAll(h.DBPath(), os.ModePerm)
 
-	dht := NewDHT(&h)
+	dht, err := NewDHT(&h)
 	Convey("It should initialize the DHT struct", t, func() {
+		So(err, ShouldBeNil)
 		So(dht.h, ShouldEqual, &h)
 		So(fileExists(h.DBPath(), DHTStoreFileName), ShouldBeTrue)
 	})
@@ -152,6 +157,117 @@ func TestPutGetModDel(t *testing.T) {
 
 	})
 
+	Convey("it should record the history of status changes", t, func() {
+		history, err := dht.getHistory(hash)
+		So(err, ShouldBeNil)
+		So(len(history), ShouldEqual, 3)
+		So(history[0].Status, ShouldEqual, StatusLive)
+		So(history[1].Status, ShouldEqual, StatusModified)
+		So(history[2].Status, ShouldEqual, StatusDeleted)
+		So(history[2].Fingerprint, ShouldNotEqual, "")
+
+		badhash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+		_, err = dht.getHistory(badhash)
+		So(err, ShouldEqual, ErrHashNotFound)
+	})
+
+}
+
+func TestLocalStore(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+
+	Convey("it should set, get and del values namespaced by zome", t, func() {
+		err := dht.localStoreSet("zome1", "key", "value1")
+		So(err, ShouldBeNil)
+		err = dht.localStoreSet("zome2", "key", "value2")
+		So(err, ShouldBeNil)
+
+		v, err := dht.localStoreGet("zome1", "key")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "value1")
+		v, err = dht.localStoreGet("zome2", "key")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "value2")
+
+		err = dht.localStoreDel("zome1", "key")
+		So(err, ShouldBeNil)
+		_, err = dht.localStoreGet("zome1", "key")
+		So(err, ShouldEqual, ErrLocalKeyNotFound)
+		err = dht.localStoreDel("zome1", "key")
+		So(err, ShouldEqual, ErrLocalKeyNotFound)
+	})
+
+	Convey("it should not add anything to the chain or gossip index", t, func() {
+		l := h.chain.Length()
+		idx, _ := dht.GetIdx()
+		dht.localStoreSet("zome1", "key", "value1")
+		So(h.chain.Length(), ShouldEqual, l)
+		i, _ := dht.GetIdx()
+		So(i, ShouldEqual, idx)
+	})
+
+	Convey("it should not collide when zome names or keys contain colons", t, func() {
+		err := dht.localStoreSet("a", "b:c", "value1")
+		So(err, ShouldBeNil)
+		err = dht.localStoreSet("a:b", "c", "value2")
+		So(err, ShouldBeNil)
+
+		v, err := dht.localStoreGet("a", "b:c")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "value1")
+		v, err = dht.localStoreGet("a:b", "c")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "value2")
+	})
+}
+
+func TestCorruptRecord(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	dht := h.dht
+	now := time.Unix(1, 1) // pick a constant time so the test will always work
+	e := GobEntry{C: "124"}
+	_, hd, _ := h.NewEntry(now, "evenNumbers", &e)
+	hash := hd.EntryLink
+	b, _ := e.Marshal()
+	err := dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: hash}), "evenNumbers", hash, h.nodeID, b, StatusLive)
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("get should return ErrCorruptRecord if the stored value was damaged", t, func() {
+		err := dht.db.Update(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set("entry:"+hash.String(), "garbage", nil)
+			return err
+		})
+		So(err, ShouldBeNil)
+		_, _, _, _, err = dht.get(hash, StatusLive, GetMaskDefault)
+		So(err, ShouldEqual, ErrCorruptRecord)
+	})
+
+	Convey("GET_REQUEST should refetch a corrupt record from its source in the background", t, func() {
+		m := h.node.NewMessage(GET_REQUEST, GetReq{H: hash, StatusMask: StatusLive})
+		_, err := ActionReceiver(h, m)
+		So(err, ShouldEqual, ErrCorruptRecord)
+
+		var data []byte
+		for i := 0; i < 100; i++ {
+			data, _, _, _, err = dht.get(hash, StatusLive, GetMaskDefault)
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, string(b))
+
+		r, err := ActionReceiver(h, m)
+		So(err, ShouldBeNil)
+		So(fmt.Sprintf("%v", r.(GetResp).Entry), ShouldEqual, fmt.Sprintf("%v", &e))
+	})
 }
 
 func TestLinking(t *testing.T) {
@@ -217,6 +333,14 @@ func TestLinking(t *testing.T) {
 		So(data[0].H, ShouldEqual, linkHash1Str)
 	})
 
+	Convey("putting a live link again should change nothing", t, func() {
+		err := dht.putLink(fakeMsg, baseStr, linkHash1Str, "tag bar")
+		So(err, ShouldBeNil)
+		data, err := dht.getLink(base, "tag bar", StatusLive)
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, 1)
+	})
+
 	Convey("It should fail delete links non existent links bases and tags", t, func() {
 		badHashStr := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqhX"
 
@@ -245,6 +369,136 @@ func TestLinking(t *testing.T) {
 		data, err = dht.getLink(base, "tag foo", StatusLive)
 		So(err.Error(), ShouldEqual, "No links for tag foo")
 	})
+
+	Convey("putting a deleted link again should fail without crashing", t, func() {
+		err := dht.putLink(fakeMsg, baseStr, linkHash2Str, "tag foo")
+		So(err, ShouldEqual, ErrLinkDeleted)
+	})
+}
+
+func TestCountLinks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	hash := commit(h, "oddNumbers", "7")
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	otherHash := commit(h, "profile", `{"firstName":"Griffy","lastName":"Pinhead"}`)
+	commit(h, "rating", fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"},{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, hash.String(), profileHash.String(), hash.String(), otherHash.String()))
+	commit(h, "rating", fmt.Sprintf(`{"Links":[{"LinkAction":"%s","Base":"%s","Link":"%s","Tag":"4stars"}]}`, DelAction, hash.String(), otherHash.String()))
+
+	Convey("links should be counted from the index", t, func() {
+		n, err := h.dht.countLinks(hash, "4stars", StatusLive, "")
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		n, err = h.dht.countLinks(hash, "4stars", StatusLive+StatusDeleted, "")
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		n, err = h.dht.countLinks(hash, "3stars", StatusLive, "")
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 0)
+		n, err = h.dht.countLinks(hash, "4stars", StatusLive, profileHash.String())
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		n, err = h.dht.countLinks(hash, "4stars", StatusLive, otherHash.String())
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 0)
+	})
+
+	Convey("countLinks and linkExists should ask the base's node", t, func() {
+		r, err := NewCountLinksAction(hash, "4stars").Do(h)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, 1)
+		r, err = NewLinkExistsAction(hash, "4stars", profileHash).Do(h)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, true)
+		r, err = NewLinkExistsAction(hash, "4stars", otherHash).Do(h)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, false)
+	})
+
+	Convey("countLinks and linkExists should be available from the ribosomes", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r, err := z.Run(fmt.Sprintf(`countLinks("%s","4stars")+":"+linkExists("%s","4stars","%s")`, hash.String(), hash.String(), profileHash.String()))
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, "1:true")
+
+		z, _, err = h.MakeRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		_, err = z.Run(fmt.Sprintf(`(hget (linkExists "%s" "4stars" "%s") %%result)`, hash.String(), otherHash.String()))
+		So(err, ShouldBeNil)
+		So(z.(*ZygoRibosome).lastResult.(*zygo.SexpBool).Val, ShouldBeFalse)
+	})
+}
+
+func TestGetLinks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	hash := commit(h, "oddNumbers", "7")
+	otherBase := commit(h, "oddNumbers", "9")
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	otherHash := commit(h, "profile", `{"firstName":"Griffy","lastName":"Pinhead"}`)
+	commit(h, "rating", fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"},{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, hash.String(), profileHash.String(), otherBase.String(), otherHash.String()))
+
+	Convey("the links on several bases should be got in one action", t, func() {
+		specs := []LinksSpec{{Base: otherBase.String(), Tag: "4stars"}, {Base: hash.String(), Tag: "3stars"}, {Base: hash.String(), Tag: "4stars"}}
+		r, err := NewGetLinksAction(specs, &GetLinkOptions{StatusMask: StatusLive}).Do(h)
+		So(err, ShouldBeNil)
+		results := r.([]LinkQueryResp)
+		So(len(results), ShouldEqual, 3)
+		So(results[0].Links[0].H, ShouldEqual, otherHash.String())
+		So(results[1].Error, ShouldEqual, "No links for 3stars")
+		So(results[2].Links[0].H, ShouldEqual, profileHash.String())
+		So(results[2].Error, ShouldEqual, "")
+
+		r, err = NewGetLinksAction(specs, &GetLinkOptions{Load: true, StatusMask: StatusLive}).Do(h)
+		So(err, ShouldBeNil)
+		So(r.([]LinkQueryResp)[2].Links[0].E, ShouldEqual, `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	})
+
+	Convey("a node should answer the queries of a links request in order", t, func() {
+		lq := LinksQuery{Queries: []LinkQuery{{Base: hash, T: "4stars", StatusMask: StatusLive}, {Base: otherBase, T: "4stars", StatusMask: StatusLive}}}
+		r, err := h.dht.send(h.nodeID, GETLINKS_REQUEST, lq)
+		So(err, ShouldBeNil)
+		results := r.(*LinksQueryResp).Results
+		So(results[0].Links[0].H, ShouldEqual, profileHash.String())
+		So(results[1].Links[0].H, ShouldEqual, otherHash.String())
+	})
+
+	Convey("getLinks should be available from the ribosomes", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r, err := z.Run(fmt.Sprintf(`var r = getLinks([{Base:"%s",Tag:"4stars"},{Base:"%s",Tag:"4stars"}]); r[0].Links[0].H+":"+r[1].Links[0].H`, hash.String(), otherBase.String()))
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, profileHash.String()+":"+otherHash.String())
+
+		z, _, err = h.MakeRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		_, err = z.Run(fmt.Sprintf(`(getLinks "[{\"Base\":\"%s\",\"Tag\":\"4stars\"}]")`, otherBase.String()))
+		So(err, ShouldBeNil)
+		So(z.(*ZygoRibosome).lastResult.(*zygo.SexpStr).S, ShouldEqual, fmt.Sprintf(`[{"Links":[{"H":"%s","E":""}]}]`, otherHash.String()))
+	})
+
+	Convey("getLinks should return a page of links when no limit is given", t, func() {
+		saved := DefaultLinksPageSize
+		DefaultLinksPageSize = 1
+		defer func() { DefaultLinksPageSize = saved }()
+		commit(h, "rating", fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, hash.String(), otherHash.String()))
+
+		r, err := NewGetLinksAction([]LinksSpec{{Base: hash.String(), Tag: "4stars"}}, &GetLinkOptions{StatusMask: StatusLive}).Do(h)
+		So(err, ShouldBeNil)
+		first := r.([]LinkQueryResp)[0]
+		So(len(first.Links), ShouldEqual, 1)
+		So(first.Next, ShouldNotEqual, "")
+
+		r, err = NewGetLinksAction([]LinksSpec{{Base: hash.String(), Tag: "4stars", Cursor: first.Next}}, &GetLinkOptions{StatusMask: StatusLive}).Do(h)
+		So(err, ShouldBeNil)
+		second := r.([]LinkQueryResp)[0]
+		So(len(second.Links), ShouldEqual, 1)
+		So(second.Links[0].H, ShouldNotEqual, first.Links[0].H)
+		So(second.Error, ShouldEqual, "")
+	})
 }
 
 func TestFindNodeForHash(t *testing.T) {
@@ -253,8 +507,7 @@ func TestFindNodeForHash(t *testing.T) {
 
 	Convey("It should find a node", t, func() {
 
-		// for now the node it finds is ourself for any hash because we haven't implemented
-		// anything about neighborhoods or other nodes...
+		// without sharding the node it finds is ourself for any hash
 		hash, err := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
 		if err != nil {
 			panic(err)
@@ -480,7 +733,7 @@ func TestActionReceiver(t *testing.T) {
 	Convey("DELETE_REQUEST should set status of hash to deleted", t, func() {
 		entry := DelEntry{Hash: hash2, Message: "expired"}
 		a := NewDelAction("evenNumbers", entry)
-		_, _, entryHash, err := h.doCommit(a, &StatusChange{Action: DelAction, Hash: hash2})
+		_, _, entryHash, err := h.doCommit(a, &StatusChange{Action: DelAction, Hash: hash2}, nil)
 
 		m := h.node.NewMessage(DEL_REQUEST, DelReq{H: hash2, By: entryHash})
 		r, err := ActionReceiver(h, m)
@@ -564,3 +817,220 @@ func (dht *DHT) simHandleChangeReqs() (err error) {
 	//	err = dht.handleChangeReq(&m)
 	return
 }
+
+func TestValidationQuorum(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	dht := h.dht
+	h.nucleus.dna.DHTConfig.ValidationQuorum = 2
+	// the quorum is of the hash's holders, which with this many are all the nodes
+	h.nucleus.dna.DHTConfig.ResilienceFactor = 4
+	defer func() { h.nucleus.dna.DHTConfig.ResilienceFactor = 0 }()
+	keys := make(map[peer.ID]ic.PrivKey)
+	for _, name := range []string{"author", "holder1", "holder2"} {
+		id, key := makePeer(name)
+		keys[id] = key
+		dht.UpdateGossiper(id, 0)
+	}
+	author, _ := makePeer("author")
+	holder1, _ := makePeer("holder1")
+	holder2, _ := makePeer("holder2")
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	receipt := func(from peer.ID) error {
+		return dht.receipt(signedReceipt(h, keys[from], hash))
+	}
+
+	Convey("receipts that arrive before the put should be counted", t, func() {
+		err := receipt(holder1)
+		So(err, ShouldBeNil)
+		err = dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: hash}), "someType", hash, author, []byte("some value"), StatusPending)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("pending hashes should only be returned when asked for", t, func() {
+		err := dht.exists(hash, StatusDefault)
+		So(err, ShouldEqual, ErrHashPending)
+		err = dht.exists(hash, StatusLive)
+		So(err, ShouldEqual, ErrHashNotFound)
+		err = dht.exists(hash, StatusPending)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("receipts from the author or repeated receipts should not count", t, func() {
+		err := receipt(author)
+		So(err, ShouldBeNil)
+		err = receipt(holder1)
+		So(err, ShouldBeNil)
+		err = dht.exists(hash, StatusPending)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should go live once enough holders have validated it", t, func() {
+		err := receipt(holder2)
+		So(err, ShouldBeNil)
+		err = dht.exists(hash, StatusLive)
+		So(err, ShouldBeNil)
+		history, err := dht.getHistory(hash)
+		So(err, ShouldBeNil)
+		So(history[len(history)-1].Status, ShouldEqual, StatusLive)
+	})
+
+	Convey("the pending error should survive being sent over the network", t, func() {
+		So(NewErrorResponse(ErrHashPending).DecodeResponseError(), ShouldEqual, ErrHashPending)
+	})
+
+	Convey("receipts not signed by their holder should be refused", t, func() {
+		m := signedReceipt(h, keys[holder1], hash)
+		r := m.Body.(ReceiptReq)
+		r.Key, _ = ic.MarshalPublicKey(keys[holder2].GetPublic())
+		m.Body = r
+		So(dht.receipt(m), ShouldEqual, ErrBadReceipt)
+	})
+
+	Convey("receipts from nodes outside the hash's neighborhood should be refused", t, func() {
+		h.nucleus.dna.DHTConfig.ResilienceFactor = 2
+		defer func() { h.nucleus.dna.DHTConfig.ResilienceFactor = 4 }()
+		nodes, err := dht.nearestNodes(hash.H, 0)
+		So(err, ShouldBeNil)
+		near, far := nodes[0], nodes[len(nodes)-1]
+		if near == h.nodeID {
+			near = nodes[1]
+		}
+		if far == h.nodeID {
+			far = nodes[len(nodes)-2]
+		}
+		So(receipt(far), ShouldEqual, ErrNotHolder)
+		So(receipt(near), ShouldBeNil)
+	})
+}
+
+// signedReceipt returns a receipt message for the hash signed with the holder's key
+func signedReceipt(h *Holochain, key ic.PrivKey, hash Hash) *Message {
+	r := ReceiptReq{H: hash}
+	r.Key, _ = ic.MarshalPublicKey(key.GetPublic())
+	r.Sig, _ = Sign(key, hash.H)
+	m := h.node.NewMessage(RECEIPT_REQUEST, r)
+	m.From, _ = peer.IDFromPrivateKey(key)
+	return m
+}
+
+func TestValidationQuorumSourceHeaders(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	dht := h.dht
+	h.nucleus.dna.DHTConfig.ValidationQuorum = 2
+	h.nucleus.dna.DHTConfig.ResilienceFactor = 3
+	defer func() { h.nucleus.dna.DHTConfig.ResilienceFactor = 0 }()
+	for _, name := range []string{"holder1", "holder2"} {
+		id, _ := makePeer(name)
+		dht.UpdateGossiper(id, 0)
+	}
+	before, err := dht.getHeaders(h.nodeID)
+	if err != nil {
+		panic(err)
+	}
+	hash := commit(h, "oddNumbers", "7")
+	hd, err := h.chain.GetEntryHeader(hash)
+	if err != nil {
+		panic(err)
+	}
+	headerHash, _, err := hd.Sum(h.hashSpec)
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("a pending put should record its source's header", t, func() {
+		So(dht.exists(hash, StatusPending), ShouldBeNil)
+		headers, err := dht.getHeaders(h.nodeID)
+		So(err, ShouldBeNil)
+		So(len(headers), ShouldEqual, len(before)+1)
+		_, err = dht.getHeader(headerHash)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("the header should still be there once the put goes live", t, func() {
+		for _, name := range []string{"holder1", "holder2"} {
+			_, key := makePeer(name)
+			So(dht.receipt(signedReceipt(h, key, hash)), ShouldBeNil)
+		}
+		So(dht.exists(hash, StatusLive), ShouldBeNil)
+		hd, err := dht.getHeader(headerHash)
+		So(err, ShouldBeNil)
+		So(hd.EntryLink.String(), ShouldEqual, hash.String())
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	dht := h.dht
+	for i, z := range h.nucleus.dna.Zomes {
+		for j, e := range z.Entries {
+			if e.Name == "oddNumbers" {
+				h.nucleus.dna.Zomes[i].Entries[j].TTL = 60
+			}
+		}
+	}
+
+	Convey("entries should be live until their TTL passes", t, func() {
+		hash := commit(h, "oddNumbers", "7")
+		So(dht.exists(hash, StatusDefault), ShouldBeNil)
+		n, err := dht.expire(time.Now())
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 0)
+
+		n, err = dht.expire(time.Now().Add(2 * time.Minute))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(dht.exists(hash, StatusDefault), ShouldEqual, ErrHashExpired)
+		So(dht.exists(hash, StatusLive), ShouldEqual, ErrHashNotFound)
+		So(dht.exists(hash, StatusExpired), ShouldBeNil)
+		history, err := dht.getHistory(hash)
+		So(err, ShouldBeNil)
+		So(history[len(history)-1].Status, ShouldEqual, StatusExpired)
+	})
+
+	Convey("entries should expire from when they were committed even before they are swept", t, func() {
+		author, _ := makePeer("author")
+		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		err := dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: hash}), "oddNumbers", hash, author, []byte("some value"), StatusLive)
+		So(err, ShouldBeNil)
+		err = dht.putExpiry(hash, "oddNumbers", time.Now().Add(-2*time.Minute))
+		So(err, ShouldBeNil)
+		So(dht.exists(hash, StatusDefault), ShouldEqual, ErrHashExpired)
+	})
+
+	Convey("entries in a status the DNA declares should expire too", t, func() {
+		author, _ := makePeer("author")
+		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1")
+		err := dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: hash}), "oddNumbers", hash, author, []byte("some value"), StatusCustom)
+		So(err, ShouldBeNil)
+		err = dht.putExpiry(hash, "oddNumbers", time.Now().Add(-2*time.Minute))
+		So(err, ShouldBeNil)
+		_, err = dht.expire(time.Now())
+		So(err, ShouldBeNil)
+		So(dht.exists(hash, StatusCustom), ShouldEqual, ErrHashNotFound)
+		So(dht.exists(hash, StatusExpired), ShouldBeNil)
+	})
+
+	Convey("entries of types without a TTL should not expire", t, func() {
+		hash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+		_, err := dht.expire(time.Now().Add(time.Hour))
+		So(err, ShouldBeNil)
+		So(dht.exists(hash, StatusDefault), ShouldBeNil)
+	})
+
+	Convey("the expired error should survive being sent over the network", t, func() {
+		So(NewErrorResponse(ErrHashExpired).DecodeResponseError(), ShouldEqual, ErrHashExpired)
+	})
+
+	Convey("a negative TTL should not be allowed", t, func() {
+		h.nucleus.dna.Zomes[0].Entries[0].TTL = -1
+		err := h.nucleus.dna.check()
+		So(err.Error(), ShouldContainSubstring, ErrNegativeTTL.Error())
+		h.nucleus.dna.Zomes[0].Entries[0].TTL = 0
+	})
+}
@@ -0,0 +1,459 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// disclosure implements proofs that an agent's chain holds an entry with a given field
+// value which don't reveal the rest of the entry
+
+package holochain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrNoMatchingEntry = errors.New("no entry matches")
+var ErrBadProof = errors.New("invalid proof")
+var ErrProofFormat = errors.New("proofs can only be made for json entries")
+var ErrNotDisclosable = errors.New("entry type isn't disclosable")
+var ErrDisclosureMismatch = errors.New("header disclosure root doesn't match the entry")
+var ErrDisclosableSharing = errors.New("disclosable entries must be public json entries")
+
+// DisclosureMetaKey is the header meta key under which the root of the commitments to
+// the fields of a disclosable entry is kept
+const DisclosureMetaKey = "_disclosure"
+
+// Proof is an agent's signed claim that an entry on its chain has a field with a value.
+// It carries the entry's header, which the agent signed when committing the entry, so it
+// proves the entry's type and hash without revealing its content, and a later disclosure
+// of the full entry can be checked against it.  The value is tied to the entry by a path
+// from its salted commitment to the disclosure root in the header's meta.
+type Proof struct {
+	Agent    string    // B58 node id of the agent whose chain holds the entry
+	Key      []byte    // the agent's marshaled public key
+	Header   []byte    // the marshaled header of the entry
+	Field    string    // dot separated path of the field in the entry
+	Value    string    // the JSON encoding of the field's value
+	Salt     []byte    // the salt of the field's commitment
+	Index    int       // the position of the field's commitment among the entry's
+	Count    int       // the number of commitments to the entry's fields
+	Siblings [][]byte  // the hashes along the path from the commitment to the root
+	Time     time.Time // when the proof was made
+	Sig      Signature // the agent's signature of the claim
+}
+
+// ProofClaim is what a verified proof establishes
+type ProofClaim struct {
+	Agent      string
+	EntryType  string
+	EntryHash  string
+	HeaderHash string
+	Committed  time.Time
+	Field      string
+	Value      interface{}
+	Time       time.Time
+}
+
+// claimData returns what the proof's signature is made over
+func (p *Proof) claimData() []byte {
+	var b bytes.Buffer
+	b.Write(p.Header)
+	writeStr(&b, p.Field)
+	writeStr(&b, p.Value)
+	b.WriteString(p.Time.UTC().Format(time.RFC3339Nano))
+	return b.Bytes()
+}
+
+// entryField returns the value at the dot separated path in a decoded JSON entry
+func entryField(entry interface{}, field string) (value interface{}, ok bool) {
+	value = entry
+	for _, name := range strings.Split(field, ".") {
+		var m map[string]interface{}
+		if m, ok = value.(map[string]interface{}); !ok {
+			return
+		}
+		if value, ok = m[name]; !ok {
+			return
+		}
+	}
+	return
+}
+
+// disclosureLeaf is a field of a JSON entry that is committed to separately
+type disclosureLeaf struct {
+	path  string
+	value []byte
+}
+
+// disclosureLeaves flattens a decoded JSON entry into its fields, sorted by path.
+// Objects are descended into, anything else (including arrays) is a single field.
+func disclosureLeaves(v interface{}, path string, leaves []disclosureLeaf) (result []disclosureLeaf, err error) {
+	result = leaves
+	if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if result, err = disclosureLeaves(m[k], p, result); err != nil {
+				return
+			}
+		}
+		return
+	}
+	var j []byte
+	if j, err = json.Marshal(v); err != nil {
+		return
+	}
+	result = append(result, disclosureLeaf{path: path, value: j})
+	return
+}
+
+// disclosureSalt returns the salt of a field's commitment.  It is derived from the whole
+// entry so holders can recompute it, but revealing it doesn't reveal the other fields.
+func disclosureSalt(content string, path string) []byte {
+	s := sha256.New()
+	s.Write([]byte(content))
+	s.Write([]byte{0})
+	s.Write([]byte(path))
+	return s.Sum(nil)
+}
+
+// disclosureLeafHash returns the commitment to a field
+func disclosureLeafHash(salt []byte, path string, value []byte) []byte {
+	s := sha256.New()
+	s.Write([]byte{0})
+	s.Write(salt)
+	s.Write([]byte(path))
+	s.Write([]byte{0})
+	s.Write(value)
+	return s.Sum(nil)
+}
+
+// disclosureNodeHash returns the hash of two adjacent nodes of the commitment tree
+func disclosureNodeHash(left, right []byte) []byte {
+	s := sha256.New()
+	s.Write([]byte{1})
+	s.Write(left)
+	s.Write(right)
+	return s.Sum(nil)
+}
+
+// disclosureTree returns the root of the commitments to an entry's fields, and the
+// siblings along the path from the commitment at index to the root.  A node without a
+// sibling is carried up to the next level unchanged.
+func disclosureTree(level [][]byte, index int) (root []byte, siblings [][]byte) {
+	for len(level) > 1 {
+		if sib := index ^ 1; sib < len(level) {
+			siblings = append(siblings, level[sib])
+		}
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, disclosureNodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+		index /= 2
+	}
+	if len(level) == 1 {
+		root = level[0]
+	}
+	return
+}
+
+// disclosureRoot returns the hex encoded root of the commitments to the fields of a
+// JSON entry's content, along with its fields
+func disclosureRoot(content string) (root string, leaves []disclosureLeaf, hashes [][]byte, err error) {
+	var decoded interface{}
+	if err = json.Unmarshal([]byte(content), &decoded); err != nil {
+		err = fmt.Errorf("%w: %w", ErrProofFormat, err)
+		return
+	}
+	if leaves, err = disclosureLeaves(decoded, "", nil); err != nil {
+		return
+	}
+	for _, l := range leaves {
+		hashes = append(hashes, disclosureLeafHash(disclosureSalt(content, l.path), l.path, l.value))
+	}
+	r, _ := disclosureTree(hashes, 0)
+	root = hex.EncodeToString(r)
+	return
+}
+
+// addDisclosureRoot returns the header meta of a commit with the disclosure root of a
+// disclosable entry added to it
+func addDisclosureRoot(def *EntryDef, entry Entry, meta map[string]string) (result map[string]string, err error) {
+	result = meta
+	if !def.Disclosable {
+		return
+	}
+	var content, root string
+	if content, err = entryContentString(entry.Content()); err != nil {
+		return
+	}
+	if root, _, _, err = disclosureRoot(content); err != nil {
+		return
+	}
+	result = make(map[string]string, len(meta)+1)
+	for k, v := range meta {
+		result[k] = v
+	}
+	result[DisclosureMetaKey] = root
+	return
+}
+
+// checkDisclosureRoot checks that the header of a disclosable entry commits to the
+// entry's fields, so proofs made from the header can be trusted
+func checkDisclosureRoot(def *EntryDef, hd *Header, entry Entry) (err error) {
+	if !def.Disclosable || entry == nil {
+		return
+	}
+	var content, root string
+	if content, err = entryContentString(entry.Content()); err != nil {
+		return
+	}
+	if root, _, _, err = disclosureRoot(content); err != nil {
+		return
+	}
+	if hd.Meta[DisclosureMetaKey] != root {
+		err = ErrDisclosureMismatch
+	}
+	return
+}
+
+// verifyDisclosure checks that the proof's value is the committed value of its field
+// in the entry whose disclosure root is given
+func (p *Proof) verifyDisclosure(root string) bool {
+	if p.Count <= 0 || p.Index < 0 || p.Index >= p.Count {
+		return false
+	}
+	hash := disclosureLeafHash(p.Salt, p.Field, []byte(p.Value))
+	siblings := p.Siblings
+	for i, n := p.Index, p.Count; n > 1; i, n = i/2, (n+1)/2 {
+		sib := i ^ 1
+		if sib >= n {
+			continue
+		}
+		if len(siblings) == 0 {
+			return false
+		}
+		if i%2 == 0 {
+			hash = disclosureNodeHash(hash, siblings[0])
+		} else {
+			hash = disclosureNodeHash(siblings[0], hash)
+		}
+		siblings = siblings[1:]
+	}
+	return len(siblings) == 0 && hex.EncodeToString(hash) == root
+}
+
+// normalizeJSON returns v as it would be decoded from JSON so that values can be compared
+func normalizeJSON(v interface{}) (n interface{}, j []byte, err error) {
+	if j, err = json.Marshal(v); err != nil {
+		return
+	}
+	err = json.Unmarshal(j, &n)
+	return
+}
+
+// MakeProof makes a proof that the agent's chain holds an entry of the given type whose
+// field has the value.  The most recently committed matching entry is used.
+func (h *Holochain) MakeProof(entryType string, field string, value interface{}) (p *Proof, err error) {
+	var def *EntryDef
+	if _, def, err = h.GetEntryDef(entryType); err != nil {
+		return
+	}
+	if def.DataFormat != DataFormatJSON {
+		err = ErrProofFormat
+		return
+	}
+	if !def.Disclosable {
+		err = ErrNotDisclosable
+		return
+	}
+	want, _, err := normalizeJSON(value)
+	if err != nil {
+		return
+	}
+	var found *Header
+	var foundContent string
+	errFound := errors.New("found")
+	err = h.chain.Walk(func(key *Hash, hd *Header, e Entry) error {
+		if hd.Type != entryType || hd.Meta[DisclosureMetaKey] == "" {
+			return nil
+		}
+		s, err := entryContentString(e.Content())
+		if err != nil {
+			return nil
+		}
+		var content interface{}
+		if json.Unmarshal([]byte(s), &content) != nil {
+			return nil
+		}
+		if v, ok := entryField(content, field); ok && reflect.DeepEqual(v, want) {
+			found = hd
+			foundContent = s
+			return errFound
+		}
+		return nil
+	})
+	if err != errFound {
+		if err == nil {
+			err = ErrNoMatchingEntry
+		}
+		return
+	}
+	err = nil
+
+	_, leaves, hashes, err := disclosureRoot(foundContent)
+	if err != nil {
+		return
+	}
+	index := -1
+	for i, l := range leaves {
+		if l.path == field {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		// the field is an object, whose fields are committed to separately
+		err = ErrNoMatchingEntry
+		return
+	}
+	_, siblings := disclosureTree(hashes, index)
+
+	p = &Proof{
+		Agent:    h.nodeIDStr,
+		Field:    field,
+		Value:    string(leaves[index].value),
+		Salt:     disclosureSalt(foundContent, field),
+		Index:    index,
+		Count:    len(leaves),
+		Siblings: siblings,
+		Time:     time.Now(),
+	}
+	if p.Key, err = ic.MarshalPublicKey(h.agent.PubKey()); err != nil {
+		return
+	}
+	if p.Header, err = found.Marshal(); err != nil {
+		return
+	}
+	p.Sig, err = Sign(h.agent.PrivKey(), p.claimData())
+	return
+}
+
+// VerifyProof checks that a proof was made by the agent it names, that the header it
+// carries was signed by that agent and published on its chain, and that the value is
+// the one committed to in the header, returning what it establishes
+func (h *Holochain) VerifyProof(p *Proof) (claim ProofClaim, err error) {
+	var pub ic.PubKey
+	if pub, err = ic.UnmarshalPublicKey(p.Key); err != nil {
+		err = fmt.Errorf("%w: %w", ErrBadProof, err)
+		return
+	}
+	var id peer.ID
+	if id, err = peer.IDFromPublicKey(pub); err != nil {
+		return
+	}
+	if peer.IDB58Encode(id) != p.Agent {
+		err = fmt.Errorf("%w: key isn't the agent's", ErrBadProof)
+		return
+	}
+	if err = h.CheckSigAlgorithm(p.Sig.A); err != nil {
+		return
+	}
+	valid, err := p.Sig.Verify(pub, p.claimData())
+	if err != nil || !valid {
+		err = fmt.Errorf("%w: bad signature", ErrBadProof)
+		return
+	}
+
+	var hd Header
+	if err = hd.Unmarshal(p.Header, 34); err != nil {
+		err = fmt.Errorf("%w: %w", ErrBadProof, err)
+		return
+	}
+	var data []byte
+	if data, err = hd.signedData(); err != nil {
+		return
+	}
+	valid, err = hd.Sig.Verify(pub, data)
+	if err != nil || !valid {
+		err = fmt.Errorf("%w: bad header signature", ErrBadProof)
+		return
+	}
+	// holders only check the disclosure root of entries whose type is disclosable
+	var def *EntryDef
+	if _, def, err = h.GetEntryDef(hd.Type); err != nil {
+		err = fmt.Errorf("%w: %w", ErrBadProof, err)
+		return
+	}
+	if !def.Disclosable {
+		err = fmt.Errorf("%w: %w", ErrBadProof, ErrNotDisclosable)
+		return
+	}
+	if !p.verifyDisclosure(hd.Meta[DisclosureMetaKey]) {
+		err = fmt.Errorf("%w: value isn't committed to in the entry", ErrBadProof)
+		return
+	}
+	var headerHash Hash
+	if headerHash, _, err = hd.Sum(h.hashSpec); err != nil {
+		return
+	}
+	if err = h.checkPublishedHeader(id, headerHash); err != nil {
+		return
+	}
+
+	claim = ProofClaim{
+		Agent:      p.Agent,
+		EntryType:  hd.Type,
+		EntryHash:  hd.EntryLink.String(),
+		HeaderHash: headerHash.String(),
+		Committed:  hd.Time,
+		Field:      p.Field,
+		Time:       p.Time,
+	}
+	if err = json.Unmarshal([]byte(p.Value), &claim.Value); err != nil {
+		err = fmt.Errorf("%w: %w", ErrBadProof, err)
+	}
+	return
+}
+
+// checkPublishedHeader checks that the header is one the agent published to the DHT, so
+// a proof can't be made from a header that isn't on the agent's chain
+func (h *Holochain) checkPublishedHeader(agent peer.ID, headerHash Hash) (err error) {
+	var r interface{}
+	if r, err = NewGetHeadersAction(HeadersReq{Source: agent}).Do(h); err != nil {
+		return
+	}
+	for _, hd := range r.(HeadersResp).Headers {
+		var hash Hash
+		if hash, _, err = hd.Sum(h.hashSpec); err != nil {
+			return
+		}
+		if hash.Equal(&headerHash) {
+			return
+		}
+	}
+	err = fmt.Errorf("%w: header isn't on the agent's published chain", ErrBadProof)
+	return
+}
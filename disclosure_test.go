@@ -0,0 +1,152 @@
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestEntryField(t *testing.T) {
+	var entry interface{}
+	json.Unmarshal([]byte(`{"name":{"first":"Zippy"},"age":3}`), &entry)
+
+	Convey("fields should be found by dotted path", t, func() {
+		v, ok := entryField(entry, "name.first")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, "Zippy")
+		v, ok = entryField(entry, "age")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, float64(3))
+		_, ok = entryField(entry, "age.years")
+		So(ok, ShouldBeFalse)
+		_, ok = entryField(entry, "name.last")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestDisclosureTree(t *testing.T) {
+	Convey("every field's path should lead to the root", t, func() {
+		for n := 1; n <= 7; n++ {
+			var hashes [][]byte
+			for i := 0; i < n; i++ {
+				hashes = append(hashes, disclosureLeafHash([]byte{byte(i)}, fmt.Sprintf("f%d", i), []byte("1")))
+			}
+			for i := 0; i < n; i++ {
+				root, siblings := disclosureTree(hashes, i)
+				p := Proof{Field: fmt.Sprintf("f%d", i), Value: "1", Salt: []byte{byte(i)}, Index: i, Count: n, Siblings: siblings}
+				So(p.verifyDisclosure(fmt.Sprintf("%x", root)), ShouldBeTrue)
+				p.Value = "2"
+				So(p.verifyDisclosure(fmt.Sprintf("%x", root)), ShouldBeFalse)
+			}
+		}
+	})
+}
+
+func TestProofs(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	_, def, _ := h.GetEntryDef("profile")
+	Convey("proofs should only be made for disclosable entry types", t, func() {
+		commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead","age":42}`)
+		_, err := h.MakeProof("profile", "age", 42)
+		So(err, ShouldEqual, ErrNotDisclosable)
+	})
+
+	def.Disclosable = true
+	defer func() { def.Disclosable = false }()
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead","age":42}`)
+
+	Convey("disclosable entries should commit to their fields in their header", t, func() {
+		hd, _ := h.chain.GetEntryHeader(profileHash)
+		root, _, _, err := disclosureRoot(`{"firstName":"Zippy","lastName":"Pinhead","age":42}`)
+		So(err, ShouldBeNil)
+		So(hd.Meta[DisclosureMetaKey], ShouldEqual, root)
+
+		e := GobEntry{C: `{"firstName":"Zippy","lastName":"Pinhead","age":43}`}
+		So(checkDisclosureRoot(def, hd, &e), ShouldEqual, ErrDisclosureMismatch)
+	})
+
+	Convey("only public json entry types should be disclosable", t, func() {
+		def.Sharing = Encrypted
+		err := h.nucleus.dna.check()
+		So(err.Error(), ShouldContainSubstring, ErrDisclosableSharing.Error())
+		def.Sharing = Public
+	})
+
+	Convey("proofs should only be made for matching json entries", t, func() {
+		_, err := h.MakeProof("profile", "firstName", "Griffy")
+		So(err, ShouldEqual, ErrNoMatchingEntry)
+		_, err = h.MakeProof("profile", "age", "42")
+		So(err, ShouldEqual, ErrNoMatchingEntry)
+		_, err = h.MakeProof("oddNumbers", "x", 1)
+		So(err, ShouldEqual, ErrProofFormat)
+	})
+
+	Convey("proofs should verify without the rest of the entry", t, func() {
+		p, err := h.MakeProof("profile", "age", 42)
+		So(err, ShouldBeNil)
+		So(p.Agent, ShouldEqual, h.nodeIDStr)
+		So(string(p.Header), ShouldNotContainSubstring, "Pinhead")
+
+		claim, err := h.VerifyProof(p)
+		So(err, ShouldBeNil)
+		So(claim.Agent, ShouldEqual, h.nodeIDStr)
+		So(claim.EntryType, ShouldEqual, "profile")
+		So(claim.EntryHash, ShouldEqual, profileHash.String())
+		So(claim.Field, ShouldEqual, "age")
+		So(claim.Value, ShouldEqual, float64(42))
+
+		hd, _ := h.chain.GetEntryHeader(profileHash)
+		headerHash, _, _ := hd.Sum(h.hashSpec)
+		So(claim.HeaderHash, ShouldEqual, headerHash.String())
+	})
+
+	Convey("tampered proofs should fail to verify", t, func() {
+		p, _ := h.MakeProof("profile", "firstName", "Zippy")
+		p.Value = `"Griffy"`
+		_, err := h.VerifyProof(p)
+		So(err.Error(), ShouldEqual, ErrBadProof.Error()+": bad signature")
+
+		p, _ = h.MakeProof("profile", "firstName", "Zippy")
+		other, _ := makePeer("peer_a")
+		p.Agent = other.Pretty()
+		_, err = h.VerifyProof(p)
+		So(err.Error(), ShouldEqual, ErrBadProof.Error()+": key isn't the agent's")
+	})
+
+	Convey("proofs of values the entry doesn't hold should fail to verify even when signed", t, func() {
+		p, _ := h.MakeProof("profile", "firstName", "Zippy")
+		p.Value = `"Griffy"`
+		p.Sig, _ = Sign(h.agent.PrivKey(), p.claimData())
+		_, err := h.VerifyProof(p)
+		So(err.Error(), ShouldEqual, ErrBadProof.Error()+": value isn't committed to in the entry")
+	})
+
+	Convey("proofs from headers that aren't on the agent's published chain should fail to verify", t, func() {
+		p, _ := h.MakeProof("profile", "firstName", "Zippy")
+		var hd Header
+		hd.Unmarshal(p.Header, 34)
+		hd.Time = hd.Time.Add(time.Minute)
+		data, _ := hd.signedData()
+		hd.Sig, _ = Sign(h.agent.PrivKey(), data)
+		p.Header, _ = hd.Marshal()
+		p.Sig, _ = Sign(h.agent.PrivKey(), p.claimData())
+		_, err := h.VerifyProof(p)
+		So(err.Error(), ShouldEqual, ErrBadProof.Error()+": header isn't on the agent's published chain")
+	})
+
+	Convey("proofs should be available from the ribosome", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r, err := z.Run(`verifyProof(makeProof("profile","lastName","Pinhead")).EntryType`)
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, "profile")
+		r, err = z.Run(`verifyProof(makeProof("profile","age",42)).Value`)
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, "42")
+	})
+}
@@ -0,0 +1,258 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// encryption implements sealing app messages to the recipient's agent key and
+// authenticating them to the recipient deniably
+
+package holochain
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"math/big"
+)
+
+var ErrNoPeerKey = errors.New("no public key for peer")
+var ErrNotEd25519Key = errors.New("encryption requires an ed25519 key")
+var ErrDecryptFailed = errors.New("unable to decrypt message")
+var ErrBadMessageAuth = errors.New("bad message authentication")
+
+// SealedBox is a payload encrypted to a recipient with a one-time sender key
+type SealedBox struct {
+	Key   [32]byte // the sender's one-time curve25519 public key
+	Nonce [24]byte
+	Box   []byte
+}
+
+// curve25519P is the field prime 2^255-19 shared by ed25519 and curve25519
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// ed25519Raw returns the raw key bytes from a marshaled libp2p ed25519 key
+func ed25519Raw(marshaled []byte) (raw []byte, err error) {
+	// the protobuf encoding is the key type field followed by the data field
+	if len(marshaled) < 4 || marshaled[0] != 0x08 || marshaled[1] != 0x01 || marshaled[2] != 0x12 || int(marshaled[3]) != len(marshaled)-4 {
+		err = ErrNotEd25519Key
+		return
+	}
+	raw = marshaled[4:]
+	return
+}
+
+// curve25519PublicKey converts an ed25519 public key to the curve25519 key for the same
+// secret, i.e. the montgomery u = (1+y)/(1-y) of the edwards point
+func curve25519PublicKey(pub ic.PubKey) (key *[32]byte, err error) {
+	var b []byte
+	if b, err = ic.MarshalPublicKey(pub); err != nil {
+		return
+	}
+	if b, err = ed25519Raw(b); err != nil {
+		return
+	}
+	if len(b) != 32 {
+		err = ErrNotEd25519Key
+		return
+	}
+	// the key is little endian with the sign of x in the top bit
+	be := make([]byte, 32)
+	for i := range b {
+		be[31-i] = b[i]
+	}
+	be[0] &= 0x7f
+	y := new(big.Int).SetBytes(be)
+	num := new(big.Int).Add(big.NewInt(1), y)
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, curve25519P)
+	if den.Sign() == 0 {
+		err = ErrNotEd25519Key
+		return
+	}
+	u := num.Mul(num, den.ModInverse(den, curve25519P))
+	u.Mod(u, curve25519P)
+	ub := u.Bytes()
+	key = new([32]byte)
+	for i := range ub {
+		key[i] = ub[len(ub)-1-i]
+	}
+	return
+}
+
+// curve25519PrivateKey converts an ed25519 private key to its curve25519 secret
+func curve25519PrivateKey(priv ic.PrivKey) (key *[32]byte, err error) {
+	var b []byte
+	if b, err = ic.MarshalPrivateKey(priv); err != nil {
+		return
+	}
+	if b, err = ed25519Raw(b); err != nil {
+		return
+	}
+	if len(b) < 32 {
+		err = ErrNotEd25519Key
+		return
+	}
+	// the secret scalar is the clamped first half of the hash of the seed
+	digest := sha512.Sum512(b[:32])
+	digest[0] &= 248
+	digest[31] &= 127
+	digest[31] |= 64
+	key = new([32]byte)
+	copy(key[:], digest[:32])
+	return
+}
+
+// Seal encrypts data so that only the holder of the private key for pub can read it
+func Seal(pub ic.PubKey, data []byte) (s *SealedBox, err error) {
+	var to *[32]byte
+	if to, err = curve25519PublicKey(pub); err != nil {
+		return
+	}
+	var epub, epriv *[32]byte
+	if epub, epriv, err = box.GenerateKey(rand.Reader); err != nil {
+		return
+	}
+	s = &SealedBox{Key: *epub}
+	if _, err = rand.Read(s.Nonce[:]); err != nil {
+		return
+	}
+	s.Box = box.Seal(nil, data, &s.Nonce, to, epriv)
+	return
+}
+
+// Open decrypts a sealed box with the recipient's private key
+func (s *SealedBox) Open(priv ic.PrivKey) (data []byte, err error) {
+	var key *[32]byte
+	if key, err = curve25519PrivateKey(priv); err != nil {
+		return
+	}
+	var ok bool
+	data, ok = box.Open(nil, s.Box, &s.Nonce, &s.Key, key)
+	if !ok {
+		err = ErrDecryptFailed
+	}
+	return
+}
+
+// sealAppMsg encrypts the body of an app message to the recipient's key
+func (h *Holochain) sealAppMsg(to peer.ID, m *AppMsg) (err error) {
+	var pub ic.PubKey
+	if pub, err = h.peerKey(to); err != nil {
+		return
+	}
+	if m.Enc, err = Seal(pub, []byte(m.Body)); err != nil {
+		return
+	}
+	m.Body = ""
+	return
+}
+
+// openAppMsg returns the body of an app message, decrypting it if it was sealed
+func (h *Holochain) openAppMsg(m AppMsg) (body string, err error) {
+	if m.Enc == nil {
+		body = m.Body
+		return
+	}
+	var data []byte
+	data, err = m.Enc.Open(h.agent.PrivKey())
+	body = string(data)
+	return
+}
+
+// DeniableAuth authenticates an app message to its recipient with a MAC keyed by an
+// exchange between the sender's agent and one-time keys and the recipient's agent key.
+// The recipient knows who sent the message, but as it could have made the MAC itself it
+// can't prove that to anyone else.
+type DeniableAuth struct {
+	Key [32]byte // the sender's one-time curve25519 public key
+	MAC []byte
+}
+
+// deniableMAC returns the MAC of data keyed by the two shared secrets of the exchange
+// and the one-time key
+func deniableMAC(agentSecret *[32]byte, oneTimeSecret *[32]byte, oneTimeKey *[32]byte, data []byte) []byte {
+	k := sha256.New()
+	k.Write(agentSecret[:])
+	k.Write(oneTimeSecret[:])
+	k.Write(oneTimeKey[:])
+	mac := hmac.New(sha256.New, k.Sum(nil))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// authAppMsg authenticates the body of an app message to the recipient
+func (h *Holochain) authAppMsg(to peer.ID, m *AppMsg) (err error) {
+	var pub ic.PubKey
+	if pub, err = h.peerKey(to); err != nil {
+		return
+	}
+	var recipient, me *[32]byte
+	if recipient, err = curve25519PublicKey(pub); err != nil {
+		return
+	}
+	if me, err = curve25519PrivateKey(h.agent.PrivKey()); err != nil {
+		return
+	}
+	var epub, epriv *[32]byte
+	if epub, epriv, err = box.GenerateKey(rand.Reader); err != nil {
+		return
+	}
+	var s1, s2 [32]byte
+	curve25519.ScalarMult(&s1, me, recipient)
+	curve25519.ScalarMult(&s2, epriv, recipient)
+	m.Auth = &DeniableAuth{Key: *epub, MAC: deniableMAC(&s1, &s2, epub, []byte(m.Body))}
+	return
+}
+
+// checkAppMsgAuth checks that an app message was authenticated by its sender
+func (h *Holochain) checkAppMsgAuth(from peer.ID, m AppMsg) (err error) {
+	var pub ic.PubKey
+	if pub, err = h.peerKey(from); err != nil {
+		err = ErrBadMessageAuth
+		return
+	}
+	var sender, me *[32]byte
+	if sender, err = curve25519PublicKey(pub); err != nil {
+		return
+	}
+	if me, err = curve25519PrivateKey(h.agent.PrivKey()); err != nil {
+		return
+	}
+	var s1, s2 [32]byte
+	curve25519.ScalarMult(&s1, me, sender)
+	curve25519.ScalarMult(&s2, me, &m.Auth.Key)
+	if !hmac.Equal(m.Auth.MAC, deniableMAC(&s1, &s2, &m.Auth.Key, []byte(m.Body))) {
+		err = ErrBadMessageAuth
+	}
+	return
+}
+
+// peerKey returns the current public key of a node.  Keys are taken from the peerstore,
+// where they are cached when a connection is made, so if there is none a connection is
+// made to fetch it.
+func (h *Holochain) peerKey(id peer.ID) (pub ic.PubKey, err error) {
+	if id == h.nodeID {
+		pub = h.agent.PubKey()
+		return
+	}
+	ps := h.node.Host.Peerstore()
+	pub = ps.PubKey(id)
+	if pub == nil {
+		if e := h.node.Host.Connect(context.Background(), ps.PeerInfo(id)); e != nil {
+			h.dht.dlog.Logf("unable to connect to %v for its key: %v", id, e)
+		}
+		pub = ps.PubKey(id)
+	}
+	// the key must be the one the node id was made from
+	if pub == nil || !id.MatchesPublicKey(pub) {
+		pub = nil
+		err = ErrNoPeerKey
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package holochain
+
+import (
+	"crypto/rand"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/curve25519"
+	"testing"
+)
+
+func TestCurve25519Keys(t *testing.T) {
+	Convey("converted keys should be a curve25519 key pair", t, func() {
+		priv, pub, err := ic.GenerateEd25519Key(rand.Reader)
+		So(err, ShouldBeNil)
+		cpriv, err := curve25519PrivateKey(priv)
+		So(err, ShouldBeNil)
+		cpub, err := curve25519PublicKey(pub)
+		So(err, ShouldBeNil)
+		var derived [32]byte
+		curve25519.ScalarBaseMult(&derived, cpriv)
+		So(derived, ShouldResemble, *cpub)
+	})
+
+	Convey("only ed25519 keys should be converted", t, func() {
+		_, err := ed25519Raw([]byte{0x08, 0x00, 0x12, 0x01, 0x00})
+		So(err, ShouldEqual, ErrNotEd25519Key)
+		_, err = ed25519Raw([]byte{0x08, 0x01, 0x12, 0x02, 0x00})
+		So(err, ShouldEqual, ErrNotEd25519Key)
+	})
+}
+
+func TestSealedBox(t *testing.T) {
+	priv, pub, _ := ic.GenerateEd25519Key(rand.Reader)
+	other, _, _ := ic.GenerateEd25519Key(rand.Reader)
+
+	Convey("sealed data should only open with the recipient's key", t, func() {
+		s, err := Seal(pub, []byte("secret"))
+		So(err, ShouldBeNil)
+		So(string(s.Box), ShouldNotContainSubstring, "secret")
+		data, err := s.Open(priv)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "secret")
+		_, err = s.Open(other)
+		So(err, ShouldEqual, ErrDecryptFailed)
+	})
+
+	Convey("each seal should use a new key and nonce", t, func() {
+		s1, _ := Seal(pub, []byte("secret"))
+		s2, _ := Seal(pub, []byte("secret"))
+		So(s1.Key, ShouldNotResemble, s2.Key)
+		So(s1.Nonce, ShouldNotResemble, s2.Nonce)
+	})
+}
+
+func TestEncryptedSend(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	var received interface{}
+	h.AddHook(HookOnReceive, func(ctx *HookContext) error {
+		received = ctx.Args
+		return nil
+	})
+
+	Convey("encrypted messages should be decrypted for receive and the reply", t, func() {
+		a := NewSendAction(h.node.HashAddr, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		a.options.Encrypted = true
+		r, err := a.Do(h)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, `{"pong":"foobar"}`)
+		So(a.msg.Body, ShouldEqual, "")
+		So(a.msg.Enc, ShouldNotBeNil)
+		So(received, ShouldEqual, `{"ping":"foobar"}`)
+	})
+
+	Convey("encrypted messages can also be signed with a one-time key", t, func() {
+		a := NewSendAction(h.node.HashAddr, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"both"}`})
+		a.options.Encrypted = true
+		a.options.Ephemeral = true
+		r, err := a.Do(h)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, `{"pong":"both"}`)
+	})
+
+	Convey("messages that don't decrypt should fail", t, func() {
+		s, _ := Seal(h.agent.PubKey(), []byte(`{"ping":"foobar"}`))
+		s.Box[0] ^= 0xff
+		_, err := h.Send(ActionProtocol, h.node.HashAddr, APP_MESSAGE, AppMsg{ZomeType: "jsSampleZome", Enc: s})
+		So(err, ShouldEqual, ErrDecryptFailed)
+	})
+
+	Convey("send should take the Encrypted option", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = z.Run(`JSON.parse(send(App.Key.Hash,{ping:"secret"},{Encrypted:true})).pong`)
+		So(err, ShouldBeNil)
+		So(z.(*JSRibosome).lastResult.String(), ShouldEqual, "secret")
+	})
+
+	Convey("keys of unknown peers should not be found", t, func() {
+		id, _ := makePeer("peer_nowhere")
+		_, err := h.peerKey(id)
+		So(err, ShouldEqual, ErrNoPeerKey)
+	})
+}
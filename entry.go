@@ -9,14 +9,20 @@ package holochain
 import (
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"github.com/lestrrat/go-jsval"
 	"io"
+	"strings"
 )
 
 const (
 
 	// System defined entry types
 
+	// SystemEntryTypePrefix is reserved for entry types defined by holochain which
+	// apps may not commit, modify or delete
+	SystemEntryTypePrefix = "%"
+
 	DNAEntryType   = "%dna"
 	AgentEntryType = "%agent"
 	KeyEntryType   = "%%key" // virtual entry type, not actually on the chain
@@ -28,11 +34,14 @@ const (
 	DataFormatString  = "string"
 	DataFormatRawJS   = "js"
 	DataFormatRawZygo = "zygo"
+	DataFormatBinary  = "binary" // base64 to apps, stored as a []byte
+	DataFormatCBOR    = "cbor"   // JSON to apps, stored as CBOR
 
 	// Entry sharing types
 
-	Public  = "public"
-	Partial = "partial"
+	Public    = "public"
+	Partial   = "partial"
+	Encrypted = "encrypted" // published sealed, readable with a token from the author
 )
 
 // AgentEntry structure for building KeyEntryType entries
@@ -53,6 +62,9 @@ type Link struct {
 	Base       string // hash of entry (perhaps elsewhere) tow which we are attaching the link
 	Link       string // hash of entry being linked to
 	Tag        string // tag
+	// SortKey optionally orders the link for getLink's SortBy option, numerically if
+	// the keys are numbers.  Like the rest of the link it is checked by validateLink.
+	SortKey string `json:",omitempty"`
 }
 
 // DelEntry struct holds the record of an entry's deletion
@@ -66,8 +78,24 @@ type EntryDef struct {
 	Name       string
 	DataFormat string
 	Sharing    string
-	Schema     string
-	validator  SchemaValidator
+	// Schema is a JSON Schema document that JSON entries of the type are checked
+	// against before the app's validation functions are called
+	Schema string
+	// Ephemeral entries are signed with a one-time key so the signature can't be
+	// attributed to the agent or linked to its other entries
+	Ephemeral bool
+	validator SchemaValidator
+	// TTL is how many seconds after they were committed entries expire, or 0 if they
+	// don't.  It is part of the DNA so every holder expires an entry at the same time.
+	TTL int
+	// Disclosable public JSON entries carry a commitment to each of their fields in their
+	// header, so the agent can prove a field's value without revealing the entry
+	Disclosable bool
+}
+
+// isShared returns whether entries of the type are published to the DHT
+func (d *EntryDef) isShared() bool {
+	return d.Sharing == Public || d.Sharing == Encrypted
 }
 
 // Entry describes serialization and deserialziation of entry data
@@ -93,6 +121,13 @@ type JSONEntry struct {
 	C interface{}
 }
 
+var ErrReservedEntryType = errors.New("entry type is reserved for system use")
+
+// IsSystemEntryType returns true if the entry type is in the reserved system namespace
+func IsSystemEntryType(entryType string) bool {
+	return strings.HasPrefix(entryType, SystemEntryTypePrefix)
+}
+
 // MarshalEntry serializes an entry to a writer
 func MarshalEntry(writer io.Writer, e Entry) (err error) {
 	var b []byte
@@ -193,6 +228,8 @@ func (d *EntryDef) BuildJSONSchemaValidator(path string) (err error) {
 	return
 }
 
+// BuildJSONSchemaValidatorFromString builds a validator in an EntryDef from a schema
+// document
 func (d *EntryDef) BuildJSONSchemaValidatorFromString(schema string) (err error) {
 	validator, err := BuildJSONSchemaValidatorFromString(schema)
 	if err != nil {
@@ -202,3 +239,13 @@ func (d *EntryDef) BuildJSONSchemaValidatorFromString(schema string) (err error)
 	d.validator = validator
 	return
 }
+
+// buildSchemaValidator builds the validator for the Schema of a JSON entry type if it
+// hasn't been built already, as when the DNA is loaded from a schema file
+func (d *EntryDef) buildSchemaValidator() (err error) {
+	if d.validator != nil || d.Schema == "" || d.DataFormat != DataFormatJSON {
+		return
+	}
+	err = d.BuildJSONSchemaValidatorFromString(d.Schema)
+	return
+}
@@ -97,6 +97,22 @@ func TestJSONSchemaValidator(t *testing.T) {
 		err := ed.BuildJSONSchemaValidatorFromString(schema)
 		testValidateJSON(ed, err)
 	})
+
+	Convey("checking the DNA should build validators for the schemas of JSON entry types", t, func() {
+		dna := DNA{Zomes: []Zome{{Name: "z", Entries: []EntryDef{
+			{Name: "schema_profile.json", DataFormat: DataFormatJSON, Schema: schema},
+			{Name: "notes", DataFormat: DataFormatString, Schema: "not a JSON schema"},
+		}}}}
+		err := dna.check()
+		testValidateJSON(dna.Zomes[0].Entries[0], err)
+		So(dna.Zomes[0].Entries[1].validator, ShouldBeNil)
+
+		dna.Zomes[0].Entries[0].validator = nil
+		dna.Zomes[0].Entries[0].Schema = "{"
+		err = dna.check()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "schema for entry type schema_profile.json in zome z")
+	})
 }
 
 func TestMarshalEntry(t *testing.T) {
@@ -0,0 +1,120 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// errors holds the errors of the Go API that embedders are meant to act on.  Errors
+// that add detail to one of them wrap it, so test for them with errors.Is and errors.As
+// rather than by comparing.
+
+package holochain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrValidationFailed is returned when an entry or action fails the app's validation
+var ErrValidationFailed = errors.New("Validation Failed")
+
+// ErrTimeout is returned when a call doesn't finish before its deadline
+var ErrTimeout = errors.New("call timed out")
+
+// ErrUnauthorized is returned when a function isn't exposed to the caller
+var ErrUnauthorized = errors.New("function not available")
+
+// ErrInvalidArgs is returned when a built-in function is called with the wrong arguments
+var ErrInvalidArgs = errors.New("invalid arguments")
+
+// ValidationError is returned when committing an entry that fails validation
+type ValidationError struct {
+	Entry interface{} // the content of the invalid entry
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid entry: %v", e.Entry)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidationFailed
+}
+
+// wrappedError is an error with a message of its own that is one of the errors above
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string {
+	return e.msg
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// Error codes are the stable names given to apps for the errors they may want to act on,
+// so that they can tell them apart without parsing messages
+const (
+	ErrorCodeUnknown           = "Unknown"
+	ErrorCodeHashNotFound      = "HashNotFound"
+	ErrorCodeHashDeleted       = "HashDeleted"
+	ErrorCodeHashModified      = "HashModified"
+	ErrorCodeHashRejected      = "HashRejected"
+	ErrorCodeHashExpired       = "HashExpired"
+	ErrorCodeHashPending       = "HashPending"
+	ErrorCodeHashCustomStatus  = "HashCustomStatus"
+	ErrorCodeEntryTypeMismatch = "EntryTypeMismatch"
+	ErrorCodeCorruptRecord     = "CorruptRecord"
+	ErrorCodeLinkNotFound      = "LinkNotFound"
+	ErrorCodeValidationFailed  = "ValidationFailed"
+	ErrorCodeUnauthorized      = "Unauthorized"
+	ErrorCodeTimeout           = "Timeout"
+	ErrorCodeInvalidArgs       = "InvalidArguments"
+	ErrorCodeReservedEntryType = "ReservedEntryType"
+	ErrorCodeNetworkFork       = "NetworkFork"
+	ErrorCodeRejectedByPolicy  = "RejectedByPolicy"
+)
+
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrHashNotFound, ErrorCodeHashNotFound},
+	{ErrHashDeleted, ErrorCodeHashDeleted},
+	{ErrHashModified, ErrorCodeHashModified},
+	{ErrHashRejected, ErrorCodeHashRejected},
+	{ErrHashExpired, ErrorCodeHashExpired},
+	{ErrHashPending, ErrorCodeHashPending},
+	{ErrHashCustomStatus, ErrorCodeHashCustomStatus},
+	{ErrEntryTypeMismatch, ErrorCodeEntryTypeMismatch},
+	{ErrCorruptRecord, ErrorCodeCorruptRecord},
+	{ErrLinkNotFound, ErrorCodeLinkNotFound},
+	{ErrValidationFailed, ErrorCodeValidationFailed},
+	{ErrUnauthorized, ErrorCodeUnauthorized},
+	{ErrTimeout, ErrorCodeTimeout},
+	{ErrInvalidArgs, ErrorCodeInvalidArgs},
+	{ErrReservedEntryType, ErrorCodeReservedEntryType},
+	{ErrNetworkFork, ErrorCodeNetworkFork},
+	{ErrRejectedByPolicy, ErrorCodeRejectedByPolicy},
+}
+
+// ErrorCode returns the code of the error that err is or wraps, or ErrorCodeUnknown
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ErrorCodeUnknown
+}
+
+// contextErr returns the error for a call ended by its context, which when the deadline
+// passed is both ErrTimeout and ctx.Err()
+func contextErr(ctx context.Context) (err error) {
+	err = ctx.Err()
+	if err == context.DeadlineExceeded {
+		err = fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return
+}
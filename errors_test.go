@@ -0,0 +1,59 @@
+package holochain
+
+import (
+	"context"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	Convey("validation errors should be ErrValidationFailed", t, func() {
+		var err error = &ValidationError{Entry: "41"}
+		So(err.Error(), ShouldEqual, "Invalid entry: 41")
+		So(errors.Is(err, ErrValidationFailed), ShouldBeTrue)
+		So(errors.Is(err, ValidationFailedErr), ShouldBeTrue)
+		var v *ValidationError
+		So(errors.As(err, &v), ShouldBeTrue)
+		So(v.Entry, ShouldEqual, "41")
+	})
+
+	Convey("calls ended by their deadline should be ErrTimeout", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		<-ctx.Done()
+		err := contextErr(ctx)
+		So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		So(contextErr(ctx), ShouldEqual, context.Canceled)
+	})
+
+	Convey("wrapped errors should keep their message and code across the wire", t, func() {
+		var err error = &wrappedError{"No links for 4stars", ErrLinkNotFound}
+		er := NewErrorResponse(err)
+		So(er.Code, ShouldEqual, ErrLinkNotFoundCode)
+		decoded := er.DecodeResponseError()
+		So(decoded.Error(), ShouldEqual, "No links for 4stars")
+		So(errors.Is(decoded, ErrLinkNotFound), ShouldBeTrue)
+
+		er = NewErrorResponse(&ValidationError{Entry: "2"})
+		So(er.Code, ShouldEqual, ErrValidationFailedCode)
+		decoded = er.DecodeResponseError()
+		So(decoded.Error(), ShouldEqual, "Invalid entry: 2")
+		So(errors.Is(decoded, ErrValidationFailed), ShouldBeTrue)
+
+		er = NewErrorResponse(ErrUnauthorized)
+		So(er.DecodeResponseError(), ShouldEqual, ErrUnauthorized)
+	})
+
+	Convey("errors should have the code of the error they wrap", t, func() {
+		So(ErrorCode(&wrappedError{"No links for 4stars", ErrLinkNotFound}), ShouldEqual, ErrorCodeLinkNotFound)
+		So(ErrorCode(&ValidationError{Entry: "41"}), ShouldEqual, ErrorCodeValidationFailed)
+		So(ErrorCode(argErr("string", 1, Arg{Name: "entryType"})), ShouldEqual, ErrorCodeInvalidArgs)
+		So(ErrorCode(errors.New("fish")), ShouldEqual, ErrorCodeUnknown)
+	})
+}
@@ -0,0 +1,177 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// events implements a bus of the things that happen in a holochain, so that embedders
+// and the web server can follow them from one place
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is a kind of event, and sets of them are or'ed together
+type EventType int
+
+const (
+	// EntryCommitted is published when an entry is added to the agent's chain
+	EntryCommitted EventType = 1 << iota
+	// PutReceived is published when an entry put by another node is stored in the DHT
+	PutReceived
+	// GossipCompleted is published when gossip with a node succeeds
+	GossipCompleted
+	// PeerJoined is published when a node is added to the gossip table
+	PeerJoined
+	// SignalEmitted is published when zome code emits a signal for UI clients
+	SignalEmitted
+
+	AllEvents = EntryCommitted | PutReceived | GossipCompleted | PeerJoined | SignalEmitted
+)
+
+var eventTypeNames = map[EventType]string{
+	EntryCommitted:  "EntryCommitted",
+	PutReceived:     "PutReceived",
+	GossipCompleted: "GossipCompleted",
+	PeerJoined:      "PeerJoined",
+	SignalEmitted:   "SignalEmitted",
+}
+
+func (t EventType) String() string {
+	var names []string
+	for _, e := range []EventType{EntryCommitted, PutReceived, GossipCompleted, PeerJoined, SignalEmitted} {
+		if t&e != 0 {
+			names = append(names, eventTypeNames[e])
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// MarshalJSON encodes the type by its name
+func (t EventType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON decodes the type from its name
+func (t *EventType) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(b, &s); err != nil || s == "" {
+		*t = 0
+		return
+	}
+	*t, err = ParseEventTypes(strings.Replace(s, "|", ",", -1))
+	return
+}
+
+// ParseEventTypes returns the event types named in a comma separated list, or all of
+// them for an empty one
+func ParseEventTypes(s string) (types EventType, err error) {
+	if s == "" {
+		types = AllEvents
+		return
+	}
+	for _, name := range strings.Split(s, ",") {
+		found := false
+		for t, n := range eventTypeNames {
+			if n == strings.TrimSpace(name) {
+				types |= t
+				found = true
+			}
+		}
+		if !found {
+			err = fmt.Errorf("unknown event type: %s", name)
+			return
+		}
+	}
+	return
+}
+
+// Event is something that happened in a holochain
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Hash and EntryType are set for EntryCommitted and PutReceived
+	Hash      string `json:",omitempty"`
+	EntryType string `json:",omitempty"`
+	// Peer is the node that put the entry, was gossiped with, or joined
+	Peer string `json:",omitempty"`
+	// Puts is how many puts were received for GossipCompleted
+	Puts int `json:",omitempty"`
+	// Signal, Zome and Payload are set for SignalEmitted, the payload being JSON
+	Signal  string          `json:",omitempty"`
+	Zome    string          `json:",omitempty"`
+	Payload json.RawMessage `json:",omitempty"`
+}
+
+// ErrBadSignalName is returned when emitting a signal without a name
+var ErrBadSignalName = errors.New("signal name must not be empty")
+
+// Emit publishes a signal from a zome to the UI clients subscribed to it.  A payload
+// that is JSON is sent as is and any other string as a JSON string.
+func (h *Holochain) Emit(zome string, name string, payload string) (err error) {
+	if name == "" {
+		err = ErrBadSignalName
+		return
+	}
+	p := json.RawMessage(payload)
+	if !json.Valid(p) {
+		if p, err = json.Marshal(payload); err != nil {
+			return
+		}
+	}
+	h.events.publish(Event{Type: SignalEmitted, Signal: name, Zome: zome, Payload: p})
+	return
+}
+
+// Events is a holochain's event bus
+type Events struct {
+	lk   sync.Mutex
+	subs map[chan<- Event]EventType
+}
+
+// Events returns the holochain's event bus
+func (h *Holochain) Events() *Events {
+	return &h.events
+}
+
+// Subscribe has events of the given types sent on ch until Unsubscribe is called.
+// Events are dropped rather than block the holochain when ch isn't ready for them, so
+// it should be buffered.
+func (e *Events) Subscribe(types EventType, ch chan<- Event) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	if e.subs == nil {
+		e.subs = make(map[chan<- Event]EventType)
+	}
+	e.subs[ch] = types
+}
+
+// Unsubscribe stops events being sent on ch
+func (e *Events) Unsubscribe(ch chan<- Event) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	delete(e.subs, ch)
+}
+
+// publish sends an event to the subscribers of its type
+func (e *Events) publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	for ch, types := range e.subs {
+		if types&ev.Type == 0 {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
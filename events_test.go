@@ -0,0 +1,100 @@
+package holochain
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	events := make(chan Event, 10)
+	h.Events().Subscribe(EntryCommitted|PeerJoined, events)
+
+	Convey("committing should publish EntryCommitted", t, func() {
+		hash := commit(h, "oddNumbers", "7")
+		e := <-events
+		So(e.Type, ShouldEqual, EntryCommitted)
+		So(e.Hash, ShouldEqual, hash.String())
+		So(e.EntryType, ShouldEqual, "oddNumbers")
+	})
+
+	Convey("adding a gossiper should publish PeerJoined once", t, func() {
+		id, _ := makePeer("peer_joined")
+		So(h.dht.UpdateGossiper(id, 0), ShouldBeNil)
+		So(h.dht.UpdateGossiper(id, 2), ShouldBeNil)
+		e := <-events
+		So(e.Type, ShouldEqual, PeerJoined)
+		So(e.Peer, ShouldEqual, id.Pretty())
+		So(len(events), ShouldEqual, 0)
+	})
+
+	Convey("only subscribed events should be sent", t, func() {
+		h.Events().publish(Event{Type: GossipCompleted})
+		So(len(events), ShouldEqual, 0)
+		h.Events().Unsubscribe(events)
+		commit(h, "oddNumbers", "9")
+		So(len(events), ShouldEqual, 0)
+	})
+
+	Convey("emitting should publish SignalEmitted with a JSON payload", t, func() {
+		signals := make(chan Event, 10)
+		h.Events().Subscribe(SignalEmitted, signals)
+		defer h.Events().Unsubscribe(signals)
+		So(h.Emit("jsSampleZome", "newMessage", `{"text":"hi"}`), ShouldBeNil)
+		e := <-signals
+		So(e.Signal, ShouldEqual, "newMessage")
+		So(e.Zome, ShouldEqual, "jsSampleZome")
+		So(string(e.Payload), ShouldEqual, `{"text":"hi"}`)
+		So(h.Emit("jsSampleZome", "typing", "alice"), ShouldBeNil)
+		e = <-signals
+		So(string(e.Payload), ShouldEqual, `"alice"`)
+		So(h.Emit("jsSampleZome", "", "alice"), ShouldEqual, ErrBadSignalName)
+	})
+
+	Convey("zome code should emit signals", t, func() {
+		signals := make(chan Event, 10)
+		h.Events().Subscribe(SignalEmitted, signals)
+		defer h.Events().Unsubscribe(signals)
+		zome, _ := h.GetZome("jsSampleZome")
+		v, _ := NewJSRibosome(h, zome)
+		z := v.(*JSRibosome)
+		_, err := z.Run(`emit("newMessage",{text:"hi"})`)
+		So(err, ShouldBeNil)
+		e := <-signals
+		So(e.Signal, ShouldEqual, "newMessage")
+		So(string(e.Payload), ShouldEqual, `{"text":"hi"}`)
+
+		zome, _ = h.GetZome("zySampleZome")
+		v, _ = NewZygoRibosome(h, zome)
+		zy := v.(*ZygoRibosome)
+		_, err = zy.Run(`(emit "typing" "alice")`)
+		So(err, ShouldBeNil)
+		e = <-signals
+		So(e.Zome, ShouldEqual, "zySampleZome")
+		So(string(e.Payload), ShouldEqual, `"alice"`)
+	})
+
+	Convey("event types should parse from their names", t, func() {
+		types, err := ParseEventTypes("EntryCommitted, PeerJoined")
+		So(err, ShouldBeNil)
+		So(types, ShouldEqual, EntryCommitted|PeerJoined)
+		So(types.String(), ShouldEqual, "EntryCommitted|PeerJoined")
+		types, err = ParseEventTypes("")
+		So(types, ShouldEqual, AllEvents)
+		_, err = ParseEventTypes("Fish")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("events should decode from the JSON they encode to", t, func() {
+		e := Event{Type: PutReceived, Hash: "QmFoo"}
+		b, err := json.Marshal(e)
+		So(err, ShouldBeNil)
+		var d Event
+		err = json.Unmarshal(b, &d)
+		So(err, ShouldBeNil)
+		So(d.Type, ShouldEqual, PutReceived)
+		So(d.Hash, ShouldEqual, "QmFoo")
+	})
+}
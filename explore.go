@@ -0,0 +1,136 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// explore implements read-only inspection of what the DHT holds, for developers
+
+package holochain
+
+import (
+	"github.com/tidwall/buntdb"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DHTLink is a link held on a base hash
+type DHTLink struct {
+	Link   string
+	Tag    string
+	Status int
+}
+
+// DHTRecord is everything the DHT holds about a hash
+type DHTRecord struct {
+	Hash       string
+	EntryType  string
+	Entry      string
+	Status     int
+	Sources    []string
+	ReplacedBy string `json:",omitempty"`
+	Pinned     bool
+	History    []StatusHistory
+	Links      []DHTLink
+}
+
+// HeldHashes returns the hashes held in the DHT, sorted, that are of entryType and were
+// put by source, either of which may be "" to match any
+func (dht *DHT) HeldHashes(entryType string, source string) (hashes []string, err error) {
+	hashes = make([]string, 0)
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		err := tx.Ascend("", func(key, value string) bool {
+			if !strings.HasPrefix(key, "type:") {
+				return true
+			}
+			if entryType != "" && value != entryType {
+				return true
+			}
+			k := key[len("type:"):]
+			if source != "" {
+				var src string
+				src, e = tx.Get("src:" + k)
+				if e == buntdb.ErrNotFound {
+					e = nil
+					return true
+				}
+				if e != nil {
+					return false
+				}
+				if src != source {
+					return true
+				}
+			}
+			hashes = append(hashes, k)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
+	sort.Strings(hashes)
+	return
+}
+
+// Record returns everything the DHT holds about a hash regardless of its status
+func (dht *DHT) Record(key Hash) (record DHTRecord, err error) {
+	k := key.String()
+	record.Hash = k
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var err error
+		record.Entry, err = tx.Get("entry:" + k)
+		if err == buntdb.ErrNotFound {
+			return ErrHashNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if record.EntryType, err = tx.Get("type:" + k); err != nil {
+			return err
+		}
+		var val string
+		if val, err = tx.Get("status:" + k); err != nil {
+			return err
+		}
+		if record.Status, err = strconv.Atoi(val); err != nil {
+			return err
+		}
+		val, err = tx.Get("src:" + k)
+		if err == nil {
+			record.Sources = append(record.Sources, val)
+		} else if err != buntdb.ErrNotFound {
+			return err
+		}
+		val, err = tx.Get("replacedBy:" + k)
+		if err == nil {
+			record.ReplacedBy = val
+		} else if err != buntdb.ErrNotFound {
+			return err
+		}
+		record.Pinned = _isPinned(tx, k)
+		if record.History, err = _getHistory(tx, k); err != nil {
+			return err
+		}
+
+		record.Links = make([]DHTLink, 0)
+		var e error
+		err = tx.Ascend("link", func(key, value string) bool {
+			x := strings.Split(key, ":")
+			if x[1] == k {
+				var status int
+				status, e = strconv.Atoi(value)
+				if e != nil {
+					return false
+				}
+				record.Links = append(record.Links, DHTLink{Link: x[2], Tag: x[3], Status: status})
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
+	return
+}
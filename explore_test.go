@@ -0,0 +1,66 @@
+package holochain
+
+import (
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestExploreDHT(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+
+	baseStr := "QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRr"
+	base, _ := NewHash(baseStr)
+	linkStr := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1"
+	var id peer.ID
+	err := dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: base}), "someType", base, id, []byte("some value"), StatusLive)
+	if err != nil {
+		panic(err)
+	}
+	err = dht.putLink(h.node.NewMessage(LINK_REQUEST, LinkReq{}), baseStr, linkStr, "tag foo")
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should list held hashes by type", t, func() {
+		hashes, err := dht.HeldHashes("someType", "")
+		So(err, ShouldBeNil)
+		So(hashes, ShouldResemble, []string{baseStr})
+
+		hashes, err = dht.HeldHashes("bogusType", "")
+		So(err, ShouldBeNil)
+		So(len(hashes), ShouldEqual, 0)
+
+		hashes, err = dht.HeldHashes("", "")
+		So(err, ShouldBeNil)
+		So(len(hashes), ShouldBeGreaterThan, 1)
+	})
+
+	Convey("it should list held hashes by author", t, func() {
+		hashes, err := dht.HeldHashes("", h.nodeIDStr)
+		So(err, ShouldBeNil)
+		So(hashes, ShouldContain, h.AgentHash().String())
+		So(hashes, ShouldNotContain, baseStr)
+
+		hashes, err = dht.HeldHashes(AgentEntryType, h.nodeIDStr)
+		So(err, ShouldBeNil)
+		So(hashes, ShouldResemble, []string{h.AgentHash().String()})
+	})
+
+	Convey("it should return the full record of a hash", t, func() {
+		record, err := dht.Record(base)
+		So(err, ShouldBeNil)
+		So(record.Hash, ShouldEqual, baseStr)
+		So(record.EntryType, ShouldEqual, "someType")
+		So(record.Entry, ShouldEqual, "some value")
+		So(record.Status, ShouldEqual, StatusLive)
+		So(len(record.History), ShouldEqual, 1)
+		So(record.Links, ShouldResemble, []DHTLink{{Link: linkStr, Tag: "tag foo", Status: StatusLive}})
+
+		missing, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		_, err = dht.Record(missing)
+		So(err, ShouldEqual, ErrHashNotFound)
+	})
+}
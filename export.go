@@ -0,0 +1,127 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// export implements exporting the entries an agent has committed as a zip archive that
+// people can read, so that they can take their data from an app
+
+package holochain
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportManifestFileName is the file describing an export in its archive
+const ExportManifestFileName = "manifest.json"
+
+// ExportManifest describes an export of an agent's data
+type ExportManifest struct {
+	App       string
+	DNA       string
+	Agent     string
+	AgentHash string
+	Time      time.Time
+	Entries   map[string]int // how many entries of each type there are
+	Files     []string
+}
+
+// ExportedEntry is an entry in an export
+type ExportedEntry struct {
+	Hash   string
+	Header string
+	Time   time.Time
+	// Content is the entry as JSON when it is JSON, and otherwise as it was committed
+	Content interface{}
+}
+
+// exportFileName returns the file in the archive for the entries of a type
+func exportFileName(entryType string) string {
+	return "entries/" + strings.TrimLeft(entryType, "%") + ".json"
+}
+
+// exportContent returns the content of an entry as it is best shown
+func (h *Holochain) exportContent(entryType string, entry Entry) (content interface{}) {
+	content = entry.Content()
+	s, ok := content.(string)
+	if !ok {
+		return
+	}
+	_, def, err := h.GetEntryDef(entryType)
+	if err != nil || (def.DataFormat != DataFormatJSON && def.DataFormat != DataFormatLinks) {
+		return
+	}
+	var v interface{}
+	if json.Unmarshal([]byte(s), &v) == nil {
+		content = v
+	}
+	return
+}
+
+// ExportData writes a zip archive of the entries on the agent's chain, oldest first,
+// in a JSON file for each entry type, with a manifest describing them.  The DNA is
+// left out as it is the app's, not the agent's.
+func (h *Holochain) ExportData(w io.Writer) (err error) {
+	entries := make(map[string][]ExportedEntry)
+	err = h.chain.Walk(func(key *Hash, header *Header, entry Entry) (err error) {
+		if header.Type == DNAEntryType {
+			return
+		}
+		e := ExportedEntry{Hash: header.EntryLink.String(), Header: key.String(), Time: header.Time, Content: h.exportContent(header.Type, entry)}
+		entries[header.Type] = append(entries[header.Type], e)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	manifest := ExportManifest{
+		App:       h.nucleus.dna.Name,
+		DNA:       h.dnaHash.String(),
+		Agent:     string(h.agent.Name()),
+		AgentHash: h.agentHash.String(),
+		Time:      time.Now(),
+		Entries:   make(map[string]int),
+	}
+	var types []string
+	for t := range entries {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	z := zip.NewWriter(w)
+	write := func(name string, v interface{}) (err error) {
+		var f io.Writer
+		if f, err = z.Create(name); err != nil {
+			return
+		}
+		var b []byte
+		if b, err = json.MarshalIndent(v, "", "  "); err != nil {
+			return
+		}
+		_, err = f.Write(b)
+		return
+	}
+	for _, t := range types {
+		es := entries[t]
+		// the chain is walked from the top
+		for i, j := 0, len(es)-1; i < j; i, j = i+1, j-1 {
+			es[i], es[j] = es[j], es[i]
+		}
+		name := exportFileName(t)
+		if err = write(name, es); err != nil {
+			return
+		}
+		manifest.Entries[t] = len(es)
+		manifest.Files = append(manifest.Files, name)
+	}
+	if err = write(ExportManifestFileName, manifest); err != nil {
+		return
+	}
+	err = z.Close()
+	return
+}
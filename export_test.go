@@ -0,0 +1,60 @@
+package holochain
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+func TestExportData(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	commit(h, "oddNumbers", "7")
+	commit(h, "oddNumbers", "9")
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+
+	var b bytes.Buffer
+	err := h.ExportData(&b)
+	z, _ := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	read := func(name string, v interface{}) {
+		for _, f := range z.File {
+			if f.Name == name {
+				r, _ := f.Open()
+				data, _ := ioutil.ReadAll(r)
+				if err := json.Unmarshal(data, v); err != nil {
+					panic(err)
+				}
+				return
+			}
+		}
+		panic("no file " + name)
+	}
+
+	Convey("the export should have a manifest", t, func() {
+		So(err, ShouldBeNil)
+		var m ExportManifest
+		read(ExportManifestFileName, &m)
+		So(m.DNA, ShouldEqual, h.dnaHash.String())
+		So(m.AgentHash, ShouldEqual, h.agentHash.String())
+		So(m.Entries["oddNumbers"], ShouldEqual, 2)
+		So(m.Entries[DNAEntryType], ShouldEqual, 0)
+		So(m.Files, ShouldContain, "entries/agent.json")
+	})
+
+	Convey("the entries should be exported by type, oldest first", t, func() {
+		var odds []ExportedEntry
+		read("entries/oddNumbers.json", &odds)
+		So(len(odds), ShouldEqual, 2)
+		So(odds[0].Content, ShouldEqual, "7")
+		So(odds[1].Content, ShouldEqual, "9")
+
+		var profiles []ExportedEntry
+		read("entries/profile.json", &profiles)
+		So(profiles[0].Hash, ShouldEqual, profileHash.String())
+		So(profiles[0].Content.(map[string]interface{})["firstName"], ShouldEqual, "Zippy")
+	})
+}
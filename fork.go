@@ -0,0 +1,107 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// fork implements detecting peers that run a different DNA of the same app, i.e. that
+// are on the other side of a hard fork of the app, so that we stop gossiping with them
+
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"sort"
+	"time"
+)
+
+// MigrationProperty is the DNA property holding a message for nodes still running other
+// DNAs of the app, e.g. where to get the new version.  It is sent to them while gossiping.
+const MigrationProperty = "migration"
+
+var ErrNetworkFork = errors.New("network fork: peer runs a different DNA")
+var ErrForeignApp = errors.New("peer runs a different app")
+
+// ForkedPeer is a peer found running a different DNA
+type ForkedPeer struct {
+	Peer      string
+	DNA       string
+	Migration string `json:",omitempty"` // the peer's migration message, if its DNA has one
+	Seen      time.Time
+}
+
+// ForkStatus reports whether the node has found peers on other DNAs
+type ForkStatus struct {
+	Forked bool
+	DNA    string
+	Peers  []ForkedPeer
+}
+
+// forkInfo returns the app name, DNA hash and migration message that we advertise to peers
+func (dht *DHT) forkInfo() (app string, dna string, migration string) {
+	app = dht.h.nucleus.dna.Name
+	dna = dht.h.dnaHash.String()
+	migration, _ = dht.h.GetProperty(MigrationProperty)
+	return
+}
+
+// checkFork records whether a peer advertising the given app and DNA is on a fork and
+// returns ErrNetworkFork if it is.  Only a peer running our app on another DNA is a
+// fork; a peer running some other app returns ErrForeignApp and isn't reported.  Peers
+// that don't advertise their DNA are given the benefit of the doubt and peers that move
+// to our DNA are forgotten.
+func (dht *DHT) checkFork(id peer.ID, app string, dna string, migration string) (err error) {
+	mine := dht.h.dnaHash.String()
+	dht.forksLk.Lock()
+	defer dht.forksLk.Unlock()
+	if dna == "" || mine == "" || dna == mine {
+		delete(dht.forks, id)
+		delete(dht.foreign, id)
+		return
+	}
+	if app != "" && app != dht.h.nucleus.dna.Name {
+		delete(dht.forks, id)
+		if !dht.foreign[id] {
+			dht.glog.Logf("%v runs app %s, not ours", id, app)
+		}
+		dht.foreign[id] = true
+		err = ErrForeignApp
+		return
+	}
+	delete(dht.foreign, id)
+	err = ErrNetworkFork
+	if _, known := dht.forks[id]; !known {
+		dht.glog.Logf("warning: network fork: %v runs DNA %s, we run %s", id, dna, mine)
+	}
+	dht.forks[id] = ForkedPeer{Peer: peer.IDB58Encode(id), DNA: dna, Migration: migration, Seen: time.Now()}
+	return
+}
+
+// isForked returns true if a peer was last found running a different DNA of our app
+func (dht *DHT) isForked(id peer.ID) (forked bool) {
+	dht.forksLk.Lock()
+	defer dht.forksLk.Unlock()
+	_, forked = dht.forks[id]
+	return
+}
+
+// isForeign returns true if a peer was last found running a different app
+func (dht *DHT) isForeign(id peer.ID) (foreign bool) {
+	dht.forksLk.Lock()
+	defer dht.forksLk.Unlock()
+	foreign = dht.foreign[id]
+	return
+}
+
+// ForkStatus returns the peers found running other DNAs, most recently seen first
+func (h *Holochain) ForkStatus() (status ForkStatus) {
+	dht := h.dht
+	status.DNA = h.dnaHash.String()
+	dht.forksLk.Lock()
+	for _, f := range dht.forks {
+		status.Peers = append(status.Peers, f)
+	}
+	dht.forksLk.Unlock()
+	sort.Slice(status.Peers, func(i, j int) bool { return status.Peers[i].Seen.After(status.Peers[j].Seen) })
+	status.Forked = len(status.Peers) > 0
+	return
+}
@@ -0,0 +1,81 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCheckFork(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+	other, _ := makePeer("peer_other")
+
+	Convey("peers on a different DNA should be recorded as forked", t, func() {
+		So(dht.checkFork(other, h.nucleus.dna.Name, "QmOtherDNA", "get the new version"), ShouldEqual, ErrNetworkFork)
+		So(dht.isForked(other), ShouldBeTrue)
+
+		status := h.ForkStatus()
+		So(status.Forked, ShouldBeTrue)
+		So(status.DNA, ShouldEqual, h.dnaHash.String())
+		So(len(status.Peers), ShouldEqual, 1)
+		So(status.Peers[0].Peer, ShouldEqual, other.Pretty())
+		So(status.Peers[0].DNA, ShouldEqual, "QmOtherDNA")
+		So(status.Peers[0].Migration, ShouldEqual, "get the new version")
+	})
+
+	Convey("we should not gossip with forked peers", t, func() {
+		So(dht.gossipWith(other), ShouldEqual, ErrNetworkFork)
+		err := dht.UpdateGossiper(other, 0)
+		So(err, ShouldBeNil)
+		_, err = dht.FindGossiper()
+		So(err, ShouldEqual, ErrDHTErrNoGossipersAvailable)
+	})
+
+	Convey("peers that don't advertise a DNA or are on ours should not be forked", t, func() {
+		So(dht.checkFork(other, h.nucleus.dna.Name, h.dnaHash.String(), ""), ShouldBeNil)
+		So(dht.isForked(other), ShouldBeFalse)
+		So(h.ForkStatus().Forked, ShouldBeFalse)
+
+		dht.checkFork(other, h.nucleus.dna.Name, "QmOtherDNA", "")
+		So(dht.checkFork(other, h.nucleus.dna.Name, "", ""), ShouldBeNil)
+		So(dht.isForked(other), ShouldBeFalse)
+	})
+
+	Convey("peers running some other app should not be reported as forked", t, func() {
+		So(dht.checkFork(other, "someOtherApp", "QmOtherDNA", ""), ShouldEqual, ErrForeignApp)
+		So(dht.isForked(other), ShouldBeFalse)
+		So(dht.isForeign(other), ShouldBeTrue)
+		So(h.ForkStatus().Forked, ShouldBeFalse)
+		So(dht.gossipWith(other), ShouldEqual, ErrForeignApp)
+
+		So(dht.checkFork(other, h.nucleus.dna.Name, h.dnaHash.String(), ""), ShouldBeNil)
+		So(dht.isForeign(other), ShouldBeFalse)
+	})
+}
+
+func TestGossipFork(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	other, _ := makePeer("peer_other")
+
+	Convey("gossip requests from forked peers should get our DNA and no puts", t, func() {
+		m := &Message{Type: GOSSIP_REQUEST, From: other, Body: GossipReq{MyIdx: 1, YourIdx: 1, App: h.nucleus.dna.Name, DNA: "QmOtherDNA"}}
+		r, err := GossipReceiver(h, m)
+		So(err, ShouldBeNil)
+		g := r.(Gossip)
+		So(g.DNA, ShouldEqual, h.dnaHash.String())
+		So(len(g.Puts), ShouldEqual, 0)
+		So(h.dht.isForked(other), ShouldBeTrue)
+	})
+
+	Convey("gossip requests on our DNA should get puts and our DNA", t, func() {
+		m := &Message{Type: GOSSIP_REQUEST, From: other, Body: GossipReq{MyIdx: 0, YourIdx: 1, DNA: h.dnaHash.String()}}
+		r, err := GossipReceiver(h, m)
+		So(err, ShouldBeNil)
+		g := r.(Gossip)
+		So(g.DNA, ShouldEqual, h.dnaHash.String())
+		So(len(g.Puts), ShouldBeGreaterThan, 0)
+		So(h.dht.isForked(other), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// forward implements forwarding zome calls between an agent's devices, so that a weak
+// device can have an always-on node of the same agent do its calls for it
+
+package holochain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"time"
+)
+
+var ErrNotTrustedDevice = errors.New("not a trusted device of this agent")
+var ErrBadForward = errors.New("invalid forwarded call")
+
+// ForwardProtocol is the protocol devices use to forward zome calls to each other
+var ForwardProtocol Protocol
+
+// ForwardMaxAge is how old, or how far ahead of this node's clock, a forwarded call
+// may be, which limits how long a captured call could be replayed
+var ForwardMaxAge = time.Minute
+
+// ForwardReq is a zome call signed by the device forwarding it
+type ForwardReq struct {
+	Zome string
+	Fn   string
+	Args string
+	Time time.Time
+	Key  []byte    // the forwarding device's marshaled public key
+	Sig  Signature // the forwarding device's signature of the call
+}
+
+// ForwardResp holds the result of a forwarded call, as it is if it's a string and
+// as JSON otherwise
+type ForwardResp struct {
+	Result string
+}
+
+// callData returns what the forwarded call's signature is made over
+func (req *ForwardReq) callData() []byte {
+	var b bytes.Buffer
+	writeStr(&b, req.Zome)
+	writeStr(&b, req.Fn)
+	writeStr(&b, req.Args)
+	b.WriteString(req.Time.UTC().Format(time.RFC3339Nano))
+	return b.Bytes()
+}
+
+// newForwardReq makes a call signed by the agent's key
+func newForwardReq(agent Agent, zome string, function string, args string) (req ForwardReq, err error) {
+	req = ForwardReq{Zome: zome, Fn: function, Args: args, Time: time.Now()}
+	if req.Key, err = ic.MarshalPublicKey(agent.PubKey()); err != nil {
+		return
+	}
+	req.Sig, err = Sign(agent.PrivKey(), req.callData())
+	return
+}
+
+// ForwardCall has the node of another of the agent's devices call a zome function, and
+// returns its result
+func (h *Holochain) ForwardCall(to peer.ID, zome string, function string, args string) (result string, err error) {
+	var req ForwardReq
+	if req, err = newForwardReq(h.agent, zome, function, args); err != nil {
+		return
+	}
+	var r Message
+	if r, err = h.node.Send(ForwardProtocol, to, h.node.NewMessage(FORWARD_REQUEST, req)); err != nil {
+		return
+	}
+	switch body := r.Body.(type) {
+	case ForwardResp:
+		result = body.Result
+	case ErrorResponse:
+		err = body.DecodeResponseError()
+	default:
+		err = fmt.Errorf("expected ForwardResp from device got %T", r.Body)
+	}
+	return
+}
+
+// ForwardReceiver handles the calls forwarded by the agent's other devices
+func ForwardReceiver(h *Holochain, m *Message) (response interface{}, err error) {
+	switch m.Type {
+	case FORWARD_REQUEST:
+		if !h.isTrustedDevice(m.From) {
+			err = ErrNotTrustedDevice
+			return
+		}
+		req := m.Body.(ForwardReq)
+		if err = h.checkForward(m.From, &req); err != nil {
+			return
+		}
+		var r interface{}
+		if r, err = h.Call(req.Zome, req.Fn, req.Args, PUBLIC_EXPOSURE); err != nil {
+			return
+		}
+		var resp ForwardResp
+		if s, ok := r.(string); ok {
+			resp.Result = s
+		} else {
+			var j []byte
+			if _, j, err = normalizeJSON(r); err != nil {
+				return
+			}
+			resp.Result = string(j)
+		}
+		response = resp
+	default:
+		err = fmt.Errorf("message type %d not in holochain-forward protocol", int(m.Type))
+	}
+	return
+}
+
+func (h *Holochain) isTrustedDevice(id peer.ID) bool {
+	for _, d := range h.config.TrustedDevices {
+		if d == peer.IDB58Encode(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkForward checks that a forwarded call was signed by the device that sent it, and
+// recently
+func (h *Holochain) checkForward(from peer.ID, req *ForwardReq) (err error) {
+	var pub ic.PubKey
+	if pub, err = ic.UnmarshalPublicKey(req.Key); err != nil {
+		err = fmt.Errorf("%w: %w", ErrBadForward, err)
+		return
+	}
+	var id peer.ID
+	if id, err = peer.IDFromPublicKey(pub); err != nil {
+		return
+	}
+	if id != from {
+		err = fmt.Errorf("%w: key isn't the sender's", ErrBadForward)
+		return
+	}
+	if age := time.Since(req.Time); age > ForwardMaxAge || age < -ForwardMaxAge {
+		err = fmt.Errorf("%w: too old", ErrBadForward)
+		return
+	}
+	if err = h.CheckSigAlgorithm(req.Sig.A); err != nil {
+		return
+	}
+	valid, err := req.Sig.Verify(pub, req.callData())
+	if err != nil || !valid {
+		err = fmt.Errorf("%w: bad signature", ErrBadForward)
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package holochain
+
+import (
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestForwardCall(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	if err := h.node.StartProtocol(h, ForwardProtocol); err != nil {
+		panic(err)
+	}
+
+	// the agent's weak device
+	device, err := makeNode(1236, "device")
+	if err != nil {
+		panic(err)
+	}
+	defer device.Close()
+	device.Host.Peerstore().AddAddrs(h.nodeID, []ma.Multiaddr{h.node.NetAddr}, pstore.PermanentAddrTTL)
+	_, key := makePeer("device")
+	agent := &LibP2PAgent{AgentName("device"), key}
+	forward := func(req ForwardReq) (result string, err error) {
+		r, err := device.Send(ForwardProtocol, h.nodeID, device.NewMessage(FORWARD_REQUEST, req))
+		if err != nil {
+			return
+		}
+		switch body := r.Body.(type) {
+		case ForwardResp:
+			result = body.Result
+		case ErrorResponse:
+			err = body.DecodeResponseError()
+		default:
+			err = fmt.Errorf("unexpected response %T", r.Body)
+		}
+		return
+	}
+
+	Convey("calls from devices that aren't trusted should be refused", t, func() {
+		req, err := newForwardReq(agent, "jsSampleZome", "addOdd", "7")
+		So(err, ShouldBeNil)
+		_, err = forward(req)
+		So(err.Error(), ShouldEqual, ErrNotTrustedDevice.Error())
+	})
+
+	h.config.TrustedDevices = []string{peer.IDB58Encode(device.HashAddr)}
+
+	Convey("calls from trusted devices should be made", t, func() {
+		req, err := newForwardReq(agent, "jsSampleZome", "addOdd", "7")
+		So(err, ShouldBeNil)
+		result, err := forward(req)
+		So(err, ShouldBeNil)
+		So(result, ShouldStartWith, "Qm")
+	})
+
+	Convey("calls whose signature doesn't match should be refused", t, func() {
+		req, err := newForwardReq(agent, "jsSampleZome", "addOdd", "7")
+		So(err, ShouldBeNil)
+		req.Args = "9"
+		_, err = forward(req)
+		So(err.Error(), ShouldStartWith, ErrBadForward.Error())
+
+		_, otherKey := makePeer("other")
+		other, err := newForwardReq(&LibP2PAgent{AgentName("other"), otherKey}, "jsSampleZome", "addOdd", "7")
+		So(err, ShouldBeNil)
+		_, err = forward(other)
+		So(err.Error(), ShouldStartWith, ErrBadForward.Error())
+	})
+
+	Convey("old calls should be refused", t, func() {
+		req, err := newForwardReq(agent, "jsSampleZome", "addOdd", "7")
+		So(err, ShouldBeNil)
+		req.Time = time.Now().Add(-2 * ForwardMaxAge)
+		req.Sig, err = Sign(key, req.callData())
+		So(err, ShouldBeNil)
+		_, err = forward(req)
+		So(err.Error(), ShouldStartWith, ErrBadForward.Error())
+	})
+}
@@ -7,6 +7,7 @@
 package holochain
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	peer "github.com/libp2p/go-libp2p-peer"
@@ -15,9 +16,14 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// DefaultGossipMaxPuts is the most puts sent in a gossip response when the config's
+// GossipMaxPuts isn't set
+const DefaultGossipMaxPuts = 1000
+
 // Put holds a put or link for gossiping
 type Put struct {
 	idx int
@@ -26,13 +32,47 @@ type Put struct {
 
 // Gossip holds a gossip message
 type Gossip struct {
-	Puts []Put
+	Puts      []Put
+	App       string // the name of the app the responder runs
+	DNA       string // the DNA hash the responder runs
+	Migration string // the responder's migration message if it is on a different DNA
+	// MoreAvailable is set when puts after those sent were held back by the limit
+	MoreAvailable bool
+	// LastIdx is the index of the last put sent, which as indexes can have gaps may be
+	// more than the index asked for plus the number of puts
+	LastIdx int
 }
 
 // GossipReq holds a gossip request
 type GossipReq struct {
-	MyIdx   int
-	YourIdx int
+	MyIdx     int
+	YourIdx   int
+	App       string // the name of the app the requester runs
+	DNA       string // the DNA hash the requester runs
+	Migration string // the requester's migration message
+	MaxPuts   int    // the most puts to send back, 0 for the responder's own limit
+}
+
+// GossipStats holds counters about the gossip relationship with a peer
+type GossipStats struct {
+	Peer         string
+	Exchanges    int           // number of successful gossip exchanges
+	PutsReceived int           // number of puts received from the peer
+	PutsSent     int           // number of puts sent to the peer
+	Failures     int           // number of failed gossip attempts
+	TotalLatency time.Duration // sum of the round trip time of our successful gossip requests
+	Requests     int           // number of successful gossip requests we initiated
+	LastSuccess  time.Time
+	LastFailure  time.Time
+	MissedPings  int // number of keep-alive pings missed in a row
+}
+
+// AvgLatency returns the average round trip time of gossip requests to the peer
+func (s *GossipStats) AvgLatency() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Requests)
 }
 
 var ErrDHTErrNoGossipersAvailable error = errors.New("no gossipers available")
@@ -63,7 +103,7 @@ func incIdx(tx *buntdb.Tx, m *Message) (index string, err error) {
 
 	if m != nil {
 		var b []byte
-		b, err = ByteEncoder(m)
+		b, err = EnvelopeEncoder(m)
 		if err != nil {
 			return
 		}
@@ -103,9 +143,75 @@ func getIntVal(key string, tx *buntdb.Tx) (idx int, err error) {
 	return
 }
 
+// RebuildIndexes reconstructs the idx: and f: gossip index records from the stored
+// messages.  Messages that can no longer be decoded are dropped, leaving gaps in the
+// index, and the remaining ones keep their numbers so that gossipers' positions in
+// the index stay valid.  It returns the number of messages in the rebuilt index.
+func (dht *DHT) RebuildIndexes() (count int, err error) {
+	dht.glog.Log("rebuilding gossip indexes")
+	err = dht.update(func(tx *buntdb.Tx) error {
+		msgs := make(map[string]*Message)
+		var oldKeys []string
+		max := 0
+		e := tx.AscendKeys("idx:*", func(key, value string) bool {
+			idx, err := strconv.Atoi(key[4:])
+			if err != nil {
+				dht.glog.Logf("dropping bad index key %s", key)
+				oldKeys = append(oldKeys, key)
+				return true
+			}
+			var m Message
+			if err := EnvelopeDecoder([]byte(value), &m); err != nil {
+				dht.glog.Logf("dropping undecodable message at %s: %v", key, err)
+				oldKeys = append(oldKeys, key)
+				return true
+			}
+			msgs[key[4:]] = &m
+			if idx > max {
+				max = idx
+			}
+			return true
+		})
+		if e != nil {
+			return e
+		}
+		e = tx.AscendKeys("f:*", func(key, value string) bool {
+			oldKeys = append(oldKeys, key)
+			return true
+		})
+		if e != nil {
+			return e
+		}
+		for _, key := range oldKeys {
+			if _, e = tx.Delete(key); e != nil {
+				return e
+			}
+		}
+		for index, m := range msgs {
+			f, e := m.Fingerprint()
+			if e != nil {
+				return e
+			}
+			if _, _, e = tx.Set("f:"+f.String(), index, nil); e != nil {
+				return e
+			}
+		}
+		// never hand out an index again, even if its message was dropped
+		current, e := getIntVal("_idx", tx)
+		if e != nil || current < max {
+			if _, _, e = tx.Set("_idx", fmt.Sprintf("%d", max), nil); e != nil {
+				return e
+			}
+		}
+		count = len(msgs)
+		return nil
+	})
+	return
+}
+
 // GetIdx returns the current put index for gossip
 func (dht *DHT) GetIdx() (idx int, err error) {
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		var e error
 		idx, e = getIntVal("_idx", tx)
 		if e != nil {
@@ -118,7 +224,7 @@ func (dht *DHT) GetIdx() (idx int, err error) {
 
 // GetIdxMessage returns the messages that causes the change at a given index
 func (dht *DHT) GetIdxMessage(idx int) (msg Message, err error) {
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		msgStr, e := tx.Get(fmt.Sprintf("idx:%d", idx))
 		if e == buntdb.ErrNotFound {
 			return ErrNoSuchIdx
@@ -126,7 +232,7 @@ func (dht *DHT) GetIdxMessage(idx int) (msg Message, err error) {
 		if e != nil {
 			return e
 		}
-		e = ByteDecoder([]byte(msgStr), &msg)
+		e = EnvelopeDecoder([]byte(msgStr), &msg)
 		if err != nil {
 			return e
 		}
@@ -147,7 +253,7 @@ func (dht *DHT) HaveFingerprint(f Hash) (result bool, err error) {
 // GetFingerprint returns the index that of the message that made a change or -1 if we don't have it
 func (dht *DHT) GetFingerprint(f Hash) (index int, err error) {
 	index = -1
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		idxStr, e := tx.Get("f:" + f.String())
 		if e == buntdb.ErrNotFound {
 			return nil
@@ -164,27 +270,40 @@ func (dht *DHT) GetFingerprint(f Hash) (index int, err error) {
 	return
 }
 
-// GetPuts returns a list of puts after the given index
-func (dht *DHT) GetPuts(since int) (puts []Put, err error) {
+// GetPuts returns a list of the puts from the given index on, in index order, at most
+// max of them unless max is 0, and whether puts were left out because of the limit
+func (dht *DHT) GetPuts(since int, max int) (puts []Put, more bool, err error) {
 	puts = make([]Put, 0)
-	err = dht.db.View(func(tx *buntdb.Tx) error {
-		err = tx.AscendGreaterOrEqual("idx", string(since), func(key, value string) bool {
-			x := strings.Split(key, ":")
-			idx, _ := strconv.Atoi(x[1])
-			if idx >= since {
-				p := Put{idx: idx}
-				if value != "" {
-					err := ByteDecoder([]byte(value), &p.M)
-					if err != nil {
-						return false
-					}
+	if since < 1 {
+		since = 1
+	}
+	err = dht.view(func(tx *buntdb.Tx) error {
+		top, e := getIntVal("_idx", tx)
+		if e != nil {
+			return e
+		}
+		// indexes dropped by RebuildIndexes leave gaps
+		for idx := since; idx <= top; idx++ {
+			value, e := tx.Get(fmt.Sprintf("idx:%d", idx))
+			if e == buntdb.ErrNotFound {
+				continue
+			}
+			if e != nil {
+				return e
+			}
+			if max > 0 && len(puts) == max {
+				more = true
+				break
+			}
+			p := Put{idx: idx}
+			if value != "" {
+				if EnvelopeDecoder([]byte(value), &p.M) != nil {
+					continue
 				}
-				puts = append(puts, p)
 			}
-			return true
-		})
-		sort.Slice(puts, func(i, j int) bool { return puts[i].idx < puts[j].idx })
-		return err
+			puts = append(puts, p)
+		}
+		return nil
 	})
 	return
 }
@@ -192,7 +311,7 @@ func (dht *DHT) GetPuts(since int) (puts []Put, err error) {
 // GetGossiper loads returns last known index of the gossiper, and adds them if not didn't exist before
 func (dht *DHT) GetGossiper(id peer.ID) (idx int, err error) {
 	key := "peer:" + peer.IDB58Encode(id)
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		var e error
 		idx, e = getIntVal(key, tx)
 		if e != nil {
@@ -203,11 +322,11 @@ func (dht *DHT) GetGossiper(id peer.ID) (idx int, err error) {
 	return
 }
 
-// FindGossiper picks a random DHT node to gossip with
-func (dht *DHT) FindGossiper() (g peer.ID, err error) {
-	glist := make([]peer.ID, 0)
+// getGossipers returns the list of DHT nodes we know to gossip with
+func (dht *DHT) getGossipers() (glist []peer.ID, err error) {
+	glist = make([]peer.ID, 0)
 
-	err = dht.db.View(func(tx *buntdb.Tx) error {
+	err = dht.view(func(tx *buntdb.Tx) error {
 		err = tx.Ascend("peer", func(key, value string) bool {
 			x := strings.Split(key, ":")
 			id, e := peer.IDB58Decode(x[1])
@@ -220,6 +339,37 @@ func (dht *DHT) FindGossiper() (g peer.ID, err error) {
 		})
 		return nil
 	})
+	return
+}
+
+// unforkedGossipers returns the DHT nodes we know that run the same app and DNA
+func (dht *DHT) unforkedGossipers() (glist []peer.ID, err error) {
+	glist, err = dht.getGossipers()
+
+	// we don't gossip with peers on other apps or DNAs
+	n := 0
+	for _, g := range glist {
+		if !dht.isForked(g) && !dht.isForeign(g) {
+			glist[n] = g
+			n++
+		}
+	}
+	glist = glist[:n]
+	return
+}
+
+// FindGossiper picks a random DHT node to gossip with, from our neighbors when the DHT
+// is sharded
+func (dht *DHT) FindGossiper() (g peer.ID, err error) {
+	var glist []peer.ID
+	if dht.resilienceFactor() > 0 {
+		glist, err = dht.neighbors()
+	} else {
+		glist, err = dht.unforkedGossipers()
+	}
+	if err != nil {
+		return
+	}
 
 	if len(glist) == 0 {
 		err = ErrDHTErrNoGossipersAvailable
@@ -232,8 +382,12 @@ func (dht *DHT) FindGossiper() (g peer.ID, err error) {
 // UpdateGossiper updates a gossiper
 func (dht *DHT) UpdateGossiper(id peer.ID, newIdx int) (err error) {
 	dht.glog.Logf("updaing %v to %d", id, newIdx)
-	err = dht.db.Update(func(tx *buntdb.Tx) error {
+	joined := false
+	err = dht.update(func(tx *buntdb.Tx) error {
 		key := "peer:" + peer.IDB58Encode(id)
+		if _, e := tx.Get(key); e == buntdb.ErrNotFound {
+			joined = true
+		}
 		idx, e := getIntVal(key, tx)
 		if e != nil {
 			return e
@@ -248,6 +402,56 @@ func (dht *DHT) UpdateGossiper(id peer.ID, newIdx int) (err error) {
 		}
 		return nil
 	})
+	if err == nil && joined {
+		dht.h.events.publish(Event{Type: PeerJoined, Peer: peer.IDB58Encode(id)})
+	}
+	return
+}
+
+// updateGossipStats loads the stats for a peer, applies fn, and stores the result
+func (dht *DHT) updateGossipStats(id peer.ID, fn func(s *GossipStats)) (err error) {
+	err = dht.update(func(tx *buntdb.Tx) error {
+		key := "gstats:" + peer.IDB58Encode(id)
+		stats := GossipStats{Peer: peer.IDB58Encode(id)}
+		val, e := tx.Get(key)
+		if e == nil {
+			e = json.Unmarshal([]byte(val), &stats)
+			if e != nil {
+				return e
+			}
+		} else if e != buntdb.ErrNotFound {
+			return e
+		}
+		fn(&stats)
+		b, e := json.Marshal(stats)
+		if e != nil {
+			return e
+		}
+		_, _, e = tx.Set(key, string(b), nil)
+		return e
+	})
+	return
+}
+
+// Stats returns the gossip statistics for all the peers we have exchanged gossip with
+func (dht *DHT) Stats() (stats []GossipStats, err error) {
+	stats = make([]GossipStats, 0)
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		err := tx.Ascend("gstats", func(key, value string) bool {
+			var s GossipStats
+			e = json.Unmarshal([]byte(value), &s)
+			if e != nil {
+				return false
+			}
+			stats = append(stats, s)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
 	return
 }
 
@@ -256,16 +460,45 @@ func GossipReceiver(h *Holochain, m *Message) (response interface{}, err error)
 	switch m.Type {
 	case GOSSIP_REQUEST:
 		dht.glog.Logf("GossipReceiver got GOSSIP_REQUEST: %v", m)
+		h.presence.seen(m.From)
 		switch t := m.Body.(type) {
 		case GossipReq:
 			dht.glog.Logf("%v wants my puts since %d and is at %d", m.From, t.YourIdx, t.MyIdx)
+			app, dna, migration := dht.forkInfo()
+			switch dht.checkFork(m.From, t.App, t.DNA, t.Migration) {
+			case ErrNetworkFork:
+				// tell them why they get nothing so they know about the fork too
+				response = Gossip{App: app, DNA: dna, Migration: migration}
+				return
+			case ErrForeignApp:
+				response = Gossip{App: app, DNA: dna}
+				return
+			}
 
-			// give the gossiper what they want
-			var puts []Put
-			puts, err = h.dht.GetPuts(t.YourIdx)
-			g := Gossip{Puts: puts}
+			// give the gossiper what they want, up to the smaller of our limit and theirs
+			max := dht.gossipMaxPuts()
+			if t.MaxPuts > 0 && (max == 0 || t.MaxPuts < max) {
+				max = t.MaxPuts
+			}
+			g := Gossip{App: app, DNA: dna}
+			g.Puts, g.MoreAvailable, err = h.dht.GetPuts(t.YourIdx, max)
+			if len(g.Puts) > 0 {
+				g.LastIdx = g.Puts[len(g.Puts)-1].idx
+			}
+			puts := g.Puts
 			response = g
 
+			if err == nil {
+				e := dht.updateGossipStats(m.From, func(s *GossipStats) {
+					s.Exchanges++
+					s.PutsSent += len(puts)
+					s.LastSuccess = time.Now()
+				})
+				if e != nil {
+					dht.glog.Logf("error updating gossip stats: %v", e)
+				}
+			}
+
 			// check to see what we know they said, and if our record is less
 			// that where they are currently at, gossip back
 			idx, e := h.dht.GetGossiper(m.From)
@@ -284,6 +517,8 @@ func GossipReceiver(h *Holochain, m *Message) (response interface{}, err error)
 		default:
 			err = ErrDHTExpectedGossipReqInBody
 		}
+	case PING_REQUEST:
+		response = "pong"
 	default:
 		err = fmt.Errorf("message type %d not in holochain-gossip protocol", int(m.Type))
 	}
@@ -306,6 +541,15 @@ func (dht *DHT) gossipWith(id peer.ID) (err error) {
 		delete(dht.gossips, id)
 	}()
 
+	if dht.isForked(id) {
+		err = ErrNetworkFork
+		return
+	}
+	if dht.isForeign(id) {
+		err = ErrForeignApp
+		return
+	}
+
 	var myIdx, yourIdx int
 	myIdx, err = dht.GetIdx()
 	if err != nil {
@@ -317,37 +561,110 @@ func (dht *DHT) gossipWith(id peer.ID) (err error) {
 		return
 	}
 
+	// ask for a page of puts at a time until we have caught up
+	var count int
+	defer func() {
+		if err == nil {
+			dht.h.events.publish(Event{Type: GossipCompleted, Peer: peer.IDB58Encode(id), Puts: count})
+		}
+	}()
+	for {
+		var n, last int
+		var more bool
+		n, last, more, err = dht.gossipPage(id, myIdx, yourIdx)
+		count += n
+		if err != nil || !more || n == 0 || last <= yourIdx {
+			return
+		}
+		yourIdx = last
+	}
+}
+
+// gossipPage requests the puts of a peer after yourIdx and runs them, returning how
+// many it got, the index of the last one, and whether the peer has more
+func (dht *DHT) gossipPage(id peer.ID, myIdx int, yourIdx int) (count int, last int, more bool, err error) {
 	var r interface{}
-	r, err = dht.h.Send(GossipProtocol, id, GOSSIP_REQUEST, GossipReq{MyIdx: myIdx, YourIdx: yourIdx + 1})
+	start := time.Now()
+	app, dna, migration := dht.forkInfo()
+	r, err = dht.h.Send(GossipProtocol, id, GOSSIP_REQUEST, GossipReq{MyIdx: myIdx, YourIdx: yourIdx + 1, App: app, DNA: dna, Migration: migration, MaxPuts: dht.gossipMaxPuts()})
 	if err != nil {
+		e := dht.updateGossipStats(id, func(s *GossipStats) {
+			s.Failures++
+			s.LastFailure = time.Now()
+		})
+		if e != nil {
+			dht.glog.Logf("error updating gossip stats: %v", e)
+		}
 		return
 	}
+	latency := time.Since(start)
+	dht.h.presence.seen(id)
 
 	gossip := r.(Gossip)
+	err = dht.checkFork(id, gossip.App, gossip.DNA, gossip.Migration)
+	if err != nil {
+		return
+	}
 	puts := gossip.Puts
+	more = gossip.MoreAvailable
+	last = gossip.LastIdx
 	dht.glog.Logf("received puts: %v", puts)
 
+	err = dht.updateGossipStats(id, func(s *GossipStats) {
+		s.Exchanges++
+		s.Requests++
+		s.PutsReceived += len(puts)
+		s.TotalLatency += latency
+		s.LastSuccess = time.Now()
+	})
+	if err != nil {
+		return
+	}
+
 	// gossiper has more stuff that we new about before so update the gossipers status
 	// and also run their puts
-	count := len(puts)
+	count = len(puts)
 	if count > 0 {
-		dht.glog.Logf("running %d puts", count)
-		var idx int
+		dht.glog.Logf("running %d puts up to index %d", count, last)
+		// puts are validated as they come and stored in batches, each one transaction,
+		// which are stored before any other kind of change so the order is kept
+		var batch []*validatedPut
+		flush := func() (err error) {
+			err = dht.applyPuts(batch)
+			batch = nil
+			return
+		}
 		for i, p := range puts {
-			idx = i + yourIdx + 1
-			/* TODO: Small mystery to be solved, the value of p.idx is always 0 but it should be the actual idx...
-			if idx != p.idx {
-				dht.glog.Logf("WHOA! idx=%d  p.idx:%d p.M: %v", idx, p.idx, p.M)
+			if len(batch) == GossipBatchSize {
+				if err = flush(); err != nil {
+					return
+				}
+			}
+			// puts don't carry their index, only the last one's is sent, so they're
+			// logged by their place in the page
+			idx := i + 1
+			// when sharded we only hold what's in our neighborhood
+			if key, ok := messageKey(&p.M); ok && !dht.holdsHash(key) {
+				dht.glog.Logf("PUT--%d not in our neighborhood: %v", idx, key)
+				continue
 			}
-			*/
 			f, e := p.M.Fingerprint()
 			if e == nil {
 				dht.glog.Logf("PUT--%d (fingerprint: %v)", idx, f)
 				exists, e := dht.HaveFingerprint(f)
-				if !exists && e == nil {
-					dht.glog.Logf("PUT--%d calling ActionReceiver", idx)
-					r, e := ActionReceiver(dht.h, &p.M)
-					dht.glog.Logf("PUT--%d ActionReceiver returned %v with err %v", idx, r, e)
+				if !exists && e == nil && p.M.Type == PUT_REQUEST {
+					vp, e := validateGossipedPut(dht.h, id, &p.M)
+					dht.glog.Logf("PUT--%d validated with err %v", idx, e)
+					if vp != nil {
+						batch = append(batch, vp)
+					}
+				} else if !exists && e == nil {
+					if err = flush(); err != nil {
+						return
+					}
+					dht.glog.Logf("PUT--%d calling receiveAction", idx)
+					r, e := receiveAction(dht.h, id, &p.M)
+					dht.glog.Logf("PUT--%d receiveAction returned %v with err %v", idx, r, e)
 				} else {
 					if e == nil {
 						dht.glog.Logf("already have fingerprint %v", f)
@@ -360,11 +677,28 @@ func (dht *DHT) gossipWith(id peer.ID) (err error) {
 				dht.glog.Logf("error calculating fingerprint for %v", p)
 			}
 		}
-		err = dht.UpdateGossiper(id, idx)
+		if err = flush(); err != nil {
+			return
+		}
+		if last > yourIdx {
+			err = dht.UpdateGossiper(id, last)
+		}
 	}
 	return
 }
 
+// gossipMaxPuts returns the most puts to exchange in one gossip message, 0 for no limit
+func (dht *DHT) gossipMaxPuts() int {
+	switch max := dht.h.config.GossipMaxPuts; {
+	case max == 0:
+		return DefaultGossipMaxPuts
+	case max < 0:
+		return 0
+	default:
+		return max
+	}
+}
+
 // gossip picks a random node in my neighborhood and sends gossips with it
 func (dht *DHT) gossip() (err error) {
 
@@ -378,15 +712,32 @@ func (dht *DHT) gossip() (err error) {
 	return
 }
 
-// Gossip gossips every interval
+// Gossip gossips every interval, or in bursts every LowPowerGossipInterval on the low
+// power profile, waiting while the DHT is suspended
 func (dht *DHT) Gossip(interval time.Duration) {
 	dht.gossiping = true
+	defer atomic.StoreInt64(&dht.lastGossip, 0)
 	for dht.gossiping {
-		err := dht.gossip()
+		dht.waitResume()
+		if !dht.gossiping {
+			break
+		}
+		wait := interval
+		if dht.isLowPower() && LowPowerGossipInterval > wait {
+			wait = LowPowerGossipInterval
+		}
+		atomic.StoreInt64(&dht.gossipInterval, int64(wait))
+		atomic.StoreInt64(&dht.lastGossip, time.Now().UnixNano())
+		var err error
+		if dht.isLowPower() {
+			err = dht.gossipBurst(LowPowerBurstSize)
+		} else {
+			err = dht.gossip()
+		}
 		if err != nil {
 			dht.glog.Logf("error: %v", err)
 		}
-		time.Sleep(interval)
+		time.Sleep(wait)
 	}
 }
 
@@ -2,7 +2,9 @@ package holochain
 
 import (
 	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
 	"testing"
 	"time"
 )
@@ -172,20 +174,34 @@ func TestGossipData(t *testing.T) {
 	})
 
 	Convey("GetPuts should return a list of the puts since an index value", t, func() {
-		puts, err := dht.GetPuts(0)
+		puts, more, err := dht.GetPuts(0, 0)
 		So(err, ShouldBeNil)
+		So(more, ShouldBeFalse)
 		So(len(puts), ShouldEqual, 4)
 		So(fmt.Sprintf("%v", puts[2].M), ShouldEqual, fmt.Sprintf("%v", *m1))
 		So(fmt.Sprintf("%v", puts[3].M), ShouldEqual, fmt.Sprintf("%v", *m2))
 		So(puts[0].idx, ShouldEqual, 1)
 		So(puts[1].idx, ShouldEqual, 2)
 
-		puts, err = dht.GetPuts(4)
+		puts, _, err = dht.GetPuts(4, 0)
 		So(err, ShouldBeNil)
 		So(len(puts), ShouldEqual, 1)
 		So(fmt.Sprintf("%v", puts[0].M), ShouldEqual, fmt.Sprintf("%v", *m2))
 		So(puts[0].idx, ShouldEqual, 4)
 	})
+
+	Convey("GetPuts should stop at the limit", t, func() {
+		puts, more, err := dht.GetPuts(0, 2)
+		So(err, ShouldBeNil)
+		So(more, ShouldBeTrue)
+		So(len(puts), ShouldEqual, 2)
+		So(puts[1].idx, ShouldEqual, 2)
+
+		puts, more, err = dht.GetPuts(3, 2)
+		So(err, ShouldBeNil)
+		So(more, ShouldBeFalse)
+		So(len(puts), ShouldEqual, 2)
+	})
 }
 
 func TestGossip(t *testing.T) {
@@ -202,3 +218,150 @@ func TestGossip(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 }
+
+func TestGossipStats(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+
+	Convey("Stats should start empty", t, func() {
+		stats, err := dht.Stats()
+		So(err, ShouldBeNil)
+		So(len(stats), ShouldEqual, 0)
+	})
+
+	fooAddr, _ := makePeer("peer_foo")
+
+	Convey("updateGossipStats should record per-peer counters", t, func() {
+		err := dht.updateGossipStats(fooAddr, func(s *GossipStats) {
+			s.Exchanges++
+			s.Requests++
+			s.PutsReceived += 3
+			s.TotalLatency += 10 * time.Millisecond
+		})
+		So(err, ShouldBeNil)
+		err = dht.updateGossipStats(fooAddr, func(s *GossipStats) {
+			s.Failures++
+		})
+		So(err, ShouldBeNil)
+		stats, err := dht.Stats()
+		So(err, ShouldBeNil)
+		So(len(stats), ShouldEqual, 1)
+		So(stats[0].Peer, ShouldEqual, peer.IDB58Encode(fooAddr))
+		So(stats[0].Exchanges, ShouldEqual, 1)
+		So(stats[0].PutsReceived, ShouldEqual, 3)
+		So(stats[0].Failures, ShouldEqual, 1)
+		So(stats[0].AvgLatency(), ShouldEqual, 10*time.Millisecond)
+	})
+
+	Convey("gossipWith should update the stats of the peer", t, func() {
+		err := dht.gossipWith(h.node.HashAddr)
+		So(err, ShouldBeNil)
+		stats, err := dht.Stats()
+		So(err, ShouldBeNil)
+		So(len(stats), ShouldEqual, 2)
+		var s GossipStats
+		for _, s = range stats {
+			if s.Peer == h.nodeIDStr {
+				break
+			}
+		}
+		So(s.Requests, ShouldEqual, 1)
+		So(s.PutsSent, ShouldEqual, s.PutsReceived)
+		So(s.LastSuccess.IsZero(), ShouldBeFalse)
+	})
+}
+
+func TestGossipPaging(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+
+	Convey("the limit should come from the config", t, func() {
+		So(dht.gossipMaxPuts(), ShouldEqual, DefaultGossipMaxPuts)
+		h.config.GossipMaxPuts = -1
+		So(dht.gossipMaxPuts(), ShouldEqual, 0)
+		h.config.GossipMaxPuts = 1
+		So(dht.gossipMaxPuts(), ShouldEqual, 1)
+	})
+
+	Convey("gossipWith should ask for pages until caught up", t, func() {
+		idx, _ := dht.GetIdx()
+		So(idx, ShouldBeGreaterThan, 1)
+		err := dht.gossipWith(h.node.HashAddr)
+		So(err, ShouldBeNil)
+		stats, _ := dht.Stats()
+		var s GossipStats
+		for _, s = range stats {
+			if s.Peer == h.nodeIDStr {
+				break
+			}
+		}
+		So(s.Requests, ShouldEqual, idx)
+		So(s.PutsReceived, ShouldEqual, idx)
+		yourIdx, _ := dht.GetGossiper(h.node.HashAddr)
+		So(yourIdx, ShouldEqual, idx)
+	})
+}
+
+func TestRebuildIndexes(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+
+	fooAddr, _ := makePeer("peer_foo")
+	dht.UpdateGossiper(fooAddr, 2)
+
+	before, _ := dht.GetIdx()
+	puts, _, _ := dht.GetPuts(1, 0)
+	f, _ := puts[0].M.Fingerprint()
+
+	Convey("RebuildIndexes should restore damaged fingerprint records", t, func() {
+		err := dht.db.Update(func(tx *buntdb.Tx) error {
+			_, err := tx.Delete("f:" + f.String())
+			return err
+		})
+		So(err, ShouldBeNil)
+		r, _ := dht.HaveFingerprint(f)
+		So(r, ShouldBeFalse)
+
+		count, err := dht.RebuildIndexes()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, before)
+		r, _ = dht.HaveFingerprint(f)
+		So(r, ShouldBeTrue)
+		idx, _ := dht.GetIdx()
+		So(idx, ShouldEqual, before)
+	})
+
+	Convey("RebuildIndexes should drop undecodable messages without renumbering", t, func() {
+		err := dht.db.Update(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set("idx:1", "garbage", nil)
+			return err
+		})
+		So(err, ShouldBeNil)
+		count, err := dht.RebuildIndexes()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, before-1)
+		idx, _ := dht.GetIdx()
+		So(idx, ShouldEqual, before)
+		puts, _, err := dht.GetPuts(1, 0)
+		So(err, ShouldBeNil)
+		So(len(puts), ShouldEqual, before-1)
+		So(puts[0].idx, ShouldEqual, 2)
+
+		// a page from across the gap ends at the last index actually sent
+		puts, more, err := dht.GetPuts(1, 1)
+		So(err, ShouldBeNil)
+		So(more, ShouldBeTrue)
+		So(puts[0].idx, ShouldEqual, 2)
+		r, _ := dht.HaveFingerprint(f)
+		So(r, ShouldBeFalse)
+	})
+
+	Convey("RebuildIndexes should keep the gossipers' positions", t, func() {
+		idx, err := dht.GetGossiper(fooAddr)
+		So(err, ShouldBeNil)
+		So(idx, ShouldEqual, 2)
+	})
+}
@@ -19,12 +19,41 @@ type Hash struct {
 	H mh.Multihash
 }
 
+// HashSize is the size in bytes of a marshaled sha2-256 hash, and of a marshaled null hash
+const HashSize = 34
+
+// maxDigestSize bounds the digest length accepted when unmarshaling a hash
+const maxDigestSize = 128
+
+var ErrBadHashEncoding = errors.New("bad hash encoding")
+var ErrHashTypeMismatch = errors.New("hash type doesn't match the DNA's hash type")
+
+// nullHashBytes is written in place of the null hash so marshaling it doesn't allocate
+var nullHashBytes [HashSize]byte
+
 // HashSpec holds the info that tells what kind of hash this is
 type HashSpec struct {
 	Code   uint64
 	Length int
 }
 
+// Check confirms that a hash was made with the algorithm (and length) of the spec.
+// The null hash always passes.
+func (hc HashSpec) Check(h Hash) (err error) {
+	if h.IsNullHash() {
+		return
+	}
+	var d *mh.DecodedMultihash
+	d, err = mh.Decode(h.H)
+	if err != nil {
+		return
+	}
+	if d.Code != hc.Code || (hc.Length > 0 && d.Length != hc.Length) {
+		err = ErrHashTypeMismatch
+	}
+	return
+}
+
 // NewHash builds a Hash from a b58 string encoded hash
 func NewHash(s string) (h Hash, err error) {
 	h.H, err = mh.FromB58String(s)
@@ -39,6 +68,12 @@ func (h Hash) String() string {
 	return h.H.B58String()
 }
 
+// Key returns the raw bytes of the hash as a string, for use as a map key
+// in hot paths where the cost of the b58 encoding done by String isn't needed
+func (h Hash) Key() string {
+	return string(h.H)
+}
+
 // Sum builds a digest according to the specs in the Holochain
 func (h *Hash) Sum(hc HashSpec, data []byte) (err error) {
 	h.H, err = mh.Sum(data, hc.Code, hc.Length)
@@ -75,28 +110,85 @@ func (h *Hash) Equal(h2 *Hash) bool {
 // MarshalHash writes a hash to a binary stream
 func (h *Hash) MarshalHash(writer io.Writer) (err error) {
 	if h.IsNullHash() {
-		b := make([]byte, 34)
-		err = binary.Write(writer, binary.LittleEndian, b)
+		_, err = writer.Write(nullHashBytes[:])
 	} else {
 		if h.H == nil {
 			err = errors.New("can't marshal nil hash")
 		} else {
-			err = binary.Write(writer, binary.LittleEndian, h.H)
+			_, err = writer.Write(h.H)
 		}
 	}
 	return
 }
 
-// UnmarshalHash reads a hash from a binary stream
+// UnmarshalHash reads a hash from a binary stream.  Hashes are self describing
+// multihashes so their length depends on the hash type of the DNA.
 func (h *Hash) UnmarshalHash(reader io.Reader) (err error) {
-	b := make([]byte, 34)
-	err = binary.Read(reader, binary.LittleEndian, b)
-	if err == nil {
-		if b[0] == 0 {
+	var c byte
+	c, err = readHashByte(reader)
+	if err != nil {
+		return
+	}
+	if c == 0 {
+		// the null hash is marshaled as HashSize zero bytes
+		var rest [HashSize - 1]byte
+		_, err = io.ReadFull(reader, rest[:])
+		if err == nil {
 			h.H = NullHash().H
-		} else {
-			h.H = b
 		}
+		return
 	}
+	// the multihash prefix is the varint code followed by the varint digest length
+	r := io.MultiReader(bytes.NewReader([]byte{c}), reader)
+	b := make([]byte, 0, HashSize)
+	b, _, err = readHashVarint(r, b)
+	if err != nil {
+		return
+	}
+	var length uint64
+	b, length, err = readHashVarint(r, b)
+	if err != nil {
+		return
+	}
+	if length > maxDigestSize {
+		err = ErrBadHashEncoding
+		return
+	}
+	prefix := len(b)
+	b = append(b, make([]byte, length)...)
+	_, err = io.ReadFull(reader, b[prefix:])
+	if err == nil {
+		h.H = b
+	}
+	return
+}
+
+// readHashVarint reads a varint from the reader, appending its bytes to b
+func readHashVarint(reader io.Reader, b []byte) (out []byte, v uint64, err error) {
+	start := len(b)
+	for {
+		if len(b)-start >= binary.MaxVarintLen64 {
+			err = ErrBadHashEncoding
+			return
+		}
+		var c byte
+		c, err = readHashByte(reader)
+		if err != nil {
+			return
+		}
+		b = append(b, c)
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	v, _ = binary.Uvarint(b[start:])
+	out = b
+	return
+}
+
+func readHashByte(reader io.Reader) (c byte, err error) {
+	var b [1]byte
+	_, err = io.ReadFull(reader, b[:])
+	c = b[0]
 	return
 }
@@ -60,21 +60,50 @@ func TestMarshalHash(t *testing.T) {
 		var b bytes.Buffer
 		err := hash.MarshalHash(&b)
 		So(err, ShouldBeNil)
+		So(b.Len(), ShouldEqual, HashSize)
 		var hash2 Hash
 		err = hash2.UnmarshalHash(&b)
 		So(err, ShouldBeNil)
-		So(hash.Equal(&hash), ShouldBeTrue)
+		So(hash.Equal(&hash2), ShouldBeTrue)
 	})
 	Convey("should be able to marshal and unmarshal a Null Hash", t, func() {
 		hash := NullHash()
 		var b bytes.Buffer
 		err := hash.MarshalHash(&b)
 		So(err, ShouldBeNil)
+		So(b.Bytes(), ShouldResemble, make([]byte, HashSize))
 		var hash2 Hash
 		err = hash2.UnmarshalHash(&b)
 		So(err, ShouldBeNil)
 		So(hash.Equal(&hash), ShouldBeTrue)
 	})
+	Convey("should be able to marshal and unmarshal hashes of other types", t, func() {
+		for _, name := range []string{"sha1", "blake2b-256", "sha2-512"} {
+			var hash Hash
+			err := hash.Sum(HashSpec{Code: mh.Names[name], Length: -1}, []byte("test data"))
+			So(err, ShouldBeNil)
+			var b bytes.Buffer
+			err = hash.MarshalHash(&b)
+			So(err, ShouldBeNil)
+			// a trailing null hash must still be readable after a hash of a different size
+			null := NullHash()
+			err = null.MarshalHash(&b)
+			So(err, ShouldBeNil)
+			var hash2, hash3 Hash
+			err = hash2.UnmarshalHash(&b)
+			So(err, ShouldBeNil)
+			So(hash2.String(), ShouldEqual, hash.String())
+			err = hash3.UnmarshalHash(&b)
+			So(err, ShouldBeNil)
+			So(hash3.IsNullHash(), ShouldBeTrue)
+			So(b.Len(), ShouldEqual, 0)
+		}
+	})
+	Convey("should fail to unmarshal a truncated hash", t, func() {
+		var hash Hash
+		err := hash.UnmarshalHash(bytes.NewBuffer([]byte{1, 2, 3}))
+		So(err, ShouldNotBeNil)
+	})
 	Convey("should not be able to marshal and unmarshal a nil Hash", t, func() {
 		var hash Hash
 		var b bytes.Buffer
@@ -83,3 +112,33 @@ func TestMarshalHash(t *testing.T) {
 	})
 
 }
+
+func TestHashKey(t *testing.T) {
+	Convey("key should be the raw hash bytes", t, func() {
+		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(hash.Key(), ShouldEqual, string(hash.H))
+		hash2 := hash.Clone()
+		So(hash2.Key(), ShouldEqual, hash.Key())
+		So(NullHash().Key(), ShouldNotEqual, hash.Key())
+	})
+}
+
+func TestHashSpecCheck(t *testing.T) {
+	spec := HashSpec{Code: mh.SHA2_256, Length: -1}
+	Convey("it should accept hashes of the spec's type", t, func() {
+		var hash Hash
+		hash.Sum(spec, []byte("test data"))
+		So(spec.Check(hash), ShouldBeNil)
+		So(spec.Check(NullHash()), ShouldBeNil)
+	})
+	Convey("it should reject hashes of a different type", t, func() {
+		var hash Hash
+		hash.Sum(HashSpec{Code: mh.Names["blake2b-256"], Length: -1}, []byte("test data"))
+		So(spec.Check(hash), ShouldEqual, ErrHashTypeMismatch)
+	})
+	Convey("it should reject hashes of a different length", t, func() {
+		var hash Hash
+		hash.Sum(HashSpec{Code: mh.SHA2_256, Length: 20}, []byte("test data"))
+		So(HashSpec{Code: mh.SHA2_256, Length: 32}.Check(hash), ShouldEqual, ErrHashTypeMismatch)
+	})
+}
@@ -9,18 +9,36 @@ package holochain
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	ic "github.com/libp2p/go-libp2p-crypto"
 	"io"
+	"sort"
 	"time"
 )
 
+// Signature holds a signature and the algorithm it was made with
 type Signature struct {
+	A SigAlgorithm
 	S []byte
+	// Key is the marshaled public key when the signature was made with a one-time key
+	Key []byte
 }
 
+// sigAlgorithmMarker is written in place of the signature length when the algorithm
+// isn't ed25519.  ed25519 signatures are marshaled without the algorithm so that
+// headers made before it was recorded keep their hashes.
+const sigAlgorithmMarker uint8 = 0xFF
+
+// sigKeyMarker is written before the one-time public key of a signature, if it has one
+const sigKeyMarker uint8 = 0xFE
+
+// headerTimestampsFlag is set in the meta count of headers with timestamps, which follow
+// the meta, so that headers made before timestamps existed keep their hashes
+const headerTimestampsFlag uint64 = 1 << 63
+
 // StatusChange records change of status of an entry in the header
 type StatusChange struct {
-	Action string // either AddAction, ModAction, or DelAction
+	Action string // either AddAction, ModAction, DelAction or StatusAction
 	Hash   Hash
 }
 
@@ -33,10 +51,50 @@ type Header struct {
 	TypeLink   Hash // link to header of previous header of this type
 	Sig        Signature
 	Change     StatusChange
+	// Meta holds small app-defined values (e.g. a client request id) attached at commit
+	Meta map[string]string
+	// Timestamps are signed by the configured time authorities, see TimeAuthority
+	Timestamps []TimeStamp
+}
+
+const (
+	MaxHeaderMetaEntries = 16   // maximum number of keys in a header's Meta
+	MaxHeaderMetaSize    = 1024 // maximum total bytes of the keys and values in a header's Meta
+)
+
+var ErrHeaderMetaTooLarge = errors.New("header meta too large")
+var ErrBadHeaderMetaKey = errors.New("header meta keys must be non-empty")
+
+// checkHeaderMeta makes sure that header meta is within the size limits
+func checkHeaderMeta(meta map[string]string) (err error) {
+	if len(meta) > MaxHeaderMetaEntries {
+		err = ErrHeaderMetaTooLarge
+		return
+	}
+	size := 0
+	for k, v := range meta {
+		if k == "" {
+			err = ErrBadHeaderMetaKey
+			return
+		}
+		// each key and value is marshaled with a single byte length
+		if len(k) > 255 || len(v) > 255 {
+			err = ErrHeaderMetaTooLarge
+			return
+		}
+		size += len(k) + len(v)
+	}
+	if size > MaxHeaderMetaSize {
+		err = ErrHeaderMetaTooLarge
+	}
+	return
 }
 
 // newHeader makes Header object linked to a previous Header by hash
-func newHeader(hashSpec HashSpec, now time.Time, t string, entry Entry, privKey ic.PrivKey, prev Hash, prevType Hash, change *StatusChange) (hash Hash, header *Header, err error) {
+func newHeader(hashSpec HashSpec, now time.Time, t string, entry Entry, privKey ic.PrivKey, prev Hash, prevType Hash, change *StatusChange, meta map[string]string) (hash Hash, header *Header, err error) {
+	if err = checkHeaderMeta(meta); err != nil {
+		return
+	}
 	var hd Header
 	hd.Type = t
 	hd.Time = now
@@ -48,17 +106,25 @@ func newHeader(hashSpec HashSpec, now time.Time, t string, entry Entry, privKey
 		hd.Change.Hash = NullHash()
 	}
 
+	if len(meta) > 0 {
+		hd.Meta = meta
+	}
+
 	hd.EntryLink, err = entry.Sum(hashSpec)
 	if err != nil {
 		return
 	}
 
-	// sign the hash of the entry
-	sig, err := privKey.Sign(hd.EntryLink.H)
+	// sign everything but the signature
+	var data []byte
+	data, err = hd.signedData()
+	if err != nil {
+		return
+	}
+	hd.Sig, err = Sign(privKey, data)
 	if err != nil {
 		return
 	}
-	hd.Sig = Signature{S: sig}
 
 	hash, _, err = (&hd).Sum(hashSpec)
 	if err != nil {
@@ -69,6 +135,34 @@ func newHeader(hashSpec HashSpec, now time.Time, t string, entry Entry, privKey
 	return
 }
 
+// signedData returns what the header's signature is made over: the whole header as it
+// is marshaled but for the signature itself and the timestamps, which are made over it
+func (hd *Header) signedData() (data []byte, err error) {
+	var b bytes.Buffer
+	if err = writeStr(&b, hd.Type); err != nil {
+		return
+	}
+	var t []byte
+	if t, err = hd.Time.MarshalBinary(); err != nil {
+		return
+	}
+	b.Write(t)
+	for _, link := range []Hash{hd.HeaderLink, hd.EntryLink, hd.TypeLink} {
+		if err = link.MarshalHash(&b); err != nil {
+			return
+		}
+	}
+	if err = writeStr(&b, hd.Change.Action); err != nil {
+		return
+	}
+	if err = hd.Change.Hash.MarshalHash(&b); err != nil {
+		return
+	}
+	err = marshalHeaderMeta(&b, hd.Meta, false)
+	data = b.Bytes()
+	return
+}
+
 // Sum encodes and creates a hash digest of the header
 func (hd *Header) Sum(spec HashSpec) (hash Hash, b []byte, err error) {
 	b, err = hd.Marshal()
@@ -143,12 +237,120 @@ func MarshalHeader(writer io.Writer, hd *Header) (err error) {
 		return
 	}
 
-	// write out 0 for future expansion (meta)
-	z := uint64(0)
+	err = marshalHeaderMeta(writer, hd.Meta, len(hd.Timestamps) > 0)
+	if err != nil || len(hd.Timestamps) == 0 {
+		return
+	}
+	err = marshalHeaderTimestamps(writer, hd.Timestamps)
+	return
+}
+
+// marshalHeaderMeta writes the number of meta keys followed by the sorted keys and
+// their values.  Headers without meta are written with just a 0 count, as they were
+// before meta existed.  The count is flagged when timestamps follow.
+func marshalHeaderMeta(writer io.Writer, meta map[string]string, timestamps bool) (err error) {
+	z := uint64(len(meta))
+	if timestamps {
+		z |= headerTimestampsFlag
+	}
 	err = binary.Write(writer, binary.LittleEndian, &z)
 	if err != nil {
 		return
 	}
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		err = writeStr(writer, k)
+		if err != nil {
+			return
+		}
+		err = writeStr(writer, meta[k])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// marshalHeaderTimestamps writes the number of timestamps followed by each one's
+// authority, public key and reply
+func marshalHeaderTimestamps(writer io.Writer, stamps []TimeStamp) (err error) {
+	if len(stamps) > MaxHeaderTimestamps {
+		err = ErrBadTimeStamp
+		return
+	}
+	err = binary.Write(writer, binary.LittleEndian, uint8(len(stamps)))
+	if err != nil {
+		return
+	}
+	for i := range stamps {
+		ts := &stamps[i]
+		if len(ts.Authority) > 255 || len(ts.PublicKey) > 255 || len(ts.Reply) > roughtimeMaxReply {
+			err = ErrBadTimeStamp
+			return
+		}
+		err = writeStr(writer, ts.Authority)
+		if err != nil {
+			return
+		}
+		err = writeStr(writer, string(ts.PublicKey))
+		if err != nil {
+			return
+		}
+		err = binary.Write(writer, binary.LittleEndian, uint16(len(ts.Reply)))
+		if err != nil {
+			return
+		}
+		_, err = writer.Write(ts.Reply)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// unmarshalHeaderTimestamps reads the timestamps written by marshalHeaderTimestamps
+func unmarshalHeaderTimestamps(reader io.Reader) (stamps []TimeStamp, err error) {
+	var n uint8
+	err = binary.Read(reader, binary.LittleEndian, &n)
+	if err != nil {
+		return
+	}
+	if n == 0 || n > MaxHeaderTimestamps {
+		err = ErrBadTimeStamp
+		return
+	}
+	stamps = make([]TimeStamp, n)
+	for i := range stamps {
+		ts := &stamps[i]
+		ts.Authority, err = readStr(reader)
+		if err != nil {
+			return
+		}
+		var key string
+		key, err = readStr(reader)
+		if err != nil {
+			return
+		}
+		ts.PublicKey = []byte(key)
+		var l uint16
+		err = binary.Read(reader, binary.LittleEndian, &l)
+		if err != nil {
+			return
+		}
+		if int(l) > roughtimeMaxReply {
+			err = ErrBadTimeStamp
+			return
+		}
+		ts.Reply = make([]byte, l)
+		_, err = io.ReadFull(reader, ts.Reply)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -225,11 +427,59 @@ func UnmarshalHeader(reader io.Reader, hd *Header, hashSize int) (err error) {
 	if err != nil {
 		return
 	}
+	timestamps := z&headerTimestampsFlag != 0
+	z &^= headerTimestampsFlag
+	if z > MaxHeaderMetaEntries {
+		err = ErrHeaderMetaTooLarge
+		return
+	}
+	if z > 0 {
+		hd.Meta = make(map[string]string, z)
+		for i := uint64(0); i < z; i++ {
+			var k, v string
+			k, err = readStr(reader)
+			if err != nil {
+				return
+			}
+			v, err = readStr(reader)
+			if err != nil {
+				return
+			}
+			hd.Meta[k] = v
+		}
+	}
+	if timestamps {
+		hd.Timestamps, err = unmarshalHeaderTimestamps(reader)
+	}
 	return
 }
 
 // MarshalSignature writes a signature to a binary stream
 func MarshalSignature(writer io.Writer, s *Signature) (err error) {
+	if len(s.S) >= int(sigKeyMarker) {
+		err = errors.New("signature too long")
+		return
+	}
+	if s.Key != nil {
+		if len(s.Key) > 255 {
+			err = errors.New("signature key too long")
+			return
+		}
+		_, err = writer.Write([]byte{sigKeyMarker, uint8(len(s.Key))})
+		if err != nil {
+			return
+		}
+		_, err = writer.Write(s.Key)
+		if err != nil {
+			return
+		}
+	}
+	if s.A != SigEd25519 {
+		_, err = writer.Write([]byte{sigAlgorithmMarker, byte(s.A)})
+		if err != nil {
+			return
+		}
+	}
 	l := uint8(len(s.S))
 	err = binary.Write(writer, binary.LittleEndian, l)
 	if err != nil {
@@ -249,6 +499,35 @@ func UnmarshalSignature(reader io.Reader, s *Signature) (err error) {
 	if err != nil {
 		return
 	}
+	s.Key = nil
+	if l == sigKeyMarker {
+		err = binary.Read(reader, binary.LittleEndian, &l)
+		if err != nil {
+			return
+		}
+		s.Key = make([]byte, l)
+		_, err = io.ReadFull(reader, s.Key)
+		if err != nil {
+			return
+		}
+		err = binary.Read(reader, binary.LittleEndian, &l)
+		if err != nil {
+			return
+		}
+	}
+	s.A = SigEd25519
+	if l == sigAlgorithmMarker {
+		var a uint8
+		err = binary.Read(reader, binary.LittleEndian, &a)
+		if err != nil {
+			return
+		}
+		s.A = SigAlgorithm(a)
+		err = binary.Read(reader, binary.LittleEndian, &l)
+		if err != nil {
+			return
+		}
+	}
 	var b = make([]byte, l)
 	err = binary.Read(reader, binary.LittleEndian, b)
 	if err != nil {
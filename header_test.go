@@ -16,7 +16,7 @@ func TestNewHeader(t *testing.T) {
 	Convey("it should make a header and return its hash", t, func() {
 		e := GobEntry{C: "some data"}
 		ph := NullHash()
-		hash, header, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, nil)
+		hash, header, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, nil, nil)
 
 		So(err, ShouldBeNil)
 		// encode the header and create a hash of it
@@ -30,7 +30,7 @@ func TestNewHeader(t *testing.T) {
 		e := GobEntry{C: "some data"}
 		ph := NullHash()
 		delHash, _ := NewHash("QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY")
-		hash, header, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, &StatusChange{Action: DelAction, Hash: delHash})
+		hash, header, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, &StatusChange{Action: DelAction, Hash: delHash}, nil)
 
 		So(err, ShouldBeNil)
 		// encode the header and create a hash of it
@@ -41,6 +41,85 @@ func TestNewHeader(t *testing.T) {
 	})
 }
 
+func TestHeaderMeta(t *testing.T) {
+	h, key, now := chainTestSetup()
+	e := GobEntry{C: "some data"}
+	ph := NullHash()
+	meta := map[string]string{"device": "phone", "requestID": "42"}
+
+	Convey("it should sign and marshal the meta", t, func() {
+		_, header, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, nil, meta)
+		So(err, ShouldBeNil)
+		So(header.Meta, ShouldResemble, meta)
+
+		data, err := header.signedData()
+		So(err, ShouldBeNil)
+		valid, err := header.Sig.Verify(key.GetPublic(), data)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+		valid, _ = header.Sig.Verify(key.GetPublic(), header.EntryLink.H)
+		So(valid, ShouldBeFalse)
+
+		// the meta can't be changed without invalidating the signature
+		changed := *header
+		changed.Meta = map[string]string{"device": "laptop", "requestID": "42"}
+		data, _ = changed.signedData()
+		valid, _ = header.Sig.Verify(key.GetPublic(), data)
+		So(valid, ShouldBeFalse)
+
+		b, err := header.Marshal()
+		So(err, ShouldBeNil)
+		var nh Header
+		err = (&nh).Unmarshal(b, 34)
+		So(err, ShouldBeNil)
+		So(nh.Meta, ShouldResemble, meta)
+	})
+
+	Convey("headers without meta should marshal as before meta existed", t, func() {
+		_, header, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, nil, nil)
+		So(err, ShouldBeNil)
+		So(header.Meta, ShouldBeNil)
+		b, err := header.Marshal()
+		So(err, ShouldBeNil)
+		So(b[len(b)-8:], ShouldResemble, make([]byte, 8))
+	})
+
+	Convey("the signature should cover all of the header but itself", t, func() {
+		_, header, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, nil, nil)
+		So(err, ShouldBeNil)
+		other, _ := NewHash("QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY")
+		for _, change := range []func(hd *Header){
+			func(hd *Header) { hd.Type = "oddNumbers" },
+			func(hd *Header) { hd.Time = hd.Time.Add(time.Second) },
+			func(hd *Header) { hd.HeaderLink = other },
+			func(hd *Header) { hd.TypeLink = other },
+			func(hd *Header) { hd.Change = StatusChange{Action: DelAction, Hash: other} },
+		} {
+			changed := *header
+			change(&changed)
+			data, _ := changed.signedData()
+			valid, _ := header.Sig.Verify(key.GetPublic(), data)
+			So(valid, ShouldBeFalse)
+		}
+		data, _ := header.signedData()
+		valid, _ := header.Sig.Verify(key.GetPublic(), data)
+		So(valid, ShouldBeTrue)
+	})
+
+	Convey("it should reject bad meta", t, func() {
+		_, _, err := newHeader(h, now, "evenNumbers", &e, key, ph, ph, nil, map[string]string{"": "x"})
+		So(err, ShouldEqual, ErrBadHeaderMetaKey)
+		_, _, err = newHeader(h, now, "evenNumbers", &e, key, ph, ph, nil, map[string]string{"k": string(make([]byte, 256))})
+		So(err, ShouldEqual, ErrHeaderMetaTooLarge)
+		big := make(map[string]string)
+		for i := 0; i < 8; i++ {
+			big[fmt.Sprintf("k%d", i)] = string(make([]byte, 200))
+		}
+		_, _, err = newHeader(h, now, "evenNumbers", &e, key, ph, ph, nil, big)
+		So(err, ShouldEqual, ErrHeaderMetaTooLarge)
+	})
+}
+
 func TestMarshalHeader(t *testing.T) {
 	h, key, now := chainTestSetup()
 
@@ -89,7 +168,8 @@ func TestMarshalSignature(t *testing.T) {
 
 func testHeader(h HashSpec, t string, entry Entry, key ic.PrivKey, now time.Time) *Header {
 	hd := mkTestHeader(t)
-	sig, err := key.Sign(hd.EntryLink.H)
+	data, _ := hd.signedData()
+	sig, err := key.Sign(data)
 	if err != nil {
 		panic(err)
 	}
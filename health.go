@@ -0,0 +1,99 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// health implements checks of whether a holochain's parts are working, for process
+// supervisors to act on
+
+package holochain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// GossipStallFactor is how many gossip intervals may pass without the gossip loop
+// running before it is considered stalled
+const GossipStallFactor = 3
+
+// HealthCheck is the result of checking one part of a holochain
+type HealthCheck struct {
+	Name   string
+	OK     bool
+	Status string
+}
+
+// Health checks the parts of the holochain needed for it to be alive, which are its chain
+// and DHT stores, and if ready is set also those needed for it to serve requests, which
+// are its genesis, its libp2p host and its gossip loop.  It returns whether all the checks
+// passed.
+func (h *Holochain) Health(ready bool) (checks []HealthCheck, ok bool) {
+	checks = append(checks, h.checkChainStore(), h.checkDHTStore())
+	if ready {
+		checks = append(checks, h.checkStarted(), h.checkHost(), h.checkGossip())
+	}
+	ok = true
+	for _, c := range checks {
+		ok = ok && c.OK
+	}
+	return
+}
+
+func healthCheck(name string, err error, status string) HealthCheck {
+	if err != nil {
+		return HealthCheck{Name: name, Status: err.Error()}
+	}
+	return HealthCheck{Name: name, OK: true, Status: status}
+}
+
+func (h *Holochain) checkChainStore() HealthCheck {
+	if h.chain == nil {
+		return healthCheck("chain", mkErr("chain not loaded"), "")
+	}
+	_, err := os.Stat(filepath.Join(h.DBPath(), StoreFileName))
+	return healthCheck("chain", err, fmt.Sprintf("%d entries", h.chain.Length()))
+}
+
+func (h *Holochain) checkDHTStore() HealthCheck {
+	if h.dht == nil {
+		return healthCheck("dht", mkErr("DHT not set up"), "")
+	}
+	idx, err := h.dht.GetIdx()
+	return healthCheck("dht", err, fmt.Sprintf("%d puts", idx))
+}
+
+func (h *Holochain) checkStarted() HealthCheck {
+	if !h.Started() {
+		return healthCheck("genesis", mkErr("chain not started"), "")
+	}
+	return healthCheck("genesis", nil, "started")
+}
+
+func (h *Holochain) checkHost() HealthCheck {
+	if h.node == nil || h.node.Host == nil {
+		return healthCheck("host", mkErr("node not running"), "")
+	}
+	return healthCheck("host", nil, fmt.Sprintf("listening on %v", h.node.NetAddr))
+}
+
+func (h *Holochain) checkGossip() HealthCheck {
+	if h.dht == nil {
+		return healthCheck("gossip", mkErr("DHT not set up"), "")
+	}
+	if h.Suspended() {
+		return healthCheck("gossip", nil, "suspended")
+	}
+	last := atomic.LoadInt64(&h.dht.lastGossip)
+	if last == 0 {
+		return healthCheck("gossip", mkErr("gossip not running"), "")
+	}
+	since := time.Since(time.Unix(0, last))
+	interval := time.Duration(atomic.LoadInt64(&h.dht.gossipInterval))
+	if since > GossipStallFactor*interval {
+		return healthCheck("gossip", fmt.Errorf("gossip stalled, last ran %v ago", since), "")
+	}
+	return healthCheck("gossip", nil, fmt.Sprintf("last ran %v ago", since))
+}
@@ -0,0 +1,55 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("it should be alive", t, func() {
+		checks, ok := h.Health(false)
+		So(ok, ShouldBeTrue)
+		So(len(checks), ShouldEqual, 2)
+		So(checks[0].Name, ShouldEqual, "chain")
+		So(checks[1].Name, ShouldEqual, "dht")
+	})
+
+	Convey("it should not be ready without gossip", t, func() {
+		checks, ok := h.Health(true)
+		So(ok, ShouldBeFalse)
+		So(len(checks), ShouldEqual, 5)
+		So(checks[2].OK, ShouldBeTrue)
+		So(checks[3].OK, ShouldBeTrue)
+		So(checks[4], ShouldResemble, HealthCheck{Name: "gossip", Status: "gossip not running"})
+	})
+
+	Convey("it should be ready while gossip runs and not when it stalls", t, func() {
+		atomic.StoreInt64(&h.dht.gossipInterval, int64(time.Second))
+		atomic.StoreInt64(&h.dht.lastGossip, time.Now().UnixNano())
+		_, ok := h.Health(true)
+		So(ok, ShouldBeTrue)
+
+		atomic.StoreInt64(&h.dht.lastGossip, time.Now().Add(-time.Minute).UnixNano())
+		checks, ok := h.Health(true)
+		So(ok, ShouldBeFalse)
+		So(checks[4].Status, ShouldStartWith, "gossip stalled")
+		atomic.StoreInt64(&h.dht.lastGossip, 0)
+	})
+
+	Convey("it should not be alive without its chain store", t, func() {
+		path := filepath.Join(h.DBPath(), StoreFileName)
+		err := os.Rename(path, path+".bak")
+		So(err, ShouldBeNil)
+		defer os.Rename(path+".bak", path)
+		checks, ok := h.Health(false)
+		So(ok, ShouldBeFalse)
+		So(checks[0].OK, ShouldBeFalse)
+	})
+}
@@ -8,6 +8,7 @@ package holochain
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -20,6 +21,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -47,6 +49,41 @@ type Config struct {
 	PeerModeDHTNode bool
 	BootstrapServer string
 	Loggers         Loggers
+	Bridges         []Bridge
+	DHTQuota        int64  // bytes of entry data the DHT store may hold, 0 for no limit
+	DHTQuotaPolicy  string // what to do when the quota is reached, DHTQuotaReject (the default) or DHTQuotaEvict
+	// ClockSkew is the seconds header times may be ahead of local time, 0 for DefaultClockSkew
+	// and negative for no limit
+	ClockSkew int
+	// AuditLog turns on recording the actions the holochain does in its audit directory,
+	// whose files are rotated when they reach AuditLogSize bytes, 0 for DefaultAuditLogSize
+	AuditLog     bool
+	AuditLogSize int64
+	// RecordMessages turns on recording the messages that change the DHT, and the
+	// responses to requests sent while handling them, so the DHT can be replayed
+	RecordMessages bool
+	// AgentDir is where the agent's key is kept when it is kept outside the holochain's
+	// directory and the service's, as it must be for a standby to take over
+	AgentDir string
+	// Standbys are the node IDs of the standbys allowed to mirror this node
+	Standbys []string
+	// TrustedDevices are the node IDs of the agent's other devices allowed to forward
+	// zome calls to this node
+	TrustedDevices []string
+	// BridgeGrants are the bridges to this app from other apps, with the tokens
+	// their calls must carry
+	BridgeGrants []BridgeGrant
+	// ZomeConfig holds settings for this instance of the app by zome name, which the
+	// zome reads with config().  Unlike DNA properties they don't change the DNA hash.
+	ZomeConfig map[string]map[string]string
+	// GossipMaxPuts is the most puts sent or asked for in one gossip message, the rest
+	// following in further messages, 0 for DefaultGossipMaxPuts and negative for no limit
+	GossipMaxPuts int
+	// PowerProfile is PowerProfileNormal, the default, or PowerProfileLow
+	PowerProfile string
+	// ValidationDebug turns on keeping transcripts of validations, and when a put we
+	// receive fails validation, logging how our transcript differs from its author's
+	ValidationDebug bool
 }
 
 // Progenitor holds data on the creator of the DNA
@@ -58,6 +95,8 @@ type Progenitor struct {
 // Holochain struct holds the full "DNA" of the holochain (all your app code for managing distributed data integrity)
 type Holochain struct {
 	//---- lowercase private values not serialized; initialized on Load
+	// first so that its counters are aligned for atomic access
+	usage          usageCounters
 	nodeID         peer.ID // this is hash of the public key of the id and acts as the node address
 	nodeIDStr      string  // this is just a cached version of the nodeID B58 string encoded
 	dnaHash        Hash
@@ -66,11 +105,43 @@ type Holochain struct {
 	agent          Agent
 	encodingFormat string
 	hashSpec       HashSpec
+	sigAlgorithms  []SigAlgorithm // signature algorithms allowed by the DNA
 	config         Config
 	dht            *DHT
 	nucleus        *Nucleus
 	node           *Node
 	chain          *Chain // This node's local source chain
+	hooks          map[HookPoint][]Hook
+	scheduler      *Scheduler
+	channels       *Channels
+	presence       *Presence
+	tasks          *TaskRunner
+	messages       *MessageTracker
+	outbox         *Outbox
+	logs           *LogRecorder
+	// chunked validation packages offered to other nodes
+	packages packageStore
+	// transcripts of recent validations, kept when the config's ValidationDebug is on
+	transcripts transcriptLog
+	// the report of the last startup integrity check
+	integrity   *IntegrityReport
+	integrityLk sync.Mutex
+	// what records the actions the holochain does, if anything
+	auditor Auditor
+	// where messages are recorded, and the recorded responses when replaying them
+	msgLog    *messageLog
+	replaying *replayResponses
+	// the background work stopped while the holochain is suspended
+	suspended *suspendedWork
+	powerLk   sync.Mutex
+	events    Events
+	// guards changes made to the config while running and saving them
+	configLk sync.Mutex
+	// held by a commit until its publications are queued, as the journal only ever
+	// holds one commit
+	commitLk sync.Mutex
+	// the standby epoch when the holochain was loaded, see checkFence
+	standbyEpoch int64
 }
 
 func (h *Holochain) Nucleus() (n *Nucleus) {
@@ -121,15 +192,31 @@ func InitializeHolochain() {
 		gob.Register(Gossip{})
 		gob.Register(ValidateQuery{})
 		gob.Register(ValidateResponse{})
+		gob.Register(ValidatePackageQuery{})
+		gob.Register(ValidatePackageChunk{})
 		gob.Register(Put{})
 		gob.Register(GobEntry{})
+		gob.Register(CBOR{})
 		gob.Register(LinkQueryResp{})
 		gob.Register(TaggedHash{})
 		gob.Register(ErrorResponse{})
 		gob.Register(DelEntry{})
+		gob.Register(StatusEntry{})
+		gob.Register(StatusReq{})
 		gob.Register(StatusChange{})
 		gob.Register(Package{})
 		gob.Register(AppMsg{})
+		gob.Register(HeadersReq{})
+		gob.Register(HeadersResp{})
+		gob.Register(ReceiptReq{})
+		gob.Register(LinksQuery{})
+		gob.Register(LinksQueryResp{})
+		gob.Register(ReplicateReq{})
+		gob.Register(ReplicateResp{})
+		gob.Register(ForwardReq{})
+		gob.Register(ForwardResp{})
+		gob.Register(ValidationTranscriptReq{})
+		gob.Register(ValidationTranscript{})
 
 		RegisterBultinRibosomes()
 
@@ -141,6 +228,8 @@ func InitializeHolochain() {
 		ValidateProtocol = Protocol{protocol.ID("/hc-validate/0.0.0"), ValidateReceiver}
 		GossipProtocol = Protocol{protocol.ID("/hc-gossip/0.0.0"), GossipReceiver}
 		ActionProtocol = Protocol{protocol.ID("/hc-action/0.0.0"), ActionReceiver}
+		ReplicationProtocol = Protocol{protocol.ID("/hc-replicate/0.0.0"), ReplicationReceiver}
+		ForwardProtocol = Protocol{protocol.ID("/hc-forward/0.0.0"), ForwardReceiver}
 		_holochainInitialized = true
 	}
 }
@@ -199,6 +288,7 @@ func NewHolochain(agent Agent, root string, format string, zomes ...Zome) Holoch
 	}
 
 	h.PrepareHashType()
+	h.PrepareSigAlgorithms()
 
 	return h
 }
@@ -209,7 +299,8 @@ func (h *Holochain) Agent() Agent {
 }
 
 // PrepareHashType makes sure the given string is a correct multi-hash and stores
-// the code and length to the Holochain struct
+// the code and length to the Holochain struct.  All entry and header hashes for the
+// app are made with this hash type, and puts whose hashes don't match it are rejected.
 func (h *Holochain) PrepareHashType() (err error) {
 	c, ok := mh.Names[h.nucleus.dna.DHTConfig.HashType]
 	if !ok {
@@ -233,14 +324,32 @@ func (h *Holochain) Prepare() (err error) {
 		return
 	}
 
+	if err = h.PrepareSigAlgorithms(); err != nil {
+		return
+	}
+	var alg SigAlgorithm
+	if alg, err = sigAlgorithmForKey(h.agent.PrivKey()); err != nil {
+		return
+	}
+	if err = h.CheckSigAlgorithm(alg); err != nil {
+		err = fmt.Errorf("agent key: %w (%v)", err, alg)
+		return
+	}
+
 	listenaddr := fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", h.config.Port)
 	h.node, err = NewNode(listenaddr, h.Agent().(*LibP2PAgent))
 	if err != nil {
 		return
 	}
 
-	h.dht = NewDHT(h)
+	h.dht, err = NewDHT(h)
+	if err != nil {
+		return
+	}
 	h.nucleus.h = h
+	h.tasks = NewTaskRunner(h)
+	h.messages = NewMessageTracker(h)
+	h.outbox = NewOutbox(h)
 
 	return
 }
@@ -269,10 +378,97 @@ func (h *Holochain) Activate() (err error) {
 		}
 
 	}
+	if len(h.config.Standbys) > 0 {
+		if err = h.node.StartProtocol(h, ReplicationProtocol); err != nil {
+			return
+		}
+	}
+	if len(h.config.TrustedDevices) > 0 {
+		if err = h.node.StartProtocol(h, ForwardProtocol); err != nil {
+			return
+		}
+	}
 	if h.config.PeerModeAuthor {
 		if err = h.nucleus.Start(); err != nil {
 			return
 		}
+		if h.scheduler, err = NewScheduler(h); err != nil {
+			return
+		}
+		h.scheduler.Start()
+		if h.channels, err = NewChannels(h); err != nil {
+			return
+		}
+		h.presence = NewPresence(h, h.channels.ps)
+		if err = h.presence.Start(); err != nil {
+			return
+		}
+		h.outbox.Start()
+		if e := h.replayJournal(); e != nil {
+			h.dht.dlog.Logf("error publishing journaled commit: %v", e)
+		}
+		if e := h.publishAgent(); e != nil {
+			h.dht.dlog.Logf("error publishing agent entries: %v", e)
+		}
+	}
+	h.CheckIntegrity()
+	return
+}
+
+// StopTimeout is how long Close and Suspend wait for each part of the holochain's
+// background work to stop, like a scheduled call or task that won't finish, before
+// carrying on without it
+var StopTimeout = 10 * time.Second
+
+// stopWithin calls stop and waits up to StopTimeout for it to return
+func (h *Holochain) stopWithin(name string, stop func()) {
+	done := make(chan struct{})
+	go func() {
+		stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(StopTimeout):
+		h.config.Loggers.App.Logf("warning: gave up waiting for the %s to stop", name)
+	}
+}
+
+// Close stops the holochain's background work, shuts down its node and flushes its chain
+// and DHT to disk.  The node is closed first so that no more messages are handled while
+// the stores are closing.
+func (h *Holochain) Close() (err error) {
+	if h.presence != nil {
+		h.stopWithin("presence heartbeat", h.presence.Stop)
+	}
+	if h.channels != nil {
+		h.stopWithin("channels", h.channels.Close)
+	}
+	if h.scheduler != nil {
+		h.stopWithin("scheduler", h.scheduler.Stop)
+	}
+	if h.outbox != nil {
+		h.stopWithin("outbox", h.outbox.Stop)
+	}
+	if h.tasks != nil {
+		h.stopWithin("tasks", h.tasks.Stop)
+	}
+	keep := func(e error) {
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	keep(h.node.Close())
+	if h.dht != nil {
+		keep(h.dht.Close())
+	}
+	keep(h.chain.Close())
+	unregisterOpen(h)
+	if l, ok := h.auditor.(*AuditLog); ok {
+		keep(l.Close())
+	}
+	if h.msgLog != nil {
+		keep(h.msgLog.close())
 	}
 	return
 }
@@ -387,6 +583,12 @@ func (h *Holochain) GenChain() (headerHash Hash, err error) {
 }
 
 func (h *Holochain) setupConfig() (err error) {
+	if err = validateQuotaPolicy(h.config.DHTQuotaPolicy); err != nil {
+		return
+	}
+	if err = validatePowerProfile(h.config.PowerProfile); err != nil {
+		return
+	}
 	if err = h.config.Loggers.App.New(nil); err != nil {
 		return
 	}
@@ -405,9 +607,26 @@ func (h *Holochain) setupConfig() (err error) {
 	if err = h.config.Loggers.TestInfo.New(nil); err != nil {
 		return
 	}
+	h.logs = NewLogRecorder(DefaultLogRecords)
+	h.config.Loggers.App.SetRecorder(h.logs, "app", LogLevelInfo)
+	h.config.Loggers.DHT.SetRecorder(h.logs, "dht", LogLevelDebug)
+	h.config.Loggers.Gossip.SetRecorder(h.logs, "gossip", LogLevelDebug)
+	if err = h.setupAuditLog(); err != nil {
+		return
+	}
+	if h.config.RecordMessages {
+		if h.msgLog, err = openMessageLog(filepath.Join(h.DBPath(), MessageLogFileName)); err != nil {
+			return
+		}
+	}
 	return
 }
 
+// Logs returns the recorder of the holochain's recent log lines
+func (h *Holochain) Logs() *LogRecorder {
+	return h.logs
+}
+
 // EncodeDNA encodes a holochain's DNA to an io.Writer
 func (h *Holochain) EncodeDNA(writer io.Writer) (err error) {
 	return Encode(writer, h.encodingFormat, &h.nucleus.dna)
@@ -416,7 +635,7 @@ func (h *Holochain) EncodeDNA(writer io.Writer) (err error) {
 // NewEntry adds an entry and it's header to the chain and returns the header and it's hash
 func (h *Holochain) NewEntry(now time.Time, entryType string, entry Entry) (hash Hash, header *Header, err error) {
 	var l int
-	l, hash, header, err = h.chain.PrepareHeader(now, entryType, entry, h.agent.PrivKey(), nil)
+	l, hash, header, err = h.chain.PrepareHeader(now, entryType, entry, h.agent.PrivKey(), nil, nil)
 	if err == nil {
 		err = h.chain.addEntry(l, hash, header, entry)
 	}
@@ -461,15 +680,67 @@ func (h *Holochain) Call(zomeType string, function string, arguments interface{}
 	if err != nil {
 		return
 	}
+	result, err = h.call(n, z, function, arguments, exposureContext)
+	return
+}
+
+// CallContext executes an exposed function like Call but returns ctx.Err(), wrapped in
+// ErrTimeout if the deadline passed, if the context is done before the call finishes.
+// Ribosomes that implement Interrupter have the running call aborted, otherwise it is
+// left to finish in the background.
+func (h *Holochain) CallContext(ctx context.Context, zomeType string, function string, arguments interface{}, exposureContext string) (result interface{}, err error) {
+	n, z, err := h.MakeRibosome(zomeType)
+	if err != nil {
+		return
+	}
+	type callResult struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		r, e := h.call(n, z, function, arguments, exposureContext)
+		done <- callResult{r, e}
+	}()
+	select {
+	case r := <-done:
+		result, err = r.result, r.err
+	case <-ctx.Done():
+		if i, ok := n.(Interrupter); ok {
+			i.Interrupt()
+		}
+		err = contextErr(ctx)
+	}
+	return
+}
+
+// call calls a function on an already created ribosome for the zome, running the call hooks
+func (h *Holochain) call(n Ribosome, z *Zome, function string, arguments interface{}, exposureContext string) (result interface{}, err error) {
+	zomeType := z.Name
 	fn, err := z.GetFunctionDef(function)
 	if err != nil {
 		return
 	}
 	if !fn.ValidExposure(exposureContext) {
-		err = errors.New("function not available")
+		err = ErrUnauthorized
+		return
+	}
+	ctx := HookContext{Point: HookBeforeCall, Zome: zomeType, Function: function, Agent: h.nodeIDStr, Exposure: exposureContext, Args: arguments, Start: time.Now()}
+	err = h.runHooks(&ctx)
+	if err != nil {
 		return
 	}
+	vmStart := time.Now()
 	result, err = n.Call(fn, arguments)
+	h.recordVM(vmStart)
+
+	ctx.Point = HookAfterCall
+	ctx.Result = result
+	ctx.Err = err
+	ctx.Duration = time.Since(ctx.Start)
+	if e := h.runHooks(&ctx); e != nil {
+		h.config.Loggers.App.Logf("after-call hook for %s.%s failed: %v", zomeType, function, e)
+	}
 	return
 }
 
@@ -539,7 +810,7 @@ func (h *Holochain) Reset() (err error) {
 		close(h.dht.puts)
 		close(h.dht.gchan)
 	}
-	h.dht = NewDHT(h)
+	h.dht, err = NewDHT(h)
 
 	return
 }
@@ -556,10 +827,26 @@ func (h *Holochain) HashSpec() HashSpec {
 
 // Send builds a message and either delivers it locally or over the network via node.Send
 func (h *Holochain) Send(proto Protocol, to peer.ID, t MsgType, body interface{}) (response interface{}, err error) {
-	message := h.node.NewMessage(t, body)
-	if err != nil {
-		return
-	}
+	response, err = h.send(proto, to, t, body, nil)
+	return
+}
+
+// send is Send calling written, if given, once the message has reached the receiver
+func (h *Holochain) send(proto Protocol, to peer.ID, t MsgType, body interface{}, written func()) (response interface{}, err error) {
+	response, err = h.sendMessage(proto, to, h.node.NewMessage(t, body), written)
+	return
+}
+
+// sendMessage sends a message that has already been made, so that the same message
+// can be sent to several nodes
+func (h *Holochain) sendMessage(proto Protocol, to peer.ID, message *Message, written func()) (response interface{}, err error) {
+	response, _, err = h.sendMessageAcked(proto, to, message, written)
+	return
+}
+
+// sendMessageAcked is sendMessage also returning whether the receiver responded, so
+// that an error it returned can be told from one in getting the message to it
+func (h *Holochain) sendMessageAcked(proto Protocol, to peer.ID, message *Message, written func()) (response interface{}, acked bool, err error) {
 	f, err := message.Fingerprint()
 	if err != nil {
 		panic(fmt.Sprintf("error calculating fingerprint when sending message %v", message))
@@ -568,17 +855,27 @@ func (h *Holochain) Send(proto Protocol, to peer.ID, t MsgType, body interface{}
 	// the receiver directly
 	if to == h.node.HashAddr {
 		Debugf("Sending message (local):%v (fingerprint:%s)", message, f)
+		if written != nil {
+			written()
+		}
 		response, err = proto.Receiver(h, message)
+		acked = true
 		Debugf("send result (local): %v (fp:%s)error:%v", response, f, err)
 	} else {
 		Debugf("Sending message (net):%v (fingerprint:%s)", message, f)
 		var r Message
-		r, err = h.node.Send(proto, to, message)
+		if h.replaying != nil {
+			r, err = h.replaying.response(to, message)
+		} else {
+			r, err = h.node.send(proto, to, message, written)
+		}
 		Debugf("send result (net): %v (fp:%s) error:%v", r, f, err)
 
 		if err != nil {
 			return
 		}
+		acked = true
+		h.recordResponse(to, message, &r)
 		if r.Type == ERROR_RESPONSE {
 			errResp := r.Body.(ErrorResponse)
 			err = errResp.DecodeResponseError()
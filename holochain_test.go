@@ -2,12 +2,15 @@ package holochain
 
 import (
 	"bytes"
+	"context"
 	gob "encoding/gob"
+	"errors"
 	"fmt"
 	// toml "github.com/BurntSushi/toml"
 	"github.com/google/uuid"
 	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
 	"os"
 	// "strings"
 	"path/filepath"
@@ -74,6 +77,14 @@ func TestPrepare(t *testing.T) {
 		So(err.Error(), ShouldEqual, "Chain requires Holochain version "+nextVersion)
 
 	})
+	Convey("it should fail if a zome defines an entry type in the system namespace", t, func() {
+		dna := DNA{DHTConfig: DHTConfig{HashType: "sha1"}, RequiresVersion: Version,
+			Zomes: []Zome{{Name: "myZome", Entries: []EntryDef{{Name: AgentEntryType}}}}}
+		h := Holochain{}
+		h.nucleus = NewNucleus(&h, &dna)
+		err := h.Prepare()
+		So(err.Error(), ShouldEqual, "entry type %agent in zome myZome: entry type is reserved for system use")
+	})
 	Convey("it should return no err if the requires version is correct", t, func() {
 		d, _, h := setupTestChain("test")
 		defer CleanupTestDir(d)
@@ -357,10 +368,32 @@ func TestCall(t *testing.T) {
 	})
 	Convey("it should fail calls to functions not exposed to the given context", t, func() {
 		_, err := h.Call("zySampleZome", "testStrFn1", "arg1 arg2", PUBLIC_EXPOSURE)
+		So(err, ShouldEqual, ErrUnauthorized)
 		So(err.Error(), ShouldEqual, "function not available")
 	})
 }
 
+func TestCallContext(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	Convey("it should call the exposed function", t, func() {
+		result, err := h.CallContext(context.Background(), "jsSampleZome", "testStrFn1", "foo", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, "result: foo")
+	})
+	Convey("it should interrupt calls that outlast the context", t, func() {
+		h.nucleus.dna.Zomes[1].Code += `function spin(x){while(true){}}`
+		h.nucleus.dna.Zomes[1].Functions = append(h.nucleus.dna.Zomes[1].Functions, FunctionDef{Name: "spin", CallingType: STRING_CALLING})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := h.CallContext(ctx, "jsSampleZome", "spin", "", ZOME_EXPOSURE)
+		So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+}
+
 func TestLoadTestFiles(t *testing.T) {
 	d, _, h := setupTestChain("test")
 	defer CleanupTestDir(d)
@@ -410,6 +443,35 @@ func TestCommit(t *testing.T) {
 	})
 }
 
+func TestClose(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	commit(h, "oddNumbers", "7")
+
+	Convey("it should flush the chain and close the stores", t, func() {
+		err := h.Close()
+		So(err, ShouldBeNil)
+		c, err := NewChainFromFile(h.hashSpec, filepath.Join(h.DBPath(), StoreFileName))
+		So(err, ShouldBeNil)
+		So(c.Length(), ShouldEqual, h.chain.Length())
+		c.Close()
+
+		err = h.dht.db.View(func(tx *buntdb.Tx) error { return nil })
+		So(err, ShouldEqual, buntdb.ErrDatabaseClosed)
+	})
+
+	Convey("closing the chain again should do nothing", t, func() {
+		So(h.chain.Close(), ShouldBeNil)
+	})
+
+	Convey("adding entries after closing should fail", t, func() {
+		l := h.chain.Length()
+		_, err := h.chain.AddEntry(time.Now(), "oddNumbers", &GobEntry{C: "9"}, h.agent.PrivKey())
+		So(err, ShouldEqual, ErrChainClosed)
+		So(h.chain.Length(), ShouldEqual, l)
+	})
+}
+
 //func TestDNADefaults(t *testing.T) {
 //	h, err := DecodeDNA(strings.NewReader(`[[Zomes]]
 //Name = "test"
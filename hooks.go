@@ -0,0 +1,83 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// hooks implements registration of embedder supplied functions that run around zome
+// calls, commits and received messages
+
+package holochain
+
+import (
+	"time"
+)
+
+// HookPoint identifies where in the processing a hook is run
+type HookPoint int
+
+const (
+	// HookBeforeCall hooks run before a zome function is called; an error aborts the call
+	HookBeforeCall HookPoint = iota
+
+	// HookAfterCall hooks run after a zome function returns; errors are logged
+	HookAfterCall
+
+	// HookOnCommit hooks run after an entry is validated but before it is added to the
+	// chain; an error aborts the commit
+	HookOnCommit
+
+	// HookOnReceive hooks run before an app message is passed to a zome's receive
+	// function; an error aborts the receive
+	HookOnReceive
+
+	// HookOnMessageStatus hooks run each time the status of a message sent in the
+	// background changes; errors are logged
+	HookOnMessageStatus
+)
+
+// HookContext holds the data passed to a hook
+type HookContext struct {
+	Point    HookPoint
+	Zome     string
+	Function string
+	Agent    string // B58 node id of the agent on whose behalf the action is taken
+	Exposure string
+	Args     interface{}
+
+	// only set for HookOnCommit
+	EntryType string
+	Entry     Entry
+
+	// only set for HookOnMessageStatus
+	Message *MessageStatus
+
+	// only set for HookAfterCall
+	Result   interface{}
+	Err      error
+	Duration time.Duration
+
+	Start time.Time
+}
+
+// Hook is the function type for hooks
+type Hook func(ctx *HookContext) error
+
+// AddHook registers a hook to be run at the given point.  Hooks run in the order they
+// were added.  Hooks should be added before the holochain is activated as AddHook is not
+// safe to call concurrently with running calls.
+func (h *Holochain) AddHook(point HookPoint, hook Hook) {
+	if h.hooks == nil {
+		h.hooks = make(map[HookPoint][]Hook)
+	}
+	h.hooks[point] = append(h.hooks[point], hook)
+}
+
+// runHooks runs the hooks for the context's point stopping at the first error
+func (h *Holochain) runHooks(ctx *HookContext) (err error) {
+	for _, hook := range h.hooks[ctx.Point] {
+		err = hook(ctx)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package holochain
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	var calls []HookContext
+	record := func(ctx *HookContext) error {
+		calls = append(calls, *ctx)
+		return nil
+	}
+	h.AddHook(HookBeforeCall, record)
+	h.AddHook(HookAfterCall, record)
+	h.AddHook(HookOnCommit, record)
+	h.AddHook(HookOnReceive, record)
+
+	Convey("hooks should run around calls and commits", t, func() {
+		calls = nil
+		result, err := h.Call("zySampleZome", "addEven", "42", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(len(calls), ShouldEqual, 3)
+
+		So(calls[0].Point, ShouldEqual, HookBeforeCall)
+		So(calls[0].Zome, ShouldEqual, "zySampleZome")
+		So(calls[0].Function, ShouldEqual, "addEven")
+		So(calls[0].Agent, ShouldEqual, h.nodeIDStr)
+		So(calls[0].Args, ShouldEqual, "42")
+
+		So(calls[1].Point, ShouldEqual, HookOnCommit)
+		So(calls[1].EntryType, ShouldEqual, "evenNumbers")
+
+		So(calls[2].Point, ShouldEqual, HookAfterCall)
+		So(calls[2].Result, ShouldEqual, result)
+		So(calls[2].Err, ShouldBeNil)
+		So(calls[2].Duration, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("hooks should run on receive", t, func() {
+		calls = nil
+		_, err := h.Send(ActionProtocol, h.node.HashAddr, APP_MESSAGE, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		So(err, ShouldBeNil)
+		So(len(calls), ShouldEqual, 1)
+		So(calls[0].Point, ShouldEqual, HookOnReceive)
+		So(calls[0].Zome, ShouldEqual, "jsSampleZome")
+		So(calls[0].Agent, ShouldEqual, h.nodeIDStr)
+	})
+
+	Convey("a before-call hook error should abort the call", t, func() {
+		h.AddHook(HookBeforeCall, func(ctx *HookContext) error {
+			return errors.New("not allowed")
+		})
+		calls = nil
+		_, err := h.Call("zySampleZome", "addEven", "44", ZOME_EXPOSURE)
+		So(err.Error(), ShouldEqual, "not allowed")
+		So(len(calls), ShouldEqual, 1)
+	})
+
+	Convey("an on-commit hook error should abort the commit", t, func() {
+		h.hooks[HookBeforeCall] = nil
+		h.AddHook(HookOnCommit, func(ctx *HookContext) error {
+			return errors.New("over quota")
+		})
+		l := h.chain.Length()
+		_, err := h.Call("zySampleZome", "addEven", "46", ZOME_EXPOSURE)
+		So(err, ShouldNotBeNil)
+		So(h.chain.Length(), ShouldEqual, l)
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// inspect implements read-only access to a holochain's data directories for external
+// tools, like block explorers, that read a node's data without running the node
+
+package holochain
+
+import (
+	"fmt"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/tidwall/buntdb"
+	"os"
+	"path/filepath"
+)
+
+// ChainReader reads a source chain
+type ChainReader interface {
+	Length() int
+	Top() *Header
+	Nth(n int) *Header
+	Get(h Hash) (*Header, error)
+	GetEntry(h Hash) (Entry, string, error)
+	GetEntryHeader(h Hash) (*Header, error)
+	Walk(fn WalkerFn) error
+	Close() error
+}
+
+// DHTReader reads what a node's DHT holds
+type DHTReader interface {
+	HeldHashes(entryType string, source string) ([]string, error)
+	Record(key Hash) (DHTRecord, error)
+	Links(base Hash, tag string, statusMask int) ([]TaggedHash, error)
+	Backlinks(target Hash, tag string, statusMask int) ([]TaggedHash, error)
+	Close() error
+}
+
+// dhtReader is a DHT loaded into memory from a node's store so that nothing done
+// with it can change the store
+type dhtReader struct {
+	dht *DHT
+}
+
+func (r *dhtReader) HeldHashes(entryType string, source string) ([]string, error) {
+	return r.dht.HeldHashes(entryType, source)
+}
+
+func (r *dhtReader) Record(key Hash) (DHTRecord, error) {
+	return r.dht.Record(key)
+}
+
+func (r *dhtReader) Links(base Hash, tag string, statusMask int) ([]TaggedHash, error) {
+	return r.dht.getLink(base, tag, statusMask)
+}
+
+func (r *dhtReader) Backlinks(target Hash, tag string, statusMask int) ([]TaggedHash, error) {
+	return r.dht.getBacklink(target, tag, statusMask)
+}
+
+func (r *dhtReader) Close() error {
+	return r.dht.db.Close()
+}
+
+// inspectHashSpec returns the hash type of the holochain at root from its DNA file
+func inspectHashSpec(root string) (spec HashSpec, err error) {
+	dir := filepath.Join(root, ChainDNADir)
+	var format string
+	if format, err = findDNA(dir); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.Open(filepath.Join(dir, DNAFileName+"."+format)); err != nil {
+		return
+	}
+	defer f.Close()
+	var dnaFile DNAFile
+	if err = Decode(f, format, &dnaFile); err != nil {
+		return
+	}
+	c, ok := mh.Names[dnaFile.DHTConfig.HashType]
+	if !ok {
+		err = fmt.Errorf("Unknown hash type: %s", dnaFile.DHTConfig.HashType)
+		return
+	}
+	spec = HashSpec{Code: c, Length: -1}
+	return
+}
+
+// OpenChainReader opens the source chain of the holochain at root for reading.  Its
+// entries are read from the chain file when they are needed, but the file is never
+// written to, so it may be read while the node is running.
+func OpenChainReader(root string) (r ChainReader, err error) {
+	var spec HashSpec
+	if spec, err = inspectHashSpec(root); err != nil {
+		return
+	}
+	c := NewChain(spec)
+	if err = c.load(filepath.Join(root, ChainDataDir, StoreFileName)); err != nil {
+		return
+	}
+	r = c
+	return
+}
+
+// OpenDHTReader opens the DHT store of the holochain at root for reading.  The store
+// is loaded into memory, so the reader is a snapshot of what the node held when it was
+// opened, and the store is never written to.
+func OpenDHTReader(root string) (r DHTReader, err error) {
+	var f *os.File
+	if f, err = os.Open(filepath.Join(root, ChainDataDir, DHTStoreFileName)); err != nil {
+		return
+	}
+	defer f.Close()
+	var db *buntdb.DB
+	if db, err = buntdb.Open(":memory:"); err != nil {
+		return
+	}
+	for _, i := range dhtIndexes {
+		db.CreateIndex(i.name, i.pattern, i.less)
+	}
+	if err = db.Load(f); err != nil {
+		db.Close()
+		return
+	}
+	r = &dhtReader{dht: &DHT{db: db}}
+	return
+}
@@ -0,0 +1,70 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	hash := commit(h, "oddNumbers", "7")
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	commit(h, "rating", fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, hash.String(), profileHash.String()))
+
+	size := func(file string) int64 {
+		info, err := os.Stat(filepath.Join(h.DBPath(), file))
+		if err != nil {
+			panic(err)
+		}
+		return info.Size()
+	}
+	chainSize := size(StoreFileName)
+	dhtSize := size(DHTStoreFileName)
+
+	Convey("a chain reader should read the node's chain", t, func() {
+		c, err := OpenChainReader(h.rootPath)
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(c.Length(), ShouldEqual, h.chain.Length())
+		So(c.Top().EntryLink.String(), ShouldEqual, h.chain.Top().EntryLink.String())
+		entry, entryType, err := c.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "oddNumbers")
+		So(entry.Content(), ShouldEqual, "7")
+	})
+
+	Convey("a DHT reader should read what the node's DHT holds", t, func() {
+		r, err := OpenDHTReader(h.rootPath)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		record, err := r.Record(hash)
+		So(err, ShouldBeNil)
+		So(record.Entry, ShouldEqual, "7")
+		hashes, err := r.HeldHashes("profile", "")
+		So(err, ShouldBeNil)
+		So(hashes, ShouldResemble, []string{profileHash.String()})
+		links, err := r.Links(hash, "4stars", StatusLive)
+		So(err, ShouldBeNil)
+		So(links[0].H, ShouldEqual, profileHash.String())
+		links, err = r.Backlinks(profileHash, "4stars", StatusLive)
+		So(err, ShouldBeNil)
+		So(links[0].H, ShouldEqual, hash.String())
+	})
+
+	Convey("the readers should not change the node's files", t, func() {
+		So(size(StoreFileName), ShouldEqual, chainSize)
+		So(size(DHTStoreFileName), ShouldEqual, dhtSize)
+	})
+
+	Convey("the readers should need a holochain", t, func() {
+		_, err := OpenChainReader(d)
+		So(err, ShouldNotBeNil)
+		_, err = OpenDHTReader(d)
+		So(err, ShouldNotBeNil)
+	})
+}
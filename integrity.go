@@ -0,0 +1,226 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// integrity implements the checks run when a holochain starts that its chain, DHT store
+// and keys are sound, and the repairs made when they aren't
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	"github.com/tidwall/buntdb"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrDNAHashMismatch = errors.New("DNA hash file doesn't match the chain's DNA")
+
+// IntegrityCheck is the result of checking one part of a holochain at startup
+type IntegrityCheck struct {
+	Name     string
+	OK       bool
+	Status   string
+	Repaired string `json:",omitempty"` // what was done to fix the problem found, if anything
+}
+
+// IntegrityReport is the result of all the startup integrity checks
+type IntegrityReport struct {
+	Time   time.Time
+	OK     bool
+	Checks []IntegrityCheck
+}
+
+// CheckIntegrity checks the chain's links and head, the DHT's indexes and change index,
+// the agent's keystore and the outbox, repairing what it can.  The report is logged to
+// the app log and kept for the admin api.
+func (h *Holochain) CheckIntegrity() (report IntegrityReport) {
+	report.Time = time.Now()
+	report.Checks = []IntegrityCheck{
+		h.checkChainHead(),
+		h.checkDHTIndexes(),
+		h.checkKeystore(),
+		h.checkOutbox(),
+	}
+	report.OK = true
+	for _, c := range report.Checks {
+		report.OK = report.OK && c.OK
+		switch {
+		case !c.OK:
+			h.config.Loggers.App.Logf("error: integrity check %s failed: %s", c.Name, c.Status)
+		case c.Repaired != "":
+			h.config.Loggers.App.Logf("warning: integrity check %s repaired: %s", c.Name, c.Repaired)
+		default:
+			h.config.Loggers.App.Logf("integrity check %s ok: %s", c.Name, c.Status)
+		}
+	}
+	h.integrityLk.Lock()
+	h.integrity = &report
+	h.integrityLk.Unlock()
+	return
+}
+
+// Integrity returns the report of the last integrity check or nil if none has been run
+func (h *Holochain) Integrity() *IntegrityReport {
+	h.integrityLk.Lock()
+	defer h.integrityLk.Unlock()
+	return h.integrity
+}
+
+func integrityCheck(name string, err error, status string) IntegrityCheck {
+	if err != nil {
+		return IntegrityCheck{Name: name, Status: err.Error()}
+	}
+	return IntegrityCheck{Name: name, OK: true, Status: status}
+}
+
+// checkChainHead checks that the headers link up to the head and that the DNA hash file
+// holds the chain's DNA hash, writing the file if it is missing.  A file holding another
+// hash is reported rather than changed.
+func (h *Holochain) checkChainHead() (c IntegrityCheck) {
+	l := h.chain.Length()
+	if l == 0 {
+		return integrityCheck("chain", nil, "not started")
+	}
+	if err := h.chain.Validate(true); err != nil {
+		return integrityCheck("chain", err, "")
+	}
+	top, _, err := h.chain.Top().Sum(h.hashSpec)
+	if err != nil {
+		return integrityCheck("chain", err, "")
+	}
+	if !top.Equal(&h.chain.Hashes[l-1]) {
+		return integrityCheck("chain", mkErr("head hash mismatch"), "")
+	}
+	c = integrityCheck("chain", nil, fmt.Sprintf("%d entries, head %v", l, top))
+	dnaHash := h.chain.Headers[0].EntryLink
+	if !fileExists(h.rootPath, DNAHashFileName) {
+		if err = writeFile([]byte(dnaHash.String()), h.rootPath, DNAHashFileName); err != nil {
+			return integrityCheck("chain", err, "")
+		}
+		c.Repaired = "rewrote " + DNAHashFileName
+		return
+	}
+	b, err := readFile(h.rootPath, DNAHashFileName)
+	if err != nil {
+		return integrityCheck("chain", err, "")
+	}
+	if string(b) != dnaHash.String() {
+		err = fmt.Errorf("%w: %s holds %s, the chain's DNA is %v", ErrDNAHashMismatch, DNAHashFileName, string(b), dnaHash)
+		return integrityCheck("chain", err, "")
+	}
+	return
+}
+
+// checkDHTIndexes recreates any missing database indexes and makes sure the change
+// index counter is past every change recorded
+func (h *Holochain) checkDHTIndexes() (c IntegrityCheck) {
+	if h.dht == nil {
+		return integrityCheck("dht", mkErr("DHT not set up"), "")
+	}
+	var repaired []string
+	have, err := h.dht.db.Indexes()
+	if err != nil {
+		return integrityCheck("dht", err, "")
+	}
+	for _, i := range dhtIndexes {
+		found := false
+		for _, name := range have {
+			found = found || name == i.name
+		}
+		if !found {
+			if err = h.dht.db.CreateIndex(i.name, i.pattern, i.less); err != nil {
+				return integrityCheck("dht", err, "")
+			}
+			repaired = append(repaired, "rebuilt index "+i.name)
+		}
+	}
+
+	var idx, max, count int
+	err = h.dht.update(func(tx *buntdb.Tx) error {
+		var e error
+		if idx, e = getIntVal("_idx", tx); e != nil {
+			return e
+		}
+		err := tx.AscendKeys("idx:*", func(key, value string) bool {
+			var n int
+			if n, e = strconv.Atoi(strings.TrimPrefix(key, "idx:")); e != nil {
+				return false
+			}
+			count++
+			if n > max {
+				max = n
+			}
+			return true
+		})
+		if err == nil {
+			err = e
+		}
+		if err != nil || max <= idx {
+			return err
+		}
+		repaired = append(repaired, fmt.Sprintf("change index was %d, set to %d", idx, max))
+		idx = max
+		_, _, err = tx.Set("_idx", strconv.Itoa(max), nil)
+		return err
+	})
+	if err != nil {
+		return integrityCheck("dht", err, "")
+	}
+	c = integrityCheck("dht", nil, fmt.Sprintf("%d changes indexed, change index %d", count, idx))
+	c.Repaired = strings.Join(repaired, "; ")
+	return
+}
+
+// checkKeystore checks that the agent's key file can be read and holds the key the
+// holochain is running with
+func (h *Holochain) checkKeystore() (c IntegrityCheck) {
+	if h.agent == nil || h.agent.PrivKey() == nil {
+		return integrityCheck("keystore", mkErr("no agent key loaded"), "")
+	}
+	// keys may be specific to the app or shared by the service's apps
+	path := h.rootPath
+	if !fileExists(path, PrivKeyFileName) {
+		path = filepath.Dir(h.rootPath)
+	}
+	b, err := readFile(path, PrivKeyFileName)
+	if err != nil {
+		return integrityCheck("keystore", err, "")
+	}
+	priv, err := ic.UnmarshalPrivateKey(b)
+	if err != nil {
+		return integrityCheck("keystore", err, "")
+	}
+	if !priv.GetPublic().Equals(h.agent.PubKey()) {
+		return integrityCheck("keystore", mkErr("key file doesn't hold the agent's key"), "")
+	}
+	return integrityCheck("keystore", nil, filepath.Join(path, PrivKeyFileName))
+}
+
+// checkOutbox retries any publications left in the outbox from before the restart
+func (h *Holochain) checkOutbox() (c IntegrityCheck) {
+	if h.outbox == nil {
+		return integrityCheck("outbox", nil, "no outbox")
+	}
+	pubs, err := h.outbox.Pending()
+	if err != nil {
+		return integrityCheck("outbox", err, "")
+	}
+	if len(pubs) == 0 {
+		return integrityCheck("outbox", nil, "empty")
+	}
+	if err = h.outbox.Drain(true); err != nil {
+		return integrityCheck("outbox", err, "")
+	}
+	left, err := h.outbox.Pending()
+	if err != nil {
+		return integrityCheck("outbox", err, "")
+	}
+	c = integrityCheck("outbox", nil, fmt.Sprintf("%d publications pending", len(left)))
+	c.Repaired = fmt.Sprintf("replayed %d publications", len(pubs)-len(left))
+	return
+}
@@ -0,0 +1,87 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	hash := commit(h, "oddNumbers", "7")
+
+	Convey("a sound holochain should pass all the checks", t, func() {
+		report := h.CheckIntegrity()
+		So(report.OK, ShouldBeTrue)
+		So(len(report.Checks), ShouldEqual, 4)
+		for _, c := range report.Checks {
+			So(c.Repaired, ShouldEqual, "")
+		}
+		So(h.Integrity(), ShouldResemble, &report)
+	})
+
+	Convey("a lost DNA hash file should be rewritten", t, func() {
+		os.Remove(filepath.Join(h.rootPath, DNAHashFileName))
+		c := h.checkChainHead()
+		So(c.OK, ShouldBeTrue)
+		So(c.Repaired, ShouldEqual, "rewrote "+DNAHashFileName)
+		So(fileExists(h.rootPath, DNAHashFileName), ShouldBeTrue)
+	})
+
+	Convey("a DNA hash file holding another hash should be reported and left alone", t, func() {
+		other := "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1"
+		So(ioutil.WriteFile(filepath.Join(h.rootPath, DNAHashFileName), []byte(other), 0600), ShouldBeNil)
+		c := h.checkChainHead()
+		So(c.OK, ShouldBeFalse)
+		So(c.Status, ShouldContainSubstring, ErrDNAHashMismatch.Error())
+		b, _ := readFile(h.rootPath, DNAHashFileName)
+		So(string(b), ShouldEqual, other)
+
+		os.Remove(filepath.Join(h.rootPath, DNAHashFileName))
+		c = h.checkChainHead()
+		So(c.OK, ShouldBeTrue)
+	})
+
+	Convey("a broken chain should fail", t, func() {
+		l := h.chain.Length()
+		saved := h.chain.Hashes[l-1]
+		h.chain.Hashes[l-1] = h.chain.Hashes[0]
+		c := h.checkChainHead()
+		h.chain.Hashes[l-1] = saved
+		So(c.OK, ShouldBeFalse)
+	})
+
+	Convey("missing DHT indexes and a stale change index should be repaired", t, func() {
+		So(h.dht.db.DropIndex("link"), ShouldBeNil)
+		idx, _ := h.dht.GetIdx()
+		h.dht.db.Update(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set("_idx", "0", nil)
+			return err
+		})
+		c := h.checkDHTIndexes()
+		So(c.OK, ShouldBeTrue)
+		So(c.Repaired, ShouldContainSubstring, "rebuilt index link")
+		So(c.Repaired, ShouldContainSubstring, "set to")
+		after, _ := h.dht.GetIdx()
+		So(after, ShouldEqual, idx)
+	})
+
+	Convey("the keystore should hold the agent's key", t, func() {
+		c := h.checkKeystore()
+		So(c.OK, ShouldBeTrue)
+	})
+
+	Convey("publications left in the outbox should be replayed", t, func() {
+		p := &Publication{Key: hash, T: PUT_REQUEST, Body: PutReq{H: hash}}
+		So(h.outbox.Queue(p), ShouldBeNil)
+		c := h.checkOutbox()
+		So(c.OK, ShouldBeTrue)
+		So(c.Repaired, ShouldStartWith, "replayed")
+		pubs, _ := h.outbox.Pending()
+		So(len(pubs), ShouldEqual, 0)
+	})
+}
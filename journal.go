@@ -0,0 +1,239 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// journal implements write-ahead journaling of commits so that a crash leaves an entry
+// either fully added to the chain and published, or not added at all
+
+package holochain
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// JournalFileName is the name of the commit journal in the chain's db directory
+const JournalFileName = "journal.json"
+
+// journal records a commit in progress.  Commits hold the holochain's commit lock
+// until their publications are queued so there is only ever one record.
+type journal struct {
+	Offset    int64  // the size of the chain file before the entry was written
+	Header    string // the hash of the entry's header
+	Committed bool   // set once the entry is synced to the chain file
+}
+
+func (h *Holochain) journalPath() string {
+	return filepath.Join(h.DBPath(), JournalFileName)
+}
+
+// writeJournal replaces the journal file with j, syncing it before it is renamed into
+// place so the journal is never seen partially written
+func (h *Holochain) writeJournal(j *journal) (err error) {
+	path := h.journalPath()
+	tmp := path + ".tmp"
+	var f *os.File
+	if f, err = os.Create(tmp); err != nil {
+		return
+	}
+	if err = json.NewEncoder(f).Encode(j); err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return
+	}
+	err = os.Rename(tmp, path)
+	return
+}
+
+func (h *Holochain) readJournal() (j *journal, err error) {
+	var f *os.File
+	if f, err = os.Open(h.journalPath()); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer f.Close()
+	j = &journal{}
+	err = json.NewDecoder(f).Decode(j)
+	return
+}
+
+// journalBegin records that the entry with the given header is about to be written
+func (h *Holochain) journalBegin(header Hash) (err error) {
+	c := h.chain
+	if c.s == nil {
+		return
+	}
+	// the file is opened for appending so its size is where the entry will be written
+	var fi os.FileInfo
+	if fi, err = c.s.Stat(); err != nil {
+		return
+	}
+	err = h.writeJournal(&journal{Offset: fi.Size(), Header: header.String()})
+	return
+}
+
+// journalCommitted syncs the chain file and records that the entry landed in it
+func (h *Holochain) journalCommitted(header Hash) (err error) {
+	c := h.chain
+	if c.s == nil {
+		return
+	}
+	if err = c.s.Sync(); err != nil {
+		return
+	}
+	err = h.writeJournal(&journal{Header: header.String(), Committed: true})
+	return
+}
+
+// journalDone clears the journal once a commit's publications have been sent
+func (h *Holochain) journalDone() {
+	if err := os.Remove(h.journalPath()); err != nil && !os.IsNotExist(err) {
+		Infof("unable to clear commit journal: %v", err)
+	}
+}
+
+// rollbackJournal truncates the chain file back to before an entry whose write may not
+// have completed.  It must be called before the chain is read.
+func (h *Holochain) rollbackJournal() (err error) {
+	var j *journal
+	if j, err = h.readJournal(); err != nil || j == nil || j.Committed {
+		return
+	}
+	Infof("rolling back interrupted commit of %s", j.Header)
+	if err = os.Truncate(filepath.Join(h.DBPath(), StoreFileName), j.Offset); err != nil {
+		return
+	}
+	err = os.Remove(h.journalPath())
+	return
+}
+
+// replayJournal publishes an entry that was committed before a crash but may not have
+// been sent to the DHT.  It is called once the holochain is activated.
+func (h *Holochain) replayJournal() (err error) {
+	var j *journal
+	if j, err = h.readJournal(); err != nil || j == nil {
+		return
+	}
+	if !j.Committed {
+		// rolled back when the chain was loaded
+		return
+	}
+	var hash Hash
+	if hash, err = NewHash(j.Header); err != nil {
+		return
+	}
+	var header *Header
+	if header, err = h.chain.Get(hash); err != nil {
+		return
+	}
+	var entry Entry
+	if entry, _, err = h.chain.GetEntry(header.EntryLink); err != nil {
+		return
+	}
+	var d *EntryDef
+	if _, d, err = h.GetEntryDef(header.Type); err != nil {
+		return
+	}
+	Infof("publishing interrupted commit of %s", j.Header)
+	err = h.publishCommit(d, header, entry)
+	return
+}
+
+// commitEntry commits an action's entry to the chain and publishes it, returning the
+// header only if the entry was committed.  The commit lock is held until the
+// publications are queued and the journal cleared, but not while they are first sent.
+func (h *Holochain) commitEntry(a CommittingAction, change *StatusChange, meta map[string]string) (header *Header, entryHash Hash, err error) {
+	var d *EntryDef
+	var hd *Header
+	var hash Hash
+	var pubs []*Publication
+	h.commitLk.Lock()
+	if err = h.checkFence(); err == nil {
+		if d, hd, hash, err = h.doCommit(a, change, meta); err == nil {
+			header, entryHash = hd, hash
+			pubs, err = h.queueCommit(d, header, a.Entry())
+		}
+	}
+	h.commitLk.Unlock()
+	if err != nil {
+		return
+	}
+	err = h.outbox.Send(pubs...)
+	return
+}
+
+// publishCommit queues the DHT messages for a committed entry and makes a first
+// attempt at sending them
+func (h *Holochain) publishCommit(d *EntryDef, header *Header, entry Entry) (err error) {
+	var pubs []*Publication
+	if pubs, err = h.queueCommit(d, header, entry); err != nil {
+		return
+	}
+	err = h.outbox.Send(pubs...)
+	return
+}
+
+// queueCommit queues the DHT messages for a committed entry in the outbox and clears
+// the journal, as once they are queued they will be sent even after a crash
+func (h *Holochain) queueCommit(d *EntryDef, header *Header, entry Entry) (pubs []*Publication, err error) {
+	entryHash := header.EntryLink
+	switch header.Change.Action {
+	case ModAction:
+		if d.isShared() {
+			pubs = append(pubs,
+				&Publication{Key: entryHash, T: PUT_REQUEST, Body: PutReq{H: entryHash}},
+				&Publication{Key: header.Change.Hash, T: MOD_REQUEST, Body: ModReq{H: header.Change.Hash, N: entryHash}})
+		}
+	case DelAction:
+		if d.isShared() {
+			pubs = append(pubs, &Publication{Key: header.Change.Hash, T: DEL_REQUEST, Body: DelReq{H: header.Change.Hash, By: entryHash}})
+		}
+	case StatusAction:
+		if d.isShared() {
+			pubs = append(pubs, &Publication{Key: header.Change.Hash, T: STATUS_REQUEST, Body: StatusReq{H: header.Change.Hash, By: entryHash}})
+		}
+	default:
+		if d.DataFormat == DataFormatLinks {
+			// if this is a Link entry we have to send the DHT Link message
+			var le LinksEntry
+			var c string
+			if c, err = entryContentString(entry.Content()); err != nil {
+				return
+			}
+			if err = json.Unmarshal([]byte(c), &le); err != nil {
+				return
+			}
+			bases := make(map[string]bool)
+			targets := make(map[string]bool)
+			for _, l := range le.Links {
+				if !bases[l.Base] {
+					b, _ := NewHash(l.Base)
+					pubs = append(pubs, &Publication{Key: b, T: LINK_REQUEST, Body: LinkReq{Base: b, Links: entryHash}})
+					bases[l.Base] = true
+				}
+				// the target's node indexes the backlinks
+				if !targets[l.Link] {
+					if t, e := NewHash(l.Link); e == nil {
+						pubs = append(pubs, &Publication{Key: t, T: LINK_REQUEST, Body: LinkReq{Base: t, Links: entryHash, Reverse: true}})
+					}
+					targets[l.Link] = true
+				}
+			}
+		} else if d.isShared() {
+			pubs = append(pubs, &Publication{Key: entryHash, T: PUT_REQUEST, Body: PutReq{H: entryHash}})
+		}
+	}
+	if err = h.outbox.Queue(pubs...); err != nil {
+		return
+	}
+	h.journalDone()
+	return
+}
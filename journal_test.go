@@ -0,0 +1,76 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	chainPath := filepath.Join(h.DBPath(), StoreFileName)
+
+	Convey("commits should clear the journal once published", t, func() {
+		commit(h, "oddNumbers", "7")
+		So(fileExists(h.journalPath()), ShouldBeFalse)
+	})
+
+	Convey("concurrent commits should each be journaled and cleared", t, func() {
+		l := h.chain.Length()
+		var wg sync.WaitGroup
+		for i := 1; i <= 8; i += 2 {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				NewCommitAction("oddNumbers", &GobEntry{C: fmt.Sprintf("%d", n)}).Do(h)
+			}(i)
+		}
+		wg.Wait()
+		So(h.chain.Length(), ShouldEqual, l+4)
+		So(fileExists(h.journalPath()), ShouldBeFalse)
+
+		c, err := NewChainFromFile(h.hashSpec, chainPath)
+		So(err, ShouldBeNil)
+		So(c.Length(), ShouldEqual, h.chain.Length())
+		c.Close()
+	})
+
+	Convey("interrupted writes should be rolled back", t, func() {
+		fi, err := os.Stat(chainPath)
+		So(err, ShouldBeNil)
+		top, _ := h.Top()
+		So(h.journalBegin(top), ShouldBeNil)
+
+		// a partial write of the next entry
+		f, err := os.OpenFile(chainPath, os.O_APPEND|os.O_WRONLY, 0600)
+		So(err, ShouldBeNil)
+		f.Write([]byte{1, 2, 3})
+		f.Close()
+
+		So(h.rollbackJournal(), ShouldBeNil)
+		fi2, err := os.Stat(chainPath)
+		So(err, ShouldBeNil)
+		So(fi2.Size(), ShouldEqual, fi.Size())
+		So(fileExists(h.journalPath()), ShouldBeFalse)
+
+		c, err := NewChainFromFile(h.hashSpec, chainPath)
+		So(err, ShouldBeNil)
+		So(c.Length(), ShouldEqual, h.chain.Length())
+		c.Close()
+	})
+
+	Convey("committed entries should be published on replay", t, func() {
+		commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+		top, _ := h.Top()
+		So(h.writeJournal(&journal{Header: top.String(), Committed: true}), ShouldBeNil)
+		So(h.rollbackJournal(), ShouldBeNil)
+		So(fileExists(h.journalPath()), ShouldBeTrue)
+
+		So(h.replayJournal(), ShouldBeNil)
+		So(fileExists(h.journalPath()), ShouldBeFalse)
+	})
+}
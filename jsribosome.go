@@ -6,12 +6,15 @@
 package holochain
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	peer "github.com/libp2p/go-libp2p-peer"
 	"github.com/robertkrimen/otto"
+	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,9 +24,75 @@ const (
 
 // JSRibosome holds data needed for the Javascript VM
 type JSRibosome struct {
+	h          *Holochain
 	zome       *Zome
 	vm         *otto.Otto
 	lastResult *otto.Value
+	stream     io.Writer
+	validators map[string]otto.Value
+	// validating is set while a validation function runs, for the header of the entry
+	// it validates, if any, to be what HC.time() returns
+	validating       bool
+	validationHeader *Header
+	strictToggle     otto.Value // switches strict validation mode, see jsStrictToggle
+}
+
+// SetStream sets where the stream built-in writes chunks for the current call
+func (jsr *JSRibosome) SetStream(w io.Writer) {
+	jsr.stream = w
+}
+
+var errJSInterrupted = errors.New("JS call interrupted")
+
+// Interrupt aborts the currently running call
+func (jsr *JSRibosome) Interrupt() {
+	select {
+	case jsr.vm.Interrupt <- func() { panic(errJSInterrupted) }:
+	default:
+	}
+}
+
+// limit starts aborting the running code once the zome's ExecutionTimeout passes,
+// returning the function that stops the timer when the code is done
+func (jsr *JSRibosome) limit() (stop func()) {
+	d, _ := jsr.zome.executionTimeout()
+	if d <= 0 {
+		return func() {}
+	}
+	var lk sync.Mutex
+	done := false
+	t := time.AfterFunc(d, func() {
+		lk.Lock()
+		defer lk.Unlock()
+		if done {
+			return
+		}
+		select {
+		case jsr.vm.Interrupt <- func() { panic(ErrRibosomeTimeout) }:
+		default:
+		}
+	})
+	return func() {
+		t.Stop()
+		lk.Lock()
+		done = true
+		lk.Unlock()
+		// the timer may have fired after the code finished
+		select {
+		case <-jsr.vm.Interrupt:
+		default:
+		}
+	}
+}
+
+// recoverInterrupt turns the panic of aborted code into the error it was aborted with
+func recoverInterrupt(err *error) {
+	if caught := recover(); caught != nil {
+		if caught != errJSInterrupted && caught != ErrRibosomeTimeout {
+			panic(caught)
+		}
+		*err = caught.(error)
+	}
 }
 
 // Type returns the string value under which this ribosome is registered
@@ -32,9 +101,11 @@ func (jsr *JSRibosome) Type() string { return JSRibosomeType }
 // ChainGenesis runs the application genesis function
 // this function gets called after the genesis entries are added to the chain
 func (jsr *JSRibosome) ChainGenesis() (err error) {
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
 	v, err := jsr.vm.Run(`genesis()`)
 	if err != nil {
-		err = fmt.Errorf("Error executing genesis: %v", err)
+		err = fmt.Errorf("Error executing genesis: %w", err)
 		return
 	}
 	if v.IsBoolean() {
@@ -55,31 +126,102 @@ func (jsr *JSRibosome) ChainGenesis() (err error) {
 
 // Receive calls the app receive function for node-to-node messages
 func (jsr *JSRibosome) Receive(from string, msg string) (response string, err error) {
-	var code string
 	fnName := "receive"
-
-	code = fmt.Sprintf(`JSON.stringify(%s("%s",JSON.parse("%s")))`, fnName, from, jsSanitizeString(msg))
-	Debug(code)
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
+	m, err := jsr.jsonToValue(msg)
+	if err != nil {
+		return
+	}
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.vm.Call(fnName, nil, from, m)
+	if err == nil {
+		v, err = jsr.vm.Call("JSON.stringify", nil, v)
+	}
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
 		return
 	}
 	response, err = v.ToString()
 	return
 }
 
+// ValidatePublish calls the app validatePublish function for a message published on a channel
+func (jsr *JSRibosome) ValidatePublish(channel string, msg string) (err error) {
+	fnName := "validatePublish"
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
+	var v otto.Value
+	v, err = jsr.vm.Call(fnName, nil, channel, msg)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	if !v.IsBoolean() {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, v)
+		return
+	}
+	var b bool
+	b, err = v.ToBoolean()
+	if err == nil && !b {
+		err = ValidationFailedErr
+	}
+	return
+}
+
+// BridgeGenesis calls the app bridgeGenesis function, if it has one, for a bridge being
+// set up to or from the app with the DNA hash dnaHash
+func (jsr *JSRibosome) BridgeGenesis(side int, dnaHash string) (err error) {
+	fnName := "bridgeGenesis"
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
+	if f, e := jsr.vm.Get(fnName); e != nil || !f.IsFunction() {
+		return
+	}
+	var v otto.Value
+	v, err = jsr.vm.Call(fnName, nil, side, dnaHash)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	if !v.IsBoolean() {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, v)
+		return
+	}
+	var b bool
+	b, err = v.ToBoolean()
+	if err == nil && !b {
+		err = fmt.Errorf("%s failed", fnName)
+	}
+	return
+}
+
+// ReceivePublish calls the app handler function subscribed to a channel
+func (jsr *JSRibosome) ReceivePublish(handler string, channel string, from string, msg string) (err error) {
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
+	_, err = jsr.vm.Call(handler, nil, channel, from, msg)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", handler, err)
+	}
+	return
+}
+
 // ValidatePackagingRequest calls the app for a validation packaging request for an action
 func (jsr *JSRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
-	var code string
 	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
-	code = fmt.Sprintf(`%s("%s")`, fnName, def.Name)
-	Debug(code)
+	Debugf("%s(%q)", fnName, def.Name)
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
+	done, err := jsr.validation(action)
+	if err != nil {
+		return
+	}
+	defer validated(done, &err)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.vm.Call(fnName, nil, def.Name)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
 		return
 	}
 	if v.IsObject() {
@@ -97,168 +239,325 @@ func (jsr *JSRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 	return
 }
 
-func prepareJSEntryArgs(def *EntryDef, entry Entry, header *Header) (args string, err error) {
-	entryStr := entry.Content().(string)
-	switch def.DataFormat {
-	case DataFormatRawJS:
-		args = entryStr
-	case DataFormatString:
-		args = "\"" + jsSanitizeString(entryStr) + "\""
-	case DataFormatLinks:
-		fallthrough
-	case DataFormatJSON:
-		args = fmt.Sprintf(`JSON.parse("%s")`, jsSanitizeString(entryStr))
+// jsValidateActions are the actions whose validation wrappers are compiled when a
+// ribosome is built
+var jsValidateActions = []string{"commit", "put", "mod", "del", "link", "setStatus"}
+
+// jsValidatorScripts caches the compiled validation wrappers by action and entry type.
+// A compiled script can be run in any VM so each wrapper is only ever parsed once.
+var jsValidatorScripts = struct {
+	lk      sync.Mutex
+	scripts map[string]*otto.Script
+}{scripts: make(map[string]*otto.Script)}
+
+// jsValidatorCode returns the source of a function that calls the app's validation
+// function for the action on entries of type def.  It takes the values returned by
+// prepareJSValidateArgs followed by the package and the sources.
+func jsValidatorCode(action string, def *EntryDef) (code string, err error) {
+	var entry string
+	if action != "del" && action != "link" && action != "setStatus" {
+		switch def.DataFormat {
+		case DataFormatRawJS:
+			entry = `eval("("+arg0+")")`
+		case DataFormatString, DataFormatLinks, DataFormatJSON, DataFormatBinary, DataFormatCBOR:
+			entry = "arg0"
+		default:
+			err = errors.New("data format not implemented: " + def.DataFormat)
+			return
+		}
+	}
+	var args string
+	switch action {
+	case "commit", "put":
+		args = entry + ",arg1"
+	case "mod":
+		args = entry + ",arg1,arg2"
+	case "del":
+		args = "arg0"
+	case "link", "setStatus":
+		args = "arg0,arg1"
 	default:
-		err = errors.New("data format not implemented: " + def.DataFormat)
+		err = fmt.Errorf("can't build validator for %s", action)
 		return
 	}
-	var hdr string
-	if header != nil {
-		hdr = fmt.Sprintf(
-			`{"EntryLink":"%s","Type":"%s","Time":"%s"}`,
-			header.EntryLink.String(),
-			header.Type,
-			header.Time.UTC().Format(time.RFC3339),
-		)
-	} else {
-		hdr = `{"EntryLink":"","Type":"","Time":""}`
-	}
-	args += "," + hdr
+	code = fmt.Sprintf(`(function(arg0,arg1,arg2,pkg,sources){return validate%s(%s,%s,pkg,sources)})`, strings.Title(action), jsString(def.Name), args)
 	return
 }
 
-func prepareJSValidateArgs(action Action, def *EntryDef) (args string, err error) {
-	switch t := action.(type) {
-	case *ActionPut:
-		args, err = prepareJSEntryArgs(def, t.entry, t.header)
-	case *ActionCommit:
-		args, err = prepareJSEntryArgs(def, t.entry, t.header)
-	case *ActionMod:
-		args, err = prepareJSEntryArgs(def, t.entry, t.header)
+// validator returns the validation wrapper for the action on entries of type def,
+// compiling it if this is the first time it's been asked for
+func (jsr *JSRibosome) validator(action string, def *EntryDef) (fn otto.Value, err error) {
+	key := action + ":" + def.DataFormat + ":" + def.Name
+	fn, ok := jsr.validators[key]
+	if ok {
+		return
+	}
+
+	jsValidatorScripts.lk.Lock()
+	script, ok := jsValidatorScripts.scripts[key]
+	if !ok {
+		var code string
+		code, err = jsValidatorCode(action, def)
 		if err == nil {
-			args += fmt.Sprintf(`,"%s"`, t.replaces.String())
+			script, err = jsr.vm.Compile("", code)
 		}
-	case *ActionDel:
-		args = fmt.Sprintf(`"%s"`, t.entry.Hash.String())
-	case *ActionLink:
-		var j []byte
-		j, err = json.Marshal(t.links)
 		if err == nil {
-			args = fmt.Sprintf(`"%s",JSON.parse("%s")`, t.validationBase.String(), jsSanitizeString(string(j)))
+			jsValidatorScripts.scripts[key] = script
 		}
-	default:
-		err = fmt.Errorf("can't prepare args for %T: ", t)
+	}
+	jsValidatorScripts.lk.Unlock()
+	if err != nil {
 		return
 	}
-	return
-}
 
-func buildJSValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (code string, err error) {
-	fnName := "validate" + strings.Title(action.Name())
-	var args string
-	args, err = prepareJSValidateArgs(action, def)
+	fn, err = jsr.vm.Run(script)
 	if err != nil {
 		return
 	}
-	srcs := mkJSSources(sources)
+	jsr.validators[key] = fn
+	return
+}
 
-	var pkgObj string
-	if pkg == nil || pkg.Chain == nil {
-		pkgObj = "{}"
-	} else {
-		var j []byte
-		j, err = json.Marshal(pkg.Chain)
-		if err != nil {
-			return
-		}
-		pkgObj = fmt.Sprintf(`{"Chain":%s}`, j)
-	}
-	code = fmt.Sprintf(`%s("%s",%s,%s,%s)`, fnName, def.Name, args, pkgObj, srcs)
+// jsHeader holds the header fields passed to validation functions
+type jsHeader struct {
+	EntryLink string
+	Type      string
+	Time      string
+	Meta      map[string]string `json:",omitempty"`
+	// Timestamps are the header's verified timestamps from time authorities
+	Timestamps []headerTimestamp `json:",omitempty"`
+}
 
+// jsonToValue parses j into a native javascript value without evaluating it as code
+func (jsr *JSRibosome) jsonToValue(j string) (v otto.Value, err error) {
+	v, err = jsr.vm.Call("JSON.parse", nil, j)
 	return
 }
 
-// ValidateAction builds the correct validation function based on the action an calls it
-func (jsr *JSRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
-	var code string
-	code, err = buildJSValidateAction(action, def, pkg, sources)
+// toValue converts x into a native javascript value by way of its JSON
+func (jsr *JSRibosome) toValue(x interface{}) (v otto.Value, err error) {
+	j, err := json.Marshal(x)
 	if err != nil {
 		return
 	}
-	Debug(code)
-	err = jsr.runValidate(action.Name(), code)
-	return
-}
-
-func mkJSSources(sources []string) (srcs string) {
-	srcs = `["` + strings.Join(sources, `","`) + `"]`
+	v, err = jsr.jsonToValue(string(j))
 	return
 }
 
-func (jsr *JSRibosome) prepareJSValidateEntryArgs(def *EntryDef, entry Entry, sources []string) (e string, srcs string, err error) {
-	c := entry.Content().(string)
+// entryValue converts entry content into the value passed to the app for the
+// entry's data format; raw javascript is left for the validation wrapper to evaluate
+func (jsr *JSRibosome) entryValue(def *EntryDef, entry Entry, header *Header) (e otto.Value, hdr otto.Value, err error) {
+	c, err := entryContentString(entry.Content())
+	if err != nil {
+		return
+	}
 	switch def.DataFormat {
-	case DataFormatRawJS:
-		e = c
-	case DataFormatString:
-		e = "\"" + jsSanitizeString(c) + "\""
-	case DataFormatLinks:
+	case DataFormatRawJS, DataFormatString, DataFormatBinary:
+		e, err = jsr.vm.ToValue(c)
+	case DataFormatLinks, DataFormatCBOR:
 		fallthrough
 	case DataFormatJSON:
-		e = fmt.Sprintf(`JSON.parse("%s")`, jsSanitizeString(c))
+		e, err = jsr.jsonToValue(c)
 	default:
 		err = errors.New("data format not implemented: " + def.DataFormat)
+	}
+	if err != nil {
 		return
 	}
-	srcs = mkJSSources(sources)
+	var h jsHeader
+	if header != nil {
+		h = toJSHeader(jsr.h, header)
+	}
+	hdr, err = jsr.toValue(h)
 	return
 }
 
-func (jsr *JSRibosome) runValidate(fnName string, code string) (err error) {
-	var v otto.Value
-	v, err = jsr.vm.Run(code)
+// toJSHeader returns the fields of a header passed to javascript
+func toJSHeader(h *Holochain, header *Header) jsHeader {
+	return jsHeader{
+		EntryLink:  header.EntryLink.String(),
+		Type:       header.Type,
+		Time:       header.Time.UTC().Format(time.RFC3339),
+		Meta:       header.Meta,
+		Timestamps: headerTimestamps(h, header),
+	}
+}
+
+// prepareJSValidateArgs returns the action specific arguments for its validation wrapper
+func (jsr *JSRibosome) prepareJSValidateArgs(action Action, def *EntryDef) (args []interface{}, err error) {
+	args = []interface{}{otto.UndefinedValue(), otto.UndefinedValue(), otto.UndefinedValue()}
+	var e, hdr otto.Value
+	switch t := action.(type) {
+	case *ActionPut:
+		e, hdr, err = jsr.entryValue(def, t.entry, t.header)
+		args[0], args[1] = e, hdr
+	case *ActionCommit:
+		e, hdr, err = jsr.entryValue(def, t.entry, t.header)
+		args[0], args[1] = e, hdr
+	case *ActionMod:
+		e, hdr, err = jsr.entryValue(def, t.entry, t.header)
+		args[0], args[1], args[2] = e, hdr, t.replaces.String()
+	case *ActionDel:
+		args[0] = t.entry.Hash.String()
+	case *ActionLink:
+		var links otto.Value
+		links, err = jsr.toValue(t.links)
+		args[0], args[1] = t.validationBase.String(), links
+	case *ActionSetStatus:
+		args[0], args[1] = t.entry.Hash.String(), t.entry.Status
+	default:
+		err = fmt.Errorf("can't prepare args for %T: ", t)
+		return
+	}
+	return
+}
+
+// packageValue converts a validation package into a native javascript object.  The
+// chain is converted a header or entry at a time so that a large chain is never also
+// held as a single JSON document.
+func (jsr *JSRibosome) packageValue(pkg *ValidationPackage) (v otto.Value, err error) {
+	obj, err := jsr.vm.Object(`({})`)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
 		return
 	}
-	if v.IsBoolean() {
-		if v.IsBoolean() {
-			var b bool
-			b, err = v.ToBoolean()
+	v = obj.Value()
+	if pkg == nil {
+		return
+	}
+	if pkg.Rate != nil {
+		var rate otto.Value
+		if rate, err = jsr.toValue(pkg.Rate); err != nil {
+			return
+		}
+		if err = obj.Set("Rate", rate); err != nil {
+			return
+		}
+	}
+	if pkg.Chain == nil {
+		return
+	}
+	c := pkg.Chain
+	chain, err := jsr.vm.Object(`({})`)
+	if err != nil {
+		return
+	}
+	arrays := []struct {
+		name string
+		n    int
+		item func(i int) interface{}
+	}{
+		{"Hashes", len(c.Hashes), func(i int) interface{} { return c.Hashes[i] }},
+		{"Headers", len(c.Headers), func(i int) interface{} { return c.Headers[i] }},
+		{"Entries", len(c.Entries), func(i int) interface{} { return c.Entries[i] }},
+	}
+	for _, a := range arrays {
+		var arr *otto.Object
+		arr, err = jsr.vm.Object(`[]`)
+		if err != nil {
+			return
+		}
+		for i := 0; i < a.n; i++ {
+			var item otto.Value
+			item, err = jsr.toValue(a.item(i))
 			if err != nil {
 				return
 			}
-			if !b {
-				err = ValidationFailedErr
+			_, err = arr.Call("push", item)
+			if err != nil {
+				return
 			}
 		}
-	} else {
-		err = fmt.Errorf("%s should return boolean, got: %v", fnName, v)
+		err = chain.Set(a.name, arr.Value())
+		if err != nil {
+			return
+		}
 	}
+	maps := []struct {
+		name string
+		m    map[string]int
+	}{{"TypeTops", c.TypeTops}, {"Hmap", c.Hmap}, {"Emap", c.Emap}}
+	for _, m := range maps {
+		var mv otto.Value
+		mv, err = jsr.toValue(m.m)
+		if err != nil {
+			return
+		}
+		err = chain.Set(m.name, mv)
+		if err != nil {
+			return
+		}
+	}
+	err = obj.Set("Chain", chain.Value())
 	return
 }
 
-func (jsr *JSRibosome) validateEntry(fnName string, def *EntryDef, entry Entry, header *Header, sources []string) (err error) {
-
-	e, srcs, err := jsr.prepareJSValidateEntryArgs(def, entry, sources)
+// ValidateAction calls the app's validation function for the action through its
+// precompiled wrapper
+func (jsr *JSRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	fnName := "validate" + strings.Title(action.Name())
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
+	fn, err := jsr.validator(action.Name(), def)
+	if err != nil {
+		return
+	}
+	args, err := jsr.prepareJSValidateArgs(action, def)
 	if err != nil {
 		return
 	}
 
-	hdr := fmt.Sprintf(
-		`{"EntryLink":"%s","Type":"%s","Time":"%s"}`,
-		header.EntryLink.String(),
-		header.Type,
-		header.Time.UTC().Format(time.RFC3339),
-	)
+	if sources == nil {
+		sources = []string{}
+	}
+	var pkgObj, srcs otto.Value
+	pkgObj, err = jsr.packageValue(pkg)
+	if err != nil {
+		return
+	}
+	if jsr.h != nil {
+		var validator otto.Value
+		if validator, err = jsr.toValue(jsr.h.validatorProps()); err != nil {
+			return
+		}
+		if err = pkgObj.Object().Set("Validator", validator); err != nil {
+			return
+		}
+	}
+	srcs, err = jsr.toValue(sources)
+	if err != nil {
+		return
+	}
+	args = append(args, pkgObj, srcs)
+	Debugf("%s: %v", fnName, args)
 
-	code := fmt.Sprintf(`%s("%s",%s,%s,%s)`, fnName, def.Name, e, hdr, srcs)
-	Debugf("%s: %s", fnName, code)
-	err = jsr.runValidate(fnName, code)
-	if err != nil && err == ValidationFailedErr {
-		err = fmt.Errorf("Invalid entry: %v", entry.Content())
+	done, err := jsr.validation(action)
+	if err != nil {
+		return
 	}
+	defer validated(done, &err)
+	v, err := fn.Call(otto.NullValue(), args...)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	err = validateResult(fnName, v)
+	return
+}
 
+// validateResult converts the value returned by a validation function into an error
+func validateResult(fnName string, v otto.Value) (err error) {
+	if v.IsBoolean() {
+		var b bool
+		b, err = v.ToBoolean()
+		if err != nil {
+			return
+		}
+		if !b {
+			err = ValidationFailedErr
+		}
+	} else {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, v)
+	}
 	return
 }
 
@@ -268,53 +567,109 @@ const (
 		`,Rejected:` + StatusRejectedVal +
 		`,Deleted:` + StatusDeletedVal +
 		`,Modified:` + StatusModifiedVal +
+		`,Pending:` + StatusPendingVal +
+		`,Expired:` + StatusExpiredVal +
 		`,Any:` + StatusAnyVal +
 		"}" +
 		`,GetMask:{Default:` + GetMaskDefaultStr +
 		`,Entry:` + GetMaskEntryStr +
 		`,EntryType:` + GetMaskEntryTypeStr +
 		`,Sources:` + GetMaskSourcesStr +
+		`,History:` + GetMaskHistoryStr +
+		`,Meta:` + GetMaskMetaStr +
+		`,Header:` + GetMaskHeaderStr +
 		`,All:` + GetMaskAllStr +
 		"}" +
 		`,LinkAction:{Add:"` + AddAction + `",Del:"` + DelAction + `"}` +
 		`,PkgReq:{Chain:"` + PkgReqChain + `"` +
+		`,Rate:"` + PkgReqRate + `"` +
 		`,ChainOpt:{None:` + PkgReqChainOptNoneStr +
 		`,Headers:` + PkgReqChainOptHeadersStr +
 		`,Entries:` + PkgReqChainOptEntriesStr +
 		`,Full:` + PkgReqChainOptFullStr +
 		"}" +
 		"}" +
+		`,ErrorCodes:{Unknown:"` + ErrorCodeUnknown + `"` +
+		`,HashNotFound:"` + ErrorCodeHashNotFound + `"` +
+		`,HashDeleted:"` + ErrorCodeHashDeleted + `"` +
+		`,HashModified:"` + ErrorCodeHashModified + `"` +
+		`,HashRejected:"` + ErrorCodeHashRejected + `"` +
+		`,HashExpired:"` + ErrorCodeHashExpired + `"` +
+		`,HashPending:"` + ErrorCodeHashPending + `"` +
+		`,HashCustomStatus:"` + ErrorCodeHashCustomStatus + `"` +
+		`,EntryTypeMismatch:"` + ErrorCodeEntryTypeMismatch + `"` +
+		`,CorruptRecord:"` + ErrorCodeCorruptRecord + `"` +
+		`,LinkNotFound:"` + ErrorCodeLinkNotFound + `"` +
+		`,ValidationFailed:"` + ErrorCodeValidationFailed + `"` +
+		`,Unauthorized:"` + ErrorCodeUnauthorized + `"` +
+		`,Timeout:"` + ErrorCodeTimeout + `"` +
+		`,InvalidArguments:"` + ErrorCodeInvalidArgs + `"` +
+		`,ReservedEntryType:"` + ErrorCodeReservedEntryType + `"` +
+		`,NetworkFork:"` + ErrorCodeNetworkFork + `"` +
+		`,RejectedByPolicy:"` + ErrorCodeRejectedByPolicy + `"` +
+		"}" +
 		`};`
 )
 
-// jsSanatizeString makes sure all quotes are quoted and returns are removed
-func jsSanitizeString(s string) string {
-	s0 := strings.Replace(s, "\n", "", -1)
-	s1 := strings.Replace(s0, "\r", "", -1)
-	s2 := strings.Replace(s1, "\"", "\\\"", -1)
-	return s2
+// jsString returns s as a double quoted javascript string literal, escaping quotes,
+// backslashes, control characters and the line separators U+2028 and U+2029, which
+// javascript (unlike JSON) doesn't allow unescaped in strings
+func jsString(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\u2028', '\u2029':
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
 }
 
 // Call calls the zygo function that was registered with expose
 func (jsr *JSRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
-	var code string
+	var args []interface{}
 	switch fn.CallingType {
 	case STRING_CALLING:
-		code = fmt.Sprintf(`%s("%s");`, fn.Name, jsSanitizeString(params.(string)))
+		args = append(args, params.(string))
 	case JSON_CALLING:
-		if params.(string) == "" {
-			code = fmt.Sprintf(`JSON.stringify(%s());`, fn.Name)
-		} else {
-			p := jsSanitizeString(params.(string))
-			code = fmt.Sprintf(`JSON.stringify(%s(JSON.parse("%s")));`, fn.Name, p)
+		if params.(string) != "" {
+			var p otto.Value
+			p, err = jsr.jsonToValue(params.(string))
+			if err != nil {
+				return
+			}
+			args = append(args, p)
 		}
 	default:
 		err = errors.New("params type not implemented")
 		return
 	}
-	Debugf("JS Call: %s", code)
+	Debugf("JS Call: %s(%v)", fn.Name, params)
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.vm.Call(fn.Name, nil, args...)
+	if err == nil && fn.CallingType == JSON_CALLING {
+		v, err = jsr.vm.Call("JSON.stringify", nil, v)
+	}
 	if err == nil {
 		if v.IsObject() && v.Class() == "Error" {
 			Debugf("JS Error:\n%v", v)
@@ -330,280 +685,693 @@ func (jsr *JSRibosome) Call(fn *FunctionDef, params interface{}) (result interfa
 	return
 }
 
-// jsProcessArgs processes oArgs according to the args spec filling args[].value with the converted value
-func jsProcessArgs(jsr *JSRibosome, args []Arg, oArgs []otto.Value) (err error) {
-	err = checkArgCount(args, len(oArgs))
+// jsArg adapts an otto value for processArgs
+type jsArg struct {
+	jsr *JSRibosome
+	v   otto.Value
+}
+
+func (a jsArg) kind() argKind {
+	switch {
+	case a.v.IsString():
+		return argStr
+	case a.v.IsNumber():
+		return argNumber
+	case a.v.IsBoolean():
+		return argBool
+	case a.v.IsObject():
+		return argObject
+	}
+	return argOther
+}
+
+func (a jsArg) str() string {
+	s, _ := a.v.ToString()
+	return s
+}
+
+func (a jsArg) integer() (int64, error) { return a.v.ToInteger() }
+
+func (a jsArg) boolean() (bool, error) { return a.v.ToBoolean() }
+
+func (a jsArg) json() (s string, err error) {
+	v, err := a.jsr.vm.Call("JSON.stringify", nil, a.v)
 	if err != nil {
-		return err
+		return
 	}
+	s, err = v.ToString()
+	return
+}
 
-	// check arg types
-	for i, arg := range oArgs {
-		switch args[i].Type {
-		case StringArg:
-			if arg.IsString() {
-				args[i].value, _ = arg.ToString()
-			} else {
-				return argErr("string", i+1, args[i])
-			}
-		case HashArg:
-			if arg.IsString() {
-				str, _ := arg.ToString()
-				var hash Hash
-				hash, err = NewHash(str)
-				if err != nil {
-					return
-				}
-				args[i].value = hash
-			} else {
-				return argErr("string", i+1, args[i])
-			}
-		case IntArg:
-			if arg.IsNumber() {
-				integer, err := arg.ToInteger()
-				if err != nil {
-					return err
-				}
-				args[i].value = integer
-			} else {
-				return argErr("int", i+1, args[i])
-			}
-		case BoolArg:
-			if arg.IsBoolean() {
-				boolean, err := arg.ToBoolean()
-				if err != nil {
-					return err
-				}
-				args[i].value = boolean
-			} else {
-				return argErr("boolean", i+1, args[i])
-			}
-		case ArgsArg:
-			if arg.IsString() {
-				str, err := arg.ToString()
-				if err != nil {
-					return err
-				}
-				args[i].value = str
-			} else if arg.IsObject() {
-				v, err := jsr.vm.Call("JSON.stringify", nil, arg)
-				if err != nil {
-					return err
-				}
-				entry, err := v.ToString()
-				if err != nil {
-					return err
-				}
-				args[i].value = entry
+func (a jsArg) export() (interface{}, error) { return a.v.Export() }
 
-			} else {
-				return argErr("string or object", i+1, args[i])
-			}
-		case EntryArg:
-			if arg.IsString() {
-				str, err := arg.ToString()
-				if err != nil {
-					return err
-				}
-				args[i].value = str
-			} else if arg.IsObject() {
-				v, err := jsr.vm.Call("JSON.stringify", nil, arg)
-				if err != nil {
-					return err
-				}
-				entry, err := v.ToString()
-				if err != nil {
-					return err
-				}
-				args[i].value = entry
+func (a jsArg) toStr() (string, bool) { return a.str(), true }
 
-			} else {
-				return argErr("string or object", i+1, args[i])
-			}
-		case MapArg:
-			if arg.IsObject() {
-				m, err := arg.Export()
-				if err != nil {
-					return err
-				}
-				args[i].value = m
-			} else {
-				return argErr("object", i+1, args[i])
-			}
-		case ToStrArg:
-			var str string
-			if arg.IsObject() {
-				v, err := jsr.vm.Call("JSON.stringify", nil, arg)
-				if err != nil {
-					return err
-				}
-				str, err = v.ToString()
-				if err != nil {
-					return err
-				}
-			} else {
-				str, _ = arg.ToString()
-			}
-			args[i].value = str
-		}
+func (a jsArg) objectName() string { return "object" }
+
+// jsProcessArgs processes oArgs according to the args spec filling args[].value with the converted value
+func jsProcessArgs(jsr *JSRibosome, args []Arg, oArgs []otto.Value) (err error) {
+	vals := make([]argValue, len(oArgs))
+	for i, v := range oArgs {
+		vals[i] = jsArg{jsr: jsr, v: v}
 	}
+	err = processArgs(args, vals)
+	return
+}
+
+// jsProcessActionArgs processes the args of a call to the action's built-in function
+func jsProcessActionArgs(jsr *JSRibosome, a BuiltinAction, args []Arg, oArgs []otto.Value) (err error) {
+	err = actionArgsErr(a, args, jsProcessArgs(jsr, args, oArgs))
 	return
 }
 
-func mkOttoErr(jsr *JSRibosome, msg string) otto.Value {
-	return jsr.vm.MakeCustomError("HolochainError", msg)
+// mkOttoErr returns the error value given to apps for err, a HolochainError whose code
+// is one of HC.ErrorCodes
+func mkOttoErr(jsr *JSRibosome, err error) otto.Value {
+	e := jsr.vm.MakeCustomError("HolochainError", err.Error())
+	e.Object().Set("code", ErrorCode(err))
+	return e
 }
 
-func numInterfaceToInt(num interface{}) (val int, ok bool) {
-	ok = true
-	switch t := num.(type) {
-	case int64:
-		val = int(t)
-	case float64:
-		val = int(t)
-	case int:
-		val = t
-	default:
-		ok = false
+func numInterfaceToInt(num interface{}) (val int, ok bool) {
+	ok = true
+	switch t := num.(type) {
+	case int64:
+		val = int(t)
+	case float64:
+		val = int(t)
+	case int:
+		val = t
+	default:
+		ok = false
+	}
+	return
+}
+
+// NewJSRibosome factory function to build a javascript execution environment for a zome
+func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	jsr := JSRibosome{
+		h:          h,
+		zome:       zome,
+		vm:         otto.New(),
+		validators: make(map[string]otto.Value),
+	}
+	jsr.vm.Interrupt = make(chan func(), 1)
+
+	err = jsr.vm.Set("property", func(call otto.FunctionCall) otto.Value {
+		a := &ActionProperty{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+
+		a.prop = args[0].value.(string)
+
+		var p interface{}
+		p, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return otto.UndefinedValue()
+		}
+		result, _ := jsr.vm.ToValue(p)
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("config", func(call otto.FunctionCall) otto.Value {
+		a := &ActionConfig{zome: jsr.zome.Name}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+
+		a.key = args[0].value.(string)
+
+		var v interface{}
+		v, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return otto.UndefinedValue()
+		}
+		result, _ := jsr.vm.ToValue(v)
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("debug", func(call otto.FunctionCall) otto.Value {
+		a := &ActionDebug{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.msg = args[0].value.(string)
+		h.doAction(jsr.zome.Name, a, args...)
+		return otto.UndefinedValue()
+	})
+
+	err = jsr.vm.Set("makeHash", func(call otto.FunctionCall) otto.Value {
+		a := &ActionMakeHash{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+
+		a.entry = &GobEntry{C: args[0].value.(string)}
+		var r interface{}
+		r, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		var entryHash Hash
+		if r != nil {
+			entryHash = r.(Hash)
+		}
+		result, _ := jsr.vm.ToValue(entryHash.String())
+		return result
+	})
+
+	err = jsr.vm.Set("entryToken", func(call otto.FunctionCall) otto.Value {
+		a := &ActionEntryToken{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.hash = args[0].value.(Hash)
+		var r interface{}
+		r, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		result, _ := jsr.vm.ToValue(r)
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("pin", func(call otto.FunctionCall) otto.Value {
+		a := &ActionPin{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.hash = args[0].value.(Hash)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return otto.UndefinedValue()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("unpin", func(call otto.FunctionCall) otto.Value {
+		a := &ActionUnpin{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.hash = args[0].value.(Hash)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return otto.UndefinedValue()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	localStore, _ := jsr.vm.Object(`localStore = {}`)
+	err = localStore.Set("set", func(call otto.FunctionCall) otto.Value {
+		a := &ActionLocalStoreSet{zome: jsr.zome.Name}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.key = args[0].value.(string)
+		a.value = args[1].value.(string)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return otto.UndefinedValue()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = localStore.Set("get", func(call otto.FunctionCall) otto.Value {
+		a := &ActionLocalStoreGet{zome: jsr.zome.Name}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.key = args[0].value.(string)
+		var r interface{}
+		r, err = h.doAction(jsr.zome.Name, a, args...)
+		if errors.Is(err, ErrLocalKeyNotFound) {
+			return otto.UndefinedValue()
+		}
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		result, _ := jsr.vm.ToValue(r)
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = localStore.Set("del", func(call otto.FunctionCall) otto.Value {
+		a := &ActionLocalStoreDel{zome: jsr.zome.Name}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.key = args[0].value.(string)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil && err != ErrLocalKeyNotFound {
+			return mkOttoErr(&jsr, err)
+		}
+		return otto.UndefinedValue()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stream, _ := jsr.vm.Object(`stream = {}`)
+	err = stream.Set("write", func(call otto.FunctionCall) otto.Value {
+		a := &ActionStreamWrite{w: jsr.stream}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.data = args[0].value.(string)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return otto.UndefinedValue()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("spawnTask", func(call otto.FunctionCall) otto.Value {
+		a := &ActionSpawnTask{zome: jsr.zome.Name}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.function = args[0].value.(string)
+		a.args = args[1].value.(string)
+		r, err := h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		result, _ := jsr.vm.ToValue(r)
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("taskProgress", func(call otto.FunctionCall) otto.Value {
+		a := &ActionTaskProgress{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.id = args[0].value.(string)
+		a.progress = int(args[1].value.(int64))
+		a.message = args[2].value.(string)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return otto.UndefinedValue()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("getTask", func(call otto.FunctionCall) otto.Value {
+		a := &ActionGetTask{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.id = args[0].value.(string)
+		r, err := h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		result, err := jsr.vm.ToValue(r)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("getBridges", func(call otto.FunctionCall) otto.Value {
+		a := &ActionGetBridges{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		r, err := h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		result, err := jsr.vm.ToValue(r)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("send", func(call otto.FunctionCall) otto.Value {
+		a := &ActionSend{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+
+		a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		msg := args[1].value.(map[string]interface{})
+		var j []byte
+		j, err = json.Marshal(msg)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+
+		if len(call.ArgumentList) == 3 {
+			err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &a.options, &h.config.Loggers.App)
+			if err != nil {
+				return mkOttoErr(&jsr, err)
+			}
+		}
+		a.msg.ZomeType = jsr.zome.Name
+		a.msg.Body = string(j)
+
+		var r interface{}
+		r, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		var result otto.Value
+		result, err = jsr.vm.ToValue(r)
+
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return result
+	})
+
+	err = jsr.vm.Set("getMessageStatus", func(call otto.FunctionCall) otto.Value {
+		a := &ActionGetMessageStatus{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.id = args[0].value.(string)
+		r, err := h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		result, err := jsr.vm.ToValue(r)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return result
+	})
+	if err != nil {
+		return nil, err
 	}
-	return
-}
 
-// NewJSRibosome factory function to build a javascript execution environment for a zome
-func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
-	jsr := JSRibosome{
-		zome: zome,
-		vm:   otto.New(),
+	err = jsr.vm.Set("makeProof", func(call otto.FunctionCall) otto.Value {
+		a := &ActionMakeProof{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.entryType = args[0].value.(string)
+		a.field = args[1].value.(string)
+		a.setValue(args[2].value.(string))
+		r, err := h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		result, err := jsr.toValue(r)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return result
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	err = jsr.vm.Set("property", func(call otto.FunctionCall) otto.Value {
-		a := &ActionProperty{}
+	err = jsr.vm.Set("verifyProof", func(call otto.FunctionCall) otto.Value {
+		a := &ActionVerifyProof{}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
-
-		a.prop = args[0].value.(string)
-
-		var p interface{}
-		p, err = a.Do(h)
+		if err = json.Unmarshal([]byte(args[0].value.(string)), &a.proof); err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		r, err := h.doAction(jsr.zome.Name, a, args...)
 		if err != nil {
-			return otto.UndefinedValue()
+			return mkOttoErr(&jsr, err)
+		}
+		result, err := jsr.toValue(r)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
 		}
-		result, _ := jsr.vm.ToValue(p)
 		return result
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	err = jsr.vm.Set("debug", func(call otto.FunctionCall) otto.Value {
-		a := &ActionDebug{}
+	err = jsr.vm.Set("publish", func(call otto.FunctionCall) otto.Value {
+		a := &ActionPublish{zome: jsr.zome.Name}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
+		}
+		a.channel = args[0].value.(string)
+		a.msg = args[1].value.(string)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
 		}
-		a.msg = args[0].value.(string)
-		a.Do(h)
 		return otto.UndefinedValue()
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	err = jsr.vm.Set("makeHash", func(call otto.FunctionCall) otto.Value {
-		a := &ActionMakeHash{}
+	err = jsr.vm.Set("subscribe", func(call otto.FunctionCall) otto.Value {
+		a := &ActionSubscribe{zome: jsr.zome.Name}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.channel = args[0].value.(string)
+		a.handler = args[1].value.(string)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
+		return otto.UndefinedValue()
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		a.entry = &GobEntry{C: args[0].value.(string)}
-		var r interface{}
-		r, err = a.Do(h)
+	err = jsr.vm.Set("unsubscribe", func(call otto.FunctionCall) otto.Value {
+		a := &ActionUnsubscribe{zome: jsr.zome.Name}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
-		var entryHash Hash
-		if r != nil {
-			entryHash = r.(Hash)
+		a.channel = args[0].value.(string)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
 		}
-		result, _ := jsr.vm.ToValue(entryHash.String())
-		return result
+		return otto.UndefinedValue()
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	err = jsr.vm.Set("send", func(call otto.FunctionCall) otto.Value {
-		a := &ActionSend{}
+	err = jsr.vm.Set("emit", func(call otto.FunctionCall) otto.Value {
+		a := &ActionEmit{zome: jsr.zome.Name}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
+		a.signal = args[0].value.(string)
+		a.payload = args[1].value.(string)
+		_, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		return otto.UndefinedValue()
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
+	err = jsr.vm.Set("getOnlineAgents", func(call otto.FunctionCall) otto.Value {
+		a := &ActionGetOnlineAgents{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
-		msg := args[1].value.(map[string]interface{})
-		var j []byte
-		j, err = json.Marshal(msg)
+		r, err := h.doAction(jsr.zome.Name, a, args...)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
-
-		a.msg.ZomeType = jsr.zome.Name
-		a.msg.Body = string(j)
-
-		var r interface{}
-		r, err = a.Do(h)
+		result, err := jsr.toValue(r)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
-		var result otto.Value
-		result, err = jsr.vm.ToValue(r)
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
 
+	err = jsr.vm.Set("query", func(call otto.FunctionCall) otto.Value {
+		a := &ActionQuery{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		options := QueryOptions{}
+		if len(call.ArgumentList) == 1 {
+			err = decodeOptions(a.Name(), args[0].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+			if err != nil {
+				return mkOttoErr(&jsr, err)
+			}
+		}
+		r, err := h.doAction(jsr.zome.Name, NewQueryAction(&options), args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		result, err := jsr.toValue(r)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		return result
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	err = jsr.vm.Set("call", func(call otto.FunctionCall) otto.Value {
 		a := &ActionCall{}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		a.zome = args[0].value.(string)
 		var zome *Zome
 		zome, err = h.GetZome(a.zome)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		a.function = args[1].value.(string)
 		var fn *FunctionDef
 		fn, err = zome.GetFunctionDef(a.function)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		if fn.CallingType == JSON_CALLING {
 			if !call.ArgumentList[2].IsObject() {
-				return mkOttoErr(&jsr, "function calling type requires object argument type")
+				return mkOttoErr(&jsr, &wrappedError{msg: "function calling type requires object argument type", err: ErrInvalidArgs})
 			}
 		}
 		a.args = args[2].value.(string)
 
 		var r interface{}
-		r, err = a.Do(h)
+		r, err = h.doAction(jsr.zome.Name, a, args...)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		var result otto.Value
 		result, err = jsr.vm.ToValue(r)
 
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
+		}
+		return result
+	})
+
+	err = jsr.vm.Set("bridge", func(call otto.FunctionCall) otto.Value {
+		a := &ActionBridge{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.toApp = args[0].value.(string)
+		a.zome = args[1].value.(string)
+		a.function = args[2].value.(string)
+		a.args = args[3].value.(string)
+
+		var r interface{}
+		r, err = h.doAction(jsr.zome.Name, a, args...)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		var result otto.Value
+		result, err = jsr.vm.ToValue(r)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
 		}
 		return result
 	})
@@ -611,18 +1379,25 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	err = jsr.vm.Set("commit", func(call otto.FunctionCall) otto.Value {
 		var a Action = &ActionCommit{}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 
 		entryType := args[0].value.(string)
 		entryStr := args[1].value.(string)
+		var options CommitOptions
+		if len(call.ArgumentList) == 3 {
+			err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+			if err != nil {
+				return mkOttoErr(&jsr, err)
+			}
+		}
 		var r interface{}
 		entry := GobEntry{C: entryStr}
-		r, err = NewCommitAction(entryType, &entry).Do(h)
+		r, err = h.doAction(jsr.zome.Name, NewCommitActionWithOptions(entryType, &entry, options), args...)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		var entryHash Hash
 		if r != nil {
@@ -638,47 +1413,33 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	err = jsr.vm.Set("get", func(call otto.FunctionCall) (result otto.Value) {
 		var a Action = &ActionGet{}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 
 		options := GetOptions{StatusMask: StatusDefault}
 		if len(call.ArgumentList) == 2 {
-			opts := args[1].value.(map[string]interface{})
-			mask, ok := opts["StatusMask"]
-			if ok {
-				// otto returns int64 or float64 depending on whether
-				// the mask was returned by constant or addition so
-				maskval, ok := numInterfaceToInt(mask)
-				if !ok {
-					return mkOttoErr(&jsr, fmt.Sprintf("expecting int StatusMask attribute, got %T", mask))
-				}
-				options.StatusMask = int(maskval)
-			}
-			mask, ok = opts["GetMask"]
-			if ok {
-				maskval, ok := numInterfaceToInt(mask)
-				if !ok {
-
-					return mkOttoErr(&jsr, fmt.Sprintf("expecting int GetMask attribute, got %T", mask))
-				}
-				options.GetMask = int(maskval)
-			}
-			local, ok := opts["Local"]
-			if ok {
-				options.Local = local.(bool)
+			err = decodeOptions(a.Name(), args[1].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+			if err != nil {
+				return mkOttoErr(&jsr, err)
 			}
 		}
 		req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
 		var r interface{}
-		r, err = NewGetAction(req, &options).Do(h)
+		r, err = h.doAction(jsr.zome.Name, NewGetAction(req, &options), args...)
 		mask := options.GetMask
 		if mask == GetMaskDefault {
 			mask = GetMaskEntry
 		}
 		if err == nil {
 			getResp := r.(GetResp)
+			if getResp.Header != nil && options.GetMask == GetMaskDefault {
+				mask = GetMaskHeader
+			}
+			if getResp.Entry, err = appEntry(getResp.Entry); err != nil {
+				return mkOttoErr(&jsr, err)
+			}
 			var singleValueReturn bool
 			if mask&GetMaskEntry != 0 {
 				if GetMaskEntry == mask {
@@ -698,6 +1459,29 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 					result, err = jsr.vm.ToValue(getResp.Sources)
 				}
 			}
+			if wantsHistory(mask) {
+				if GetMaskHistory == mask {
+					singleValueReturn = true
+					result, err = jsr.vm.ToValue(getResp.History)
+				}
+			}
+			if mask&GetMaskMeta != 0 {
+				if GetMaskMeta == mask {
+					singleValueReturn = true
+					result, err = jsr.vm.ToValue(getResp.Meta)
+				}
+			}
+			var header otto.Value
+			if mask&GetMaskHeader != 0 {
+				header = otto.NullValue()
+				if getResp.Header != nil {
+					header, err = jsr.toValue(toJSHeader(jsr.h, getResp.Header))
+				}
+				if GetMaskHeader == mask {
+					singleValueReturn = true
+					result = header
+				}
+			}
 			if err == nil && !singleValueReturn {
 				respObj := make(map[string]interface{})
 				if mask&GetMaskEntry != 0 {
@@ -709,13 +1493,22 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				if mask&GetMaskSources != 0 {
 					respObj["Sources"] = getResp.Sources
 				}
+				if wantsHistory(mask) {
+					respObj["History"] = getResp.History
+				}
+				if mask&GetMaskMeta != 0 {
+					respObj["Meta"] = getResp.Meta
+				}
+				if mask&GetMaskHeader != 0 {
+					respObj["Header"] = header
+				}
 				result, err = jsr.vm.ToValue(respObj)
 			}
 			return
 		}
 
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		panic("Shouldn't get here!")
 	})
@@ -726,18 +1519,18 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	err = jsr.vm.Set("update", func(call otto.FunctionCall) (result otto.Value) {
 		var a Action = &ActionMod{}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		entryType := args[0].value.(string)
 		entryStr := args[1].value.(string)
 		replaces := args[2].value.(Hash)
 
 		entry := GobEntry{C: entryStr}
-		resp, err := NewModAction(entryType, &entry, replaces).Do(h)
+		resp, err := h.doAction(jsr.zome.Name, NewModAction(entryType, &entry, replaces), args...)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		var entryHash Hash
 		if resp != nil {
@@ -755,9 +1548,9 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	err = jsr.vm.Set("remove", func(call otto.FunctionCall) (result otto.Value) {
 		var a Action = &ActionDel{}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return mkOttoErr(&jsr, err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		entry := DelEntry{
 			Hash:    args[0].value.(Hash),
@@ -766,7 +1559,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		header, err := h.chain.GetEntryHeader(entry.Hash)
 		if err == nil {
 			var resp interface{}
-			resp, err = NewDelAction(header.Type, entry).Do(h)
+			resp, err = h.doAction(jsr.zome.Name, NewDelAction(header.Type, entry), args...)
 			if err == nil {
 				var entryHash Hash
 				if resp != nil {
@@ -776,7 +1569,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return
 			}
 		}
-		result = mkOttoErr(&jsr, err.Error())
+		result = mkOttoErr(&jsr, err)
 		return
 
 	})
@@ -784,12 +1577,42 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return nil, err
 	}
 
+	err = jsr.vm.Set("setStatus", func(call otto.FunctionCall) (result otto.Value) {
+		var a Action = &ActionSetStatus{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		entry := StatusEntry{
+			Hash:   args[0].value.(Hash),
+			Status: args[1].value.(string),
+		}
+		if args[2].value != nil {
+			entry.Message = args[2].value.(string)
+		}
+		entryType, err := h.entryTypeOf(jsr.zome.Name, entry.Hash)
+		if err == nil {
+			var resp interface{}
+			resp, err = h.doAction(jsr.zome.Name, NewSetStatusAction(entryType, entry), args...)
+			if err == nil {
+				result, _ = jsr.vm.ToValue(hashResult(resp))
+				return
+			}
+		}
+		result = mkOttoErr(&jsr, err)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	err = jsr.vm.Set("getLink", func(call otto.FunctionCall) (result otto.Value) {
 		var a Action = &ActionGetLink{}
 		args := a.Args()
-		err := jsProcessArgs(&jsr, args, call.ArgumentList)
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
 		if err != nil {
-			return jsr.vm.MakeCustomError("HolochainError", err.Error())
+			return mkOttoErr(&jsr, err)
 		}
 		base := args[0].value.(Hash)
 		tag := args[1].value.(string)
@@ -797,35 +1620,130 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		l := len(call.ArgumentList)
 		options := GetLinkOptions{Load: false, StatusMask: StatusLive}
 		if l == 3 {
-			opts := args[2].value.(map[string]interface{})
-			load, ok := opts["Load"]
-			if ok {
-				loadval, ok := load.(bool)
-				if !ok {
-					return mkOttoErr(&jsr, fmt.Sprintf("expecting boolean Load attribute in object, got %T", load))
-				}
-				options.Load = loadval
-			}
-			mask, ok := opts["StatusMask"]
-			if ok {
-				maskval, ok := numInterfaceToInt(mask)
-				if !ok {
-					return mkOttoErr(&jsr, fmt.Sprintf("expecting int StatusMask attribute in object, got %T", mask))
-				}
-				options.StatusMask = int(maskval)
+			err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+			if err != nil {
+				return mkOttoErr(&jsr, err)
 			}
 		}
 		var response interface{}
 
-		response, err = NewGetLinkAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, &options).Do(h)
+		response, err = h.doAction(jsr.zome.Name, NewGetLinkAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask, Limit: options.Limit, Cursor: options.Cursor, SortBy: options.SortBy}, &options), args...)
 		Debugf("RESPONSE:%v\n", response)
 
 		if err == nil {
 			result, err = jsr.vm.ToValue(response)
 		} else {
-			result = mkOttoErr(&jsr, err.Error())
+			result = mkOttoErr(&jsr, err)
+		}
+
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("getBacklinks", func(call otto.FunctionCall) (result otto.Value) {
+		a := &ActionGetBacklinks{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		target := args[0].value.(Hash)
+		tag := args[1].value.(string)
+
+		options := GetLinkOptions{Load: false, StatusMask: StatusLive}
+		if len(call.ArgumentList) == 3 {
+			err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+			if err != nil {
+				return mkOttoErr(&jsr, err)
+			}
+		}
+
+		response, err := h.doAction(jsr.zome.Name, NewGetBacklinksAction(target, tag, &options), args...)
+		if err == nil {
+			result, err = jsr.vm.ToValue(response)
+		}
+		if err != nil {
+			result = mkOttoErr(&jsr, err)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("countLinks", func(call otto.FunctionCall) (result otto.Value) {
+		a := &ActionCountLinks{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.base = args[0].value.(Hash)
+		a.tag = args[1].value.(string)
+		response, err := h.doAction(jsr.zome.Name, a, args...)
+		if err == nil {
+			result, err = jsr.vm.ToValue(response)
+		}
+		if err != nil {
+			result = mkOttoErr(&jsr, err)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("linkExists", func(call otto.FunctionCall) (result otto.Value) {
+		a := &ActionLinkExists{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		a.base = args[0].value.(Hash)
+		a.tag = args[1].value.(string)
+		a.target = args[2].value.(Hash)
+		response, err := h.doAction(jsr.zome.Name, a, args...)
+		if err == nil {
+			result, err = jsr.vm.ToValue(response)
+		}
+		if err != nil {
+			result = mkOttoErr(&jsr, err)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.vm.Set("getLinks", func(call otto.FunctionCall) (result otto.Value) {
+		a := &ActionGetLinks{}
+		args := a.Args()
+		err := jsProcessActionArgs(&jsr, a, args, call.ArgumentList)
+		if err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+		if err = a.setSpecs(args[0].value.(string)); err != nil {
+			return mkOttoErr(&jsr, err)
+		}
+
+		a.options = &GetLinkOptions{Load: false, StatusMask: StatusLive}
+		if len(call.ArgumentList) == 2 {
+			err = decodeOptions(a.Name(), args[1].value.(map[string]interface{}), a.options, &h.config.Loggers.App)
+			if err != nil {
+				return mkOttoErr(&jsr, err)
+			}
 		}
 
+		response, err := h.doAction(jsr.zome.Name, a, args...)
+		if err == nil {
+			result, err = jsr.vm.ToValue(response)
+		}
+		if err != nil {
+			result = mkOttoErr(&jsr, err)
+		}
 		return
 	})
 	if err != nil {
@@ -834,18 +1752,38 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 
 	l := JSLibrary
 	if h != nil {
-		l += fmt.Sprintf(`var App = {Name:"%s",DNA:{Hash:"%s"},Agent:{Hash:"%s",String:"%s"},Key:{Hash:"%s"}};`, h.nucleus.dna.Name, h.dnaHash, h.agentHash, h.Agent().Name(), h.nodeIDStr)
+		l += fmt.Sprintf(`var App = {Name:%s,DNA:{Hash:%s},Agent:{Hash:%s,String:%s},Key:{Hash:%s}};`,
+			jsString(h.nucleus.dna.Name), jsString(h.dnaHash.String()), jsString(h.agentHash.String()), jsString(string(h.Agent().Name())), jsString(h.nodeIDStr))
+		for i, s := range h.nucleus.dna.Statuses {
+			l += fmt.Sprintf(`HC.Status[%s]=%d;`, jsString(s.Name), StatusCustom<<uint(i))
+		}
+	}
+	if _, err = jsr.Run(l); err != nil {
+		return
+	}
+	if err = jsr.addHostFunctions(); err != nil {
+		return
 	}
-	_, err = jsr.Run(l + zome.Code)
+	_, err = jsr.Run(zome.Code)
 	if err != nil {
 		return
 	}
+
+	// get the validators ready for the zome's entry types; any that can't be built
+	// report their error when they are first used
+	for i := range zome.Entries {
+		for _, action := range jsValidateActions {
+			jsr.validator(action, &zome.Entries[i])
+		}
+	}
 	n = &jsr
 	return
 }
 
 // Run executes javascript code
 func (jsr *JSRibosome) Run(code string) (result interface{}, err error) {
+	defer recoverInterrupt(&err)
+	defer jsr.limit()()
 	v, err := jsr.vm.Run(code)
 	if err != nil {
 		err = errors.New("JS exec error: " + err.Error())
@@ -2,10 +2,12 @@ package holochain
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/robertkrimen/otto"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
 func TestNewJSRibosome(t *testing.T) {
@@ -118,6 +120,27 @@ func TestNewJSRibosome(t *testing.T) {
 
 		})
 
+		Convey("localStore", func() {
+			_, err = z.Run(`localStore.get("pref")`)
+			So(err, ShouldBeNil)
+			So(z.lastResult.IsUndefined(), ShouldBeTrue)
+
+			_, err = z.Run(`localStore.set("pref",{theme:"dark"})`)
+			So(err, ShouldBeNil)
+			_, err = z.Run(`localStore.get("pref")`)
+			So(err, ShouldBeNil)
+			s, _ := z.lastResult.ToString()
+			So(s, ShouldEqual, `{"theme":"dark"}`)
+
+			// storage is namespaced by zome
+			_, err = h.dht.localStoreGet("zySampleZome", "pref")
+			So(err, ShouldEqual, ErrLocalKeyNotFound)
+
+			_, err = z.Run(`localStore.del("pref");localStore.get("pref")`)
+			So(err, ShouldBeNil)
+			So(z.lastResult.IsUndefined(), ShouldBeTrue)
+		})
+
 		// add entries onto the chain to get hash values for testing
 		hash := commit(h, "oddNumbers", "3")
 		profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
@@ -187,34 +210,50 @@ func TestJSReceive(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(response, ShouldEqual, `{"foo":"baz"}`)
 	})
+	Convey("it should pass messages with newlines and quotes intact", t, func() {
+		z, _ := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType, Code: `function receive(from,msg) {return {foo:msg.bar,from:from}}`})
+		response, err := z.Receive(`fake"hash`, `{"bar":"line\n\"two\""}`)
+		So(err, ShouldBeNil)
+		So(response, ShouldEqual, `{"foo":"line\n\"two\"","from":"fake\"hash"}`)
+	})
 }
 
-func TestJSbuildValidate(t *testing.T) {
-	d, _, h := PrepareTestChain("test")
-	defer CleanupTestDir(d)
-
-	e := GobEntry{C: "2"}
-	a := NewCommitAction("evenNumbers", &e)
-	var header Header
-	a.header = &header
-
+func TestJSValidatorCode(t *testing.T) {
 	def := EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
 
-	Convey("it should build commit", t, func() {
-		code, err := buildJSValidateAction(a, &def, nil, []string{"fake_src_hash"})
+	Convey("it should build the commit wrapper", t, func() {
+		code, err := jsValidatorCode("commit", &def)
 		So(err, ShouldBeNil)
-		So(code, ShouldEqual, `validateCommit("evenNumbers","2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"},{},["fake_src_hash"])`)
+		So(code, ShouldEqual, `(function(arg0,arg1,arg2,pkg,sources){return validateCommit("evenNumbers",arg0,arg1,pkg,sources)})`)
 	})
 
-	Convey("it should build put", t, func() {
-		a := NewPutAction("evenNumbers", &e, &header)
-		pkg, _ := MakePackage(h, PackagingReq{PkgReqChain: int64(PkgReqChainOptFull)})
-		vpkg, _ := MakeValidationPackage(h, &pkg)
-		_, err := buildJSValidateAction(a, &def, vpkg, []string{"fake_src_hash"})
+	Convey("it should evaluate raw javascript entries", t, func() {
+		code, err := jsValidatorCode("mod", &EntryDef{Name: "profile", DataFormat: DataFormatRawJS})
 		So(err, ShouldBeNil)
-		//	So(code, ShouldEqual, `validatePut("evenNumbers","2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"},pgk,["fake_src_hash"])`)
+		So(code, ShouldEqual, `(function(arg0,arg1,arg2,pkg,sources){return validateMod("profile",eval("("+arg0+")"),arg1,arg2,pkg,sources)})`)
+
+		_, err = jsValidatorCode("put", &EntryDef{Name: "profile", DataFormat: "bogus"})
+		So(err.Error(), ShouldEqual, "data format not implemented: bogus")
 	})
 
+	Convey("it should compile each wrapper once and reuse it across ribosomes", t, func() {
+		z := &Zome{RibosomeType: JSRibosomeType, Entries: []EntryDef{{Name: "precompiled", DataFormat: DataFormatString}}}
+		v, err := NewJSRibosome(nil, z)
+		So(err, ShouldBeNil)
+		key := "commit:" + DataFormatString + ":precompiled"
+		So(v.(*JSRibosome).validators[key].IsFunction(), ShouldBeTrue)
+
+		jsValidatorScripts.lk.Lock()
+		script := jsValidatorScripts.scripts[key]
+		jsValidatorScripts.lk.Unlock()
+		So(script, ShouldNotBeNil)
+
+		_, err = NewJSRibosome(nil, z)
+		So(err, ShouldBeNil)
+		jsValidatorScripts.lk.Lock()
+		So(jsValidatorScripts.scripts[key], ShouldEqual, script)
+		jsValidatorScripts.lk.Unlock()
+	})
 }
 
 func TestJSValidateCommit(t *testing.T) {
@@ -233,11 +272,12 @@ func TestJSValidateCommit(t *testing.T) {
 		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function validateCommit(name,entry,header,pkg,sources) {debug(name);debug(entry);debug(JSON.stringify(header));debug(JSON.stringify(sources));debug(JSON.stringify(pkg));return true};`})
 		So(err, ShouldBeNil)
 		d := EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+		validator, _ := json.Marshal(h.validatorProps())
 		ShouldLog(&h.config.Loggers.App, `evenNumbers
 foo
 {"EntryLink":"QmNiCwBNA8MWDADTFVq1BonUEJbS2SvjAoNkZZrhEwcuU2","Time":"1970-01-01T00:00:01Z","Type":"evenNumbers"}
 ["fakehashvalue"]
-{}
+{"Validator":`+string(validator)+`}
 `, func() {
 			a := NewCommitAction("oddNumbers", &GobEntry{C: "foo"})
 			a.header = &hdr
@@ -290,26 +330,76 @@ foo
 	})
 }
 
+func TestJSPackageValue(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	v, _ := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType})
+	jsr := v.(*JSRibosome)
+
+	Convey("it should convert a package's chain to the same object as its JSON", t, func() {
+		pkg, _ := MakePackage(h, PackagingReq{PkgReqChain: int64(PkgReqChainOptFull)})
+		vpkg, _ := MakeValidationPackage(h, &pkg)
+		p, err := jsr.packageValue(vpkg)
+		So(err, ShouldBeNil)
+		j, err := jsr.vm.Call("JSON.stringify", nil, p)
+		So(err, ShouldBeNil)
+
+		var got, expected interface{}
+		err = json.Unmarshal([]byte(j.String()), &got)
+		So(err, ShouldBeNil)
+		b, _ := json.Marshal(map[string]interface{}{"Chain": vpkg.Chain})
+		json.Unmarshal(b, &expected)
+		So(got, ShouldResemble, expected)
+	})
+
+	Convey("it should convert an empty package to an empty object", t, func() {
+		p, err := jsr.packageValue(nil)
+		So(err, ShouldBeNil)
+		j, _ := jsr.vm.Call("JSON.stringify", nil, p)
+		So(j.String(), ShouldEqual, "{}")
+	})
+}
+
 func TestPrepareJSValidateArgs(t *testing.T) {
 	d := EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+	v, _ := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType})
+	jsr := v.(*JSRibosome)
+
+	// decode returns the go equivalents of the native values the args were converted to
+	decode := func(args []interface{}) (vals []interface{}) {
+		for _, arg := range args {
+			j, err := jsr.vm.Call("JSON.stringify", nil, arg)
+			So(err, ShouldBeNil)
+			var v interface{}
+			if !j.IsUndefined() {
+				err = json.Unmarshal([]byte(j.String()), &v)
+				So(err, ShouldBeNil)
+			}
+			vals = append(vals, v)
+		}
+		return
+	}
+	hdr := func(t string) map[string]interface{} {
+		return map[string]interface{}{"EntryLink": "", "Type": t, "Time": "0001-01-01T00:00:00Z"}
+	}
 
 	Convey("it should prepare args for commit", t, func() {
 		e := GobEntry{C: "2"}
 		a := NewCommitAction("evenNumbers", &e)
 		var header Header
 		a.header = &header
-		args, err := prepareJSValidateArgs(a, &d)
+		args, err := jsr.prepareJSValidateArgs(a, &d)
 		So(err, ShouldBeNil)
-		So(args, ShouldEqual, `"2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"}`)
+		So(decode(args), ShouldResemble, []interface{}{"2", hdr(""), nil})
 	})
 	Convey("it should prepare args for put", t, func() {
 		e := GobEntry{C: "2"}
 		var header Header
 		a := NewPutAction("evenNumbers", &e, &header)
 
-		args, err := prepareJSValidateArgs(a, &d)
+		args, err := jsr.prepareJSValidateArgs(a, &d)
 		So(err, ShouldBeNil)
-		So(args, ShouldEqual, `"2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"}`)
+		So(decode(args), ShouldResemble, []interface{}{"2", hdr(""), nil})
 	})
 	Convey("it should prepare args for mod", t, func() {
 		e := GobEntry{C: "4"}
@@ -318,32 +408,56 @@ func TestPrepareJSValidateArgs(t *testing.T) {
 		a := NewModAction("evenNumbers", &e, hash)
 		a.header = &header
 
-		args, err := prepareJSValidateArgs(a, &d)
+		args, err := jsr.prepareJSValidateArgs(a, &d)
 		So(err, ShouldBeNil)
-		So(args, ShouldEqual, `"4",{"EntryLink":"","Type":"foo","Time":"0001-01-01T00:00:00Z"},"QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2"`)
+		So(decode(args), ShouldResemble, []interface{}{"4", hdr("foo"), "QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2"})
 	})
 	Convey("it should prepare args for del", t, func() {
 		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2")
 		entry := DelEntry{Hash: hash, Message: "expired"}
 		a := NewDelAction("profile", entry)
-		args, err := prepareJSValidateArgs(a, &d)
+		args, err := jsr.prepareJSValidateArgs(a, &d)
 		So(err, ShouldBeNil)
-		So(args, ShouldEqual, `"QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2"`)
+		So(decode(args), ShouldResemble, []interface{}{"QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2", nil, nil})
 	})
 	Convey("it should prepare args for link", t, func() {
 		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2")
 		a := NewLinkAction("evenNumbers", []Link{{Base: "QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5", Link: "QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5", Tag: "fish"}})
 		a.validationBase = hash
-		args, err := prepareJSValidateArgs(a, &d)
+		args, err := jsr.prepareJSValidateArgs(a, &d)
 		So(err, ShouldBeNil)
-		So(args, ShouldEqual, `"QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2",JSON.parse("[{\"LinkAction\":\"\",\"Base\":\"QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5\",\"Link\":\"QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5\",\"Tag\":\"fish\"}]")`)
+		So(decode(args), ShouldResemble, []interface{}{"QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2", []interface{}{map[string]interface{}{
+			"LinkAction": "", "Base": "QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5", "Link": "QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5", "Tag": "fish"}}, nil})
+	})
+	Convey("it should pass entries through unchanged", t, func() {
+		content := "line one\nline \"two\"\\ \u2028 \"); evil(); (\""
+		a := NewCommitAction("evenNumbers", &GobEntry{C: content})
+		a.header = &Header{}
+		args, err := jsr.prepareJSValidateArgs(a, &d)
+		So(err, ShouldBeNil)
+		s, err := args[0].(otto.Value).ToString()
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, content)
 	})
 }
 
-func TestJSSanitize(t *testing.T) {
-	Convey("should strip quotes and returns", t, func() {
-		So(jsSanitizeString(`"`), ShouldEqual, `\"`)
-		So(jsSanitizeString("\"x\ny"), ShouldEqual, "\\\"xy")
+func TestJSString(t *testing.T) {
+	Convey("it should quote and escape quotes, backslashes and returns", t, func() {
+		So(jsString(`"`), ShouldEqual, `"\""`)
+		So(jsString("\"x\ny\r\tz"), ShouldEqual, `"\"x\ny\r\tz"`)
+		So(jsString(`a\"); evil(); ("`), ShouldEqual, `"a\\\"); evil(); (\""`)
+	})
+	Convey("it should escape control characters and line separators", t, func() {
+		So(jsString("\x00\x1f\x7f"), ShouldEqual, `"\u0000\u001f\u007f"`)
+		So(jsString("a\u2028b\u2029c"), ShouldEqual, `"a\u2028b\u2029c"`)
+		So(jsString("ünïcødé"), ShouldEqual, `"ünïcødé"`)
+	})
+	Convey("it should round trip through the VM", t, func() {
+		v, _ := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType})
+		s := "quote\" back\\slash\nnew\u2028line\x01"
+		r, err := v.(*JSRibosome).vm.Run(jsString(s))
+		So(err, ShouldBeNil)
+		So(r.String(), ShouldEqual, s)
 	})
 }
 
@@ -393,6 +507,86 @@ func TestJSExposeCall(t *testing.T) {
 	})
 }
 
+func TestJSExecutionTimeout(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	zome, _ := h.GetZome("jsSampleZome")
+	zome.ExecutionTimeout = "100ms"
+	zome.Code += `function spin(x){while(true){}}`
+	zome.Functions = append(zome.Functions, FunctionDef{Name: "spin", CallingType: STRING_CALLING})
+	v, err := NewJSRibosome(h, zome)
+	if err != nil {
+		panic(err)
+	}
+	z := v.(*JSRibosome)
+
+	Convey("calls running past the zome's execution timeout should be aborted", t, func() {
+		spin, _ := zome.GetFunctionDef("spin")
+		start := time.Now()
+		_, err := z.Call(spin, "")
+		So(err, ShouldEqual, ErrRibosomeTimeout)
+		So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+
+		_, err = z.Run(`while(true){}`)
+		So(err, ShouldEqual, ErrRibosomeTimeout)
+	})
+
+	Convey("validation running past the zome's execution timeout should be aborted", t, func() {
+		v, err := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType, ExecutionTimeout: "100ms", Code: `function validateCommit(name,entry,header,pkg,sources) {while(true){}}`})
+		So(err, ShouldBeNil)
+		hdr := mkTestHeader("oddNumbers")
+		a := NewCommitAction("oddNumbers", &GobEntry{C: "3"})
+		a.header = &hdr
+		start := time.Now()
+		err = v.ValidateAction(a, &EntryDef{Name: "oddNumbers", DataFormat: DataFormatString}, nil, nil)
+		So(err, ShouldEqual, ErrRibosomeTimeout)
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+	})
+
+	Convey("genesis and receive running past the timeout should be aborted", t, func() {
+		v, err := NewJSRibosome(nil, &Zome{RibosomeType: JSRibosomeType, ExecutionTimeout: "100ms", Code: `function genesis() {while(true){}};function receive(from,msg) {while(true){}}`})
+		So(err, ShouldBeNil)
+		So(v.ChainGenesis(), ShouldEqual, ErrRibosomeTimeout)
+		_, err = v.Receive("fakehash", `{}`)
+		So(err, ShouldEqual, ErrRibosomeTimeout)
+	})
+
+	Convey("calls within the timeout shouldn't be affected by earlier timeouts", t, func() {
+		cater, _ := zome.GetFunctionDef("testStrFn1")
+		result, err := z.Call(cater, "fish")
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, "result: fish")
+	})
+
+	Convey("the execution timeout should be checked in the DNA", t, func() {
+		z := Zome{Name: "z", ExecutionTimeout: "soon"}
+		_, err := z.executionTimeout()
+		So(err, ShouldNotBeNil)
+		z.ExecutionTimeout = "-1s"
+		_, err = z.executionTimeout()
+		So(err, ShouldNotBeNil)
+		z.ExecutionTimeout = "2s"
+		timeout, err := z.executionTimeout()
+		So(err, ShouldBeNil)
+		So(timeout, ShouldEqual, 2*time.Second)
+	})
+
+	Convey("the execution timeout should only be allowed for zomes that can be interrupted", t, func() {
+		z := &h.nucleus.dna.Zomes[0]
+		So(z.RibosomeType, ShouldEqual, ZygoRibosomeType)
+		z.ExecutionTimeout = "2s"
+		defer func() { z.ExecutionTimeout = "" }()
+		So(h.nucleus.dna.check(), ShouldBeNil)
+
+		z.RibosomeType = WASMRibosomeType
+		defer func() { z.RibosomeType = ZygoRibosomeType }()
+		err := h.nucleus.dna.check()
+		So(errors.Is(err, ErrExecutionTimeoutUnsupported), ShouldBeTrue)
+	})
+}
+
 func TestJSDHT(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestDir(d)
@@ -405,6 +599,17 @@ func TestJSDHT(t *testing.T) {
 		So(z.lastResult.String(), ShouldEqual, "HolochainError: hash not found")
 	})
 
+	Convey("errors should be returned with a code apps can branch on", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`var e=get("%s");e.name+" "+(e.code==HC.ErrorCodes.HashNotFound)+" "+e.message`, hash.String())})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		So(z.lastResult.String(), ShouldEqual, "HolochainError true hash not found")
+
+		_, err = z.Run(`get(1).code`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, ErrorCodeInvalidArgs)
+	})
+
 	// add an entry onto the chain
 	hash = commit(h, "oddNumbers", "7")
 
@@ -439,6 +644,15 @@ func TestJSDHT(t *testing.T) {
 		So(fmt.Sprintf("%v", x), ShouldEqual, fmt.Sprintf("[%v]", h.nodeIDStr))
 	})
 
+	Convey("get should return history", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`get("%s",{GetMask:HC.GetMask.History}).length;`, hash.String())})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		x, err := z.lastResult.Export()
+		So(err, ShouldBeNil)
+		So(fmt.Sprintf("%v", x), ShouldEqual, "1")
+	})
+
 	Convey("get should return collection", t, func() {
 		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`get("%s",{GetMask:HC.GetMask.All});`, hash.String())})
 		So(err, ShouldBeNil)
@@ -449,6 +663,24 @@ func TestJSDHT(t *testing.T) {
 		So(obj["Entry"].(Entry).Content(), ShouldEqual, `7`)
 		So(obj["EntryType"].(string), ShouldEqual, `oddNumbers`)
 		So(fmt.Sprintf("%v", obj["Sources"]), ShouldEqual, fmt.Sprintf("[%v]", h.nodeIDStr))
+		_, ok := obj["History"]
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("get should resolve header hashes", t, func() {
+		headerHash := h.chain.Hashes[len(h.chain.Hashes)-1]
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`get("%s").EntryLink;`, headerHash.String())})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		So(z.lastResult.String(), ShouldEqual, hash.String())
+
+		_, err = z.Run(fmt.Sprintf(`get("%s",{GetMask:HC.GetMask.Entry|HC.GetMask.Header});`, headerHash.String()))
+		So(err, ShouldBeNil)
+		x, err := z.lastResult.Export()
+		So(err, ShouldBeNil)
+		obj := x.(map[string]interface{})
+		So(obj["Entry"].(Entry).Content(), ShouldEqual, `7`)
+		So(obj["Header"].(map[string]interface{})["Type"], ShouldEqual, "oddNumbers")
 	})
 
 	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
@@ -0,0 +1,125 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// keepalive implements pinging the nodes in the gossip table and evicting the ones that
+// stop answering, so that gossip isn't wasted on nodes that have gone
+
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"sync"
+	"time"
+)
+
+var ErrPingTimeout = errors.New("ping timed out")
+
+// KeepAliveInterval is how often the gossipers are pinged, 0 for never
+var KeepAliveInterval = time.Minute
+
+// KeepAliveTimeout is how long a gossiper has to answer a ping
+var KeepAliveTimeout = 10 * time.Second
+
+// KeepAliveMisses is how many pings in a row a gossiper can miss before it is evicted
+var KeepAliveMisses = 3
+
+// ping checks that a node answers.  Any answer will do, even an error from a node too
+// old to know about pings.
+func (dht *DHT) ping(id peer.ID) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		_, e := dht.h.node.Send(GossipProtocol, id, dht.h.node.NewMessage(PING_REQUEST, ""))
+		done <- e
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(KeepAliveTimeout):
+		err = ErrPingTimeout
+	}
+	return
+}
+
+// DeleteGossiper removes a node from the gossip table
+func (dht *DHT) DeleteGossiper(id peer.ID) (err error) {
+	err = dht.update(func(tx *buntdb.Tx) error {
+		_, e := tx.Delete("peer:" + peer.IDB58Encode(id))
+		if e == buntdb.ErrNotFound {
+			e = nil
+		}
+		return e
+	})
+	return
+}
+
+// pingGossipers pings all the gossipers at once, evicting the ones that have missed
+// KeepAliveMisses pings in a row, and returns how many were evicted
+func (dht *DHT) pingGossipers() (evicted int, err error) {
+	var glist []peer.ID
+	if glist, err = dht.getGossipers(); err != nil {
+		return
+	}
+	var wg sync.WaitGroup
+	var lk sync.Mutex
+	for _, id := range glist {
+		wg.Add(1)
+		go func(id peer.ID) {
+			defer wg.Done()
+			pingErr := dht.ping(id)
+			evict := false
+			e := dht.updateGossipStats(id, func(s *GossipStats) {
+				if pingErr == nil {
+					s.MissedPings = 0
+					return
+				}
+				s.MissedPings++
+				if s.MissedPings >= KeepAliveMisses {
+					evict = true
+					s.MissedPings = 0
+				}
+			})
+			if e != nil {
+				dht.glog.Logf("error updating gossip stats: %v", e)
+				return
+			}
+			if !evict {
+				return
+			}
+			dht.glog.Logf("evicting %v after %d missed pings: %v", id, KeepAliveMisses, pingErr)
+			if e = dht.DeleteGossiper(id); e != nil {
+				dht.glog.Logf("error evicting %v: %v", id, e)
+				return
+			}
+			lk.Lock()
+			evicted++
+			lk.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return
+}
+
+// keepAlive pings the gossipers every interval until stop is closed.  It doesn't ping
+// while the DHT is suspended or on the low power profile, to save power.
+func (dht *DHT) keepAlive(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		dht.powerLk.Lock()
+		suspended := dht.suspended != nil
+		dht.powerLk.Unlock()
+		if suspended || dht.isLowPower() {
+			continue
+		}
+		if _, err := dht.pingGossipers(); err != nil {
+			dht.glog.Logf("error pinging gossipers: %v", err)
+		}
+	}
+}
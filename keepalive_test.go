@@ -0,0 +1,65 @@
+package holochain
+
+import (
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestKeepAlive(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+	defer func(timeout time.Duration) { KeepAliveTimeout = timeout }(KeepAliveTimeout)
+	KeepAliveTimeout = time.Second
+
+	// a node that answers pings
+	alive, err := makeNode(1237, "alive")
+	if err != nil {
+		panic(err)
+	}
+	defer alive.Close()
+	if err = alive.StartProtocol(h, GossipProtocol); err != nil {
+		panic(err)
+	}
+	h.node.Host.Peerstore().AddAddrs(alive.HashAddr, []ma.Multiaddr{alive.NetAddr}, pstore.PermanentAddrTTL)
+	// and one that has gone
+	gone, _ := makePeer("peer_gone")
+	dht.UpdateGossiper(alive.HashAddr, 0)
+	dht.UpdateGossiper(gone, 0)
+
+	Convey("gossipers should answer pings", t, func() {
+		r, err := GossipReceiver(h, h.node.NewMessage(PING_REQUEST, ""))
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, "pong")
+		So(dht.ping(alive.HashAddr), ShouldBeNil)
+		So(dht.ping(gone), ShouldNotBeNil)
+	})
+
+	Convey("gossipers that miss pings in a row should be evicted", t, func() {
+		for i := 1; i < KeepAliveMisses; i++ {
+			evicted, err := dht.pingGossipers()
+			So(err, ShouldBeNil)
+			So(evicted, ShouldEqual, 0)
+		}
+		stats, err := dht.Stats()
+		So(err, ShouldBeNil)
+		for _, s := range stats {
+			if s.Peer == alive.HashAddr.Pretty() {
+				So(s.MissedPings, ShouldEqual, 0)
+			} else {
+				So(s.MissedPings, ShouldEqual, KeepAliveMisses-1)
+			}
+		}
+
+		evicted, err := dht.pingGossipers()
+		So(err, ShouldBeNil)
+		So(evicted, ShouldEqual, 1)
+		glist, err := dht.getGossipers()
+		So(err, ShouldBeNil)
+		So(len(glist), ShouldEqual, 1)
+		So(glist[0], ShouldEqual, alive.HashAddr)
+	})
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// linkpage implements ordering the links on a base, by when they were made or by the
+// sort keys apps give them, and paging through them with cursors, which are positions
+// in the order so that pages don't shift as new links arrive by gossip
+
+package holochain
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/tidwall/buntdb"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orders for getLink's SortBy option, prefixed with "-" for descending order
+const (
+	LinkSortTime = "time" // when the links were made, the default for paging
+	LinkSortKey  = "key"  // the links' sort keys
+)
+
+// MaxLinkSortKeySize is the longest sort key a link may have
+const MaxLinkSortKeySize = 256
+
+var ErrBadCursor = errors.New("invalid link cursor")
+var ErrBadLinkSort = errors.New("invalid link sort order")
+var ErrLinkSortKeyTooLong = errors.New("invalid links entry: SortKey too long")
+
+// linkTimeKey returns the DHT store key holding when a link was made
+func linkTimeKey(base string, link string, tag string) string {
+	return "linktime:" + base + ":" + link + ":" + tag
+}
+
+// linkSortKey returns the DHT store key holding a link's sort key
+func linkSortKey(base string, link string, tag string) string {
+	return "linksort:" + base + ":" + link + ":" + tag
+}
+
+// _putLinkTime records when a link was made, which is the time in the header of the
+// linking entry so that every holder orders the link the same way.  The first time
+// recorded is kept so that re-puts of the link don't move it under paging cursors.
+func _putLinkTime(tx *buntdb.Tx, base string, link string, tag string, t time.Time) (err error) {
+	key := linkTimeKey(base, link, tag)
+	_, err = tx.Get(key)
+	if err == nil {
+		return
+	}
+	if err != buntdb.ErrNotFound {
+		return
+	}
+	_, _, err = tx.Set(key, strconv.FormatInt(t.UnixNano(), 10), nil)
+	return
+}
+
+// parseLinkSort returns what a SortBy option orders links by
+func parseLinkSort(sortBy string) (order string, err error) {
+	if sortBy == "" {
+		sortBy = LinkSortTime
+	}
+	order = strings.TrimPrefix(sortBy, "-")
+	if order != LinkSortTime && order != LinkSortKey {
+		err = ErrBadLinkSort
+	}
+	return
+}
+
+// linkCursor is a position in the ordered links on a base
+type linkCursor struct {
+	sortBy string
+	value  string // the link's time in unix nanoseconds or its sort key
+	hash   string
+}
+
+// linkNumber returns the value of a link sort value if it is a number; NaN isn't one
+// as it can't be ordered
+func linkNumber(s string) (f float64, ok bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	ok = err == nil && !math.IsNaN(f)
+	return
+}
+
+// compareLinkValues orders values as numbers if they both are, and otherwise puts all
+// numbers before all strings so that mixed sets still have a total order.  Integers are
+// compared exactly as times in nanoseconds don't fit in a float, and values that are
+// numerically equal fall back to string order.
+func compareLinkValues(a string, b string) int {
+	ia, ea := strconv.ParseInt(a, 10, 64)
+	ib, eb := strconv.ParseInt(b, 10, 64)
+	if ea == nil && eb == nil {
+		switch {
+		case ia < ib:
+			return -1
+		case ia > ib:
+			return 1
+		}
+		return 0
+	}
+	fa, na := linkNumber(a)
+	fb, nb := linkNumber(b)
+	switch {
+	case na && !nb:
+		return -1
+	case !na && nb:
+		return 1
+	case na && nb:
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// before returns true if c comes before o in the cursor's order
+func (c linkCursor) before(o linkCursor) bool {
+	cmp := compareLinkValues(c.value, o.value)
+	if cmp == 0 {
+		cmp = strings.Compare(c.hash, o.hash)
+	}
+	if strings.HasPrefix(c.sortBy, "-") {
+		cmp = -cmp
+	}
+	return cmp < 0
+}
+
+// encode returns the cursor as an opaque string
+func (c linkCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.sortBy + ":" + c.hash + ":" + c.value))
+}
+
+func decodeLinkCursor(s string) (c linkCursor, err error) {
+	var b []byte
+	if b, err = base64.RawURLEncoding.DecodeString(s); err != nil {
+		err = ErrBadCursor
+		return
+	}
+	x := strings.SplitN(string(b), ":", 3)
+	if len(x) != 3 {
+		err = ErrBadCursor
+		return
+	}
+	c = linkCursor{sortBy: x[0], hash: x[1], value: x[2]}
+	return
+}
+
+// getLinkPage returns up to limit links on a base in the sortBy order after the cursor,
+// which is empty for the first page, and the cursor for the next page, which is empty
+// after the last page.  A limit of 0 returns all the links after the cursor.  Links
+// without a time or sort key sort lowest.
+func (dht *DHT) getLinkPage(base Hash, tag string, statusMask int, sortBy string, cursor string, limit int) (results []TaggedHash, next string, err error) {
+	dht.dlog.Logf("getLinkPage on %v of %s by %q after %q", base, tag, sortBy, cursor)
+	var order string
+	if order, err = parseLinkSort(sortBy); err != nil {
+		return
+	}
+	if sortBy == "" {
+		sortBy = LinkSortTime
+	}
+	var after *linkCursor
+	if cursor != "" {
+		var c linkCursor
+		if c, err = decodeLinkCursor(cursor); err != nil {
+			return
+		}
+		if c.sortBy != sortBy {
+			err = fmt.Errorf("%w: it was made for sorting by %s", ErrBadCursor, c.sortBy)
+			return
+		}
+		after = &c
+	}
+	if statusMask == StatusDefault {
+		statusMask = StatusLive
+	}
+	b := base.String()
+	var links []linkCursor
+	err = dht.view(func(tx *buntdb.Tx) error {
+		_, err := _get(tx, b, StatusLive+StatusModified)
+		if err != nil {
+			return err
+		}
+		var e error
+		err = tx.Ascend("link", func(key, value string) bool {
+			x := strings.Split(key, ":")
+			if x[1] != b || x[3] != tag {
+				return true
+			}
+			var status int
+			if status, e = strconv.Atoi(value); e != nil {
+				return false
+			}
+			if status&statusMask == 0 {
+				return true
+			}
+			c := linkCursor{sortBy: sortBy, hash: x[2]}
+			k := linkTimeKey(b, x[2], tag)
+			if order == LinkSortKey {
+				k = linkSortKey(b, x[2], tag)
+			}
+			if v, e := tx.Get(k); e == nil {
+				c.value = v
+			}
+			if after == nil || after.before(c) {
+				links = append(links, c)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
+	if err != nil {
+		return
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].before(links[j]) })
+	if limit > 0 && len(links) > limit {
+		links = links[:limit]
+		next = links[limit-1].encode()
+	}
+	results = make([]TaggedHash, len(links))
+	for i, c := range links {
+		results[i] = TaggedHash{H: c.hash}
+	}
+	return
+}
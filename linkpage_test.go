@@ -0,0 +1,165 @@
+package holochain
+
+import (
+	"encoding/base64"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetLinkPage(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+
+	base, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh6")
+	var id peer.ID
+	dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: base}), "someType", base, id, []byte("some value"), StatusLive)
+
+	start := time.Now()
+	link := func(n int, at time.Duration) string {
+		l := fmt.Sprintf("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkq%02d", n)
+		m := h.node.NewMessage(LINK_REQUEST, LinkReq{})
+		m.Time = start.Add(at)
+		if err := dht.putLink(m, base.String(), l, "tag foo"); err != nil {
+			panic(err)
+		}
+		return l
+	}
+	// made out of hash order so that the pages follow the link times
+	l3 := link(3, time.Second)
+	l1 := link(1, 2*time.Second)
+	l2 := link(2, 3*time.Second)
+	var l4, l5 string
+
+	Convey("links should be paged in the order they were made", t, func() {
+		page, next, err := dht.getLinkPage(base, "tag foo", StatusLive, "", "", 2)
+		So(err, ShouldBeNil)
+		So(len(page), ShouldEqual, 2)
+		So(page[0].H, ShouldEqual, l3)
+		So(page[1].H, ShouldEqual, l1)
+		So(next, ShouldNotEqual, "")
+
+		page, next, err = dht.getLinkPage(base, "tag foo", StatusLive, "", next, 2)
+		So(err, ShouldBeNil)
+		So(len(page), ShouldEqual, 1)
+		So(page[0].H, ShouldEqual, l2)
+		So(next, ShouldEqual, "")
+	})
+
+	Convey("pages should not shift when links arrive", t, func() {
+		_, next, _ := dht.getLinkPage(base, "tag foo", StatusLive, "", "", 2)
+		// one that gossip delivers late and one made after the first page was read
+		l4 = link(4, 0)
+		l5 = link(5, 4*time.Second)
+
+		page, next, err := dht.getLinkPage(base, "tag foo", StatusLive, "", next, 2)
+		So(err, ShouldBeNil)
+		So(len(page), ShouldEqual, 2)
+		So(page[0].H, ShouldEqual, l2)
+		So(page[1].H, ShouldEqual, l5)
+		So(next, ShouldEqual, "")
+	})
+
+	Convey("re-putting a link should not move it", t, func() {
+		link(3, 10*time.Second)
+		page, _, err := dht.getLinkPage(base, "tag foo", StatusLive, "", "", 1)
+		So(err, ShouldBeNil)
+		So(page[0].H, ShouldEqual, l4)
+	})
+
+	Convey("bad cursors should be rejected", t, func() {
+		_, _, err := dht.getLinkPage(base, "tag foo", StatusLive, "", "not a cursor!", 2)
+		So(err, ShouldEqual, ErrBadCursor)
+		_, _, err = dht.getLinkPage(base, "tag foo", StatusLive, "", base64.RawURLEncoding.EncodeToString([]byte("time")), 2)
+		So(err, ShouldEqual, ErrBadCursor)
+	})
+
+	Convey("getLink should take the Limit and Cursor options", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r, err := z.Run(fmt.Sprintf(`var p = getLink("%s","tag foo",{Limit:4}); getLink("%s","tag foo",{Limit:4,Cursor:p.Next}).Links[0].H`, base.String(), base.String()))
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, l5)
+	})
+}
+
+func TestSortedLinks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	base := commit(h, "oddNumbers", "7")
+	var targets []Hash
+	var links []string
+	for i, score := range []string{"10", "9", "100"} {
+		target := commit(h, "profile", fmt.Sprintf(`{"firstName":"Zippy%d","lastName":"Pinhead"}`, i))
+		targets = append(targets, target)
+		links = append(links, fmt.Sprintf(`{"Base":"%s","Link":"%s","Tag":"score","SortKey":"%s"}`, base.String(), target.String(), score))
+	}
+	commit(h, "rating", fmt.Sprintf(`{"Links":[%s]}`, strings.Join(links, ",")))
+
+	hashes := func(r []TaggedHash) (s []string) {
+		for _, th := range r {
+			s = append(s, th.H)
+		}
+		return
+	}
+
+	Convey("links should be sorted numerically by their sort keys", t, func() {
+		r, _, err := h.dht.getLinkPage(base, "score", StatusLive, LinkSortKey, "", 0)
+		So(err, ShouldBeNil)
+		So(hashes(r), ShouldResemble, []string{targets[1].String(), targets[0].String(), targets[2].String()})
+
+		r, _, err = h.dht.getLinkPage(base, "score", StatusLive, "-"+LinkSortKey, "", 0)
+		So(err, ShouldBeNil)
+		So(hashes(r), ShouldResemble, []string{targets[2].String(), targets[0].String(), targets[1].String()})
+	})
+
+	Convey("sorted links should page with cursors for their order", t, func() {
+		r, next, err := h.dht.getLinkPage(base, "score", StatusLive, "-"+LinkSortKey, "", 2)
+		So(err, ShouldBeNil)
+		So(len(r), ShouldEqual, 2)
+		r, next, err = h.dht.getLinkPage(base, "score", StatusLive, "-"+LinkSortKey, next, 2)
+		So(err, ShouldBeNil)
+		So(hashes(r), ShouldResemble, []string{targets[1].String()})
+		So(next, ShouldEqual, "")
+
+		_, next, _ = h.dht.getLinkPage(base, "score", StatusLive, LinkSortKey, "", 2)
+		_, _, err = h.dht.getLinkPage(base, "score", StatusLive, LinkSortTime, next, 2)
+		So(err.Error(), ShouldStartWith, ErrBadCursor.Error())
+		_, _, err = h.dht.getLinkPage(base, "score", StatusLive, "name", "", 2)
+		So(err, ShouldEqual, ErrBadLinkSort)
+	})
+
+	Convey("getLink should take the SortBy option", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r, err := z.Run(fmt.Sprintf(`getLink("%s","score",{SortBy:"-key"}).Links[0].H`, base.String()))
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, targets[2].String())
+	})
+
+	Convey("sort keys should be limited in size", t, func() {
+		_, def, _ := h.GetEntryDef("rating")
+		key := strings.Repeat("x", MaxLinkSortKeySize+1)
+		err := sysValidateEntry(h, def, &GobEntry{C: fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"score","SortKey":"%s"}]}`, base.String(), targets[0].String(), key)})
+		So(err, ShouldEqual, ErrLinkSortKeyTooLong)
+	})
+}
+
+func TestCompareLinkValues(t *testing.T) {
+	Convey("mixed numbers and strings should have a total order with numbers first", t, func() {
+		values := []string{"b", "10", "NaN", "a", "9.5", "-1", "1e3"}
+		sort.Slice(values, func(i, j int) bool { return compareLinkValues(values[i], values[j]) < 0 })
+		So(values, ShouldResemble, []string{"-1", "9.5", "10", "1e3", "NaN", "a", "b"})
+
+		So(compareLinkValues("1", "a"), ShouldEqual, -1)
+		So(compareLinkValues("a", "1"), ShouldEqual, 1)
+		So(compareLinkValues("1.0", "1"), ShouldNotEqual, 0)
+	})
+}
@@ -13,9 +13,41 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
+// DefaultLogRecords is how many of the most recent log lines a holochain keeps
+const DefaultLogRecords = 1000
+
+// levels of log records, from least to most severe
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+var logLevels = map[string]int{LogLevelDebug: 0, LogLevelInfo: 1, LogLevelWarn: 2, LogLevelError: 3}
+
+// LogLevelAtLeast reports whether level is at least as severe as min
+func LogLevelAtLeast(level string, min string) bool {
+	return logLevels[level] >= logLevels[min]
+}
+
+// logLevel returns the level of a message, which is warn or error if the message says
+// so and otherwise the level of the logger it was logged to
+func logLevel(m string, level string) string {
+	m = strings.ToLower(m)
+	switch {
+	case strings.HasPrefix(m, "warning"):
+		return LogLevelWarn
+	case strings.HasPrefix(m, "error"):
+		return LogLevelError
+	}
+	return level
+}
+
 // Logger holds logger configuration
 type Logger struct {
 	Enabled bool
@@ -24,6 +56,85 @@ type Logger struct {
 	tf      string
 	color   *color.Color
 	w       io.Writer
+
+	recorder  *LogRecorder
+	subsystem string
+	level     string
+}
+
+// LogRecord is a line logged by one of the loggers of a holochain
+type LogRecord struct {
+	Time      time.Time
+	Subsystem string
+	Level     string
+	Message   string
+}
+
+// LogRecorder keeps the most recent lines logged so they can be inspected later, and
+// passes them on to any subscribers as they are logged
+type LogRecorder struct {
+	lk      sync.RWMutex
+	records []LogRecord
+	next    int
+	full    bool
+	subs    map[chan LogRecord]bool
+}
+
+// NewLogRecorder returns a recorder that keeps the last size records
+func NewLogRecorder(size int) *LogRecorder {
+	return &LogRecorder{records: make([]LogRecord, size)}
+}
+
+func (r *LogRecorder) record(rec LogRecord) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.records[r.next] = rec
+	r.next++
+	if r.next == len(r.records) {
+		r.next = 0
+		r.full = true
+	}
+	for c := range r.subs {
+		// slow subscribers miss records rather than hold up logging
+		select {
+		case c <- rec:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives records as they are logged until it
+// is unsubscribed
+func (r *LogRecorder) Subscribe() chan LogRecord {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if r.subs == nil {
+		r.subs = make(map[chan LogRecord]bool)
+	}
+	c := make(chan LogRecord, 100)
+	r.subs[c] = true
+	return c
+}
+
+// Unsubscribe stops records being sent to a channel returned by Subscribe
+func (r *LogRecorder) Unsubscribe(c chan LogRecord) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	delete(r.subs, c)
+}
+
+// Recent returns up to the last n records, oldest first, or all the records if n <= 0
+func (r *LogRecorder) Recent(n int) (records []LogRecord) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	if r.full {
+		records = append(records, r.records[r.next:]...)
+	}
+	records = append(records, r.records[:r.next]...)
+	if n > 0 && len(records) > n {
+		records = records[len(records)-n:]
+	}
+	return
 }
 
 func (l *Logger) setupColor(f string) (colorResult *color.Color, result string) {
@@ -102,6 +213,14 @@ func (l *Logger) New(w io.Writer) (err error) {
 	return
 }
 
+// SetRecorder sets the recorder that lines logged while the logger is enabled are also
+// kept in, tagged with the subsystem they came from and by default the given level
+func (l *Logger) SetRecorder(r *LogRecorder, subsystem string, level string) {
+	l.recorder = r
+	l.subsystem = subsystem
+	l.level = level
+}
+
 func (l *Logger) parse(m string) (output string) {
 	var t *time.Time
 	if l.tf != "" {
@@ -132,6 +251,10 @@ func (l *Logger) pf(m string, args ...interface{}) {
 		} else {
 			fmt.Fprintf(l.w, f+"\n", args...)
 		}
+		if l.recorder != nil {
+			msg := fmt.Sprintf(m, args...)
+			l.recorder.record(LogRecord{Time: time.Now(), Subsystem: l.subsystem, Level: logLevel(msg, l.level), Message: msg})
+		}
 	}
 }
 
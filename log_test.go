@@ -72,3 +72,71 @@ func TestNewLog(t *testing.T) {
 		So(l._parse("fish", &now), ShouldEqual, now.Format(time.Stamp)+":fish")
 	})
 }
+
+func TestLogRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewLogRecorder(3)
+	l := Logger{Enabled: true}
+	l.New(&buf)
+	l.SetRecorder(r, "app", LogLevelInfo)
+
+	Convey("it should record the lines logged", t, func() {
+		l.Logf("%d fish", 1)
+		l.Log("cow")
+		recs := r.Recent(0)
+		So(len(recs), ShouldEqual, 2)
+		So(recs[0].Message, ShouldEqual, "1 fish")
+		So(recs[0].Subsystem, ShouldEqual, "app")
+		So(recs[1].Message, ShouldEqual, "cow")
+	})
+
+	Convey("it should keep only the most recent lines", t, func() {
+		l.Log("dog")
+		l.Log("cat")
+		recs := r.Recent(0)
+		So(len(recs), ShouldEqual, 3)
+		So(recs[0].Message, ShouldEqual, "cow")
+		So(recs[2].Message, ShouldEqual, "cat")
+		recs = r.Recent(1)
+		So(len(recs), ShouldEqual, 1)
+		So(recs[0].Message, ShouldEqual, "cat")
+	})
+
+	Convey("it should not record when disabled", t, func() {
+		l.Enabled = false
+		l.Log("bird")
+		So(r.Recent(1)[0].Message, ShouldEqual, "cat")
+	})
+}
+
+func TestLogLevels(t *testing.T) {
+	Convey("it should compare levels", t, func() {
+		So(LogLevelAtLeast(LogLevelWarn, LogLevelInfo), ShouldBeTrue)
+		So(LogLevelAtLeast(LogLevelInfo, LogLevelInfo), ShouldBeTrue)
+		So(LogLevelAtLeast(LogLevelDebug, LogLevelInfo), ShouldBeFalse)
+		So(LogLevelAtLeast(LogLevelDebug, ""), ShouldBeTrue)
+	})
+
+	Convey("it should get the level of a message", t, func() {
+		So(logLevel("warning: get() ignoring unknown option", LogLevelInfo), ShouldEqual, LogLevelWarn)
+		So(logLevel("Error: bad thing", LogLevelDebug), ShouldEqual, LogLevelError)
+		So(logLevel("put foo", LogLevelDebug), ShouldEqual, LogLevelDebug)
+	})
+
+	Convey("it should send records to subscribers", t, func() {
+		var buf bytes.Buffer
+		r := NewLogRecorder(3)
+		l := Logger{Enabled: true}
+		l.New(&buf)
+		l.SetRecorder(r, "dht", LogLevelDebug)
+		c := r.Subscribe()
+		l.Log("warning: fish")
+		rec := <-c
+		So(rec.Message, ShouldEqual, "warning: fish")
+		So(rec.Level, ShouldEqual, LogLevelWarn)
+		So(rec.Subsystem, ShouldEqual, "dht")
+		r.Unsubscribe(c)
+		l.Log("cow")
+		So(len(c), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// messages implements tracking the delivery of app messages sent in the background
+
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	MessageQueued    = "queued"
+	MessageDelivered = "delivered"
+	MessageProcessed = "processed"
+	MessageFailed    = "failed"
+)
+
+// The status of a message is kept until it has been finished for MessageStatusTTL, and
+// at most MaxTrackedMessages statuses are kept, forgetting the oldest first
+var MessageStatusTTL = time.Hour
+var MaxTrackedMessages = 10000
+
+var ErrMessageNotFound = errors.New("message not found")
+
+// MessageStatus holds the delivery status of an app message sent in the background
+type MessageStatus struct {
+	ID        string
+	Zome      string
+	To        string // B58 node id of the recipient
+	Status    string
+	Response  string `json:",omitempty"` // the recipient's reply once processed
+	Error     string `json:",omitempty"`
+	Queued    time.Time
+	Delivered time.Time
+	Finished  time.Time
+}
+
+// MessageTracker sends app messages in the background and records their status
+type MessageTracker struct {
+	h     *Holochain
+	lk    sync.RWMutex
+	msgs  map[string]*MessageStatus
+	order []string // ids of the tracked messages, oldest first
+	count int
+}
+
+// NewMessageTracker returns a MessageTracker for the holochain
+func NewMessageTracker(h *Holochain) *MessageTracker {
+	t := MessageTracker{
+		h:    h,
+		msgs: make(map[string]*MessageStatus),
+	}
+	return &t
+}
+
+// Messages returns the holochain's tracker of messages sent in the background
+func (h *Holochain) Messages() *MessageTracker {
+	return h.messages
+}
+
+// Send queues msg to be sent to the given node and returns the id under which its
+// status is tracked
+func (t *MessageTracker) Send(to peer.ID, msg AppMsg) (id string) {
+	t.lk.Lock()
+	t.count++
+	id = strconv.Itoa(t.count)
+	m := &MessageStatus{ID: id, Zome: msg.ZomeType, To: peer.IDB58Encode(to), Status: MessageQueued, Queued: time.Now()}
+	t.msgs[id] = m
+	t.order = append(t.order, id)
+	t.expire(m.Queued)
+	t.lk.Unlock()
+	t.notify(m)
+
+	go t.run(m, to, msg)
+	return
+}
+
+// Get returns a copy of the status of the message with the given id
+func (t *MessageTracker) Get(id string) (status MessageStatus, err error) {
+	t.lk.RLock()
+	defer t.lk.RUnlock()
+	m, ok := t.msgs[id]
+	if !ok {
+		err = ErrMessageNotFound
+		return
+	}
+	status = *m
+	return
+}
+
+// expire forgets the oldest messages while there are too many or they have been
+// finished for longer than MessageStatusTTL. The caller must hold the lock.
+func (t *MessageTracker) expire(now time.Time) {
+	n := 0
+	for ; n < len(t.order); n++ {
+		m := t.msgs[t.order[n]]
+		old := !m.Finished.IsZero() && now.Sub(m.Finished) > MessageStatusTTL
+		if len(t.order)-n <= MaxTrackedMessages && !old {
+			break
+		}
+		delete(t.msgs, m.ID)
+	}
+	t.order = t.order[n:]
+}
+
+func (t *MessageTracker) run(m *MessageStatus, to peer.ID, msg AppMsg) {
+	r, err := t.h.send(ActionProtocol, to, APP_MESSAGE, msg, func() {
+		t.lk.Lock()
+		m.Status = MessageDelivered
+		m.Delivered = time.Now()
+		t.lk.Unlock()
+		t.notify(m)
+	})
+
+	var body string
+	if err == nil {
+		body, err = t.h.openAppMsg(r.(AppMsg))
+	}
+
+	t.lk.Lock()
+	m.Finished = time.Now()
+	if err != nil {
+		m.Status = MessageFailed
+		m.Error = err.Error()
+	} else {
+		m.Status = MessageProcessed
+		m.Response = body
+	}
+	t.lk.Unlock()
+	t.notify(m)
+}
+
+// notify runs the HookOnMessageStatus hooks with a copy of the message's status
+func (t *MessageTracker) notify(m *MessageStatus) {
+	t.lk.RLock()
+	status := *m
+	t.lk.RUnlock()
+	ctx := HookContext{Point: HookOnMessageStatus, Zome: status.Zome, Agent: status.To, Message: &status, Start: time.Now()}
+	if err := t.h.runHooks(&ctx); err != nil {
+		t.h.config.Loggers.App.Logf("message %s status hook failed: %v", status.ID, err)
+	}
+}
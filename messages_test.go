@@ -0,0 +1,103 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func waitForMessage(h *Holochain, id string) (status MessageStatus) {
+	for i := 0; i < 100; i++ {
+		status, _ = h.Messages().Get(id)
+		if status.Status == MessageProcessed || status.Status == MessageFailed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return
+}
+
+func TestMessageTracker(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	statuses := make(chan string, 100)
+	h.AddHook(HookOnMessageStatus, func(ctx *HookContext) error {
+		statuses <- ctx.Message.Status
+		return nil
+	})
+
+	Convey("unknown messages should not be found", t, func() {
+		_, err := h.Messages().Get("foo")
+		So(err, ShouldEqual, ErrMessageNotFound)
+	})
+
+	Convey("messages sent in the background should be tracked until processed", t, func() {
+		id := h.Messages().Send(h.nodeID, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		m := waitForMessage(h, id)
+		So(m.ID, ShouldEqual, id)
+		So(m.Zome, ShouldEqual, "jsSampleZome")
+		So(m.To, ShouldEqual, h.nodeIDStr)
+		So(m.Status, ShouldEqual, MessageProcessed)
+		So(m.Response, ShouldEqual, `{"pong":"foobar"}`)
+		So(m.Delivered.Before(m.Queued), ShouldBeFalse)
+		So(m.Finished.Before(m.Delivered), ShouldBeFalse)
+		So(<-statuses, ShouldEqual, MessageQueued)
+		So(<-statuses, ShouldEqual, MessageDelivered)
+		So(<-statuses, ShouldEqual, MessageProcessed)
+	})
+
+	Convey("messages that fail should record the error", t, func() {
+		id := h.Messages().Send(h.nodeID, AppMsg{ZomeType: "fooZome", Body: `{}`})
+		m := waitForMessage(h, id)
+		So(m.Status, ShouldEqual, MessageFailed)
+		So(m.Error, ShouldEqual, "unknown zome: fooZome")
+		So(<-statuses, ShouldEqual, MessageQueued)
+		So(<-statuses, ShouldEqual, MessageDelivered)
+		So(<-statuses, ShouldEqual, MessageFailed)
+	})
+
+	Convey("send with the Async option should return a message id", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = z.Run(`var id = send(App.Key.Hash,{ping:"async"},{Async:true}); id`)
+		So(err, ShouldBeNil)
+		m := waitForMessage(h, z.(*JSRibosome).lastResult.String())
+		So(m.Response, ShouldEqual, `{"pong":"async"}`)
+		_, err = z.Run(`getMessageStatus(id).Status`)
+		So(err, ShouldBeNil)
+		So(z.(*JSRibosome).lastResult.String(), ShouldEqual, MessageProcessed)
+	})
+}
+
+func TestMessageTrackerExpire(t *testing.T) {
+	tr := NewMessageTracker(nil)
+	now := time.Now()
+	add := func(id string, finished time.Time) {
+		tr.msgs[id] = &MessageStatus{ID: id, Finished: finished}
+		tr.order = append(tr.order, id)
+	}
+
+	Convey("statuses finished longer ago than the TTL should be forgotten", t, func() {
+		add("1", now.Add(-2*MessageStatusTTL))
+		add("2", time.Time{})
+		add("3", now.Add(-2*MessageStatusTTL))
+		tr.expire(now)
+		_, err := tr.Get("1")
+		So(err, ShouldEqual, ErrMessageNotFound)
+		_, err = tr.Get("2")
+		So(err, ShouldBeNil)
+		So(len(tr.msgs), ShouldEqual, 2)
+	})
+
+	Convey("the oldest statuses should be forgotten when there are too many", t, func() {
+		old := MaxTrackedMessages
+		MaxTrackedMessages = 1
+		defer func() { MaxTrackedMessages = old }()
+		add("4", time.Time{})
+		tr.expire(now)
+		So(len(tr.msgs), ShouldEqual, 1)
+		_, err := tr.Get("4")
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// metrics implements keeping a history of snapshots of the DHT's state, so that
+// operators can follow how it converges over days rather than just see how it is now.
+// The snapshots are kept in the DHT's database, so the history survives restarts.
+
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsInterval is how often a snapshot of the DHT's metrics is recorded, 0 for never
+var MetricsInterval = 10 * time.Minute
+
+// MaxMetricsSnapshots is how many snapshots are kept, the oldest being dropped for new
+// ones, which at the default interval is a week of them
+var MaxMetricsSnapshots = 1008
+
+const metricsPrefix = "metrics:"
+
+// MetricsSnapshot is the state of the DHT at a moment
+type MetricsSnapshot struct {
+	Time      time.Time
+	Idx       int   // the put index
+	Gossipers int   // the nodes in the gossip table, not counting forked ones
+	Forks     int   // the nodes found running a different DNA
+	Neighbors int   // the nodes in our neighborhood when sharding
+	Bytes     int64 // the bytes of entry data held
+	// Resilience estimates how many nodes hold each hash we hold, from the nodes we
+	// know of and the ResilienceFactor
+	Resilience int
+}
+
+// snapshotMetrics returns the DHT's metrics now
+func (dht *DHT) snapshotMetrics(now time.Time) (s MetricsSnapshot, err error) {
+	s.Time = now
+	if s.Idx, err = dht.GetIdx(); err != nil {
+		return
+	}
+	var peers []peer.ID
+	if peers, err = dht.unforkedGossipers(); err != nil {
+		return
+	}
+	s.Gossipers = len(peers)
+	dht.forksLk.Lock()
+	s.Forks = len(dht.forks)
+	dht.forksLk.Unlock()
+	var neighbors []peer.ID
+	if neighbors, err = dht.neighbors(); err != nil {
+		return
+	}
+	s.Neighbors = len(neighbors)
+	s.Bytes = atomic.LoadInt64(&dht.storedBytes)
+	s.Resilience = s.Gossipers + 1
+	if r := dht.resilienceFactor(); r > 0 && r < s.Resilience {
+		s.Resilience = r
+	}
+	return
+}
+
+// recordMetrics stores a snapshot of the DHT's metrics, dropping the oldest ones beyond
+// MaxMetricsSnapshots
+func (dht *DHT) recordMetrics(now time.Time) (s MetricsSnapshot, err error) {
+	if s, err = dht.snapshotMetrics(now); err != nil {
+		return
+	}
+	var b []byte
+	if b, err = json.Marshal(s); err != nil {
+		return
+	}
+	err = dht.update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(fmt.Sprintf("%s%020d", metricsPrefix, now.UnixNano()), string(b), nil)
+		if err != nil {
+			return err
+		}
+		var keys []string
+		err = tx.AscendKeys(metricsPrefix+"*", func(key, value string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(keys)-MaxMetricsSnapshots; i++ {
+			if _, err = tx.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// MetricsHistory returns the recorded snapshots of the DHT's metrics taken since the
+// given time, oldest first
+func (dht *DHT) MetricsHistory(since time.Time) (history []MetricsSnapshot, err error) {
+	history = []MetricsSnapshot{}
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		err := tx.AscendKeys(metricsPrefix+"*", func(key, value string) bool {
+			var s MetricsSnapshot
+			if e = json.Unmarshal([]byte(value), &s); e != nil {
+				return false
+			}
+			if !s.Time.Before(since) {
+				history = append(history, s)
+			}
+			return true
+		})
+		if err == nil {
+			err = e
+		}
+		return err
+	})
+	return
+}
+
+// keepMetrics records a snapshot of the DHT's metrics every interval until stop is
+// closed
+func (dht *DHT) keepMetrics(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if _, err := dht.recordMetrics(now); err != nil {
+				dht.dlog.Logf("error recording metrics: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestMetricsHistory(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+
+	Convey("a snapshot should capture the state of the DHT", t, func() {
+		s, err := dht.snapshotMetrics(time.Now())
+		So(err, ShouldBeNil)
+		idx, _ := dht.GetIdx()
+		So(s.Idx, ShouldEqual, idx)
+		So(s.Gossipers, ShouldEqual, 0)
+		So(s.Resilience, ShouldEqual, 1)
+		So(s.Bytes, ShouldBeGreaterThan, 0)
+
+		id, _ := makePeer("metrics_peer")
+		So(dht.UpdateGossiper(id, 0), ShouldBeNil)
+		s, err = dht.snapshotMetrics(time.Now())
+		So(err, ShouldBeNil)
+		So(s.Gossipers, ShouldEqual, 1)
+		So(s.Resilience, ShouldEqual, 2)
+	})
+
+	Convey("snapshots should be kept oldest first up to the maximum", t, func() {
+		max := MaxMetricsSnapshots
+		MaxMetricsSnapshots = 3
+		defer func() { MaxMetricsSnapshots = max }()
+		start := time.Now().Add(-time.Hour)
+		for i := 0; i < 5; i++ {
+			_, err := dht.recordMetrics(start.Add(time.Duration(i) * time.Minute))
+			So(err, ShouldBeNil)
+		}
+		history, err := dht.MetricsHistory(time.Time{})
+		So(err, ShouldBeNil)
+		So(len(history), ShouldEqual, 3)
+		So(history[0].Time.Equal(start.Add(2*time.Minute)), ShouldBeTrue)
+		So(history[2].Time.Equal(start.Add(4*time.Minute)), ShouldBeTrue)
+
+		history, err = dht.MetricsHistory(start.Add(3 * time.Minute))
+		So(err, ShouldBeNil)
+		So(len(history), ShouldEqual, 2)
+	})
+}
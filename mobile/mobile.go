@@ -0,0 +1,274 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// Package mobile is a thin binding layer for embedding holochain nodes in apps written
+// in other languages.  Its functions only take and return strings, byte slices, errors
+// and a callback interface so that it can be bound with gomobile for iOS and Android,
+// or wrapped with cgo exports for a c-shared build.  Holochains are named by the name
+// they were installed under, and results and events are passed as JSON.
+package mobile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	holo "github.com/metacurrency/holochain"
+	"sync"
+	"time"
+)
+
+// kinds of event passed to callbacks
+const (
+	EventCall          = "call"          // a zome function returned
+	EventCommit        = "commit"        // an entry is about to be committed
+	EventMessageStatus = "messageStatus" // a message sent in the background changed status
+)
+
+var ErrNotInitialized = errors.New("mobile: Init has not been called")
+
+// Callback receives the events of the running holochains
+type Callback interface {
+	OnEvent(name string, kind string, data string)
+}
+
+var lk sync.Mutex
+var daemon *holo.Daemon
+var running = make(map[string]bool)
+var callbacks []Callback
+
+// Init sets up the service in the directory root, making it and an agent called agent
+// if it doesn't exist yet.  It must be called before anything else.
+func Init(root string, agent string) (err error) {
+	lk.Lock()
+	defer lk.Unlock()
+	holo.InitializeHolochain()
+	var s *holo.Service
+	if holo.IsInitialized(root) {
+		s, err = holo.LoadService(root)
+	} else {
+		s, err = holo.Init(root, holo.AgentName(agent))
+	}
+	if err != nil {
+		return
+	}
+	daemon = holo.NewDaemon(s)
+	daemon.Prepare = addHooks
+	return
+}
+
+func getDaemon() (d *holo.Daemon, err error) {
+	lk.Lock()
+	defer lk.Unlock()
+	if daemon == nil {
+		err = ErrNotInitialized
+		return
+	}
+	d = daemon
+	return
+}
+
+func getInstance(name string) (h *holo.Holochain, err error) {
+	var d *holo.Daemon
+	if d, err = getDaemon(); err != nil {
+		return
+	}
+	if h = d.Instance(name); h == nil {
+		err = holo.ErrInstanceNotRunning
+	}
+	return
+}
+
+// Install joins the app whose DNA is in the directory dnaPath under the given name
+func Install(name string, dnaPath string) (err error) {
+	var d *holo.Daemon
+	if d, err = getDaemon(); err != nil {
+		return
+	}
+	err = d.Install(name, dnaPath)
+	return
+}
+
+// Start starts the installed holochain called name
+func Start(name string) (err error) {
+	var d *holo.Daemon
+	if d, err = getDaemon(); err != nil {
+		return
+	}
+	if err = d.StartInstance(name); err != nil {
+		return
+	}
+	lk.Lock()
+	running[name] = true
+	lk.Unlock()
+	return
+}
+
+// Stop stops the running holochain called name
+func Stop(name string) (err error) {
+	var d *holo.Daemon
+	if d, err = getDaemon(); err != nil {
+		return
+	}
+	lk.Lock()
+	delete(running, name)
+	lk.Unlock()
+	err = d.StopInstance(name)
+	return
+}
+
+// Call calls a zome function of the running holochain called name, returning its
+// result as it is if it's a string and as JSON otherwise
+func Call(name string, zome string, function string, args string) (result string, err error) {
+	var h *holo.Holochain
+	if h, err = getInstance(name); err != nil {
+		return
+	}
+	var r interface{}
+	if r, err = h.Call(zome, function, args, holo.ZOME_EXPOSURE); err != nil {
+		return
+	}
+	result, err = toJSON(r)
+	return
+}
+
+// Export returns a zip archive of the agent's entries in the running holochain
+// called name
+func Export(name string) (archive []byte, err error) {
+	var h *holo.Holochain
+	if h, err = getInstance(name); err != nil {
+		return
+	}
+	var b bytes.Buffer
+	if err = h.ExportData(&b); err != nil {
+		return
+	}
+	archive = b.Bytes()
+	return
+}
+
+// Subscribe has cb called with the events of every running holochain
+func Subscribe(cb Callback) {
+	lk.Lock()
+	defer lk.Unlock()
+	callbacks = append(callbacks, cb)
+}
+
+// Background suspends the background work of every running holochain, for when the
+// embedding app goes into the background
+func Background() {
+	for _, h := range instances() {
+		h.Suspend()
+	}
+}
+
+// Foreground resumes the background work of every running holochain and catches up
+// on what was missed
+func Foreground() (err error) {
+	for _, h := range instances() {
+		if e := h.Resume(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// SetPowerProfile sets the power profile of the running holochain called name
+func SetPowerProfile(name string, profile string) (err error) {
+	var h *holo.Holochain
+	if h, err = getInstance(name); err != nil {
+		return
+	}
+	err = h.SetPowerProfile(profile)
+	return
+}
+
+// Close stops every running holochain
+func Close() (err error) {
+	lk.Lock()
+	var names []string
+	for name := range running {
+		names = append(names, name)
+	}
+	lk.Unlock()
+	for _, name := range names {
+		if e := Stop(name); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+func instances() (hs []*holo.Holochain) {
+	d, err := getDaemon()
+	if err != nil {
+		return
+	}
+	lk.Lock()
+	defer lk.Unlock()
+	for name := range running {
+		if h := d.Instance(name); h != nil {
+			hs = append(hs, h)
+		}
+	}
+	return
+}
+
+// addHooks passes the events of a holochain on to the callbacks
+func addHooks(name string, h *holo.Holochain) {
+	h.AddHook(holo.HookAfterCall, func(ctx *holo.HookContext) error {
+		e := struct {
+			Zome     string
+			Function string
+			Duration time.Duration
+			Error    string `json:",omitempty"`
+		}{Zome: ctx.Zome, Function: ctx.Function, Duration: ctx.Duration}
+		if ctx.Err != nil {
+			e.Error = ctx.Err.Error()
+		}
+		emit(name, EventCall, e)
+		return nil
+	})
+	h.AddHook(holo.HookOnCommit, func(ctx *holo.HookContext) error {
+		e := struct {
+			EntryType string
+			Entry     interface{}
+		}{EntryType: ctx.EntryType}
+		if ctx.Entry != nil {
+			e.Entry = ctx.Entry.Content()
+		}
+		emit(name, EventCommit, e)
+		return nil
+	})
+	h.AddHook(holo.HookOnMessageStatus, func(ctx *holo.HookContext) error {
+		emit(name, EventMessageStatus, ctx.Message)
+		return nil
+	})
+}
+
+func emit(name string, kind string, v interface{}) {
+	data, err := toJSON(v)
+	if err != nil {
+		holo.Infof("mobile: can't encode %s event: %v", kind, err)
+		return
+	}
+	lk.Lock()
+	cbs := callbacks
+	lk.Unlock()
+	for _, cb := range cbs {
+		cb.OnEvent(name, kind, data)
+	}
+}
+
+func toJSON(v interface{}) (s string, err error) {
+	if str, ok := v.(string); ok {
+		s = str
+		return
+	}
+	var b []byte
+	if b, err = json.Marshal(v); err != nil {
+		return
+	}
+	s = string(b)
+	return
+}
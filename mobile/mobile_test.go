@@ -0,0 +1,76 @@
+package mobile
+
+import (
+	"archive/zip"
+	"bytes"
+	holo "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testCallback struct {
+	lk     sync.Mutex
+	events []string
+}
+
+func (c *testCallback) OnEvent(name string, kind string, data string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.events = append(c.events, name+" "+kind+" "+data)
+}
+
+func TestMobile(t *testing.T) {
+	d := holo.SetupTestDir()
+	defer holo.CleanupTestDir(d)
+	s, err := holo.Init(filepath.Join(d, "dev"), holo.AgentName("dev"))
+	if err != nil {
+		panic(err)
+	}
+	app := filepath.Join(s.Path, "app")
+	h, err := s.GenDev(app, "toml")
+	if err != nil {
+		panic(err)
+	}
+	// free the dev chain's port for the instance
+	h.Close()
+
+	Convey("nothing should work before Init", t, func() {
+		So(Start("app"), ShouldEqual, ErrNotInitialized)
+	})
+
+	Convey("apps should be installed, started and called", t, func() {
+		So(Init(filepath.Join(d, "mobile"), "mobile"), ShouldBeNil)
+		So(Install("app", app), ShouldBeNil)
+		cb := &testCallback{}
+		Subscribe(cb)
+		So(Start("app"), ShouldBeNil)
+		defer Close()
+
+		result, err := Call("app", "jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "result: foo")
+
+		_, err = Call("app", "jsSampleZome", "addOdd", "7")
+		So(err, ShouldBeNil)
+		events := strings.Join(cb.events, "\n")
+		So(events, ShouldContainSubstring, `app call {"Zome":"jsSampleZome","Function":"testStrFn1"`)
+		So(events, ShouldContainSubstring, `app commit {"EntryType":"oddNumbers","Entry":"7"}`)
+
+		archive, err := Export("app")
+		So(err, ShouldBeNil)
+		_, err = zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		So(err, ShouldBeNil)
+
+		Background()
+		So(Foreground(), ShouldBeNil)
+		So(SetPowerProfile("app", holo.PowerProfileLow), ShouldBeNil)
+	})
+
+	Convey("calls to holochains that aren't running should fail", t, func() {
+		_, err := Call("app", "jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldEqual, holo.ErrInstanceNotRunning)
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// neighborhood implements sharding the DHT by the DNA's ResilienceFactor.  Hashes and
+// node IDs are placed in one keyspace by hashing them with sha256, and the nodes that
+// hold a hash are the ResilienceFactor nodes nearest to it by XOR distance there.
+
+package holochain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"sort"
+)
+
+// keyspaceLoc returns where a hash or node ID falls in the DHT's keyspace
+func keyspaceLoc(b []byte) []byte {
+	loc := sha256.Sum256(b)
+	return loc[:]
+}
+
+// keyspaceDistance returns the XOR distance between two keyspace locations
+func keyspaceDistance(a []byte, b []byte) []byte {
+	d := make([]byte, len(a))
+	for i := range a {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// resilienceFactor returns the number of nodes that hold each hash, 0 for all of them
+func (dht *DHT) resilienceFactor() int {
+	return dht.h.nucleus.dna.DHTConfig.ResilienceFactor
+}
+
+// sortByDistance sorts ids by their distance from the location of key, nearest first
+func sortByDistance(key []byte, ids []peer.ID) {
+	loc := keyspaceLoc(key)
+	dists := make(map[peer.ID][]byte, len(ids))
+	for _, id := range ids {
+		dists[id] = keyspaceDistance(loc, keyspaceLoc([]byte(id)))
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return bytes.Compare(dists[ids[i]], dists[ids[j]]) < 0 })
+}
+
+// nearestNodes returns up to n of the nodes we know, including ourselves, nearest to the
+// key, all of them if n is 0
+func (dht *DHT) nearestNodes(key []byte, n int) (nodes []peer.ID, err error) {
+	var peers []peer.ID
+	if peers, err = dht.unforkedGossipers(); err != nil {
+		return
+	}
+	nodes = append([]peer.ID{dht.h.nodeID}, peers...)
+	sortByDistance(key, nodes)
+	if n > 0 && len(nodes) > n {
+		nodes = nodes[:n]
+	}
+	return
+}
+
+// holdsHash returns true if the hash is in our neighborhood, so that we should hold it.
+// Without sharding every node holds every hash.
+func (dht *DHT) holdsHash(key Hash) bool {
+	return dht.resilienceFactor() <= 0 || dht.isHolder(key, dht.h.nodeID)
+}
+
+// isHolder returns true if the node is one of the nearest nodes we know to the hash.
+// Without sharding there are no neighborhoods, so no node is a holder by its place.
+func (dht *DHT) isHolder(key Hash, id peer.ID) bool {
+	r := dht.resilienceFactor()
+	if r <= 0 {
+		return false
+	}
+	nodes, err := dht.nearestNodes(key.H, r)
+	if err != nil {
+		return true
+	}
+	for _, n := range nodes {
+		if n == id {
+			return true
+		}
+	}
+	return false
+}
+
+// neighbors returns the peers in our own neighborhood, which hold the same hashes as us
+// and so are the ones to gossip with when sharding, or nil without sharding
+func (dht *DHT) neighbors() (peers []peer.ID, err error) {
+	r := dht.resilienceFactor()
+	if r <= 0 {
+		return
+	}
+	var nodes []peer.ID
+	if nodes, err = dht.nearestNodes([]byte(dht.h.nodeID), r+1); err != nil {
+		return
+	}
+	for _, id := range nodes {
+		if id != dht.h.nodeID {
+			peers = append(peers, id)
+		}
+	}
+	return
+}
+
+// messageKey returns the hash whose neighborhood a DHT changing message is for
+func messageKey(m *Message) (key Hash, ok bool) {
+	ok = true
+	switch t := m.Body.(type) {
+	case PutReq:
+		key = t.H
+	case DelReq:
+		key = t.H
+	case ModReq:
+		key = t.H
+	case LinkReq:
+		key = t.Base
+	case DelLinkReq:
+		key = t.Base
+	case ReceiptReq:
+		key = t.H
+	default:
+		ok = false
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package holochain
+
+import (
+	"bytes"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestKeyspaceDistance(t *testing.T) {
+	Convey("distance should be the XOR of keyspace locations", t, func() {
+		a := keyspaceLoc([]byte("a"))
+		b := keyspaceLoc([]byte("b"))
+		So(len(a), ShouldEqual, 32)
+		So(keyspaceDistance(a, a), ShouldResemble, make([]byte, 32))
+		So(keyspaceDistance(a, b), ShouldResemble, keyspaceDistance(b, a))
+	})
+}
+
+func TestNeighborhood(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+
+	Convey("without sharding we should hold everything", t, func() {
+		So(dht.resilienceFactor(), ShouldEqual, 0)
+		So(dht.holdsHash(hash), ShouldBeTrue)
+		peers, err := dht.neighbors()
+		So(err, ShouldBeNil)
+		So(peers, ShouldBeNil)
+	})
+
+	var ids []peer.ID
+	for _, name := range []string{"peer_a", "peer_b", "peer_c", "peer_d"} {
+		id, _ := makePeer(name)
+		dht.UpdateGossiper(id, 0)
+		ids = append(ids, id)
+	}
+
+	Convey("nodes should be found in order of their distance from a hash", t, func() {
+		nodes, err := dht.nearestNodes(hash.H, 0)
+		So(err, ShouldBeNil)
+		So(len(nodes), ShouldEqual, 5)
+		loc := keyspaceLoc(hash.H)
+		for i := 1; i < len(nodes); i++ {
+			prev := keyspaceDistance(loc, keyspaceLoc([]byte(nodes[i-1])))
+			next := keyspaceDistance(loc, keyspaceLoc([]byte(nodes[i])))
+			So(bytes.Compare(prev, next), ShouldBeLessThan, 0)
+		}
+		near, err := dht.nearestNodes(hash.H, 2)
+		So(err, ShouldBeNil)
+		So(near, ShouldResemble, nodes[:2])
+	})
+
+	Convey("with sharding we should hold just the hashes in our neighborhood", t, func() {
+		h.nucleus.dna.DHTConfig.ResilienceFactor = 2
+		defer func() { h.nucleus.dna.DHTConfig.ResilienceFactor = 0 }()
+		nodes, _ := dht.nearestNodes(hash.H, 2)
+		held := nodes[0] == h.nodeID || nodes[1] == h.nodeID
+		So(dht.holdsHash(hash), ShouldEqual, held)
+
+		n, err := dht.FindNodeForHash(hash)
+		So(err, ShouldBeNil)
+		So(n.HashAddr, ShouldEqual, nodes[0])
+
+		peers, err := dht.neighbors()
+		So(err, ShouldBeNil)
+		So(len(peers), ShouldEqual, 2)
+		g, err := dht.FindGossiper()
+		So(err, ShouldBeNil)
+		So(g == peers[0] || g == peers[1], ShouldBeTrue)
+
+		// we always hold the hash of our own ID
+		So(dht.holdsHash(Hash{H: []byte(h.nodeID)}), ShouldBeTrue)
+	})
+
+	Convey("the resilience factor can't be negative", t, func() {
+		dna := *h.nucleus.dna
+		dna.DHTConfig.ResilienceFactor = -1
+		So(dna.check(), ShouldEqual, ErrNegativeResilienceFactor)
+	})
+
+	Convey("messages should be keyed by the hash they change", t, func() {
+		key, ok := messageKey(h.node.NewMessage(LINK_REQUEST, LinkReq{Base: hash}))
+		So(ok, ShouldBeTrue)
+		So(key.String(), ShouldEqual, hash.String())
+		_, ok = messageKey(h.node.NewMessage(GET_REQUEST, GetReq{H: hash}))
+		So(ok, ShouldBeFalse)
+	})
+}
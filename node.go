@@ -8,10 +8,10 @@ package holochain
 
 import (
 	"context"
-	//	host "github.com/libp2p/go-libp2p-host"
-	"encoding/gob"
 	"errors"
 	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	host "github.com/libp2p/go-libp2p-host"
 	net "github.com/libp2p/go-libp2p-net"
 	peer "github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
@@ -24,6 +24,7 @@ import (
 	mh "github.com/multiformats/go-multihash"
 	"gopkg.in/mgo.v2/bson"
 	"io"
+	"sync/atomic"
 	"time"
 )
 
@@ -61,6 +62,43 @@ const (
 	// Application Messages
 
 	APP_MESSAGE
+
+	// Recovery messages
+
+	GET_HEADERS_REQUEST
+
+	// Validate Messages for fetching chunked packages
+
+	VALIDATE_PACKAGE_REQUEST
+
+	// DHT message recording that a holder validated a put
+
+	RECEIPT_REQUEST
+
+	// DHT message asking for the links on several bases at once
+
+	GETLINKS_REQUEST
+
+	// Replication message asking a primary for its changes
+
+	REPLICATE_REQUEST
+
+	// Forwarding message carrying a zome call from another of the agent's devices
+
+	FORWARD_REQUEST
+
+	// Gossip message checking that a gossiper is still there
+
+	PING_REQUEST
+
+	// Validate message asking the author for its transcript of validating an entry
+
+	VALIDATE_TRANSCRIPT_REQUEST
+
+	// DHT message moving an entry into a status the DNA declares, and its validation
+
+	STATUS_REQUEST
+	VALIDATE_STATUS_REQUEST
 )
 
 // Message represents data that can be sent to node in the network
@@ -73,6 +111,12 @@ type Message struct {
 
 // Node represents a node in the network
 type Node struct {
+	// updated atomically so kept first for alignment
+	bytesSent        int64
+	bytesReceived    int64
+	messagesSent     int64
+	messagesReceived int64
+
 	HashAddr peer.ID
 	NetAddr  ma.Multiaddr
 	Host     *rhost.RoutedHost
@@ -131,49 +175,58 @@ func NewNode(listenAddr string, agent *LibP2PAgent) (node *Node, err error) {
 	if err != nil {
 		return
 	}
+	n.HashAddr = nodeID
 
-	ps := pstore.NewPeerstore()
+	var bh host.Host
+	bh, err = NodeHost(n.NetAddr, agent.PrivKey())
+	if err != nil {
+		return
+	}
+	hr := Router{}
+	n.Host = rhost.Wrap(bh, &hr)
 
-	n.HashAddr = nodeID
-	priv := agent.PrivKey()
+	node = &n
+	return
+}
+
+// NodeHost makes the libp2p host of a new node.  By default it listens on the network
+// at the node's address, but it may be replaced, like by simulations that wire many
+// nodes together in one process.
+var NodeHost = newSwarmHost
+
+// newSwarmHost makes a host for a swarm listening at listenAddr
+func newSwarmHost(listenAddr ma.Multiaddr, priv ic.PrivKey) (h host.Host, err error) {
+	var nodeID peer.ID
+	if nodeID, err = peer.IDFromPrivateKey(priv); err != nil {
+		return
+	}
+	ps := pstore.NewPeerstore()
 	ps.AddPrivKey(nodeID, priv)
 	ps.AddPubKey(nodeID, priv.GetPublic())
 
 	ctx := context.Background()
 
 	// create a new swarm to be used by the service host
-	netw, err := swarm.NewNetwork(ctx, []ma.Multiaddr{n.NetAddr}, nodeID, ps, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var bh *bhost.BasicHost
-	bh, err = bhost.New(netw), nil
+	netw, err := swarm.NewNetwork(ctx, []ma.Multiaddr{listenAddr}, nodeID, ps, nil)
 	if err != nil {
 		return
 	}
-	hr := Router{}
-	n.Host = rhost.Wrap(bh, &hr)
-
-	node = &n
+	h = bhost.New(netw)
 	return
 }
 
-// Encode codes a message to gob format
-// @TODO generalize for other message encoding formats
+// Encode codes a message into an envelope with the current codec
 func (m *Message) Encode() (data []byte, err error) {
-	data, err = ByteEncoder(m)
+	data, err = EnvelopeEncoder(m)
 	if err != nil {
 		return
 	}
 	return
 }
 
-// Decode converts a message from gob format
-// @TODO generalize for other message encoding formats
+// Decode converts a message from an envelope (or legacy gob format)
 func (m *Message) Decode(r io.Reader) (err error) {
-	dec := gob.NewDecoder(r)
-	err = dec.Decode(m)
+	err = decodeEnvelope(r, m)
 	return
 }
 
@@ -226,6 +279,26 @@ func (m Message) String() string {
 		typeStr = "VALIDATE_DEL_REQUEST"
 	case VALIDATE_MOD_REQUEST:
 		typeStr = "VALIDATE_MOD_REQUEST"
+	case GET_HEADERS_REQUEST:
+		typeStr = "GET_HEADERS_REQUEST"
+	case VALIDATE_PACKAGE_REQUEST:
+		typeStr = "VALIDATE_PACKAGE_REQUEST"
+	case RECEIPT_REQUEST:
+		typeStr = "RECEIPT_REQUEST"
+	case GETLINKS_REQUEST:
+		typeStr = "GETLINKS_REQUEST"
+	case REPLICATE_REQUEST:
+		typeStr = "REPLICATE_REQUEST"
+	case FORWARD_REQUEST:
+		typeStr = "FORWARD_REQUEST"
+	case PING_REQUEST:
+		typeStr = "PING_REQUEST"
+	case VALIDATE_TRANSCRIPT_REQUEST:
+		typeStr = "VALIDATE_TRANSCRIPT_REQUEST"
+	case STATUS_REQUEST:
+		typeStr = "STATUS_REQUEST"
+	case VALIDATE_STATUS_REQUEST:
+		typeStr = "VALIDATE_STATUS_REQUEST"
 	}
 	return fmt.Sprintf("%s @ %v From:%v Body:%v", typeStr, m.Time, m.From, m.Body)
 }
@@ -241,11 +314,14 @@ func (node *Node) respondWith(s net.Stream, err error, body interface{}) {
 		m = node.NewMessage(OK_RESPONSE, body)
 	}
 
-	data, err := m.Encode()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	err = encodeEnvelope(buf, m)
 	if err != nil {
 		panic(err) //TODO can't panic, gotta do something else!
 	}
-	_, err = s.Write(data)
+	n, err := s.Write(buf.Bytes())
+	atomic.AddInt64(&node.bytesSent, int64(n))
 	if err != nil {
 		panic(err) //TODO can't panic, gotta do something else!
 	}
@@ -255,7 +331,8 @@ func (node *Node) respondWith(s net.Stream, err error, body interface{}) {
 func (node *Node) StartProtocol(h *Holochain, proto Protocol) (err error) {
 	node.Host.SetStreamHandler(proto.ID, func(s net.Stream) {
 		var m Message
-		err := m.Decode(s)
+		err := m.Decode(countingReader{s, &node.bytesReceived})
+		atomic.AddInt64(&node.messagesReceived, 1)
 		var response interface{}
 		if m.From == "" {
 			// @todo other sanity checks on From?
@@ -277,28 +354,42 @@ func (node *Node) Close() error {
 
 // Send delivers a message to a node via the given protocol
 func (node *Node) Send(proto Protocol, addr peer.ID, m *Message) (response Message, err error) {
+	response, err = node.send(proto, addr, m, nil)
+	return
+}
+
+// send sends a message and waits for the response, calling written, if given, once the
+// whole message has been written to the peer
+func (node *Node) send(proto Protocol, addr peer.ID, m *Message, written func()) (response Message, err error) {
 	s, err := node.Host.NewStream(context.Background(), addr, proto.ID)
 	if err != nil {
 		return
 	}
 	defer s.Close()
 
-	// encode the message and send it
-	data, err := m.Encode()
+	// encode the message into a pooled buffer and send it
+	buf := getBuffer()
+	defer putBuffer(buf)
+	err = encodeEnvelope(buf, m)
 	if err != nil {
 		return
 	}
+	data := buf.Bytes()
 
 	n, err := s.Write(data)
+	atomic.AddInt64(&node.bytesSent, int64(n))
+	atomic.AddInt64(&node.messagesSent, 1)
 	if err != nil {
 		return
 	}
 	if n != len(data) {
 		err = errors.New("unable to send all data")
+	} else if written != nil {
+		written()
 	}
 
 	// decode the response
-	err = response.Decode(s)
+	err = response.Decode(countingReader{s, &node.bytesReceived})
 	if err != nil {
 		return
 	}
@@ -326,46 +417,57 @@ const (
 	ErrHashRejectedCode
 	ErrLinkNotFoundCode
 	ErrEntryTypeMismatchCode
+	ErrCorruptRecordCode
+	ErrHashPendingCode
+	ErrHashExpiredCode
+	ErrValidationFailedCode
+	ErrUnauthorizedCode
+	ErrTimeoutCode
+	ErrRejectedByPolicyCode
 )
 
-// NewErrorResponse encodes standard errors for transmitting
+// responseErrors are the standard errors indexed by their codes
+var responseErrors = []error{
+	ErrHashNotFoundCode:      ErrHashNotFound,
+	ErrHashDeletedCode:       ErrHashDeleted,
+	ErrHashModifiedCode:      ErrHashModified,
+	ErrHashRejectedCode:      ErrHashRejected,
+	ErrLinkNotFoundCode:      ErrLinkNotFound,
+	ErrEntryTypeMismatchCode: ErrEntryTypeMismatch,
+	ErrCorruptRecordCode:     ErrCorruptRecord,
+	ErrHashPendingCode:       ErrHashPending,
+	ErrHashExpiredCode:       ErrHashExpired,
+	ErrValidationFailedCode:  ErrValidationFailed,
+	ErrUnauthorizedCode:      ErrUnauthorized,
+	ErrTimeoutCode:           ErrTimeout,
+	ErrRejectedByPolicyCode:  ErrRejectedByPolicy,
+}
+
+// NewErrorResponse encodes standard errors for transmitting, with the message of errors
+// that wrap them so that they arrive as they were sent
 func NewErrorResponse(err error) (errResp ErrorResponse) {
-	switch err {
-	case ErrHashNotFound:
-		errResp.Code = ErrHashNotFoundCode
-	case ErrHashDeleted:
-		errResp.Code = ErrHashDeletedCode
-	case ErrHashModified:
-		errResp.Code = ErrHashModifiedCode
-	case ErrHashRejected:
-		errResp.Code = ErrHashRejectedCode
-	case ErrLinkNotFound:
-		errResp.Code = ErrLinkNotFoundCode
-	case ErrEntryTypeMismatch:
-		errResp.Code = ErrEntryTypeMismatchCode
-	default:
-		errResp.Message = err.Error() //Code will be set to ErrUnknown by default cus it's 0
+	for code, e := range responseErrors {
+		if e != nil && errors.Is(err, e) {
+			errResp.Code = code
+			if err != e {
+				errResp.Message = err.Error()
+			}
+			return
+		}
 	}
+	errResp.Message = err.Error() //Code will be set to ErrUnknown by default cus it's 0
 	return
 }
 
 // DecodeResponseError creates a go error object from the ErrorResponse data
 func (errResp ErrorResponse) DecodeResponseError() (err error) {
-	switch errResp.Code {
-	case ErrHashNotFoundCode:
-		err = ErrHashNotFound
-	case ErrHashDeletedCode:
-		err = ErrHashDeleted
-	case ErrHashModifiedCode:
-		err = ErrHashModified
-	case ErrHashRejectedCode:
-		err = ErrHashRejected
-	case ErrLinkNotFoundCode:
-		err = ErrLinkNotFound
-	case ErrEntryTypeMismatchCode:
-		err = ErrEntryTypeMismatch
-	default:
-		err = errors.New(errResp.Message)
+	if errResp.Code > ErrUnknownCode && errResp.Code < len(responseErrors) {
+		err = responseErrors[errResp.Code]
+		if errResp.Message != "" {
+			err = &wrappedError{errResp.Message, err}
+		}
+		return
 	}
+	err = errors.New(errResp.Message)
 	return
 }
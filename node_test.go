@@ -134,7 +134,10 @@ func TestNodeSend(t *testing.T) {
 	h2.rootPath = d
 	h2.node = node2
 	os.MkdirAll(h2.DBPath(), os.ModePerm)
-	h2.dht = NewDHT(&h2)
+	h2.dht, err = NewDHT(&h2)
+	if err != nil {
+		panic(err)
+	}
 	h2.chain = NewChain(h.hashSpec)
 	h2.nucleus = NewNucleus(&h2, &DNA{})
 
@@ -270,6 +273,8 @@ func TestErrorCoding(t *testing.T) {
 		So(er.DecodeResponseError(), ShouldEqual, ErrHashRejected)
 		er = NewErrorResponse(ErrLinkNotFound)
 		So(er.DecodeResponseError(), ShouldEqual, ErrLinkNotFound)
+		er = NewErrorResponse(ErrCorruptRecord)
+		So(er.DecodeResponseError(), ShouldEqual, ErrCorruptRecord)
 
 		er = NewErrorResponse(errors.New("Some Error"))
 		So(er.Code, ShouldEqual, ErrUnknownCode)
@@ -7,6 +7,8 @@ package holochain
 import (
 	"fmt"
 	"github.com/google/uuid"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"time"
 )
 
 type DNA struct {
@@ -20,16 +22,82 @@ type DNA struct {
 	DHTConfig                 DHTConfig
 	Progenitor                Progenitor
 	Zomes                     []Zome
+	Statuses                  []StatusDef     // statuses entries can be moved into beyond the system ones
+	TimeAuthorities           []TimeAuthority // roughtime servers that timestamp commits, whose keys every node trusts
 	propertiesSchemaValidator SchemaValidator
 }
 
 func (dna *DNA) check() (err error) {
 	if dna.RequiresVersion > Version {
 		err = fmt.Errorf("Chain requires Holochain version %d", dna.RequiresVersion)
+		return
+	}
+	if dna.DHTConfig.ResilienceFactor < 0 {
+		err = ErrNegativeResilienceFactor
+		return
+	}
+	if err = dna.checkStatuses(); err != nil {
+		return
+	}
+	if err = validateTimeAuthorities(dna.TimeAuthorities); err != nil {
+		return
+	}
+	for _, z := range dna.Zomes {
+		for j := range z.Entries {
+			e := &z.Entries[j]
+			if IsSystemEntryType(e.Name) {
+				err = fmt.Errorf("entry type %s in zome %s: %w", e.Name, z.Name, ErrReservedEntryType)
+				return
+			}
+			if e.TTL < 0 {
+				err = fmt.Errorf("entry type %s in zome %s: %w", e.Name, z.Name, ErrNegativeTTL)
+				return
+			}
+			if e.Disclosable && (e.DataFormat != DataFormatJSON || e.Sharing != Public) {
+				err = fmt.Errorf("entry type %s in zome %s: %w", e.Name, z.Name, ErrDisclosableSharing)
+				return
+			}
+			if err = e.buildSchemaValidator(); err != nil {
+				err = fmt.Errorf("schema for entry type %s in zome %s: %w", e.Name, z.Name, err)
+				return
+			}
+		}
+		var timeout time.Duration
+		if timeout, err = z.executionTimeout(); err != nil {
+			err = fmt.Errorf("zome %s: %w", z.Name, err)
+			return
+		}
+		// only javascript and zygo zomes can be interrupted
+		if timeout > 0 && z.RibosomeType != JSRibosomeType && z.RibosomeType != ZygoRibosomeType {
+			err = fmt.Errorf("zome %s: %w", z.Name, ErrExecutionTimeoutUnsupported)
+			return
+		}
+		if z.StrictValidation && z.RibosomeType != JSRibosomeType {
+			err = fmt.Errorf("zome %s: %w", z.Name, ErrStrictValidationUnsupported)
+			return
+		}
+		for _, s := range z.Schedules {
+			if _, err = parseSchedule(&z, s); err != nil {
+				err = fmt.Errorf("schedule for %s in zome %s: %w", s.Function, z.Name, err)
+				return
+			}
+		}
 	}
 	return
 }
 
+// hasTTL returns whether any of the DNA's entry types expire
+func (dna *DNA) hasTTL() bool {
+	for _, z := range dna.Zomes {
+		for _, e := range z.Entries {
+			if e.TTL > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Nucleus encapsulates Application parts: Ribosomes to run code in Zomes, plus application
 // validation and direct message passing protocols
 type Nucleus struct {
@@ -79,11 +147,26 @@ func (n *Nucleus) Start() (err error) {
 type AppMsg struct {
 	ZomeType string
 	Body     string
+	// Auth deniably authenticates Body to the recipient when the sender asked for it
+	Auth *DeniableAuth
+	// Enc holds Body encrypted to the recipient, in which case Body is empty
+	Enc *SealedBox
 }
 
 // ActionReceiver handles messages on the action protocol
 func ActionReceiver(h *Holochain, msg *Message) (response interface{}, err error) {
+	response, err = receiveAction(h, msg.From, msg)
+	return
+}
+
+// receiveAction handles an action message that came from the peer, which for gossiped
+// messages is the peer gossiping it rather than its sender
+func receiveAction(h *Holochain, from peer.ID, msg *Message) (response interface{}, err error) {
 	dht := h.dht
+	if !dht.accepts(from, msg) {
+		err = ErrRejectedByPolicy
+		return
+	}
 	var a Action
 	a, err = MakeActionFromMessage(msg)
 	if err == nil {
@@ -91,11 +174,66 @@ func ActionReceiver(h *Holochain, msg *Message) (response interface{}, err error
 		// N.B. a.Receive calls made to an Action whose values are NOT populated.
 		// The Receive functions understand this and use the values from the message body
 		// TODO, this indicates an architectural error, so fix!
-		response, err = a.Receive(dht, msg)
+		if !changesDHT(msg.Type) {
+			response, err = a.Receive(dht, msg)
+			return
+		}
+		// the same change often arrives from several gossip partners at once, so only
+		// validate and apply the first copy
+		var f Hash
+		f, err = msg.Fingerprint()
+		if err != nil {
+			return
+		}
+		var dup bool
+		response, err, dup = dht.dedup.do(f.Key(), func() (interface{}, error) {
+			h.recordReceived(msg)
+			return a.Receive(dht, msg)
+		})
+		if dup {
+			dht.dlog.Logf("ActionReceiver skipped duplicate %s: %v", a.Name(), f)
+		}
 	}
 	return
 }
 
+// validateGossipedPut receives a put gossiped by the peer the way receiveAction does
+// but only validates it, returning what to store for it, or nil if it needn't be stored
+func validateGossipedPut(h *Holochain, from peer.ID, msg *Message) (p *validatedPut, err error) {
+	dht := h.dht
+	if !dht.accepts(from, msg) {
+		err = ErrRejectedByPolicy
+		return
+	}
+	if _, err = MakeActionFromMessage(msg); err != nil {
+		return
+	}
+	var f Hash
+	if f, err = msg.Fingerprint(); err != nil {
+		return
+	}
+	var dup bool
+	_, err, dup = dht.dedup.do(f.Key(), func() (interface{}, error) {
+		h.recordReceived(msg)
+		var e error
+		p, e = dht.validatePut(msg)
+		return "queued", e
+	})
+	if dup {
+		dht.dlog.Logf("skipped duplicate gossiped put: %v", f)
+	}
+	return
+}
+
+// changesDHT returns true for the types of message that change the DHT
+func changesDHT(t MsgType) bool {
+	switch t {
+	case PUT_REQUEST, DEL_REQUEST, MOD_REQUEST, LINK_REQUEST, DELETELINK_REQUEST, RECEIPT_REQUEST, STATUS_REQUEST:
+		return true
+	}
+	return false
+}
+
 // NewUUID generates a new UUID for the DNA
 func (dna *DNA) NewUUID() (err error) {
 	dna.UUID, err = uuid.NewUUID()
@@ -44,7 +44,27 @@ func TestAppMessages(t *testing.T) {
 	Convey("it should send and receive app messages", t, func() {
 		r, err := h.Send(ActionProtocol, h.node.HashAddr, APP_MESSAGE, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
 		So(err, ShouldBeNil)
-		So(fmt.Sprintf("%v", r), ShouldEqual, `{jsSampleZome {"pong":"foobar"}}`)
+		So(r.(AppMsg).ZomeType, ShouldEqual, "jsSampleZome")
+		So(r.(AppMsg).Body, ShouldEqual, `{"pong":"foobar"}`)
+	})
+
+	Convey("it should send app messages deniably authenticated with a one-time key", t, func() {
+		a := NewSendAction(h.node.HashAddr, AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`})
+		a.options.Ephemeral = true
+		r, err := a.Do(h)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, `{"pong":"foobar"}`)
+		So(a.msg.Auth, ShouldNotBeNil)
+		So(len(a.msg.Auth.MAC), ShouldEqual, 32)
+	})
+
+	Convey("it should reject app messages whose authentication doesn't match", t, func() {
+		m := AppMsg{ZomeType: "jsSampleZome", Body: `{"ping":"foobar"}`}
+		err := h.authAppMsg(h.node.HashAddr, &m)
+		So(err, ShouldBeNil)
+		m.Body = `{"ping":"barfoo"}`
+		_, err = h.Send(ActionProtocol, h.node.HashAddr, APP_MESSAGE, m)
+		So(err.Error(), ShouldEqual, ErrBadMessageAuth.Error())
 	})
 }
 
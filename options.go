@@ -0,0 +1,145 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// options implements decoding the options objects passed to built-in functions into
+// their go structs
+
+package holochain
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OptionError reports an option whose value has the wrong type
+type OptionError struct {
+	Option   string
+	Expected string
+	Got      interface{}
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("expecting %s %s attribute, got %T", e.Expected, e.Option, e.Got)
+}
+
+// decodeOptions sets the fields of the struct pointed to by to from the options object
+// passed to the built-in fn.  Keys match field names regardless of case, and unknown keys
+// are ignored with a warning to the log so that typos don't pass silently.
+func decodeOptions(fn string, opts map[string]interface{}, to interface{}, log *Logger) (err error) {
+	v := reflect.ValueOf(to).Elem()
+	t := v.Type()
+
+	var keys []string
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var field reflect.Value
+		var name string
+		for i := 0; i < t.NumField(); i++ {
+			if strings.EqualFold(t.Field(i).Name, k) {
+				field = v.Field(i)
+				name = t.Field(i).Name
+				break
+			}
+		}
+		if !field.IsValid() {
+			if log != nil {
+				log.Logf("warning: %s() ignoring unknown option %q", fn, k)
+			}
+			continue
+		}
+		val := opts[k]
+		switch field.Kind() {
+		case reflect.Int:
+			// ribosomes may give int64 or float64 depending on how the number was made
+			i, ok := numInterfaceToInt(val)
+			if !ok {
+				err = &OptionError{Option: name, Expected: "int", Got: val}
+				return
+			}
+			field.SetInt(int64(i))
+		case reflect.Bool:
+			b, ok := val.(bool)
+			if !ok {
+				err = &OptionError{Option: name, Expected: "boolean", Got: val}
+				return
+			}
+			field.SetBool(b)
+		case reflect.String:
+			s, ok := val.(string)
+			if !ok {
+				err = &OptionError{Option: name, Expected: "string", Got: val}
+				return
+			}
+			field.SetString(s)
+		case reflect.Map:
+			if field.Type().Key().Kind() != reflect.String || field.Type().Elem().Kind() != reflect.String {
+				err = fmt.Errorf("unsupported option type %v for %s", field.Type(), name)
+				return
+			}
+			obj, ok := val.(map[string]interface{})
+			if !ok {
+				err = &OptionError{Option: name, Expected: "object", Got: val}
+				return
+			}
+			m := make(map[string]string, len(obj))
+			for mk, mv := range obj {
+				s, ok := mv.(string)
+				if !ok {
+					err = &OptionError{Option: name + "." + mk, Expected: "string", Got: mv}
+					return
+				}
+				m[mk] = s
+			}
+			field.Set(reflect.ValueOf(m))
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.String {
+				err = fmt.Errorf("unsupported option type %v for %s", field.Type(), name)
+				return
+			}
+			// otto exports arrays whose elements are all strings as []string
+			if ss, ok := val.([]string); ok {
+				field.Set(reflect.ValueOf(ss))
+				continue
+			}
+			arr, ok := val.([]interface{})
+			if !ok {
+				err = &OptionError{Option: name, Expected: "array", Got: val}
+				return
+			}
+			ss := make([]string, len(arr))
+			for i, av := range arr {
+				s, ok := av.(string)
+				if !ok {
+					err = &OptionError{Option: fmt.Sprintf("%s[%d]", name, i), Expected: "string", Got: av}
+					return
+				}
+				ss[i] = s
+			}
+			field.Set(reflect.ValueOf(ss))
+		case reflect.Struct:
+			obj, ok := val.(map[string]interface{})
+			if !ok {
+				err = &OptionError{Option: name, Expected: "object", Got: val}
+				return
+			}
+			err = decodeOptions(fn, obj, field.Addr().Interface(), log)
+			if oerr, ok := err.(*OptionError); ok {
+				oerr.Option = name + "." + oerr.Option
+			}
+			if err != nil {
+				return
+			}
+		default:
+			err = fmt.Errorf("unsupported option type %v for %s", field.Kind(), name)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package holochain
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	var buf bytes.Buffer
+	log := Logger{Enabled: true}
+	log.New(&buf)
+
+	Convey("it should decode options regardless of key case", t, func() {
+		buf.Reset()
+		options := GetOptions{StatusMask: StatusDefault}
+		err := decodeOptions("get", map[string]interface{}{"statusMask": float64(StatusAny), "GETMASK": int64(GetMaskAll), "local": true}, &options, &log)
+		So(err, ShouldBeNil)
+		So(options.StatusMask, ShouldEqual, StatusAny)
+		So(options.GetMask, ShouldEqual, GetMaskAll)
+		So(options.Local, ShouldBeTrue)
+		So(buf.String(), ShouldEqual, "")
+	})
+
+	Convey("it should warn about unknown options", t, func() {
+		buf.Reset()
+		options := GetLinkOptions{}
+		err := decodeOptions("getLink", map[string]interface{}{"Lode": true, "Load": true}, &options, &log)
+		So(err, ShouldBeNil)
+		So(options.Load, ShouldBeTrue)
+		So(buf.String(), ShouldEqual, "warning: getLink() ignoring unknown option \"Lode\"\n")
+	})
+
+	Convey("it should return structured errors for wrong types", t, func() {
+		options := GetLinkOptions{}
+		err := decodeOptions("getLink", map[string]interface{}{"load": "yes"}, &options, &log)
+		oerr, ok := err.(*OptionError)
+		So(ok, ShouldBeTrue)
+		So(oerr.Option, ShouldEqual, "Load")
+		So(oerr.Expected, ShouldEqual, "boolean")
+		So(err.Error(), ShouldEqual, "expecting boolean Load attribute, got string")
+
+		err = decodeOptions("getLink", map[string]interface{}{"StatusMask": "1"}, &options, nil)
+		So(err.Error(), ShouldEqual, "expecting int StatusMask attribute, got string")
+	})
+
+	Convey("it should decode string maps", t, func() {
+		options := CommitOptions{}
+		err := decodeOptions("commit", map[string]interface{}{"meta": map[string]interface{}{"device": "phone"}}, &options, &log)
+		So(err, ShouldBeNil)
+		So(options.Meta, ShouldResemble, map[string]string{"device": "phone"})
+
+		err = decodeOptions("commit", map[string]interface{}{"meta": map[string]interface{}{"device": 1}}, &options, nil)
+		So(err.Error(), ShouldEqual, "expecting string Meta.device attribute, got int")
+	})
+}
+
+func TestDecodeOptionsNested(t *testing.T) {
+	Convey("it should decode string arrays and nested objects", t, func() {
+		options := QueryOptions{}
+		err := decodeOptions("query", map[string]interface{}{
+			"entryTypes": []interface{}{"a", "b"},
+			"constrain":  map[string]interface{}{"contains": "x"},
+			"return":     map[string]interface{}{"hashes": true},
+		}, &options, nil)
+		So(err, ShouldBeNil)
+		So(options.EntryTypes, ShouldResemble, []string{"a", "b"})
+		So(options.Constrain.Contains, ShouldEqual, "x")
+		So(options.Return.Hashes, ShouldBeTrue)
+
+		err = decodeOptions("query", map[string]interface{}{"entryTypes": []string{"c"}}, &options, nil)
+		So(err, ShouldBeNil)
+		So(options.EntryTypes, ShouldResemble, []string{"c"})
+	})
+
+	Convey("it should report errors in arrays and nested objects by their path", t, func() {
+		options := QueryOptions{}
+		err := decodeOptions("query", map[string]interface{}{"entryTypes": []interface{}{"a", 1}}, &options, nil)
+		So(err.Error(), ShouldEqual, "expecting string EntryTypes[1] attribute, got int")
+		err = decodeOptions("query", map[string]interface{}{"return": map[string]interface{}{"hashes": "yes"}}, &options, nil)
+		So(err.Error(), ShouldEqual, "expecting boolean Return.Hashes attribute, got string")
+		err = decodeOptions("query", map[string]interface{}{"entryTypes": "a"}, &options, nil)
+		So(err.Error(), ShouldEqual, "expecting array EntryTypes attribute, got string")
+	})
+}
@@ -0,0 +1,284 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// outbox implements a persistent queue of the DHT publications of committed entries which
+// are retried until they are delivered
+
+package holochain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/tidwall/buntdb"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OutboxRetryInterval is how long to wait before the first retry of a failed publication
+	OutboxRetryInterval = 5 * time.Second
+	// OutboxMaxRetryInterval caps the backoff between retries
+	OutboxMaxRetryInterval = 10 * time.Minute
+	// OutboxCheckInterval is how often the outbox looks for publications due for retry
+	OutboxCheckInterval = time.Second
+
+	outboxPrefix = "outbox:"
+)
+
+// Publication is a DHT message waiting in the outbox to be sent
+type Publication struct {
+	ID        string
+	Key       Hash // the hash whose neighborhood the message is sent to
+	T         MsgType
+	Body      interface{}
+	Attempts  int
+	Next      time.Time // when the next attempt is due
+	LastError string
+}
+
+// Outbox holds the publications of committed entries until they are delivered
+type Outbox struct {
+	h     *Holochain
+	lk    sync.Mutex
+	last  int64
+	stop  chan struct{}
+	wake  chan struct{}
+	wg    sync.WaitGroup
+	sendp func(p *Publication) (delivered bool, err error) // delivered if the receiver responded
+}
+
+// NewOutbox returns the outbox of a holochain
+func NewOutbox(h *Holochain) *Outbox {
+	o := Outbox{h: h, wake: make(chan struct{}, 1)}
+	o.sendp = o.send
+	return &o
+}
+
+// Outbox returns the holochain's queue of unsent DHT publications
+func (h *Holochain) Outbox() *Outbox {
+	return h.outbox
+}
+
+// outboxBackoff returns how long to wait after the given number of failed attempts
+func outboxBackoff(attempts int) (d time.Duration) {
+	d = OutboxRetryInterval
+	for i := 1; i < attempts && d < OutboxMaxRetryInterval; i++ {
+		d *= 2
+	}
+	if d > OutboxMaxRetryInterval {
+		d = OutboxMaxRetryInterval
+	}
+	return
+}
+
+// nextID returns an id that sorts after all the ids given before, even across restarts
+func (o *Outbox) nextID() string {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	n := time.Now().UnixNano()
+	if n <= o.last {
+		n = o.last + 1
+	}
+	o.last = n
+	return fmt.Sprintf("%020d", n)
+}
+
+func (o *Outbox) save(p *Publication) (err error) {
+	var b bytes.Buffer
+	if err = gob.NewEncoder(&b).Encode(p); err != nil {
+		return
+	}
+	err = o.h.dht.update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(outboxPrefix+p.ID, b.String(), nil)
+		return err
+	})
+	return
+}
+
+func (o *Outbox) remove(id string) (err error) {
+	err = o.h.dht.update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(outboxPrefix + id)
+		if err == buntdb.ErrNotFound {
+			err = nil
+		}
+		return err
+	})
+	return
+}
+
+// Pending returns the publications waiting to be sent in the order they were queued
+func (o *Outbox) Pending() (pubs []*Publication, err error) {
+	err = o.h.dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		err := tx.AscendKeys(outboxPrefix+"*", func(key, value string) bool {
+			var p Publication
+			if e = gob.NewDecoder(strings.NewReader(value)).Decode(&p); e != nil {
+				return false
+			}
+			pubs = append(pubs, &p)
+			return true
+		})
+		if err == nil {
+			err = e
+		}
+		return err
+	})
+	sort.Slice(pubs, func(i, j int) bool { return pubs[i].ID < pubs[j].ID })
+	return
+}
+
+// Queue saves publications in the outbox
+func (o *Outbox) Queue(pubs ...*Publication) (err error) {
+	now := time.Now()
+	for _, p := range pubs {
+		p.ID = o.nextID()
+		// the worker leaves it alone while a first attempt is made
+		p.Next = now.Add(outboxBackoff(1))
+		if err = o.save(p); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Send makes a first attempt at sending queued publications.  Those that can't be
+// delivered now are retried in the background, so the error returned is the first
+// one from a node that received a publication and rejected it.
+func (o *Outbox) Send(pubs ...*Publication) (err error) {
+	now := time.Now()
+	for _, p := range pubs {
+		if e := o.attempt(p, now); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// attempt sends a publication, removing it from the outbox if it was delivered or
+// scheduling its retry if not.  It returns the receiver's error if it was rejected.
+func (o *Outbox) attempt(p *Publication, now time.Time) (rejected error) {
+	delivered, err := o.sendp(p)
+	if delivered {
+		if err != nil {
+			// retrying won't change the receiver's mind
+			o.h.dht.dlog.Logf("outbox: %v to %v rejected: %v", p.T, p.Key, err)
+			rejected = err
+		}
+		if err = o.remove(p.ID); err != nil {
+			o.h.dht.dlog.Logf("outbox: unable to remove %s: %v", p.ID, err)
+		}
+		return
+	}
+	p.Attempts++
+	p.LastError = err.Error()
+	p.Next = now.Add(outboxBackoff(p.Attempts))
+	o.h.dht.dlog.Logf("outbox: %v to %v failed (attempt %d), retrying at %v: %v", p.T, p.Key, p.Attempts, p.Next, err)
+	if err = o.save(p); err != nil {
+		o.h.dht.dlog.Logf("outbox: unable to save %s: %v", p.ID, err)
+	}
+	return
+}
+
+// send delivers a publication to the node responsible for its key, and when the DHT is
+// sharded, copies it to the rest of the nodes in the key's neighborhood too.  They are
+// best effort as gossip between neighbors fills in any that are missed.
+func (o *Outbox) send(p *Publication) (delivered bool, err error) {
+	var n *Node
+	if n, err = o.h.dht.FindNodeForHash(p.Key); err != nil {
+		return
+	}
+	// the replicas get the very same message so holders see it as one change
+	msg := o.h.node.NewMessage(p.T, p.Body)
+	// it's only delivered once the receiver responds, as the connection can fail after
+	// the message is written but before the receiver has it
+	_, delivered, err = o.h.sendMessageAcked(ActionProtocol, n.HashAddr, msg, nil)
+	if err != nil {
+		return
+	}
+	if r := o.h.dht.resilienceFactor(); r > 1 {
+		nodes, e := o.h.dht.nearestNodes(p.Key.H, r)
+		if e != nil {
+			o.h.dht.dlog.Logf("outbox: unable to find the neighborhood of %v: %v", p.Key, e)
+			return
+		}
+		for _, id := range nodes {
+			if id == n.HashAddr {
+				continue
+			}
+			if _, e := o.h.sendMessage(ActionProtocol, id, msg, nil); e != nil {
+				o.h.dht.dlog.Logf("outbox: %v to %v replica %v failed: %v", p.T, p.Key, id, e)
+			}
+		}
+	}
+	return
+}
+
+// Drain attempts the publications that are due, or all of them if all is true
+func (o *Outbox) Drain(all bool) (err error) {
+	var pubs []*Publication
+	if pubs, err = o.Pending(); err != nil {
+		return
+	}
+	now := time.Now()
+	for _, p := range pubs {
+		if all || !p.Next.After(now) {
+			o.attempt(p, now)
+		}
+	}
+	return
+}
+
+// Wake has the background worker retry all pending publications now, e.g. when
+// connectivity returns
+func (o *Outbox) Wake() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the background worker that retries publications
+func (o *Outbox) Start() {
+	if o.stop != nil {
+		return
+	}
+	o.stop = make(chan struct{})
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		ticker := time.NewTicker(OutboxCheckInterval)
+		defer ticker.Stop()
+		for {
+			all := false
+			select {
+			case <-o.stop:
+				return
+			case <-ticker.C:
+			case <-o.wake:
+				all = true
+			}
+			if err := o.Drain(all); err != nil {
+				o.h.dht.dlog.Logf("outbox: %v", err)
+			}
+		}
+	}()
+}
+
+// running reports whether the background worker has been started
+func (o *Outbox) running() bool {
+	return o.stop != nil
+}
+
+// Stop stops the background worker and waits for it to finish
+func (o *Outbox) Stop() {
+	if o.stop == nil {
+		return
+	}
+	close(o.stop)
+	o.wg.Wait()
+	o.stop = nil
+}
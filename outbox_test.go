@@ -0,0 +1,88 @@
+package holochain
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	Convey("retries should back off exponentially up to a limit", t, func() {
+		So(outboxBackoff(1), ShouldEqual, OutboxRetryInterval)
+		So(outboxBackoff(2), ShouldEqual, 2*OutboxRetryInterval)
+		So(outboxBackoff(3), ShouldEqual, 4*OutboxRetryInterval)
+		So(outboxBackoff(100), ShouldEqual, OutboxMaxRetryInterval)
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	o := h.Outbox()
+	offline := errors.New("offline")
+
+	Convey("delivered commits should leave the outbox empty", t, func() {
+		commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+		pubs, err := o.Pending()
+		So(err, ShouldBeNil)
+		So(len(pubs), ShouldEqual, 0)
+	})
+
+	Convey("undelivered publications should be kept for retry", t, func() {
+		o.sendp = func(p *Publication) (bool, error) { return false, offline }
+		hash := commit(h, "profile", `{"firstName":"Griffy"}`)
+		pubs, err := o.Pending()
+		So(err, ShouldBeNil)
+		So(len(pubs), ShouldEqual, 1)
+		So(pubs[0].T, ShouldEqual, PUT_REQUEST)
+		So(pubs[0].Key.String(), ShouldEqual, hash.String())
+		So(pubs[0].Attempts, ShouldEqual, 1)
+		So(pubs[0].LastError, ShouldEqual, "offline")
+		So(pubs[0].Next.After(time.Now()), ShouldBeTrue)
+
+		// and kept across restarts
+		pubs, err = NewOutbox(h).Pending()
+		So(err, ShouldBeNil)
+		So(len(pubs), ShouldEqual, 1)
+		So(pubs[0].Body, ShouldResemble, PutReq{H: hash})
+
+		// until they are due and can be sent
+		So(o.Drain(false), ShouldBeNil)
+		pubs, _ = o.Pending()
+		So(len(pubs), ShouldEqual, 1)
+		o.sendp = o.send
+		So(o.Drain(true), ShouldBeNil)
+		pubs, _ = o.Pending()
+		So(len(pubs), ShouldEqual, 0)
+	})
+
+	Convey("rejected publications should not be retried", t, func() {
+		rejected := errors.New("invalid")
+		o.sendp = func(p *Publication) (bool, error) { return true, rejected }
+		p := &Publication{Key: h.DNAHash(), T: PUT_REQUEST, Body: PutReq{H: h.DNAHash()}}
+		So(o.Queue(p), ShouldBeNil)
+		So(o.Send(p), ShouldEqual, rejected)
+		pubs, _ := o.Pending()
+		So(len(pubs), ShouldEqual, 0)
+		o.sendp = o.send
+	})
+
+	Convey("publications lost after being written should be retried", t, func() {
+		// a connection failing after the message was written gets no response
+		o.sendp = func(p *Publication) (bool, error) { return false, errors.New("stream reset") }
+		p := &Publication{Key: h.DNAHash(), T: PUT_REQUEST, Body: PutReq{H: h.DNAHash()}}
+		So(o.Queue(p), ShouldBeNil)
+		So(o.Send(p), ShouldBeNil)
+		pubs, _ := o.Pending()
+		So(len(pubs), ShouldEqual, 1)
+		So(pubs[0].LastError, ShouldEqual, "stream reset")
+		So(o.remove(pubs[0].ID), ShouldBeNil)
+		o.sendp = o.send
+	})
+
+	Convey("only a response from the receiver should acknowledge a publication", t, func() {
+		_, acked, _ := h.sendMessageAcked(ActionProtocol, h.nodeID, h.node.NewMessage(PUT_REQUEST, PutReq{H: h.DNAHash()}), nil)
+		So(acked, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// pin implements pinning hashes so that this node keeps them, exempting them from
+// eviction to stay within the DHT quota and from expiring when their TTL passes
+
+package holochain
+
+import (
+	"errors"
+	"github.com/tidwall/buntdb"
+	"strconv"
+	"time"
+)
+
+var ErrNotPinned = errors.New("hash not pinned")
+
+// Pin is a hash pinned on this node
+type Pin struct {
+	Hash string
+	Time time.Time // when it was pinned
+}
+
+// Pin marks a hash as one this node must keep.  The hash needn't be held yet, so
+// that it is kept once it arrives.
+func (dht *DHT) Pin(key Hash) (err error) {
+	err = dht.update(func(tx *buntdb.Tx) error {
+		k := "pin:" + key.String()
+		if _, err := tx.Get(k); err == nil {
+			return nil
+		}
+		_, _, err := tx.Set(k, strconv.FormatInt(time.Now().UnixNano(), 10), nil)
+		return err
+	})
+	return
+}
+
+// Unpin lets a pinned hash be evicted or expire again
+func (dht *DHT) Unpin(key Hash) (err error) {
+	err = dht.update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete("pin:" + key.String())
+		if err == buntdb.ErrNotFound {
+			err = ErrNotPinned
+		}
+		return err
+	})
+	return
+}
+
+// Pins returns the pinned hashes, sorted
+func (dht *DHT) Pins() (pins []Pin, err error) {
+	pins = []Pin{}
+	err = dht.view(func(tx *buntdb.Tx) error {
+		var e error
+		err := tx.AscendKeys("pin:*", func(key, value string) bool {
+			var t int64
+			if t, e = strconv.ParseInt(value, 10, 64); e != nil {
+				return false
+			}
+			pins = append(pins, Pin{Hash: key[len("pin:"):], Time: time.Unix(0, t)})
+			return true
+		})
+		if err == nil {
+			err = e
+		}
+		return err
+	})
+	return
+}
+
+// IsPinned returns true if the hash is pinned
+func (dht *DHT) IsPinned(key Hash) (pinned bool, err error) {
+	err = dht.view(func(tx *buntdb.Tx) error {
+		pinned = _isPinned(tx, key.String())
+		return nil
+	})
+	return
+}
+
+func _isPinned(tx *buntdb.Tx, k string) bool {
+	_, err := tx.Get("pin:" + k)
+	return err == nil
+}
@@ -0,0 +1,111 @@
+package holochain
+
+import (
+	"bytes"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPin(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+	hash1, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1")
+	hash2, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+
+	Convey("hashes should be pinned and unpinned", t, func() {
+		So(dht.Pin(hash1), ShouldBeNil)
+		So(dht.Pin(hash1), ShouldBeNil)
+		pinned, err := dht.IsPinned(hash1)
+		So(err, ShouldBeNil)
+		So(pinned, ShouldBeTrue)
+		pins, err := dht.Pins()
+		So(err, ShouldBeNil)
+		So(len(pins), ShouldEqual, 1)
+		So(pins[0].Hash, ShouldEqual, hash1.String())
+
+		So(dht.Unpin(hash1), ShouldBeNil)
+		So(dht.Unpin(hash1), ShouldEqual, ErrNotPinned)
+		pins, err = dht.Pins()
+		So(err, ShouldBeNil)
+		So(len(pins), ShouldEqual, 0)
+	})
+
+	Convey("wasm zomes should be able to pin and unpin", t, func() {
+		wr := &WASMRibosome{h: h, zome: &Zome{Name: "test", RibosomeType: WASMRibosomeType}}
+		fns := wr.builtins()
+		_, err := fns["pin"]([]interface{}{hash2.String()})
+		So(err, ShouldBeNil)
+		pinned, err := dht.IsPinned(hash2)
+		So(err, ShouldBeNil)
+		So(pinned, ShouldBeTrue)
+		_, err = fns["unpin"]([]interface{}{hash2.String()})
+		So(err, ShouldBeNil)
+		pinned, err = dht.IsPinned(hash2)
+		So(err, ShouldBeNil)
+		So(pinned, ShouldBeFalse)
+	})
+
+	Convey("pinned hashes shouldn't be evicted", t, func() {
+		var other peer.ID
+		h.config.DHTQuota = 0
+		So(dht.put(nil, "someType", hash1, other, []byte("12345"), StatusLive), ShouldBeNil)
+		So(dht.put(nil, "someType", hash2, other, []byte("12345"), StatusLive), ShouldBeNil)
+		far, near := hash1, hash2
+		if bytes.Compare(hashDistance(hash1.H, []byte(h.nodeID)), hashDistance(hash2.H, []byte(h.nodeID))) < 0 {
+			far, near = hash2, hash1
+		}
+		So(dht.Pin(far), ShouldBeNil)
+		h.config.DHTQuotaPolicy = DHTQuotaEvict
+		h.config.DHTQuota = atomic.LoadInt64(&dht.storedBytes)
+		defer func() { h.config.DHTQuota = 0 }()
+		hash3, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+		So(dht.put(nil, "someType", hash3, other, []byte("1"), StatusLive), ShouldBeNil)
+		So(dht.exists(far, StatusDefault), ShouldBeNil)
+		So(dht.exists(near, StatusDefault), ShouldEqual, ErrHashNotFound)
+
+		record, err := dht.Record(far)
+		So(err, ShouldBeNil)
+		So(record.Pinned, ShouldBeTrue)
+	})
+
+	Convey("pinned hashes shouldn't expire", t, func() {
+		for i, z := range h.nucleus.dna.Zomes {
+			for j, e := range z.Entries {
+				if e.Name == "oddNumbers" {
+					h.nucleus.dna.Zomes[i].Entries[j].TTL = 60
+				}
+			}
+		}
+		pinned := commit(h, "oddNumbers", "7")
+		unpinned := commit(h, "oddNumbers", "9")
+		So(dht.Pin(pinned), ShouldBeNil)
+		n, err := dht.expire(time.Now().Add(2 * time.Minute))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(dht.exists(unpinned, StatusDefault), ShouldEqual, ErrHashExpired)
+		So(dht.exists(pinned, StatusDefault), ShouldBeNil)
+	})
+
+	Convey("zome code should pin and unpin", t, func() {
+		hash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+		zome, _ := h.GetZome("jsSampleZome")
+		v, _ := NewJSRibosome(h, zome)
+		z := v.(*JSRibosome)
+		_, err := z.Run(`pin("` + hash.String() + `")`)
+		So(err, ShouldBeNil)
+		pinned, _ := dht.IsPinned(hash)
+		So(pinned, ShouldBeTrue)
+
+		zome, _ = h.GetZome("zySampleZome")
+		v, _ = NewZygoRibosome(h, zome)
+		zy := v.(*ZygoRibosome)
+		_, err = zy.Run(`(unpin "` + hash.String() + `")`)
+		So(err, ShouldBeNil)
+		pinned, _ = dht.IsPinned(hash)
+		So(pinned, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// power implements the lifecycle calls that apps embedding a holochain, like mobile apps,
+// make when they go into and out of the background, and a low power profile that
+// gossips in infrequent bursts
+
+package holochain
+
+import (
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// power profiles
+const (
+	PowerProfileNormal = "normal" // gossip every gossip interval
+	PowerProfileLow    = "low"    // gossip in bursts every LowPowerGossipInterval
+)
+
+// LowPowerGossipInterval is how long the low power profile waits between bursts of gossip
+var LowPowerGossipInterval = 5 * time.Minute
+
+// LowPowerBurstSize is how many nodes the low power profile gossips with in a burst
+var LowPowerBurstSize = 4
+
+// suspendedWork notes which background work was running when a holochain was suspended
+type suspendedWork struct {
+	presence  bool
+	scheduler bool
+	outbox    bool
+}
+
+func validatePowerProfile(profile string) (err error) {
+	switch profile {
+	case "", PowerProfileNormal, PowerProfileLow:
+	default:
+		err = fmt.Errorf("unknown power profile: %s", profile)
+	}
+	return
+}
+
+// SetPowerProfile changes how the holochain spends power, taking effect from its next
+// round of gossip
+func (h *Holochain) SetPowerProfile(profile string) (err error) {
+	if err = validatePowerProfile(profile); err != nil {
+		return
+	}
+	h.configLk.Lock()
+	h.config.PowerProfile = profile
+	h.configLk.Unlock()
+	if h.dht != nil {
+		h.dht.setLowPower(profile == PowerProfileLow)
+	}
+	return
+}
+
+// Suspend stops the holochain's background work, gossip, heartbeats, schedules and
+// retrying publications, for when the app embedding it goes into the background.  The
+// node still answers requests while it is suspended.  Work that doesn't stop within
+// StopTimeout is left to finish on its own.
+func (h *Holochain) Suspend() {
+	h.powerLk.Lock()
+	defer h.powerLk.Unlock()
+	if h.suspended != nil || h.dht == nil {
+		return
+	}
+	w := suspendedWork{}
+	if h.presence != nil && h.presence.stop != nil {
+		w.presence = true
+		h.stopWithin("presence heartbeat", h.presence.Stop)
+	}
+	if h.scheduler != nil && h.scheduler.stop != nil {
+		w.scheduler = true
+		h.stopWithin("scheduler", h.scheduler.Stop)
+	}
+	if h.outbox != nil && h.outbox.stop != nil {
+		w.outbox = true
+		h.stopWithin("outbox", h.outbox.Stop)
+	}
+	h.dht.suspend()
+	h.suspended = &w
+}
+
+// Resume restarts the background work stopped by Suspend and catches up on what was
+// missed by gossiping with every known node and retrying every pending publication
+func (h *Holochain) Resume() (err error) {
+	h.powerLk.Lock()
+	defer h.powerLk.Unlock()
+	w := h.suspended
+	if w == nil {
+		return
+	}
+	h.suspended = nil
+	h.dht.resume()
+	if w.scheduler {
+		h.scheduler.Start()
+	}
+	if w.outbox {
+		h.outbox.Start()
+		h.outbox.Wake()
+	}
+	if w.presence {
+		err = h.presence.Start()
+	}
+	return
+}
+
+// Suspended returns whether the holochain's background work is suspended
+func (h *Holochain) Suspended() bool {
+	h.powerLk.Lock()
+	defer h.powerLk.Unlock()
+	return h.suspended != nil
+}
+
+func (dht *DHT) setLowPower(low bool) {
+	var v int32
+	if low {
+		v = 1
+	}
+	atomic.StoreInt32(&dht.lowPower, v)
+}
+
+func (dht *DHT) isLowPower() bool {
+	return atomic.LoadInt32(&dht.lowPower) == 1
+}
+
+// suspend pauses the gossip loop and the expiry sweep
+func (dht *DHT) suspend() {
+	dht.powerLk.Lock()
+	defer dht.powerLk.Unlock()
+	if dht.suspended != nil {
+		return
+	}
+	dht.suspended = make(chan struct{})
+	dht.sweeping = dht.stopExpiry != nil
+	if dht.sweeping {
+		close(dht.stopExpiry)
+		dht.stopExpiry = nil
+	}
+}
+
+// resume restarts the gossip loop and expiry sweep, catching up with all the nodes it
+// knows and expiring what expired while it was suspended
+func (dht *DHT) resume() {
+	dht.powerLk.Lock()
+	defer dht.powerLk.Unlock()
+	if dht.suspended == nil {
+		return
+	}
+	close(dht.suspended)
+	dht.suspended = nil
+	if dht.sweeping {
+		if _, err := dht.expire(time.Now()); err != nil {
+			dht.dlog.Logf("error expiring hashes: %v", err)
+		}
+		dht.stopExpiry = make(chan struct{})
+		go dht.sweepExpired(dht.stopExpiry)
+	}
+	if dht.gossiping {
+		go func() {
+			if err := dht.gossipBurst(0); err != nil {
+				dht.glog.Logf("error catching up: %v", err)
+			}
+		}()
+	}
+}
+
+// waitResume blocks while the DHT is suspended
+func (dht *DHT) waitResume() {
+	dht.powerLk.Lock()
+	c := dht.suspended
+	dht.powerLk.Unlock()
+	if c != nil {
+		atomic.StoreInt64(&dht.lastGossip, 0)
+		<-c
+	}
+}
+
+// gossipBurst gossips with n of the nodes it knows picked at random, or all of them if
+// n is 0
+func (dht *DHT) gossipBurst(n int) (err error) {
+	var glist []peer.ID
+	if glist, err = dht.unforkedGossipers(); err != nil {
+		return
+	}
+	if len(glist) == 0 {
+		err = ErrDHTErrNoGossipersAvailable
+		return
+	}
+	for i, j := range rand.Perm(len(glist)) {
+		if n > 0 && i == n {
+			break
+		}
+		dht.gchan <- gossipWithReq{glist[j]}
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestSuspendResume(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("suspending should stop the background work", t, func() {
+		So(h.presence.stop, ShouldNotBeNil)
+		So(h.outbox.stop, ShouldNotBeNil)
+		h.Suspend()
+		So(h.Suspended(), ShouldBeTrue)
+		So(h.presence.stop, ShouldBeNil)
+		So(h.outbox.stop, ShouldBeNil)
+		So(h.checkGossip().OK, ShouldBeTrue)
+	})
+
+	Convey("gossip should wait while suspended", t, func() {
+		done := make(chan struct{})
+		go func() {
+			h.dht.waitResume()
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("gossip didn't wait")
+		case <-time.After(20 * time.Millisecond):
+		}
+		So(h.Resume(), ShouldBeNil)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("gossip didn't resume")
+		}
+	})
+
+	Convey("resuming should restart what was running", t, func() {
+		So(h.Suspended(), ShouldBeFalse)
+		So(h.presence.stop, ShouldNotBeNil)
+		So(h.outbox.stop, ShouldNotBeNil)
+		So(h.Resume(), ShouldBeNil)
+	})
+
+	Convey("stopping should give up on work that doesn't stop", t, func() {
+		saved := StopTimeout
+		StopTimeout = 10 * time.Millisecond
+		defer func() { StopTimeout = saved }()
+		block := make(chan struct{})
+		defer close(block)
+		start := time.Now()
+		h.stopWithin("test", func() { <-block })
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+}
+
+func TestPowerProfile(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("the power profile should be settable", t, func() {
+		So(h.dht.isLowPower(), ShouldBeFalse)
+		So(h.SetPowerProfile(PowerProfileLow), ShouldBeNil)
+		So(h.dht.isLowPower(), ShouldBeTrue)
+		So(h.SetPowerProfile(PowerProfileNormal), ShouldBeNil)
+		So(h.dht.isLowPower(), ShouldBeFalse)
+		So(h.SetPowerProfile("turbo"), ShouldNotBeNil)
+	})
+
+	Convey("bursts should gossip with several nodes at once", t, func() {
+		So(h.dht.gossipBurst(1), ShouldEqual, ErrDHTErrNoGossipersAvailable)
+		for _, id := range []string{"peer1", "peer2", "peer3"} {
+			p, _ := makePeer(id)
+			So(h.dht.UpdateGossiper(p, 0), ShouldBeNil)
+		}
+		So(h.dht.gossipBurst(2), ShouldBeNil)
+		So(len(h.dht.gchan), ShouldEqual, 2)
+		So(h.dht.gossipBurst(0), ShouldBeNil)
+		So(len(h.dht.gchan), ShouldEqual, 5)
+	})
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// presence implements tracking which agents of a holochain are currently online
+
+package holochain
+
+import (
+	"context"
+	floodsub "github.com/libp2p/go-floodsub"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// PresenceHeartbeatInterval is how often a node announces that it is online
+	PresenceHeartbeatInterval = 30 * time.Second
+
+	// PresenceTimeout is how long after it was last heard from an agent is taken to
+	// have gone offline
+	PresenceTimeout = 3 * PresenceHeartbeatInterval
+)
+
+// OnlineAgent is an agent that has been heard from recently
+type OnlineAgent struct {
+	Agent    string // the agent's node id
+	LastSeen time.Time
+}
+
+// PresenceEvent reports an agent coming online or going offline
+type PresenceEvent struct {
+	Agent  string
+	Online bool
+	Time   time.Time
+}
+
+// Presence keeps a table of the agents that have sent heartbeats or gossiped with this
+// node recently
+type Presence struct {
+	h        *Holochain
+	ps       *floodsub.PubSub
+	sub      *floodsub.Subscription
+	lk       sync.Mutex
+	agents   map[peer.ID]time.Time
+	watchers map[chan PresenceEvent]bool
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewPresence returns a presence table that uses the node's pubsub for heartbeats
+func NewPresence(h *Holochain, ps *floodsub.PubSub) *Presence {
+	p := Presence{
+		h:        h,
+		ps:       ps,
+		agents:   make(map[peer.ID]time.Time),
+		watchers: make(map[chan PresenceEvent]bool),
+	}
+	return &p
+}
+
+// Presence returns the holochain's presence table, nil until the node is activated
+func (h *Holochain) Presence() *Presence {
+	return h.presence
+}
+
+// topic returns the heartbeat topic, which is scoped to the DNA
+func (p *Presence) topic() string {
+	return p.h.dnaHash.String() + "/_presence"
+}
+
+// Start subscribes to heartbeats and starts announcing this node and expiring agents
+// that haven't been heard from
+func (p *Presence) Start() (err error) {
+	p.sub, err = p.ps.Subscribe(p.topic())
+	if err != nil {
+		return
+	}
+	p.stop = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		for {
+			m, err := p.sub.Next(ctx)
+			if err != nil {
+				return
+			}
+			p.seen(peer.ID(m.GetFrom()))
+		}
+	}()
+	go func() {
+		defer p.wg.Done()
+		defer cancel()
+		ticker := time.NewTicker(PresenceHeartbeatInterval)
+		defer ticker.Stop()
+		p.heartbeat()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case now := <-ticker.C:
+				p.heartbeat()
+				p.expire(now)
+			}
+		}
+	}()
+	return
+}
+
+// Stop stops the heartbeats and waits for them to finish
+func (p *Presence) Stop() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	p.sub.Cancel()
+	p.wg.Wait()
+	p.stop = nil
+}
+
+func (p *Presence) heartbeat() {
+	if err := p.ps.Publish(p.topic(), nil); err != nil {
+		p.h.dht.dlog.Logf("error publishing presence heartbeat: %v", err)
+	}
+}
+
+// seen records that the agent was heard from.  It is safe to call on a nil Presence
+// so that nodes not tracking presence can still report liveness.
+func (p *Presence) seen(id peer.ID) {
+	if p == nil || id == p.h.nodeID {
+		return
+	}
+	now := time.Now()
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	_, online := p.agents[id]
+	p.agents[id] = now
+	if !online {
+		p.notify(PresenceEvent{Agent: peer.IDB58Encode(id), Online: true, Time: now})
+		// a peer coming online may mean we can publish what we couldn't before
+		if p.h.outbox != nil {
+			p.h.outbox.Wake()
+		}
+	}
+}
+
+// expire removes the agents that haven't been heard from within PresenceTimeout of now
+func (p *Presence) expire(now time.Time) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	for id, t := range p.agents {
+		if now.Sub(t) > PresenceTimeout {
+			delete(p.agents, id)
+			p.notify(PresenceEvent{Agent: peer.IDB58Encode(id), Online: false, Time: now})
+		}
+	}
+}
+
+// notify sends an event to the watchers, dropping it for any that aren't keeping up.
+// It must be called with the lock held.
+func (p *Presence) notify(e PresenceEvent) {
+	for ch := range p.watchers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Online returns the agents other than this one that are currently online, most
+// recently seen first
+func (p *Presence) Online() (agents []OnlineAgent) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	agents = make([]OnlineAgent, 0, len(p.agents))
+	for id, t := range p.agents {
+		agents = append(agents, OnlineAgent{Agent: peer.IDB58Encode(id), LastSeen: t})
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].LastSeen.After(agents[j].LastSeen)
+	})
+	return
+}
+
+// Watch returns a channel of presence events which must be released with the returned
+// cancel function
+func (p *Presence) Watch() (events <-chan PresenceEvent, cancel func()) {
+	ch := make(chan PresenceEvent, 16)
+	p.lk.Lock()
+	p.watchers[ch] = true
+	p.lk.Unlock()
+	events = ch
+	cancel = func() {
+		p.lk.Lock()
+		defer p.lk.Unlock()
+		if p.watchers[ch] {
+			delete(p.watchers, ch)
+			close(ch)
+		}
+	}
+	return
+}
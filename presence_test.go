@@ -0,0 +1,78 @@
+package holochain
+
+import (
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	p := h.Presence()
+	peerA, _ := makePeer("peer_a")
+	peerB, _ := makePeer("peer_b")
+
+	Convey("presence should be started when the node is activated", t, func() {
+		So(p, ShouldNotBeNil)
+		So(len(p.Online()), ShouldEqual, 0)
+	})
+
+	Convey("seeing agents should mark them online and notify watchers", t, func() {
+		events, cancel := p.Watch()
+		defer cancel()
+		p.seen(h.nodeID)
+		p.seen(peerA)
+		p.seen(peerB)
+		p.seen(peerA)
+		online := p.Online()
+		So(len(online), ShouldEqual, 2)
+		So(online[0].Agent, ShouldEqual, peerA.Pretty())
+		So(online[1].Agent, ShouldEqual, peerB.Pretty())
+
+		e := <-events
+		So(e.Agent, ShouldEqual, peerA.Pretty())
+		So(e.Online, ShouldBeTrue)
+		e = <-events
+		So(e.Agent, ShouldEqual, peerB.Pretty())
+		So(len(events), ShouldEqual, 0)
+	})
+
+	Convey("agents not heard from should expire", t, func() {
+		events, cancel := p.Watch()
+		defer cancel()
+		p.lk.Lock()
+		p.agents[peerB] = time.Now().Add(-PresenceTimeout - time.Second)
+		p.lk.Unlock()
+		p.expire(time.Now())
+		online := p.Online()
+		So(len(online), ShouldEqual, 1)
+		So(online[0].Agent, ShouldEqual, peerA.Pretty())
+		e := <-events
+		So(e.Agent, ShouldEqual, peerB.Pretty())
+		So(e.Online, ShouldBeFalse)
+	})
+
+	Convey("cancelling a watch should close it", t, func() {
+		events, cancel := p.Watch()
+		cancel()
+		cancel()
+		_, ok := <-events
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("seen should be safe on a nil presence", t, func() {
+		var np *Presence
+		So(func() { np.seen(peerA) }, ShouldNotPanic)
+	})
+
+	Convey("getOnlineAgents should be available from the ribosome", t, func() {
+		z, _, err := h.MakeRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r, err := z.Run(`getOnlineAgents()[0].Agent`)
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, peerA.Pretty())
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// query implements reading the entries and headers of the local chain from zome code,
+// filtered by type and content and paged, without going to the DHT
+
+package holochain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	QueryOrderAscending  = "ascending" // oldest entries first, the default
+	QueryOrderDescending = "descending"
+)
+
+// QueryReturn selects what query returns for each entry, just the entries by default
+type QueryReturn struct {
+	Hashes  bool
+	Entries bool
+	Headers bool
+}
+
+// QueryConstrain filters the entries query returns by their content, as the app sees it
+type QueryConstrain struct {
+	Equals   string // the content is exactly this
+	Contains string // the content contains this
+	Matches  string // the content matches this regular expression
+}
+
+// QueryOptions are the options of the query built-in
+type QueryOptions struct {
+	EntryTypes []string // the types of the entries to return, all the app's types if none
+	Constrain  QueryConstrain
+	Order      string // QueryOrderAscending or QueryOrderDescending
+	Count      int    // the number of entries in a page, 0 for all of them
+	Page       int    // the page to return, counting from 0
+	Return     QueryReturn
+}
+
+// QueryResult is an entry returned by query when more than one thing is returned for it
+type QueryResult struct {
+	Hash   string      `json:",omitempty"`
+	Header *jsHeader   `json:",omitempty"`
+	Entry  interface{} `json:",omitempty"`
+}
+
+// checkQueryOptions checks the options and sets the defaults
+func checkQueryOptions(options *QueryOptions) (err error) {
+	switch options.Order {
+	case "":
+		options.Order = QueryOrderAscending
+	case QueryOrderAscending, QueryOrderDescending:
+	default:
+		err = fmt.Errorf("%w: query Order should be one of: %s, %s", ErrInvalidArgs, QueryOrderAscending, QueryOrderDescending)
+		return
+	}
+	if options.Count < 0 || options.Page < 0 {
+		err = fmt.Errorf("%w: query Count and Page can't be negative", ErrInvalidArgs)
+		return
+	}
+	r := &options.Return
+	if !r.Hashes && !r.Entries && !r.Headers {
+		r.Entries = true
+	}
+	return
+}
+
+// query returns the entries of the local chain selected by options: a list of the
+// entries, hashes or headers if just one of them is to be returned, otherwise a list of
+// QueryResults
+func (h *Holochain) query(options *QueryOptions) (response interface{}, err error) {
+	if err = checkQueryOptions(options); err != nil {
+		return
+	}
+	var re *regexp.Regexp
+	if c := options.Constrain.Matches; c != "" {
+		if re, err = regexp.Compile(c); err != nil {
+			err = fmt.Errorf("%w: query Matches: %v", ErrInvalidArgs, err)
+			return
+		}
+	}
+	for _, t := range options.EntryTypes {
+		if IsSystemEntryType(t) {
+			err = ErrReservedEntryType
+			return
+		}
+	}
+
+	idxs := h.chain.TypeIndexes(options.EntryTypes...)
+	if options.Order == QueryOrderDescending {
+		for i, j := 0, len(idxs)-1; i < j; i, j = i+1, j-1 {
+			idxs[i], idxs[j] = idxs[j], idxs[i]
+		}
+	}
+	skip := options.Page * options.Count
+
+	results := []QueryResult{}
+	for _, i := range idxs {
+		hd := h.chain.Headers[i]
+		var entry Entry
+		if entry, err = h.chain.Entry(i); err != nil {
+			return
+		}
+		entry = h.openEntry(entry, "")
+		c := options.Constrain
+		if c.Equals != "" || c.Contains != "" || re != nil {
+			s, _ := entryContentString(entry.Content())
+			if (c.Equals != "" && s != c.Equals) || !strings.Contains(s, c.Contains) || (re != nil && !re.MatchString(s)) {
+				continue
+			}
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		var r QueryResult
+		if options.Return.Hashes {
+			r.Hash = hd.EntryLink.String()
+		}
+		if options.Return.Entries || options.Return.Headers {
+			_, def, e := h.GetEntryDef(hd.Type)
+			if e != nil {
+				err = e
+				return
+			}
+			e2, hdr := wasmEntryValue(h, def, entry, hd)
+			if options.Return.Entries {
+				r.Entry = e2
+			}
+			if options.Return.Headers {
+				r.Header = hdr
+			}
+		}
+		results = append(results, r)
+		if options.Count > 0 && len(results) == options.Count {
+			break
+		}
+	}
+
+	ret := options.Return
+	switch {
+	case ret.Hashes && !ret.Entries && !ret.Headers:
+		hashes := make([]string, len(results))
+		for i := range results {
+			hashes[i] = results[i].Hash
+		}
+		response = hashes
+	case ret.Entries && !ret.Hashes && !ret.Headers:
+		entries := make([]interface{}, len(results))
+		for i := range results {
+			entries[i] = results[i].Entry
+		}
+		response = entries
+	case ret.Headers && !ret.Hashes && !ret.Entries:
+		headers := make([]*jsHeader, len(results))
+		for i := range results {
+			headers[i] = results[i].Header
+		}
+		response = headers
+	default:
+		response = results
+	}
+	return
+}
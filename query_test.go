@@ -0,0 +1,103 @@
+package holochain
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	h1 := commit(h, "oddNumbers", "3")
+	h2 := commit(h, "oddNumbers", "5")
+	h3 := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	h4 := commit(h, "oddNumbers", "7")
+
+	Convey("the chain should index entries by type", t, func() {
+		odd := h.chain.TypeIndexes("oddNumbers")
+		So(len(odd), ShouldEqual, 3)
+		So(h.chain.Headers[odd[0]].EntryLink.String(), ShouldEqual, h1.String())
+		So(len(h.chain.TypeIndexes()), ShouldEqual, 4)
+		So(len(h.chain.TypeIndexes("oddNumbers", "profile", "oddNumbers")), ShouldEqual, 4)
+		So(len(h.chain.TypeIndexes(AgentEntryType)), ShouldEqual, 1)
+	})
+
+	Convey("query should return the entries of the given types in chain order", t, func() {
+		r, err := h.query(&QueryOptions{EntryTypes: []string{"oddNumbers"}})
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, []interface{}{"3", "5", "7"})
+
+		r, err = h.query(&QueryOptions{})
+		So(err, ShouldBeNil)
+		So(len(r.([]interface{})), ShouldEqual, 4)
+	})
+
+	Convey("query should order and page", t, func() {
+		r, err := h.query(&QueryOptions{EntryTypes: []string{"oddNumbers"}, Order: QueryOrderDescending, Count: 2})
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, []interface{}{"7", "5"})
+		r, err = h.query(&QueryOptions{EntryTypes: []string{"oddNumbers"}, Order: QueryOrderDescending, Count: 2, Page: 1})
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, []interface{}{"3"})
+		r, err = h.query(&QueryOptions{EntryTypes: []string{"oddNumbers"}, Count: 2, Page: 2})
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, []interface{}{})
+
+		_, err = h.query(&QueryOptions{Order: "sideways"})
+		So(errors.Is(err, ErrInvalidArgs), ShouldBeTrue)
+	})
+
+	Convey("query should constrain by content", t, func() {
+		r, err := h.query(&QueryOptions{Constrain: QueryConstrain{Equals: "5"}, Return: QueryReturn{Hashes: true}})
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, []string{h2.String()})
+		r, err = h.query(&QueryOptions{Constrain: QueryConstrain{Contains: "Zippy"}, Return: QueryReturn{Hashes: true}})
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, []string{h3.String()})
+		r, err = h.query(&QueryOptions{Constrain: QueryConstrain{Matches: "^[57]$"}, Return: QueryReturn{Hashes: true}})
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, []string{h2.String(), h4.String()})
+
+		_, err = h.query(&QueryOptions{Constrain: QueryConstrain{Matches: "("}})
+		So(errors.Is(err, ErrInvalidArgs), ShouldBeTrue)
+	})
+
+	Convey("query should return headers and several things at once", t, func() {
+		r, err := h.query(&QueryOptions{EntryTypes: []string{"profile"}, Return: QueryReturn{Headers: true}})
+		So(err, ShouldBeNil)
+		hdrs := r.([]*jsHeader)
+		So(len(hdrs), ShouldEqual, 1)
+		So(hdrs[0].Type, ShouldEqual, "profile")
+
+		r, err = h.query(&QueryOptions{EntryTypes: []string{"oddNumbers"}, Count: 1, Return: QueryReturn{Hashes: true, Entries: true}})
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, []QueryResult{{Hash: h1.String(), Entry: "3"}})
+	})
+
+	Convey("query shouldn't read system entries", t, func() {
+		_, err := h.query(&QueryOptions{EntryTypes: []string{AgentEntryType}})
+		So(err, ShouldEqual, ErrReservedEntryType)
+	})
+
+	Convey("query should be callable from zome code", t, func() {
+		zome, _ := h.GetZome("jsSampleZome")
+		v, _ := NewJSRibosome(h, zome)
+		z := v.(*JSRibosome)
+		_, err := z.Run(`JSON.stringify(query({EntryTypes:["oddNumbers"],Order:"descending",Count:1,Return:{Hashes:true,Entries:true}}))`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, `[{"Hash":"`+h4.String()+`","Entry":"7"}]`)
+		_, err = z.Run(`JSON.stringify(query({EntryTypes:["profile"]}))`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, `[{"firstName":"Zippy","lastName":"Pinhead"}]`)
+		_, err = z.Run(`query({EntryTypes:"profile"})`)
+		So(err, ShouldNotBeNil)
+
+		zome, _ = h.GetZome("zySampleZome")
+		v, _ = NewZygoRibosome(h, zome)
+		zy := v.(*ZygoRibosome)
+		_, err = zy.Run(`(query (hash EntryTypes:["oddNumbers"] Return:(hash Hashes:true)))`)
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,208 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// quota implements limiting the disk space the DHT store of a holochain may use
+
+package holochain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// policies for what to do when a put would take the DHT store over its quota
+const (
+	DHTQuotaReject = "reject" // refuse the put
+	DHTQuotaEvict  = "evict"  // make room by dropping the entries farthest from this node
+)
+
+// DHTQuotaWarnLevel is the fraction of the quota over which warnings are logged
+const DHTQuotaWarnLevel = 0.9
+
+// EvictionTombstoneTTL is how long puts of an evicted hash from other nodes are refused,
+// so that gossip doesn't bring it straight back
+var EvictionTombstoneTTL = 24 * time.Hour
+
+var ErrDHTQuotaExceeded = errors.New("DHT storage quota exceeded")
+var ErrEvicted = errors.New("hash was evicted to stay within the DHT storage quota")
+
+func validateQuotaPolicy(policy string) (err error) {
+	switch policy {
+	case "", DHTQuotaReject, DHTQuotaEvict:
+	default:
+		err = fmt.Errorf("unknown DHT quota policy: %s", policy)
+	}
+	return
+}
+
+// updateStored runs fn in a read-write transaction and adds the change in stored entry
+// bytes it returns to storedBytes before the transaction ends, so that quota checks in
+// later transactions see it
+func (dht *DHT) updateStored(fn func(tx *buntdb.Tx) (int64, error)) (err error) {
+	var added int64
+	err = dht.update(func(tx *buntdb.Tx) error {
+		n, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		added = n
+		atomic.AddInt64(&dht.storedBytes, added)
+		return nil
+	})
+	if err != nil {
+		atomic.AddInt64(&dht.storedBytes, -added)
+	}
+	return
+}
+
+// _makeRoom checks that size more bytes for the hash k fit in the store's quota,
+// evicting entries to make room if that's the policy, and returns the bytes evicted, which
+// it may have done even if it then returns ErrDHTQuotaExceeded.  It
+// runs in the transaction that stores the put so nothing else can take the room first.
+// Entries put by this node aren't subject to the quota.
+func (dht *DHT) _makeRoom(tx *buntdb.Tx, src peer.ID, k string, size int64) (freed int64, err error) {
+	quota := dht.h.config.DHTQuota
+	if quota <= 0 || src == dht.h.nodeID {
+		return
+	}
+	if _, e := tx.Get("evicted:" + k); e == nil {
+		err = ErrEvicted
+		return
+	}
+	used := atomic.LoadInt64(&dht.storedBytes)
+	if used+size > quota && dht.h.config.DHTQuotaPolicy == DHTQuotaEvict {
+		freed, err = dht._evictFarthest(tx, used+size-quota, k)
+		if err != nil {
+			return
+		}
+		used -= freed
+	}
+	if used+size > quota {
+		dht.h.config.Loggers.App.Logf("warning: DHT store is full at %d of its %d byte quota, rejecting put", used, quota)
+		err = ErrDHTQuotaExceeded
+		return
+	}
+	warnAt := int64(float64(quota) * DHTQuotaWarnLevel)
+	if used+size > warnAt {
+		// warn once each time the level is crossed
+		if atomic.CompareAndSwapInt32(&dht.quotaWarned, 0, 1) {
+			dht.h.config.Loggers.App.Logf("warning: DHT store is at %d of its %d byte quota", used+size, quota)
+		}
+	} else {
+		atomic.StoreInt32(&dht.quotaWarned, 0)
+	}
+	return
+}
+
+// hashDistance returns the distance in the keyspace between a hash and a node, as bytes
+// that compare in order of distance
+func hashDistance(hash []byte, node []byte) []byte {
+	return keyspaceDistance(keyspaceLoc(hash), keyspaceLoc(node))
+}
+
+// _evictFarthest removes unpinned entries put by other nodes, other than keep, those
+// farthest from this node first, until at least need bytes are freed or there are none
+// left, returning the bytes freed.  Each evicted hash leaves a tombstone.
+func (dht *DHT) _evictFarthest(tx *buntdb.Tx, need int64, keep string) (freed int64, err error) {
+	me := peer.IDB58Encode(dht.h.nodeID)
+	type candidate struct {
+		key      string
+		distance []byte
+	}
+	var candidates []candidate
+	err = tx.AscendKeys("src:*", func(key, value string) bool {
+		if value == me {
+			return true
+		}
+		k := key[len("src:"):]
+		if k == keep || _isPinned(tx, k) {
+			return true
+		}
+		h, e := NewHash(k)
+		if e != nil {
+			return true
+		}
+		candidates = append(candidates, candidate{key: k, distance: hashDistance(h.H, []byte(dht.h.nodeID))})
+		return true
+	})
+	if err != nil {
+		return
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return bytes.Compare(candidates[i].distance, candidates[j].distance) > 0
+	})
+
+	var evicted int
+	for _, c := range candidates {
+		if freed >= need {
+			break
+		}
+		val, e := tx.Get("entry:" + c.key)
+		if e != nil && e != buntdb.ErrNotFound {
+			err = e
+			return
+		}
+		if err = _evict(tx, c.key); err != nil {
+			return
+		}
+		freed += int64(len(val))
+		evicted++
+	}
+	if evicted > 0 {
+		dht.h.config.Loggers.App.Logf("warning: evicting %d entries (%d bytes) from the DHT store to stay within its quota", evicted, freed)
+	}
+	return
+}
+
+// _evict deletes everything stored about a hash including the links, backlinks and
+// receipts on it, leaving a tombstone so that puts of it are refused for a while
+func _evict(tx *buntdb.Tx, k string) (err error) {
+	for _, prefix := range []string{"entry:", "sum:", "type:", "src:", "status:", "history:", "replacedBy:", "meta:", "expires:"} {
+		_, err = tx.Delete(prefix + k)
+		if err != nil && err != buntdb.ErrNotFound {
+			return
+		}
+	}
+	var links []string
+	err = tx.Ascend("link", func(key, value string) bool {
+		if strings.HasPrefix(key, "link:"+k+":") {
+			links = append(links, key)
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	var receipts []string
+	err = tx.AscendKeys("receipt:"+k+":*", func(key, value string) bool {
+		receipts = append(receipts, key)
+		return true
+	})
+	if err != nil {
+		return
+	}
+	for _, prefix := range []string{"backlink:", "linktime:", "linksort:"} {
+		err = tx.AscendKeys(prefix+k+":*", func(key, value string) bool {
+			receipts = append(receipts, key)
+			return true
+		})
+		if err != nil {
+			return
+		}
+	}
+	for _, key := range append(links, receipts...) {
+		if _, err = tx.Delete(key); err != nil {
+			return
+		}
+	}
+	_, _, err = tx.Set("evicted:"+k, "", &buntdb.SetOptions{Expires: true, TTL: EvictionTombstoneTTL})
+	return
+}
@@ -0,0 +1,119 @@
+package holochain
+
+import (
+	"bytes"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDHTQuota(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dht := h.dht
+	var buf bytes.Buffer
+	h.config.Loggers.App.Enabled = true
+	h.config.Loggers.App.New(&buf)
+
+	var other peer.ID
+	hash1, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1")
+	hash2, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	hash3, _ := NewHash("QmZcUPvPhD1Xvk6mwijYF8AfR3mG31S1YsEfHG4khrFPRr")
+	used := atomic.LoadInt64(&dht.storedBytes)
+	h.config.DHTQuota = used + 10
+
+	Convey("it should validate the policy", t, func() {
+		So(validateQuotaPolicy(""), ShouldBeNil)
+		So(validateQuotaPolicy(DHTQuotaEvict), ShouldBeNil)
+		So(validateQuotaPolicy("bogus").Error(), ShouldEqual, "unknown DHT quota policy: bogus")
+	})
+
+	Convey("it should reject puts over the quota and warn near it", t, func() {
+		err := dht.put(nil, "someType", hash1, other, []byte("12345"), StatusLive)
+		So(err, ShouldBeNil)
+
+		err = dht.put(nil, "someType", hash2, other, []byte("1234"), StatusLive)
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, "warning: DHT store is at")
+
+		err = dht.put(nil, "someType", hash3, other, []byte("12"), StatusLive)
+		So(err, ShouldEqual, ErrDHTQuotaExceeded)
+		So(dht.exists(hash3, StatusDefault), ShouldEqual, ErrHashNotFound)
+	})
+
+	Convey("it should not apply the quota to this node's own puts", t, func() {
+		err := dht.put(nil, "someType", hash3, h.nodeID, []byte("12"), StatusLive)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should evict the farthest entries when that's the policy", t, func() {
+		h.config.DHTQuotaPolicy = DHTQuotaEvict
+		h.config.DHTQuota = atomic.LoadInt64(&dht.storedBytes)
+		far, near := hash1, hash2
+		if bytes.Compare(hashDistance(hash1.H, []byte(h.nodeID)), hashDistance(hash2.H, []byte(h.nodeID))) < 0 {
+			far, near = hash2, hash1
+		}
+		for _, hash := range []Hash{far, near} {
+			So(dht.update(func(tx *buntdb.Tx) error {
+				_, _, err := tx.Set("expires:"+hash.String(), "0", nil)
+				return err
+			}), ShouldBeNil)
+		}
+		hash4, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+		err := dht.put(nil, "someType", hash4, other, []byte("1"), StatusLive)
+		So(err, ShouldBeNil)
+		So(dht.exists(far, StatusDefault), ShouldEqual, ErrHashNotFound)
+		So(dht.exists(near, StatusDefault), ShouldBeNil)
+		So(dht.exists(hash4, StatusDefault), ShouldBeNil)
+		So(dht.view(func(tx *buntdb.Tx) error {
+			_, err := tx.Get("expires:" + far.String())
+			So(err, ShouldEqual, buntdb.ErrNotFound)
+			_, err = tx.Get("expires:" + near.String())
+			So(err, ShouldBeNil)
+			return nil
+		}), ShouldBeNil)
+		// this node's own entries are never evicted
+		So(dht.exists(hash3, StatusDefault), ShouldBeNil)
+		n, err := dht.countStoredBytes()
+		So(err, ShouldBeNil)
+		So(atomic.LoadInt64(&dht.storedBytes), ShouldEqual, n)
+	})
+
+	Convey("evicted entries should not be taken back while their tombstone lasts", t, func() {
+		h.config.DHTQuota = atomic.LoadInt64(&dht.storedBytes) + 100
+		var far Hash
+		if dht.exists(hash1, StatusDefault) == ErrHashNotFound {
+			far = hash1
+		} else {
+			far = hash2
+		}
+		err := dht.put(nil, "someType", far, other, []byte("12345"), StatusLive)
+		So(err, ShouldEqual, ErrEvicted)
+		So(dht.exists(far, StatusDefault), ShouldEqual, ErrHashNotFound)
+
+		// this node's own puts aren't refused
+		err = dht.put(nil, "someType", far, h.nodeID, []byte("12345"), StatusLive)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("applying puts should check the quota in the transaction that stores them", t, func() {
+		h.config.DHTQuotaPolicy = DHTQuotaReject
+		h.config.DHTQuota = atomic.LoadInt64(&dht.storedBytes) + 3
+		hash5, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh5")
+		hash6, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh6")
+		m := h.node.NewMessage(PUT_REQUEST, PutReq{H: hash5})
+		m.From = other
+		err := dht.applyPuts([]*validatedPut{
+			{msg: m, entryType: "someType", key: hash5, value: []byte("12"), status: StatusLive},
+			{msg: m, entryType: "someType", key: hash6, value: []byte("12"), status: StatusLive},
+		})
+		So(err, ShouldBeNil)
+		So(dht.exists(hash5, StatusDefault), ShouldBeNil)
+		So(dht.exists(hash6, StatusDefault), ShouldEqual, ErrHashNotFound)
+		n, err := dht.countStoredBytes()
+		So(err, ShouldBeNil)
+		So(atomic.LoadInt64(&dht.storedBytes), ShouldEqual, n)
+	})
+}
@@ -0,0 +1,208 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// recovery implements regenerating a lost local source chain from the DHT
+
+package holochain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var ErrChainNotEmpty = errors.New("chain not empty")
+var ErrNoHeadersFound = errors.New("no headers found")
+
+// RegenerateChain rebuilds the local source chain after data loss from the headers and
+// entries the agent published to the DHT.  Headers are checked against the agent's
+// public key and followed in order from the DNA header.  Regeneration stops at the first
+// link that can't be recovered (e.g. a private entry), so the resulting chain is the
+// longest verified prefix of the original.  It returns the number of entries recovered.
+func (h *Holochain) RegenerateChain() (count int, err error) {
+	if h.chain.Length() > 0 {
+		err = ErrChainNotEmpty
+		return
+	}
+
+	var headers []Header
+	headers, err = h.collectSourceHeaders()
+	if err != nil {
+		return
+	}
+
+	// index the verified headers by the hash of the header they link back to
+	pub := h.agent.PubKey()
+	seen := make(map[string]bool)
+	next := make(map[string][]*Header)
+	for i := range headers {
+		hd := &headers[i]
+		var hash Hash
+		hash, _, err = hd.Sum(h.hashSpec)
+		if err != nil {
+			return
+		}
+		if seen[hash.String()] {
+			continue
+		}
+		seen[hash.String()] = true
+		data, e := hd.signedData()
+		if e != nil {
+			h.dht.dlog.Logf("regenerate: ignoring header %v with bad meta", hash)
+			continue
+		}
+		var valid bool
+		_, def, defErr := h.GetEntryDef(hd.Type)
+		if defErr == nil && def.Ephemeral && hd.Sig.Key != nil {
+			// ephemeral entries are signed with keys that nothing ties to us
+			valid, e = hd.Sig.VerifyOneTime(data)
+		} else {
+			valid, e = hd.Sig.Verify(pub, data)
+		}
+		if e != nil || !valid {
+			h.dht.dlog.Logf("regenerate: ignoring header %v with bad signature", hash)
+			continue
+		}
+		prev := hd.HeaderLink.String()
+		next[prev] = append(next[prev], hd)
+	}
+
+	prev := NullHash()
+	var prevHeader *Header
+	for {
+		candidates := next[prev.String()]
+		if len(candidates) == 0 {
+			break
+		}
+		if len(candidates) > 1 {
+			h.dht.dlog.Logf("regenerate: chain forks after %v, stopping", prev)
+			break
+		}
+		hd := candidates[0]
+		if prevHeader != nil && hd.Time.Before(prevHeader.Time) {
+			h.dht.dlog.Logf("regenerate: header after %v is out of order, stopping", prev)
+			break
+		}
+
+		var entry Entry
+		entry, err = h.regenerateEntry(count, hd)
+		if err != nil {
+			if count == 0 {
+				return
+			}
+			h.dht.dlog.Logf("regenerate: unable to recover entry %v: %v", hd.EntryLink, err)
+			err = nil
+			break
+		}
+
+		var hash Hash
+		hash, _, err = hd.Sum(h.hashSpec)
+		if err != nil {
+			return
+		}
+		err = h.chain.addEntry(count, hash, hd, entry)
+		if err != nil {
+			return
+		}
+		count++
+		prev = hash
+		prevHeader = hd
+	}
+
+	if count == 0 {
+		err = ErrNoHeadersFound
+		return
+	}
+
+	h.dnaHash = h.chain.Headers[0].EntryLink.Clone()
+	if e := h.agentChanged(); e != nil {
+		h.dht.dlog.Logf("regenerate: error publishing agent entries: %v", e)
+	}
+	if !fileExists(h.rootPath, DNAHashFileName) {
+		err = writeFile([]byte(h.dnaHash.String()), h.rootPath, DNAHashFileName)
+	}
+	return
+}
+
+// collectSourceHeaders asks the DHT and any known gossipers for the headers the agent published
+func (h *Holochain) collectSourceHeaders() (headers []Header, err error) {
+	req := HeadersReq{Source: h.nodeID}
+	var r interface{}
+	r, err = h.doAction("", NewGetHeadersAction(req))
+	if err != nil {
+		return
+	}
+	headers = r.(HeadersResp).Headers
+
+	var gossipers []peer.ID
+	gossipers, err = h.dht.getGossipers()
+	if err != nil {
+		return
+	}
+	for _, g := range gossipers {
+		r, e := h.dht.send(g, GET_HEADERS_REQUEST, req)
+		if e != nil {
+			h.dht.dlog.Logf("regenerate: unable to get headers from %v: %v", g, e)
+			continue
+		}
+		if resp, ok := r.(HeadersResp); ok {
+			headers = append(headers, resp.Headers...)
+		}
+	}
+	return
+}
+
+// regenerateEntry gets the entry for the header at position idx and confirms it matches
+// the header's entry link
+func (h *Holochain) regenerateEntry(idx int, hd *Header) (entry Entry, err error) {
+	if idx == 0 {
+		if hd.Type != DNAEntryType {
+			err = fmt.Errorf("expected first header to be %s, got %s", DNAEntryType, hd.Type)
+			return
+		}
+		// the DNA entry is never put to the DHT but we have it locally
+		var buf bytes.Buffer
+		err = h.EncodeDNA(&buf)
+		if err != nil {
+			return
+		}
+		entry = &GobEntry{C: buf.Bytes()}
+	} else {
+		var r interface{}
+		r, err = h.dht.Send(hd.EntryLink, GET_REQUEST, GetReq{H: hd.EntryLink, StatusMask: StatusAny, GetMask: GetMaskEntry | GetMaskEntryType})
+		if err != nil {
+			return
+		}
+		resp, ok := r.(GetResp)
+		if !ok {
+			err = fmt.Errorf("expected GetResp response from GET_REQUEST, got: %T", r)
+			return
+		}
+		entry = resp.Entry
+		if resp.EntryType == AgentEntryType {
+			// agent entries are returned as their raw marshaled bytes
+			var e GobEntry
+			var c string
+			if c, err = systemEntryContent(resp.Entry); err != nil {
+				return
+			}
+			err = e.Unmarshal([]byte(c))
+			if err != nil {
+				return
+			}
+			entry = &e
+		}
+	}
+
+	var hash Hash
+	hash, err = entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	if !hash.Equal(&hd.EntryLink) {
+		err = fmt.Errorf("entry hash mismatch for %v", hd.EntryLink)
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loseChain simulates local data loss of the source chain
+func loseChain(h *Holochain) {
+	h.chain.s.Close()
+	path := filepath.Join(h.DBPath(), StoreFileName)
+	err := os.Remove(path)
+	if err != nil {
+		panic(err)
+	}
+	h.chain, err = NewChainFromFile(h.hashSpec, path)
+	if err != nil {
+		panic(err)
+	}
+	h.dnaHash = Hash{}
+	h.agentHash = Hash{}
+}
+
+func TestRegenerateChain(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	commit(h, "oddNumbers", "3")
+	commit(h, "oddNumbers", "5")
+	original := h.chain
+	dnaHash := h.DNAHash()
+	agentHash := h.AgentHash()
+
+	Convey("it should fail if the chain isn't empty", t, func() {
+		_, err := h.RegenerateChain()
+		So(err, ShouldEqual, ErrChainNotEmpty)
+	})
+
+	Convey("the DHT should hold the published headers", t, func() {
+		headers, err := h.dht.getHeaders(h.nodeID)
+		So(err, ShouldBeNil)
+		So(len(headers), ShouldEqual, 4)
+	})
+
+	Convey("it should regenerate the chain from the DHT", t, func() {
+		loseChain(h)
+		So(h.chain.Length(), ShouldEqual, 0)
+
+		count, err := h.RegenerateChain()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, original.Length())
+		So(h.DNAHash().String(), ShouldEqual, dnaHash.String())
+		So(h.AgentHash().String(), ShouldEqual, agentHash.String())
+		for i := range original.Hashes {
+			So(h.chain.Hashes[i].String(), ShouldEqual, original.Hashes[i].String())
+		}
+		So(h.chain.Validate(false), ShouldBeNil)
+	})
+
+	Convey("the regenerated chain should be persisted", t, func() {
+		c, err := NewChainFromFile(h.hashSpec, filepath.Join(h.DBPath(), StoreFileName))
+		So(err, ShouldBeNil)
+		So(c.Length(), ShouldEqual, original.Length())
+	})
+
+	Convey("it should stop at entries that weren't published", t, func() {
+		commit(h, "secret", "31415")
+		commit(h, "oddNumbers", "7")
+		l := h.chain.Length()
+		loseChain(h)
+
+		count, err := h.RegenerateChain()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, l-2)
+	})
+}
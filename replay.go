@@ -0,0 +1,294 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// replay implements recording the messages that change a node's DHT, with the responses
+// to the requests it sent while handling them, so that the DHT can be rebuilt from the
+// node's DNA, agent, chain and messages to find when and why it diverged
+
+package holochain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MessageLogFileName is the file in the data directory the messages are recorded in
+const MessageLogFileName = "messages.log"
+
+// kinds of message log record
+const (
+	msgLogReceived = iota + 1 // a message received that changes the DHT
+	msgLogResponse            // a request sent to another node and its response
+)
+
+var ErrNoRecordedResponse = errors.New("no recorded response")
+
+// msgLogRecord is a record in the message log
+type msgLogRecord struct {
+	Kind     int
+	To       peer.ID
+	Msg      Message
+	Response Message
+}
+
+// messageLog appends records to a file, each gob encoded on its own so that the file
+// can be appended to across restarts, and prefixed by its length
+type messageLog struct {
+	lk sync.Mutex
+	f  *os.File
+}
+
+func openMessageLog(path string) (l *messageLog, err error) {
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return
+	}
+	l = &messageLog{f: f}
+	return
+}
+
+func (l *messageLog) record(r *msgLogRecord) (err error) {
+	var b bytes.Buffer
+	if err = gob.NewEncoder(&b).Encode(r); err != nil {
+		return
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.f == nil {
+		return
+	}
+	if err = binary.Write(l.f, binary.LittleEndian, uint64(b.Len())); err != nil {
+		return
+	}
+	_, err = l.f.Write(b.Bytes())
+	return
+}
+
+func (l *messageLog) close() (err error) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.f != nil {
+		err = l.f.Close()
+		l.f = nil
+	}
+	return
+}
+
+// readMessageLog returns the records of the message log at path
+func readMessageLog(path string) (records []msgLogRecord, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		var l uint64
+		if err = binary.Read(r, binary.LittleEndian, &l); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		b := make([]byte, l)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return
+		}
+		var rec msgLogRecord
+		if err = gob.NewDecoder(bytes.NewReader(b)).Decode(&rec); err != nil {
+			return
+		}
+		records = append(records, rec)
+	}
+}
+
+// recordReceived records a message that changes the DHT before it is applied
+func (h *Holochain) recordReceived(m *Message) {
+	if h.msgLog == nil {
+		return
+	}
+	if err := h.msgLog.record(&msgLogRecord{Kind: msgLogReceived, Msg: *m}); err != nil {
+		h.dht.dlog.Logf("error recording message: %v", err)
+	}
+}
+
+// recordResponse records a request sent to another node and its response
+func (h *Holochain) recordResponse(to peer.ID, m *Message, r *Message) {
+	if h.msgLog == nil {
+		return
+	}
+	if err := h.msgLog.record(&msgLogRecord{Kind: msgLogResponse, To: to, Msg: *m, Response: *r}); err != nil {
+		h.dht.dlog.Logf("error recording response: %v", err)
+	}
+}
+
+// requestKey identifies a request by who it is to and what it is, but not when it was
+// sent, so that a replayed request finds the response to the recorded one
+func requestKey(to peer.ID, m *Message) (key string, err error) {
+	r := *m
+	r.Time = time.Time{}
+	var f Hash
+	if f, err = r.Fingerprint(); err != nil {
+		return
+	}
+	key = peer.IDB58Encode(to) + ":" + f.String()
+	return
+}
+
+// replayResponses answers the requests a replaying node sends with the responses
+// recorded when they were first sent, in the order they were recorded
+type replayResponses struct {
+	lk        sync.Mutex
+	responses map[string][]Message
+}
+
+func newReplayResponses(records []msgLogRecord) (r *replayResponses, err error) {
+	r = &replayResponses{responses: make(map[string][]Message)}
+	for i := range records {
+		rec := &records[i]
+		if rec.Kind != msgLogResponse {
+			continue
+		}
+		var k string
+		if k, err = requestKey(rec.To, &rec.Msg); err != nil {
+			return
+		}
+		r.responses[k] = append(r.responses[k], rec.Response)
+	}
+	return
+}
+
+func (r *replayResponses) response(to peer.ID, m *Message) (response Message, err error) {
+	var k string
+	if k, err = requestKey(to, m); err != nil {
+		return
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	rs := r.responses[k]
+	if len(rs) == 0 {
+		err = fmt.Errorf("%w for %v to %v", ErrNoRecordedResponse, m.Type, to)
+		return
+	}
+	response = rs[0]
+	// the last response answers any repeats of the request
+	if len(rs) > 1 {
+		r.responses[k] = rs[1:]
+	}
+	return
+}
+
+// Replay rebuilds the DHT of the holochain called name in a copy of it at dest from
+// its DNA, agent, chain and message log, which it must have been recording.  Only the
+// first n received messages are replayed, or all of them if n is 0, so that bisecting
+// on n finds the message at which the DHT diverged.  Requests the node sent are
+// answered from the log rather than the network.  The copy is returned unactivated,
+// with how many messages were replayed, and the caller closes it.
+func (s *Service) Replay(name string, dest string, n int) (h *Holochain, replayed int, err error) {
+	root := filepath.Join(s.Path, name)
+	var records []msgLogRecord
+	if records, err = readMessageLog(filepath.Join(root, ChainDataDir, MessageLogFileName)); err != nil {
+		return
+	}
+	if err = CopyDir(root, dest); err != nil {
+		return
+	}
+	for _, f := range []string{DHTStoreFileName, MessageLogFileName} {
+		if err = os.RemoveAll(filepath.Join(dest, ChainDataDir, f)); err != nil {
+			return
+		}
+	}
+	if !fileExists(dest, PrivKeyFileName) {
+		var agent Agent
+		if agent, err = LoadAgent(s.Path); err != nil {
+			return
+		}
+		if err = SaveAgent(dest, agent); err != nil {
+			return
+		}
+	}
+
+	// the copy must not reach the network or record anything of its own
+	var format string
+	if format, err = findDNA(filepath.Join(dest, ChainDNADir)); err != nil {
+		return
+	}
+	var config Config
+	p := filepath.Join(dest, ConfigFileName+"."+format)
+	if err = decodeFile(p, format, &config); err != nil {
+		return
+	}
+	config.Port = 0
+	config.BootstrapServer = ""
+	config.EnableMDNS = false
+	config.AuditLog = false
+	config.RecordMessages = false
+	if err = encodeFile(p, format, &config); err != nil {
+		return
+	}
+
+	rs := &Service{Settings: s.Settings, Path: filepath.Dir(dest), DefaultAgent: s.DefaultAgent}
+	if h, err = rs.load(filepath.Base(dest), format); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			h.Close()
+			h = nil
+		}
+	}()
+	if h.replaying, err = newReplayResponses(records); err != nil {
+		return
+	}
+	if err = h.dht.SetupDHT(); err != nil {
+		return
+	}
+	for i := range records {
+		if n > 0 && replayed == n {
+			break
+		}
+		if records[i].Kind != msgLogReceived {
+			continue
+		}
+		// messages that failed when they were received fail again when replayed
+		if _, e := ActionReceiver(h, &records[i].Msg); e != nil {
+			h.dht.dlog.Logf("replayed message %d failed: %v", replayed, e)
+		}
+		replayed++
+	}
+	return
+}
+
+func decodeFile(path string, format string, data interface{}) (err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+	err = Decode(f, format, data)
+	return
+}
+
+func encodeFile(path string, format string, data interface{}) (err error) {
+	var f *os.File
+	if f, err = os.Create(path); err != nil {
+		return
+	}
+	defer f.Close()
+	err = Encode(f, format, data)
+	return
+}
@@ -0,0 +1,77 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	d, s, h := setupTestChain("test")
+	defer CleanupTestDir(d)
+	h.config.RecordMessages = true
+	if err := h.setupConfig(); err != nil {
+		panic(err)
+	}
+	if _, err := h.GenChain(); err != nil {
+		panic(err)
+	}
+	if err := h.Activate(); err != nil {
+		panic(err)
+	}
+
+	hash := commit(h, "oddNumbers", "7")
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	commit(h, "rating", fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, hash.String(), profileHash.String()))
+	held, _ := h.dht.HeldHashes("", "")
+
+	Convey("the messages that change the DHT should be recorded", t, func() {
+		records, err := readMessageLog(filepath.Join(h.DBPath(), MessageLogFileName))
+		So(err, ShouldBeNil)
+		So(len(records), ShouldBeGreaterThan, 0)
+		So(records[0].Kind, ShouldEqual, msgLogReceived)
+		So(changesDHT(records[0].Msg.Type), ShouldBeTrue)
+	})
+
+	Convey("replaying the messages should rebuild the DHT", t, func() {
+		r, n, err := s.Replay("test", filepath.Join(d, "replay"), 0)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		So(n, ShouldBeGreaterThan, 1)
+		replayed, err := r.dht.HeldHashes("", "")
+		So(err, ShouldBeNil)
+		So(replayed, ShouldResemble, held)
+		links, err := r.dht.getLink(hash, "4stars", StatusLive)
+		So(err, ShouldBeNil)
+		So(links[0].H, ShouldEqual, profileHash.String())
+	})
+
+	Convey("replaying some of the messages should rebuild the DHT up to them", t, func() {
+		r, n, err := s.Replay("test", filepath.Join(d, "replay1"), 1)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		So(n, ShouldEqual, 1)
+		replayed, err := r.dht.HeldHashes("", "")
+		So(err, ShouldBeNil)
+		So(len(replayed), ShouldBeLessThan, len(held))
+	})
+
+	Convey("requests should be answered with their recorded responses", t, func() {
+		other, _ := makePeer("peer_other")
+		m := h.node.NewMessage(GET_REQUEST, GetReq{H: hash})
+		rs, err := newReplayResponses([]msgLogRecord{{Kind: msgLogResponse, To: other, Msg: *m, Response: Message{Type: OK_RESPONSE, Body: "fish"}}})
+		So(err, ShouldBeNil)
+
+		// sent again later
+		m = h.node.NewMessage(GET_REQUEST, GetReq{H: hash})
+		r, err := rs.response(other, m)
+		So(err, ShouldBeNil)
+		So(r.Body, ShouldEqual, "fish")
+
+		_, err = rs.response(h.nodeID, m)
+		So(err.Error(), ShouldStartWith, ErrNoRecordedResponse.Error())
+		_, err = rs.response(other, h.node.NewMessage(GET_REQUEST, GetReq{H: profileHash}))
+		So(err.Error(), ShouldStartWith, ErrNoRecordedResponse.Error())
+	})
+}
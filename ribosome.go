@@ -30,6 +30,8 @@ const (
 	AUTHENTICATED_EXPOSURE = "auth"
 	// PUBLIC_EXPOSURE means that the function is callable by anyone
 	PUBLIC_EXPOSURE = "public"
+	// BRIDGE_EXPOSURE means that the function is callable by apps bridged to this one
+	BRIDGE_EXPOSURE = "bridge"
 
 	// these constants are for a removed feature, see ChangeAppProperty
 	// @TODO figure out how to remove code over time that becomes obsolete, i.e. for long-dead changes
@@ -39,13 +41,17 @@ const (
 	AGENT_NAME_PROPERTY = "_agent_name"
 )
 
-var ValidationFailedErr = errors.New("Validation Failed")
+// ValidationFailedErr is the old name of ErrValidationFailed
+var ValidationFailedErr = ErrValidationFailed
 
 // FunctionDef holds the name and calling type of an DNA exposed function
 type FunctionDef struct {
 	Name        string
 	CallingType string
 	Exposure    string
+	// ReadOnly functions don't commit or otherwise change anything, so the web server
+	// lets them be called with GET, which a page on another site can make a browser do
+	ReadOnly bool
 }
 
 // ValidExposure verifies that the function can be called in the given context
@@ -67,6 +73,15 @@ type Ribosome interface {
 	Run(code string) (result interface{}, err error)
 }
 
+// ErrRibosomeTimeout is returned when zome code runs past its zome's ExecutionTimeout
+var ErrRibosomeTimeout = fmt.Errorf("%w: zome code ran past its execution timeout", ErrTimeout)
+var ErrExecutionTimeoutUnsupported = errors.New("execution timeouts are only supported for javascript and zygo zomes")
+
+// Interrupter is implemented by ribosomes that can abort a running call
+type Interrupter interface {
+	Interrupt()
+}
+
 var ribosomeFactories = make(map[string]RibosomeFactory)
 
 // RegisterRibosome sets up a Ribosome to be used by the CreateRibosome function
@@ -85,6 +100,7 @@ func RegisterRibosome(name string, factory RibosomeFactory) {
 func RegisterBultinRibosomes() {
 	RegisterRibosome(ZygoRibosomeType, NewZygoRibosome)
 	RegisterRibosome(JSRibosomeType, NewJSRibosome)
+	RegisterRibosome(WASMRibosomeType, NewWASMRibosome)
 }
 
 // CreateRibosome returns a new Ribosome of the given type
@@ -0,0 +1,280 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// schedule implements running zome functions periodically as declared in the DNA
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ScheduleBackoffBase is the delay added after the first failed scheduled call; it
+	// doubles with each consecutive failure up to ScheduleBackoffMax
+	ScheduleBackoffBase = 10 * time.Second
+	ScheduleBackoffMax  = time.Hour
+)
+
+var ErrBadSchedule = errors.New("schedule must have exactly one of Interval or Cron")
+
+// ScheduleDef declares a zome function the node should call periodically.  Exactly one
+// of Interval (a duration like "10m") or Cron (a five field spec like "*/5 * * * *")
+// must be given.  Jitter is an optional maximum random delay added to each run.
+type ScheduleDef struct {
+	Function string
+	Interval string
+	Cron     string
+	Jitter   string
+}
+
+// schedule is a parsed ScheduleDef
+type schedule struct {
+	zome     string
+	fn       *FunctionDef
+	interval time.Duration
+	cron     *cronSpec
+	jitter   time.Duration
+	failures int
+}
+
+// Scheduler runs the scheduled functions of a holochain
+type Scheduler struct {
+	h         *Holochain
+	schedules []*schedule
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// cronSpec holds the allowed values of each field of a cron spec as bit sets
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronFieldRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// parseCron parses a standard five field cron spec: minute hour day-of-month month
+// day-of-week. Fields may be *, numbers, ranges (a-b), lists (a,b) and steps (*/n, a-b/n).
+func parseCron(spec string) (c *cronSpec, err error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		err = fmt.Errorf("cron spec %q must have 5 fields", spec)
+		return
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		bits[i], err = parseCronField(f, cronFieldRanges[i][0], cronFieldRanges[i][1])
+		if err != nil {
+			err = fmt.Errorf("cron spec %q: %w", spec, err)
+			return
+		}
+	}
+	c = &cronSpec{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	return
+}
+
+func parseCronField(field string, min int, max int) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				err = fmt.Errorf("bad step in %q", part)
+				return
+			}
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			if i := strings.Index(part, "-"); i >= 0 {
+				lo, err = strconv.Atoi(part[:i])
+				if err == nil {
+					hi, err = strconv.Atoi(part[i+1:])
+				}
+			} else {
+				lo, err = strconv.Atoi(part)
+				hi = lo
+			}
+			if err != nil || lo < min || hi > max || lo > hi {
+				err = fmt.Errorf("bad value %q", part)
+				return
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	// as in standard cron, if both day fields are restricted either may match
+	if !c.domStar && !c.dowStar {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next returns the first time after t that matches the spec in t's location.  Minutes and
+// hours are stepped by their local clock values rather than with Truncate, which works on
+// absolute time and misses the hour in zones whose offset isn't a whole number of hours.
+func (c *cronSpec) next(t time.Time) time.Time {
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	// any valid spec matches within a few years (e.g. Feb 29)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return limit
+}
+
+// parseSchedule checks a ScheduleDef against its zome and returns the parsed schedule
+func parseSchedule(z *Zome, def ScheduleDef) (s *schedule, err error) {
+	s = &schedule{zome: z.Name}
+	s.fn, err = z.GetFunctionDef(def.Function)
+	if err != nil {
+		return
+	}
+	if (def.Interval == "") == (def.Cron == "") {
+		err = ErrBadSchedule
+		return
+	}
+	if def.Interval != "" {
+		s.interval, err = time.ParseDuration(def.Interval)
+		if err == nil && s.interval <= 0 {
+			err = fmt.Errorf("interval must be positive: %s", def.Interval)
+		}
+	} else {
+		s.cron, err = parseCron(def.Cron)
+	}
+	if err == nil && def.Jitter != "" {
+		s.jitter, err = time.ParseDuration(def.Jitter)
+	}
+	return
+}
+
+// backoff returns the extra delay to wait after consecutive failures
+func (s *schedule) backoff() time.Duration {
+	if s.failures == 0 {
+		return 0
+	}
+	d := ScheduleBackoffBase
+	for i := 1; i < s.failures && d < ScheduleBackoffMax; i++ {
+		d *= 2
+	}
+	if d > ScheduleBackoffMax {
+		d = ScheduleBackoffMax
+	}
+	return d
+}
+
+// next returns when the schedule should next run after now
+func (s *schedule) next(now time.Time) (t time.Time) {
+	if s.cron != nil {
+		t = s.cron.next(now)
+	} else {
+		t = now.Add(s.interval)
+	}
+	if b := now.Add(s.backoff()); b.After(t) {
+		t = b
+	}
+	if s.jitter > 0 {
+		t = t.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+	return
+}
+
+// NewScheduler parses the schedules declared by all the zomes in the holochain's DNA
+func NewScheduler(h *Holochain) (s *Scheduler, err error) {
+	s = &Scheduler{h: h}
+	for i := range h.nucleus.dna.Zomes {
+		z := &h.nucleus.dna.Zomes[i]
+		for _, def := range z.Schedules {
+			var sched *schedule
+			sched, err = parseSchedule(z, def)
+			if err != nil {
+				err = fmt.Errorf("schedule for %s in zome %s: %w", def.Function, z.Name, err)
+				return
+			}
+			s.schedules = append(s.schedules, sched)
+		}
+	}
+	return
+}
+
+// Start runs each schedule in its own go routine until Stop is called
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	for _, sched := range s.schedules {
+		s.wg.Add(1)
+		go s.run(sched)
+	}
+}
+
+// Stop stops the schedules and waits for any running calls to finish
+func (s *Scheduler) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.wg.Wait()
+		s.stop = nil
+	}
+}
+
+func (s *Scheduler) run(sched *schedule) {
+	defer s.wg.Done()
+	for {
+		now := time.Now()
+		timer := time.NewTimer(sched.next(now).Sub(now))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		arg := ""
+		if sched.fn.CallingType == JSON_CALLING {
+			arg = "{}"
+		}
+		_, err := s.h.Call(sched.zome, sched.fn.Name, arg, sched.fn.Exposure)
+		if err != nil {
+			sched.failures++
+			s.h.config.Loggers.App.Logf("scheduled call to %s:%s failed (%d in a row): %v", sched.zome, sched.fn.Name, sched.failures, err)
+		} else {
+			sched.failures = 0
+		}
+	}
+}
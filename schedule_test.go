@@ -0,0 +1,129 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	Convey("it should reject bad specs", t, func() {
+		_, err := parseCron("* * * *")
+		So(err.Error(), ShouldEqual, `cron spec "* * * *" must have 5 fields`)
+		_, err = parseCron("60 * * * *")
+		So(err.Error(), ShouldEqual, `cron spec "60 * * * *": bad value "60"`)
+		_, err = parseCron("*/0 * * * *")
+		So(err.Error(), ShouldEqual, `cron spec "*/0 * * * *": bad step in "*/0"`)
+		_, err = parseCron("5-2 * * * *")
+		So(err, ShouldNotBeNil)
+	})
+	Convey("it should compute the next matching time", t, func() {
+		start := time.Date(2017, time.March, 14, 10, 7, 30, 0, time.UTC)
+
+		c, err := parseCron("*/15 * * * *")
+		So(err, ShouldBeNil)
+		So(c.next(start), ShouldResemble, time.Date(2017, time.March, 14, 10, 15, 0, 0, time.UTC))
+
+		c, _ = parseCron("0 9-17 * * *")
+		So(c.next(start), ShouldResemble, time.Date(2017, time.March, 14, 11, 0, 0, 0, time.UTC))
+
+		c, _ = parseCron("30 2 * * *")
+		So(c.next(start), ShouldResemble, time.Date(2017, time.March, 15, 2, 30, 0, 0, time.UTC))
+
+		c, _ = parseCron("0 0 1 1,6 *")
+		So(c.next(start), ShouldResemble, time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC))
+
+		// March 14 2017 was a Tuesday
+		c, _ = parseCron("0 12 * * 5")
+		So(c.next(start), ShouldResemble, time.Date(2017, time.March, 17, 12, 0, 0, 0, time.UTC))
+
+		// restricted day of month and day of week match either
+		c, _ = parseCron("0 12 20 * 5")
+		So(c.next(start), ShouldResemble, time.Date(2017, time.March, 17, 12, 0, 0, 0, time.UTC))
+	})
+	Convey("it should match in the local zone when the offset isn't whole hours", t, func() {
+		ist := time.FixedZone("IST", 5*60*60+30*60)
+		start := time.Date(2017, time.March, 14, 10, 7, 30, 0, ist)
+		c, _ := parseCron("0 12 * * *")
+		So(c.next(start).Equal(time.Date(2017, time.March, 14, 12, 0, 0, 0, ist)), ShouldBeTrue)
+		c, _ = parseCron("30 2 * * *")
+		So(c.next(start).Equal(time.Date(2017, time.March, 15, 2, 30, 0, 0, ist)), ShouldBeTrue)
+
+		// stepping over the hour skipped when daylight saving starts
+		if ny, err := time.LoadLocation("America/New_York"); err == nil {
+			c, _ = parseCron("0 3 * * *")
+			So(c.next(time.Date(2017, time.March, 11, 23, 0, 0, 0, ny)).Equal(time.Date(2017, time.March, 12, 3, 0, 0, 0, ny)), ShouldBeTrue)
+		}
+	})
+}
+
+func TestParseSchedule(t *testing.T) {
+	z := &Zome{Name: "z", Functions: []FunctionDef{{Name: "tick", CallingType: STRING_CALLING}}}
+	Convey("it should validate schedule defs", t, func() {
+		_, err := parseSchedule(z, ScheduleDef{Function: "tock", Interval: "1m"})
+		So(err.Error(), ShouldEqual, "unknown exposed function: tock")
+		_, err = parseSchedule(z, ScheduleDef{Function: "tick"})
+		So(err, ShouldEqual, ErrBadSchedule)
+		_, err = parseSchedule(z, ScheduleDef{Function: "tick", Interval: "1m", Cron: "* * * * *"})
+		So(err, ShouldEqual, ErrBadSchedule)
+		_, err = parseSchedule(z, ScheduleDef{Function: "tick", Interval: "-1m"})
+		So(err.Error(), ShouldEqual, "interval must be positive: -1m")
+		_, err = parseSchedule(z, ScheduleDef{Function: "tick", Interval: "1m", Jitter: "x"})
+		So(err, ShouldNotBeNil)
+
+		s, err := parseSchedule(z, ScheduleDef{Function: "tick", Interval: "1m", Jitter: "10s"})
+		So(err, ShouldBeNil)
+		So(s.interval, ShouldEqual, time.Minute)
+		So(s.jitter, ShouldEqual, 10*time.Second)
+	})
+	Convey("next should add jitter and backoff", t, func() {
+		s, _ := parseSchedule(z, ScheduleDef{Function: "tick", Interval: "1s", Jitter: "10s"})
+		now := time.Now()
+		n := s.next(now)
+		So(n.Sub(now), ShouldBeGreaterThanOrEqualTo, time.Second)
+		So(n.Sub(now), ShouldBeLessThan, 11*time.Second)
+
+		s.jitter = 0
+		s.failures = 1
+		So(s.next(now).Sub(now), ShouldEqual, ScheduleBackoffBase)
+		s.failures = 3
+		So(s.next(now).Sub(now), ShouldEqual, 4*ScheduleBackoffBase)
+		s.failures = 100
+		So(s.next(now).Sub(now), ShouldEqual, ScheduleBackoffMax)
+	})
+}
+
+func TestScheduler(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("the DNA check should reject bad schedules", t, func() {
+		dna := *h.nucleus.dna
+		dna.Zomes = []Zome{{Name: "z", Schedules: []ScheduleDef{{Function: "tick", Interval: "1m"}}}}
+		err := dna.check()
+		So(err.Error(), ShouldEqual, "schedule for tick in zome z: unknown exposed function: tick")
+	})
+
+	Convey("it should call scheduled functions until stopped", t, func() {
+		// the hook runs in the scheduler's goroutines
+		var calls int32
+		h.AddHook(HookBeforeCall, func(ctx *HookContext) error {
+			if ctx.Zome == "zySampleZome" && ctx.Function == "getDNA" {
+				atomic.AddInt32(&calls, 1)
+			}
+			return nil
+		})
+		h.nucleus.dna.Zomes[0].Schedules = []ScheduleDef{{Function: "getDNA", Interval: "20ms"}}
+		s, err := NewScheduler(h)
+		So(err, ShouldBeNil)
+		So(len(s.schedules), ShouldEqual, 1)
+		s.Start()
+		time.Sleep(110 * time.Millisecond)
+		s.Stop()
+		stopped := atomic.LoadInt32(&calls)
+		So(stopped, ShouldBeGreaterThanOrEqualTo, 2)
+		time.Sleep(50 * time.Millisecond)
+		So(atomic.LoadInt32(&calls), ShouldEqual, stopped)
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// sealedentry implements the encrypted sharing type, whose entries are committed and
+// published sealed with a key only their author can derive.  The author hands out
+// capability tokens holding the key of an entry, and whoever gets the entry with its
+// token opens it locally, so the DHT only ever holds and serves the sealed form.
+
+package holochain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+var ErrNotSealed = errors.New("entry is not encrypted")
+var ErrBadEntryToken = errors.New("invalid entry token")
+
+// SealedEntry is the content committed for an entry of an encrypted entry type
+type SealedEntry struct {
+	Sealed []byte // a nonce followed by the secretbox of the marshaled entry
+}
+
+const sealedNonceSize = 24
+
+// entryKey derives the key of the entry sealed with nonce from the agent's private key
+func entryKey(priv ic.PrivKey, nonce []byte) (key *[32]byte, err error) {
+	var secret []byte
+	if secret, err = ic.MarshalPrivateKey(priv); err != nil {
+		return
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(nonce)
+	key = new([32]byte)
+	copy(key[:], mac.Sum(nil))
+	return
+}
+
+// sealEntry returns the sealed entry committed in place of entry
+func (h *Holochain) sealEntry(entry Entry) (sealed Entry, err error) {
+	var data []byte
+	if data, err = entry.Marshal(); err != nil {
+		return
+	}
+	var nonce [sealedNonceSize]byte
+	if _, err = rand.Read(nonce[:]); err != nil {
+		return
+	}
+	var key *[32]byte
+	if key, err = entryKey(h.agent.PrivKey(), nonce[:]); err != nil {
+		return
+	}
+	var j []byte
+	if j, err = json.Marshal(SealedEntry{Sealed: secretbox.Seal(nonce[:], data, &nonce, key)}); err != nil {
+		return
+	}
+	sealed = &GobEntry{C: string(j)}
+	return
+}
+
+// sealedContent returns the sealed form of an entry if it is one
+func sealedContent(entry Entry) (s SealedEntry, ok bool) {
+	c, isStr := entry.Content().(string)
+	if !isStr {
+		return
+	}
+	ok = json.Unmarshal([]byte(c), &s) == nil && len(s.Sealed) > sealedNonceSize
+	return
+}
+
+// open decrypts a sealed entry with key
+func (s SealedEntry) open(key *[32]byte) (entry Entry, err error) {
+	var nonce [sealedNonceSize]byte
+	copy(nonce[:], s.Sealed)
+	data, ok := secretbox.Open(nil, s.Sealed[sealedNonceSize:], &nonce, key)
+	if !ok {
+		err = ErrDecryptFailed
+		return
+	}
+	var g GobEntry
+	if err = g.Unmarshal(data); err != nil {
+		return
+	}
+	entry = &g
+	return
+}
+
+// EntryToken returns a capability token for reading an encrypted entry the agent
+// committed.  The token opens that entry and no other.
+func (h *Holochain) EntryToken(hash Hash) (token string, err error) {
+	var entry Entry
+	if entry, _, err = h.chain.GetEntry(hash); err != nil {
+		return
+	}
+	s, ok := sealedContent(entry)
+	if !ok {
+		err = ErrNotSealed
+		return
+	}
+	var key *[32]byte
+	if key, err = entryKey(h.agent.PrivKey(), s.Sealed[:sealedNonceSize]); err != nil {
+		return
+	}
+	if _, err = s.open(key); err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(key[:])
+	return
+}
+
+// OpenSealedEntry decrypts an encrypted entry with a capability token from its author
+func OpenSealedEntry(entry Entry, token string) (plain Entry, err error) {
+	s, ok := sealedContent(entry)
+	if !ok {
+		err = ErrNotSealed
+		return
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 32 {
+		err = ErrBadEntryToken
+		return
+	}
+	var key [32]byte
+	copy(key[:], b)
+	plain, err = s.open(&key)
+	return
+}
+
+// openEntry returns an encrypted entry decrypted with the token, or with the agent's own
+// key if it is the author, and returns any other entry as it is
+func (h *Holochain) openEntry(entry Entry, token string) Entry {
+	s, ok := sealedContent(entry)
+	if !ok {
+		return entry
+	}
+	if token != "" {
+		if plain, err := OpenSealedEntry(entry, token); err == nil {
+			return plain
+		}
+	}
+	if key, err := entryKey(h.agent.PrivKey(), s.Sealed[:sealedNonceSize]); err == nil {
+		if plain, err := s.open(key); err == nil {
+			return plain
+		}
+	}
+	return entry
+}
@@ -0,0 +1,82 @@
+package holochain
+
+import (
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEncryptedSharing(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	for i, z := range h.nucleus.dna.Zomes {
+		for j, e := range z.Entries {
+			if e.Name == "profile" {
+				h.nucleus.dna.Zomes[i].Entries[j].Sharing = Encrypted
+			}
+		}
+	}
+	profile := `{"firstName":"Zippy","lastName":"Pinhead"}`
+	hash := commit(h, "profile", profile)
+	plainHash := commit(h, "oddNumbers", "7")
+
+	Convey("encrypted entries should be committed and published sealed", t, func() {
+		entry, _, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		_, ok := sealedContent(entry)
+		So(ok, ShouldBeTrue)
+		So(h.dht.exists(hash, StatusDefault), ShouldBeNil)
+	})
+
+	Convey("holders should skip only the validation that needs the plaintext", t, func() {
+		entry, _, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		header, err := h.chain.GetEntryHeader(hash)
+		So(err, ShouldBeNil)
+
+		before := h.Usage().VMExecutions
+		_, err = h.ValidateAction(NewPutAction("profile", entry, header), "profile", nil, []peer.ID{h.nodeID})
+		So(err, ShouldBeNil)
+		So(h.Usage().VMExecutions, ShouldEqual, before)
+
+		a := NewModAction("profile", entry, hash)
+		a.header = header
+		_, err = h.ValidateAction(a, "profile", nil, []peer.ID{h.nodeID})
+		So(err, ShouldBeNil)
+		So(h.Usage().VMExecutions, ShouldEqual, before+1)
+	})
+
+	Convey("the author should get the entry opened", t, func() {
+		req := GetReq{H: hash, StatusMask: StatusDefault, GetMask: GetMaskEntry}
+		rsp, err := NewGetAction(req, &GetOptions{GetMask: req.GetMask}).Do(h)
+		So(err, ShouldBeNil)
+		So(rsp.(GetResp).Entry.Content(), ShouldEqual, profile)
+
+		rsp, err = NewGetAction(req, &GetOptions{GetMask: req.GetMask, Local: true}).Do(h)
+		So(err, ShouldBeNil)
+		So(rsp.(GetResp).Entry.Content(), ShouldEqual, profile)
+	})
+
+	Convey("a token should open the entry it was made for", t, func() {
+		entry, _, _ := h.chain.GetEntry(hash)
+		token, err := h.EntryToken(hash)
+		So(err, ShouldBeNil)
+		plain, err := OpenSealedEntry(entry, token)
+		So(err, ShouldBeNil)
+		So(plain.Content(), ShouldEqual, profile)
+
+		_, err = OpenSealedEntry(entry, "not a token")
+		So(err, ShouldEqual, ErrBadEntryToken)
+
+		other := commit(h, "profile", `{"firstName":"Griffy","lastName":"Pinhead"}`)
+		otherToken, _ := h.EntryToken(other)
+		_, err = OpenSealedEntry(entry, otherToken)
+		So(err, ShouldEqual, ErrDecryptFailed)
+	})
+
+	Convey("only encrypted entries should have tokens", t, func() {
+		_, err := h.EntryToken(plainHash)
+		So(errors.Is(err, ErrNotSealed), ShouldBeTrue)
+	})
+}
@@ -48,6 +48,7 @@ type ServiceConfig struct {
 	DefaultPeerModeAuthor  bool
 	DefaultPeerModeDHTNode bool
 	DefaultBootstrapServer string
+	APIKeys                []APIKey // keys clients of the web api may use
 }
 
 // A Service is a Holochain service data structure
@@ -63,15 +64,19 @@ type EntryDefFile struct {
 	Schema     string
 	SchemaFile string // file name of schema or language schema directive
 	Sharing    string
+	TTL        int
 }
 
 type ZomeFile struct {
-	Name         string
-	Description  string
-	CodeFile     string
-	Entries      []EntryDefFile
-	RibosomeType string
-	Functions    []FunctionDef
+	Name             string
+	Description      string
+	CodeFile         string
+	Entries          []EntryDefFile
+	RibosomeType     string
+	Functions        []FunctionDef
+	Schedules        []ScheduleDef
+	ExecutionTimeout string
+	StrictValidation bool
 }
 
 type DNAFile struct {
@@ -85,6 +90,7 @@ type DNAFile struct {
 	RequiresVersion      int
 	DHTConfig            DHTConfig
 	Progenitor           Progenitor
+	Statuses             []StatusDef
 }
 
 // IsInitialized checks a path for a correctly set up .holochain directory
@@ -165,6 +171,10 @@ func (c *ServiceConfig) Validate() (err error) {
 		err = errors.New(SysFileName + ": At least one peer mode must be set to true.")
 		return
 	}
+	if e := validateAPIKeys(c.APIKeys); e != nil {
+		err = errors.New(SysFileName + ": " + e.Error())
+		return
+	}
 	return
 }
 
@@ -272,6 +282,7 @@ func (s *Service) LoadDNA(path string, filename string, format string) (dnaP *DN
 	dna.RequiresVersion = dnaFile.RequiresVersion
 	dna.DHTConfig = dnaFile.DHTConfig
 	dna.Progenitor = dnaFile.Progenitor
+	dna.Statuses = dnaFile.Statuses
 	dna.Properties = dnaFile.Properties
 	dna.PropertiesSchema = string(propertiesSchema)
 	dna.propertiesSchemaValidator = validator
@@ -290,6 +301,8 @@ func (s *Service) LoadDNA(path string, filename string, format string) (dnaP *DN
 				ext = ".js"
 			case "zygo":
 				ext = ".zy"
+			case "wasm":
+				ext = ".wasm"
 			}
 			dnaFile.Zomes[i].CodeFile = zome.Name + ext
 		}
@@ -305,6 +318,9 @@ func (s *Service) LoadDNA(path string, filename string, format string) (dnaP *DN
 		dna.Zomes[i].Description = zome.Description
 		dna.Zomes[i].RibosomeType = zome.RibosomeType
 		dna.Zomes[i].Functions = zome.Functions
+		dna.Zomes[i].Schedules = zome.Schedules
+		dna.Zomes[i].ExecutionTimeout = zome.ExecutionTimeout
+		dna.Zomes[i].StrictValidation = zome.StrictValidation
 
 		var code []byte
 		code, err = readFile(zomePath, zome.CodeFile)
@@ -319,6 +335,7 @@ func (s *Service) LoadDNA(path string, filename string, format string) (dnaP *DN
 			dna.Zomes[i].Entries[j].DataFormat = entry.DataFormat
 			dna.Zomes[i].Entries[j].Sharing = entry.Sharing
 			dna.Zomes[i].Entries[j].Schema = entry.Schema
+			dna.Zomes[i].Entries[j].TTL = entry.TTL
 			if entry.Schema == "" && entry.SchemaFile != "" {
 				schemaFilePath := filepath.Join(zomePath, entry.SchemaFile)
 				if !fileExists(schemaFilePath) {
@@ -371,11 +388,19 @@ func (s *Service) load(name string, format string) (hP *Holochain, err error) {
 		return
 	}
 
-	// try and get the holochain-specific agent info
-	agent, err := LoadAgent(root)
-	if err != nil {
-		// if not specified for this app, get the default from the Agent.txt file for all apps
-		agent, err = LoadAgent(filepath.Dir(root))
+	var agent Agent
+	if h.config.AgentDir != "" {
+		if h.standbyEpoch, err = readStandbyEpoch(h.config.AgentDir); err != nil {
+			return
+		}
+		agent, err = LoadAgent(h.config.AgentDir)
+	} else {
+		// try and get the holochain-specific agent info
+		agent, err = LoadAgent(root)
+		if err != nil {
+			// if not specified for this app, get the default from the Agent.txt file for all apps
+			agent, err = LoadAgent(filepath.Dir(root))
+		}
 	}
 	if err != nil {
 		return
@@ -387,11 +412,20 @@ func (s *Service) load(name string, format string) (hP *Holochain, err error) {
 	if err != nil {
 		return
 	}
+	if err = h.setupAuditLog(); err != nil {
+		return
+	}
 
+	if err = h.PrepareSigAlgorithms(); err != nil {
+		return
+	}
 	if err = h.PrepareHashType(); err != nil {
 		return
 	}
 
+	if err = h.rollbackJournal(); err != nil {
+		return
+	}
 	h.chain, err = NewChainFromFile(h.hashSpec, filepath.Join(h.DBPath(), StoreFileName))
 	if err != nil {
 		return
@@ -409,8 +443,8 @@ func (s *Service) load(name string, format string) (hP *Holochain, err error) {
 		// @TODO compare value from file to actual hash
 	}
 
-	if h.chain.Length() > 0 {
-		h.agentHash = h.chain.Headers[1].EntryLink
+	if err = h.agentChanged(); err != nil {
+		return
 	}
 	if err = h.Prepare(); err != nil {
 		return
@@ -474,6 +508,8 @@ func suffixByRibosomeType(ribosomeType string) (suffix string) {
 		suffix = ".js"
 	case ZygoRibosomeType:
 		suffix = ".zy"
+	case WASMRibosomeType:
+		suffix = ".wasm"
 	default:
 	}
 	return
@@ -547,6 +583,7 @@ func (s *Service) GenDev(root string, format string) (hP *Holochain, err error)
 			DHTConfig:            dna.DHTConfig,
 			Progenitor:           dna.Progenitor,
 			PropertiesSchemaFile: propertiesSchemaFile,
+			Statuses:             []StatusDef{{Name: "Flagged", Description: "marked for moderation"}},
 		}
 
 		zygoZomeName := "zySampleZome"
@@ -672,6 +709,7 @@ func (s *Service) GenDev(root string, format string) (hP *Holochain, err error)
   (validate entryType entry header sources))
 (defn validateMod [entryType entry header replaces pkg sources] true)
 (defn validateDel [entryType hash pkg sources] true)
+(defn validateSetStatus [entryType hash status pkg sources] true)
 (defn validate [entryType entry header sources]
   (cond (== entryType "evenNumbers")  (cond (== (mod entry 2) 0) true false)
         (== entryType "primes")  (isprime (hget entry %prime))
@@ -683,6 +721,7 @@ func (s *Service) GenDev(root string, format string) (hP *Holochain, err error)
 (defn validateModPkg [entryType] nil)
 (defn validateDelPkg [entryType] nil)
 (defn validateLinkPkg [entryType] nil)
+(defn validateSetStatusPkg [entryType] nil)
 (defn genesis [] true)
 (defn receive [from message]
 	(hash pong: (hget message %ping)))
@@ -719,6 +758,9 @@ function validateMod(entry_type,entry,header,replaces,pkg,sources) {
 function validateDel(entry_type,hash,pkg,sources) {
   return true;
 }
+function validateSetStatus(entry_type,hash,status,pkg,sources) {
+  return entry_type == "oddNumbers" || entry_type == "profile";
+}
 function validateCommit(entry_type,entry,header,pkg,sources) {
   if (entry_type == "rating") {return true}
   return validate(entry_type,entry,header,sources);
@@ -744,6 +786,7 @@ function validatePutPkg(entry_type) {
 function validateModPkg(entry_type) { return null}
 function validateDelPkg(entry_type) { return null}
 function validateLinkPkg(entry_type) { return null}
+function validateSetStatusPkg(entry_type) { return null}
 
 function genesis() {return true}
 
@@ -1027,6 +1070,7 @@ func (s *Service) SaveDNAFile(root string, dna *DNA, encodingFormat string, over
 		RequiresVersion:      dna.RequiresVersion,
 		DHTConfig:            dna.DHTConfig,
 		Progenitor:           dna.Progenitor,
+		Statuses:             dna.Statuses,
 	}
 	for _, z := range dna.Zomes {
 		zpath := filepath.Join(dnaPath, z.Name)
@@ -1038,10 +1082,13 @@ func (s *Service) SaveDNAFile(root string, dna *DNA, encodingFormat string, over
 		}
 
 		zomeFile := ZomeFile{Name: z.Name,
-			Description:  z.Description,
-			CodeFile:     z.CodeFileName(),
-			RibosomeType: z.RibosomeType,
-			Functions:    z.Functions,
+			Description:      z.Description,
+			CodeFile:         z.CodeFileName(),
+			RibosomeType:     z.RibosomeType,
+			Functions:        z.Functions,
+			Schedules:        z.Schedules,
+			ExecutionTimeout: z.ExecutionTimeout,
+			StrictValidation: z.StrictValidation,
 		}
 
 		for _, e := range z.Entries {
@@ -1049,6 +1096,7 @@ func (s *Service) SaveDNAFile(root string, dna *DNA, encodingFormat string, over
 				Name:       e.Name,
 				DataFormat: e.DataFormat,
 				Sharing:    e.Sharing,
+				TTL:        e.TTL,
 			}
 			if e.DataFormat == DataFormatJSON && e.Schema != "" {
 				entryDefFile.SchemaFile = e.Name + ".json"
@@ -24,7 +24,7 @@ func TestInit(t *testing.T) {
 
 		Convey("it should return a service with default values", func() {
 			So(s.DefaultAgent.Name(), ShouldEqual, AgentName(agent))
-			So(fmt.Sprintf("%v", s.Settings), ShouldEqual, "{true true bootstrap.holochain.net:10000}")
+			So(fmt.Sprintf("%v", s.Settings), ShouldEqual, "{true true bootstrap.holochain.net:10000 []}")
 		})
 
 		p := filepath.Join(d, DefaultDirectoryName)
@@ -59,6 +59,15 @@ func TestLoadService(t *testing.T) {
 		So(s.DefaultAgent.Name(), ShouldEqual, AgentName("Herbert <h@bert.com>"))
 	})
 
+	Convey("it should load api keys from the service config", t, func() {
+		settings := service.Settings
+		settings.APIKeys = []APIKey{{Name: "app1", Key: "abc", Write: true, Functions: []string{"zome/*"}, RateLimit: 2.5, Burst: 5}}
+		err := writeToml(root, SysFileName, settings, true)
+		So(err, ShouldBeNil)
+		s, err := LoadService(root)
+		So(err, ShouldBeNil)
+		So(s.Settings.APIKeys, ShouldResemble, settings.APIKeys)
+	})
 }
 
 func TestValidateServiceConfig(t *testing.T) {
@@ -76,6 +85,13 @@ func TestValidateServiceConfig(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 
+	Convey("it should fail with duplicate api keys", t, func() {
+		svc.APIKeys = []APIKey{{Name: "app1", Key: "abc"}, {Name: "app1", Key: "def"}}
+		err := svc.Validate()
+		So(err.Error(), ShouldEqual, SysFileName+": api key app1 is not unique")
+		svc.APIKeys = nil
+	})
+
 }
 
 func TestConfiguredChains(t *testing.T) {
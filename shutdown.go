@@ -0,0 +1,22 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// shutdown implements closing holochains cleanly when the process is asked to stop
+
+package holochain
+
+// WaitForShutdown blocks until the process is asked to stop, by SIGINT or SIGTERM or,
+// when running as a Windows service, by the service manager, and then calls each of the
+// close functions in turn.  It returns the first error they return.
+func WaitForShutdown(closers ...func() error) (err error) {
+	requested, finished := shutdownRequests()
+	<-requested
+	defer finished()
+	for _, c := range closers {
+		if e := c(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
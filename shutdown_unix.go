@@ -0,0 +1,33 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+//go:build !windows
+// +build !windows
+
+// shutdown requests on unix come from signals
+
+package holochain
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// shutdownRequests returns a channel that is closed when the process is asked to stop
+// and a function to call once it has
+func shutdownRequests() (requested <-chan struct{}, finished func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		<-sig
+		// a second signal will kill the process if closing hangs
+		signal.Stop(sig)
+		close(done)
+	}()
+	requested = done
+	finished = func() {}
+	return
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownRequests(t *testing.T) {
+	Convey("SIGTERM should request a shutdown", t, func() {
+		requested, finished := shutdownRequests()
+		err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		So(err, ShouldBeNil)
+		select {
+		case <-requested:
+		case <-time.After(time.Second):
+			So("no shutdown request", ShouldBeNil)
+		}
+		finished()
+	})
+}
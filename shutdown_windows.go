@@ -0,0 +1,73 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// shutdown requests on windows come from the service manager or from ctrl-c
+
+package holochain
+
+import (
+	"golang.org/x/sys/windows/svc"
+	"os"
+	"os/signal"
+)
+
+// WindowsServiceName is the name holochain processes run under as Windows services
+var WindowsServiceName = "holochain"
+
+// serviceHandler reports the process's state to the Windows service manager
+type serviceHandler struct {
+	requested chan struct{}
+	finished  chan struct{}
+}
+
+// Execute runs until the service manager asks the service to stop and the holochains
+// have been closed
+func (s *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			changes <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			close(s.requested)
+			<-s.finished
+			return
+		}
+	}
+	return
+}
+
+// shutdownRequests returns a channel that is closed when the process is asked to stop
+// and a function to call once it has
+func shutdownRequests() (requested <-chan struct{}, finished func()) {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil || interactive {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		done := make(chan struct{})
+		go func() {
+			<-sig
+			signal.Stop(sig)
+			close(done)
+		}()
+		requested = done
+		finished = func() {}
+		return
+	}
+	h := &serviceHandler{requested: make(chan struct{}), finished: make(chan struct{})}
+	stopped := make(chan struct{})
+	go func() {
+		if err := svc.Run(WindowsServiceName, h); err != nil {
+			Infof("windows service: %v", err)
+		}
+		close(stopped)
+	}()
+	requested = h.requested
+	finished = func() {
+		close(h.finished)
+		<-stopped
+	}
+	return
+}
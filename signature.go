@@ -0,0 +1,227 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// signature implements signing and verification behind an algorithm identifier that is
+// carried with each signature, so that new schemes can be added without breaking old chains
+
+package holochain
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	"sort"
+)
+
+// SigAlgorithm identifies the scheme a signature was made with
+type SigAlgorithm uint8
+
+const (
+	// SigEd25519 is the zero value so that signatures made before the algorithm was
+	// recorded are read as ed25519
+	SigEd25519 SigAlgorithm = iota
+)
+
+// DefaultSigAlgorithms are the algorithms allowed when the DNA doesn't specify any
+var DefaultSigAlgorithms = []string{"ed25519"}
+
+var ErrUnknownSigAlgorithm = errors.New("unknown signature algorithm")
+var ErrSigAlgorithmNotAllowed = errors.New("signature algorithm not allowed by DNA")
+var ErrSigKeyType = errors.New("key type doesn't match signature algorithm")
+var ErrOneTimeSignature = errors.New("signature made with a one-time key")
+var ErrNotOneTimeSignature = errors.New("signature not made with a one-time key")
+
+// SigScheme is the interface for signature algorithms
+type SigScheme interface {
+	// Accepts reports whether the scheme can sign with or verify for a key
+	Accepts(k ic.Key) bool
+	Sign(priv ic.PrivKey, data []byte) ([]byte, error)
+	Verify(pub ic.PubKey, data []byte, sig []byte) (bool, error)
+}
+
+type sigAlgorithm struct {
+	name   string
+	scheme SigScheme
+}
+
+var sigAlgorithms = map[SigAlgorithm]sigAlgorithm{
+	SigEd25519: {"ed25519", Ed25519Scheme{}},
+}
+
+// RegisterSigAlgorithm adds a signature algorithm under the given id and name.
+// It is not safe to call while signatures are being made or verified.
+func RegisterSigAlgorithm(a SigAlgorithm, name string, s SigScheme) {
+	sigAlgorithms[a] = sigAlgorithm{name, s}
+}
+
+// SigAlgorithmFromName returns the id of the registered algorithm with the given name
+func SigAlgorithmFromName(name string) (a SigAlgorithm, err error) {
+	for id, alg := range sigAlgorithms {
+		if alg.name == name {
+			a = id
+			return
+		}
+	}
+	err = fmt.Errorf("%w: %s", ErrUnknownSigAlgorithm, name)
+	return
+}
+
+// String returns the name of the algorithm
+func (a SigAlgorithm) String() string {
+	alg, ok := sigAlgorithms[a]
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", int(a))
+	}
+	return alg.name
+}
+
+// sigAlgorithmForKey returns the lowest numbered algorithm that accepts the key
+func sigAlgorithmForKey(k ic.Key) (a SigAlgorithm, err error) {
+	ids := make([]int, 0, len(sigAlgorithms))
+	for id := range sigAlgorithms {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if sigAlgorithms[SigAlgorithm(id)].scheme.Accepts(k) {
+			a = SigAlgorithm(id)
+			return
+		}
+	}
+	err = ErrUnknownSigAlgorithm
+	return
+}
+
+// OneTimeKey is a private key used for a single signature.  Signatures made with it
+// carry its public key, which nothing ties to the agent, so they can't be attributed to
+// the agent or linked to each other.
+type OneTimeKey struct {
+	ic.PrivKey
+	Pub []byte // the marshaled public key
+}
+
+// NewOneTimeKey generates a one-time key
+func NewOneTimeKey() (k *OneTimeKey, err error) {
+	var priv ic.PrivKey
+	priv, _, err = ic.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return
+	}
+	var pub []byte
+	pub, err = ic.MarshalPublicKey(priv.GetPublic())
+	if err != nil {
+		return
+	}
+	k = &OneTimeKey{PrivKey: priv, Pub: pub}
+	return
+}
+
+// Sign makes a signature of data with the algorithm for the key
+func Sign(priv ic.PrivKey, data []byte) (sig Signature, err error) {
+	if k, ok := priv.(*OneTimeKey); ok {
+		sig, err = Sign(k.PrivKey, data)
+		if err == nil {
+			sig.Key = k.Pub
+		}
+		return
+	}
+	sig.A, err = sigAlgorithmForKey(priv)
+	if err != nil {
+		return
+	}
+	sig.S, err = sigAlgorithms[sig.A].scheme.Sign(priv, data)
+	return
+}
+
+// Verify checks a signature of data with the algorithm it was made with.  Signatures
+// made with one-time keys say nothing about pub so they are refused.
+func (s *Signature) Verify(pub ic.PubKey, data []byte) (valid bool, err error) {
+	if s.Key != nil {
+		err = ErrOneTimeSignature
+		return
+	}
+	valid, err = s.verify(pub, data)
+	return
+}
+
+// VerifyOneTime checks a signature of data made with a one-time key against the key
+// it carries
+func (s *Signature) VerifyOneTime(data []byte) (valid bool, err error) {
+	if s.Key == nil {
+		err = ErrNotOneTimeSignature
+		return
+	}
+	var pub ic.PubKey
+	pub, err = ic.UnmarshalPublicKey(s.Key)
+	if err != nil {
+		return
+	}
+	valid, err = s.verify(pub, data)
+	return
+}
+
+func (s *Signature) verify(pub ic.PubKey, data []byte) (valid bool, err error) {
+	alg, ok := sigAlgorithms[s.A]
+	if !ok {
+		err = ErrUnknownSigAlgorithm
+		return
+	}
+	if !alg.scheme.Accepts(pub) {
+		err = ErrSigKeyType
+		return
+	}
+	valid, err = alg.scheme.Verify(pub, data, s.S)
+	return
+}
+
+// Ed25519Scheme implements the SigScheme interface for ed25519 keys
+type Ed25519Scheme struct{}
+
+func (s Ed25519Scheme) Accepts(k ic.Key) bool {
+	switch k.(type) {
+	case *ic.Ed25519PrivateKey, *ic.Ed25519PublicKey:
+		return true
+	}
+	return false
+}
+
+func (s Ed25519Scheme) Sign(priv ic.PrivKey, data []byte) ([]byte, error) {
+	return priv.Sign(data)
+}
+
+func (s Ed25519Scheme) Verify(pub ic.PubKey, data []byte, sig []byte) (bool, error) {
+	return pub.Verify(data, sig)
+}
+
+// PrepareSigAlgorithms makes sure the signature algorithms named in the DNA are known
+// and stores them to the Holochain struct
+func (h *Holochain) PrepareSigAlgorithms() (err error) {
+	names := h.nucleus.dna.DHTConfig.SigAlgorithms
+	if len(names) == 0 {
+		names = DefaultSigAlgorithms
+	}
+	allowed := make([]SigAlgorithm, 0, len(names))
+	for _, name := range names {
+		var a SigAlgorithm
+		a, err = SigAlgorithmFromName(name)
+		if err != nil {
+			return
+		}
+		allowed = append(allowed, a)
+	}
+	h.sigAlgorithms = allowed
+	return
+}
+
+// CheckSigAlgorithm returns an error if the DNA doesn't allow the algorithm
+func (h *Holochain) CheckSigAlgorithm(a SigAlgorithm) (err error) {
+	for _, allowed := range h.sigAlgorithms {
+		if a == allowed {
+			return
+		}
+	}
+	err = ErrSigAlgorithmNotAllowed
+	return
+}
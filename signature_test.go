@@ -0,0 +1,153 @@
+package holochain
+
+import (
+	"bytes"
+	"crypto/rand"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+const testSigAlgorithm SigAlgorithm = 200
+
+func init() {
+	RegisterSigAlgorithm(testSigAlgorithm, "test-ed25519", Ed25519Scheme{})
+}
+
+func TestSign(t *testing.T) {
+	priv, pub, _ := ic.GenerateEd25519Key(rand.Reader)
+	data := []byte("some data")
+
+	Convey("it should sign with the algorithm for the key", t, func() {
+		sig, err := Sign(priv, data)
+		So(err, ShouldBeNil)
+		So(sig.A, ShouldEqual, SigEd25519)
+		valid, err := sig.Verify(pub, data)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+		valid, err = sig.Verify(pub, []byte("other data"))
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeFalse)
+	})
+
+	Convey("it should not verify with an unknown algorithm", t, func() {
+		sig, _ := Sign(priv, data)
+		sig.A = 201
+		_, err := sig.Verify(pub, data)
+		So(err, ShouldEqual, ErrUnknownSigAlgorithm)
+	})
+
+	Convey("algorithms should be found by name", t, func() {
+		a, err := SigAlgorithmFromName("ed25519")
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, SigEd25519)
+		So(a.String(), ShouldEqual, "ed25519")
+		_, err = SigAlgorithmFromName("bogus")
+		So(err.Error(), ShouldEqual, "unknown signature algorithm: bogus")
+	})
+}
+
+func TestMarshalSignatureAlgorithm(t *testing.T) {
+	Convey("ed25519 signatures should marshal without the algorithm", t, func() {
+		sig := Signature{S: []byte{1, 2, 3}}
+		var b bytes.Buffer
+		err := MarshalSignature(&b, &sig)
+		So(err, ShouldBeNil)
+		So(b.Bytes(), ShouldResemble, []byte{3, 1, 2, 3})
+		var sig2 Signature
+		err = UnmarshalSignature(&b, &sig2)
+		So(err, ShouldBeNil)
+		So(sig2.A, ShouldEqual, SigEd25519)
+		So(sig2.S, ShouldResemble, sig.S)
+	})
+	Convey("other signatures should marshal with the algorithm", t, func() {
+		sig := Signature{A: testSigAlgorithm, S: []byte{1, 2, 3}}
+		var b bytes.Buffer
+		err := MarshalSignature(&b, &sig)
+		So(err, ShouldBeNil)
+		So(b.Bytes(), ShouldResemble, []byte{sigAlgorithmMarker, byte(testSigAlgorithm), 3, 1, 2, 3})
+		var sig2 Signature
+		err = UnmarshalSignature(&b, &sig2)
+		So(err, ShouldBeNil)
+		So(sig2.A, ShouldEqual, testSigAlgorithm)
+		So(sig2.S, ShouldResemble, sig.S)
+	})
+}
+
+func TestPrepareSigAlgorithms(t *testing.T) {
+	Convey("it should default to ed25519", t, func() {
+		h := Holochain{}
+		h.nucleus = NewNucleus(&h, &DNA{})
+		err := h.PrepareSigAlgorithms()
+		So(err, ShouldBeNil)
+		So(h.CheckSigAlgorithm(SigEd25519), ShouldBeNil)
+		So(h.CheckSigAlgorithm(testSigAlgorithm), ShouldEqual, ErrSigAlgorithmNotAllowed)
+	})
+	Convey("it should allow the algorithms in the DNA", t, func() {
+		h := Holochain{}
+		h.nucleus = NewNucleus(&h, &DNA{DHTConfig: DHTConfig{SigAlgorithms: []string{"test-ed25519"}}})
+		err := h.PrepareSigAlgorithms()
+		So(err, ShouldBeNil)
+		So(h.CheckSigAlgorithm(testSigAlgorithm), ShouldBeNil)
+		So(h.CheckSigAlgorithm(SigEd25519), ShouldEqual, ErrSigAlgorithmNotAllowed)
+	})
+	Convey("it should reject unknown algorithms", t, func() {
+		h := Holochain{}
+		h.nucleus = NewNucleus(&h, &DNA{DHTConfig: DHTConfig{SigAlgorithms: []string{"bogus"}}})
+		err := h.PrepareSigAlgorithms()
+		So(err.Error(), ShouldEqual, "unknown signature algorithm: bogus")
+	})
+}
+
+func TestOneTimeKey(t *testing.T) {
+	_, pub, _ := ic.GenerateEd25519Key(rand.Reader)
+	data := []byte("some data")
+
+	Convey("signatures with one-time keys should verify against the key they carry", t, func() {
+		k, err := NewOneTimeKey()
+		So(err, ShouldBeNil)
+		sig, err := Sign(k, data)
+		So(err, ShouldBeNil)
+		So(sig.Key, ShouldResemble, k.Pub)
+		valid, err := sig.VerifyOneTime(data)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+
+		valid, _ = sig.VerifyOneTime([]byte("other data"))
+		So(valid, ShouldBeFalse)
+	})
+
+	Convey("signatures with one-time keys should not be attributable to an agent", t, func() {
+		k, _ := NewOneTimeKey()
+		sig, _ := Sign(k, data)
+		_, err := sig.Verify(pub, data)
+		So(err, ShouldEqual, ErrOneTimeSignature)
+
+		agent, _, _ := ic.GenerateEd25519Key(rand.Reader)
+		sig, _ = Sign(agent, data)
+		_, err = sig.VerifyOneTime(data)
+		So(err, ShouldEqual, ErrNotOneTimeSignature)
+	})
+
+	Convey("each one-time key should be different", t, func() {
+		k1, _ := NewOneTimeKey()
+		k2, _ := NewOneTimeKey()
+		So(k1.Pub, ShouldNotResemble, k2.Pub)
+	})
+
+	Convey("signatures with one-time keys should round-trip", t, func() {
+		k, _ := NewOneTimeKey()
+		sig, _ := Sign(k, data)
+		var b bytes.Buffer
+		err := MarshalSignature(&b, &sig)
+		So(err, ShouldBeNil)
+		So(b.Bytes()[0], ShouldEqual, sigKeyMarker)
+		var sig2 Signature
+		err = UnmarshalSignature(&b, &sig2)
+		So(err, ShouldBeNil)
+		So(sig2.Key, ShouldResemble, sig.Key)
+		valid, err := sig2.VerifyOneTime(data)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+	})
+}
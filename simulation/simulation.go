@@ -0,0 +1,254 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// Package simulation runs many holochain nodes in one process, wired together by an
+// in-memory network, to see how a workload spreads through them.  It is for judging
+// changes to gossip and sharding parameters before they are rolled out.
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	holo "github.com/metacurrency/holochain"
+	ma "github.com/multiformats/go-multiaddr"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultGossipInterval = 100 * time.Millisecond
+	DefaultPollInterval   = 50 * time.Millisecond
+	DefaultTimeout        = 30 * time.Second
+)
+
+var ErrNoNodes = errors.New("simulation needs at least one node")
+
+// Step is a zome function call made by one of the nodes in a workload
+type Step struct {
+	Node     int // index of the node making the call
+	Zome     string
+	Function string
+	Args     interface{}
+	// Wait is how long to wait after the step before the next one
+	Wait time.Duration
+}
+
+// Config describes a simulation
+type Config struct {
+	Nodes          int
+	App            string // path of the app whose DNA the nodes all run
+	Dir            string // where the nodes' data is kept, which the caller cleans up
+	GossipInterval time.Duration
+	PollInterval   time.Duration // how often the nodes are checked for convergence
+	Timeout        time.Duration // how long to wait for the nodes to converge
+	Workload       []Step
+}
+
+// Report is the outcome of a simulation
+type Report struct {
+	Nodes     int
+	Converged bool
+	// ConvergenceTime is from the end of the workload until every node held the same
+	// hashes, or until the timeout if they didn't
+	ConvergenceTime time.Duration
+	MessagesSent    int64
+	BytesSent       int64
+	// Divergence is how many of the hashes held by any node each node didn't hold at
+	// the end of the simulation
+	Divergence []int
+	// StepErrors are the errors of the workload steps that failed, by step index
+	StepErrors map[int]string
+}
+
+// Simulation is a set of nodes running in one process
+type Simulation struct {
+	Config Config
+	Nodes  []*holo.Holochain
+	net    mocknet.Mocknet
+}
+
+// simLk serializes simulations as they replace how nodes make their hosts
+var simLk sync.Mutex
+
+// New makes the nodes of a simulation, each with its own agent, all joined to the app
+// and connected to each other in memory, and starts their gossip
+func New(config Config) (sim *Simulation, err error) {
+	if config.Nodes < 1 {
+		err = ErrNoNodes
+		return
+	}
+	if config.GossipInterval == 0 {
+		config.GossipInterval = DefaultGossipInterval
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	holo.InitializeHolochain()
+	s := Simulation{Config: config, net: mocknet.New(context.Background())}
+
+	simLk.Lock()
+	nodeHost := holo.NodeHost
+	holo.NodeHost = func(listenAddr ma.Multiaddr, priv ic.PrivKey) (host.Host, error) {
+		// each node needs its own address in the mock network
+		addr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 10000+len(s.Nodes)))
+		if err != nil {
+			return nil, err
+		}
+		return s.net.AddPeer(priv, addr)
+	}
+	defer func() {
+		holo.NodeHost = nodeHost
+		simLk.Unlock()
+		if err != nil {
+			s.Close()
+		}
+	}()
+
+	for i := 0; i < config.Nodes; i++ {
+		var h *holo.Holochain
+		if h, err = s.makeNode(i); err != nil {
+			return
+		}
+		s.Nodes = append(s.Nodes, h)
+	}
+	if err = s.net.LinkAll(); err != nil {
+		return
+	}
+	if err = s.net.ConnectAllButSelf(); err != nil {
+		return
+	}
+	for _, h := range s.Nodes {
+		for _, o := range s.Nodes {
+			if o == h {
+				continue
+			}
+			var id peer.ID
+			if id, _, err = o.Agent().NodeID(); err != nil {
+				return
+			}
+			if err = h.DHT().UpdateGossiper(id, 0); err != nil {
+				return
+			}
+		}
+		go h.DHT().HandleGossipWiths()
+		go h.DHT().Gossip(config.GossipInterval)
+	}
+	sim = &s
+	return
+}
+
+// makeNode makes the ith node in a service of its own so that it has its own agent
+func (s *Simulation) makeNode(i int) (h *holo.Holochain, err error) {
+	name := fmt.Sprintf("node%d", i)
+	var service *holo.Service
+	if service, err = holo.Init(filepath.Join(s.Config.Dir, name), holo.AgentName(name)); err != nil {
+		return
+	}
+	// the nodes only know of each other
+	service.Settings.DefaultBootstrapServer = ""
+	root := filepath.Join(service.Path, filepath.Base(s.Config.App))
+	if err = service.Clone(s.Config.App, root, service.DefaultAgent, false); err != nil {
+		return
+	}
+	h, err = service.GenChain(filepath.Base(root))
+	return
+}
+
+// Run runs the workload and waits for the nodes to converge, reporting how it went
+func (s *Simulation) Run() (report Report, err error) {
+	report.Nodes = len(s.Nodes)
+	report.StepErrors = make(map[int]string)
+	for i, step := range s.Config.Workload {
+		if step.Node < 0 || step.Node >= len(s.Nodes) {
+			err = fmt.Errorf("step %d: no node %d", i, step.Node)
+			return
+		}
+		_, e := s.Nodes[step.Node].Call(step.Zome, step.Function, step.Args, holo.ZOME_EXPOSURE)
+		if e != nil {
+			report.StepErrors[i] = e.Error()
+		}
+		time.Sleep(step.Wait)
+	}
+
+	start := time.Now()
+	for {
+		if report.Divergence, err = s.Divergence(); err != nil {
+			return
+		}
+		report.Converged = true
+		for _, d := range report.Divergence {
+			if d > 0 {
+				report.Converged = false
+			}
+		}
+		report.ConvergenceTime = time.Since(start)
+		if report.Converged || report.ConvergenceTime >= s.Config.Timeout {
+			break
+		}
+		time.Sleep(s.Config.PollInterval)
+	}
+
+	for _, h := range s.Nodes {
+		u := h.Usage()
+		report.MessagesSent += u.MessagesSent
+		report.BytesSent += u.BytesSent
+	}
+	return
+}
+
+// Divergence returns how many of the hashes held by any node each node doesn't hold
+func (s *Simulation) Divergence() (divergence []int, err error) {
+	all := make(map[string]bool)
+	held := make([]map[string]bool, len(s.Nodes))
+	for i, h := range s.Nodes {
+		var hashes []string
+		if hashes, err = h.DHT().HeldHashes("", ""); err != nil {
+			return
+		}
+		held[i] = make(map[string]bool)
+		for _, hash := range hashes {
+			held[i][hash] = true
+			all[hash] = true
+		}
+	}
+	divergence = make([]int, len(s.Nodes))
+	for i := range s.Nodes {
+		divergence[i] = len(all) - len(held[i])
+	}
+	return
+}
+
+// Close shuts down the nodes
+func (s *Simulation) Close() (err error) {
+	for _, h := range s.Nodes {
+		if e := h.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// Run makes a simulation, runs it and closes it
+func Run(config Config) (report Report, err error) {
+	if err = os.MkdirAll(config.Dir, os.ModePerm); err != nil {
+		return
+	}
+	var sim *Simulation
+	if sim, err = New(config); err != nil {
+		return
+	}
+	defer sim.Close()
+	report, err = sim.Run()
+	return
+}
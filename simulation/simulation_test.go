@@ -0,0 +1,54 @@
+package simulation
+
+import (
+	holo "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	holo.InitializeHolochain()
+	os.Exit(m.Run())
+}
+
+func TestSimulation(t *testing.T) {
+	d := holo.SetupTestDir()
+	defer holo.CleanupTestDir(d)
+	s, err := holo.Init(filepath.Join(d, "dev"), holo.AgentName("dev"))
+	if err != nil {
+		panic(err)
+	}
+	app := filepath.Join(s.Path, "app")
+	if _, err = s.GenDev(app, "toml"); err != nil {
+		panic(err)
+	}
+
+	Convey("a simulation should need nodes", t, func() {
+		_, err := New(Config{App: app, Dir: filepath.Join(d, "none")})
+		So(err, ShouldEqual, ErrNoNodes)
+	})
+
+	Convey("the nodes of a simulation should converge on the workload", t, func() {
+		report, err := Run(Config{
+			Nodes:   3,
+			App:     app,
+			Dir:     filepath.Join(d, "sim"),
+			Timeout: 10 * time.Second,
+			Workload: []Step{
+				{Node: 0, Zome: "jsSampleZome", Function: "addOdd", Args: "7"},
+				{Node: 1, Zome: "jsSampleZome", Function: "addOdd", Args: "9"},
+				{Node: 2, Zome: "jsSampleZome", Function: "addOdd", Args: "2"},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(report.Nodes, ShouldEqual, 3)
+		So(report.Converged, ShouldBeTrue)
+		So(report.Divergence, ShouldResemble, []int{0, 0, 0})
+		So(report.MessagesSent, ShouldBeGreaterThan, 0)
+		So(len(report.StepErrors), ShouldEqual, 1)
+		So(report.StepErrors[2], ShouldNotEqual, "")
+	})
+}
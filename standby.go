@@ -0,0 +1,414 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// standby implements a hot standby: a process that mirrors a primary node's chain and
+// DHT store so that it can take over the primary's identity if the primary fails.  The
+// agent's key is never replicated, only where it is kept, so both processes must be able
+// to reach that place.  That place also holds the standby epoch, which a standby raises
+// when it takes over, so that a primary that was only cut off, rather than failed, stops
+// committing once it finds it has been replaced.
+
+package holochain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	"github.com/tidwall/buntdb"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNotStandby = errors.New("not a standby of this node")
+var ErrNoKeyRef = errors.New("primary has no AgentDir for a standby to load its key from")
+var ErrFenced = errors.New("a standby has taken over from this node")
+
+const (
+	// StandbyEpochFileName is the file in the AgentDir holding the standby epoch
+	StandbyEpochFileName = "standby.epoch"
+
+	// how much of the end of the copy of a file a standby has is compared with the
+	// primary's to find whether the primary's was rewritten
+	replicateTailSize = 4096
+)
+
+// ReplicationProtocol is the protocol standbys use to mirror their primary
+var ReplicationProtocol Protocol
+
+// ReplicateReq asks a primary for what has changed since the standby last synced
+type ReplicateReq struct {
+	ChainOffset int64  // how much of the chain file the standby has
+	DHTOffset   int64  // how much of the DHT store file the standby has
+	DHTTail     []byte // the hash of the end of the standby's copy of the DHT store file
+}
+
+// ReplicateResp holds the changes to a primary's chain and DHT store
+type ReplicateResp struct {
+	DNAHash string
+	// KeyRef is where the primary's agent key is kept, its AgentDir
+	KeyRef string
+	// Chain is the chain file from ChainOffset, which is 0 if the standby's copy has to
+	// be replaced rather than appended to
+	ChainOffset int64
+	Chain       []byte
+	// DHT is the DHT store file from DHTOffset, which is 0 if the standby's copy has to
+	// be replaced, as when the store was shrunk, rather than appended to
+	DHTOffset int64
+	DHT       []byte
+}
+
+// ReplicationReceiver handles the requests of standbys
+func ReplicationReceiver(h *Holochain, m *Message) (response interface{}, err error) {
+	switch m.Type {
+	case REPLICATE_REQUEST:
+		if !h.isStandby(m.From) {
+			err = ErrNotStandby
+			return
+		}
+		if err = h.checkFence(); err != nil {
+			return
+		}
+		response, err = h.replicate(m.Body.(ReplicateReq))
+	default:
+		err = fmt.Errorf("message type %d not in holochain-replicate protocol", int(m.Type))
+	}
+	return
+}
+
+func (h *Holochain) isStandby(id peer.ID) bool {
+	for _, s := range h.config.Standbys {
+		if s == peer.IDB58Encode(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// replicate returns what has changed on the node since a standby's last request
+func (h *Holochain) replicate(req ReplicateReq) (resp ReplicateResp, err error) {
+	resp.DNAHash = h.dnaHash.String()
+	resp.KeyRef = h.config.AgentDir
+	if resp.ChainOffset, resp.Chain, err = h.chainSince(req.ChainOffset); err != nil {
+		return
+	}
+	// the store writes each transaction to its file while holding its lock, so reading
+	// the file in a view doesn't find it part way through one
+	err = h.dht.db.View(func(tx *buntdb.Tx) (err error) {
+		resp.DHTOffset, resp.DHT, err = fileSince(filepath.Join(h.DBPath(), DHTStoreFileName), req.DHTOffset, req.DHTTail)
+		return
+	})
+	if len(resp.DHT) == 0 {
+		resp.DHT = nil
+	}
+	return
+}
+
+// fileTail returns the hash of the replicateTailSize bytes before offset in the file
+func fileTail(f *os.File, offset int64) (tail []byte, err error) {
+	start := offset - int64(replicateTailSize)
+	if start < 0 {
+		start = 0
+	}
+	b := make([]byte, offset-start)
+	if _, err = f.ReadAt(b, start); err != nil {
+		return
+	}
+	sum := sha256.Sum256(b)
+	tail = sum[:]
+	return
+}
+
+// fileSince returns the file at path from offset.  If offset is past its end, or the
+// file doesn't end at offset with the given tail, because it was rewritten, all of it
+// is returned.
+func fileSince(path string, offset int64, tail []byte) (from int64, data []byte, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+	var info os.FileInfo
+	if info, err = f.Stat(); err != nil {
+		return
+	}
+	if offset > 0 && offset <= info.Size() {
+		var t []byte
+		if t, err = fileTail(f, offset); err != nil {
+			return
+		}
+		if bytes.Equal(t, tail) {
+			from = offset
+		}
+	}
+	if _, err = f.Seek(from, io.SeekStart); err != nil {
+		return
+	}
+	data, err = ioutil.ReadAll(f)
+	return
+}
+
+// readStandbyEpoch returns the standby epoch kept in the agent directory, 0 if there
+// isn't one yet
+func readStandbyEpoch(agentDir string) (epoch int64, err error) {
+	var b []byte
+	if b, err = readFile(agentDir, StandbyEpochFileName); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	epoch, err = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	return
+}
+
+// raiseStandbyEpoch raises the standby epoch kept in the agent directory, fencing off
+// the node that was running with the one before
+func raiseStandbyEpoch(agentDir string) (epoch int64, err error) {
+	if epoch, err = readStandbyEpoch(agentDir); err != nil {
+		return
+	}
+	epoch++
+	p := filepath.Join(agentDir, StandbyEpochFileName)
+	if err = ioutil.WriteFile(p+".tmp", []byte(strconv.FormatInt(epoch, 10)), 0600); err != nil {
+		return
+	}
+	err = os.Rename(p+".tmp", p)
+	return
+}
+
+// checkFence returns ErrFenced if a standby has taken over since the holochain was
+// loaded.  A holochain whose agent isn't kept in an AgentDir can't have standbys take
+// over so is never fenced.
+func (h *Holochain) checkFence() (err error) {
+	if h.config.AgentDir == "" {
+		return
+	}
+	var epoch int64
+	if epoch, err = readStandbyEpoch(h.config.AgentDir); err != nil {
+		return
+	}
+	if epoch > h.standbyEpoch {
+		err = ErrFenced
+	}
+	return
+}
+
+// chainSince returns the chain file from offset, or all of it if offset is past its end
+func (h *Holochain) chainSince(offset int64) (from int64, data []byte, err error) {
+	// entries are written while the lock is held so the file doesn't end part way
+	// through one while it's held
+	h.chain.lk.Lock()
+	defer h.chain.lk.Unlock()
+	var f *os.File
+	if f, err = os.Open(filepath.Join(h.DBPath(), StoreFileName)); err != nil {
+		return
+	}
+	defer f.Close()
+	var info os.FileInfo
+	if info, err = f.Stat(); err != nil {
+		return
+	}
+	if offset <= info.Size() {
+		from = offset
+	}
+	if _, err = f.Seek(from, io.SeekStart); err != nil {
+		return
+	}
+	data, err = ioutil.ReadAll(f)
+	return
+}
+
+// Standby mirrors a primary node into the standby's own copy of the app.  Until it
+// takes over it uses the identity of the service's agent, which must be in the
+// primary's Standbys.
+type Standby struct {
+	Primary peer.ID
+	s       *Service
+	name    string
+	root    string
+	format  string
+	node    *Node
+	req     ReplicateReq
+	keyRef  string
+}
+
+// NewStandby makes a standby of the primary for the holochain called name, which must
+// already be installed in the service from the same DNA as the primary's
+func (s *Service) NewStandby(name string, primary pstore.PeerInfo) (sb *Standby, err error) {
+	root := filepath.Join(s.Path, name)
+	var format string
+	if format, err = findDNA(filepath.Join(root, ChainDNADir)); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Join(root, ChainDataDir), os.ModePerm); err != nil {
+		return
+	}
+	var agent Agent
+	if agent, err = LoadAgent(s.Path); err != nil {
+		return
+	}
+	var node *Node
+	if node, err = NewNode("/ip4/0.0.0.0/tcp/0", agent.(*LibP2PAgent)); err != nil {
+		return
+	}
+	node.Host.Peerstore().AddAddrs(primary.ID, primary.Addrs, pstore.PermanentAddrTTL)
+	sb = &Standby{Primary: primary.ID, s: s, name: name, root: root, format: format, node: node}
+	// carry on from a copy of the chain and DHT store left by an earlier run
+	if info, e := os.Stat(filepath.Join(root, ChainDataDir, StoreFileName)); e == nil {
+		sb.req.ChainOffset = info.Size()
+	}
+	if f, e := os.Open(filepath.Join(root, ChainDataDir, DHTStoreFileName)); e == nil {
+		if info, e := f.Stat(); e == nil {
+			if tail, e := fileTail(f, info.Size()); e == nil {
+				sb.req.DHTOffset = info.Size()
+				sb.req.DHTTail = tail
+			}
+		}
+		f.Close()
+	}
+	return
+}
+
+// Sync fetches what has changed on the primary since the last sync and applies it
+func (sb *Standby) Sync() (err error) {
+	var r Message
+	if r, err = sb.node.Send(ReplicationProtocol, sb.Primary, sb.node.NewMessage(REPLICATE_REQUEST, sb.req)); err != nil {
+		return
+	}
+	switch body := r.Body.(type) {
+	case ReplicateResp:
+		err = sb.apply(&body)
+	case ErrorResponse:
+		err = body.DecodeResponseError()
+	default:
+		err = fmt.Errorf("expected ReplicateResp from primary got %T", r.Body)
+	}
+	return
+}
+
+// writeFileAt replaces the file at path from offset with data
+func writeFileAt(path string, offset int64, data []byte) (err error) {
+	var f *os.File
+	if f, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600); err != nil {
+		return
+	}
+	if err = f.Truncate(offset); err == nil {
+		if _, err = f.WriteAt(data, offset); err == nil {
+			err = f.Sync()
+		}
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+// apply writes the changes from the primary to the standby's copy
+func (sb *Standby) apply(resp *ReplicateResp) (err error) {
+	dbPath := filepath.Join(sb.root, ChainDataDir)
+	if err = writeFileAt(filepath.Join(dbPath, StoreFileName), resp.ChainOffset, resp.Chain); err != nil {
+		return
+	}
+	sb.req.ChainOffset = resp.ChainOffset + int64(len(resp.Chain))
+
+	if resp.DHT != nil || resp.DHTOffset != sb.req.DHTOffset {
+		p := filepath.Join(dbPath, DHTStoreFileName)
+		if err = writeFileAt(p, resp.DHTOffset, resp.DHT); err != nil {
+			return
+		}
+		var f *os.File
+		if f, err = os.Open(p); err != nil {
+			return
+		}
+		sb.req.DHTOffset = resp.DHTOffset + int64(len(resp.DHT))
+		sb.req.DHTTail, err = fileTail(f, sb.req.DHTOffset)
+		f.Close()
+		if err != nil {
+			return
+		}
+	}
+	if resp.DNAHash != "" && !fileExists(sb.root, DNAHashFileName) {
+		if err = writeFile([]byte(resp.DNAHash), sb.root, DNAHashFileName); err != nil {
+			return
+		}
+	}
+	sb.keyRef = resp.KeyRef
+	return
+}
+
+// Run syncs with the primary every interval until stop is closed, taking over once
+// failAfter syncs in a row have failed.  It returns the activated holochain that took
+// over, or nil if it was stopped.
+func (sb *Standby) Run(interval time.Duration, failAfter int, stop chan struct{}) (h *Holochain, err error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		if e := sb.Sync(); e != nil {
+			failures++
+			Infof("standby sync with %v failed (%d in a row): %v", sb.Primary, failures, e)
+		} else {
+			failures = 0
+		}
+		if failures >= failAfter {
+			h, err = sb.TakeOver()
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// TakeOver stops mirroring and starts the copy as the primary, with the primary's
+// agent loaded from where the primary keeps it.  The standby epoch is raised first so
+// that the old primary stops committing and serving standbys if it's still running.
+func (sb *Standby) TakeOver() (h *Holochain, err error) {
+	if sb.keyRef == "" {
+		err = ErrNoKeyRef
+		return
+	}
+	if err = sb.Close(); err != nil {
+		return
+	}
+	if _, err = raiseStandbyEpoch(sb.keyRef); err != nil {
+		return
+	}
+	var config Config
+	p := filepath.Join(sb.root, ConfigFileName+"."+sb.format)
+	if err = decodeFile(p, sb.format, &config); err != nil {
+		return
+	}
+	config.AgentDir = sb.keyRef
+	if err = encodeFile(p, sb.format, &config); err != nil {
+		return
+	}
+	if h, err = sb.s.load(sb.name, sb.format); err != nil {
+		return
+	}
+	if err = h.Activate(); err != nil {
+		h.Close()
+		h = nil
+	}
+	return
+}
+
+// Close shuts down the standby's node
+func (sb *Standby) Close() (err error) {
+	if sb.node != nil {
+		err = sb.node.Close()
+		sb.node = nil
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package holochain
+
+import (
+	"bytes"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestStandby(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	commit(h, "oddNumbers", "7")
+
+	// the standby runs the same app in a service of its own
+	ss, err := Init(filepath.Join(d, "standby"), AgentName("standby"))
+	if err != nil {
+		panic(err)
+	}
+	ss.Settings.DefaultBootstrapServer = ""
+	if err = ss.Clone(filepath.Join(s.Path, "test"), filepath.Join(ss.Path, "test"), ss.DefaultAgent, false); err != nil {
+		panic(err)
+	}
+	standbyID, _, _ := ss.DefaultAgent.NodeID()
+
+	h.config.AgentDir = s.Path
+	h.config.Standbys = []string{peer.IDB58Encode(standbyID)}
+	if err = h.node.StartProtocol(h, ReplicationProtocol); err != nil {
+		panic(err)
+	}
+	sb, err := ss.NewStandby("test", pstore.PeerInfo{ID: h.nodeID, Addrs: []ma.Multiaddr{h.node.NetAddr}})
+	if err != nil {
+		panic(err)
+	}
+	defer sb.Close()
+	chainFile := func(root string) []byte {
+		b, err := ioutil.ReadFile(filepath.Join(root, ChainDataDir, StoreFileName))
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+
+	Convey("the standby should mirror the primary's chain and DHT", t, func() {
+		So(sb.Sync(), ShouldBeNil)
+		So(bytes.Equal(chainFile(sb.root), chainFile(h.rootPath)), ShouldBeTrue)
+		r, err := OpenDHTReader(sb.root)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		mirrored, _ := r.HeldHashes("", "")
+		held, _ := h.dht.HeldHashes("", "")
+		So(mirrored, ShouldResemble, held)
+	})
+
+	Convey("later syncs should only fetch what changed", t, func() {
+		offset := sb.req.ChainOffset
+		commit(h, "oddNumbers", "9")
+		resp, err := h.replicate(sb.req)
+		So(err, ShouldBeNil)
+		So(resp.ChainOffset, ShouldEqual, offset)
+		So(sb.Sync(), ShouldBeNil)
+		So(bytes.Equal(chainFile(sb.root), chainFile(h.rootPath)), ShouldBeTrue)
+
+		resp, err = h.replicate(sb.req)
+		So(err, ShouldBeNil)
+		So(len(resp.Chain), ShouldEqual, 0)
+		So(resp.DHT, ShouldBeNil)
+	})
+
+	Convey("only the DHT store's changes should be shipped", t, func() {
+		offset := sb.req.DHTOffset
+		So(offset, ShouldBeGreaterThan, 0)
+		commit(h, "oddNumbers", "11")
+		resp, err := h.replicate(sb.req)
+		So(err, ShouldBeNil)
+		So(resp.DHTOffset, ShouldEqual, offset)
+		So(len(resp.DHT), ShouldBeGreaterThan, 0)
+		So(sb.Sync(), ShouldBeNil)
+	})
+
+	Convey("a shrunk DHT store should be shipped whole", t, func() {
+		So(h.dht.db.Shrink(), ShouldBeNil)
+		resp, err := h.replicate(sb.req)
+		So(err, ShouldBeNil)
+		So(resp.DHTOffset, ShouldEqual, 0)
+		So(sb.Sync(), ShouldBeNil)
+		r, err := OpenDHTReader(sb.root)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		mirrored, _ := r.HeldHashes("", "")
+		held, _ := h.dht.HeldHashes("", "")
+		So(mirrored, ShouldResemble, held)
+	})
+
+	Convey("only configured standbys should be able to mirror the primary", t, func() {
+		h.config.Standbys = nil
+		err := sb.Sync()
+		So(err.Error(), ShouldEqual, ErrNotStandby.Error())
+		h.config.Standbys = []string{peer.IDB58Encode(standbyID)}
+	})
+
+	Convey("the standby should take over the primary's identity", t, func() {
+		length := h.chain.Length()
+		held, _ := h.dht.HeldHashes("", "")
+		So(h.Close(), ShouldBeNil)
+
+		th, err := sb.TakeOver()
+		So(err, ShouldBeNil)
+		defer th.Close()
+		So(th.nodeID, ShouldEqual, h.nodeID)
+		So(th.checkFence(), ShouldBeNil)
+		So(th.dnaHash.String(), ShouldEqual, h.dnaHash.String())
+		So(th.chain.Length(), ShouldEqual, length)
+		taken, _ := th.dht.HeldHashes("", "")
+		So(taken, ShouldResemble, held)
+	})
+
+	Convey("the old primary should be fenced off once the standby takes over", t, func() {
+		So(h.checkFence(), ShouldEqual, ErrFenced)
+		_, _, err := h.commitEntry(NewCommitAction("oddNumbers", &GobEntry{C: "13"}), nil, nil)
+		So(err, ShouldEqual, ErrFenced)
+	})
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// status implements the entry statuses a DNA declares beyond the system ones, such as
+// Flagged or Archived.  Each gets a bit of the status mask above the system statuses,
+// and entries are moved into them, or back to Live, by committing a StatusEntry, which
+// the app authorizes in validateSetStatus and the DHT applies and gossips like a del.
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/buntdb"
+	"regexp"
+)
+
+const (
+	// StatusCustom is the status bit of the first status a DNA declares, the others
+	// following it in the order they are declared
+	StatusCustom = 0x100
+	// StatusCustomAny is the mask of all the statuses a DNA can declare
+	StatusCustomAny = 0xFF00
+
+	MaxCustomStatuses = 8
+)
+
+var ErrUnknownStatus = errors.New("unknown status")
+var ErrHashCustomStatus = errors.New("hash has a custom status")
+
+// statusNameRE is what status names must look like, so that they can be used in the
+// names the ribosomes give them, like HC.Status.Flagged and HC_Status_Flagged
+var statusNameRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// systemStatuses are the names of the statuses a DNA can't declare
+var systemStatuses = map[string]bool{
+	"Default": true, "Live": true, "Rejected": true, "Deleted": true,
+	"Modified": true, "Pending": true, "Expired": true, "Any": true,
+}
+
+// StatusDef declares a status entries can be moved into
+type StatusDef struct {
+	Name        string
+	Description string
+}
+
+// StatusEntry is the content of the entry recording that an entry was moved into a
+// status
+type StatusEntry struct {
+	Hash    Hash   // the entry whose status is set
+	Status  string // the name of a status the DNA declares, or Live
+	Message string
+}
+
+// StatusReq holds the data of a status request
+type StatusReq struct {
+	H  Hash // hash whose status is set
+	By Hash // hash of the StatusEntry on the source chain that took this action
+}
+
+// checkStatuses checks the statuses the DNA declares
+func (dna *DNA) checkStatuses() (err error) {
+	if len(dna.Statuses) > MaxCustomStatuses {
+		err = fmt.Errorf("DNA declares %d statuses, the most it can is %d", len(dna.Statuses), MaxCustomStatuses)
+		return
+	}
+	seen := make(map[string]bool)
+	for _, s := range dna.Statuses {
+		if !statusNameRE.MatchString(s.Name) || systemStatuses[s.Name] || seen[s.Name] {
+			err = fmt.Errorf("bad status name %q: must be unique, alphanumeric and not a system status", s.Name)
+			return
+		}
+		seen[s.Name] = true
+	}
+	return
+}
+
+// statusValue returns the status bit of a status the DNA declares, or of Live, which
+// entries can be moved back to
+func (dna *DNA) statusValue(name string) (status int, err error) {
+	if name == "Live" {
+		status = StatusLive
+		return
+	}
+	for i, s := range dna.Statuses {
+		if s.Name == name {
+			status = StatusCustom << uint(i)
+			return
+		}
+	}
+	err = fmt.Errorf("%w: %s", ErrUnknownStatus, name)
+	return
+}
+
+// setStatus moves the given hash to a status
+// N.B. this functions assumes that the validity of this action has been confirmed
+func (dht *DHT) setStatus(m *Message, key Hash, status int) (err error) {
+	k := key.String()
+	dht.dlog.Logf("setStatus %s to %d", k, status)
+	err = dht.update(func(tx *buntdb.Tx) error {
+		return _setStatus(tx, m, k, status)
+	})
+	return
+}
+
+// entryTypeOf returns the entry type of a hash, from the chain if it's ours and from
+// the DHT if not
+func (h *Holochain) entryTypeOf(zome string, hash Hash) (entryType string, err error) {
+	if header, e := h.chain.GetEntryHeader(hash); e == nil {
+		entryType = header.Type
+		return
+	}
+	req := GetReq{H: hash, StatusMask: StatusLive | StatusCustomAny, GetMask: GetMaskEntryType}
+	var r interface{}
+	if r, err = h.doAction(zome, NewGetAction(req, &GetOptions{StatusMask: req.StatusMask, GetMask: req.GetMask})); err != nil {
+		return
+	}
+	entryType = r.(GetResp).EntryType
+	return
+}
@@ -0,0 +1,100 @@
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCheckStatuses(t *testing.T) {
+	Convey("it should accept unique alphanumeric names", t, func() {
+		dna := DNA{Statuses: []StatusDef{{Name: "Flagged"}, {Name: "Archived2"}}}
+		So(dna.checkStatuses(), ShouldBeNil)
+	})
+
+	Convey("it should reject bad, duplicate and system names", t, func() {
+		for _, names := range [][]string{{""}, {"Has Space"}, {"Live"}, {"Any"}, {"Flagged", "Flagged"}} {
+			dna := DNA{}
+			for _, n := range names {
+				dna.Statuses = append(dna.Statuses, StatusDef{Name: n})
+			}
+			So(dna.checkStatuses(), ShouldNotBeNil)
+		}
+	})
+
+	Convey("it should reject too many statuses", t, func() {
+		dna := DNA{}
+		for i := 0; i <= MaxCustomStatuses; i++ {
+			dna.Statuses = append(dna.Statuses, StatusDef{Name: fmt.Sprintf("S%d", i)})
+		}
+		So(dna.checkStatuses(), ShouldNotBeNil)
+	})
+
+	Convey("statuses should get bits in the order declared", t, func() {
+		dna := DNA{Statuses: []StatusDef{{Name: "Flagged"}, {Name: "Archived"}}}
+		s, err := dna.statusValue("Flagged")
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, StatusCustom)
+		s, err = dna.statusValue("Archived")
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, StatusCustom<<1)
+		s, err = dna.statusValue("Live")
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, StatusLive)
+		_, err = dna.statusValue("Deleted")
+		So(errors.Is(err, ErrUnknownStatus), ShouldBeTrue)
+		So(StatusAny&StatusCustomAny, ShouldEqual, StatusCustomAny)
+	})
+}
+
+func TestSetStatus(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	hash := commit(h, "oddNumbers", "7")
+
+	run := func(code string) string {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: code})
+		So(err, ShouldBeNil)
+		return v.(*JSRibosome).lastResult.String()
+	}
+
+	Convey("the DNA's statuses should be in the HC library", t, func() {
+		So(run(`HC.Status.Flagged`), ShouldEqual, fmt.Sprintf("%d", StatusCustom))
+	})
+
+	Convey("it should move an entry into a status", t, func() {
+		r := run(fmt.Sprintf(`setStatus("%s","Flagged","spam")`, hash.String()))
+		_, err := NewHash(r)
+		So(err, ShouldBeNil)
+
+		So(run(fmt.Sprintf(`get("%s").code`, hash.String())), ShouldEqual, ErrorCodeHashCustomStatus)
+		So(run(fmt.Sprintf(`get("%s",{StatusMask:HC.Status.Flagged})`, hash.String())), ShouldEqual, "7")
+		So(run(fmt.Sprintf(`get("%s",{StatusMask:HC.Status.Live}).code`, hash.String())), ShouldEqual, ErrorCodeHashNotFound)
+		So(h.dht.exists(hash, StatusAny), ShouldBeNil)
+	})
+
+	Convey("it should move an entry back to live", t, func() {
+		run(fmt.Sprintf(`setStatus("%s","Live")`, hash.String()))
+		So(run(fmt.Sprintf(`get("%s")`, hash.String())), ShouldEqual, "7")
+	})
+
+	Convey("it should refuse statuses the DNA doesn't declare", t, func() {
+		So(run(fmt.Sprintf(`setStatus("%s","Archived").code`, hash.String())), ShouldEqual, ErrorCodeUnknown)
+		So(run(fmt.Sprintf(`setStatus("%s","Deleted").code`, hash.String())), ShouldEqual, ErrorCodeUnknown)
+	})
+
+	Convey("entries in a DNA's statuses should still be deletable", t, func() {
+		flagged := commit(h, "oddNumbers", "9")
+		run(fmt.Sprintf(`setStatus("%s","Flagged")`, flagged.String()))
+		r := run(fmt.Sprintf(`remove("%s","mistake")`, flagged.String()))
+		_, err := NewHash(r)
+		So(err, ShouldBeNil)
+		So(h.dht.exists(flagged, StatusDeleted), ShouldBeNil)
+	})
+
+	Convey("it should refuse transitions the app doesn't authorize", t, func() {
+		secret := commit(h, "secret", "31415")
+		So(run(fmt.Sprintf(`setStatus("%s","Flagged").code`, secret.String())), ShouldEqual, ErrorCodeValidationFailed)
+	})
+}
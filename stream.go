@@ -0,0 +1,86 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// stream implements zome calls whose results are written in chunks to a reader rather
+// than returned all at once
+
+package holochain
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNoStream = errors.New("function not called with streaming")
+
+// Streamer is implemented by ribosomes that support the stream built-in
+type Streamer interface {
+	SetStream(w io.Writer)
+}
+
+// countingWriter records whether anything was written through it
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += n
+	return
+}
+
+// callStream is the reader side of a streaming call; closing it aborts the call
+type callStream struct {
+	*io.PipeReader
+	n Ribosome
+}
+
+func (s *callStream) Close() error {
+	if i, ok := s.n.(Interrupter); ok {
+		i.Interrupt()
+	}
+	return s.PipeReader.Close()
+}
+
+// CallStream executes an exposed function returning a reader of the chunks the function
+// writes with the stream built-in, which the caller must close.  If the function doesn't
+// write any chunks its return value is the only chunk.  Errors from the function or the
+// context are returned by Read once the chunks written before them have been read.
+func (h *Holochain) CallStream(ctx context.Context, zomeType string, function string, arguments interface{}, exposureContext string) (r io.ReadCloser, err error) {
+	n, z, err := h.MakeRibosome(zomeType)
+	if err != nil {
+		return
+	}
+	pr, pw := io.Pipe()
+	cw := &countingWriter{w: pw}
+	if s, ok := n.(Streamer); ok {
+		s.SetStream(cw)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, e := h.call(n, z, function, arguments, exposureContext)
+		if e == nil && cw.n == 0 {
+			if s, ok := result.(string); ok && s != "" {
+				_, e = io.WriteString(pw, s)
+			}
+		}
+		pw.CloseWithError(e)
+	}()
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if i, ok := n.(Interrupter); ok {
+				i.Interrupt()
+			}
+			pw.CloseWithError(contextErr(ctx))
+		}
+	}()
+	r = &callStream{PipeReader: pr, n: n}
+	return
+}
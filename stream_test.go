@@ -0,0 +1,80 @@
+package holochain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestCallStream(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	h.nucleus.dna.Zomes[1].Code += `function streamer(x){for(var i=0;i<3;i++){stream.write("chunk"+i)};return "ignored"};function spin(x){stream.write("start");while(true){}}`
+	h.nucleus.dna.Zomes[1].Functions = append(h.nucleus.dna.Zomes[1].Functions,
+		FunctionDef{Name: "streamer", CallingType: STRING_CALLING},
+		FunctionDef{Name: "spin", CallingType: STRING_CALLING})
+
+	Convey("it should return the chunks written by the function", t, func() {
+		r, err := h.CallStream(context.Background(), "jsSampleZome", "streamer", "", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "chunk0chunk1chunk2")
+	})
+
+	Convey("it should return the result of functions that don't stream", t, func() {
+		r, err := h.CallStream(context.Background(), "zySampleZome", "testStrFn1", "foo", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "result: foo")
+	})
+
+	Convey("it should return call errors from Read", t, func() {
+		r, err := h.CallStream(context.Background(), "zySampleZome", "testStrFn1", "foo", PUBLIC_EXPOSURE)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		_, err = ioutil.ReadAll(r)
+		So(err.Error(), ShouldEqual, "function not available")
+	})
+
+	Convey("it should end the stream when the context is done", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		r, err := h.CallStream(ctx, "jsSampleZome", "spin", "", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		So(string(b), ShouldEqual, "start")
+		So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+	})
+
+	Convey("the stream built-in should fail outside of streaming calls", t, func() {
+		_, err := NewStreamWriteAction(nil, "x").Do(h)
+		So(err, ShouldEqual, ErrNoStream)
+
+		var buf bytes.Buffer
+		_, err = NewStreamWriteAction(&buf, "x").Do(h)
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldEqual, "x")
+	})
+
+	Convey("zygo functions should be able to stream", t, func() {
+		zome, _ := h.GetZome("zySampleZome")
+		v, err := NewZygoRibosome(h, zome)
+		So(err, ShouldBeNil)
+		z := v.(*ZygoRibosome)
+		var buf bytes.Buffer
+		z.SetStream(&buf)
+		_, err = z.Run(`(begin (streamWrite "a") (streamWrite 1))`)
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldEqual, "a1")
+	})
+}
@@ -0,0 +1,284 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// tasks implements running zome functions in the background with progress reporting
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	TaskQueued  = "queued"
+	TaskRunning = "running"
+	TaskDone    = "done"
+	TaskFailed  = "failed"
+
+	// MaxConcurrentTasks is the number of background tasks that can run at once, the
+	// rest wait in the queue
+	MaxConcurrentTasks = 4
+	// MaxQueuedTasks is the number of tasks that can wait in the queue, spawning more
+	// fails until some have run
+	MaxQueuedTasks = 64
+	// MaxFinishedTasks is the number of finished tasks whose status is kept, the oldest
+	// being forgotten first
+	MaxFinishedTasks = 256
+	// FinishedTaskRetention is how long the status of a finished task is kept
+	FinishedTaskRetention = time.Hour
+)
+
+var ErrTaskNotFound = errors.New("task not found")
+var ErrTaskQueueFull = errors.New("too many tasks queued")
+var ErrTasksStopped = errors.New("tasks stopped")
+
+// Task holds the status of a zome function spawned to run in the background
+type Task struct {
+	ID       string
+	Zome     string
+	Function string
+	Status   string
+	Progress int    // percent complete as reported by the task
+	Message  string // last progress message reported by the task
+	Result   string `json:",omitempty"`
+	Error    string `json:",omitempty"`
+	Queued   time.Time
+	Started  time.Time
+	Finished time.Time
+
+	args string
+	seq  int
+}
+
+// TaskRunner queues and runs background tasks
+type TaskRunner struct {
+	h       *Holochain
+	lk      sync.RWMutex
+	tasks   map[string]*Task
+	count   int
+	running int     // the number of goroutines running tasks
+	queue   []*Task // tasks waiting for one of them
+	stopped bool
+	wg      sync.WaitGroup
+	calls   map[string]Ribosome // the ribosomes of the running tasks
+}
+
+// NewTaskRunner returns a TaskRunner for the holochain
+func NewTaskRunner(h *Holochain) *TaskRunner {
+	r := TaskRunner{
+		h:     h,
+		tasks: make(map[string]*Task),
+		calls: make(map[string]Ribosome),
+	}
+	return &r
+}
+
+// Tasks returns the holochain's background task runner
+func (h *Holochain) Tasks() *TaskRunner {
+	return h.tasks
+}
+
+// Spawn queues a function of the given zome to be called in the background with args
+// and returns the id of the task, which is prefixed with the zome name
+func (r *TaskRunner) Spawn(zome string, function string, args string) (id string, err error) {
+	var z *Zome
+	z, err = r.h.GetZome(zome)
+	if err != nil {
+		return
+	}
+	_, err = z.GetFunctionDef(function)
+	if err != nil {
+		return
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if r.stopped {
+		err = ErrTasksStopped
+		return
+	}
+	if r.running == MaxConcurrentTasks && len(r.queue) >= MaxQueuedTasks {
+		err = ErrTaskQueueFull
+		return
+	}
+	r.prune(time.Now())
+	r.count++
+	id = zome + ":" + strconv.Itoa(r.count)
+	t := &Task{ID: id, Zome: zome, Function: function, Status: TaskQueued, Queued: time.Now(), args: args, seq: r.count}
+	r.tasks[id] = t
+	if r.running < MaxConcurrentTasks {
+		r.running++
+		r.wg.Add(1)
+		go r.run(t)
+	} else {
+		r.queue = append(r.queue, t)
+	}
+	return
+}
+
+// prune forgets the finished tasks that are past FinishedTaskRetention, and the oldest
+// ones past MaxFinishedTasks
+func (r *TaskRunner) prune(now time.Time) {
+	var finished []*Task
+	for id, t := range r.tasks {
+		if t.Status != TaskDone && t.Status != TaskFailed {
+			continue
+		}
+		if now.Sub(t.Finished) > FinishedTaskRetention {
+			delete(r.tasks, id)
+		} else {
+			finished = append(finished, t)
+		}
+	}
+	if len(finished) <= MaxFinishedTasks {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].Finished.Before(finished[j].Finished) })
+	for _, t := range finished[:len(finished)-MaxFinishedTasks] {
+		delete(r.tasks, t.ID)
+	}
+}
+
+// Get returns a copy of the task with the given id
+func (r *TaskRunner) Get(id string) (task Task, err error) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	t, ok := r.tasks[id]
+	if !ok {
+		err = ErrTaskNotFound
+		return
+	}
+	task = *t
+	return
+}
+
+// List returns copies of all the tasks in the order they were spawned
+func (r *TaskRunner) List() (tasks []Task) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	for _, t := range r.tasks {
+		tasks = append(tasks, *t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].seq < tasks[j].seq })
+	return
+}
+
+// SetProgress records the progress reported by a running task
+func (r *TaskRunner) SetProgress(id string, progress int, message string) (err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	t, ok := r.tasks[id]
+	if !ok {
+		err = ErrTaskNotFound
+		return
+	}
+	t.Progress = progress
+	t.Message = message
+	return
+}
+
+// Stop fails the queued tasks, interrupts the running ones that can be interrupted and
+// waits for them to finish.  No more tasks can be spawned afterwards.
+func (r *TaskRunner) Stop() {
+	r.lk.Lock()
+	r.stopped = true
+	for _, t := range r.queue {
+		r.finish(t, nil, ErrTasksStopped)
+	}
+	r.queue = nil
+	for _, n := range r.calls {
+		if i, ok := n.(Interrupter); ok {
+			i.Interrupt()
+		}
+	}
+	r.lk.Unlock()
+	r.wg.Wait()
+}
+
+// started records the ribosome a task is running in so that Stop can interrupt it
+func (r *TaskRunner) started(id string, n Ribosome) (err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if r.stopped {
+		err = ErrTasksStopped
+		return
+	}
+	r.calls[id] = n
+	return
+}
+
+// run runs the task and then the queued ones until the queue is empty
+func (r *TaskRunner) run(t *Task) {
+	defer r.wg.Done()
+	for t != nil {
+		r.lk.Lock()
+		t.Status = TaskRunning
+		t.Started = time.Now()
+		r.lk.Unlock()
+
+		result, err := r.h.callTask(t.ID, t.Zome, t.Function, t.args, r.started)
+
+		r.lk.Lock()
+		delete(r.calls, t.ID)
+		r.finish(t, result, err)
+		t = nil
+		if len(r.queue) > 0 {
+			t = r.queue[0]
+			r.queue = r.queue[1:]
+		} else {
+			r.running--
+		}
+		r.lk.Unlock()
+	}
+}
+
+// finish records the outcome of a task
+func (r *TaskRunner) finish(t *Task, result interface{}, err error) {
+	t.Finished = time.Now()
+	if err != nil {
+		t.Status = TaskFailed
+		t.Error = err.Error()
+		r.h.config.Loggers.App.Logf("task %s (%s:%s) failed: %v", t.ID, t.Zome, t.Function, err)
+		return
+	}
+	t.Status = TaskDone
+	t.Progress = 100
+	if s, ok := result.(string); ok {
+		t.Result = s
+	} else {
+		t.Result = fmt.Sprintf("%v", result)
+	}
+}
+
+// callTask calls a zome function with the task id available to the code as App.Task.ID
+// in JS and App_Task_ID in zygo, passing the ribosome to started before running anything
+func (h *Holochain) callTask(id string, zome string, function string, args string, started func(string, Ribosome) error) (result interface{}, err error) {
+	n, z, err := h.MakeRibosome(zome)
+	if err != nil {
+		return
+	}
+	err = started(id, n)
+	if err != nil {
+		return
+	}
+	var code string
+	switch n.Type() {
+	case JSRibosomeType:
+		code = fmt.Sprintf(`App.Task={ID:"%s"};`, id)
+	case ZygoRibosomeType:
+		code = fmt.Sprintf(`(def App_Task_ID "%s")`, id)
+	}
+	if code != "" {
+		_, err = n.Run(code)
+		if err != nil {
+			return
+		}
+	}
+	result, err = h.call(n, z, function, args, ZOME_EXPOSURE)
+	return
+}
@@ -0,0 +1,132 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func waitForTask(h *Holochain, id string) (task Task) {
+	for i := 0; i < 100; i++ {
+		task, _ = h.Tasks().Get(id)
+		if task.Status == TaskDone || task.Status == TaskFailed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return
+}
+
+func TestTasks(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("spawning an unknown function should fail", t, func() {
+		_, err := h.Tasks().Spawn("jsSampleZome", "foo", "")
+		So(err.Error(), ShouldEqual, "unknown exposed function: foo")
+		_, err = h.Tasks().Get("foo")
+		So(err, ShouldEqual, ErrTaskNotFound)
+	})
+
+	Convey("spawned functions should run in the background", t, func() {
+		id, err := h.Tasks().Spawn("jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, "jsSampleZome:1")
+		task := waitForTask(h, id)
+		So(task.ID, ShouldEqual, id)
+		So(task.Zome, ShouldEqual, "jsSampleZome")
+		So(task.Function, ShouldEqual, "testStrFn1")
+		So(task.Status, ShouldEqual, TaskDone)
+		So(task.Progress, ShouldEqual, 100)
+		So(task.Result, ShouldEqual, "result: foo")
+		So(task.Finished.After(task.Started), ShouldBeTrue)
+
+		tasks := h.Tasks().List()
+		So(len(tasks), ShouldEqual, 1)
+		So(tasks[0].ID, ShouldEqual, id)
+	})
+
+	Convey("failing tasks should record the error", t, func() {
+		id, err := h.Tasks().Spawn("jsSampleZome", "testJsonFn1", "bad json")
+		So(err, ShouldBeNil)
+		task := waitForTask(h, id)
+		So(task.Status, ShouldEqual, TaskFailed)
+		So(task.Error, ShouldNotEqual, "")
+	})
+
+	Convey("tasks should be able to report progress with their id", t, func() {
+		h.nucleus.dna.Zomes[1].Code += `function taskWork(x){taskProgress(App.Task.ID,50,"half");return getTask(App.Task.ID).Message}`
+		h.nucleus.dna.Zomes[1].Functions = append(h.nucleus.dna.Zomes[1].Functions, FunctionDef{Name: "taskWork", CallingType: STRING_CALLING})
+		id, err := h.Tasks().Spawn("jsSampleZome", "taskWork", "")
+		So(err, ShouldBeNil)
+		task := waitForTask(h, id)
+		So(task.Error, ShouldEqual, "")
+		So(task.Result, ShouldEqual, "half")
+
+		So(h.Tasks().SetProgress(id, 20, "again"), ShouldBeNil)
+		task, _ = h.Tasks().Get(id)
+		So(task.Progress, ShouldEqual, 20)
+		So(task.Message, ShouldEqual, "again")
+	})
+}
+
+func TestTaskLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("spawning should fail when the queue is full", t, func() {
+		r := NewTaskRunner(h)
+		r.running = MaxConcurrentTasks
+		for i := 0; i < MaxQueuedTasks; i++ {
+			r.queue = append(r.queue, &Task{})
+		}
+		_, err := r.Spawn("jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldEqual, ErrTaskQueueFull)
+
+		// a queued task should start once a running one finishes
+		r.queue = r.queue[:MaxQueuedTasks-1]
+		id, err := r.Spawn("jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldBeNil)
+		task, _ := r.Get(id)
+		So(task.Status, ShouldEqual, TaskQueued)
+		So(len(r.queue), ShouldEqual, MaxQueuedTasks)
+	})
+
+	Convey("finished tasks should be forgotten after a while or when there are too many", t, func() {
+		r := NewTaskRunner(h)
+		now := time.Now()
+		for i := 1; i <= MaxFinishedTasks+2; i++ {
+			id := fmt.Sprintf("%d", i)
+			r.tasks[id] = &Task{ID: id, Status: TaskDone, Finished: now.Add(time.Duration(i) * time.Second)}
+		}
+		r.tasks["old"] = &Task{ID: "old", Status: TaskFailed, Finished: now.Add(-FinishedTaskRetention - time.Second)}
+		r.tasks["running"] = &Task{ID: "running", Status: TaskRunning}
+		r.prune(now)
+		So(len(r.tasks), ShouldEqual, MaxFinishedTasks+1)
+		_, err := r.Get("old")
+		So(err, ShouldEqual, ErrTaskNotFound)
+		_, err = r.Get("1")
+		So(err, ShouldEqual, ErrTaskNotFound)
+		_, err = r.Get("2")
+		So(err, ShouldEqual, ErrTaskNotFound)
+		_, err = r.Get("3")
+		So(err, ShouldBeNil)
+		_, err = r.Get("running")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("stopping should fail the queued tasks and refuse new ones", t, func() {
+		r := NewTaskRunner(h)
+		r.running = MaxConcurrentTasks
+		id, err := r.Spawn("jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldBeNil)
+		r.Stop()
+		task, _ := r.Get(id)
+		So(task.Status, ShouldEqual, TaskFailed)
+		So(task.Error, ShouldEqual, ErrTasksStopped.Error())
+		So(len(r.queue), ShouldEqual, 0)
+		_, err = r.Spawn("jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldEqual, ErrTasksStopped)
+	})
+}
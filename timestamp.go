@@ -0,0 +1,449 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// timestamp implements attaching timestamps signed by external time authorities to
+// headers, for apps that need more than the author's word for when an entry was made.
+// The authorities speak the roughtime protocol, whose replies anyone can verify with the
+// authority's public key.  The nonce sent is the hash of what the header's signature is
+// made over, so a reply proves the entry existed by the time the authority signed it.
+// (NTS isn't supported as its replies are authenticated with keys shared with just the
+// client, so other nodes couldn't verify them.)
+
+package holochain
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TimeAuthority is a roughtime server whose signed timestamps are attached to headers.
+// The authorities are listed in the DNA, and only timestamps signed with their keys there
+// are accepted.
+type TimeAuthority struct {
+	Name string
+	// Address is the host:port of the server, which is queried over UDP
+	Address string
+	// PublicKey is the server's base64 encoded ed25519 long-term public key
+	PublicKey string
+}
+
+// TimeStamp is a time authority's signed reply to a request made with a header's nonce
+type TimeStamp struct {
+	Authority string
+	PublicKey []byte
+	Reply     []byte
+}
+
+const (
+	MaxHeaderTimestamps = 8 // maximum number of timestamps attached to a header
+
+	// TimeAuthorityTimeout is how long to wait for the time authorities' replies, which
+	// are requested all at once
+	TimeAuthorityTimeout = 2 * time.Second
+
+	roughtimeRequestSize = 1024
+	roughtimeMaxReply    = 1280
+)
+
+var ErrBadTimeAuthority = errors.New("bad time authority")
+var ErrBadTimeStamp = errors.New("bad timestamp")
+var ErrNoTimeStamp = errors.New("couldn't get a timestamp from any time authority")
+var ErrTimeStampMismatch = errors.New("header time doesn't match its timestamp")
+
+var (
+	roughtimeDelegationContext = []byte("RoughTime v1 delegation signature--\x00")
+	roughtimeResponseContext   = []byte("RoughTime v1 response signature\x00")
+)
+
+func roughtimeTag(s string) uint32 {
+	return binary.LittleEndian.Uint32([]byte(s))
+}
+
+var (
+	tagSIG  = roughtimeTag("SIG\x00")
+	tagNONC = roughtimeTag("NONC")
+	tagPAD  = roughtimeTag("PAD\xff")
+	tagSREP = roughtimeTag("SREP")
+	tagCERT = roughtimeTag("CERT")
+	tagINDX = roughtimeTag("INDX")
+	tagPATH = roughtimeTag("PATH")
+	tagROOT = roughtimeTag("ROOT")
+	tagMIDP = roughtimeTag("MIDP")
+	tagRADI = roughtimeTag("RADI")
+	tagDELE = roughtimeTag("DELE")
+	tagPUBK = roughtimeTag("PUBK")
+	tagMINT = roughtimeTag("MINT")
+	tagMAXT = roughtimeTag("MAXT")
+)
+
+// encodeRoughtimeMessage encodes a roughtime message: the number of tags, the offsets
+// of all but the first value, the tags in increasing order, and then the values
+func encodeRoughtimeMessage(msg map[uint32][]byte) (b []byte, err error) {
+	tags := make([]uint32, 0, len(msg))
+	for t, v := range msg {
+		if len(v)%4 != 0 {
+			err = fmt.Errorf("roughtime value of tag %x isn't a multiple of 4 bytes", t)
+			return
+		}
+		tags = append(tags, t)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(len(tags)))
+	offset := uint32(0)
+	for i, t := range tags {
+		if i > 0 {
+			binary.Write(&buf, binary.LittleEndian, offset)
+		}
+		offset += uint32(len(msg[t]))
+	}
+	for _, t := range tags {
+		binary.Write(&buf, binary.LittleEndian, t)
+	}
+	for _, t := range tags {
+		buf.Write(msg[t])
+	}
+	b = buf.Bytes()
+	return
+}
+
+// decodeRoughtimeMessage decodes a roughtime message into its values by tag
+func decodeRoughtimeMessage(b []byte) (msg map[uint32][]byte, err error) {
+	err = fmt.Errorf("%w: malformed roughtime message", ErrBadTimeStamp)
+	if len(b) < 4 || len(b)%4 != 0 {
+		return
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	if n == 0 || n > len(b)/8 {
+		return
+	}
+	offsets := b[4 : 4*n]
+	tags := b[4*n : 8*n]
+	values := b[8*n:]
+	msg = make(map[uint32][]byte, n)
+	start := uint32(0)
+	var prev uint32
+	for i := 0; i < n; i++ {
+		end := uint32(len(values))
+		if i < n-1 {
+			end = binary.LittleEndian.Uint32(offsets[4*i:])
+		}
+		t := binary.LittleEndian.Uint32(tags[4*i:])
+		if end < start || end > uint32(len(values)) || end%4 != 0 || (i > 0 && t <= prev) {
+			msg = nil
+			return
+		}
+		msg[t] = values[start:end]
+		start, prev = end, t
+	}
+	err = nil
+	return
+}
+
+// roughtimeRequest returns a request for a timestamp of nonce, padded to the size
+// servers require
+func roughtimeRequest(nonce []byte) ([]byte, error) {
+	// a message of two tags has a 16 byte header
+	pad := roughtimeRequestSize - 16 - len(nonce)
+	return encodeRoughtimeMessage(map[uint32][]byte{tagNONC: nonce, tagPAD: make([]byte, pad)})
+}
+
+// queryRoughtime sends a request for a timestamp of nonce to the server at address and
+// returns its reply if it arrives by the deadline
+func queryRoughtime(address string, nonce []byte, deadline time.Time) (reply []byte, err error) {
+	req, err := roughtimeRequest(nonce)
+	if err != nil {
+		return
+	}
+	conn, err := net.DialTimeout("udp", address, time.Until(deadline))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(deadline); err != nil {
+		return
+	}
+	if _, err = conn.Write(req); err != nil {
+		return
+	}
+	buf := make([]byte, roughtimeMaxReply)
+	n, err := conn.Read(buf)
+	if err == nil {
+		reply = buf[:n]
+	}
+	return
+}
+
+// timestampNonce returns the nonce timestamps of the header are requested with
+func (hd *Header) timestampNonce() (nonce []byte, err error) {
+	data, err := hd.signedData()
+	if err != nil {
+		return
+	}
+	sum := sha512.Sum512(data)
+	nonce = sum[:]
+	return
+}
+
+// Verify checks that the timestamp is a reply signed with the authority's trusted public
+// key to a request made with nonce and returns the time the authority gave and its
+// uncertainty.  The key carried in the timestamp must be the trusted one.
+func (ts *TimeStamp) Verify(key []byte, nonce []byte) (midpoint time.Time, radius time.Duration, err error) {
+	bad := func(why string) error { return fmt.Errorf("%w from %s: %s", ErrBadTimeStamp, ts.Authority, why) }
+	resp, err := decodeRoughtimeMessage(ts.Reply)
+	if err != nil {
+		return
+	}
+	sig, srepBytes, certBytes, path, indx := resp[tagSIG], resp[tagSREP], resp[tagCERT], resp[tagPATH], resp[tagINDX]
+	if len(sig) != ed25519.SignatureSize || len(indx) != 4 || len(path)%sha512.Size != 0 {
+		err = bad("missing or malformed reply fields")
+		return
+	}
+	cert, err := decodeRoughtimeMessage(certBytes)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(ts.PublicKey, key) {
+		err = bad("not signed with the authority's key")
+		return
+	}
+	deleBytes := cert[tagDELE]
+	if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, append(append([]byte{}, roughtimeDelegationContext...), deleBytes...), cert[tagSIG]) {
+		err = bad("bad delegation signature")
+		return
+	}
+	dele, err := decodeRoughtimeMessage(deleBytes)
+	if err != nil {
+		return
+	}
+	pubk, mint, maxt := dele[tagPUBK], dele[tagMINT], dele[tagMAXT]
+	if len(pubk) != ed25519.PublicKeySize || len(mint) != 8 || len(maxt) != 8 {
+		err = bad("malformed delegation")
+		return
+	}
+	if !ed25519.Verify(pubk, append(append([]byte{}, roughtimeResponseContext...), srepBytes...), sig) {
+		err = bad("bad response signature")
+		return
+	}
+	srep, err := decodeRoughtimeMessage(srepBytes)
+	if err != nil {
+		return
+	}
+	root, midp, radi := srep[tagROOT], srep[tagMIDP], srep[tagRADI]
+	if len(root) != sha512.Size || len(midp) != 8 || len(radi) != 4 {
+		err = bad("malformed signed response")
+		return
+	}
+	mid := binary.LittleEndian.Uint64(midp)
+	if mid < binary.LittleEndian.Uint64(mint) || mid > binary.LittleEndian.Uint64(maxt) {
+		err = bad("time outside the delegation's validity")
+		return
+	}
+
+	// the nonce must be a leaf of the merkle tree whose root was signed
+	hash := sha512.Sum512(append([]byte{0}, nonce...))
+	idx := binary.LittleEndian.Uint32(indx)
+	for i := 0; i < len(path); i += sha512.Size {
+		node := []byte{1}
+		if idx&1 == 0 {
+			node = append(append(node, hash[:]...), path[i:i+sha512.Size]...)
+		} else {
+			node = append(append(node, path[i:i+sha512.Size]...), hash[:]...)
+		}
+		hash = sha512.Sum512(node)
+		idx >>= 1
+	}
+	if !bytes.Equal(hash[:], root) {
+		err = bad("nonce not in signed merkle tree")
+		return
+	}
+	midpoint = time.UnixMicro(int64(mid)).UTC()
+	radius = time.Duration(binary.LittleEndian.Uint32(radi)) * time.Microsecond
+	return
+}
+
+// publicKey decodes the authority's public key
+func (a *TimeAuthority) publicKey() (key []byte, err error) {
+	key, err = base64.StdEncoding.DecodeString(a.PublicKey)
+	if err == nil && len(key) != ed25519.PublicKeySize {
+		err = errors.New("wrong key size")
+	}
+	if err != nil {
+		err = fmt.Errorf("%w %s: %v", ErrBadTimeAuthority, a.Name, err)
+	}
+	return
+}
+
+// stamp gets a verified timestamp of nonce from the authority by the deadline
+func (a *TimeAuthority) stamp(nonce []byte, deadline time.Time) (ts TimeStamp, err error) {
+	key, err := a.publicKey()
+	if err != nil {
+		return
+	}
+	reply, err := queryRoughtime(a.Address, nonce, deadline)
+	if err != nil {
+		return
+	}
+	ts = TimeStamp{Authority: a.Name, PublicKey: key, Reply: reply}
+	_, _, err = ts.Verify(key, nonce)
+	return
+}
+
+// timeAuthorityKey returns the trusted key of the DNA's time authority with the name
+func (dna *DNA) timeAuthorityKey(name string) (key []byte, err error) {
+	for i := range dna.TimeAuthorities {
+		if dna.TimeAuthorities[i].Name == name {
+			key, err = dna.TimeAuthorities[i].publicKey()
+			return
+		}
+	}
+	err = fmt.Errorf("%w from %s: not one of the DNA's time authorities", ErrBadTimeStamp, name)
+	return
+}
+
+// validateTimeAuthorities checks the DNA's time authorities
+func validateTimeAuthorities(authorities []TimeAuthority) (err error) {
+	if len(authorities) > MaxHeaderTimestamps {
+		err = fmt.Errorf("%w: more than %d time authorities", ErrBadTimeAuthority, MaxHeaderTimestamps)
+		return
+	}
+	names := make(map[string]bool)
+	for i := range authorities {
+		if names[authorities[i].Name] {
+			err = fmt.Errorf("%w %s: listed twice", ErrBadTimeAuthority, authorities[i].Name)
+			return
+		}
+		names[authorities[i].Name] = true
+		if authorities[i].Address == "" {
+			err = fmt.Errorf("%w %s: no address", ErrBadTimeAuthority, authorities[i].Name)
+			return
+		}
+		if _, err = authorities[i].publicKey(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// timestampHeader attaches timestamps from the DNA's time authorities to a header and
+// returns its new hash.  The authorities are queried in parallel, and those that don't
+// reply within TimeAuthorityTimeout are skipped, but at least one must reply.
+func (h *Holochain) timestampHeader(hd *Header) (hash Hash, err error) {
+	nonce, err := hd.timestampNonce()
+	if err != nil {
+		return
+	}
+	authorities := h.nucleus.dna.TimeAuthorities
+	stamps := make([]*TimeStamp, len(authorities))
+	deadline := time.Now().Add(TimeAuthorityTimeout)
+	var wg sync.WaitGroup
+	for i := range authorities {
+		wg.Add(1)
+		go func(a *TimeAuthority, i int) {
+			defer wg.Done()
+			ts, e := a.stamp(nonce, deadline)
+			if e != nil {
+				Debugf("couldn't get timestamp from %s: %v", a.Name, e)
+				return
+			}
+			stamps[i] = &ts
+		}(&authorities[i], i)
+	}
+	wg.Wait()
+	hd.Timestamps = nil
+	for _, ts := range stamps {
+		if ts != nil {
+			hd.Timestamps = append(hd.Timestamps, *ts)
+		}
+	}
+	if len(hd.Timestamps) == 0 {
+		err = ErrNoTimeStamp
+		return
+	}
+	hash, _, err = hd.Sum(h.hashSpec)
+	return
+}
+
+// checkHeaderTimestamps verifies any timestamps attached to a header against the keys
+// of the DNA's time authorities and checks that the header's time is within their
+// radius, plus the allowed clock skew, of theirs
+func (h *Holochain) checkHeaderTimestamps(hd *Header) (err error) {
+	if len(hd.Timestamps) == 0 {
+		return
+	}
+	nonce, err := hd.timestampNonce()
+	if err != nil {
+		return
+	}
+	skew := h.clockSkew()
+	for i := range hd.Timestamps {
+		var key []byte
+		if key, err = h.nucleus.dna.timeAuthorityKey(hd.Timestamps[i].Authority); err != nil {
+			return
+		}
+		var mid time.Time
+		var radius time.Duration
+		mid, radius, err = hd.Timestamps[i].Verify(key, nonce)
+		if err != nil {
+			return
+		}
+		d := hd.Time.Sub(mid)
+		if d < 0 {
+			d = -d
+		}
+		if skew > 0 && d > radius+skew {
+			err = fmt.Errorf("%w: %v is %v from %s's %v", ErrTimeStampMismatch, hd.Time, d, hd.Timestamps[i].Authority, mid)
+			return
+		}
+	}
+	return
+}
+
+// headerTimestamp is a verified timestamp as passed to validation functions
+type headerTimestamp struct {
+	Authority string
+	PublicKey string
+	Time      string
+	// Radius is the authority's uncertainty about Time in microseconds
+	Radius int64
+}
+
+// headerTimestamps returns the header's timestamps that verify against the keys of the
+// DNA's time authorities, for validation functions
+func headerTimestamps(h *Holochain, hd *Header) (stamps []headerTimestamp) {
+	if h == nil || len(hd.Timestamps) == 0 {
+		return
+	}
+	nonce, err := hd.timestampNonce()
+	if err != nil {
+		return
+	}
+	for i := range hd.Timestamps {
+		ts := &hd.Timestamps[i]
+		key, err := h.nucleus.dna.timeAuthorityKey(ts.Authority)
+		if err != nil {
+			continue
+		}
+		mid, radius, err := ts.Verify(key, nonce)
+		if err != nil {
+			continue
+		}
+		stamps = append(stamps, headerTimestamp{
+			Authority: ts.Authority,
+			PublicKey: base64.StdEncoding.EncodeToString(ts.PublicKey),
+			Time:      mid.Format(time.RFC3339Nano),
+			Radius:    radius.Microseconds(),
+		})
+	}
+	return
+}
@@ -0,0 +1,219 @@
+package holochain
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+// testTimeAuthority is a roughtime server that replies to each request on its own
+type testTimeAuthority struct {
+	rootKey ed25519.PrivateKey
+	key     ed25519.PrivateKey
+	conn    net.PacketConn
+	// offset is added to the time the server gives
+	offset time.Duration
+}
+
+func newTestTimeAuthority() (ta *testTimeAuthority) {
+	ta = &testTimeAuthority{}
+	_, ta.rootKey, _ = ed25519.GenerateKey(rand.Reader)
+	_, ta.key, _ = ed25519.GenerateKey(rand.Reader)
+	ta.conn, _ = net.ListenPacket("udp", "127.0.0.1:0")
+	go func() {
+		buf := make([]byte, roughtimeRequestSize)
+		for {
+			n, addr, err := ta.conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, err := decodeRoughtimeMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			ta.conn.WriteTo(ta.reply(req[tagNONC], time.Now().Add(ta.offset)), addr)
+		}
+	}()
+	return
+}
+
+func (ta *testTimeAuthority) config() TimeAuthority {
+	return TimeAuthority{
+		Name:      "test",
+		Address:   ta.conn.LocalAddr().String(),
+		PublicKey: base64.StdEncoding.EncodeToString(ta.rootKey.Public().(ed25519.PublicKey)),
+	}
+}
+
+func le64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+func le32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+// reply makes the server's reply for a tree of just the one nonce
+func (ta *testTimeAuthority) reply(nonce []byte, now time.Time) []byte {
+	dele, _ := encodeRoughtimeMessage(map[uint32][]byte{
+		tagPUBK: ta.key.Public().(ed25519.PublicKey),
+		tagMINT: le64(0),
+		tagMAXT: le64(math.MaxUint64),
+	})
+	cert, _ := encodeRoughtimeMessage(map[uint32][]byte{
+		tagDELE: dele,
+		tagSIG:  ed25519.Sign(ta.rootKey, append(append([]byte{}, roughtimeDelegationContext...), dele...)),
+	})
+	root := sha512.Sum512(append([]byte{0}, nonce...))
+	srep, _ := encodeRoughtimeMessage(map[uint32][]byte{
+		tagROOT: root[:],
+		tagMIDP: le64(uint64(now.UnixMicro())),
+		tagRADI: le32(1000000),
+	})
+	reply, _ := encodeRoughtimeMessage(map[uint32][]byte{
+		tagSIG:  ed25519.Sign(ta.key, append(append([]byte{}, roughtimeResponseContext...), srep...)),
+		tagSREP: srep,
+		tagCERT: cert,
+		tagINDX: le32(0),
+		tagPATH: {},
+	})
+	return reply
+}
+
+func TestRoughtimeMessage(t *testing.T) {
+	Convey("roughtime messages should round trip", t, func() {
+		msg := map[uint32][]byte{tagNONC: make([]byte, 64), tagPAD: make([]byte, 8), tagINDX: le32(3)}
+		b, err := encodeRoughtimeMessage(msg)
+		So(err, ShouldBeNil)
+		m, err := decodeRoughtimeMessage(b)
+		So(err, ShouldBeNil)
+		So(m, ShouldResemble, msg)
+
+		req, err := roughtimeRequest(make([]byte, 64))
+		So(err, ShouldBeNil)
+		So(len(req), ShouldEqual, roughtimeRequestSize)
+	})
+	Convey("malformed roughtime messages should be rejected", t, func() {
+		_, err := decodeRoughtimeMessage([]byte{1, 2, 3})
+		So(errors.Is(err, ErrBadTimeStamp), ShouldBeTrue)
+		_, err = decodeRoughtimeMessage(le32(100))
+		So(errors.Is(err, ErrBadTimeStamp), ShouldBeTrue)
+		_, err = encodeRoughtimeMessage(map[uint32][]byte{tagNONC: {1}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestTimeStampVerify(t *testing.T) {
+	ta := newTestTimeAuthority()
+	defer ta.conn.Close()
+	nonce := make([]byte, 64)
+	nonce[0] = 1
+	now := time.Now()
+	key := ta.rootKey.Public().(ed25519.PublicKey)
+	ts := TimeStamp{Authority: "test", PublicKey: key, Reply: ta.reply(nonce, now)}
+
+	Convey("a timestamp should verify for its nonce", t, func() {
+		mid, radius, err := ts.Verify(key, nonce)
+		So(err, ShouldBeNil)
+		So(mid.Equal(time.UnixMicro(now.UnixMicro())), ShouldBeTrue)
+		So(radius, ShouldEqual, time.Second)
+	})
+	Convey("a timestamp shouldn't verify for another nonce or key", t, func() {
+		_, _, err := ts.Verify(key, make([]byte, 64))
+		So(errors.Is(err, ErrBadTimeStamp), ShouldBeTrue)
+		other := ta.key.Public().(ed25519.PublicKey)
+		bad := ts
+		bad.PublicKey = other
+		_, _, err = bad.Verify(other, nonce)
+		So(errors.Is(err, ErrBadTimeStamp), ShouldBeTrue)
+		_, _, err = ts.Verify(other, nonce)
+		So(errors.Is(err, ErrBadTimeStamp), ShouldBeTrue)
+	})
+	Convey("a timestamp should be got from a time authority", t, func() {
+		a := ta.config()
+		ts, err := a.stamp(nonce, time.Now().Add(TimeAuthorityTimeout))
+		So(err, ShouldBeNil)
+		So(ts.Authority, ShouldEqual, "test")
+	})
+	Convey("time authorities should be checked", t, func() {
+		So(validateTimeAuthorities([]TimeAuthority{ta.config()}), ShouldBeNil)
+		err := validateTimeAuthorities([]TimeAuthority{{Name: "x", Address: "localhost:2002", PublicKey: "AAAA"}})
+		So(errors.Is(err, ErrBadTimeAuthority), ShouldBeTrue)
+		err = validateTimeAuthorities([]TimeAuthority{ta.config(), ta.config()})
+		So(errors.Is(err, ErrBadTimeAuthority), ShouldBeTrue)
+	})
+}
+
+func TestHeaderTimestamps(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	ta := newTestTimeAuthority()
+	defer ta.conn.Close()
+
+	Convey("headers without timestamps should marshal as before", t, func() {
+		hd := h.chain.Headers[len(h.chain.Headers)-1]
+		b, err := hd.Marshal()
+		So(err, ShouldBeNil)
+		var hd2 Header
+		So(hd2.Unmarshal(b, 34), ShouldBeNil)
+		So(hd2.Timestamps, ShouldBeNil)
+	})
+
+	h.nucleus.dna.TimeAuthorities = []TimeAuthority{ta.config()}
+	Convey("commits should get timestamps from the time authorities", t, func() {
+		hash := commit(h, "oddNumbers", "3")
+		hd, err := h.chain.GetEntryHeader(hash)
+		So(err, ShouldBeNil)
+		So(len(hd.Timestamps), ShouldEqual, 1)
+		So(h.checkHeaderTimestamps(hd), ShouldBeNil)
+
+		b, err := hd.Marshal()
+		So(err, ShouldBeNil)
+		var hd2 Header
+		So(hd2.Unmarshal(b, 34), ShouldBeNil)
+		So(hd2.Timestamps, ShouldResemble, hd.Timestamps)
+
+		stamps := headerTimestamps(h, hd)
+		So(len(stamps), ShouldEqual, 1)
+		So(stamps[0].Authority, ShouldEqual, "test")
+		So(stamps[0].Radius, ShouldEqual, 1000000)
+	})
+	Convey("timestamps signed with keys the DNA doesn't trust should be rejected", t, func() {
+		forger := newTestTimeAuthority()
+		defer forger.conn.Close()
+		hash := commit(h, "oddNumbers", "9")
+		hd, _ := h.chain.GetEntryHeader(hash)
+		forged := *hd
+		nonce, _ := forged.timestampNonce()
+		forged.Timestamps = []TimeStamp{{Authority: "test", PublicKey: forger.rootKey.Public().(ed25519.PublicKey), Reply: forger.reply(nonce, time.Now())}}
+		So(errors.Is(h.checkHeaderTimestamps(&forged), ErrBadTimeStamp), ShouldBeTrue)
+		So(len(headerTimestamps(h, &forged)), ShouldEqual, 0)
+
+		forged.Timestamps[0].Authority = "forger"
+		So(errors.Is(h.checkHeaderTimestamps(&forged), ErrBadTimeStamp), ShouldBeTrue)
+	})
+	Convey("header times far from their timestamps should be rejected", t, func() {
+		ta.offset = time.Hour
+		_, err := NewCommitAction("oddNumbers", &GobEntry{C: "5"}).Do(h)
+		So(errors.Is(err, ErrTimeStampMismatch), ShouldBeTrue)
+		ta.offset = 0
+	})
+	Convey("commits should fail when no time authority replies", t, func() {
+		ta.conn.Close()
+		_, err := NewCommitAction("oddNumbers", &GobEntry{C: "7"}).Do(h)
+		So(err, ShouldEqual, ErrNoTimeStamp)
+	})
+	h.nucleus.dna.TimeAuthorities = nil
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// transcript implements debugging nondeterministic validation.  With ValidationDebug on,
+// a node keeps transcripts of the inputs and results of its recent validations, and
+// when a put it receives fails validation, it asks the author for the author's
+// transcript of validating the same entry and logs how the two differ.  Authors only
+// give their transcripts to nodes that hold the entry, and leave out anything that
+// isn't published: the content of entries that aren't public and the zome's config.
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"sync"
+	"time"
+)
+
+// MaxValidationTranscripts is how many of the most recent validation transcripts are kept
+const MaxValidationTranscripts = 256
+
+var ErrTranscriptRefused = errors.New("validation transcripts are only given to nodes holding the entry")
+
+// ValidationTranscript records what went into a validation and what came out of it
+type ValidationTranscript struct {
+	Hash       string // the entry's hash
+	Action     string
+	EntryType  string
+	Entry      string
+	HeaderTime time.Time
+	HeaderMeta map[string]string
+	Sources    []string
+	Properties map[string]string // the DNA's properties
+	ZomeConfig map[string]string // the validating zome's config on the validating node
+	// the chain in the validation package, where there is one
+	ChainLength int
+	ChainTop    string
+	Rate        *ChainRate
+	Time        time.Time // when the validation ran
+	Result      string    // the validation error, empty if it passed
+	// Redacted lists the fields left out of a transcript given to another node
+	Redacted []string `json:",omitempty"`
+}
+
+// ValidationTranscriptReq asks a node for its transcript of validating an entry
+type ValidationTranscriptReq struct {
+	H Hash
+}
+
+// transcriptLog keeps the most recent validation transcripts by entry hash
+type transcriptLog struct {
+	lk     sync.Mutex
+	order  []string
+	byHash map[string]*ValidationTranscript
+}
+
+func (l *transcriptLog) add(t *ValidationTranscript) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.byHash == nil {
+		l.byHash = make(map[string]*ValidationTranscript)
+	}
+	if _, ok := l.byHash[t.Hash]; !ok {
+		l.order = append(l.order, t.Hash)
+	}
+	l.byHash[t.Hash] = t
+	if len(l.order) > MaxValidationTranscripts {
+		delete(l.byHash, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+func (l *transcriptLog) get(hash string) (t *ValidationTranscript, ok bool) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	t, ok = l.byHash[hash]
+	return
+}
+
+// recordTranscript keeps the transcript of validating an action's entry
+func (h *Holochain) recordTranscript(a ValidatingAction, entryType string, zome string, vpkg *ValidationPackage, sources []peer.ID, start time.Time, verr error) {
+	hd := validatedHeader(a)
+	e := validatedEntry(a)
+	if hd == nil || e == nil {
+		return
+	}
+	t := ValidationTranscript{
+		Hash:       hd.EntryLink.String(),
+		Action:     a.Name(),
+		EntryType:  entryType,
+		HeaderTime: hd.Time,
+		HeaderMeta: hd.Meta,
+		Sources:    prepareSources(sources),
+		Properties: h.nucleus.dna.Properties,
+		ZomeConfig: h.config.ZomeConfig[zome],
+		Time:       start,
+	}
+	t.Entry, _ = entryContentString(e.Content())
+	if vpkg != nil {
+		t.Rate = vpkg.Rate
+		if vpkg.Chain != nil {
+			t.ChainLength = len(vpkg.Chain.Headers)
+			if top := vpkg.Chain.Top(); top != nil {
+				t.ChainTop = top.EntryLink.String()
+			}
+		}
+	}
+	if verr != nil {
+		t.Result = verr.Error()
+	}
+	h.transcripts.add(&t)
+}
+
+// ValidationTranscript returns our transcript of validating the entry with the hash
+func (h *Holochain) ValidationTranscript(hash Hash) (t *ValidationTranscript, err error) {
+	t, ok := h.transcripts.get(hash.String())
+	if !ok {
+		err = ErrHashNotFound
+	}
+	return
+}
+
+// transcriptFor returns our transcript of validating the entry with the hash for the
+// node from, which must hold the entry, redacted of what isn't published
+func (h *Holochain) transcriptFor(from peer.ID, hash Hash) (t ValidationTranscript, err error) {
+	// without sharding every node holds every entry
+	if h.dht.resilienceFactor() > 0 && !h.dht.isHolder(hash, from) {
+		err = ErrTranscriptRefused
+		return
+	}
+	var tr *ValidationTranscript
+	if tr, err = h.ValidationTranscript(hash); err != nil {
+		return
+	}
+	t = *tr
+	t.ZomeConfig = nil
+	t.Redacted = []string{"ZomeConfig"}
+	if _, d, e := h.GetEntryDef(t.EntryType); e != nil || d.Sharing != Public {
+		t.Entry = ""
+		t.Redacted = append(t.Redacted, "Entry")
+	}
+	return
+}
+
+// diffTranscripts lists the differences between the author's transcript of a
+// validation and ours, which are the likely sources of the validations disagreeing
+func diffTranscripts(author *ValidationTranscript, local *ValidationTranscript) (diffs []string) {
+	str := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	fields := []struct {
+		name          string
+		author, local interface{}
+	}{
+		{"Result", author.Result, local.Result},
+		{"EntryType", author.EntryType, local.EntryType},
+		{"Entry", author.Entry, local.Entry},
+		{"HeaderTime", author.HeaderTime.UTC(), local.HeaderTime.UTC()},
+		{"HeaderMeta", author.HeaderMeta, local.HeaderMeta},
+		{"Sources", author.Sources, local.Sources},
+		{"Properties", author.Properties, local.Properties},
+		{"ZomeConfig", author.ZomeConfig, local.ZomeConfig},
+		{"ChainLength", author.ChainLength, local.ChainLength},
+		{"ChainTop", author.ChainTop, local.ChainTop},
+		{"Rate", author.Rate, local.Rate},
+	}
+	redacted := make(map[string]bool)
+	for _, name := range author.Redacted {
+		redacted[name] = true
+	}
+	for _, f := range fields {
+		if redacted[f.name] {
+			continue
+		}
+		a, l := str(f.author), str(f.local)
+		if a != l {
+			diffs = append(diffs, fmt.Sprintf("%s: author %s, local %s", f.name, a, l))
+		}
+	}
+	// validations never run at the same moment, so rules that look at the current time
+	// can pass for one and fail for the other
+	if d := local.Time.Sub(author.Time); d != 0 {
+		diffs = append(diffs, fmt.Sprintf("Time: validated %v after the author", d))
+	}
+	return
+}
+
+// debugValidation fetches the author's transcript of validating an entry that failed
+// our validation and logs how it differs from ours
+func (h *Holochain) debugValidation(author peer.ID, hash Hash) (diffs []string, err error) {
+	local, err := h.ValidationTranscript(hash)
+	if err != nil {
+		return
+	}
+	r, err := h.Send(ValidateProtocol, author, VALIDATE_TRANSCRIPT_REQUEST, ValidationTranscriptReq{H: hash})
+	if err != nil {
+		return
+	}
+	t, ok := r.(ValidationTranscript)
+	if !ok {
+		err = fmt.Errorf("expected ValidationTranscript got %T", r)
+		return
+	}
+	diffs = h.logTranscriptDiffs(author, &t, local)
+	return
+}
+
+// logTranscriptDiffs logs how our transcript of a failed validation differs from its
+// author's
+func (h *Holochain) logTranscriptDiffs(author peer.ID, theirs *ValidationTranscript, ours *ValidationTranscript) (diffs []string) {
+	diffs = diffTranscripts(theirs, ours)
+	log := &h.config.Loggers.App
+	log.Logf("validation of %s from %v failed: %s; differences from the author's validation:", ours.Hash, peer.IDB58Encode(author), ours.Result)
+	for _, d := range diffs {
+		log.Logf("  %s", d)
+	}
+	return
+}
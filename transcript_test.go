@@ -0,0 +1,137 @@
+package holochain
+
+import (
+	"bytes"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestTranscriptLog(t *testing.T) {
+	Convey("the log should keep the most recent transcripts", t, func() {
+		var l transcriptLog
+		for i := 0; i < MaxValidationTranscripts+1; i++ {
+			l.add(&ValidationTranscript{Hash: string(rune('a' + i))})
+		}
+		_, ok := l.get("a")
+		So(ok, ShouldBeFalse)
+		_, ok = l.get("b")
+		So(ok, ShouldBeTrue)
+		So(len(l.order), ShouldEqual, MaxValidationTranscripts)
+	})
+}
+
+func TestDiffTranscripts(t *testing.T) {
+	now := time.Now()
+	author := ValidationTranscript{Entry: "3", Properties: map[string]string{"a": "1"}, ChainLength: 4, Time: now}
+	Convey("identical transcripts should only differ in time", t, func() {
+		local := author
+		So(diffTranscripts(&author, &local), ShouldBeNil)
+		local.Time = now.Add(time.Minute)
+		So(diffTranscripts(&author, &local), ShouldResemble, []string{"Time: validated 1m0s after the author"})
+	})
+	Convey("differences in the inputs and result should be listed", t, func() {
+		local := author
+		local.Properties = map[string]string{"a": "2"}
+		local.ChainLength = 3
+		local.Result = "Validation Failed"
+		So(diffTranscripts(&author, &local), ShouldResemble, []string{
+			`Result: author "", local "Validation Failed"`,
+			`Properties: author {"a":"1"}, local {"a":"2"}`,
+			`ChainLength: author 4, local 3`,
+		})
+	})
+}
+
+func TestValidationTranscripts(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("transcripts should only be kept in debug mode", t, func() {
+		hash := commit(h, "oddNumbers", "3")
+		_, err := h.ValidationTranscript(hash)
+		So(err, ShouldEqual, ErrHashNotFound)
+	})
+
+	h.config.ValidationDebug = true
+	defer func() { h.config.ValidationDebug = false }()
+
+	Convey("validations should keep transcripts in debug mode", t, func() {
+		hash := commit(h, "oddNumbers", "5")
+		tr, err := h.ValidationTranscript(hash)
+		So(err, ShouldBeNil)
+		So(tr.Action, ShouldEqual, "commit")
+		So(tr.EntryType, ShouldEqual, "oddNumbers")
+		So(tr.Entry, ShouldEqual, "5")
+		So(tr.Result, ShouldEqual, "")
+		So(tr.Sources, ShouldResemble, []string{peer.IDB58Encode(h.nodeID)})
+	})
+
+	Convey("a transcript should be fetched from its author", t, func() {
+		hash := commit(h, "oddNumbers", "7")
+		r, err := ValidateReceiver(h, h.node.NewMessage(VALIDATE_TRANSCRIPT_REQUEST, ValidationTranscriptReq{H: hash}))
+		So(err, ShouldBeNil)
+		So(r.(ValidationTranscript).Entry, ShouldEqual, "7")
+		_, err = ValidateReceiver(h, h.node.NewMessage(VALIDATE_TRANSCRIPT_REQUEST, ValidationTranscriptReq{H: NullHash()}))
+		So(err, ShouldEqual, ErrHashNotFound)
+	})
+
+	Convey("a transcript should be given without what isn't published", t, func() {
+		h.config.ZomeConfig = map[string]map[string]string{"jsSampleZome": {"limit": "5"}}
+		defer func() { h.config.ZomeConfig = nil }()
+		hash := commit(h, "secret", "shh")
+		tr, err := h.ValidationTranscript(hash)
+		So(err, ShouldBeNil)
+		So(tr.Entry, ShouldEqual, "shh")
+		r, err := ValidateReceiver(h, h.node.NewMessage(VALIDATE_TRANSCRIPT_REQUEST, ValidationTranscriptReq{H: hash}))
+		So(err, ShouldBeNil)
+		given := r.(ValidationTranscript)
+		So(given.Entry, ShouldEqual, "")
+		So(given.ZomeConfig, ShouldBeNil)
+		So(given.Redacted, ShouldResemble, []string{"ZomeConfig", "Entry"})
+		So(diffTranscripts(&given, tr), ShouldBeNil)
+	})
+
+	Convey("a transcript should only be given to nodes holding the entry", t, func() {
+		hash := commit(h, "oddNumbers", "11")
+		others := []peer.ID{}
+		for _, s := range []string{"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2", "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3"} {
+			id, _ := peer.IDB58Decode(s)
+			So(h.dht.UpdateGossiper(id, 0), ShouldBeNil)
+			others = append(others, id)
+		}
+		h.nucleus.dna.DHTConfig.ResilienceFactor = 1
+		defer func() { h.nucleus.dna.DHTConfig.ResilienceFactor = 0 }()
+		refused := 0
+		for _, id := range append(others, h.nodeID) {
+			if _, err := h.transcriptFor(id, hash); err == ErrTranscriptRefused {
+				refused++
+			}
+		}
+		So(refused, ShouldEqual, 2)
+	})
+
+	Convey("a failed validation should be compared with the author's", t, func() {
+		var buf bytes.Buffer
+		h.config.Loggers.App.Format = ""
+		h.config.Loggers.App.Enabled = true
+		h.config.Loggers.App.New(&buf)
+		hash := commit(h, "oddNumbers", "9")
+
+		// the author here is ourself, so its transcript is the same as ours
+		diffs, err := h.debugValidation(h.nodeID, hash)
+		So(err, ShouldBeNil)
+		So(diffs, ShouldBeNil)
+
+		author, _ := h.ValidationTranscript(hash)
+		local := *author
+		local.Result = "Validation Failed"
+		local.ZomeConfig = map[string]string{"limit": "5"}
+		buf.Reset()
+		diffs = h.logTranscriptDiffs(h.nodeID, author, &local)
+		So(diffs, ShouldResemble, []string{`Result: author "", local "Validation Failed"`, `ZomeConfig: author null, local {"limit":"5"}`})
+		So(buf.String(), ShouldContainSubstring, "failed: Validation Failed")
+		So(buf.String(), ShouldContainSubstring, `ZomeConfig: author null`)
+	})
+}
@@ -0,0 +1,388 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements the admin api and the built-in admin UI that uses it
+
+package ui
+
+import (
+	"crypto/subtle"
+	websocket "github.com/gorilla/websocket"
+	holo "github.com/metacurrency/holochain"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminUpgrader upgrades the admin api's websockets only for pages the web server
+// served itself, so other sites open in the operator's browser can't connect to them
+var adminUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     sameOrigin,
+}
+
+// ChainItem is a header of the local chain, with its entry, as returned by the admin api
+type ChainItem struct {
+	Index     int
+	Hash      string
+	Type      string
+	Time      time.Time
+	EntryLink string
+	Entry     interface{}
+}
+
+// DHTStats summarizes the state of the DHT as returned by the admin api
+type DHTStats struct {
+	Puts      int // number of puts this node has received
+	Gossipers int // number of peers this node has gossiped with
+	// use of the cache of decoded entries
+	EntryCache holo.CacheStats
+	// use of the cache of the source chain's decoded entries
+	ChainEntryCache holo.CacheStats
+}
+
+// LogFilter selects the log records streamed to an admin client
+type LogFilter struct {
+	Level      string   // least severe level to send, "" for all
+	Subsystems []string // subsystems to send records from, none for all
+	Tail       int      // number of recent records to send before streaming new ones
+}
+
+func (f *LogFilter) match(rec holo.LogRecord) bool {
+	if !holo.LogLevelAtLeast(rec.Level, f.Level) {
+		return false
+	}
+	if len(f.Subsystems) == 0 {
+		return true
+	}
+	for _, s := range f.Subsystems {
+		if s == rec.Subsystem {
+			return true
+		}
+	}
+	return false
+}
+
+// AppUsage is the resources used by the app served, as returned by the admin api
+type AppUsage struct {
+	Name string
+	DNA  string
+	holo.Usage
+}
+
+// adminAllowed reports whether r may use the admin api, which only answers the
+// local host unless AdminAllowRemote is set
+func (ws *WebServer) adminAllowed(r *http.Request) bool {
+	if ws.AdminAllowRemote {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// sameOrigin reports whether r comes from a page of the host it was sent to, or from
+// something other than a browser, which sends no Origin
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// adminAuthorized reports whether r carries the AdminToken as a bearer token, which
+// it need not if no token is set
+func (ws *WebServer) adminAuthorized(r *http.Request) bool {
+	if ws.AdminToken == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(ws.AdminToken)) == 1
+}
+
+// admin wraps the handler of an admin route so it is refused to hosts that aren't allowed
+func (ws *WebServer) admin(next http.HandlerFunc) http.Handler {
+	return ws.compress("/admin/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ws.adminAllowed(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}))
+}
+
+// adminAPI wraps the handler of an admin api route so it also requires the admin token
+func (ws *WebServer) adminAPI(next http.HandlerFunc) http.Handler {
+	return ws.admin(func(w http.ResponseWriter, r *http.Request) {
+		if !ws.adminAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// handleAdmin sets up the routes of the admin api and UI
+func (ws *WebServer) handleAdmin() {
+	http.Handle("/admin/ui/", ws.admin(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(adminHTML))
+	}))
+
+	// /admin/api/chain returns the local chain, most recent first
+	http.Handle("/admin/api/chain", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		chain := ws.h.Chain()
+		items := make([]ChainItem, 0)
+		i := chain.Length()
+		err := chain.Walk(func(key *holo.Hash, header *holo.Header, entry holo.Entry) (err error) {
+			i--
+			item := ChainItem{Index: i, Hash: key.String(), Type: header.Type, Time: header.Time, EntryLink: header.EntryLink.String()}
+			// the DNA is too big to be worth showing
+			if header.Type != holo.DNAEntryType {
+				item.Entry = entry.Content()
+			}
+			items = append(items, item)
+			return
+		})
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		ws.writeJSON(w, items)
+	}))
+
+	http.Handle("/admin/api/dht", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		var stats DHTStats
+		var err error
+		stats.Puts, err = ws.h.DHT().GetIdx()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		peers, err := ws.h.DHT().Stats()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		stats.Gossipers = len(peers)
+		stats.EntryCache = ws.h.DHT().EntryCacheStats()
+		stats.ChainEntryCache = ws.h.Chain().EntryCacheStats()
+		ws.writeJSON(w, stats)
+	}))
+
+	http.Handle("/admin/api/peers", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		peers, err := ws.h.DHT().Stats()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		ws.writeJSON(w, peers)
+	}))
+
+	http.Handle("/admin/api/usage", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		ws.writeJSON(w, AppUsage{Name: ws.h.Nucleus().DNA().Name, DNA: ws.h.DNAHash().String(), Usage: ws.h.Usage()})
+	}))
+
+	// /admin/api/fork reports any peers found running a different DNA of the app
+	http.Handle("/admin/api/fork", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		ws.writeJSON(w, ws.h.ForkStatus())
+	}))
+
+	// /admin/api/export downloads the agent's entries as a zip archive
+	http.Handle("/admin/api/export", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+ws.h.Nucleus().DNA().Name+`-export.zip"`)
+		if err := ws.h.ExportData(w); err != nil {
+			ws.errs.Log(err)
+		}
+	}))
+
+	// /admin/api/audit exports the audit log, one JSON record per line, oldest first
+	http.Handle("/admin/api/audit", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		l, ok := ws.h.Auditor().(*holo.AuditLog)
+		if !ok {
+			http.Error(w, "audit log not kept", 404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if err := l.Export(w); err != nil {
+			ws.errs.Log(err)
+		}
+	}))
+
+	// /admin/api/integrity returns the report of the startup integrity checks, which are
+	// run again on a POST
+	http.Handle("/admin/api/integrity", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		report := ws.h.Integrity()
+		if r.Method == "POST" || report == nil {
+			r := ws.h.CheckIntegrity()
+			report = &r
+		}
+		ws.writeJSON(w, report)
+	}))
+
+	// /admin/api/logs returns the recent log lines, limited by the n parameter
+	http.Handle("/admin/api/logs", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		n := 0
+		if s := r.URL.Query().Get("n"); s != "" {
+			var err error
+			n, err = strconv.Atoi(s)
+			if err != nil {
+				http.Error(w, "bad n: "+s, 400)
+				return
+			}
+		}
+		records := make([]holo.LogRecord, 0)
+		if ws.h.Logs() != nil {
+			records = append(records, ws.h.Logs().Recent(n)...)
+		}
+		ws.writeJSON(w, records)
+	}))
+
+	// /admin/api/dht/hashes lists the hashes held, filtered by the type and author parameters
+	http.Handle("/admin/api/dht/hashes", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		hashes, err := ws.h.DHT().HeldHashes(q.Get("type"), q.Get("author"))
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		ws.writeJSON(w, hashes)
+	}))
+
+	// /admin/api/dht/entry/<hash> returns the entry of a hash with its status, sources,
+	// status history and links
+	http.Handle("/admin/api/dht/entry/", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		hash, err := holo.NewHash(strings.TrimPrefix(r.URL.Path, "/admin/api/dht/entry/"))
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		record, err := ws.h.DHT().Record(hash)
+		if err == holo.ErrHashNotFound {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		ws.writeJSON(w, record)
+	}))
+
+	// /admin/api/pins lists the hashes pinned on this node
+	http.Handle("/admin/api/pins", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		pins, err := ws.h.DHT().Pins()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		ws.writeJSON(w, pins)
+	}))
+
+	// /admin/api/metrics returns the recorded snapshots of the DHT's metrics, oldest
+	// first, limited to those since the RFC 3339 time in the since parameter
+	http.Handle("/admin/api/metrics", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				http.Error(w, "bad since: "+s, 400)
+				return
+			}
+		}
+		history, err := ws.h.DHT().MetricsHistory(since)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		ws.writeJSON(w, history)
+	}))
+
+	// /admin/logs streams log records over a websocket, starting once the client has
+	// sent a LogFilter, which it can replace by sending another at any time
+	http.Handle("/admin/logs", ws.adminAPI(func(w http.ResponseWriter, r *http.Request) {
+		logs := ws.h.Logs()
+		if logs == nil {
+			http.Error(w, "logs not recorded", 500)
+			return
+		}
+		conn, err := adminUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			ws.errs.Log(err)
+			return
+		}
+		defer conn.Close()
+
+		var filter LogFilter
+		if err = conn.ReadJSON(&filter); err != nil {
+			return
+		}
+		records := logs.Subscribe()
+		defer logs.Unsubscribe(records)
+
+		filters := make(chan LogFilter)
+		quit := make(chan struct{})
+		defer close(quit)
+		go func() {
+			defer close(filters)
+			for {
+				var f LogFilter
+				if e := conn.ReadJSON(&f); e != nil {
+					return
+				}
+				select {
+				case filters <- f:
+				case <-quit:
+					return
+				}
+			}
+		}()
+
+		var tail []holo.LogRecord
+		for _, rec := range logs.Recent(0) {
+			if filter.match(rec) {
+				tail = append(tail, rec)
+			}
+		}
+		if filter.Tail < 0 {
+			filter.Tail = 0
+		}
+		if len(tail) > filter.Tail {
+			tail = tail[len(tail)-filter.Tail:]
+		}
+		for _, rec := range tail {
+			if err = conn.WriteJSON(rec); err != nil {
+				return
+			}
+		}
+
+		for {
+			select {
+			case rec := <-records:
+				if filter.match(rec) {
+					if err = conn.WriteJSON(rec); err != nil {
+						return
+					}
+				}
+			case f, ok := <-filters:
+				if !ok {
+					// the client has gone
+					return
+				}
+				filter = f
+			}
+		}
+	}))
+}
@@ -0,0 +1,72 @@
+package ui
+
+import (
+	holo "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAllowed(t *testing.T) {
+	ws := &WebServer{}
+	Convey("it should only allow the local host by default", t, func() {
+		r := httptest.NewRequest("GET", "/admin/api/chain", nil)
+		So(ws.adminAllowed(r), ShouldBeFalse)
+		r.RemoteAddr = "127.0.0.1:5555"
+		So(ws.adminAllowed(r), ShouldBeTrue)
+		r.RemoteAddr = "[::1]:5555"
+		So(ws.adminAllowed(r), ShouldBeTrue)
+	})
+	Convey("it should allow remote hosts when configured to", t, func() {
+		ws.AdminAllowRemote = true
+		r := httptest.NewRequest("GET", "/admin/api/chain", nil)
+		So(ws.adminAllowed(r), ShouldBeTrue)
+	})
+}
+
+func TestSameOrigin(t *testing.T) {
+	Convey("it should only accept pages of the host the request was sent to", t, func() {
+		r := httptest.NewRequest("GET", "http://127.0.0.1:31415/admin/logs", nil)
+		So(sameOrigin(r), ShouldBeTrue)
+		r.Header.Set("Origin", "http://127.0.0.1:31415")
+		So(sameOrigin(r), ShouldBeTrue)
+		r.Header.Set("Origin", "https://example.com")
+		So(sameOrigin(r), ShouldBeFalse)
+		r.Header.Set("Origin", "http://127.0.0.1:8080")
+		So(sameOrigin(r), ShouldBeFalse)
+	})
+}
+
+func TestAdminAuthorized(t *testing.T) {
+	ws := &WebServer{}
+	Convey("it should need no token if none is set", t, func() {
+		r := httptest.NewRequest("GET", "/admin/api/dht/hashes", nil)
+		So(ws.adminAuthorized(r), ShouldBeTrue)
+	})
+	Convey("it should require the token when set", t, func() {
+		ws.AdminToken = "secret"
+		r := httptest.NewRequest("GET", "/admin/api/dht/hashes", nil)
+		So(ws.adminAuthorized(r), ShouldBeFalse)
+		r.Header.Set("Authorization", "Bearer wrong")
+		So(ws.adminAuthorized(r), ShouldBeFalse)
+		r.Header.Set("Authorization", "secret")
+		So(ws.adminAuthorized(r), ShouldBeFalse)
+		r.Header.Set("Authorization", "Bearer secret")
+		So(ws.adminAuthorized(r), ShouldBeTrue)
+	})
+}
+
+func TestLogFilter(t *testing.T) {
+	Convey("it should match records by level and subsystem", t, func() {
+		rec := holo.LogRecord{Subsystem: "dht", Level: holo.LogLevelInfo, Message: "x"}
+		f := LogFilter{}
+		So(f.match(rec), ShouldBeTrue)
+		f.Level = holo.LogLevelWarn
+		So(f.match(rec), ShouldBeFalse)
+		f.Level = holo.LogLevelDebug
+		f.Subsystems = []string{"app"}
+		So(f.match(rec), ShouldBeFalse)
+		f.Subsystems = []string{"app", "dht"}
+		So(f.match(rec), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// the built-in admin UI, a single page that renders the admin api
+
+package ui
+
+const adminHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Holochain Admin</title>
+<style>
+body { font-family: sans-serif; margin: 0; }
+nav { background: #333; padding: 0.5em; }
+nav a { color: #eee; margin-right: 1em; cursor: pointer; text-decoration: none; }
+nav a.active { color: #fff; font-weight: bold; }
+main { padding: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em; text-align: left; vertical-align: top; font-size: 0.9em; }
+td.entry { font-family: monospace; white-space: pre-wrap; word-break: break-all; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<nav>
+<a data-view="chain">Chain</a>
+<a data-view="dht">DHT</a>
+<a data-view="explore">Explore</a>
+<a data-view="peers">Peers</a>
+<a data-view="usage">Usage</a>
+<a data-view="logs">Logs</a>
+</nav>
+<main id="view"></main>
+<script>
+(function() {
+  var view = document.getElementById("view");
+  var timer = null;
+
+  function esc(s) {
+    return String(s).replace(/[&<>"]/g, function(c) {
+      return {"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c];
+    });
+  }
+
+  function table(cols, rows) {
+    var html = "<table><tr>";
+    cols.forEach(function(c) { html += "<th>" + esc(c.title) + "</th>"; });
+    html += "</tr>";
+    rows.forEach(function(r) {
+      html += "<tr>";
+      cols.forEach(function(c) {
+        var v = c.get(r);
+        html += "<td" + (c.cls ? " class=\"" + c.cls + "\"" : "") + ">" + esc(v === undefined || v === null ? "" : v) + "</td>";
+      });
+      html += "</tr>";
+    });
+    return html + "</table>";
+  }
+
+  function get(path, render, target) {
+    target = target || view;
+    var req = new XMLHttpRequest();
+    req.open("GET", "/admin/api/" + path);
+    var token = sessionStorage.getItem("adminToken");
+    if (token) {
+      req.setRequestHeader("Authorization", "Bearer " + token);
+    }
+    req.onload = function() {
+      if (req.status == 401) {
+        token = prompt("Admin token");
+        if (token) {
+          sessionStorage.setItem("adminToken", token);
+          get(path, render, target);
+        }
+        return;
+      }
+      if (req.status != 200) {
+        target.innerHTML = "<p class=\"error\">" + esc(req.responseText) + "</p>";
+        return;
+      }
+      target.innerHTML = render(JSON.parse(req.responseText));
+    };
+    req.send();
+  }
+
+  var views = {
+    chain: function() {
+      get("chain", function(items) {
+        return table([
+          {title: "#", get: function(i) { return i.Index; }},
+          {title: "Type", get: function(i) { return i.Type; }},
+          {title: "Time", get: function(i) { return i.Time; }},
+          {title: "Hash", get: function(i) { return i.Hash; }},
+          {title: "Entry", cls: "entry", get: function(i) { return typeof i.Entry == "string" ? i.Entry : JSON.stringify(i.Entry); }}
+        ], items);
+      });
+    },
+    dht: function() {
+      get("dht", function(s) {
+        return table([
+          {title: "Puts held", get: function(s) { return s.Puts; }},
+          {title: "Gossip peers", get: function(s) { return s.Gossipers; }},
+          {title: "Cached entries", get: function(s) { return s.EntryCache.Entries + "/" + s.EntryCache.Capacity; }},
+          {title: "Cache hits", get: function(s) { return s.EntryCache.Hits; }},
+          {title: "Cache misses", get: function(s) { return s.EntryCache.Misses; }}
+        ], [s]);
+      });
+    },
+    explore: function() {
+      var form = document.getElementById("explore");
+      if (!form) {
+        view.innerHTML = "<form id=\"explore\">Type <input name=\"type\"> Author <input name=\"author\"> <button>Search</button></form><div id=\"results\"></div>";
+        form = document.getElementById("explore");
+        form.onsubmit = function() { views.explore(); return false; };
+      }
+      var results = document.getElementById("results");
+      var q = "type=" + encodeURIComponent(form.type.value) + "&author=" + encodeURIComponent(form.author.value);
+      // render into the results rather than the whole view so the form is kept
+      get("dht/hashes?" + q, function(hashes) {
+        var html = "<ul>";
+        hashes.forEach(function(h) { html += "<li><a href=\"#\" data-hash=\"" + esc(h) + "\">" + esc(h) + "</a></li>"; });
+        return html + "</ul>";
+      }, results);
+    },
+    record: function(hash) {
+      get("dht/entry/" + hash, function(r) {
+        var html = table([
+          {title: "Hash", get: function(r) { return r.Hash; }},
+          {title: "Type", get: function(r) { return r.EntryType; }},
+          {title: "Status", get: function(r) { return r.Status; }},
+          {title: "Sources", get: function(r) { return (r.Sources || []).join(", "); }},
+          {title: "Replaced by", get: function(r) { return r.ReplacedBy; }},
+          {title: "Entry", cls: "entry", get: function(r) { return r.Entry; }}
+        ], [r]);
+        html += "<h4>Links</h4>" + table([
+          {title: "Tag", get: function(l) { return l.Tag; }},
+          {title: "Link", get: function(l) { return l.Link; }},
+          {title: "Status", get: function(l) { return l.Status; }}
+        ], r.Links);
+        html += "<h4>History</h4>" + table([
+          {title: "Time", get: function(s) { return s.Time; }},
+          {title: "Status", get: function(s) { return s.Status; }}
+        ], r.History || []);
+        return html;
+      }, document.getElementById("results"));
+    },
+    peers: function() {
+      get("peers", function(peers) {
+        return table([
+          {title: "Peer", get: function(p) { return p.Peer; }},
+          {title: "Exchanges", get: function(p) { return p.Exchanges; }},
+          {title: "Puts received", get: function(p) { return p.PutsReceived; }},
+          {title: "Puts sent", get: function(p) { return p.PutsSent; }},
+          {title: "Failures", get: function(p) { return p.Failures; }},
+          {title: "Last success", get: function(p) { return p.LastSuccess; }},
+          {title: "Last failure", get: function(p) { return p.LastFailure; }}
+        ], peers);
+      });
+    },
+    usage: function() {
+      get("usage", function(u) {
+        return table([
+          {title: "App", get: function(u) { return u.Name; }},
+          {title: "VM time (ms)", get: function(u) { return Math.round(u.VMTime / 1e6); }},
+          {title: "VM executions", get: function(u) { return u.VMExecutions; }},
+          {title: "DHT bytes", get: function(u) { return u.DHTBytes; }},
+          {title: "Bytes sent", get: function(u) { return u.BytesSent; }},
+          {title: "Bytes received", get: function(u) { return u.BytesReceived; }}
+        ], [u]);
+      });
+    },
+    logs: function() {
+      get("logs?n=500", function(records) {
+        return table([
+          {title: "Time", get: function(r) { return r.Time; }},
+          {title: "Subsystem", get: function(r) { return r.Subsystem; }},
+          {title: "Message", cls: "entry", get: function(r) { return r.Message; }}
+        ], records.reverse());
+      });
+    }
+  };
+
+  function show(name) {
+    clearInterval(timer);
+    Array.prototype.forEach.call(document.querySelectorAll("nav a"), function(a) {
+      a.className = a.getAttribute("data-view") == name ? "active" : "";
+    });
+    views[name]();
+    // the explorer is only refreshed by searching so results being read aren't replaced
+    if (name != "explore") {
+      timer = setInterval(views[name], 5000);
+    }
+  }
+
+  view.addEventListener("click", function(e) {
+    var hash = e.target.getAttribute("data-hash");
+    if (hash) {
+      e.preventDefault();
+      views.record(hash);
+    }
+  });
+
+  Array.prototype.forEach.call(document.querySelectorAll("nav a"), function(a) {
+    a.onclick = function() { show(a.getAttribute("data-view")); };
+  });
+  show("chain");
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,242 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements capability tokens, which /auth issues signed by the agent's key and bound
+// to the zome functions they may call, and without which requests are refused when
+// CapabilityTokens is set, along with the checks every request and zome call go through
+
+package ui
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	holo "github.com/metacurrency/holochain"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	CapabilityHeader    = "X-Capability-Token"
+	DefaultTokenTimeout = time.Hour
+)
+
+var ErrBadCapabilityToken = errors.New("missing, bad or expired capability token")
+var ErrCapabilityScope = errors.New("capability token doesn't permit the call")
+
+// TokenRequest is what a client posts to /auth, the functions being of the form
+// zome/function
+type TokenRequest struct {
+	Functions []string
+}
+
+// CapabilityToken is what /auth returns
+type CapabilityToken struct {
+	Token     string
+	Functions []string
+	Expires   time.Time
+}
+
+// capClaims are what a capability token is signed over
+type capClaims struct {
+	Functions []string
+	Expires   time.Time
+	Nonce     []byte
+}
+
+func (ws *WebServer) tokenTimeout() time.Duration {
+	if ws.TokenTimeout > 0 {
+		return ws.TokenTimeout
+	}
+	return DefaultTokenTimeout
+}
+
+// issueToken returns a capability token for the functions
+func (ws *WebServer) issueToken(functions []string) (token CapabilityToken, err error) {
+	claims := capClaims{Functions: functions, Expires: time.Now().Add(ws.tokenTimeout()).UTC(), Nonce: make([]byte, 16)}
+	if _, err = rand.Read(claims.Nonce); err != nil {
+		return
+	}
+	var b, sig []byte
+	if b, err = json.Marshal(claims); err != nil {
+		return
+	}
+	if sig, err = ws.h.Agent().PrivKey().Sign(b); err != nil {
+		return
+	}
+	token = CapabilityToken{
+		Token:     base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(sig),
+		Functions: functions,
+		Expires:   claims.Expires,
+	}
+	return
+}
+
+// checkToken returns the claims of a capability token if it was signed by the agent's
+// key and hasn't expired
+func (ws *WebServer) checkToken(token string) (claims *capClaims, err error) {
+	err = ErrBadCapabilityToken
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return
+	}
+	b, e := base64.RawURLEncoding.DecodeString(parts[0])
+	if e != nil {
+		return
+	}
+	sig, e := base64.RawURLEncoding.DecodeString(parts[1])
+	if e != nil {
+		return
+	}
+	if ok, e := ws.h.Agent().PubKey().Verify(b, sig); e != nil || !ok {
+		return
+	}
+	var c capClaims
+	if e = json.Unmarshal(b, &c); e != nil || time.Now().After(c.Expires) {
+		return
+	}
+	claims, err = &c, nil
+	return
+}
+
+// allows returns nil if the token's claims permit calling the zome function
+func (c *capClaims) allows(zome string, function string) (err error) {
+	fn := zome + "/" + function
+	for _, f := range c.Functions {
+		if f == fn {
+			return
+		}
+	}
+	err = ErrCapabilityScope
+	return
+}
+
+// capability returns the claims of the request's capability token, given in the
+// X-Capability-Token header or, for websockets, the cap parameter, or nil if tokens
+// aren't required, along with the status code to fail the request with if its token
+// isn't valid
+func (ws *WebServer) capability(r *http.Request) (claims *capClaims, code int, err error) {
+	token := r.Header.Get(CapabilityHeader)
+	if token == "" {
+		token = r.URL.Query().Get("cap")
+	}
+	claims, code, err = ws.requireToken(token)
+	return
+}
+
+// requireToken returns the claims of a capability token, or nil if tokens aren't
+// required
+func (ws *WebServer) requireToken(token string) (claims *capClaims, code int, err error) {
+	if !ws.CapabilityTokens {
+		return
+	}
+	if claims, err = ws.checkToken(token); err != nil {
+		code = http.StatusUnauthorized
+	}
+	return
+}
+
+// authorizeCapability checks that claims, as returned by capability, permit calling
+// the zome function
+func (ws *WebServer) authorizeCapability(claims *capClaims, zome string, function string) (code int, err error) {
+	if claims == nil {
+		return
+	}
+	if err = claims.allows(zome, function); err != nil {
+		code = http.StatusForbidden
+	}
+	return
+}
+
+// caller is who a request or relayed call comes from, as far as the web server knows
+type caller struct {
+	key    *holo.APIKey // nil if no keys are configured
+	claims *capClaims   // nil if capability tokens aren't required
+}
+
+// authenticate checks the api key and capability token of a request.  Every endpoint
+// but /auth and the admin api goes through it, or for relayed calls relayCaller.
+func (ws *WebServer) authenticate(r *http.Request) (c *caller, code int, err error) {
+	c = &caller{}
+	if c.key, code, err = ws.apiKey(r); err != nil {
+		return
+	}
+	c.claims, code, err = ws.capability(r)
+	return
+}
+
+// authorize checks that a caller may call the zome function.  Every zome call goes
+// through it, whichever way it arrives.
+func (ws *WebServer) authorize(c *caller, zome string, function string) (code int, err error) {
+	if code, err = ws.authorizeCall(c.key, zome, function); err != nil {
+		return
+	}
+	code, err = ws.authorizeCapability(c.claims, zome, function)
+	return
+}
+
+// handleAuth sets up /auth, to which a POST of a TokenRequest returns a capability token
+// for the functions requested.  With api keys configured, the request needs a key that
+// permits calling all of them, and without, it is authorized like the admin api.
+func (ws *WebServer) handleAuth() {
+	http.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var key *holo.APIKey
+		if len(ws.APIKeys) > 0 {
+			var code int
+			var err error
+			if key, code, err = ws.apiKey(r); err != nil {
+				http.Error(w, err.Error(), code)
+				return
+			}
+		} else if !ws.adminAllowed(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		} else if !ws.adminAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if len(req.Functions) == 0 {
+			http.Error(w, "no functions requested", 400)
+			return
+		}
+		for _, f := range req.Functions {
+			parts := strings.Split(f, "/")
+			if len(parts) != 2 {
+				http.Error(w, fmt.Sprintf("bad function %q, should be zome/function", f), 400)
+				return
+			}
+			z, err := ws.h.GetZome(parts[0])
+			if err == nil {
+				_, err = z.GetFunctionDef(parts[1])
+			}
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			if code, err := ws.authorizeCall(key, parts[0], parts[1]); err != nil {
+				http.Error(w, err.Error(), code)
+				return
+			}
+		}
+		token, err := ws.issueToken(req.Functions)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		ws.writeJSON(w, token)
+	})
+}
@@ -0,0 +1,67 @@
+package ui
+
+import (
+	. "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCapabilityTokens(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	ws := NewWebServer(h, "31416")
+
+	Convey("issued tokens should check and permit just their functions", t, func() {
+		token, err := ws.issueToken([]string{"jsSampleZome/addOdd"})
+		So(err, ShouldBeNil)
+		So(token.Expires.After(time.Now()), ShouldBeTrue)
+		claims, err := ws.checkToken(token.Token)
+		So(err, ShouldBeNil)
+		So(claims.allows("jsSampleZome", "addOdd"), ShouldBeNil)
+		So(claims.allows("jsSampleZome", "addProfile"), ShouldEqual, ErrCapabilityScope)
+	})
+
+	Convey("tampered, malformed and expired tokens should be refused", t, func() {
+		token, _ := ws.issueToken([]string{"jsSampleZome/addOdd"})
+		other, _ := ws.issueToken([]string{"jsSampleZome/addProfile"})
+		// the claims of one token with the signature of another
+		tampered := other.Token[:strings.Index(other.Token, ".")] + token.Token[strings.Index(token.Token, "."):]
+		_, err := ws.checkToken(tampered)
+		So(err, ShouldEqual, ErrBadCapabilityToken)
+		_, err = ws.checkToken("garbage")
+		So(err, ShouldEqual, ErrBadCapabilityToken)
+		_, err = ws.checkToken("")
+		So(err, ShouldEqual, ErrBadCapabilityToken)
+
+		ws.TokenTimeout = time.Nanosecond
+		defer func() { ws.TokenTimeout = 0 }()
+		expired, _ := ws.issueToken([]string{"jsSampleZome/addOdd"})
+		time.Sleep(time.Millisecond)
+		_, err = ws.checkToken(expired.Token)
+		So(err, ShouldEqual, ErrBadCapabilityToken)
+	})
+
+	Convey("requests should need a token only when tokens are required", t, func() {
+		r := httptest.NewRequest("POST", "/fn/jsSampleZome/addOdd", nil)
+		claims, _, err := ws.capability(r)
+		So(err, ShouldBeNil)
+		So(claims, ShouldBeNil)
+
+		ws.CapabilityTokens = true
+		defer func() { ws.CapabilityTokens = false }()
+		_, code, err := ws.capability(r)
+		So(err, ShouldEqual, ErrBadCapabilityToken)
+		So(code, ShouldEqual, 401)
+
+		token, _ := ws.issueToken([]string{"jsSampleZome/addOdd"})
+		r = httptest.NewRequest("GET", "/_sock/?cap="+token.Token, nil)
+		claims, _, err = ws.capability(r)
+		So(err, ShouldBeNil)
+		code, err = ws.authorizeCapability(claims, "zySampleZome", "addEven")
+		So(err, ShouldEqual, ErrCapabilityScope)
+		So(code, ShouldEqual, 403)
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements gzip/deflate compression of webserver responses
+
+package ui
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressor is the common interface of the gzip and zlib writers
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter compresses the body written to a ResponseWriter
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	c           compressor
+	wroteHeader bool
+	skip        bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	if code == http.StatusNoContent || code == http.StatusNotModified || h.Get("Content-Encoding") != "" {
+		cw.skip = true
+	} else {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+	}
+	h.Add("Vary", "Accept-Encoding")
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(b []byte) (n int, err error) {
+	if !cw.wroteHeader {
+		// sniff the type now as net/http would otherwise sniff the compressed bytes
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.skip {
+		return cw.ResponseWriter.Write(b)
+	}
+	if cw.c == nil {
+		if cw.encoding == "gzip" {
+			cw.c = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			// the deflate content-coding is actually zlib wrapped
+			cw.c = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+	return cw.c.Write(b)
+}
+
+// Flush sends any buffered compressed data so that streamed responses keep streaming
+func (cw *compressWriter) Flush() {
+	if cw.c != nil {
+		cw.c.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) close() {
+	if cw.c != nil {
+		cw.c.Close()
+	}
+}
+
+// acceptedEncoding returns the compression to use given an Accept-Encoding header,
+// preferring gzip, or "" if the client doesn't accept either
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		enc := strings.ToLower(strings.TrimSpace(fields[0]))
+		ok := true
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				q, err := strconv.ParseFloat(p[2:], 64)
+				if err == nil && q == 0 {
+					ok = false
+				}
+			}
+		}
+		accepted[enc] = ok
+	}
+	for _, enc := range []string{"gzip", "deflate"} {
+		if accepted[enc] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// compress wraps the handler for route so that its responses are compressed if that
+// route is enabled in ws.Compress and the client accepts it
+func (ws *WebServer) compress(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// ranges refer to the uncompressed content so leave those to the handler, and
+		// upgraded connections need the underlying writer to hijack
+		if !ws.Compress[route] || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		enc := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if enc == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: enc}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -0,0 +1,84 @@
+package ui
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	Convey("it should pick gzip or deflate from Accept-Encoding", t, func() {
+		So(acceptedEncoding(""), ShouldEqual, "")
+		So(acceptedEncoding("br"), ShouldEqual, "")
+		So(acceptedEncoding("deflate, gzip;q=1.0"), ShouldEqual, "gzip")
+		So(acceptedEncoding("gzip;q=0, deflate"), ShouldEqual, "deflate")
+		So(acceptedEncoding("GZIP"), ShouldEqual, "gzip")
+		So(acceptedEncoding("gzip; q=0.0"), ShouldEqual, "")
+	})
+}
+
+func TestCompress(t *testing.T) {
+	ws := &WebServer{Compress: map[string]bool{"/on/": true}}
+	body := "some response body some response body some response body"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+
+	Convey("it should gzip responses for enabled routes", t, func() {
+		r := httptest.NewRequest("GET", "/on/x", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		ws.compress("/on/", handler).ServeHTTP(w, r)
+		So(w.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+		So(w.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+		gz, err := gzip.NewReader(w.Body)
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(gz)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, body)
+	})
+
+	Convey("it should deflate responses", t, func() {
+		r := httptest.NewRequest("GET", "/on/x", nil)
+		r.Header.Set("Accept-Encoding", "deflate")
+		w := httptest.NewRecorder()
+		ws.compress("/on/", handler).ServeHTTP(w, r)
+		So(w.Header().Get("Content-Encoding"), ShouldEqual, "deflate")
+		zr, err := zlib.NewReader(w.Body)
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(zr)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, body)
+	})
+
+	Convey("it should not compress disabled routes or when not accepted", t, func() {
+		r := httptest.NewRequest("GET", "/off/x", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		ws.compress("/off/", handler).ServeHTTP(w, r)
+		So(w.Header().Get("Content-Encoding"), ShouldEqual, "")
+		So(w.Body.String(), ShouldEqual, body)
+
+		r = httptest.NewRequest("GET", "/on/x", nil)
+		w = httptest.NewRecorder()
+		ws.compress("/on/", handler).ServeHTTP(w, r)
+		So(w.Header().Get("Content-Encoding"), ShouldEqual, "")
+		So(w.Body.String(), ShouldEqual, body)
+	})
+
+	Convey("it should not compress bodiless responses", t, func() {
+		r := httptest.NewRequest("GET", "/on/x", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		ws.compress("/on/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotModified)
+		})).ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusNotModified)
+		So(w.Header().Get("Content-Encoding"), ShouldEqual, "")
+		So(w.Body.Len(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements conditional requests for content addressed webserver responses
+
+package ui
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hashETag returns the ETag of content addressed by hash, which can be a strong
+// validator as the content of a hash never changes
+func hashETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// etagMatch reports whether an If-None-Match header matches etag, using the weak
+// comparison the header calls for
+func etagMatch(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag header of the response and returns true having sent a
+// 304 if the request already has the content with that ETag
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" || !etagMatch(inm, etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
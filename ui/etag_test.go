@@ -0,0 +1,41 @@
+package ui
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagMatch(t *testing.T) {
+	Convey("it should match If-None-Match headers", t, func() {
+		etag := hashETag("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(etag, ShouldEqual, `"QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2"`)
+		So(etagMatch(etag, etag), ShouldBeTrue)
+		So(etagMatch(`"foo", `+etag, etag), ShouldBeTrue)
+		So(etagMatch("W/"+etag, etag), ShouldBeTrue)
+		So(etagMatch("*", etag), ShouldBeTrue)
+		So(etagMatch(`"foo"`, etag), ShouldBeFalse)
+	})
+}
+
+func TestNotModified(t *testing.T) {
+	etag := hashETag("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	Convey("it should send 304 when the client has the content", t, func() {
+		r := httptest.NewRequest("GET", "/entry/x", nil)
+		r.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		So(notModified(w, r, etag), ShouldBeTrue)
+		So(w.Code, ShouldEqual, http.StatusNotModified)
+		So(w.Header().Get("ETag"), ShouldEqual, etag)
+	})
+	Convey("it should only set the ETag otherwise", t, func() {
+		r := httptest.NewRequest("GET", "/entry/x", nil)
+		w := httptest.NewRecorder()
+		So(notModified(w, r, etag), ShouldBeFalse)
+		So(w.Header().Get("ETag"), ShouldEqual, etag)
+
+		r.Header.Set("If-None-Match", `"other"`)
+		So(notModified(w, r, etag), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements per api key authentication and rate limiting of webserver requests
+
+package ui
+
+import (
+	"crypto/subtle"
+	"errors"
+	holo "github.com/metacurrency/holochain"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrBadAPIKey = errors.New("missing or unknown api key")
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// rateLimiter is a token bucket allowing rate requests per second with bursts of burst
+type rateLimiter struct {
+	lk     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow takes a token from the bucket if there is one, a nil limiter always allowing
+func (l *rateLimiter) allow(now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// bearerToken returns the bearer token of a request, which as browsers can't set
+// headers on websockets may also be given as the token parameter
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return auth[len("Bearer "):]
+	}
+	return r.URL.Query().Get("token")
+}
+
+// apiKey returns the api key of a request, or nil if no keys are configured so
+// none is needed, along with the status code to fail the request with if it has
+// no valid key or the key is over its rate limit.  With CookieSessions the key
+// may instead come from the request's session.
+func (ws *WebServer) apiKey(r *http.Request) (key *holo.APIKey, code int, err error) {
+	if len(ws.APIKeys) == 0 {
+		return
+	}
+	token := bearerToken(r)
+	if token == "" && ws.CookieSessions {
+		key, code, err = ws.sessionKey(r)
+		if err != nil {
+			return
+		}
+	} else {
+		key = ws.findKey(token)
+	}
+	code, err = ws.checkKey(key)
+	return
+}
+
+// checkKey checks that there is a key and that it isn't over its rate limit
+func (ws *WebServer) checkKey(key *holo.APIKey) (code int, err error) {
+	if key == nil {
+		code, err = http.StatusUnauthorized, ErrBadAPIKey
+		return
+	}
+	if !ws.limiter(key).allow(time.Now()) {
+		code, err = http.StatusTooManyRequests, ErrRateLimited
+	}
+	return
+}
+
+// findKey returns the configured api key whose Key is token, if any
+func (ws *WebServer) findKey(token string) *holo.APIKey {
+	if token == "" {
+		return nil
+	}
+	for i := range ws.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(ws.APIKeys[i].Key), []byte(token)) == 1 {
+			return &ws.APIKeys[i]
+		}
+	}
+	return nil
+}
+
+// authorizeCall checks that key, as returned by apiKey, may call the zome function
+func (ws *WebServer) authorizeCall(key *holo.APIKey, zome string, function string) (code int, err error) {
+	if key == nil {
+		return
+	}
+	if err = key.Allows(zome, function); err != nil {
+		code = http.StatusForbidden
+	}
+	return
+}
+
+// limiter returns the rate limiter of key, which is nil for keys without a limit
+func (ws *WebServer) limiter(key *holo.APIKey) *rateLimiter {
+	if key.RateLimit == 0 {
+		return nil
+	}
+	ws.limitersLk.Lock()
+	defer ws.limitersLk.Unlock()
+	if ws.limiters == nil {
+		ws.limiters = make(map[string]*rateLimiter)
+	}
+	l, ok := ws.limiters[key.Name]
+	if !ok {
+		l = newRateLimiter(key.RateLimit, key.Burst)
+		ws.limiters[key.Name] = l
+	}
+	return l
+}
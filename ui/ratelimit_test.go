@@ -0,0 +1,85 @@
+package ui
+
+import (
+	holo "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	Convey("it should allow bursts and then the rate", t, func() {
+		l := newRateLimiter(2, 3)
+		now := time.Now()
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeFalse)
+		now = now.Add(500 * time.Millisecond)
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeFalse)
+		now = now.Add(time.Hour)
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeFalse)
+	})
+
+	Convey("a nil limiter should always allow", t, func() {
+		var l *rateLimiter
+		So(l.allow(time.Now()), ShouldBeTrue)
+	})
+}
+
+func TestAPIKey(t *testing.T) {
+	ws := &WebServer{}
+	Convey("no key should be needed if none are configured", t, func() {
+		r := httptest.NewRequest("GET", "/entry/x", nil)
+		key, _, err := ws.apiKey(r)
+		So(err, ShouldBeNil)
+		So(key, ShouldBeNil)
+	})
+
+	ws.APIKeys = []holo.APIKey{
+		{Name: "reader", Key: "r1"},
+		{Name: "writer", Key: "w1", Write: true, Functions: []string{"zome/*"}, RateLimit: 1, Burst: 1},
+	}
+
+	Convey("it should require a configured key", t, func() {
+		r := httptest.NewRequest("GET", "/entry/x", nil)
+		_, code, err := ws.apiKey(r)
+		So(err, ShouldEqual, ErrBadAPIKey)
+		So(code, ShouldEqual, http.StatusUnauthorized)
+
+		r.Header.Set("Authorization", "Bearer bogus")
+		_, code, err = ws.apiKey(r)
+		So(err, ShouldEqual, ErrBadAPIKey)
+
+		r.Header.Set("Authorization", "Bearer r1")
+		key, _, err := ws.apiKey(r)
+		So(err, ShouldBeNil)
+		So(key.Name, ShouldEqual, "reader")
+	})
+
+	Convey("it should check the scope of calls", t, func() {
+		code, err := ws.authorizeCall(&ws.APIKeys[0], "zome", "fn")
+		So(err, ShouldEqual, holo.ErrAPIKeyScope)
+		So(code, ShouldEqual, http.StatusForbidden)
+		_, err = ws.authorizeCall(&ws.APIKeys[1], "zome", "fn")
+		So(err, ShouldBeNil)
+		_, err = ws.authorizeCall(nil, "zome", "fn")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should rate limit keys", t, func() {
+		r := httptest.NewRequest("POST", "/fn/zome/fn?token=w1", nil)
+		key, _, err := ws.apiKey(r)
+		So(err, ShouldBeNil)
+		So(key.Name, ShouldEqual, "writer")
+		_, code, err := ws.apiKey(r)
+		So(err, ShouldEqual, ErrRateLimited)
+		So(code, ShouldEqual, http.StatusTooManyRequests)
+	})
+}
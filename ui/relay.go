@@ -0,0 +1,196 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements the web server's client mode, where it connects out to a relay that passes
+// on the zome calls of hosted front-ends, for nodes that can't be reached from outside
+
+package ui
+
+import (
+	"context"
+	"errors"
+	websocket "github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultRelayRetry is how long to wait before reconnecting to a relay
+const DefaultRelayRetry = 10 * time.Second
+
+var ErrRelayUnauthenticated = errors.New("relaying calls needs api keys or capability tokens to check them against")
+
+// RelayRequest is a zome call passed on by a relay.  Calls are run concurrently, so the
+// relay matches the responses to them by ID.
+type RelayRequest struct {
+	ID   string
+	Zome string
+	Fn   string
+	Arg  string
+	// Token is the api key of the front-end making the call, needed if keys are set
+	Token string
+	// Capability is the front-end's capability token, needed if tokens are required
+	Capability string
+}
+
+// RelayResponse is a chunk of the result of a call, or with Done the end of it and the
+// error it failed with, if any
+type RelayResponse struct {
+	ID    string
+	Data  string `json:",omitempty"`
+	Done  bool   `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+// StartRelay connects to the relay at RelayURL in the background, reconnecting after
+// RelayRetry whenever the connection drops, until StopRelay is called.  It doesn't
+// need the web server to be started.  As the relay passes on calls from anyone, it
+// refuses to start unless api keys or capability tokens are configured.
+func (ws *WebServer) StartRelay() (err error) {
+	ws.relayLk.Lock()
+	defer ws.relayLk.Unlock()
+	if ws.relayStop != nil {
+		return
+	}
+	if len(ws.APIKeys) == 0 && !ws.CapabilityTokens {
+		err = ErrRelayUnauthenticated
+		return
+	}
+	stop := make(chan struct{})
+	ws.relayStop = stop
+	retry := ws.RelayRetry
+	if retry == 0 {
+		retry = DefaultRelayRetry
+	}
+	go func() {
+		for {
+			if err := ws.relay(stop); err != nil {
+				ws.errs.Logf("relay %s: %v", ws.RelayURL, err)
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(retry):
+			}
+		}
+	}()
+	return
+}
+
+// StopRelay disconnects from the relay
+func (ws *WebServer) StopRelay() {
+	ws.relayLk.Lock()
+	defer ws.relayLk.Unlock()
+	if ws.relayStop != nil {
+		close(ws.relayStop)
+		ws.relayStop = nil
+	}
+}
+
+// relay serves the calls the relay sends until the connection drops or stop is closed
+func (ws *WebServer) relay(stop chan struct{}) (err error) {
+	header := http.Header{}
+	if ws.RelayToken != "" {
+		header.Set("Authorization", "Bearer "+ws.RelayToken)
+	}
+	// the relay routes front-ends to nodes by these
+	_, nodeID, _ := ws.h.Agent().NodeID()
+	header.Set("X-Holochain-Node", nodeID)
+	header.Set("X-Holochain-DNA", ws.h.DNAHash().String())
+	var conn *websocket.Conn
+	if conn, _, err = websocket.DefaultDialer.Dial(ws.RelayURL, header); err != nil {
+		return
+	}
+	ws.log.Logf("connected to relay %s\n", ws.RelayURL)
+
+	done := make(chan struct{})
+	go func() {
+		// closing the connection ends the read loop when the relay is stopped
+		select {
+		case <-stop:
+		case <-done:
+		}
+		conn.Close()
+	}()
+	var calls sync.WaitGroup
+	defer func() {
+		calls.Wait()
+		close(done)
+	}()
+
+	var writeLk sync.Mutex
+	write := func(resp RelayResponse) error {
+		writeLk.Lock()
+		defer writeLk.Unlock()
+		return conn.WriteJSON(resp)
+	}
+	for {
+		var req RelayRequest
+		if err = conn.ReadJSON(&req); err != nil {
+			select {
+			case <-stop:
+				err = nil
+			default:
+			}
+			return
+		}
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			ws.relayCall(&req, write)
+		}()
+	}
+}
+
+// relayCall runs a call from the relay, writing its result in chunks
+func (ws *WebServer) relayCall(req *RelayRequest, write func(RelayResponse) error) {
+	err := ws.authorizeRelayed(req)
+	if err == nil {
+		var result io.ReadCloser
+		var cancel context.CancelFunc
+		if result, cancel, err = ws.stream(context.Background(), req.Zome, req.Fn, req.Arg); err == nil {
+			_, err = copyChunks(result, func(chunk []byte) error {
+				return write(RelayResponse{ID: req.ID, Data: string(chunk)})
+			})
+			result.Close()
+			cancel()
+		}
+	}
+	resp := RelayResponse{ID: req.ID, Done: true}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if err = write(resp); err != nil {
+		ws.errs.Log(err)
+	}
+}
+
+// authorizeRelayed checks the api key and capability token a relayed call carries, as
+// the relay is trusted only to pass calls on
+func (ws *WebServer) authorizeRelayed(req *RelayRequest) (err error) {
+	if len(ws.APIKeys) == 0 && !ws.CapabilityTokens {
+		err = ErrRelayUnauthenticated
+		return
+	}
+	var c *caller
+	if c, _, err = ws.relayCaller(req); err != nil {
+		return
+	}
+	_, err = ws.authorize(c, req.Zome, req.Fn)
+	return
+}
+
+// relayCaller checks the api key and capability token of a relayed call
+func (ws *WebServer) relayCaller(req *RelayRequest) (c *caller, code int, err error) {
+	c = &caller{}
+	if len(ws.APIKeys) > 0 {
+		c.key = ws.findKey(req.Token)
+		if code, err = ws.checkKey(c.key); err != nil {
+			return
+		}
+	}
+	c.claims, code, err = ws.requireToken(req.Capability)
+	return
+}
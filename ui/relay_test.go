@@ -0,0 +1,104 @@
+package ui
+
+import (
+	websocket "github.com/gorilla/websocket"
+	. "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRelay(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	defer h.Close()
+
+	headers := make(chan http.Header, 1)
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		headers <- r.Header
+		conns <- conn
+	}))
+	defer relay.Close()
+
+	ws := NewWebServer(h, "31416")
+	ws.RelayURL = "ws" + strings.TrimPrefix(relay.URL, "http")
+	ws.RelayToken = "relaytoken"
+
+	Convey("it should refuse to relay calls it can't authorize", t, func() {
+		So(ws.StartRelay(), ShouldEqual, ErrRelayUnauthenticated)
+		So(ws.authorizeRelayed(&RelayRequest{Zome: "jsSampleZome", Fn: "addOdd"}), ShouldEqual, ErrRelayUnauthenticated)
+	})
+
+	ws.APIKeys = []APIKey{{Name: "fe", Key: "secret", Write: true, Functions: []string{"jsSampleZome/*"}}}
+	if err := ws.StartRelay(); err != nil {
+		t.Fatal(err)
+	}
+	defer ws.StopRelay()
+
+	header := <-headers
+	conn := <-conns
+	defer conn.Close()
+
+	call := func(req RelayRequest) (data string, resp RelayResponse) {
+		err := conn.WriteJSON(req)
+		So(err, ShouldBeNil)
+		for {
+			resp = RelayResponse{}
+			err = conn.ReadJSON(&resp)
+			So(err, ShouldBeNil)
+			So(resp.ID, ShouldEqual, req.ID)
+			if resp.Done {
+				return
+			}
+			data += resp.Data
+		}
+	}
+
+	Convey("the node should connect with its token and identity", t, func() {
+		So(header.Get("Authorization"), ShouldEqual, "Bearer relaytoken")
+		So(header.Get("X-Holochain-DNA"), ShouldEqual, h.DNAHash().String())
+		_, nodeID, _ := h.Agent().NodeID()
+		So(header.Get("X-Holochain-Node"), ShouldEqual, nodeID)
+	})
+
+	Convey("it should serve calls passed on by the relay", t, func() {
+		data, resp := call(RelayRequest{ID: "1", Zome: "jsSampleZome", Fn: "addOdd", Arg: "7", Token: "secret"})
+		So(resp.Error, ShouldEqual, "")
+		So(data, ShouldStartWith, "Qm")
+	})
+
+	Convey("it should report errors of calls", t, func() {
+		_, resp := call(RelayRequest{ID: "2", Zome: "jsSampleZome", Fn: "addOdd", Arg: "2", Token: "secret"})
+		So(resp.Error, ShouldNotEqual, "")
+	})
+
+	Convey("it should require an api key when keys are set", t, func() {
+		_, resp := call(RelayRequest{ID: "3", Zome: "jsSampleZome", Fn: "addOdd", Arg: "9"})
+		So(resp.Error, ShouldEqual, ErrBadAPIKey.Error())
+
+		data, resp := call(RelayRequest{ID: "4", Zome: "jsSampleZome", Fn: "addOdd", Arg: "9", Token: "secret"})
+		So(resp.Error, ShouldEqual, "")
+		So(data, ShouldStartWith, "Qm")
+	})
+
+	Convey("it should require a capability token when tokens are required", t, func() {
+		ws.CapabilityTokens = true
+		defer func() { ws.CapabilityTokens = false }()
+		_, resp := call(RelayRequest{ID: "5", Zome: "jsSampleZome", Fn: "addOdd", Arg: "11", Token: "secret"})
+		So(resp.Error, ShouldEqual, ErrBadCapabilityToken.Error())
+
+		token, err := ws.issueToken([]string{"jsSampleZome/addOdd"})
+		So(err, ShouldBeNil)
+		data, resp := call(RelayRequest{ID: "6", Zome: "jsSampleZome", Fn: "addOdd", Arg: "11", Token: "secret", Capability: token.Token})
+		So(resp.Error, ShouldEqual, "")
+		So(data, ShouldStartWith, "Qm")
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// rest implements calling zome functions declared ReadOnly with GET requests, so that
+// they can be used from a browser or curl without a body, and picking the content type of
+// call results that the client accepts
+
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	holo "github.com/metacurrency/holochain"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrNotAcceptable = errors.New("the function's result can't be sent in any of the accepted content types")
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeText = "text/plain; charset=utf-8"
+)
+
+// queryArgs maps the query parameters of a GET call to the function's argument.  A
+// string function gets the arg parameter.  A json function gets an object of all the
+// parameters, each value being used as JSON if it is a number, boolean, null, object or
+// array and as a string otherwise, and repeated parameters becoming arrays.
+func queryArgs(fn *holo.FunctionDef, q url.Values) (args string, err error) {
+	if fn.CallingType != holo.JSON_CALLING {
+		args = q.Get("arg")
+		return
+	}
+	if len(q) == 0 {
+		return
+	}
+	obj := make(map[string]interface{}, len(q))
+	for name, values := range q {
+		if len(values) == 1 {
+			obj[name] = queryValue(values[0])
+			continue
+		}
+		list := make([]interface{}, len(values))
+		for i, v := range values {
+			list[i] = queryValue(v)
+		}
+		obj[name] = list
+	}
+	var b []byte
+	b, err = json.Marshal(obj)
+	args = string(b)
+	return
+}
+
+// queryValue returns the value of a query parameter as JSON, or as a string if it isn't
+// JSON or is a JSON string
+func queryValue(s string) interface{} {
+	if json.Valid([]byte(s)) && !strings.HasPrefix(strings.TrimSpace(s), `"`) {
+		return json.RawMessage(s)
+	}
+	return s
+}
+
+// resultContentType returns the content type to send a function's result in, given
+// the Accept header of the request.  json functions return JSON, which may also be
+// sent as plain text, and string functions plain text.
+func resultContentType(fn *holo.FunctionDef, accept string) (contentType string, err error) {
+	contentType = contentTypeText
+	if fn.CallingType == holo.JSON_CALLING {
+		contentType = contentTypeJSON
+	}
+	if strings.TrimSpace(accept) == "" {
+		return
+	}
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		ok := true
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				q, e := strconv.ParseFloat(p[2:], 64)
+				if e == nil && q == 0 {
+					ok = false
+				}
+			}
+		}
+		accepted[mediaType] = ok
+	}
+	if acceptable(accepted, strings.Split(contentType, ";")[0]) {
+		return
+	}
+	if fn.CallingType == holo.JSON_CALLING && acceptable(accepted, "text/plain") {
+		contentType = contentTypeText
+		return
+	}
+	err = ErrNotAcceptable
+	return
+}
+
+// acceptable returns true if the media type is accepted, the most specific of the
+// accepted ranges that match it deciding
+func acceptable(accepted map[string]bool, mediaType string) bool {
+	for _, r := range []string{mediaType, strings.Split(mediaType, "/")[0] + "/*", "*/*"} {
+		if ok, found := accepted[r]; found {
+			return ok
+		}
+	}
+	return false
+}
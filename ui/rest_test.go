@@ -0,0 +1,65 @@
+package ui
+
+import (
+	. "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/url"
+	"testing"
+)
+
+func TestQueryArgs(t *testing.T) {
+	str := &FunctionDef{Name: "f", CallingType: STRING_CALLING}
+	js := &FunctionDef{Name: "f", CallingType: JSON_CALLING}
+
+	Convey("a string function should get the arg parameter", t, func() {
+		args, err := queryArgs(str, url.Values{"arg": {"hello"}, "other": {"x"}})
+		So(err, ShouldBeNil)
+		So(args, ShouldEqual, "hello")
+		args, err = queryArgs(str, url.Values{})
+		So(err, ShouldBeNil)
+		So(args, ShouldEqual, "")
+	})
+
+	Convey("a json function should get an object of the parameters", t, func() {
+		q, _ := url.ParseQuery(`n=7&ok=true&name=zippy&quoted="7"&tag=a&tag=b&obj={"x":1}&zip=007`)
+		args, err := queryArgs(js, q)
+		So(err, ShouldBeNil)
+		So(args, ShouldEqual, `{"n":7,"name":"zippy","obj":{"x":1},"ok":true,"quoted":"\"7\"","tag":["a","b"],"zip":"007"}`)
+		args, err = queryArgs(js, url.Values{})
+		So(err, ShouldBeNil)
+		So(args, ShouldEqual, "")
+	})
+}
+
+func TestResultContentType(t *testing.T) {
+	str := &FunctionDef{Name: "f", CallingType: STRING_CALLING}
+	js := &FunctionDef{Name: "f", CallingType: JSON_CALLING}
+
+	Convey("results should be sent in their own type when it is accepted", t, func() {
+		ct, err := resultContentType(js, "")
+		So(err, ShouldBeNil)
+		So(ct, ShouldEqual, "application/json")
+		ct, err = resultContentType(str, "text/html, */*;q=0.8")
+		So(err, ShouldBeNil)
+		So(ct, ShouldEqual, "text/plain; charset=utf-8")
+		ct, err = resultContentType(js, "application/*")
+		So(err, ShouldBeNil)
+		So(ct, ShouldEqual, "application/json")
+	})
+
+	Convey("json results should be sent as text when only that is accepted", t, func() {
+		ct, err := resultContentType(js, "text/plain")
+		So(err, ShouldBeNil)
+		So(ct, ShouldEqual, "text/plain; charset=utf-8")
+		ct, err = resultContentType(js, "application/json;q=0, */*")
+		So(err, ShouldBeNil)
+		So(ct, ShouldEqual, "text/plain; charset=utf-8")
+	})
+
+	Convey("results should be refused in types that aren't accepted", t, func() {
+		_, err := resultContentType(str, "application/json")
+		So(err, ShouldEqual, ErrNotAcceptable)
+		_, err = resultContentType(js, "image/png")
+		So(err, ShouldEqual, ErrNotAcceptable)
+	})
+}
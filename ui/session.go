@@ -0,0 +1,179 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements cookie sessions with CSRF tokens, so UIs served by the node can use an
+// api key without keeping it in the browser
+
+package ui
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	holo "github.com/metacurrency/holochain"
+	"net/http"
+	"time"
+)
+
+const (
+	SessionCookieName     = "hc_session"
+	CSRFHeader            = "X-CSRF-Token"
+	DefaultSessionTimeout = 24 * time.Hour
+)
+
+var ErrBadCSRFToken = errors.New("missing or bad CSRF token")
+
+// session is what a session cookie stands for
+type session struct {
+	keyName string
+	csrf    string
+	expires time.Time
+}
+
+// SessionInfo is returned to clients that start or check a session
+type SessionInfo struct {
+	CSRFToken string
+	Expires   time.Time
+}
+
+func randomToken() (token string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return
+}
+
+// newSession starts a session for key returning its id and CSRF token
+func (ws *WebServer) newSession(key *holo.APIKey) (id string, s *session, err error) {
+	if id, err = randomToken(); err != nil {
+		return
+	}
+	s = &session{keyName: key.Name, expires: time.Now().Add(ws.sessionTimeout())}
+	if s.csrf, err = randomToken(); err != nil {
+		return
+	}
+	ws.sessionsLk.Lock()
+	defer ws.sessionsLk.Unlock()
+	if ws.sessions == nil {
+		ws.sessions = make(map[string]*session)
+	}
+	ws.sessions[id] = s
+	return
+}
+
+func (ws *WebServer) sessionTimeout() time.Duration {
+	if ws.SessionTimeout > 0 {
+		return ws.SessionTimeout
+	}
+	return DefaultSessionTimeout
+}
+
+// session returns the unexpired session of the request's cookie and its id, if any
+func (ws *WebServer) session(r *http.Request) (id string, s *session) {
+	c, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return
+	}
+	ws.sessionsLk.Lock()
+	defer ws.sessionsLk.Unlock()
+	s = ws.sessions[c.Value]
+	if s == nil {
+		return
+	}
+	if time.Now().After(s.expires) {
+		delete(ws.sessions, c.Value)
+		s = nil
+		return
+	}
+	id = c.Value
+	return
+}
+
+// sessionKey returns the api key of the request's session.  Requests that could change
+// state must also carry the session's CSRF token, in the X-CSRF-Token header or, for
+// websockets, the csrf parameter.
+func (ws *WebServer) sessionKey(r *http.Request) (key *holo.APIKey, code int, err error) {
+	_, s := ws.session(r)
+	if s == nil {
+		code, err = http.StatusUnauthorized, ErrBadAPIKey
+		return
+	}
+	if (r.Method != "GET" && r.Method != "HEAD") || r.Header.Get("Upgrade") != "" {
+		csrf := r.Header.Get(CSRFHeader)
+		if csrf == "" {
+			csrf = r.URL.Query().Get("csrf")
+		}
+		if subtle.ConstantTimeCompare([]byte(csrf), []byte(s.csrf)) != 1 {
+			code, err = http.StatusForbidden, ErrBadCSRFToken
+			return
+		}
+	}
+	for i := range ws.APIKeys {
+		if ws.APIKeys[i].Name == s.keyName {
+			key = &ws.APIKeys[i]
+			return
+		}
+	}
+	// the key has been removed since the session started
+	code, err = http.StatusUnauthorized, ErrBadAPIKey
+	return
+}
+
+// handleSessions sets up /_session, to which a POST with an api key as the bearer token
+// starts a session, setting its cookie and returning its CSRF token; a GET returns the
+// CSRF token of the current session; and a DELETE ends the current session
+func (ws *WebServer) handleSessions() {
+	http.HandleFunc("/_session", func(w http.ResponseWriter, r *http.Request) {
+		if !ws.CookieSessions {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "POST":
+			key := ws.findKey(bearerToken(r))
+			if key == nil {
+				http.Error(w, ErrBadAPIKey.Error(), http.StatusUnauthorized)
+				return
+			}
+			id, s, err := ws.newSession(key)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     SessionCookieName,
+				Value:    id,
+				Path:     "/",
+				Expires:  s.expires,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+			ws.writeJSON(w, SessionInfo{CSRFToken: s.csrf, Expires: s.expires})
+		case "GET":
+			_, s := ws.session(r)
+			if s == nil {
+				http.Error(w, ErrBadAPIKey.Error(), http.StatusUnauthorized)
+				return
+			}
+			ws.writeJSON(w, SessionInfo{CSRFToken: s.csrf, Expires: s.expires})
+		case "DELETE":
+			if _, code, err := ws.sessionKey(r); err != nil {
+				http.Error(w, err.Error(), code)
+				return
+			}
+			id, _ := ws.session(r)
+			ws.sessionsLk.Lock()
+			delete(ws.sessions, id)
+			ws.sessionsLk.Unlock()
+			http.SetCookie(w, &http.Cookie{Name: SessionCookieName, Value: "", Path: "/", MaxAge: -1})
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
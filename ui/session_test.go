@@ -0,0 +1,70 @@
+package ui
+
+import (
+	holo "github.com/metacurrency/holochain"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	ws := &WebServer{CookieSessions: true}
+	ws.APIKeys = []holo.APIKey{{Name: "app", Key: "secret", Write: true, Functions: []string{"*/*"}}}
+	id, s, err := ws.newSession(&ws.APIKeys[0])
+
+	Convey("it should start sessions", t, func() {
+		So(err, ShouldBeNil)
+		So(id, ShouldNotEqual, "")
+		So(s.csrf, ShouldNotEqual, "")
+		So(s.csrf, ShouldNotEqual, id)
+		So(s.keyName, ShouldEqual, "app")
+	})
+
+	Convey("it should get the key of a session for reads", t, func() {
+		r := httptest.NewRequest("GET", "/entry/x", nil)
+		_, _, err := ws.apiKey(r)
+		So(err, ShouldEqual, ErrBadAPIKey)
+
+		r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: id})
+		key, _, err := ws.apiKey(r)
+		So(err, ShouldBeNil)
+		So(key.Name, ShouldEqual, "app")
+	})
+
+	Convey("it should require the CSRF token for calls", t, func() {
+		r := httptest.NewRequest("POST", "/fn/zome/fn", nil)
+		r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: id})
+		_, code, err := ws.apiKey(r)
+		So(err, ShouldEqual, ErrBadCSRFToken)
+		So(code, ShouldEqual, http.StatusForbidden)
+
+		r.Header.Set(CSRFHeader, "bogus")
+		_, _, err = ws.apiKey(r)
+		So(err, ShouldEqual, ErrBadCSRFToken)
+
+		r.Header.Set(CSRFHeader, s.csrf)
+		key, _, err := ws.apiKey(r)
+		So(err, ShouldBeNil)
+		So(key.Name, ShouldEqual, "app")
+	})
+
+	Convey("it should not use sessions unless enabled", t, func() {
+		ws.CookieSessions = false
+		defer func() { ws.CookieSessions = true }()
+		r := httptest.NewRequest("GET", "/entry/x", nil)
+		r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: id})
+		_, _, err := ws.apiKey(r)
+		So(err, ShouldEqual, ErrBadAPIKey)
+	})
+
+	Convey("it should expire sessions", t, func() {
+		s.expires = time.Now().Add(-time.Second)
+		r := httptest.NewRequest("GET", "/entry/x", nil)
+		r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: id})
+		_, _, err := ws.apiKey(r)
+		So(err, ShouldEqual, ErrBadAPIKey)
+		So(len(ws.sessions), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// signal implements pushing the signals zome code emits to browser clients on the
+// /_sock/ websocket.  A client subscribes by sending {"signals":"name1,name2"}, or "*"
+// for every signal, and unsubscribes by sending an empty list; the signals are then sent
+// to it as SignalMessages in between the results of its calls.
+
+package ui
+
+import (
+	websocket "github.com/gorilla/websocket"
+	holo "github.com/metacurrency/holochain"
+	"strings"
+	"sync"
+)
+
+// SignalMessage is how a signal is sent to a websocket client
+type SignalMessage struct {
+	Signal  string      `json:"signal"`
+	Zome    string      `json:"zome"`
+	Payload interface{} `json:"payload"`
+}
+
+// sockWriter serializes writes to a websocket, which call results and signals share
+type sockWriter struct {
+	lk   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *sockWriter) WriteMessage(messageType int, data []byte) error {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	return w.conn.WriteMessage(messageType, data)
+}
+
+func (w *sockWriter) WriteJSON(v interface{}) error {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	return w.conn.WriteJSON(v)
+}
+
+// signalRouter holds the signals a websocket client is subscribed to
+type signalRouter struct {
+	lk    sync.Mutex
+	all   bool
+	names map[string]bool
+}
+
+// subscribe replaces the subscriptions with the signals in a comma separated list
+func (r *signalRouter) subscribe(list string) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.all = false
+	r.names = make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+		case "*":
+			r.all = true
+		default:
+			r.names[name] = true
+		}
+	}
+}
+
+// wants returns true if the client is subscribed to the signal
+func (r *signalRouter) wants(name string) bool {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.all || r.names[name]
+}
+
+// routeSignals sends the signals the client subscribes to on the websocket until done
+// is closed
+func (ws *WebServer) routeSignals(w *sockWriter, r *signalRouter, done <-chan struct{}) {
+	events := make(chan holo.Event, 64)
+	ws.h.Events().Subscribe(holo.SignalEmitted, events)
+	defer ws.h.Events().Unsubscribe(events)
+	for {
+		select {
+		case <-done:
+			return
+		case e := <-events:
+			if !r.wants(e.Signal) {
+				continue
+			}
+			if err := w.WriteJSON(SignalMessage{Signal: e.Signal, Zome: e.Zome, Payload: e.Payload}); err != nil {
+				ws.errs.Log(err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package ui
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSignalRouter(t *testing.T) {
+	Convey("a client should get only the signals it subscribes to", t, func() {
+		var r signalRouter
+		So(r.wants("newMessage"), ShouldBeFalse)
+		r.subscribe("newMessage, typing")
+		So(r.wants("newMessage"), ShouldBeTrue)
+		So(r.wants("typing"), ShouldBeTrue)
+		So(r.wants("left"), ShouldBeFalse)
+		r.subscribe("*")
+		So(r.wants("left"), ShouldBeTrue)
+		r.subscribe("")
+		So(r.wants("newMessage"), ShouldBeFalse)
+	})
+}
@@ -7,51 +7,122 @@
 package ui
 
 import (
-	_ "encoding/json"
+	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
 	websocket "github.com/gorilla/websocket"
 	holo "github.com/metacurrency/holochain"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
+// DefaultCallTimeout is how long a zome call made through the web server may run
+const DefaultCallTimeout = 60 * time.Second
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
 type WebServer struct {
 	h    *holo.Holochain
 	port string
 	log  holo.Logger
 	errs holo.Logger
+
+	// CallTimeout limits how long a zome call may run before it is cancelled and
+	// a 504 returned, 0 means no limit
+	CallTimeout time.Duration
+
+	// Compress holds the routes whose responses are compressed for clients that
+	// accept gzip or deflate
+	Compress map[string]bool
+
+	// AdminAllowRemote lets hosts other than the local one use the admin api and UI
+	AdminAllowRemote bool
+
+	// AdminToken if set must be given as a bearer token to use the admin api
+	AdminToken string
+
+	// APIKeys if set are the keys one of which must be given as a bearer token to
+	// get entries and task statuses or, for keys that permit it, call zome functions
+	APIKeys []holo.APIKey
+
+	// CookieSessions lets clients exchange an api key for a session cookie, with a
+	// CSRF token that must accompany calls, see /_session
+	CookieSessions bool
+
+	// SessionTimeout is how long sessions last, 0 meaning DefaultSessionTimeout
+	SessionTimeout time.Duration
+
+	// CapabilityTokens requires requests and relayed calls to carry a token from
+	// /auth, which for zome calls must permit calling the function, see captoken.go
+	CapabilityTokens bool
+
+	// TokenTimeout is how long capability tokens last, 0 meaning DefaultTokenTimeout
+	TokenTimeout time.Duration
+
+	// RelayURL is the websocket URL of a relay to connect out to and take zome calls
+	// from, which needs APIKeys or CapabilityTokens to check them against, see
+	// StartRelay, and RelayToken the bearer token to connect with
+	RelayURL   string
+	RelayToken string
+
+	// RelayRetry is how long to wait before reconnecting, 0 meaning DefaultRelayRetry
+	RelayRetry time.Duration
+
+	limiters   map[string]*rateLimiter
+	limitersLk sync.Mutex
+	sessions   map[string]*session
+	sessionsLk sync.Mutex
+	relayStop  chan struct{}
+	relayLk    sync.Mutex
 }
 
 func NewWebServer(h *holo.Holochain, port string) *WebServer {
-	w := WebServer{h: h, port: port}
+	w := WebServer{h: h, port: port, CallTimeout: DefaultCallTimeout}
+	w.Compress = map[string]bool{"/": true, "/fn/": true, "/task/": true, "/entry/": true, "/admin/": true}
 	w.log = holo.Logger{Format: "%{color:magenta}%{message}"}
 	w.errs = holo.Logger{Format: "%{color:red}%{time} %{message}", Enabled: true}
+	w.log.New(nil)
+	w.errs.New(os.Stderr)
 	return &w
 }
 
 func (ws *WebServer) Start() {
-
-	ws.log.New(nil)
-	ws.errs.New(os.Stderr)
+	if ws.RelayURL != "" {
+		if err := ws.StartRelay(); err != nil {
+			ws.errs.Logf("relay %s: %v", ws.RelayURL, err)
+		}
+	}
 
 	fs := http.FileServer(http.Dir(ws.h.UIPath()))
-	http.Handle("/", fs)
-
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin:     func(r *http.Request) bool { return true },
-	}
+	http.Handle("/", ws.compress("/", fs))
 
+	// /_sock/ is a websocket taking zome calls, on which the signals the client
+	// subscribes to are also pushed, see signal.go
 	http.HandleFunc("/_sock/", func(w http.ResponseWriter, r *http.Request) {
+		c, code, err := ws.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			ws.errs.Logf(err.Error())
 			return
 		}
+		out := &sockWriter{conn: conn}
+		signals := &signalRouter{}
+		done := make(chan struct{})
+		defer close(done)
+		go ws.routeSignals(out, signals, done)
 
 		for {
 			var v map[string]string
@@ -63,19 +134,45 @@ func (ws *WebServer) Start() {
 				ws.errs.Log(err)
 				return
 			}
+			if list, ok := v["signals"]; ok {
+				signals.subscribe(list)
+				continue
+			}
 			zome := v["zome"]
 			function := v["fn"]
-			result, err := ws.call(zome, function, v["arg"])
-			switch t := result.(type) {
-			case string:
-				err = conn.WriteMessage(websocket.TextMessage, []byte(t))
-			case []byte:
-				err = conn.WriteMessage(websocket.TextMessage, t)
-				//err = conn.WriteJSON(t)
-			default:
-				err = fmt.Errorf("Unknown type from Call of %s:%s", zome, function)
+			// the key and token were checked on connecting but each call must be
+			// permitted and counts towards the key's rate limit
+			if c.key != nil || c.claims != nil {
+				_, err = ws.authorize(c, zome, function)
+				if err == nil && c.key != nil && !ws.limiter(c.key).allow(time.Now()) {
+					err = ErrRateLimited
+				}
+				if err != nil {
+					if err = out.WriteMessage(websocket.TextMessage, []byte(err.Error())); err != nil {
+						ws.errs.Log(err)
+						return
+					}
+					continue
+				}
+			}
+			result, cancel, err := ws.stream(context.Background(), zome, function, v["arg"])
+			if err != nil {
+				ws.errs.Log(err)
+				return
+			}
+			// each chunk of the result is sent as its own message
+			written, err := copyChunks(result, func(chunk []byte) error {
+				return out.WriteMessage(websocket.TextMessage, chunk)
+			})
+			result.Close()
+			cancel()
+			if !written && (err == nil || errors.Is(err, holo.ErrTimeout)) {
+				msg := ""
+				if err != nil {
+					msg = err.Error()
+				}
+				err = out.WriteMessage(websocket.TextMessage, []byte(msg))
 			}
-
 			if err != nil {
 				ws.errs.Log(err)
 				return
@@ -83,52 +180,263 @@ func (ws *WebServer) Start() {
 		}
 	})
 
-	http.HandleFunc("/fn/", func(w http.ResponseWriter, r *http.Request) {
+	// /_presence is a websocket on which agents coming online and going offline are
+	// sent as they happen, starting with the agents online when it connects
+	http.HandleFunc("/_presence", func(w http.ResponseWriter, r *http.Request) {
+		if _, code, err := ws.authenticate(r); err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		p := ws.h.Presence()
+		if p == nil {
+			http.Error(w, "presence not started", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			ws.errs.Logf(err.Error())
+			return
+		}
+		defer conn.Close()
+		events, cancel := p.Watch()
+		defer cancel()
+		for _, a := range p.Online() {
+			if err = conn.WriteJSON(holo.PresenceEvent{Agent: a.Agent, Online: true, Time: a.LastSeen}); err != nil {
+				return
+			}
+		}
+		// the client never sends anything, so reading only serves to notice it closing
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		for {
+			select {
+			case <-closed:
+				return
+			case e := <-events:
+				if err = conn.WriteJSON(e); err != nil {
+					ws.errs.Log(err)
+					return
+				}
+			}
+		}
+	})
+
+	// /_events streams the holochain's events, of the types in the comma separated
+	// types parameter or all of them
+	http.HandleFunc("/_events", func(w http.ResponseWriter, r *http.Request) {
+		if _, code, err := ws.authenticate(r); err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		types, err := holo.ParseEventTypes(r.URL.Query().Get("types"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			ws.errs.Logf(err.Error())
+			return
+		}
+		defer conn.Close()
+		events := make(chan holo.Event, 64)
+		ws.h.Events().Subscribe(types, events)
+		defer ws.h.Events().Unsubscribe(events)
+		// the client never sends anything, so reading only serves to notice it closing
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		for {
+			select {
+			case <-closed:
+				return
+			case e := <-events:
+				if err = conn.WriteJSON(e); err != nil {
+					ws.errs.Log(err)
+					return
+				}
+			}
+		}
+	})
+
+	http.Handle("/fn/", ws.compress("/fn/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		var err error
 		var errCode = 400
 		defer func() {
 			if err != nil {
+				if errCode == 0 {
+					errCode = http.StatusInternalServerError
+				}
 				ws.log.Logf("ERROR:%s,code:%d", err.Error(), errCode)
 				http.Error(w, err.Error(), errCode)
 			}
 		}()
 
-		/*		if r.Method == "GET" {
-					fmt.Printf("processing Get:%s\n", r.URL.Path)
-
-					http.Redirect(w, r, "/static", http.StatusSeeOther)
-				}
-		*/
-		body, err := ioutil.ReadAll(r.Body)
+		c, errCode, err := ws.authenticate(r)
 		if err != nil {
-			errCode, err = mkErr("unable to read body", 500)
 			return
 		}
-		ws.log.Logf("processing req:%s\n  Body:%v\n", r.URL.Path, string(body))
-
 		path := strings.Split(r.URL.Path, "/")
+		if len(path) < 4 {
+			errCode, err = mkErr("expected /fn/<zome>/<function>", http.StatusNotFound)
+			return
+		}
 
 		zome := path[2]
 		function := path[3]
-		args := string(body)
-		result, err := ws.call(zome, function, args)
+		if errCode, err = ws.authorize(c, zome, function); err != nil {
+			return
+		}
+		z, err := ws.h.GetZome(zome)
+		if err != nil {
+			errCode = 404
+			return
+		}
+		fn, err := z.GetFunctionDef(function)
+		if err != nil {
+			errCode = 404
+			return
+		}
+		if (r.Method == "GET" || r.Method == "HEAD") && !fn.ReadOnly {
+			w.Header().Set("Allow", "POST")
+			errCode, err = mkErr("only functions declared ReadOnly can be called with GET", http.StatusMethodNotAllowed)
+			return
+		}
+		contentType, err := resultContentType(fn, r.Header.Get("Accept"))
+		if err != nil {
+			errCode = http.StatusNotAcceptable
+			return
+		}
+
+		// GETs take the argument from the query parameters and POSTs from the body
+		var args string
+		if r.Method == "GET" || r.Method == "HEAD" {
+			if args, err = queryArgs(fn, r.URL.Query()); err != nil {
+				errCode = http.StatusBadRequest
+				return
+			}
+		} else {
+			body, e := ioutil.ReadAll(r.Body)
+			if e != nil {
+				errCode, err = mkErr("unable to read body", 500)
+				return
+			}
+			args = string(body)
+		}
+		ws.log.Logf("processing req:%s\n  Args:%v\n", r.URL.Path, args)
+
+		result, cancel, err := ws.stream(r.Context(), zome, function, args)
+		if err != nil {
+			errCode = callErrorCode(err)
+			return
+		}
+		defer cancel()
+		defer result.Close()
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Add("Vary", "Accept")
+
+		// flush each chunk of the result as it arrives so large results are streamed
+		written, err := copyChunks(result, func(chunk []byte) (e error) {
+			_, e = w.Write(chunk)
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return
+		})
 		if err != nil {
 			ws.log.Logf("call of %s:%s resulted in error: %v\n", zome, function, err)
-			http.Error(w, err.Error(), 500)
+			if !written {
+				errCode = callErrorCode(err)
+				return
+			}
+			// the status has already been sent so all we can do is end the response
+			err = nil
+		}
+	}))) // set router
+
+	// /task/ lists background tasks and /task/<id> returns the status of one
+	http.Handle("/task/", ws.compress("/task/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, code, err := ws.authenticate(r); err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/task/")
+		var result interface{}
+		if id == "" {
+			result = ws.h.Tasks().List()
+		} else {
+			task, err := ws.h.Tasks().Get(id)
+			if err != nil {
+				http.Error(w, err.Error(), 404)
+				return
+			}
+			result = task
+		}
+		ws.writeJSON(w, result)
+	})))
 
+	// /entry/<hash> returns an entry and its type, with its hash as the ETag
+	http.Handle("/entry/", ws.compress("/entry/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, code, err := ws.authenticate(r); err != nil {
+			http.Error(w, err.Error(), code)
 			return
 		}
-		ws.log.Logf(" result: %v\n", result)
-		switch t := result.(type) {
-		case string:
-			fmt.Fprintf(w, t)
-		case []byte:
-			fmt.Fprintf(w, string(t))
-		default:
-			err = fmt.Errorf("Unknown type from Call of %s:%s", zome, function)
+		hash, err := holo.NewHash(strings.TrimPrefix(r.URL.Path, "/entry/"))
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
 		}
-	}) // set router
+		// get before checking the ETag so deleted entries aren't reported as unchanged
+		req := holo.GetReq{H: hash, StatusMask: holo.StatusDefault, GetMask: holo.GetMaskEntry | holo.GetMaskEntryType}
+		resp, err := holo.NewGetAction(req, &holo.GetOptions{GetMask: req.GetMask}).Do(ws.h)
+		if err != nil {
+			http.Error(w, err.Error(), errorCode(err))
+			return
+		}
+		getResp := resp.(holo.GetResp)
+		// modified entries are followed, so tag what was actually found
+		hash, err = getResp.Entry.Sum(ws.h.HashSpec())
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if notModified(w, r, hashETag(hash.String())) {
+			return
+		}
+		ws.writeJSON(w, map[string]interface{}{"Entry": getResp.Entry.Content(), "EntryType": getResp.EntryType})
+	})))
+
+	ws.handleAdmin()
+	ws.handleSessions()
+	ws.handleAuth()
+
+	// /healthz and /readyz report the holochain's health checks for process supervisors,
+	// failing with 503 when any of them fail
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		ws.health(w, false)
+	})
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ws.health(w, true)
+	})
+
 	ws.log.Logf("starting server on localhost:%s\n", ws.port)
 	err := http.ListenAndServe(":"+ws.port, nil) // set listen port
 	if err != nil {
@@ -136,17 +444,91 @@ func (ws *WebServer) Start() {
 	}
 }
 
+// health writes the results of the holochain's liveness or readiness checks
+func (ws *WebServer) health(w http.ResponseWriter, ready bool) {
+	checks, ok := ws.h.Health(ready)
+	w.Header().Set("Cache-Control", "no-store")
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	ws.writeJSON(w, checks)
+}
+
+// writeJSON writes v to the response as JSON
+func (ws *WebServer) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		ws.errs.Log(err)
+	}
+}
+
 func mkErr(etext string, code int) (int, error) {
 	return code, errors.New(etext)
 }
 
-func (ws *WebServer) call(zome string, function string, args string) (result interface{}, err error) {
+// errorCode returns the HTTP status for an error from the holochain
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, holo.ErrHashNotFound), errors.Is(err, holo.ErrHashDeleted), errors.Is(err, holo.ErrHashModified),
+		errors.Is(err, holo.ErrHashRejected), errors.Is(err, holo.ErrHashExpired), errors.Is(err, holo.ErrLinkNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, holo.ErrValidationFailed):
+		return http.StatusBadRequest
+	case errors.Is(err, holo.ErrUnauthorized):
+		return http.StatusForbidden
+	case errors.Is(err, holo.ErrTimeout):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
 
-	ws.log.Logf("calling %s:%s(%s)\n", zome, function, args)
-	result, err = ws.h.Call(zome, function, args, holo.PUBLIC_EXPOSURE)
+// callErrorCode returns the HTTP status for an error from a zome call, where the errors
+// errorCode doesn't recognise come from the app and are reported as bad requests
+func callErrorCode(err error) (code int) {
+	code = errorCode(err)
+	if code == http.StatusInternalServerError {
+		code = http.StatusBadRequest
+	}
+	return
+}
+
+// stream starts a call returning a reader of its result chunks, and the function that
+// releases the call's context once the reader is finished with
+func (ws *WebServer) stream(ctx context.Context, zome string, function string, args string) (result io.ReadCloser, cancel context.CancelFunc, err error) {
 
+	ws.log.Logf("calling %s:%s(%s)\n", zome, function, args)
+	if ws.CallTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, ws.CallTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	result, err = ws.h.CallStream(ctx, zome, function, args, holo.PUBLIC_EXPOSURE)
 	if err != nil {
-		_, err = mkErr(err.Error(), 400)
+		cancel()
 	}
 	return
 }
+
+// copyChunks passes each chunk read from r to write until r is done, returning whether
+// anything was written and the error that ended the copy, if any
+func copyChunks(r io.Reader, write func([]byte) error) (written bool, err error) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, e := r.Read(buf)
+		if n > 0 {
+			if err = write(buf[:n]); err != nil {
+				return
+			}
+			written = true
+		}
+		if e == io.EOF {
+			return
+		}
+		if e != nil {
+			err = e
+			return
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package ui
 
 import (
+	"encoding/json"
+	websocket "github.com/gorilla/websocket"
 	. "github.com/metacurrency/holochain"
 	. "github.com/smartystreets/goconvey/convey"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -18,7 +21,9 @@ func TestMain(m *testing.M) {
 func TestWebServer(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestDir(d)
-	go NewWebServer(h, "31415").Start()
+	ws := NewWebServer(h, "31415")
+	ws.CallTimeout = 500 * time.Millisecond
+	go ws.Start()
 	time.Sleep(time.Second * 1)
 	Convey("it should should get nothing", t, func() {
 		resp, err := http.Get("http://0.0.0.0:31415")
@@ -29,4 +34,438 @@ func TestWebServer(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(string(b), ShouldEqual, SampleHTML)
 	})
+
+	Convey("it should return 504 when a call times out", t, func() {
+		zome, _ := h.GetZome("jsSampleZome")
+		zome.Code += `function spin(x){while(true){}}`
+		zome.Functions = append(zome.Functions, FunctionDef{Name: "spin", CallingType: STRING_CALLING, Exposure: PUBLIC_EXPOSURE})
+		h.Nucleus().DNA().Zomes[1] = *zome
+
+		resp, err := http.Post("http://0.0.0.0:31415/fn/jsSampleZome/spin", "text/plain", nil)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusGatewayTimeout)
+	})
+
+	Convey("it should return task status", t, func() {
+		id, err := h.Tasks().Spawn("jsSampleZome", "testStrFn1", "foo")
+		So(err, ShouldBeNil)
+		time.Sleep(time.Millisecond * 100)
+		resp, err := http.Get("http://0.0.0.0:31415/task/" + id)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		var task Task
+		err = json.NewDecoder(resp.Body).Decode(&task)
+		So(err, ShouldBeNil)
+		So(task.ID, ShouldEqual, id)
+		So(task.Status, ShouldEqual, TaskDone)
+		So(task.Result, ShouldEqual, "result: foo")
+
+		resp, err = http.Get("http://0.0.0.0:31415/task/bogus")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 404)
+	})
+
+	Convey("it should get entries with ETags", t, func() {
+		hash, err := h.Call("zySampleZome", "addEven", "2", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		resp, err := http.Get("http://0.0.0.0:31415/entry/" + hash.(string))
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+		etag := resp.Header.Get("ETag")
+		So(etag, ShouldEqual, `"`+hash.(string)+`"`)
+		var entry map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&entry)
+		So(err, ShouldBeNil)
+		So(entry["Entry"], ShouldEqual, "2")
+		So(entry["EntryType"], ShouldEqual, "evenNumbers")
+
+		req, _ := http.NewRequest("GET", "http://0.0.0.0:31415/entry/"+hash.(string), nil)
+		req.Header.Set("If-None-Match", etag)
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotModified)
+
+		resp, err = http.Get("http://0.0.0.0:31415/entry/QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 404)
+	})
+
+	Convey("it should serve the admin api and UI", t, func() {
+		resp, err := http.Get("http://127.0.0.1:31415/admin/api/chain")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		var items []ChainItem
+		err = json.NewDecoder(resp.Body).Decode(&items)
+		So(err, ShouldBeNil)
+		So(len(items), ShouldEqual, h.Chain().Length())
+		So(items[len(items)-1].Type, ShouldEqual, DNAEntryType)
+		So(items[len(items)-1].Entry, ShouldBeNil)
+
+		resp, err = http.Get("http://127.0.0.1:31415/admin/api/dht")
+		So(err, ShouldBeNil)
+		var stats DHTStats
+		err = json.NewDecoder(resp.Body).Decode(&stats)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(stats.Puts, ShouldBeGreaterThan, 0)
+
+		resp, err = http.Get("http://127.0.0.1:31415/admin/api/logs?n=5")
+		So(err, ShouldBeNil)
+		var records []LogRecord
+		err = json.NewDecoder(resp.Body).Decode(&records)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(len(records), ShouldBeLessThanOrEqualTo, 5)
+
+		resp, err = http.Get("http://127.0.0.1:31415/admin/ui/")
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, "<title>Holochain Admin</title>")
+	})
+
+	Convey("it should list the pinned hashes", t, func() {
+		So(h.DHT().Pin(h.AgentHash()), ShouldBeNil)
+		resp, err := http.Get("http://127.0.0.1:31415/admin/api/pins")
+		So(err, ShouldBeNil)
+		var pins []Pin
+		err = json.NewDecoder(resp.Body).Decode(&pins)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(len(pins), ShouldEqual, 1)
+		So(pins[0].Hash, ShouldEqual, h.AgentHash().String())
+		So(h.DHT().Unpin(h.AgentHash()), ShouldBeNil)
+	})
+
+	Convey("it should return the metrics history", t, func() {
+		resp, err := http.Get("http://127.0.0.1:31415/admin/api/metrics?since=2017-01-01T00:00:00Z")
+		So(err, ShouldBeNil)
+		var history []MetricsSnapshot
+		err = json.NewDecoder(resp.Body).Decode(&history)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(history, ShouldNotBeNil)
+
+		resp, err = http.Get("http://127.0.0.1:31415/admin/api/metrics?since=yesterday")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+	})
+
+	Convey("it should explore the DHT", t, func() {
+		resp, err := http.Get("http://127.0.0.1:31415/admin/api/dht/hashes?type=" + AgentEntryType)
+		So(err, ShouldBeNil)
+		var hashes []string
+		err = json.NewDecoder(resp.Body).Decode(&hashes)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(hashes, ShouldResemble, []string{h.AgentHash().String()})
+
+		resp, err = http.Get("http://127.0.0.1:31415/admin/api/dht/entry/" + h.AgentHash().String())
+		So(err, ShouldBeNil)
+		var record DHTRecord
+		err = json.NewDecoder(resp.Body).Decode(&record)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(record.EntryType, ShouldEqual, AgentEntryType)
+		So(record.Status, ShouldEqual, StatusLive)
+
+		resp, err = http.Get("http://127.0.0.1:31415/admin/api/dht/entry/QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 404)
+
+		ws.AdminToken = "secret"
+		defer func() { ws.AdminToken = "" }()
+		resp, err = http.Get("http://127.0.0.1:31415/admin/api/dht/hashes")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+
+		req, _ := http.NewRequest("GET", "http://127.0.0.1:31415/admin/api/dht/hashes", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+	})
+
+	Convey("it should stream filtered logs over a websocket", t, func() {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:31415/admin/logs", nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		err = conn.WriteJSON(LogFilter{Level: LogLevelWarn, Subsystems: []string{"app"}})
+		So(err, ShouldBeNil)
+		time.Sleep(time.Millisecond * 100)
+
+		l := Logger{Enabled: true}
+		l.New(ioutil.Discard)
+		l.SetRecorder(h.Logs(), "app", LogLevelInfo)
+		l.Log("not sent")
+		l.Log("warning: sent")
+
+		var rec LogRecord
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		err = conn.ReadJSON(&rec)
+		So(err, ShouldBeNil)
+		So(rec.Message, ShouldEqual, "warning: sent")
+		So(rec.Level, ShouldEqual, LogLevelWarn)
+
+		_, resp, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:31415/admin/logs", http.Header{"Origin": {"https://example.com"}})
+		So(err, ShouldNotBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+	})
+
+	Convey("it should only call functions declared read-only with GET", t, func() {
+		resp, err := http.Get("http://127.0.0.1:31415/fn/zySampleZome/addEven?arg=8")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+		So(resp.Header.Get("Allow"), ShouldEqual, "POST")
+
+		req, _ := http.NewRequest("HEAD", "http://127.0.0.1:31415/fn/zySampleZome/addPrime?prime=7", nil)
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+	})
+
+	Convey("it should call functions with GET, mapping the query to the argument", t, func() {
+		// the test functions commit, so are only declared read-only to test the mapping
+		fns := h.Nucleus().DNA().Zomes[0].Functions
+		for i := range fns {
+			fns[i].ReadOnly = true
+		}
+		defer func() {
+			for i := range fns {
+				fns[i].ReadOnly = false
+			}
+		}()
+
+		resp, err := http.Get("http://127.0.0.1:31415/fn/zySampleZome/addEven?arg=8")
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(resp.Header.Get("Content-Type"), ShouldStartWith, "text/plain")
+		So(string(b), ShouldStartWith, "Qm")
+
+		resp, err = http.Get("http://127.0.0.1:31415/fn/zySampleZome/addPrime?prime=7")
+		So(err, ShouldBeNil)
+		b, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/json")
+		So(string(b), ShouldStartWith, `"Qm`)
+
+		req, _ := http.NewRequest("GET", "http://127.0.0.1:31415/fn/zySampleZome/addEven?arg=10", nil)
+		req.Header.Set("Accept", "application/json")
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusNotAcceptable)
+
+		resp, err = http.Get("http://127.0.0.1:31415/fn/zySampleZome/noSuchFn")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 404)
+
+		resp, err = http.Get("http://127.0.0.1:31415/fn/zySampleZome")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 404)
+
+		// errors from the app are the caller's
+		resp, err = http.Post("http://127.0.0.1:31415/fn/jsSampleZome/testJsonFn1", "application/json", strings.NewReader("bad json"))
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("it should require capability tokens when they are configured", t, func() {
+		ws.CapabilityTokens = true
+		defer func() { ws.CapabilityTokens = false }()
+
+		resp, err := http.Post("http://127.0.0.1:31415/fn/zySampleZome/addEven", "text/plain", strings.NewReader("12"))
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+
+		resp, err = http.Post("http://127.0.0.1:31415/auth", "application/json", strings.NewReader(`{"Functions":["zySampleZome/noSuchFn"]}`))
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+
+		resp, err = http.Post("http://127.0.0.1:31415/auth", "application/json", strings.NewReader(`{"Functions":["zySampleZome/addEven"]}`))
+		So(err, ShouldBeNil)
+		var token CapabilityToken
+		err = json.NewDecoder(resp.Body).Decode(&token)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(token.Token, ShouldNotEqual, "")
+
+		req, _ := http.NewRequest("POST", "http://127.0.0.1:31415/fn/zySampleZome/addEven", strings.NewReader("12"))
+		req.Header.Set(CapabilityHeader, token.Token)
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+
+		req, _ = http.NewRequest("POST", "http://127.0.0.1:31415/fn/jsSampleZome/addOdd", strings.NewReader("13"))
+		req.Header.Set(CapabilityHeader, token.Token)
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+
+		resp, err = http.Get("http://127.0.0.1:31415/entry/" + h.DNAHash().String())
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+
+		resp, err = http.Get("http://127.0.0.1:31415/_events")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+	})
+
+	Convey("it should require api keys when they are configured", t, func() {
+		ws.APIKeys = []APIKey{{Name: "app", Key: "secret", Write: true, Functions: []string{"zySampleZome/*"}}}
+		defer func() { ws.APIKeys = nil }()
+
+		resp, err := http.Post("http://127.0.0.1:31415/fn/zySampleZome/addEven", "text/plain", strings.NewReader("4"))
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+
+		req, _ := http.NewRequest("POST", "http://127.0.0.1:31415/fn/jsSampleZome/addOdd", strings.NewReader("3"))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+
+		req, _ = http.NewRequest("POST", "http://127.0.0.1:31415/fn/zySampleZome/addEven", strings.NewReader("4"))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(string(b), ShouldStartWith, "Qm")
+	})
+
+	Convey("it should support CSRF protected cookie sessions", t, func() {
+		ws.APIKeys = []APIKey{{Name: "app", Key: "secret", Write: true, Functions: []string{"zySampleZome/*"}}}
+		ws.CookieSessions = true
+		defer func() { ws.APIKeys = nil; ws.CookieSessions = false }()
+
+		req, _ := http.NewRequest("POST", "http://127.0.0.1:31415/_session", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		var info SessionInfo
+		err = json.NewDecoder(resp.Body).Decode(&info)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(info.CSRFToken, ShouldNotEqual, "")
+		cookies := resp.Cookies()
+		So(len(cookies), ShouldEqual, 1)
+		So(cookies[0].Name, ShouldEqual, SessionCookieName)
+		So(cookies[0].HttpOnly, ShouldBeTrue)
+
+		req, _ = http.NewRequest("POST", "http://127.0.0.1:31415/fn/zySampleZome/addEven", strings.NewReader("6"))
+		req.AddCookie(cookies[0])
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+
+		req, _ = http.NewRequest("POST", "http://127.0.0.1:31415/fn/zySampleZome/addEven", strings.NewReader("6"))
+		req.AddCookie(cookies[0])
+		req.Header.Set(CSRFHeader, info.CSRFToken)
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+	})
+
+	Convey("it should report health and readiness", t, func() {
+		resp, err := http.Get("http://127.0.0.1:31415/healthz")
+		So(err, ShouldBeNil)
+		var checks []HealthCheck
+		err = json.NewDecoder(resp.Body).Decode(&checks)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(checks), ShouldEqual, 2)
+
+		// gossip isn't running in the test
+		resp, err = http.Get("http://127.0.0.1:31415/readyz")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+	})
+
+	Convey("it should report the app's resource usage", t, func() {
+		resp, err := http.Get("http://127.0.0.1:31415/admin/api/usage")
+		So(err, ShouldBeNil)
+		var usage AppUsage
+		err = json.NewDecoder(resp.Body).Decode(&usage)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(usage.DNA, ShouldEqual, h.DNAHash().String())
+		So(usage.VMExecutions, ShouldBeGreaterThan, 0)
+		So(usage.DHTBytes, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("it should stream the holochain's events", t, func() {
+		resp, err := http.Get("http://127.0.0.1:31415/_events?types=Fish")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:31415/_events?types=EntryCommitted", nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		// let the subscription be made before committing
+		time.Sleep(100 * time.Millisecond)
+		hash, err := h.Call("jsSampleZome", "addOdd", "7", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		var e struct {
+			Type string
+			Hash string
+		}
+		So(conn.ReadJSON(&e), ShouldBeNil)
+		So(e.Type, ShouldEqual, "EntryCommitted")
+		So(e.Hash, ShouldEqual, hash)
+	})
+
+	Convey("it should push subscribed signals on the socket", t, func() {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:31415/_sock/", nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(conn.WriteJSON(map[string]string{"signals": "newMessage"}), ShouldBeNil)
+		// let the subscription be made before emitting
+		time.Sleep(100 * time.Millisecond)
+		So(h.Emit("jsSampleZome", "typing", "alice"), ShouldBeNil)
+		So(h.Emit("jsSampleZome", "newMessage", `{"text":"hi"}`), ShouldBeNil)
+		var m struct {
+			Signal  string `json:"signal"`
+			Zome    string `json:"zome"`
+			Payload struct {
+				Text string `json:"text"`
+			} `json:"payload"`
+		}
+		So(conn.ReadJSON(&m), ShouldBeNil)
+		So(m.Signal, ShouldEqual, "newMessage")
+		So(m.Zome, ShouldEqual, "jsSampleZome")
+		So(m.Payload.Text, ShouldEqual, "hi")
+	})
 }
@@ -0,0 +1,68 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// usage implements accounting of the resources used by a holochain, so that operators
+// of nodes hosting several apps can see which is using what
+
+package holochain
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Usage is the resources a holochain has used since it was loaded
+type Usage struct {
+	VMTime        time.Duration // time spent running zome code, in calls and validation
+	VMExecutions  int64         // number of zome function calls and validations run
+	DHTBytes      int64         // bytes of entry data held in the DHT store
+	DHTQuota      int64         // bytes of entry data the DHT store may hold, 0 for no limit
+	BytesSent     int64         // bytes sent to other nodes
+	BytesReceived int64         // bytes received from other nodes
+	// messages sent to and received from other nodes, not counting responses
+	MessagesSent     int64
+	MessagesReceived int64
+}
+
+// usageCounters are updated atomically so must be kept 64 bit aligned
+type usageCounters struct {
+	vmNanos      int64
+	vmExecutions int64
+}
+
+// recordVM accounts for a ribosome execution that began at start
+func (h *Holochain) recordVM(start time.Time) {
+	atomic.AddInt64(&h.usage.vmNanos, int64(time.Since(start)))
+	atomic.AddInt64(&h.usage.vmExecutions, 1)
+}
+
+// Usage returns the resources the holochain has used
+func (h *Holochain) Usage() (u Usage) {
+	u.VMTime = time.Duration(atomic.LoadInt64(&h.usage.vmNanos))
+	u.VMExecutions = atomic.LoadInt64(&h.usage.vmExecutions)
+	if h.dht != nil {
+		u.DHTBytes = atomic.LoadInt64(&h.dht.storedBytes)
+	}
+	u.DHTQuota = h.config.DHTQuota
+	if h.node != nil {
+		u.BytesSent = atomic.LoadInt64(&h.node.bytesSent)
+		u.BytesReceived = atomic.LoadInt64(&h.node.bytesReceived)
+		u.MessagesSent = atomic.LoadInt64(&h.node.messagesSent)
+		u.MessagesReceived = atomic.LoadInt64(&h.node.messagesReceived)
+	}
+	return
+}
+
+// countingReader adds the number of bytes read through it to n
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return
+}
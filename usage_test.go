@@ -0,0 +1,64 @@
+package holochain
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
+	"io/ioutil"
+	"testing"
+)
+
+func TestUsage(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("it should account for zome calls", t, func() {
+		before := h.Usage()
+		_, err := h.Call("zySampleZome", "testStrFn1", "foo", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		after := h.Usage()
+		So(after.VMExecutions, ShouldEqual, before.VMExecutions+1)
+		So(after.VMTime, ShouldBeGreaterThan, before.VMTime)
+	})
+
+	Convey("it should account for DHT storage", t, func() {
+		n, err := h.dht.countStoredBytes()
+		So(err, ShouldBeNil)
+		So(h.Usage().DHTBytes, ShouldEqual, n)
+
+		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		err = h.dht.put(nil, "someType", hash, h.nodeID, []byte("12345"), StatusLive)
+		So(err, ShouldBeNil)
+		So(h.Usage().DHTBytes, ShouldEqual, n+5)
+
+		// replacing a value only accounts for the difference
+		err = h.dht.put(nil, "someType", hash, h.nodeID, []byte("123"), StatusLive)
+		So(err, ShouldBeNil)
+		So(h.Usage().DHTBytes, ShouldEqual, n+3)
+	})
+
+	Convey("refetching a corrupt record should account for the difference", t, func() {
+		hash := commit(h, "evenNumbers", "2")
+		err := h.dht.db.Update(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set("entry:"+hash.String(), "a much longer damaged value", nil)
+			return err
+		})
+		So(err, ShouldBeNil)
+		// as when the store is opened with the damage
+		h.dht.storedBytes, err = h.dht.countStoredBytes()
+		So(err, ShouldBeNil)
+
+		So(h.dht.refetch(hash), ShouldBeNil)
+		n, err := h.dht.countStoredBytes()
+		So(err, ShouldBeNil)
+		So(h.Usage().DHTBytes, ShouldEqual, n)
+	})
+
+	Convey("counting readers should count", t, func() {
+		var n int64
+		b, err := ioutil.ReadAll(countingReader{bytes.NewBufferString("hello"), &n})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "hello")
+		So(n, ShouldEqual, 5)
+	})
+}
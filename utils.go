@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 const (
@@ -261,15 +262,38 @@ func Decode(reader io.Reader, format string, data interface{}) (err error) {
 	return
 }
 
+// maxPooledBufferSize is the largest buffer returned to the pool, so that a
+// single large message doesn't keep its memory pinned
+const maxPooledBufferSize = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer resets a buffer and returns it to the pool
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
 // ByteEncoder encodes anything using gob
 func ByteEncoder(data interface{}) (b []byte, err error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	enc := gob.NewEncoder(buf)
 	err = enc.Encode(data)
 	if err != nil {
 		return
 	}
-	b = buf.Bytes()
+	b = append([]byte(nil), buf.Bytes()...)
 	return
 }
 
@@ -49,3 +49,26 @@ func TestUtilsEncodeDecode(t *testing.T) {
 		So(data.B, ShouldEqual, data1.B)
 	})
 }
+
+func TestByteEncoderPooledBuffers(t *testing.T) {
+	Convey("encoded bytes should not be shared with pooled buffers", t, func() {
+		b1, err := ByteEncoder("fish")
+		So(err, ShouldBeNil)
+		saved := append([]byte(nil), b1...)
+		b2, err := ByteEncoder("something much longer than fish")
+		So(err, ShouldBeNil)
+		So(b1, ShouldResemble, saved)
+		var s string
+		err = ByteDecoder(b2, &s)
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, "something much longer than fish")
+	})
+	Convey("large buffers should not be returned to the pool", t, func() {
+		buf := getBuffer()
+		buf.Grow(maxPooledBufferSize + 1)
+		putBuffer(buf)
+		buf = getBuffer()
+		So(buf.Len(), ShouldEqual, 0)
+		putBuffer(buf)
+	})
+}
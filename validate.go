@@ -8,13 +8,31 @@
 package holochain
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
 )
 
 // Package holds app specified data needed for validation (wire package)
 type Package struct {
 	Chain []byte
+
+	// Size and ID are set instead of Chain for packages larger than
+	// ValidationPackageChunkSize, whose chunks the receiver then fetches one at a time
+	Size int64
+	ID   string
+
+	// spool holds a chunked package once it has been fetched
+	spool *os.File
 }
 
 // ValidationPackage holds app specified data needed for validation. This version
@@ -22,6 +40,45 @@ type Package struct {
 // into the app for app level validation
 type ValidationPackage struct {
 	Chain *Chain
+	Rate  *ChainRate
+}
+
+// ValidatorProps describes the node doing a validation.  It is added to the package
+// passed to validation functions as Validator, so that rules like "only the author may
+// modify" can be checked without calling get().
+type ValidatorProps struct {
+	Agent      string            // the hash of the validator's agent entry
+	Key        string            // the validator's node id, which is its public key
+	ChainHead  string            // the hash of the header at the top of its chain, if any
+	Properties map[string]string // the DNA's properties
+}
+
+// validatorProps returns the props of this node for validation functions
+func (h *Holochain) validatorProps() (p *ValidatorProps) {
+	p = &ValidatorProps{
+		Agent:      h.agentHash.String(),
+		Key:        h.nodeIDStr,
+		Properties: h.nucleus.dna.Properties,
+	}
+	// the chain is empty while its genesis entries are validated
+	if h.chain != nil && len(h.chain.Hashes) > 0 {
+		top, _ := h.Top()
+		p.ChainHead = top.String()
+	}
+	if p.Properties == nil {
+		p.Properties = map[string]string{}
+	}
+	return
+}
+
+// ChainRate counts the entries of each type an agent committed before the entry being
+// validated.  It is computed from the headers of the entry and those before it, never
+// from the current time, so all validators get the same counts.
+type ChainRate struct {
+	Minutes   int            // the window of time counted in InMinutes
+	Headers   int            // the number of headers counted in InHeaders
+	InMinutes map[string]int // entries of each type committed within Minutes of the entry
+	InHeaders map[string]int // entries of each type among the previous Headers headers
 }
 
 const (
@@ -36,6 +93,11 @@ const (
 	// the chain to
 	PkgReqEntryTypes = "types"
 
+	// PkgReqRate is the key whose value is an object with Minutes and/or Headers
+	// fields requesting a ChainRate in the validation package.  It implies the
+	// chain's headers are sent if PkgReqChain isn't given.
+	PkgReqRate = "rate"
+
 	// Constant mask values for PkgReqChain key of the validation request object
 
 	PkgReqChainOptNone       = 0x00
@@ -48,6 +110,35 @@ const (
 	PkgReqChainOptFullStr    = "3"
 )
 
+const (
+	// ValidationPackageChunkSize is both the size above which packages are sent in
+	// chunks and the size of those chunks
+	ValidationPackageChunkSize = 256 * 1024
+
+	// MaxValidationPackageSize is the largest chunked package that will be fetched
+	MaxValidationPackageSize = 1 << 30
+
+	// ValidationPackageTTL is how long a chunked package is kept for fetching
+	ValidationPackageTTL = time.Minute
+
+	// MaxSpooledPackageBytes is the most space the chunked packages offered by this
+	// node may take up, past which validate requests that need one are refused until
+	// others have been fetched or have expired
+	MaxSpooledPackageBytes = 2 * MaxValidationPackageSize
+
+	// MaxConcurrentPackageFetches is how many chunked packages this node fetches and
+	// holds for validation at once, further validations waiting their turn
+	MaxConcurrentPackageFetches = 2
+)
+
+var ErrPackageTooLarge = errors.New("validation package too large")
+var ErrPackageNotFound = errors.New("validation package not found")
+var ErrPackageStoreFull = errors.New("too many validation packages waiting to be fetched")
+
+// packageFetches holds a slot for each chunked package being fetched or held
+var packageFetches = make(chan struct{}, MaxConcurrentPackageFetches)
+var ErrBadRateReq = errors.New("rate request must be an object with Minutes and/or Headers")
+
 // PackagingReq holds a request from an app for data to be included in the validation response
 type PackagingReq map[string]interface{}
 
@@ -56,6 +147,17 @@ type ValidateQuery struct {
 	H Hash
 }
 
+// ValidatePackageQuery requests the chunk of a package starting at Offset
+type ValidatePackageQuery struct {
+	ID     string
+	Offset int64
+}
+
+// ValidatePackageChunk holds a chunk of a package
+type ValidatePackageChunk struct {
+	Data []byte
+}
+
 // ValidateResponse holds the response to committing validates (PUT/MOD/DEL)
 type ValidateResponse struct {
 	Type    string
@@ -68,9 +170,18 @@ type ValidateResponse struct {
 // this is the package that gets sent over the wire.  Chain DNA is omitted in this package
 // because it can be added at the destination and the chain will still validate.
 func MakePackage(h *Holochain, req PackagingReq) (pkg Package, err error) {
-	if f, ok := req[PkgReqChain]; ok {
-		var b bytes.Buffer
-		flags := f.(int64)
+	f, ok := req[PkgReqChain]
+	_, rate := req[PkgReqRate]
+	if ok || rate {
+		s := spoolWriter{limit: ValidationPackageChunkSize, max: MaxValidationPackageSize}
+		var flags int64
+		if ok {
+			flags = f.(int64)
+		}
+		// the chain rate is counted from the headers
+		if rate {
+			flags |= PkgReqChainOptHeaders
+		}
 		var mflags int64
 		if (flags & PkgReqChainOptHeaders) == 0 {
 			mflags += ChainMarshalFlagsNoHeaders
@@ -83,8 +194,20 @@ func MakePackage(h *Holochain, req PackagingReq) (pkg Package, err error) {
 		if t, ok := req[PkgReqEntryTypes]; ok {
 			types = t.([]string)
 		}
-		h.chain.MarshalChain(&b, mflags+ChainMarshalFlagsOmitDNA, types...)
-		pkg.Chain = b.Bytes()
+		err = h.chain.MarshalChain(&s, mflags+ChainMarshalFlagsOmitDNA, types...)
+		if err != nil {
+			s.discard()
+			return
+		}
+		if s.f == nil {
+			pkg.Chain = s.buf.Bytes()
+		} else {
+			pkg.Size = s.size
+			pkg.ID, err = h.packages.add(s.f, s.size)
+			if err != nil {
+				s.discard()
+			}
+		}
 	}
 	return
 }
@@ -93,16 +216,30 @@ func MakePackage(h *Holochain, req PackagingReq) (pkg Package, err error) {
 // any chain data that was included
 func MakeValidationPackage(h *Holochain, pkg *Package) (vpkg *ValidationPackage, err error) {
 	vp := ValidationPackage{}
-	if (pkg != nil) && (pkg.Chain != nil) {
-		buf := bytes.NewBuffer(pkg.Chain)
+	if (pkg != nil) && (pkg.Chain != nil || pkg.spool != nil) {
+		var r io.Reader
+		if pkg.spool != nil {
+			_, err = pkg.spool.Seek(0, io.SeekStart)
+			if err != nil {
+				return
+			}
+			r = bufio.NewReader(pkg.spool)
+		} else {
+			r = bytes.NewBuffer(pkg.Chain)
+		}
 		var flags int64
-		flags, vp.Chain, err = UnmarshalChain(h.hashSpec, buf)
+		flags, vp.Chain, err = UnmarshalChain(h.hashSpec, r)
 		if err != nil {
 			return
 		}
 		if flags&ChainMarshalFlagsNoEntries == 0 {
 			// restore the chain's DNA data
-			vp.Chain.Entries[0].(*GobEntry).C = h.chain.Entries[0].(*GobEntry).C
+			var dna Entry
+			dna, err = h.chain.Entry(0)
+			if err != nil {
+				return
+			}
+			vp.Chain.Entries[0].(*GobEntry).C = dna.(*GobEntry).C
 		}
 		if flags&ChainMarshalFlagsNoHeaders == 0 {
 			err = vp.Chain.Validate(flags&ChainMarshalFlagsNoEntries != 0)
@@ -115,6 +252,53 @@ func MakeValidationPackage(h *Holochain, pkg *Package) (vpkg *ValidationPackage,
 	return
 }
 
+// parseRateReq returns the windows of a PkgReqRate value
+func parseRateReq(v interface{}) (minutes int, headers int, err error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		err = ErrBadRateReq
+		return
+	}
+	for k, n := range map[string]*int{"Minutes": &minutes, "Headers": &headers} {
+		x, ok := m[k]
+		if !ok {
+			continue
+		}
+		if *n, ok = numInterfaceToInt(x); !ok || *n < 0 {
+			err = ErrBadRateReq
+			return
+		}
+	}
+	return
+}
+
+// countChainRate counts the headers before hd by type within the windows.  They are
+// found by their position along the chain back from the header hd links to, not by
+// their times, which the author chooses, so entries can't be hidden from the count by
+// giving them the same time as hd.
+func countChainRate(chain *Chain, hd *Header, minutes int, n int) (rate *ChainRate) {
+	rate = &ChainRate{Minutes: minutes, Headers: n, InMinutes: make(map[string]int), InHeaders: make(map[string]int)}
+	since := hd.Time.Add(-time.Duration(minutes) * time.Minute)
+	top, ok := chain.Hmap[hd.HeaderLink.String()]
+	if !ok {
+		return
+	}
+	seen := 0
+	for i := top; i >= 0; i-- {
+		prev := chain.Headers[i]
+		if seen < n {
+			rate.InHeaders[prev.Type]++
+			seen++
+		}
+		if prev.Time.After(since) {
+			rate.InMinutes[prev.Type]++
+		} else if seen >= n {
+			break
+		}
+	}
+	return
+}
+
 // ValidateReceiver handles messages on the Validate protocol
 func ValidateReceiver(h *Holochain, msg *Message) (response interface{}, err error) {
 	var a ValidatingAction
@@ -125,8 +309,29 @@ func ValidateReceiver(h *Holochain, msg *Message) (response interface{}, err err
 		a = &ActionMod{}
 	case VALIDATE_DEL_REQUEST:
 		a = &ActionDel{}
+	case VALIDATE_STATUS_REQUEST:
+		a = &ActionSetStatus{}
 	case VALIDATE_LINK_REQUEST:
 		a = &ActionLink{}
+	case VALIDATE_PACKAGE_REQUEST:
+		switch t := msg.Body.(type) {
+		case ValidatePackageQuery:
+			response, err = h.packages.read(t.ID, t.Offset)
+		default:
+			err = fmt.Errorf("expected ValidatePackageQuery got %T", t)
+		}
+		return
+	case VALIDATE_TRANSCRIPT_REQUEST:
+		switch t := msg.Body.(type) {
+		case ValidationTranscriptReq:
+			var tr ValidationTranscript
+			if tr, err = h.transcriptFor(msg.From, t.H); err == nil {
+				response = tr
+			}
+		default:
+			err = fmt.Errorf("expected ValidationTranscriptReq got %T", t)
+		}
+		return
 	default:
 		err = fmt.Errorf("message type %d not in holochain-validate protocol", int(msg.Type))
 	}
@@ -142,3 +347,198 @@ func ValidateReceiver(h *Holochain, msg *Message) (response interface{}, err err
 	h.dht.dlog.Logf("validate responding with: %T %v (err=%v)", response, response, err)
 	return
 }
+
+// spoolWriter buffers what is written to it in memory until there is more than limit,
+// after which it all goes to a temporary file, refusing to write more than max in all
+type spoolWriter struct {
+	buf   bytes.Buffer
+	f     *os.File
+	size  int64
+	limit int
+	max   int64
+}
+
+func (s *spoolWriter) Write(p []byte) (n int, err error) {
+	if s.max > 0 && s.size+int64(len(p)) > s.max {
+		err = ErrPackageTooLarge
+		return
+	}
+	if s.f == nil && s.buf.Len()+len(p) > s.limit {
+		s.f, err = ioutil.TempFile("", "hc-pkg")
+		if err != nil {
+			return
+		}
+		_, err = s.f.Write(s.buf.Bytes())
+		if err != nil {
+			return
+		}
+		s.buf = bytes.Buffer{}
+	}
+	if s.f != nil {
+		n, err = s.f.Write(p)
+	} else {
+		n, err = s.buf.Write(p)
+	}
+	s.size += int64(n)
+	return
+}
+
+// discard removes the temporary file if there is one
+func (s *spoolWriter) discard() {
+	if s.f != nil {
+		removeSpool(s.f)
+		s.f = nil
+	}
+}
+
+func removeSpool(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// spooledPackage is a chunked package waiting to be fetched
+type spooledPackage struct {
+	f       *os.File
+	size    int64
+	expires time.Time
+}
+
+// packageStore holds the chunked packages this node has offered in validate responses
+type packageStore struct {
+	lk    sync.Mutex
+	pkgs  map[string]*spooledPackage
+	bytes int64 // the total size of the packages
+}
+
+// add keeps the package in f for fetching, returning the ID to fetch it by, or
+// ErrPackageStoreFull if there's no room for it
+func (s *packageStore) add(f *os.File, size int64) (id string, err error) {
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.sweep()
+	if s.bytes+size > MaxSpooledPackageBytes {
+		err = ErrPackageStoreFull
+		return
+	}
+	id = hex.EncodeToString(b)
+	if s.pkgs == nil {
+		s.pkgs = make(map[string]*spooledPackage)
+	}
+	s.pkgs[id] = &spooledPackage{f: f, size: size, expires: time.Now().Add(ValidationPackageTTL)}
+	s.bytes += size
+	return
+}
+
+// remove forgets a package and removes its file, and must be called with the lock held
+func (s *packageStore) remove(id string) {
+	if p, ok := s.pkgs[id]; ok {
+		removeSpool(p.f)
+		s.bytes -= p.size
+		delete(s.pkgs, id)
+	}
+}
+
+// read returns the chunk of a package starting at offset, forgetting the package once
+// its last chunk has been read
+func (s *packageStore) read(id string, offset int64) (chunk ValidatePackageChunk, err error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.sweep()
+	p, ok := s.pkgs[id]
+	if !ok {
+		err = ErrPackageNotFound
+		return
+	}
+	if offset < 0 || offset >= p.size {
+		err = fmt.Errorf("offset %d out of range", offset)
+		return
+	}
+	n := p.size - offset
+	if n > ValidationPackageChunkSize {
+		n = ValidationPackageChunkSize
+	}
+	chunk.Data = make([]byte, n)
+	_, err = p.f.ReadAt(chunk.Data, offset)
+	if err != nil {
+		return
+	}
+	if offset+n == p.size {
+		s.remove(id)
+	} else {
+		p.expires = time.Now().Add(ValidationPackageTTL)
+	}
+	return
+}
+
+// sweep removes expired packages, and must be called with the lock held
+func (s *packageStore) sweep() {
+	now := time.Now()
+	for id, p := range s.pkgs {
+		if now.After(p.expires) {
+			s.remove(id)
+		}
+	}
+}
+
+// fetchPackage gets the chunks of a chunked package from source into a temporary file
+// which is left in pkg for MakeValidationPackage to read, and must be released with
+// releasePackage.  Only MaxConcurrentPackageFetches packages are fetched or held at
+// once, so it waits for one to be released if need be.
+func fetchPackage(h *Holochain, source peer.ID, pkg *Package) (err error) {
+	if pkg.Size > MaxValidationPackageSize {
+		err = ErrPackageTooLarge
+		return
+	}
+	packageFetches <- struct{}{}
+	f, err := ioutil.TempFile("", "hc-pkg")
+	if err != nil {
+		<-packageFetches
+		return
+	}
+	var offset int64
+	for offset < pkg.Size {
+		var r interface{}
+		r, err = h.Send(ValidateProtocol, source, VALIDATE_PACKAGE_REQUEST, ValidatePackageQuery{ID: pkg.ID, Offset: offset})
+		if err != nil {
+			break
+		}
+		chunk, ok := r.(ValidatePackageChunk)
+		if !ok {
+			err = fmt.Errorf("expected ValidatePackageChunk got %T", r)
+			break
+		}
+		if len(chunk.Data) == 0 || offset+int64(len(chunk.Data)) > pkg.Size {
+			err = fmt.Errorf("bad validation package chunk at %d", offset)
+			break
+		}
+		_, err = f.Write(chunk.Data)
+		if err != nil {
+			break
+		}
+		offset += int64(len(chunk.Data))
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeSpool(f)
+		<-packageFetches
+		return
+	}
+	pkg.spool = f
+	return
+}
+
+// releasePackage removes the temporary file of a fetched package
+func releasePackage(pkg *Package) {
+	if pkg.spool != nil {
+		removeSpool(pkg.spool)
+		pkg.spool = nil
+		<-packageFetches
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
 	"strings"
 	"testing"
 	"time"
@@ -127,6 +128,79 @@ func TestMakePackage(t *testing.T) {
 
 }
 
+func TestChunkedPackage(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	entry := GobEntry{C: strings.Repeat("x", ValidationPackageChunkSize*2)}
+	h.NewEntry(time.Now(), "evenNumbers", &entry)
+
+	Convey("it should offer large packages in chunks", t, func() {
+		pkg, err := MakePackage(h, PackagingReq{PkgReqChain: int64(PkgReqChainOptFull)})
+		So(err, ShouldBeNil)
+		So(pkg.Chain, ShouldBeNil)
+		So(pkg.ID, ShouldNotEqual, "")
+		So(pkg.Size, ShouldBeGreaterThan, int64(ValidationPackageChunkSize*2))
+
+		var b bytes.Buffer
+		h.chain.MarshalChain(&b, ChainMarshalFlagsOmitDNA)
+		So(pkg.Size, ShouldEqual, int64(b.Len()))
+
+		Convey("which can be fetched and validated", func() {
+			err := fetchPackage(h, h.node.HashAddr, &pkg)
+			So(err, ShouldBeNil)
+			defer releasePackage(&pkg)
+			vpkg, err := MakeValidationPackage(h, &pkg)
+			So(err, ShouldBeNil)
+			So(fmt.Sprintf("%v", vpkg.Chain), ShouldEqual, fmt.Sprintf("%v", h.chain))
+
+			Convey("only once", func() {
+				m := h.node.NewMessage(VALIDATE_PACKAGE_REQUEST, ValidatePackageQuery{ID: pkg.ID})
+				_, err := ValidateReceiver(h, m)
+				So(err, ShouldEqual, ErrPackageNotFound)
+			})
+		})
+	})
+
+	Convey("it should refuse to fetch packages that are too large", t, func() {
+		err := fetchPackage(h, h.node.HashAddr, &Package{ID: "x", Size: MaxValidationPackageSize + 1})
+		So(err, ShouldEqual, ErrPackageTooLarge)
+	})
+
+	Convey("it should not spool more than the largest package", t, func() {
+		s := spoolWriter{limit: 4, max: 8}
+		_, err := s.Write([]byte("12345"))
+		So(err, ShouldBeNil)
+		_, err = s.Write([]byte("6789"))
+		So(err, ShouldEqual, ErrPackageTooLarge)
+		s.discard()
+	})
+
+	Convey("it should refuse to offer packages when too many are waiting", t, func() {
+		var s packageStore
+		f, _ := ioutil.TempFile("", "hc-pkg")
+		id, err := s.add(f, MaxSpooledPackageBytes)
+		So(err, ShouldBeNil)
+		g, _ := ioutil.TempFile("", "hc-pkg")
+		defer removeSpool(g)
+		_, err = s.add(g, 1)
+		So(err, ShouldEqual, ErrPackageStoreFull)
+
+		s.lk.Lock()
+		s.remove(id)
+		s.lk.Unlock()
+		So(s.bytes, ShouldEqual, 0)
+		_, err = s.add(g, 1)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("VALIDATE_PACKAGE_REQUEST should fail if body isn't a ValidatePackageQuery", t, func() {
+		m := h.node.NewMessage(VALIDATE_PACKAGE_REQUEST, "fish")
+		_, err := ValidateReceiver(h, m)
+		So(err.Error(), ShouldEqual, "expected ValidatePackageQuery got string")
+	})
+}
+
 func TestGetValidationResponse(t *testing.T) {
 	d, _, h := PrepareTestChain("test")
 	defer CleanupTestDir(d)
@@ -173,3 +247,122 @@ func TestMakeValidatePackage(t *testing.T) {
 
 	})
 }
+
+func TestChainRate(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	now := time.Now()
+	headers := []*Header{
+		{Type: "post", Time: now.Add(-90 * time.Minute)},
+		{Type: "post", Time: now.Add(-50 * time.Minute)},
+		{Type: "like", Time: now.Add(-40 * time.Minute)},
+		{Type: "post", Time: now.Add(-10 * time.Minute)},
+		{Type: "post", Time: now},
+		{Type: "post", Time: now.Add(time.Minute)},
+	}
+
+	chain := &Chain{Headers: headers, Hmap: make(map[string]int)}
+	for i, hd := range headers {
+		hash, _, _ := hd.Sum(h.hashSpec)
+		chain.Hmap[hash.String()] = i
+		if i+1 < len(headers) {
+			headers[i+1].HeaderLink = hash
+		}
+	}
+
+	Convey("rates should count the entries before the header", t, func() {
+		rate := countChainRate(chain, headers[4], 60, 2)
+		So(rate.Minutes, ShouldEqual, 60)
+		So(rate.Headers, ShouldEqual, 2)
+		So(rate.InMinutes, ShouldResemble, map[string]int{"post": 2, "like": 1})
+		So(rate.InHeaders, ShouldResemble, map[string]int{"post": 1, "like": 1})
+
+		rate = countChainRate(chain, headers[0], 60, 2)
+		So(len(rate.InMinutes), ShouldEqual, 0)
+		So(len(rate.InHeaders), ShouldEqual, 0)
+	})
+
+	Convey("rates should count entries with the same time as the header", t, func() {
+		same := make([]*Header, 4)
+		c := &Chain{Headers: same, Hmap: make(map[string]int)}
+		for i := range same {
+			same[i] = &Header{Type: "post", Time: now}
+			if i > 0 {
+				same[i].HeaderLink, _, _ = same[i-1].Sum(h.hashSpec)
+			}
+			hash, _, _ := same[i].Sum(h.hashSpec)
+			c.Hmap[hash.String()] = i
+		}
+		rate := countChainRate(c, same[3], 60, 10)
+		So(rate.InMinutes["post"], ShouldEqual, 3)
+		So(rate.InHeaders["post"], ShouldEqual, 3)
+	})
+
+	Convey("rate requests should be objects of counts", t, func() {
+		m, n, err := parseRateReq(map[string]interface{}{"Minutes": int64(60), "Headers": float64(10)})
+		So(err, ShouldBeNil)
+		So(m, ShouldEqual, 60)
+		So(n, ShouldEqual, 10)
+		_, _, err = parseRateReq(int64(60))
+		So(err, ShouldEqual, ErrBadRateReq)
+		_, _, err = parseRateReq(map[string]interface{}{"Minutes": "lots"})
+		So(err, ShouldEqual, ErrBadRateReq)
+	})
+
+	Convey("rate requests should add the headers to the package", t, func() {
+		pkg, err := MakePackage(h, PackagingReq{PkgReqRate: map[string]interface{}{"Headers": int64(5)}})
+		So(err, ShouldBeNil)
+		var b bytes.Buffer
+		h.chain.MarshalChain(&b, ChainMarshalFlagsOmitDNA+ChainMarshalFlagsNoEntries)
+		So(string(pkg.Chain), ShouldEqual, string(b.Bytes()))
+	})
+
+	Convey("validation should be given the rate the app asks for", t, func() {
+		commit(h, "oddNumbers", "3")
+		commit(h, "oddNumbers", "5")
+		z, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `
+function validatePutPkg(name) {return {rate:{Headers:10,Minutes:60}}}
+function validateCommit(name,entry,header,pkg,sources) {return pkg.Rate.InHeaders.oddNumbers < 2}`})
+		So(err, ShouldBeNil)
+		def := &EntryDef{Name: "oddNumbers", DataFormat: DataFormatRawJS}
+		_, _, hd, err := h.chain.PrepareHeader(time.Now(), "oddNumbers", &GobEntry{C: "7"}, h.agent.PrivKey(), nil, nil)
+		So(err, ShouldBeNil)
+		a := NewCommitAction("oddNumbers", &GobEntry{C: "7"})
+		a.header = hd
+
+		vpkg := &ValidationPackage{}
+		err = h.addChainRate(z, a, def, vpkg)
+		So(err, ShouldBeNil)
+		So(vpkg.Rate.InHeaders["oddNumbers"], ShouldEqual, 2)
+		So(vpkg.Rate.InMinutes["oddNumbers"], ShouldEqual, 2)
+
+		err = z.ValidateAction(a, def, vpkg, nil)
+		So(err, ShouldEqual, ValidationFailedErr)
+	})
+}
+
+func TestValidatorProps(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+
+	Convey("it should describe the validating node", t, func() {
+		p := h.validatorProps()
+		So(p.Agent, ShouldEqual, h.agentHash.String())
+		So(p.Key, ShouldEqual, h.nodeIDStr)
+		top, _ := h.Top()
+		So(p.ChainHead, ShouldEqual, top.String())
+		So(p.Properties, ShouldNotBeNil)
+	})
+
+	Convey("validation functions should get the props in the package", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function validateCommit(name,entry,header,pkg,sources) {return pkg.Validator.Key==sources[0] && pkg.Validator.ChainHead!=""}`})
+		So(err, ShouldBeNil)
+		def := EntryDef{Name: "oddNumbers", DataFormat: DataFormatString}
+		hdr := mkTestHeader("oddNumbers")
+		a := NewCommitAction("oddNumbers", &GobEntry{C: "7"})
+		a.header = &hdr
+		So(v.ValidateAction(a, &def, nil, []string{h.nodeIDStr}), ShouldBeNil)
+		So(v.ValidateAction(a, &def, nil, []string{"someone else"}), ShouldEqual, ErrValidationFailed)
+	})
+}
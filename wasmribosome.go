@@ -0,0 +1,832 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// WASMRibosome implements a WebAssembly use of the Ribosome interface so that zomes can
+// be written in any language that compiles to wasm.
+//
+// The zome's code is the wasm binary.  Values cross between the host and the module as
+// JSON in the module's memory, which it must export as "memory" along with an
+// "alloc(size i32) i32" function the host uses to get space for what it passes in.
+//
+// Zome functions are exported as "fn(ptr i32, len i32) i64" taking the call's params and
+// returning the pointer to their result in the high 32 bits and its length in the low.
+// The callbacks are "genesis() i32", "validate<Action>(ptr i32, len i32) i32" which is
+// passed a JSON object describing the action, "validate<Action>Pkg(ptr i32, len i32) i64"
+// and "receive(ptr i32, len i32) i64", where an i32 result is 0 for false.
+//
+// The built-in functions are imported from the "env" module as "name(ptr i32, len i32)
+// i32" taking a JSON array of their arguments.  They return the length of their JSON
+// result, or minus the length of a JSON error message if they failed, which the module
+// then copies into memory it has allocated with "result(ptr i32) i32".
+//
+// A running module can't be interrupted, so wasm zomes can't set an ExecutionTimeout.
+
+package holochain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/wasm"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WASMRibosomeType = "wasm"
+
+	// WASMHostModule is the module the built-in functions are imported from
+	WASMHostModule = "env"
+)
+
+var ErrWASMNoExport = errors.New("wasm module doesn't export function")
+var ErrWASMOutOfBounds = errors.New("wasm memory access out of bounds")
+
+// WASMRibosome holds data needed for the WebAssembly VM
+type WASMRibosome struct {
+	h       *Holochain
+	zome    *Zome
+	module  *wasm.Module
+	vm      *exec.VM
+	pending []byte // the result of the last built-in call, waiting to be copied
+}
+
+// wasmHostFunc is a built-in function taking the args decoded from the JSON array the
+// module passed and returning a value to be passed back to it as JSON
+type wasmHostFunc func(vals []interface{}) (result interface{}, err error)
+
+// wasmValidateArgs is what is passed to the validate<Action> callbacks
+type wasmValidateArgs struct {
+	EntryType string
+	Entry     interface{} `json:",omitempty"`
+	Header    *jsHeader   `json:",omitempty"`
+	Replaces  string      `json:",omitempty"`
+	Hash      string      `json:",omitempty"`
+	Base      string      `json:",omitempty"`
+	Links     []Link      `json:",omitempty"`
+	Status    string      `json:",omitempty"`
+	Package   *ValidationPackage
+	Validator *ValidatorProps `json:",omitempty"`
+	Sources   []string
+}
+
+// Type returns the string value under which this ribosome is registered
+func (wr *WASMRibosome) Type() string { return WASMRibosomeType }
+
+// NewWASMRibosome factory function to build a WebAssembly execution environment for a zome
+func NewWASMRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	wr := WASMRibosome{
+		h:    h,
+		zome: zome,
+	}
+	host := wr.hostModule(wr.builtins())
+	wr.module, err = wasm.ReadModule(bytes.NewReader([]byte(zome.Code)), func(name string) (*wasm.Module, error) {
+		if name != WASMHostModule {
+			return nil, fmt.Errorf("unknown wasm import module: %s", name)
+		}
+		return host, nil
+	})
+	if err != nil {
+		err = fmt.Errorf("WASM load error: %w", err)
+		return
+	}
+	wr.vm, err = exec.NewVM(wr.module)
+	if err != nil {
+		return
+	}
+	n = &wr
+	return
+}
+
+// hostModule builds the module the zome's code imports the built-in functions from
+func (wr *WASMRibosome) hostModule(funcs map[string]wasmHostFunc) *wasm.Module {
+	m := wasm.NewModule()
+	i32 := wasm.ValueTypeI32
+	m.Types = &wasm.SectionTypes{Entries: []wasm.FunctionSig{
+		{Form: 0, ParamTypes: []wasm.ValueType{i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+		{Form: 0, ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i32}},
+	}}
+	m.Export = &wasm.SectionExports{Entries: make(map[string]wasm.ExportEntry)}
+	add := func(name string, sig int, fn interface{}) {
+		m.Export.Entries[name] = wasm.ExportEntry{FieldStr: name, Kind: wasm.ExternalFunction, Index: uint32(len(m.FunctionIndexSpace))}
+		m.FunctionIndexSpace = append(m.FunctionIndexSpace, wasm.Function{
+			Sig:  &m.Types.Entries[sig],
+			Host: reflect.ValueOf(fn),
+			Body: &wasm.FunctionBody{},
+		})
+	}
+	var names []string
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, 0, wr.hostFunc(funcs[name]))
+	}
+	add("result", 1, wr.hostResult)
+	return m
+}
+
+// hostFunc wraps a built-in function as a wasm host function
+func (wr *WASMRibosome) hostFunc(f wasmHostFunc) func(proc *exec.Process, ptr int32, size int32) int32 {
+	return func(proc *exec.Process, ptr int32, size int32) int32 {
+		var result interface{}
+		var b []byte
+		// the args are where the module says they are, so check it's in its memory
+		err := ErrWASMOutOfBounds
+		if ptr >= 0 && size >= 0 {
+			b, err = wr.read(uint32(ptr), uint32(size))
+		}
+		if err == nil {
+			var vals []interface{}
+			if err = json.Unmarshal(b, &vals); err == nil {
+				result, err = f(vals)
+			}
+		}
+		if err == nil {
+			wr.pending, err = json.Marshal(result)
+		}
+		if err != nil {
+			wr.pending, _ = json.Marshal(err.Error())
+			return -int32(len(wr.pending))
+		}
+		return int32(len(wr.pending))
+	}
+}
+
+// hostResult copies the result of the last built-in call to ptr
+func (wr *WASMRibosome) hostResult(proc *exec.Process, ptr int32) int32 {
+	n, _ := proc.WriteAt(wr.pending, int64(ptr))
+	wr.pending = nil
+	return int32(n)
+}
+
+// export returns the index of the function the module exports as name
+func (wr *WASMRibosome) export(name string) (idx int64, err error) {
+	if wr.module.Export != nil {
+		if e, ok := wr.module.Export.Entries[name]; ok && e.Kind == wasm.ExternalFunction {
+			idx = int64(e.Index)
+			return
+		}
+	}
+	err = fmt.Errorf("%w: %s", ErrWASMNoExport, name)
+	return
+}
+
+// hasExport returns whether the module exports a function called name
+func (wr *WASMRibosome) hasExport(name string) bool {
+	_, err := wr.export(name)
+	return err == nil
+}
+
+// write copies data into memory allocated by the module
+func (wr *WASMRibosome) write(data []byte) (ptr uint32, err error) {
+	idx, err := wr.export("alloc")
+	if err != nil {
+		return
+	}
+	r, err := wr.vm.ExecCode(idx, uint64(len(data)))
+	if err != nil {
+		return
+	}
+	p, ok := r.(uint32)
+	if !ok {
+		err = fmt.Errorf("alloc should return i32, got: %v", r)
+		return
+	}
+	mem := wr.vm.Memory()
+	if uint64(p)+uint64(len(data)) > uint64(len(mem)) {
+		err = ErrWASMOutOfBounds
+		return
+	}
+	copy(mem[p:], data)
+	ptr = p
+	return
+}
+
+// read returns a copy of size bytes of the module's memory from ptr
+func (wr *WASMRibosome) read(ptr uint32, size uint32) (data []byte, err error) {
+	mem := wr.vm.Memory()
+	if uint64(ptr)+uint64(size) > uint64(len(mem)) {
+		err = ErrWASMOutOfBounds
+		return
+	}
+	data = make([]byte, size)
+	copy(data, mem[ptr:])
+	return
+}
+
+// invoke calls the function the module exports as name passing it data
+func (wr *WASMRibosome) invoke(name string, data []byte) (r interface{}, err error) {
+	idx, err := wr.export(name)
+	if err != nil {
+		return
+	}
+	ptr, err := wr.write(data)
+	if err != nil {
+		return
+	}
+	r, err = wr.vm.ExecCode(idx, uint64(ptr), uint64(len(data)))
+	return
+}
+
+// invokeData calls a function the module exports as name which returns data
+func (wr *WASMRibosome) invokeData(name string, data []byte) (result []byte, err error) {
+	r, err := wr.invoke(name, data)
+	if err != nil {
+		return
+	}
+	v, ok := r.(uint64)
+	if !ok {
+		err = fmt.Errorf("%s should return i64, got: %v", name, r)
+		return
+	}
+	result, err = wr.read(uint32(v>>32), uint32(v))
+	return
+}
+
+// boolResult converts the i32 returned by a callback into a bool
+func boolResult(fnName string, r interface{}) (b bool, err error) {
+	v, ok := r.(uint32)
+	if !ok {
+		err = fmt.Errorf("%s should return i32, got: %v", fnName, r)
+		return
+	}
+	b = v != 0
+	return
+}
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (wr *WASMRibosome) ChainGenesis() (err error) {
+	idx, err := wr.export("genesis")
+	if err != nil {
+		return
+	}
+	r, err := wr.vm.ExecCode(idx)
+	if err != nil {
+		err = fmt.Errorf("Error executing genesis: %w", err)
+		return
+	}
+	b, err := boolResult("genesis", r)
+	if err == nil && !b {
+		err = fmt.Errorf("genesis failed")
+	}
+	return
+}
+
+// BridgeGenesis calls the app bridgeGenesis function, if the module exports one, for a
+// bridge being set up to or from the app with the DNA hash dnaHash.  It is passed the
+// JSON array of the side and the DNA hash.
+func (wr *WASMRibosome) BridgeGenesis(side int, dnaHash string) (err error) {
+	fnName := "bridgeGenesis"
+	if !wr.hasExport(fnName) {
+		return
+	}
+	data, err := json.Marshal([]interface{}{side, dnaHash})
+	if err != nil {
+		return
+	}
+	r, err := wr.invoke(fnName, data)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	b, err := boolResult(fnName, r)
+	if err == nil && !b {
+		err = fmt.Errorf("%s failed", fnName)
+	}
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (wr *WASMRibosome) Receive(from string, msg string) (response string, err error) {
+	fnName := "receive"
+	data, err := json.Marshal([]interface{}{from, json.RawMessage(msg)})
+	if err != nil {
+		return
+	}
+	r, err := wr.invokeData(fnName, data)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	response = string(r)
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an
+// action.  A module that doesn't export the function asks for no package.
+func (wr *WASMRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
+	if !wr.hasExport(fnName) {
+		return
+	}
+	Debugf("%s(%q)", fnName, def.Name)
+	data, err := json.Marshal(def.Name)
+	if err != nil {
+		return
+	}
+	r, err := wr.invokeData(fnName, data)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	var v interface{}
+	if err = json.Unmarshal(r, &v); err != nil {
+		return
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		req = t
+	case nil:
+	default:
+		err = fmt.Errorf("%s should return null or object, got: %v", fnName, v)
+	}
+	return
+}
+
+// wasmEntryValue converts entry content into the value passed to the app for the entry's
+// data format
+func wasmEntryValue(h *Holochain, def *EntryDef, entry Entry, header *Header) (e interface{}, hdr *jsHeader) {
+	c, _ := entryContentString(entry.Content())
+	switch def.DataFormat {
+	case DataFormatJSON, DataFormatLinks, DataFormatCBOR:
+		e = json.RawMessage(c)
+	default:
+		e = c
+	}
+	if header != nil {
+		hdr = &jsHeader{
+			EntryLink:  header.EntryLink.String(),
+			Type:       header.Type,
+			Time:       header.Time.UTC().Format(time.RFC3339),
+			Meta:       header.Meta,
+			Timestamps: headerTimestamps(h, header),
+		}
+	}
+	return
+}
+
+// ValidateAction calls the app's validate<Action> function for the action
+func (wr *WASMRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	fnName := "validate" + strings.Title(action.Name())
+	if sources == nil {
+		sources = []string{}
+	}
+	v := wasmValidateArgs{EntryType: def.Name, Package: pkg, Sources: sources}
+	switch t := action.(type) {
+	case *ActionPut:
+		v.Entry, v.Header = wasmEntryValue(wr.h, def, t.entry, t.header)
+	case *ActionCommit:
+		v.Entry, v.Header = wasmEntryValue(wr.h, def, t.entry, t.header)
+	case *ActionMod:
+		v.Entry, v.Header = wasmEntryValue(wr.h, def, t.entry, t.header)
+		v.Replaces = t.replaces.String()
+	case *ActionDel:
+		v.Hash = t.entry.Hash.String()
+	case *ActionLink:
+		v.Base = t.validationBase.String()
+		v.Links = t.links
+	case *ActionSetStatus:
+		v.Hash = t.entry.Hash.String()
+		v.Status = t.entry.Status
+	default:
+		err = fmt.Errorf("can't prepare args for %T: ", t)
+		return
+	}
+	if wr.h != nil {
+		v.Validator = wr.h.validatorProps()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	Debugf("%s: %s", fnName, string(data))
+	r, err := wr.invoke(fnName, data)
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	b, err := boolResult(fnName, r)
+	if err == nil && !b {
+		err = ValidationFailedErr
+	}
+	return
+}
+
+// Call calls a function exported by the zome's module.  The params are passed as they
+// are for both calling types, the module parsing them itself for JSON calling.
+func (wr *WASMRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	switch fn.CallingType {
+	case STRING_CALLING, JSON_CALLING:
+	default:
+		err = errors.New("params type not implemented")
+		return
+	}
+	Debugf("WASM Call: %s(%v)", fn.Name, params)
+	r, err := wr.invokeData(fn.Name, []byte(params.(string)))
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fn.Name, err)
+		return
+	}
+	result = string(r)
+	return
+}
+
+// Run calls the function exported by the module as code, which takes no arguments,
+// returning what it returns
+func (wr *WASMRibosome) Run(code string) (result interface{}, err error) {
+	idx, err := wr.export(code)
+	if err != nil {
+		return
+	}
+	result, err = wr.vm.ExecCode(idx)
+	if err != nil {
+		err = errors.New("WASM exec error: " + err.Error())
+	}
+	return
+}
+
+// wasmArg adapts a value decoded from the JSON args of a built-in call for processArgs
+type wasmArg struct {
+	v interface{}
+}
+
+func (a wasmArg) kind() argKind {
+	switch a.v.(type) {
+	case string:
+		return argStr
+	case float64:
+		return argNumber
+	case bool:
+		return argBool
+	case map[string]interface{}:
+		return argObject
+	case []interface{}:
+		return argArray
+	}
+	return argOther
+}
+
+func (a wasmArg) str() string { return a.v.(string) }
+
+func (a wasmArg) integer() (int64, error) { return int64(a.v.(float64)), nil }
+
+func (a wasmArg) boolean() (bool, error) { return a.v.(bool), nil }
+
+func (a wasmArg) json() (s string, err error) {
+	b, err := json.Marshal(a.v)
+	s = string(b)
+	return
+}
+
+func (a wasmArg) export() (interface{}, error) { return a.v, nil }
+
+func (a wasmArg) toStr() (str string, ok bool) {
+	ok = true
+	switch t := a.v.(type) {
+	case string:
+		str = t
+	case float64:
+		str = strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		str = strconv.FormatBool(t)
+	default:
+		ok = false
+	}
+	return
+}
+
+func (a wasmArg) objectName() string { return "object" }
+
+// wasmProcessActionArgs processes the args of a call to the action's built-in function
+func wasmProcessActionArgs(a BuiltinAction, args []Arg, vals []interface{}) (err error) {
+	avs := make([]argValue, len(vals))
+	for i, v := range vals {
+		avs[i] = wasmArg{v: v}
+	}
+	err = actionArgsErr(a, args, processArgs(args, avs))
+	return
+}
+
+// hashResult returns the string of a hash returned by an action
+func hashResult(r interface{}) string {
+	var hash Hash
+	if r != nil {
+		hash = r.(Hash)
+	}
+	return hash.String()
+}
+
+// wasmGetResult returns the parts of a get response asked for by mask, the part itself
+// if only one was asked for
+func wasmGetResult(h *Holochain, mask int, resp GetResp) interface{} {
+	if mask == GetMaskDefault {
+		mask = GetMaskEntry
+		if resp.Header != nil {
+			mask = GetMaskHeader
+		}
+	}
+	parts := make(map[string]interface{})
+	if mask&GetMaskEntry != 0 {
+		var c interface{}
+		if resp.Entry != nil {
+			c = resp.Entry.Content()
+		}
+		parts["Entry"] = c
+	}
+	if mask&GetMaskEntryType != 0 {
+		parts["EntryType"] = resp.EntryType
+	}
+	if mask&GetMaskSources != 0 {
+		parts["Sources"] = resp.Sources
+	}
+	if wantsHistory(mask) {
+		parts["History"] = resp.History
+	}
+	if mask&GetMaskMeta != 0 {
+		parts["Meta"] = resp.Meta
+	}
+	if mask&GetMaskHeader != 0 {
+		var header interface{}
+		if resp.Header != nil {
+			header = toJSHeader(h, resp.Header)
+		}
+		parts["Header"] = header
+	}
+	if len(parts) == 1 {
+		for _, v := range parts {
+			return v
+		}
+	}
+	return parts
+}
+
+// builtins returns the built-in functions the zome's module can import
+func (wr *WASMRibosome) builtins() map[string]wasmHostFunc {
+	h := wr.h
+	return map[string]wasmHostFunc{
+		"property": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionProperty{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			a.prop = args[0].value.(string)
+			r, err = h.doAction(wr.zome.Name, a, args...)
+			return
+		},
+		"config": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionConfig{zome: wr.zome.Name}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			a.key = args[0].value.(string)
+			if r, err = h.doAction(wr.zome.Name, a, args...); errors.Is(err, ErrZomeConfigNotSet) {
+				r, err = nil, nil
+			}
+			return
+		},
+		"debug": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionDebug{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			a.msg = args[0].value.(string)
+			h.doAction(wr.zome.Name, a, args...)
+			return
+		},
+		"makeHash": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionMakeHash{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			a.entry = &GobEntry{C: args[0].value.(string)}
+			if r, err = h.doAction(wr.zome.Name, a, args...); err == nil {
+				r = hashResult(r)
+			}
+			return
+		},
+		"call": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionCall{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			a.zome = args[0].value.(string)
+			var zome *Zome
+			if zome, err = h.GetZome(a.zome); err != nil {
+				return
+			}
+			a.function = args[1].value.(string)
+			var fn *FunctionDef
+			if fn, err = zome.GetFunctionDef(a.function); err != nil {
+				return
+			}
+			if fn.CallingType == JSON_CALLING && (wasmArg{v: vals[2]}).kind() != argObject {
+				err = errors.New("function calling type requires object argument type")
+				return
+			}
+			a.args = args[2].value.(string)
+			r, err = h.doAction(wr.zome.Name, a, args...)
+			return
+		},
+		"commit": func(vals []interface{}) (r interface{}, err error) {
+			var a Action = &ActionCommit{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			var options CommitOptions
+			if len(vals) == 3 {
+				if err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &options, &h.config.Loggers.App); err != nil {
+					return
+				}
+			}
+			entry := GobEntry{C: args[1].value.(string)}
+			if r, err = h.doAction(wr.zome.Name, NewCommitActionWithOptions(args[0].value.(string), &entry, options), args...); err == nil {
+				r = hashResult(r)
+			}
+			return
+		},
+		"get": func(vals []interface{}) (r interface{}, err error) {
+			var a Action = &ActionGet{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			options := GetOptions{StatusMask: StatusDefault}
+			if len(vals) == 2 {
+				if err = decodeOptions(a.Name(), args[1].value.(map[string]interface{}), &options, &h.config.Loggers.App); err != nil {
+					return
+				}
+			}
+			req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
+			if r, err = h.doAction(wr.zome.Name, NewGetAction(req, &options), args...); err == nil {
+				resp := r.(GetResp)
+				if resp.Entry, err = appEntry(resp.Entry); err == nil {
+					r = wasmGetResult(h, options.GetMask, resp)
+				}
+			}
+			return
+		},
+		"query": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionQuery{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			options := QueryOptions{}
+			if len(vals) == 1 {
+				if err = decodeOptions(a.Name(), args[0].value.(map[string]interface{}), &options, &h.config.Loggers.App); err != nil {
+					return
+				}
+			}
+			r, err = h.doAction(wr.zome.Name, NewQueryAction(&options), args...)
+			return
+		},
+		"update": func(vals []interface{}) (r interface{}, err error) {
+			var a Action = &ActionMod{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			entry := GobEntry{C: args[1].value.(string)}
+			if r, err = h.doAction(wr.zome.Name, NewModAction(args[0].value.(string), &entry, args[2].value.(Hash)), args...); err == nil {
+				r = hashResult(r)
+			}
+			return
+		},
+		"remove": func(vals []interface{}) (r interface{}, err error) {
+			var a Action = &ActionDel{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			entry := DelEntry{
+				Hash:    args[0].value.(Hash),
+				Message: args[1].value.(string),
+			}
+			var header *Header
+			if header, err = h.chain.GetEntryHeader(entry.Hash); err != nil {
+				return
+			}
+			if r, err = h.doAction(wr.zome.Name, NewDelAction(header.Type, entry), args...); err == nil {
+				r = hashResult(r)
+			}
+			return
+		},
+		"setStatus": func(vals []interface{}) (r interface{}, err error) {
+			var a Action = &ActionSetStatus{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			entry := StatusEntry{
+				Hash:   args[0].value.(Hash),
+				Status: args[1].value.(string),
+			}
+			if args[2].value != nil {
+				entry.Message = args[2].value.(string)
+			}
+			var entryType string
+			if entryType, err = h.entryTypeOf(wr.zome.Name, entry.Hash); err != nil {
+				return
+			}
+			if r, err = h.doAction(wr.zome.Name, NewSetStatusAction(entryType, entry), args...); err == nil {
+				r = hashResult(r)
+			}
+			return
+		},
+		"pin": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionPin{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			a.hash = args[0].value.(Hash)
+			_, err = h.doAction(wr.zome.Name, a, args...)
+			return
+		},
+		"unpin": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionUnpin{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			a.hash = args[0].value.(Hash)
+			_, err = h.doAction(wr.zome.Name, a, args...)
+			return
+		},
+		"getLink": func(vals []interface{}) (r interface{}, err error) {
+			var a Action = &ActionGetLink{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			options := GetLinkOptions{Load: false, StatusMask: StatusLive}
+			if len(vals) == 3 {
+				if err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &options, &h.config.Loggers.App); err != nil {
+					return
+				}
+			}
+			q := LinkQuery{Base: args[0].value.(Hash), T: args[1].value.(string), StatusMask: options.StatusMask, Limit: options.Limit, Cursor: options.Cursor, SortBy: options.SortBy}
+			r, err = h.doAction(wr.zome.Name, NewGetLinkAction(&q, &options), args...)
+			return
+		},
+		"bridge": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionBridge{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			a.toApp = args[0].value.(string)
+			a.zome = args[1].value.(string)
+			a.function = args[2].value.(string)
+			a.args = args[3].value.(string)
+			r, err = h.doAction(wr.zome.Name, a, args...)
+			return
+		},
+		"getBridges": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionGetBridges{}
+			if err = wasmProcessActionArgs(a, a.Args(), vals); err != nil {
+				return
+			}
+			r, err = h.doAction(wr.zome.Name, a)
+			return
+		},
+		"send": func(vals []interface{}) (r interface{}, err error) {
+			a := &ActionSend{}
+			args := a.Args()
+			if err = wasmProcessActionArgs(a, args, vals); err != nil {
+				return
+			}
+			if a.to, err = peer.IDB58Decode(args[0].value.(Hash).String()); err != nil {
+				return
+			}
+			var j []byte
+			if j, err = json.Marshal(args[1].value); err != nil {
+				return
+			}
+			if len(vals) == 3 {
+				if err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &a.options, &h.config.Loggers.App); err != nil {
+					return
+				}
+			}
+			a.msg.ZomeType = wr.zome.Name
+			a.msg.Body = string(j)
+			r, err = h.doAction(wr.zome.Name, a, args...)
+			return
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package holochain
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// testWASMGenesis returns the binary of a module that only exports "genesis() i32"
+// returning result
+func testWASMGenesis(result byte) string {
+	return string([]byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+		0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f, // types: () -> i32
+		0x03, 0x02, 0x01, 0x00, // functions: one of type 0
+		0x07, 0x0b, 0x01, 0x07, 'g', 'e', 'n', 'e', 's', 'i', 's', 0x00, 0x00, // export "genesis"
+		0x0a, 0x06, 0x01, 0x04, 0x00, 0x41, result, 0x0b, // code: i32.const result
+	})
+}
+
+func TestNewWASMRibosome(t *testing.T) {
+	Convey("new should create a ribosome", t, func() {
+		v, err := NewWASMRibosome(nil, &Zome{RibosomeType: WASMRibosomeType, Code: testWASMGenesis(1)})
+		So(err, ShouldBeNil)
+		So(v.Type(), ShouldEqual, WASMRibosomeType)
+		r, err := v.Run("genesis")
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, uint32(1))
+	})
+	Convey("new should fail to create a ribosome when the code isn't wasm", t, func() {
+		v, err := NewWASMRibosome(nil, &Zome{RibosomeType: WASMRibosomeType, Code: "(+ 1 1)"})
+		So(v, ShouldBeNil)
+		So(err.Error(), ShouldStartWith, "WASM load error: ")
+	})
+	Convey("it should be registered as a built in ribosome", t, func() {
+		z := Zome{Name: "test", RibosomeType: WASMRibosomeType, Code: testWASMGenesis(1)}
+		So(z.CodeFileName(), ShouldEqual, "test.wasm")
+		v, err := z.MakeRibosome(nil)
+		So(err, ShouldBeNil)
+		So(v.Type(), ShouldEqual, WASMRibosomeType)
+	})
+}
+
+func TestWASMGenesis(t *testing.T) {
+	Convey("it should succeed when genesis returns true", t, func() {
+		v, _ := NewWASMRibosome(nil, &Zome{RibosomeType: WASMRibosomeType, Code: testWASMGenesis(1)})
+		So(v.ChainGenesis(), ShouldBeNil)
+	})
+	Convey("it should fail when genesis returns false", t, func() {
+		v, _ := NewWASMRibosome(nil, &Zome{RibosomeType: WASMRibosomeType, Code: testWASMGenesis(0)})
+		So(v.ChainGenesis().Error(), ShouldEqual, "genesis failed")
+	})
+}
+
+func TestWASMCall(t *testing.T) {
+	v, _ := NewWASMRibosome(nil, &Zome{RibosomeType: WASMRibosomeType, Code: testWASMGenesis(1)})
+	Convey("calling a function the module doesn't export should fail", t, func() {
+		_, err := v.Call(&FunctionDef{Name: "getProperty", CallingType: STRING_CALLING}, "")
+		So(errors.Is(err, ErrWASMNoExport), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "Error executing getProperty: wasm module doesn't export function: getProperty")
+	})
+	Convey("built-in calls with args outside the module's memory should fail", t, func() {
+		wr := v.(*WASMRibosome)
+		called := false
+		f := wr.hostFunc(func(vals []interface{}) (interface{}, error) { called = true; return nil, nil })
+		So(f(nil, 0, -1), ShouldBeLessThan, 0)
+		So(f(nil, -1, 2), ShouldBeLessThan, 0)
+		So(f(nil, 0, 0x7fffffff), ShouldBeLessThan, 0)
+		So(called, ShouldBeFalse)
+		So(string(wr.pending), ShouldEqual, `"`+ErrWASMOutOfBounds.Error()+`"`)
+	})
+	Convey("it should ask for no package when the module has no packaging function", t, func() {
+		req, err := v.ValidatePackagingRequest(&ActionCommit{}, &EntryDef{Name: "evenNumbers"})
+		So(err, ShouldBeNil)
+		So(req, ShouldBeNil)
+	})
+}
+
+func TestWASMArgs(t *testing.T) {
+	Convey("the args decoded from JSON should be processed", t, func() {
+		a := &ActionCommit{}
+		args := a.Args()
+		err := wasmProcessActionArgs(a, args, []interface{}{"oddNumbers", map[string]interface{}{"n": 3.0}})
+		So(err, ShouldBeNil)
+		So(args[0].value, ShouldEqual, "oddNumbers")
+		So(args[1].value, ShouldEqual, `{"n":3}`)
+
+		err = wasmProcessActionArgs(a, args, []interface{}{})
+		So(err.Error(), ShouldStartWith, "commit() expects (")
+	})
+	Convey("it should convert values to strings", t, func() {
+		s, ok := wasmArg{v: 3.5}.toStr()
+		So(ok, ShouldBeTrue)
+		So(s, ShouldEqual, "3.5")
+		s, ok = wasmArg{v: true}.toStr()
+		So(s, ShouldEqual, "true")
+		_, ok = wasmArg{v: nil}.toStr()
+		So(ok, ShouldBeFalse)
+	})
+	Convey("a get result should be the part asked for or an object of the parts", t, func() {
+		resp := GetResp{Entry: &GobEntry{C: "7"}, EntryType: "oddNumbers"}
+		So(wasmGetResult(nil, GetMaskDefault, resp), ShouldEqual, "7")
+		So(wasmGetResult(nil, GetMaskEntryType, resp), ShouldEqual, "oddNumbers")
+		So(wasmGetResult(nil, GetMaskEntry|GetMaskEntryType, resp), ShouldResemble, map[string]interface{}{"Entry": "7", "EntryType": "oddNumbers"})
+	})
+}
@@ -6,6 +6,7 @@ package holochain
 
 import (
 	"errors"
+	"time"
 )
 
 // Zome struct encapsulates logically related code, from a "chromosome"
@@ -16,6 +17,26 @@ type Zome struct {
 	Entries      []EntryDef
 	RibosomeType string
 	Functions    []FunctionDef
+	Schedules    []ScheduleDef
+	// ExecutionTimeout is how long a call into the zome's code may run before it is
+	// aborted with ErrRibosomeTimeout, as a duration like "5s", "" for no limit.  Only
+	// javascript and zygo zomes support it.
+	ExecutionTimeout string
+	// StrictValidation makes Date.now(), new Date() and Math.random() throw in
+	// javascript validation functions, whose results must be the same on every node;
+	// HC.time() and HC.rand(seed) can be used instead.  Only javascript zomes support it.
+	StrictValidation bool
+}
+
+// executionTimeout returns the zome's ExecutionTimeout, 0 for no limit
+func (z *Zome) executionTimeout() (d time.Duration, err error) {
+	if z.ExecutionTimeout == "" {
+		return
+	}
+	if d, err = time.ParseDuration(z.ExecutionTimeout); err == nil && d < 0 {
+		err = errors.New("execution timeout can't be negative")
+	}
+	return
 }
 
 // GetEntryDef returns the entry def structure
@@ -56,6 +77,8 @@ func (zome *Zome) CodeFileName() string {
 		return zome.Name + ".zy"
 	} else if zome.RibosomeType == JSRibosomeType {
 		return zome.Name + ".js"
+	} else if zome.RibosomeType == WASMRibosomeType {
+		return zome.Name + ".wasm"
 	}
 	panic("unknown ribosome type:" + zome.RibosomeType)
 }
@@ -0,0 +1,45 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// zomeconfig implements the per-instance settings of zomes, such as the URLs of external
+// services, which are kept in the config rather than the DNA so changing them doesn't
+// change the DNA hash
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrZomeConfigNotSet = errors.New("zome config not set")
+
+// ZomeConfig returns the value of a zome's config setting
+func (h *Holochain) ZomeConfig(zome string, key string) (value string, err error) {
+	h.configLk.Lock()
+	defer h.configLk.Unlock()
+	value, ok := h.config.ZomeConfig[zome][key]
+	if !ok {
+		err = fmt.Errorf("%w: %s.%s", ErrZomeConfigNotSet, zome, key)
+	}
+	return
+}
+
+// SetZomeConfig sets a zome's config setting and saves it in the config file
+func (h *Holochain) SetZomeConfig(zome string, key string, value string) (err error) {
+	if _, err = h.GetZome(zome); err != nil {
+		return
+	}
+	h.configLk.Lock()
+	defer h.configLk.Unlock()
+	if h.config.ZomeConfig == nil {
+		h.config.ZomeConfig = make(map[string]map[string]string)
+	}
+	if h.config.ZomeConfig[zome] == nil {
+		h.config.ZomeConfig[zome] = make(map[string]string)
+	}
+	h.config.ZomeConfig[zome][key] = value
+	err = h.saveConfig()
+	return
+}
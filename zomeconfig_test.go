@@ -0,0 +1,56 @@
+package holochain
+
+import (
+	"errors"
+	zygo "github.com/glycerine/zygomys/repl"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+)
+
+func TestZomeConfig(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestDir(d)
+	dnaHash := h.dnaHash.String()
+
+	Convey("unset settings should be reported", t, func() {
+		_, err := h.ZomeConfig("jsSampleZome", "serviceURL")
+		So(errors.Is(err, ErrZomeConfigNotSet), ShouldBeTrue)
+	})
+
+	Convey("settings should be saved in the config without changing the DNA", t, func() {
+		err := h.SetZomeConfig("jsSampleZome", "serviceURL", "https://example.com")
+		So(err, ShouldBeNil)
+		v, err := h.ZomeConfig("jsSampleZome", "serviceURL")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "https://example.com")
+		So(h.dnaHash.String(), ShouldEqual, dnaHash)
+
+		var config Config
+		err = decodeFile(filepath.Join(h.rootPath, ConfigFileName+"."+h.encodingFormat), h.encodingFormat, &config)
+		So(err, ShouldBeNil)
+		So(config.ZomeConfig["jsSampleZome"]["serviceURL"], ShouldEqual, "https://example.com")
+
+		err = h.SetZomeConfig("noSuchZome", "serviceURL", "x")
+		So(err.Error(), ShouldEqual, "unknown zome: noSuchZome")
+	})
+
+	Convey("settings should be read by their own zome with config()", t, func() {
+		zome, _ := h.GetZome("jsSampleZome")
+		v, _ := NewJSRibosome(h, zome)
+		z := v.(*JSRibosome)
+		_, err := z.Run(`config("serviceURL")`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.String(), ShouldEqual, "https://example.com")
+		_, err = z.Run(`config("other")`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.IsUndefined(), ShouldBeTrue)
+
+		zome, _ = h.GetZome("zySampleZome")
+		v, _ = NewZygoRibosome(h, zome)
+		zy := v.(*ZygoRibosome)
+		_, err = zy.Run(`(config "serviceURL")`)
+		So(err, ShouldBeNil)
+		So(zy.lastResult, ShouldEqual, zygo.SexpNull)
+	})
+}
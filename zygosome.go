@@ -11,10 +11,12 @@ import (
 	"fmt"
 	zygo "github.com/glycerine/zygomys/repl"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"io"
 	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,10 +26,80 @@ const (
 
 // ZygoRibosome holds data needed for the Zygo VM
 type ZygoRibosome struct {
+	h          *Holochain
 	zome       *Zome
 	env        *zygo.Glisp
 	lastResult zygo.Sexp
 	library    string
+	stream     io.Writer
+	abort      chan error // what the running code is being aborted with
+}
+
+// SetStream sets where the streamWrite built-in writes chunks for the current call
+func (z *ZygoRibosome) SetStream(w io.Writer) {
+	z.stream = w
+}
+
+var errZyInterrupted = errors.New("zygo call interrupted")
+
+// Interrupt aborts the currently running call the next time it calls a function
+func (z *ZygoRibosome) Interrupt() {
+	select {
+	case z.abort <- errZyInterrupted:
+	default:
+	}
+}
+
+// checkAbort is run before each function the code calls and panics with the error the
+// code is being aborted with, if any, as zygomys has no other way to stop running code
+func (z *ZygoRibosome) checkAbort(env *zygo.Glisp, name string, args []zygo.Sexp) {
+	select {
+	case e := <-z.abort:
+		panic(e)
+	default:
+	}
+}
+
+// run runs the loaded code, aborting it once the zome's ExecutionTimeout passes
+func (z *ZygoRibosome) run() (result zygo.Sexp, err error) {
+	defer func() {
+		if caught := recover(); caught != nil {
+			if caught != errZyInterrupted && caught != ErrRibosomeTimeout {
+				panic(caught)
+			}
+			// the code was stopped part way through so clear what it left behind
+			z.env.Clear()
+			err = caught.(error)
+		}
+	}()
+	if d, _ := z.zome.executionTimeout(); d > 0 {
+		var lk sync.Mutex
+		done := false
+		t := time.AfterFunc(d, func() {
+			lk.Lock()
+			defer lk.Unlock()
+			if done {
+				return
+			}
+			select {
+			case z.abort <- ErrRibosomeTimeout:
+			default:
+			}
+		})
+		defer func() {
+			t.Stop()
+			lk.Lock()
+			done = true
+			lk.Unlock()
+			// the timer may have fired after the code finished
+			select {
+			case <-z.abort:
+			default:
+			}
+		}()
+	}
+	result, err = z.env.Run()
+	return
 }
 
 // Type returns the string value under which this ribosome is registered
@@ -40,9 +112,9 @@ func (z *ZygoRibosome) ChainGenesis() (err error) {
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.run()
 	if err != nil {
-		err = fmt.Errorf("Error executing genesis: %v", err)
+		err = fmt.Errorf("Error executing genesis: %w", err)
 		return
 	}
 	switch result.(type) {
@@ -73,7 +145,7 @@ func (z *ZygoRibosome) Receive(from string, msg string) (response string, err er
 		return
 	}
 	var result interface{}
-	result, err = z.env.Run()
+	result, err = z.run()
 	if err == nil {
 		switch t := result.(type) {
 		case *zygo.SexpStr:
@@ -89,6 +161,74 @@ func (z *ZygoRibosome) Receive(from string, msg string) (response string, err er
 	return
 }
 
+// ValidatePublish calls the app validatePublish function for a message published on a channel
+func (z *ZygoRibosome) ValidatePublish(channel string, msg string) (err error) {
+	fnName := "validatePublish"
+	code := fmt.Sprintf(`(%s "%s" "%s")`, fnName, sanitizeZyString(channel), sanitizeZyString(msg))
+	err = z.env.LoadString(code)
+	if err != nil {
+		return
+	}
+	var result interface{}
+	result, err = z.run()
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	b, ok := result.(*zygo.SexpBool)
+	if !ok {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, result)
+		return
+	}
+	if !b.Val {
+		err = ValidationFailedErr
+	}
+	return
+}
+
+// BridgeGenesis calls the app bridgeGenesis function, if it has one, for a bridge being
+// set up to or from the app with the DNA hash dnaHash
+func (z *ZygoRibosome) BridgeGenesis(side int, dnaHash string) (err error) {
+	fnName := "bridgeGenesis"
+	if _, defined := z.env.FindObject(fnName); !defined {
+		return
+	}
+	code := fmt.Sprintf(`(%s %d "%s")`, fnName, side, sanitizeZyString(dnaHash))
+	err = z.env.LoadString(code)
+	if err != nil {
+		return
+	}
+	var result interface{}
+	result, err = z.run()
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
+		return
+	}
+	b, ok := result.(*zygo.SexpBool)
+	if !ok {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, result)
+		return
+	}
+	if !b.Val {
+		err = fmt.Errorf("%s failed", fnName)
+	}
+	return
+}
+
+// ReceivePublish calls the app handler function subscribed to a channel
+func (z *ZygoRibosome) ReceivePublish(handler string, channel string, from string, msg string) (err error) {
+	code := fmt.Sprintf(`(%s "%s" "%s" "%s")`, handler, sanitizeZyString(channel), from, sanitizeZyString(msg))
+	err = z.env.LoadString(code)
+	if err != nil {
+		return
+	}
+	_, err = z.run()
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %w", handler, err)
+	}
+	return
+}
+
 // ValidatePackagingRequest calls the app for a validation packaging request for an action
 func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
 	var code string
@@ -99,9 +239,9 @@ func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.run()
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
 		return
 	}
 	switch v := result.(type) {
@@ -123,14 +263,17 @@ func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 	return
 }
 
-func prepareZyEntryArgs(def *EntryDef, entry Entry, header *Header) (args string, err error) {
-	entryStr := entry.Content().(string)
+func prepareZyEntryArgs(h *Holochain, def *EntryDef, entry Entry, header *Header) (args string, err error) {
+	entryStr, err := entryContentString(entry.Content())
+	if err != nil {
+		return
+	}
 	switch def.DataFormat {
 	case DataFormatRawZygo:
 		args = entryStr
-	case DataFormatString:
+	case DataFormatString, DataFormatBinary:
 		args = "\"" + sanitizeZyString(entryStr) + "\""
-	case DataFormatLinks:
+	case DataFormatLinks, DataFormatCBOR:
 		fallthrough
 	case DataFormatJSON:
 		args = fmt.Sprintf(`(unjson (raw "%s"))`, sanitizeZyString(entryStr))
@@ -139,30 +282,45 @@ func prepareZyEntryArgs(def *EntryDef, entry Entry, header *Header) (args string
 		return
 	}
 
-	var hdr string
-	if header != nil {
-		hdr = fmt.Sprintf(
-			`(hash EntryLink:"%s" Type:"%s" Time:"%s")`,
-			header.EntryLink.String(),
-			header.Type,
-			header.Time.UTC().Format(time.RFC3339),
-		)
-	} else {
-		hdr = `""`
-	}
-
-	args += " " + hdr
+	args += " " + zyHeader(h, header)
 	return
 }
 
-func prepareZyValidateArgs(action Action, def *EntryDef) (args string, err error) {
+// zyHeader returns the zygo code for the header fields passed to validation functions
+func zyHeader(h *Holochain, header *Header) string {
+	if header == nil {
+		return `""`
+	}
+	var meta string
+	if len(header.Meta) > 0 {
+		j, err := json.Marshal(header.Meta)
+		if err == nil {
+			meta = fmt.Sprintf(` Meta:(unjson (raw "%s"))`, sanitizeZyString(string(j)))
+		}
+	}
+	if stamps := headerTimestamps(h, header); len(stamps) > 0 {
+		j, err := json.Marshal(stamps)
+		if err == nil {
+			meta += fmt.Sprintf(` Timestamps:(unjson (raw "%s"))`, sanitizeZyString(string(j)))
+		}
+	}
+	return fmt.Sprintf(
+		`(hash EntryLink:"%s" Type:"%s" Time:"%s"%s)`,
+		header.EntryLink.String(),
+		header.Type,
+		header.Time.UTC().Format(time.RFC3339),
+		meta,
+	)
+}
+
+func prepareZyValidateArgs(h *Holochain, action Action, def *EntryDef) (args string, err error) {
 	switch t := action.(type) {
 	case *ActionCommit:
-		args, err = prepareZyEntryArgs(def, t.entry, t.header)
+		args, err = prepareZyEntryArgs(h, def, t.entry, t.header)
 	case *ActionPut:
-		args, err = prepareZyEntryArgs(def, t.entry, t.header)
+		args, err = prepareZyEntryArgs(h, def, t.entry, t.header)
 	case *ActionMod:
-		args, err = prepareZyEntryArgs(def, t.entry, t.header)
+		args, err = prepareZyEntryArgs(h, def, t.entry, t.header)
 		if err == nil {
 			args += fmt.Sprintf(` "%s"`, t.replaces.String())
 		}
@@ -174,6 +332,8 @@ func prepareZyValidateArgs(action Action, def *EntryDef) (args string, err error
 		if err == nil {
 			args = fmt.Sprintf(`"%s" (unjson (raw "%s"))`, t.validationBase.String(), sanitizeZyString(string(j)))
 		}
+	case *ActionSetStatus:
+		args = fmt.Sprintf(`"%s" "%s"`, t.entry.Hash.String(), sanitizeZyString(t.entry.Status))
 	default:
 		err = fmt.Errorf("can't prepare args for %T: ", t)
 		return
@@ -181,21 +341,31 @@ func prepareZyValidateArgs(action Action, def *EntryDef) (args string, err error
 	return
 }
 
-func buildZyValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (code string, err error) {
+// buildZyValidateAction builds the call of the validation function for the action, with
+// the validator's props in the package if given
+func buildZyValidateAction(h *Holochain, action Action, def *EntryDef, pkg *ValidationPackage, validator *ValidatorProps, sources []string) (code string, err error) {
 	fnName := "validate" + strings.Title(action.Name())
 	var args string
-	args, err = prepareZyValidateArgs(action, def)
+	args, err = prepareZyValidateArgs(h, action, def)
 	if err != nil {
 		return
 	}
 	srcs := mkZySources(sources)
 
+	if pkg == nil {
+		pkg = &ValidationPackage{}
+	}
 	var pkgObj string
-	if pkg == nil || pkg.Chain == nil {
+	if pkg.Chain == nil && pkg.Rate == nil && validator == nil {
 		pkgObj = "(hash)"
 	} else {
+		// the rate and validator are added alongside the chain's fields
 		var j []byte
-		j, err = json.Marshal(pkg.Chain)
+		j, err = json.Marshal(struct {
+			*Chain
+			Rate      *ChainRate      `json:",omitempty"`
+			Validator *ValidatorProps `json:",omitempty"`
+		}{pkg.Chain, pkg.Rate, validator})
 		if err != nil {
 			return
 		}
@@ -210,7 +380,11 @@ func buildZyValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 // ValidateAction builds the correct validation function based on the action an calls it
 func (z *ZygoRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
 	var code string
-	code, err = buildZyValidateAction(action, def, pkg, sources)
+	var validator *ValidatorProps
+	if z.h != nil {
+		validator = z.h.validatorProps()
+	}
+	code, err = buildZyValidateAction(z.h, action, def, pkg, validator, sources)
 	if err != nil {
 		return
 	}
@@ -231,14 +405,17 @@ func mkZySources(sources []string) (srcs string) {
 }
 
 func (z *ZygoRibosome) prepareValidateArgs(def *EntryDef, entry Entry, sources []string) (e string, srcs string, err error) {
-	c := entry.Content().(string)
+	c, err := entryContentString(entry.Content())
+	if err != nil {
+		return
+	}
 	// @todo handle JSON if schema type is different
 	switch def.DataFormat {
 	case DataFormatRawZygo:
 		e = c
-	case DataFormatString:
+	case DataFormatString, DataFormatBinary:
 		e = "\"" + sanitizeZyString(c) + "\""
-	case DataFormatLinks:
+	case DataFormatLinks, DataFormatCBOR:
 		fallthrough
 	case DataFormatJSON:
 		e = fmt.Sprintf(`(unjson (raw "%s"))`, sanitizeZyString(c))
@@ -255,9 +432,9 @@ func (z *ZygoRibosome) runValidate(fnName string, code string) (err error) {
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.run()
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = fmt.Errorf("Error executing %s: %w", fnName, err)
 		return
 	}
 	switch v := result.(type) {
@@ -281,24 +458,14 @@ func (z *ZygoRibosome) validateEntry(fnName string, def *EntryDef, entry Entry,
 		return
 	}
 
-	var hdr string
-	if header != nil {
-		hdr = fmt.Sprintf(
-			`(hash EntryLink:"%s" Type:"%s" Time:"%s")`,
-			header.EntryLink.String(),
-			header.Type,
-			header.Time.UTC().Format(time.RFC3339),
-		)
-	} else {
-		hdr = `""`
-	}
+	hdr := zyHeader(z.h, header)
 
 	code := fmt.Sprintf(`(%s "%s" %s %s %s)`, fnName, def.Name, e, hdr, srcs)
 	Debugf("%s: %s", fnName, code)
 
 	err = z.runValidate(fnName, code)
-	if err != nil && err == ValidationFailedErr {
-		err = fmt.Errorf("Invalid entry: %v", entry.Content())
+	if errors.Is(err, ErrValidationFailed) {
+		err = &ValidationError{Entry: entry.Content()}
 	}
 	return
 }
@@ -330,7 +497,7 @@ func (z *ZygoRibosome) Call(fn *FunctionDef, params interface{}) (result interfa
 	if err != nil {
 		return
 	}
-	result, err = z.env.Run()
+	result, err = z.run()
 	if err == nil {
 		switch fn.CallingType {
 		case STRING_CALLING:
@@ -366,16 +533,22 @@ const (
 		`(def HC_Status_Rejected ` + StatusRejectedVal + ")" +
 		`(def HC_Status_Deleted ` + StatusDeletedVal + ")" +
 		`(def HC_Status_Modified ` + StatusModifiedVal + ")" +
+		`(def HC_Status_Pending ` + StatusPendingVal + ")" +
+		`(def HC_Status_Expired ` + StatusExpiredVal + ")" +
 		`(def HC_Status_Any ` + StatusAnyVal + ")" +
 		`(def HC_GetMask_Default ` + GetMaskDefaultStr + ")" +
 		`(def HC_GetMask_Entry ` + GetMaskEntryStr + ")" +
 		`(def HC_GetMask_EntryType ` + GetMaskEntryTypeStr + ")" +
 		`(def HC_GetMask_Sources ` + GetMaskSourcesStr + ")" +
+		`(def HC_GetMask_History ` + GetMaskHistoryStr + ")" +
+		`(def HC_GetMask_Meta ` + GetMaskMetaStr + ")" +
+		`(def HC_GetMask_Header ` + GetMaskHeaderStr + ")" +
 		`(def HC_GetMask_All ` + GetMaskAllStr + ")" +
 
 		`(def HC_LinkAction_Add "` + AddAction + "\")" +
 		`(def HC_LinkAction_Del "` + DelAction + "\")" +
 		`(def HC_PkgReq_Chain "` + PkgReqChain + "\")" +
+		`(def HC_PkgReq_Rate "` + PkgReqRate + "\")" +
 		`(def HC_PkgReq_ChainOpt_None "` + PkgReqChainOptNoneStr + "\")" +
 		`(def HC_PkgReq_ChainOpt_Headers "` + PkgReqChainOptHeadersStr + "\")" +
 		`(def HC_PkgReq_ChainOpt_Entries "` + PkgReqChainOptEntriesStr + "\")" +
@@ -403,119 +576,88 @@ func cleanZygoJson(s string) string {
 	return s
 }
 
-func zyProcessArgs(args []Arg, zyArgs []zygo.Sexp) (err error) {
-	err = checkArgCount(args, len(zyArgs))
-	if err != nil {
-		return err
+// zyArg adapts a zygo value for processArgs
+type zyArg struct {
+	s zygo.Sexp
+}
+
+func (a zyArg) kind() argKind {
+	switch a.s.(type) {
+	case *zygo.SexpStr:
+		return argStr
+	case *zygo.SexpInt:
+		return argNumber
+	case *zygo.SexpBool:
+		return argBool
+	case *zygo.SexpHash:
+		return argObject
+	case *zygo.SexpArray:
+		return argArray
 	}
+	return argOther
+}
 
-	// check arg types
-	for i, a := range zyArgs {
-		switch args[i].Type {
-		case StringArg:
-			var str string
-			switch t := a.(type) {
-			case *zygo.SexpStr:
-				str = t.S
-				args[i].value = str
-			default:
-				return argErr("string", i+1, args[i])
-			}
-		case HashArg:
-			switch t := a.(type) {
-			case *zygo.SexpStr:
-				var hash Hash
-				hash, err = NewHash(t.S)
-				if err != nil {
-					return
-				}
-				args[i].value = hash
-			default:
-				return argErr("string", i+1, args[i])
-			}
-		case IntArg:
-			var integer int64
-			switch t := a.(type) {
-			case *zygo.SexpInt:
-				integer = t.Val
-				args[i].value = integer
-			default:
-				return argErr("int", i+1, args[i])
-			}
-		case BoolArg:
-			var boolean bool
-			switch t := a.(type) {
-			case *zygo.SexpBool:
-				boolean = t.Val
-				args[i].value = boolean
-			default:
-				return argErr("boolean", i+1, args[i])
-			}
-		case ArgsArg:
-			switch t := a.(type) {
-			case *zygo.SexpStr:
-				args[i].value = t.S
-			case *zygo.SexpHash:
-				args[i].value = cleanZygoJson(zygo.SexpToJson(t))
-			default:
-				return argErr("string or hash", i+1, args[i])
-			}
-		case EntryArg:
-			switch t := a.(type) {
-			case *zygo.SexpStr:
-				args[i].value = t.S
-			case *zygo.SexpHash:
-				args[i].value = cleanZygoJson(zygo.SexpToJson(t))
-			default:
-				return argErr("string or hash", i+1, args[i])
-			}
-		case MapArg:
-			switch t := a.(type) {
-			case *zygo.SexpHash:
-				j := cleanZygoJson(zygo.SexpToJson(t))
-				m := make(map[string]interface{})
-				var err = json.Unmarshal([]byte(j), &m)
-				if err != nil {
-					return err
-				}
-				args[i].value = m
-			default:
-				return argErr("hash", i+1, args[i])
-			}
-		case ToStrArg:
-			var str string
+func (a zyArg) str() string { return a.s.(*zygo.SexpStr).S }
 
-			switch t := a.(type) {
-			case *zygo.SexpStr:
-				str = t.S
-			case *zygo.SexpInt:
-				str = fmt.Sprintf("%d", t.Val)
-			case *zygo.SexpBool:
-				if t.Val {
-					str = "true"
-				} else {
-					str = "false"
-				}
-			case *zygo.SexpHash:
-				str = cleanZygoJson(zygo.SexpToJson(t))
-			case *zygo.SexpArray:
-				str = cleanZygoJson(zygo.SexpToJson(t))
-			default:
-				return argErr("int, boolean, string, array or hash", i+1, args[i])
-			}
-			args[i].value = str
+func (a zyArg) integer() (int64, error) { return a.s.(*zygo.SexpInt).Val, nil }
+
+func (a zyArg) boolean() (bool, error) { return a.s.(*zygo.SexpBool).Val, nil }
+
+func (a zyArg) json() (string, error) { return cleanZygoJson(zygo.SexpToJson(a.s)), nil }
+
+func (a zyArg) export() (v interface{}, err error) {
+	m := make(map[string]interface{})
+	err = json.Unmarshal([]byte(cleanZygoJson(zygo.SexpToJson(a.s))), &m)
+	v = m
+	return
+}
+
+func (a zyArg) toStr() (str string, ok bool) {
+	ok = true
+	switch t := a.s.(type) {
+	case *zygo.SexpStr:
+		str = t.S
+	case *zygo.SexpInt:
+		str = fmt.Sprintf("%d", t.Val)
+	case *zygo.SexpBool:
+		if t.Val {
+			str = "true"
+		} else {
+			str = "false"
 		}
+	default:
+		ok = false
+	}
+	return
+}
+
+func (a zyArg) objectName() string { return "hash" }
+
+// zyProcessArgs processes zyArgs according to the args spec filling args[].value with the converted value
+func zyProcessArgs(args []Arg, zyArgs []zygo.Sexp) (err error) {
+	vals := make([]argValue, len(zyArgs))
+	for i, s := range zyArgs {
+		vals[i] = zyArg{s}
 	}
+	err = processArgs(args, vals)
+	return
+}
 
+// zyProcessActionArgs processes the args of a call to the action's built-in function
+func zyProcessActionArgs(a BuiltinAction, args []Arg, zyArgs []zygo.Sexp) (err error) {
+	err = actionArgsErr(a, args, zyProcessArgs(args, zyArgs))
 	return
 }
 
 // NewZygoRibosome factory function to build a zygo execution environment for a zome
 func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z := ZygoRibosome{
-		zome: zome,
-		env:  zygo.NewGlispSandbox(),
+		h:     h,
+		zome:  zome,
+		env:   zygo.NewGlispSandbox(),
+		abort: make(chan error, 1),
 	}
+	z.env.AddPreHook(z.checkAbort)
 
 	z.env.AddFunction("version",
 		func(env *zygo.Glisp, name string, args []zygo.Sexp) (zygo.Sexp, error) {
@@ -530,7 +672,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionProperty{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -538,7 +680,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			a.prop = args[0].value.(string)
 
 			var p interface{}
-			p, err = a.Do(h)
+			p, err = h.doAction(z.zome.Name, a, args...)
 
 			if err != nil {
 				return zygo.SexpNull, err
@@ -547,16 +689,38 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &result, err
 		})
 
+	z.env.AddFunction("config",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionConfig{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+
+			a.key = args[0].value.(string)
+
+			var v interface{}
+			v, err = h.doAction(z.zome.Name, a, args...)
+			if errors.Is(err, ErrZomeConfigNotSet) {
+				return zygo.SexpNull, nil
+			}
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			return &zygo.SexpStr{S: v.(string)}, nil
+		})
+
 	z.env.AddFunction("debug",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionDebug{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
 			a.msg = args[0].value.(string)
-			a.Do(h)
+			h.doAction(z.zome.Name, a, args...)
 			return zygo.SexpNull, err
 		})
 
@@ -564,13 +728,13 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionMakeHash{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
 			a.entry = &GobEntry{C: args[0].value.(string)}
 			var r interface{}
-			r, err = a.Do(h)
+			r, err = h.doAction(z.zome.Name, a, args...)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -582,11 +746,360 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &result, nil
 		})
 
+	z.env.AddFunction("entryToken",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionEntryToken{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.hash = args[0].value.(Hash)
+			var r interface{}
+			r, err = h.doAction(z.zome.Name, a, args...)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			return &zygo.SexpStr{S: r.(string)}, nil
+		})
+
+	z.env.AddFunction("pin",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionPin{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.hash = args[0].value.(Hash)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("unpin",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionUnpin{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.hash = args[0].value.(Hash)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("localStoreSet",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionLocalStoreSet{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.key = args[0].value.(string)
+			a.value = args[1].value.(string)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("localStoreGet",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionLocalStoreGet{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.key = args[0].value.(string)
+			var r interface{}
+			r, err = h.doAction(z.zome.Name, a, args...)
+			if errors.Is(err, ErrLocalKeyNotFound) {
+				return zygo.SexpNull, nil
+			}
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			return &zygo.SexpStr{S: r.(string)}, nil
+		})
+
+	z.env.AddFunction("localStoreDel",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionLocalStoreDel{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.key = args[0].value.(string)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			if errors.Is(err, ErrLocalKeyNotFound) {
+				err = nil
+			}
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("streamWrite",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionStreamWrite{w: z.stream}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.data = args[0].value.(string)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("spawnTask",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionSpawnTask{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.function = args[0].value.(string)
+			a.args = args[1].value.(string)
+			r, err := h.doAction(z.zome.Name, a, args...)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			return &zygo.SexpStr{S: r.(string)}, nil
+		})
+
+	z.env.AddFunction("taskProgress",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionTaskProgress{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.id = args[0].value.(string)
+			a.progress = int(args[1].value.(int64))
+			a.message = args[2].value.(string)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("getTask",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionGetTask{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.id = args[0].value.(string)
+			r, err := h.doAction(z.zome.Name, a, args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				var j []byte
+				j, err = json.Marshal(r)
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("getMessageStatus",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionGetMessageStatus{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.id = args[0].value.(string)
+			r, err := h.doAction(z.zome.Name, a, args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				var j []byte
+				j, err = json.Marshal(r)
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("makeProof",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionMakeProof{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.entryType = args[0].value.(string)
+			a.field = args[1].value.(string)
+			a.setValue(args[2].value.(string))
+			r, err := h.doAction(z.zome.Name, a, args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				var j []byte
+				j, err = json.Marshal(r)
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("verifyProof",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionVerifyProof{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			var resultValue zygo.Sexp = zygo.SexpNull
+			err = json.Unmarshal([]byte(args[0].value.(string)), &a.proof)
+			if err == nil {
+				var r interface{}
+				r, err = h.doAction(z.zome.Name, a, args...)
+				if err == nil {
+					var j []byte
+					j, err = json.Marshal(r)
+					if err == nil {
+						resultValue = &zygo.SexpStr{S: string(j)}
+					}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("publish",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionPublish{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.channel = args[0].value.(string)
+			a.msg = args[1].value.(string)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("subscribe",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionSubscribe{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.channel = args[0].value.(string)
+			a.handler = args[1].value.(string)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("unsubscribe",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionUnsubscribe{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.channel = args[0].value.(string)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("emit",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionEmit{zome: z.zome.Name}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.signal = args[0].value.(string)
+			a.payload = args[1].value.(string)
+			_, err = h.doAction(z.zome.Name, a, args...)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("getOnlineAgents",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionGetOnlineAgents{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			r, err := h.doAction(z.zome.Name, a, args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				var j []byte
+				j, err = json.Marshal(r)
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("query",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionQuery{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			options := QueryOptions{}
+			if len(zyargs) == 1 {
+				err = decodeOptions(a.Name(), args[0].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+				if err != nil {
+					return zygo.SexpNull, err
+				}
+			}
+			r, err := h.doAction(z.zome.Name, NewQueryAction(&options), args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				var j []byte
+				j, err = json.Marshal(r)
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("getBridges",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionGetBridges{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			r, err := h.doAction(z.zome.Name, a, args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				var j []byte
+				j, err = json.Marshal(r)
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
 	z.env.AddFunction("send",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionSend{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -603,11 +1116,17 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return zygo.SexpNull, err
 			}
 
+			if len(zyargs) == 3 {
+				err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &a.options, &h.config.Loggers.App)
+				if err != nil {
+					return zygo.SexpNull, err
+				}
+			}
 			a.msg.ZomeType = z.zome.Name
 			a.msg.Body = string(j)
 
 			var r interface{}
-			r, err = a.Do(h)
+			r, err = h.doAction(z.zome.Name, a, args...)
 			var resp zygo.Sexp
 			if err == nil {
 				resp = &zygo.SexpStr{S: r.(string)}
@@ -619,7 +1138,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionCall{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -647,26 +1166,53 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				a.args = args[2].value.(string)
 			}
 			var r interface{}
-			r, err = a.Do(h)
+			r, err = h.doAction(z.zome.Name, a, args...)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
 			return &zygo.SexpStr{S: r.(string)}, err
 		})
 
+	z.env.AddFunction("bridge",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionBridge{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.toApp = args[0].value.(string)
+			a.zome = args[1].value.(string)
+			a.function = args[2].value.(string)
+			a.args = args[3].value.(string)
+			var r interface{}
+			r, err = h.doAction(z.zome.Name, a, args...)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			return &zygo.SexpStr{S: fmt.Sprintf("%v", r)}, err
+		})
+
 	z.env.AddFunction("commit",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionCommit{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
 			entryType := args[0].value.(string)
 			entry := args[1].value.(string)
+			var options CommitOptions
+			if len(zyargs) == 3 {
+				err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+				if err != nil {
+					return zygo.SexpNull, err
+				}
+			}
 			var r interface{}
 			e := GobEntry{C: entry}
-			r, err = NewCommitAction(entryType, &e).Do(h)
+			r, err = h.doAction(z.zome.Name, NewCommitActionWithOptions(entryType, &e, options), args...)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -682,41 +1228,21 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionGet{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
 			options := GetOptions{StatusMask: StatusDefault, GetMask: GetMaskDefault}
 			if len(zyargs) == 2 {
-				opts := args[1].value.(map[string]interface{})
-				mask, ok := opts["StatusMask"]
-				if ok {
-					maskval, ok := mask.(float64)
-					if !ok {
-						return zygo.SexpNull,
-							fmt.Errorf("expecting int StatusMask attribute, got %T", mask)
-					}
-					options.StatusMask = int(maskval)
-				}
-				mask, ok = opts["GetMask"]
-				if ok {
-					maskval, ok := mask.(float64)
-					if !ok {
-						return zygo.SexpNull,
-							fmt.Errorf("expecting int GetMask attribute, got %T", mask)
-					}
-					options.GetMask = int(maskval)
-				}
-				local, ok := opts["Local"]
-				if ok {
-					options.Local = local.(bool)
+				err = decodeOptions(a.Name(), args[1].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+				if err != nil {
+					return zygo.SexpNull, err
 				}
-
 			}
 			req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
 
 			var r interface{}
-			r, err = NewGetAction(req, &options).Do(h)
+			r, err = h.doAction(z.zome.Name, NewGetAction(req, &options), args...)
 			mask := options.GetMask
 			if mask == GetMaskDefault {
 				mask = GetMaskEntry
@@ -725,17 +1251,27 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			resultValue = zygo.SexpNull
 			if err == nil {
 				getResp := r.(GetResp)
+				if getResp.Header != nil && options.GetMask == GetMaskDefault {
+					mask = GetMaskHeader
+				}
 				var entryStr string
 				var singleValueReturn bool
+				var j []byte
 				if mask&GetMaskEntry != 0 {
-					j, err := json.Marshal(getResp.Entry.Content())
-					if err == nil {
-						if GetMaskEntry == mask {
-							singleValueReturn = true
-							resultValue = &zygo.SexpStr{S: string(j)}
-						} else {
-							entryStr = string(j)
-						}
+					var c string
+					c, err = entryContentString(getResp.Entry.Content())
+					if err != nil {
+						return zygo.SexpNull, err
+					}
+					j, err = json.Marshal(c)
+					if err != nil {
+						return zygo.SexpNull, err
+					}
+					if GetMaskEntry == mask {
+						singleValueReturn = true
+						resultValue = &zygo.SexpStr{S: string(j)}
+					} else {
+						entryStr = string(j)
 					}
 				}
 				if mask&GetMaskEntryType != 0 {
@@ -756,6 +1292,46 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 						resultValue = zSources
 					}
 				}
+				var historyStr string
+				if wantsHistory(mask) {
+					j, err = json.Marshal(getResp.History)
+					if err != nil {
+						return zygo.SexpNull, err
+					}
+					historyStr = string(j)
+					if GetMaskHistory == mask {
+						singleValueReturn = true
+						resultValue = &zygo.SexpStr{S: historyStr}
+					}
+				}
+				var metaStr string
+				if mask&GetMaskMeta != 0 {
+					j, err = json.Marshal(getResp.Meta)
+					if err != nil {
+						return zygo.SexpNull, err
+					}
+					metaStr = string(j)
+					if GetMaskMeta == mask {
+						singleValueReturn = true
+						resultValue = &zygo.SexpStr{S: metaStr}
+					}
+				}
+				var headerStr string
+				if mask&GetMaskHeader != 0 {
+					var header interface{}
+					if getResp.Header != nil {
+						header = toJSHeader(z.h, getResp.Header)
+					}
+					j, err = json.Marshal(header)
+					if err != nil {
+						return zygo.SexpNull, err
+					}
+					headerStr = string(j)
+					if GetMaskHeader == mask {
+						singleValueReturn = true
+						resultValue = &zygo.SexpStr{S: headerStr}
+					}
+				}
 				if err == nil && !singleValueReturn {
 					// build the return object
 					var respObj *zygo.SexpHash
@@ -771,6 +1347,15 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 						if mask&GetMaskSources != 0 {
 							err = respObj.HashSet(env.MakeSymbol("Sources"), zSources)
 						}
+						if wantsHistory(mask) {
+							err = respObj.HashSet(env.MakeSymbol("History"), &zygo.SexpStr{S: historyStr})
+						}
+						if mask&GetMaskMeta != 0 {
+							err = respObj.HashSet(env.MakeSymbol("Meta"), &zygo.SexpStr{S: metaStr})
+						}
+						if mask&GetMaskHeader != 0 {
+							err = respObj.HashSet(env.MakeSymbol("Header"), &zygo.SexpStr{S: headerStr})
+						}
 					}
 				}
 			}
@@ -782,7 +1367,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionMod{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -791,7 +1376,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			replaces := args[2].value.(Hash)
 
 			entry := GobEntry{C: entryStr}
-			resp, err := NewModAction(entryType, &entry, replaces).Do(h)
+			resp, err := h.doAction(z.zome.Name, NewModAction(entryType, &entry, replaces), args...)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -807,7 +1392,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionDel{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -817,7 +1402,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			}
 			header, err := h.chain.GetEntryHeader(entry.Hash)
 			if err == nil {
-				resp, err := NewDelAction(header.Type, entry).Do(h)
+				resp, err := h.doAction(z.zome.Name, NewDelAction(header.Type, entry), args...)
 				if err != nil {
 					return zygo.SexpNull, err
 				}
@@ -830,11 +1415,37 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return zygo.SexpNull, err
 		})
 
+	z.env.AddFunction("setStatus",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			var a Action = &ActionSetStatus{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			entry := StatusEntry{
+				Hash:   args[0].value.(Hash),
+				Status: args[1].value.(string),
+			}
+			if args[2].value != nil {
+				entry.Message = args[2].value.(string)
+			}
+			entryType, err := h.entryTypeOf(z.zome.Name, entry.Hash)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			resp, err := h.doAction(z.zome.Name, NewSetStatusAction(entryType, entry), args...)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			return &zygo.SexpStr{S: hashResult(resp)}, nil
+		})
+
 	z.env.AddFunction("getLink",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionGetLink{}
 			args := a.Args()
-			err := zyProcessArgs(args, zyargs)
+			err := zyProcessActionArgs(a, args, zyargs)
 			if err != nil {
 				return zygo.SexpNull, err
 			}
@@ -843,35 +1454,125 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 
 			options := GetLinkOptions{Load: false, StatusMask: StatusLive}
 			if len(zyargs) == 3 {
-				opts := args[2].value.(map[string]interface{})
-				load, ok := opts["Load"]
-				if ok {
-					loadval, ok := load.(bool)
-					if !ok {
-						return zygo.SexpNull,
-							fmt.Errorf("expecting boolean Load attribute in object, got %T", load)
-					}
-					options.Load = loadval
-				}
-				mask, ok := opts["StatusMask"]
-				if ok {
-					maskval, ok := mask.(float64)
-					if !ok {
-						return zygo.SexpNull,
-							fmt.Errorf("expecting int StatusMask attribute in object, got %T", mask)
-					}
-					options.StatusMask = int(maskval)
+				err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+				if err != nil {
+					return zygo.SexpNull, err
 				}
 			}
 
 			var r interface{}
-			r, err = NewGetLinkAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, &options).Do(h)
+			r, err = h.doAction(z.zome.Name, NewGetLinkAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask, Limit: options.Limit, Cursor: options.Cursor, SortBy: options.SortBy}, &options), args...)
 			var resultValue zygo.Sexp
 			if err == nil {
 				response := r.(*LinkQueryResp)
 				resultValue = zygo.SexpNull
 				var j []byte
-				j, err = json.Marshal(response.Links)
+				if options.Limit > 0 || options.Cursor != "" {
+					// pages come with the cursor for the next page
+					j, err = json.Marshal(response)
+				} else {
+					j, err = json.Marshal(response.Links)
+				}
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("getBacklinks",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionGetBacklinks{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			target := args[0].value.(Hash)
+			tag := args[1].value.(string)
+
+			options := GetLinkOptions{Load: false, StatusMask: StatusLive}
+			if len(zyargs) == 3 {
+				err = decodeOptions(a.Name(), args[2].value.(map[string]interface{}), &options, &h.config.Loggers.App)
+				if err != nil {
+					return zygo.SexpNull, err
+				}
+			}
+
+			r, err := h.doAction(z.zome.Name, NewGetBacklinksAction(target, tag, &options), args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				var j []byte
+				j, err = json.Marshal(r.(*LinkQueryResp).Links)
+				if err == nil {
+					resultValue = &zygo.SexpStr{S: string(j)}
+				}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("countLinks",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionCountLinks{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.base = args[0].value.(Hash)
+			a.tag = args[1].value.(string)
+			r, err := h.doAction(z.zome.Name, a, args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				resultValue = &zygo.SexpInt{Val: int64(r.(int))}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("linkExists",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionLinkExists{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.base = args[0].value.(Hash)
+			a.tag = args[1].value.(string)
+			a.target = args[2].value.(Hash)
+			r, err := h.doAction(z.zome.Name, a, args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				resultValue = &zygo.SexpBool{Val: r.(bool)}
+			}
+			return makeResult(env, resultValue, err)
+		})
+
+	z.env.AddFunction("getLinks",
+		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &ActionGetLinks{}
+			args := a.Args()
+			err := zyProcessActionArgs(a, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			if err = a.setSpecs(args[0].value.(string)); err != nil {
+				return zygo.SexpNull, err
+			}
+
+			a.options = &GetLinkOptions{Load: false, StatusMask: StatusLive}
+			if len(zyargs) == 2 {
+				err = decodeOptions(a.Name(), args[1].value.(map[string]interface{}), a.options, &h.config.Loggers.App)
+				if err != nil {
+					return zygo.SexpNull, err
+				}
+			}
+
+			r, err := h.doAction(z.zome.Name, a, args...)
+			var resultValue zygo.Sexp = zygo.SexpNull
+			if err == nil {
+				var j []byte
+				j, err = json.Marshal(r)
 				if err == nil {
 					resultValue = &zygo.SexpStr{S: string(j)}
 				}
@@ -882,6 +1583,9 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	l := ZygoLibrary
 	if h != nil {
 		l += fmt.Sprintf(`(def App_Name "%s")(def App_DNA_Hash "%s")(def App_Agent_Hash "%s")(def App_Agent_String "%s")(def App_Key_Hash "%s")`, h.nucleus.dna.Name, h.dnaHash, h.agentHash, h.Agent().Name(), h.nodeIDStr)
+		for i, s := range h.nucleus.dna.Statuses {
+			l += fmt.Sprintf(`(def HC_Status_%s %d)`, s.Name, StatusCustom<<uint(i))
+		}
 	}
 	z.library = l
 
@@ -902,7 +1606,7 @@ func (z *ZygoRibosome) Run(code string) (result interface{}, err error) {
 		return
 	}
 	var sexp zygo.Sexp
-	sexp, err = z.env.Run()
+	sexp, err = z.run()
 	if err != nil {
 		err = errors.New("Zygomys exec error: " + err.Error())
 		return
@@ -2,10 +2,12 @@ package holochain
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	zygo "github.com/glycerine/zygomys/repl"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
 func TestNewZygoRibosome(t *testing.T) {
@@ -130,6 +132,43 @@ func TestNewZygoRibosome(t *testing.T) {
 
 		})
 
+		Convey("localStore", func() {
+			_, err = z.Run(`(localStoreGet "count")`)
+			So(err, ShouldBeNil)
+			So(z.lastResult, ShouldEqual, zygo.SexpNull)
+
+			_, err = z.Run(`(localStoreSet "count" 3)`)
+			So(err, ShouldBeNil)
+			_, err = z.Run(`(localStoreGet "count")`)
+			So(err, ShouldBeNil)
+			So(z.lastResult.(*zygo.SexpStr).S, ShouldEqual, "3")
+
+			_, err = z.Run(`(localStoreDel "count")`)
+			So(err, ShouldBeNil)
+			_, err = h.dht.localStoreGet("zySampleZome", "count")
+			So(err, ShouldEqual, ErrLocalKeyNotFound)
+		})
+
+		Convey("spawnTask", func() {
+			_, err = z.Run(`(spawnTask "testStrFn1" "x")`)
+			So(err, ShouldBeNil)
+			id := z.lastResult.(*zygo.SexpStr).S
+			task := waitForTask(h, id)
+			So(task.Result, ShouldEqual, "result: x")
+
+			_, err = z.Run(`(taskProgress "` + id + `" 10 "ten")`)
+			So(err, ShouldBeNil)
+			_, err = z.Run(`(getTask "` + id + `")`)
+			So(err, ShouldBeNil)
+			sh := z.lastResult.(*zygo.SexpHash)
+			r, err := sh.HashGet(z.env, z.env.MakeSymbol("result"))
+			So(err, ShouldBeNil)
+			So(r.(*zygo.SexpStr).S, ShouldContainSubstring, `"Message":"ten"`)
+
+			_, err = z.Run(`(spawnTask "foo" "x")`)
+			So(err.Error(), ShouldContainSubstring, "unknown exposed function: foo")
+		})
+
 		// add entries onto the chain to get hash values for testing
 		hash := commit(h, "oddNumbers", "3")
 		profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
@@ -193,6 +232,38 @@ func TestZygoGenesis(t *testing.T) {
 	})
 }
 
+func TestZygoExecutionTimeout(t *testing.T) {
+	zome := &Zome{RibosomeType: ZygoRibosomeType, ExecutionTimeout: "100ms", Code: `(defn genesis [] (for [(def i 0) true (set i (+ i 1))] i))`}
+	v, err := NewZygoRibosome(nil, zome)
+	if err != nil {
+		panic(err)
+	}
+	z := v.(*ZygoRibosome)
+
+	Convey("code running past the zome's execution timeout should be aborted", t, func() {
+		start := time.Now()
+		err := z.ChainGenesis()
+		So(errors.Is(err, ErrRibosomeTimeout), ShouldBeTrue)
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+	})
+
+	Convey("the ribosome should be usable after being aborted", t, func() {
+		_, err := z.Run(`(+ 1 2)`)
+		So(err, ShouldBeNil)
+		So(z.lastResult.(*zygo.SexpInt).Val, ShouldEqual, 3)
+	})
+
+	Convey("running code should be interruptible", t, func() {
+		zome.ExecutionTimeout = ""
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			z.Interrupt()
+		}()
+		err := z.ChainGenesis()
+		So(errors.Is(err, errZyInterrupted), ShouldBeTrue)
+	})
+}
+
 func TestZyReceive(t *testing.T) {
 	Convey("it should call a receive function that returns a hash", t, func() {
 		z, _ := NewZygoRibosome(nil, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn receive [from msg] (hash %foo (hget msg %bar)))`})
@@ -228,7 +299,7 @@ func TestZybuildValidate(t *testing.T) {
 	def := EntryDef{Name: "oddNumbers", DataFormat: DataFormatString}
 
 	Convey("it should build commit", t, func() {
-		code, err := buildZyValidateAction(a, &def, nil, []string{"fake_src_hash"})
+		code, err := buildZyValidateAction(nil, a, &def, nil, nil, []string{"fake_src_hash"})
 		So(err, ShouldBeNil)
 		So(code, ShouldEqual, `(validateCommit "oddNumbers" "3" (hash EntryLink:"" Type:"" Time:"0001-01-01T00:00:00Z") (hash) (unjson (raw "[\"fake_src_hash\"]")))`)
 	})
@@ -236,7 +307,7 @@ func TestZybuildValidate(t *testing.T) {
 		a := NewPutAction("evenNumbers", &e, &header)
 		pkg, _ := MakePackage(h, PackagingReq{PkgReqChain: int64(PkgReqChainOptFull)})
 		vpkg, _ := MakeValidationPackage(h, &pkg)
-		_, err := buildZyValidateAction(a, &def, vpkg, []string{"fake_src_hash"})
+		_, err := buildZyValidateAction(nil, a, &def, vpkg, nil, []string{"fake_src_hash"})
 		So(err, ShouldBeNil)
 		//So(code, ShouldEqual, `validatePut("evenNumbers","2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"},pgk,["fake_src_hash"])`)
 	})
@@ -249,14 +320,14 @@ func TestZyValidateCommit(t *testing.T) {
 	hdr := mkTestHeader("evenNumbers")
 
 	Convey("it should be passing in the correct values", t, func() {
-		v, err := NewZygoRibosome(&h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn validateCommit [name entry header pkg sources] (debug name) (debug entry) (debug header) (debug sources) (debug pkg) true)`})
+		v, err := NewZygoRibosome(&h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn validateCommit [name entry header pkg sources] (debug name) (debug entry) (debug header) (debug sources) (debug (hget (hget pkg %Validator) %Key)) true)`})
 		So(err, ShouldBeNil)
 		d := EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
 		ShouldLog(&h.config.Loggers.App, `evenNumbers
 foo
 {"EntryLink":"QmNiCwBNA8MWDADTFVq1BonUEJbS2SvjAoNkZZrhEwcuU2", "Type":"evenNumbers", "Time":"1970-01-01T00:00:01Z"}
 ["fakehashvalue"]
-{"Atype":"hash"}
+`+h.nodeIDStr+`
 `, func() {
 			a := NewCommitAction("oddNumbers", &GobEntry{C: "foo"})
 			a.header = &hdr
@@ -317,7 +388,7 @@ func TestPrepareZyValidateArgs(t *testing.T) {
 		a := NewCommitAction("oddNumbers", &e)
 		var header Header
 		a.header = &header
-		args, err := prepareZyValidateArgs(a, &d)
+		args, err := prepareZyValidateArgs(nil, a, &d)
 		So(err, ShouldBeNil)
 		So(args, ShouldEqual, `"3" (hash EntryLink:"" Type:"" Time:"0001-01-01T00:00:00Z")`)
 	})
@@ -326,7 +397,7 @@ func TestPrepareZyValidateArgs(t *testing.T) {
 		var header Header
 		a := NewPutAction("oddNumbers", &e, &header)
 
-		args, err := prepareZyValidateArgs(a, &d)
+		args, err := prepareZyValidateArgs(nil, a, &d)
 		So(err, ShouldBeNil)
 		So(args, ShouldEqual, `"3" (hash EntryLink:"" Type:"" Time:"0001-01-01T00:00:00Z")`)
 	})
@@ -336,7 +407,7 @@ func TestPrepareZyValidateArgs(t *testing.T) {
 		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2") // fake hash for previous
 		a := NewModAction("oddNumbers", &e, hash)
 		a.header = &header
-		args, err := prepareZyValidateArgs(a, &d)
+		args, err := prepareZyValidateArgs(nil, a, &d)
 		So(err, ShouldBeNil)
 		So(args, ShouldEqual, `"7" (hash EntryLink:"" Type:"foo" Time:"0001-01-01T00:00:00Z") "QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2"`)
 	})
@@ -344,7 +415,7 @@ func TestPrepareZyValidateArgs(t *testing.T) {
 		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2")
 		entry := DelEntry{Hash: hash, Message: "expired"}
 		a := NewDelAction("profile", entry)
-		args, err := prepareZyValidateArgs(a, &d)
+		args, err := prepareZyValidateArgs(nil, a, &d)
 		So(err, ShouldBeNil)
 		So(args, ShouldEqual, `"QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2"`)
 	})
@@ -352,7 +423,7 @@ func TestPrepareZyValidateArgs(t *testing.T) {
 		hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2")
 		a := NewLinkAction("oddNumbers", []Link{{Base: "QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5", Link: "QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5", Tag: "fish"}})
 		a.validationBase = hash
-		args, err := prepareZyValidateArgs(a, &d)
+		args, err := prepareZyValidateArgs(nil, a, &d)
 		So(err, ShouldBeNil)
 		So(args, ShouldEqual, `"QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2" (unjson (raw "[{\"LinkAction\":\"\",\"Base\":\"QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5\",\"Link\":\"QmdRXz53TVT9qBYfbXctHyy2GpTNa6YrpAy6ZcDGG8Xhc5\",\"Tag\":\"fish\"}]"))`)
 	})